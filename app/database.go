@@ -3,12 +3,12 @@ package app
 import (
 	"ePrometna_Server/config"
 	"ePrometna_Server/model"
+	"ePrometna_Server/util/search"
 	"os"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -28,7 +28,7 @@ func newDbConn() *gorm.DB {
 }
 
 func testDbConn() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("file:db?mode=memory&cache=shared"), &gorm.Config{
+	db, err := gorm.Open(search.OpenSqlite("file:db?mode=memory&cache=shared"), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
@@ -57,9 +57,24 @@ func dbSetup() {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	if err = migrateLegacyData(db); err != nil {
+		zap.S().Panicf("Can't migrate legacy data err = %+v", err)
+	}
 	if err = db.AutoMigrate(model.GetAllModels()...); err != nil {
 		zap.S().Panicf("Can't run AutoMigrate err = %+v", err)
 	}
+	if err = migrateActivationLookups(db); err != nil {
+		zap.S().Panicf("Can't hash activation code lookups err = %+v", err)
+	}
+	if err = migrateCompanyVehicles(db); err != nil {
+		zap.S().Panicf("Can't move company vehicles to organisations err = %+v", err)
+	}
+	if err = migrateTotpSecrets(db); err != nil {
+		zap.S().Panicf("Can't seal totp secrets err = %+v", err)
+	}
+	if err = createSearchIndexes(db); err != nil {
+		zap.S().Panicf("Can't create search indexes err = %+v", err)
+	}
 
 	Provide(dbConFunc)
 }
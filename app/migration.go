@@ -0,0 +1,336 @@
+package app
+
+import (
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/postal"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// legacyMobile has the device columns added to model.Mobile, they are nullable
+// so they can be added to existing rows before AutoMigrate adds constraints
+type legacyMobile struct {
+	Platform  string `gorm:"type:varchar(30)"`
+	Brand     string `gorm:"type:varchar(50)"`
+	ModelName string `gorm:"type:varchar(50)"`
+	DeviceId  string `gorm:"type:varchar(100)"`
+}
+
+func (legacyMobile) TableName() string {
+	return "mobiles"
+}
+
+// legacyPoliceUser has the police token column removed from model.User
+type legacyPoliceUser struct {
+	ID          uint
+	PoliceToken *string
+}
+
+func (legacyPoliceUser) TableName() string {
+	return "users"
+}
+
+// legacyResidenceUser has the free text residence replaced by model.User.Residence,
+// the address columns are nullable so they can be added to existing rows
+type legacyResidenceUser struct {
+	ID                   uint
+	Residence            string
+	ResidenceStreet      string `gorm:"type:varchar(255)"`
+	ResidenceHouseNumber string `gorm:"type:varchar(20)"`
+	ResidencePostalCode  string `gorm:"type:char(5)"`
+	ResidenceSettlement  string `gorm:"type:varchar(100)"`
+	ResidenceCounty      string `gorm:"type:varchar(100)"`
+}
+
+func (legacyResidenceUser) TableName() string {
+	return "users"
+}
+
+// migrateLegacyData prepares rows stored by older versions for AutoMigrate
+func migrateLegacyData(db *gorm.DB) error {
+	if err := migrateMobileDevices(db); err != nil {
+		return err
+	}
+	if err := migratePoliceTokens(db); err != nil {
+		return err
+	}
+	return migrateResidences(db)
+}
+
+// migrateMobileDevices splits the formatted device name into columns, every
+// row needs a device id before its unique index is created
+func migrateMobileDevices(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&model.Mobile{}) || migrator.HasColumn(&model.Mobile{}, "device_id") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, field := range []string{"Platform", "Brand", "ModelName", "DeviceId"} {
+			if err := tx.Migrator().AddColumn(&legacyMobile{}, field); err != nil {
+				return err
+			}
+		}
+
+		var mobiles []model.Mobile
+		if err := tx.Unscoped().Select("id", "uuid", "registered_device").Find(&mobiles).Error; err != nil {
+			return err
+		}
+
+		seen := map[string]bool{}
+		for _, mobile := range mobiles {
+			platform, brand, modelName, deviceId := model.ParseDeviceName(mobile.RegisteredDevice)
+			// NOTE: the old lookup used LIKE so ids could repeat, only the first row keeps it
+			if deviceId == "" || seen[deviceId] {
+				deviceId = "legacy-" + mobile.Uuid.String()
+			}
+			seen[deviceId] = true
+
+			if err := tx.
+				Table("mobiles").
+				Where("id = ?", mobile.ID).
+				Updates(map[string]any{
+					"platform":   platform,
+					"brand":      brand,
+					"model_name": modelName,
+					"device_id":  deviceId,
+				}).
+				Error; err != nil {
+				return err
+			}
+		}
+
+		zap.S().Infof("Migrated %d mobile devices to structured columns", len(mobiles))
+		return nil
+	})
+}
+
+// migratePoliceTokens moves unused police tokens stored in plain text to
+// hashed activation codes and drops the column, used tokens were already
+// replaced by a password hash and are dropped
+func migratePoliceTokens(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&legacyPoliceUser{}, "police_token") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// NOTE: AutoMigrate would also migrate users, which still has old rows
+		if !tx.Migrator().HasTable(&model.PoliceActivationCode{}) {
+			if err := tx.Migrator().CreateTable(&model.PoliceActivationCode{}); err != nil {
+				return err
+			}
+		}
+
+		var users []legacyPoliceUser
+		if err := tx.Where("police_token IS NOT NULL AND police_token <> ''").Find(&users).Error; err != nil {
+			return err
+		}
+
+		migrated := 0
+		for _, user := range users {
+			if strings.HasPrefix(*user.PoliceToken, "$") {
+				continue
+			}
+			code := model.PoliceActivationCode{
+				Uuid:      uuid.New(),
+				UserId:    user.ID,
+				Lookup:    auth.ActivationCodeLookup(*user.PoliceToken),
+				CodeHash:  auth.HashActivationCode(*user.PoliceToken),
+				Status:    model.ActivationIssued,
+				ExpiresAt: time.Now().Add(config.AppConfig.ActivationCodeValidity()),
+			}
+			if err := tx.Create(&code).Error; err != nil {
+				return err
+			}
+			migrated++
+		}
+
+		if err := tx.Migrator().DropColumn(&legacyPoliceUser{}, "police_token"); err != nil {
+			return err
+		}
+
+		zap.S().Infof("Migrated %d police tokens to activation codes", migrated)
+		return nil
+	})
+}
+
+// migrateResidences parses the free text residences into addresses and
+// keeps the free text in residence_legacy, residences naming no place of the
+// postal codebook are kept as the street so users can correct them
+func migrateResidences(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&legacyResidenceUser{}, "residence") {
+		return nil
+	}
+
+	codebook, err := postal.LoadAtLeast(config.AppConfig.PostalCodebook, config.AppConfig.PostalCodebookMinPlaces)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, field := range []string{
+			"ResidenceStreet", "ResidenceHouseNumber", "ResidencePostalCode", "ResidenceSettlement", "ResidenceCounty",
+		} {
+			if !tx.Migrator().HasColumn(&legacyResidenceUser{}, field) {
+				if err := tx.Migrator().AddColumn(&legacyResidenceUser{}, field); err != nil {
+					return err
+				}
+			}
+		}
+
+		var users []legacyResidenceUser
+		if err := tx.Select("id", "residence").Find(&users).Error; err != nil {
+			return err
+		}
+
+		parsed := 0
+		for _, user := range users {
+			address, ok := codebook.Parse(user.Residence)
+			if ok {
+				parsed++
+			}
+			if err := tx.
+				Table("users").
+				Where("id = ?", user.ID).
+				Updates(map[string]any{
+					"residence_street":       address.Street,
+					"residence_house_number": address.HouseNumber,
+					"residence_postal_code":  address.PostalCode,
+					"residence_settlement":   address.Settlement,
+					"residence_county":       address.County,
+				}).
+				Error; err != nil {
+				return err
+			}
+		}
+
+		// NOTE: the search index on the free text has the name of the index on
+		// the address, it would keep that one from being created
+		if err := tx.Exec("DROP INDEX IF EXISTS idx_users_residence_trgm").Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().RenameColumn(&legacyResidenceUser{}, "residence", "residence_legacy"); err != nil {
+			return err
+		}
+
+		zap.S().Infof("Migrated residences of %d users, %d could not be matched to a place", len(users), len(users)-parsed)
+		return nil
+	})
+}
+
+// migrateActivationLookups hashes the lookups of activation codes stored when
+// the lookup was the start of the code in plain text. It runs after
+// AutoMigrate widened the column.
+func migrateActivationLookups(db *gorm.DB) error {
+	var codes []model.PoliceActivationCode
+	if err := db.Unscoped().Where("LENGTH(lookup) <= ?", auth.ActivationLookupLength).Find(&codes).Error; err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if err := db.
+			Unscoped().
+			Model(&code).
+			Update("lookup", auth.ActivationPrefixLookup(code.Lookup)).
+			Error; err != nil {
+			return err
+		}
+	}
+	if len(codes) > 0 {
+		zap.S().Infof("Hashed the lookups of %d activation codes", len(codes))
+	}
+	return nil
+}
+
+// migrateCompanyVehicles moves vehicles owned by company logins to an
+// organisation of the company, the login becomes its owner. It runs after
+// AutoMigrate because it needs the organisation tables.
+func migrateCompanyVehicles(db *gorm.DB) error {
+	var companies []model.User
+	if err := db.
+		Where("role = ? AND id IN (?)", model.RoleFirma, db.Model(&model.Vehicle{}).Select("user_id").Where("user_id IS NOT NULL")).
+		Find(&companies).
+		Error; err != nil {
+		return err
+	}
+
+	for _, company := range companies {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			var organisation model.Organisation
+			err := tx.Where("oib = ?", company.OIB).First(&organisation).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				organisation = model.Organisation{
+					Uuid: uuid.New(),
+					Name: strings.TrimSpace(company.FirstName + " " + company.LastName),
+					OIB:  company.OIB,
+				}
+				err = tx.Create(&organisation).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := tx.
+				Where(model.OrganisationMember{OrganisationId: organisation.ID, UserId: company.ID}).
+				Attrs(model.OrganisationMember{Role: model.OrgRoleOwner}).
+				FirstOrCreate(&model.OrganisationMember{}).
+				Error; err != nil {
+				return err
+			}
+
+			moved := tx.
+				Model(&model.Vehicle{}).
+				Where("user_id = ?", company.ID).
+				Updates(map[string]any{"organisation_id": organisation.ID, "user_id": nil})
+			if moved.Error != nil {
+				return moved.Error
+			}
+
+			zap.S().Infof("Moved %d vehicles of company user = %s to organisation = %s", moved.RowsAffected, company.Uuid, organisation.Uuid)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTotpSecrets seals the TOTP secrets stored in plain text. It runs
+// after AutoMigrate widened the column.
+func migrateTotpSecrets(db *gorm.DB) error {
+	var totps []model.UserTotp
+	if err := db.Unscoped().Find(&totps).Error; err != nil {
+		return err
+	}
+
+	sealedCount := 0
+	for _, totp := range totps {
+		if auth.IsSealed(totp.Secret) {
+			continue
+		}
+		sealed, err := auth.SealTotpSecret(totp.UserId, totp.Secret)
+		if err != nil {
+			return err
+		}
+		if err := db.
+			Unscoped().
+			Model(&totp).
+			Update("secret", sealed).
+			Error; err != nil {
+			return err
+		}
+		sealedCount++
+	}
+	if sealedCount > 0 {
+		zap.S().Infof("Sealed the secrets of %d totp second factors", sealedCount)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"gorm.io/gorm"
+)
+
+// searchIndexes back the user search, the expressions must stay the same as
+// the ones service.UserCrudService searches
+var searchIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (LOWER(first_name || ' ' || last_name) gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (LOWER(email) gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_users_residence_trgm ON users USING gin (LOWER(residence_street || ' ' || residence_settlement) gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_users_oib_prefix ON users (oib bpchar_pattern_ops)",
+}
+
+// createSearchIndexes creates the trigram indexes of the user search, SQLite
+// has no pg_trgm and scans the table instead
+func createSearchIndexes(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return err
+	}
+	for _, index := range searchIndexes {
+		if err := db.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
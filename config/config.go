@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 const (
 	_CONFIG_FILE                = "ePrometna.json"
 	LOG_FILE                    = "ePrometna.log"
@@ -19,6 +21,106 @@ type AppConfiguration struct {
 	DbConnection string
 	AccessKey    string
 	RefreshKey   string
+	JwtAlgorithm string
+	MfaRoles     []string
+	MfaIssuer    string
+	// TrustedProxies may set X-Forwarded-For, client ips are used to throttle logins
+	TrustedProxies []string
+	// MailOutboxDir stores outgoing mail as files, if empty mail is stored in the database
+	MailOutboxDir string
+	// AppUrl is the address of the web app used in links sent by mail
+	AppUrl string
+	// Password policy of new passwords, PasswordBreachedList is an optional file path
+	PasswordMinLength    int
+	PasswordMinClasses   int
+	PasswordBreachedList string
+	// DeviceLimits is the number of mobile devices a role can register, roles
+	// that are not listed can register one device
+	DeviceLimits map[string]int
+	// DeviceSignatures makes sensitive mobile routes require a challenge signed
+	// with an attested device key, it needs an attestation verifier
+	DeviceSignatures bool
+	// ActivationCodeKey keys the hash of police activation codes, if empty
+	// RefreshKey is used
+	ActivationCodeKey string
+	// ActivationLookupKey keys the lookup of police activation codes, if
+	// empty it is derived from ActivationCodeKey
+	ActivationLookupKey string
+	// LegacyAccessTokens accepts HS256 tokens signed with AccessKey that were
+	// issued before the first signing key
+	LegacyAccessTokens bool
+	// SigningKeyEncryptionKey encrypts private signing keys and TOTP secrets
+	// stored in the database, if empty outside of production it is derived
+	// from RefreshKey
+	SigningKeyEncryptionKey string
+	// ActivationCodeHours is how long a police activation code is valid
+	ActivationCodeHours int
+	// Sign in through an OpenID Connect provider (NIAS), disabled if OidcIssuer is empty.
+	// OidcRedirectUrl is the web app page the provider returns the user to.
+	OidcIssuer       string
+	OidcClientId     string
+	OidcClientSecret string
+	OidcRedirectUrl  string
+	OidcScopes       []string
+	// OidcOibClaim is the id token claim holding the OIB of the user
+	OidcOibClaim string
+	// ApiKeyMaxDays is the longest lifetime of an API key
+	ApiKeyMaxDays int
+	// ErasureGraceDays is how long an erasure request can be cancelled before
+	// the personal data of the user is erased
+	ErasureGraceDays int
+	// RetentionDays is how long records of an entity are kept after their user
+	// is erased, entities that are not listed are purged right away
+	RetentionDays map[string]int
+	// PostalCodebook is the file of postal codes and settlements residence
+	// addresses are checked against
+	PostalCodebook string
+	// PostalCodebookMinPlaces is the least number of places PostalCodebook has
+	// to have, it keeps a partial codebook from rejecting valid addresses
+	PostalCodebookMinPlaces int
+}
+
+// MaxDevices returns the number of mobile devices users of a role can register
+func (c *AppConfiguration) MaxDevices(role string) int {
+	if limit, ok := c.DeviceLimits[role]; ok {
+		return limit
+	}
+	return 1
+}
+
+// ActivationCodeValidity returns how long a police activation code can be redeemed
+func (c *AppConfiguration) ActivationCodeValidity() time.Duration {
+	if c.ActivationCodeHours <= 0 {
+		return 72 * time.Hour
+	}
+	return time.Duration(c.ActivationCodeHours) * time.Hour
+}
+
+// ApiKeyMaxLifetime returns how long an API key can be valid
+func (c *AppConfiguration) ApiKeyMaxLifetime() time.Duration {
+	if c.ApiKeyMaxDays <= 0 {
+		return 365 * 24 * time.Hour
+	}
+	return time.Duration(c.ApiKeyMaxDays) * 24 * time.Hour
+}
+
+// ErasureGrace returns how long after an erasure request the user is erased
+func (c *AppConfiguration) ErasureGrace() time.Duration {
+	if c.ErasureGraceDays < 0 {
+		return 0
+	}
+	return time.Duration(c.ErasureGraceDays) * 24 * time.Hour
+}
+
+// RetentionPeriod returns how long records of an entity are kept after their
+// user is erased
+func (c *AppConfiguration) RetentionPeriod(entity string) time.Duration {
+	return time.Duration(c.RetentionDays[entity]) * 24 * time.Hour
+}
+
+// OidcEnabled reports whether users can sign in through an OpenID Connect provider
+func (c *AppConfiguration) OidcEnabled() bool {
+	return c.OidcIssuer != ""
 }
 
 type environment = string
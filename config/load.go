@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -31,10 +32,62 @@ func loadData() error {
 	conf.DbConnection = loadString("DB_CONN")
 	conf.AccessKey = loadString("ACCESS_KEY")
 	conf.RefreshKey = loadString("REFRESH_KEY")
+	conf.LegacyAccessTokens = loadBoolOr("LEGACY_ACCESS_TOKENS", conf.Env != Prod)
+	conf.JwtAlgorithm = loadString("JWT_ALG")
+	conf.SigningKeyEncryptionKey = loadString("SIGNING_KEY_ENCRYPTION_KEY")
+	conf.MfaRoles = loadList("MFA_ROLES", []string{"superadmin", "mupadmin"})
+	conf.MfaIssuer = loadString("MFA_ISSUER")
+	conf.TrustedProxies = loadList("TRUSTED_PROXIES", []string{})
+	conf.MailOutboxDir = loadString("MAIL_OUTBOX_DIR")
+	conf.AppUrl = strings.TrimRight(loadString("APP_URL"), "/")
+	conf.PasswordMinLength = loadIntOr("PASSWORD_MIN_LENGTH", 8)
+	conf.PasswordMinClasses = loadIntOr("PASSWORD_MIN_CLASSES", 3)
+	conf.PasswordBreachedList = loadString("PASSWORD_BREACHED_LIST")
+	conf.DeviceLimits = loadLimits("DEVICE_LIMITS", []string{"osoba:3", "firma:3", "policija:1"})
+	// NOTE: production has no attestation verifier yet, keys can't be trusted there
+	conf.DeviceSignatures = loadBoolOr("DEVICE_SIGNATURES", conf.Env != Prod)
+	conf.ActivationCodeKey = loadString("ACTIVATION_CODE_KEY")
+	conf.ActivationLookupKey = loadString("ACTIVATION_LOOKUP_KEY")
+	conf.ActivationCodeHours = loadIntOr("ACTIVATION_CODE_HOURS", 72)
+	conf.OidcIssuer = strings.TrimRight(loadString("OIDC_ISSUER"), "/")
+	conf.OidcClientId = loadString("OIDC_CLIENT_ID")
+	conf.OidcClientSecret = loadString("OIDC_CLIENT_SECRET")
+	conf.OidcRedirectUrl = loadString("OIDC_REDIRECT_URL")
+	conf.OidcScopes = loadList("OIDC_SCOPES", []string{"openid", "profile", "email"})
+	conf.OidcOibClaim = loadString("OIDC_OIB_CLAIM")
+	conf.ApiKeyMaxDays = loadIntOr("API_KEY_MAX_DAYS", 365)
+	conf.ErasureGraceDays = loadIntOr("ERASURE_GRACE_DAYS", 30)
+	conf.RetentionDays = loadLimits("RETENTION_DAYS", []string{"owner_history:3650", "refresh_token:90"})
+	conf.PostalCodebook = loadString("POSTAL_CODEBOOK")
+	conf.PostalCodebookMinPlaces = loadIntOr("POSTAL_CODEBOOK_MIN_PLACES", defaultCodebookPlaces(conf.Env))
 	conf.Port = loadInt("PORT")
 
+	// NOTE: access tokens are signed with keys stored in the database,
+	// ACCESS_KEY is only used to verify tokens issued before that
 	if conf.AccessKey == "" {
-		return fmt.Errorf("ACCESS_KEY environment variable is required")
+		fmt.Printf("ACCESS_KEY is empty, legacy HS256 access tokens will be rejected\n")
+	}
+	if conf.JwtAlgorithm == "" {
+		conf.JwtAlgorithm = "RS256"
+	}
+	if conf.SigningKeyEncryptionKey == "" && conf.Env == Prod {
+		return fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY environment variable is required in production")
+	}
+	if conf.MfaIssuer == "" {
+		conf.MfaIssuer = "ePrometna"
+	}
+	// NOTE: the bundled codebook is a sample, production needs the full one
+	if conf.PostalCodebook == "" && conf.Env == Prod {
+		return fmt.Errorf("POSTAL_CODEBOOK environment variable is required in production")
+	}
+	if conf.PostalCodebook == "" {
+		conf.PostalCodebook = "./data/postal_codes.csv"
+	}
+	if conf.OidcOibClaim == "" {
+		conf.OidcOibClaim = "oib"
+	}
+	if conf.OidcEnabled() && (conf.OidcClientId == "" || conf.OidcRedirectUrl == "") {
+		return fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
 	}
 	if conf.RefreshKey == "" {
 		return fmt.Errorf("REFRESH_KEY environment variable is required")
@@ -58,6 +111,79 @@ func loadInt(name string) int {
 	return num
 }
 
+// defaultCodebookPlaces is the least number of places the postal codebook
+// has to have, the full Hrvatska pošta codebook has about 6700
+func defaultCodebookPlaces(env environment) int {
+	if env == Prod {
+		return 6000
+	}
+	return 0
+}
+
+// loadIntOr loads an int, if the variable is not set or invalid def is returned
+func loadIntOr(name string, def int) int {
+	rez := os.Getenv(name)
+	if rez == "" {
+		fmt.Printf("Env variable %s is empty, will use default (%d)\n", name, def)
+		return def
+	}
+	num, err := strconv.Atoi(rez)
+	if err != nil {
+		fmt.Printf("Failed to parse int %s, will use default (%d)\n", rez, def)
+		return def
+	}
+
+	return num
+}
+
+// loadBoolOr loads a bool, if the variable is not set or invalid def is returned
+func loadBoolOr(name string, def bool) bool {
+	rez := os.Getenv(name)
+	if rez == "" {
+		fmt.Printf("Env variable %s is empty, will use default (%t)\n", name, def)
+		return def
+	}
+	value, err := strconv.ParseBool(rez)
+	if err != nil {
+		fmt.Printf("Failed to parse bool %s, will use default (%t)\n", rez, def)
+		return def
+	}
+
+	return value
+}
+
+// loadList loads a comma separated list, if the variable is not set def is returned
+func loadList(name string, def []string) []string {
+	rez, ok := os.LookupEnv(name)
+	if !ok {
+		fmt.Printf("Env variable %s is not set, will use default (%s)\n", name, strings.Join(def, ","))
+		return def
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(rez, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// loadLimits loads a list of name:number pairs, invalid pairs are skipped
+func loadLimits(name string, def []string) map[string]int {
+	limits := map[string]int{}
+	for _, item := range loadList(name, def) {
+		key, value, ok := strings.Cut(item, ":")
+		num, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || num < 0 {
+			fmt.Printf("Failed to parse %s entry %s, it will be skipped\n", name, item)
+			continue
+		}
+		limits[strings.TrimSpace(key)] = num
+	}
+	return limits
+}
+
 func loadString(name string) string {
 	rez := os.Getenv(name)
 	if rez == "" {
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ApiKeyController struct {
+	apiKeyService service.IApiKeyService
+	logger        *zap.SugaredLogger
+}
+
+func NewApiKeyController() *ApiKeyController {
+	var controller *ApiKeyController
+	app.Invoke(func(apiKeyService service.IApiKeyService, logger *zap.SugaredLogger) {
+		controller = &ApiKeyController{
+			apiKeyService: apiKeyService,
+			logger:        logger,
+		}
+	})
+	return controller
+}
+
+func (c *ApiKeyController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/api-keys")
+	group.Use(middleware.Protect(model.PermApiKeyManage))
+
+	// register Endpoints
+	group.GET("/", c.getAll)
+	group.POST("/", c.create)
+	group.DELETE("/:uuid", c.revoke)
+}
+
+// getAll godoc
+//
+//	@Summary		API keys
+//	@Description	Returns API keys of integrations, the keys themselves are never returned
+//	@Tags			api-keys
+//	@Produce		json
+//	@Param			organisation	query	string	false	"Only keys of this organisation"
+//	@Success		200				{array}	dto.ApiKeyDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/api-keys [get]
+func (c *ApiKeyController) getAll(ctx *gin.Context) {
+	keys, err := c.apiKeyService.GetAll(ctx.Query("organisation"))
+	if err != nil {
+		c.logger.Errorf("Failed to fetch API keys err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.ApiKeyDto, 0, len(keys))
+	for _, key := range keys {
+		dtos = append(dtos, dto.ApiKeyDto{}.FromModel(&key))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// create godoc
+//
+//	@Summary		Issue API key
+//	@Description	Issues a key with the role and scopes of an integration, scopes have to be
+//	@Description	granted to the role. The key is only returned in this response.
+//	@Tags			api-keys
+//	@Accept			json
+//	@Produce		json
+//	@Param			apiKey	body		dto.NewApiKeyDto	true	"Key to issue"
+//	@Success		201		{object}	dto.CreatedApiKeyDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/api-keys [post]
+func (c *ApiKeyController) create(ctx *gin.Context) {
+	var newDto dto.NewApiKeyDto
+	if err := ctx.BindJSON(&newDto); err != nil {
+		c.logger.Errorf("Invalid API key request err = %+v", err)
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	key, err := newDto.ToModel()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	secret, created, err := c.apiKeyService.Create(key, adminUuid)
+	if err != nil {
+		switch {
+		case errors.Is(err, cerror.ErrBadRole),
+			errors.Is(err, cerror.ErrUnknownPermission),
+			errors.Is(err, cerror.ErrScopeNotAllowed),
+			errors.Is(err, cerror.ErrInvalidIpAllowlist),
+			errors.Is(err, cerror.ErrInvalidExpiry):
+			ctx.JSON(http.StatusBadRequest, err.Error())
+		default:
+			c.logger.Errorf("Failed to issue API key err = %+v", err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.CreatedApiKeyDto{
+		ApiKeyDto: dto.ApiKeyDto{}.FromModel(created),
+		Key:       secret,
+	})
+}
+
+// revoke godoc
+//
+//	@Summary		Revoke API key
+//	@Description	Revokes an API key, requests made with it are rejected immediately
+//	@Tags			api-keys
+//	@Param			uuid	path	string	true	"API key UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/api-keys/{uuid} [delete]
+func (c *ApiKeyController) revoke(ctx *gin.Context) {
+	keyUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.apiKeyService.Revoke(keyUuid, adminUuid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.logger.Errorf("Failed to revoke API key %s err = %+v", keyUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
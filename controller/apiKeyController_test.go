@@ -0,0 +1,185 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockApiKeyService struct {
+	mock.Mock
+}
+
+func (m *MockApiKeyService) Create(key *model.ApiKey, adminUuid uuid.UUID) (string, *model.ApiKey, error) {
+	args := m.Called(key, adminUuid)
+	var res *model.ApiKey
+	if v := args.Get(1); v != nil {
+		res = v.(*model.ApiKey)
+	}
+	return args.String(0), res, args.Error(2)
+}
+
+func (m *MockApiKeyService) GetAll(organisation string) ([]model.ApiKey, error) {
+	args := m.Called(organisation)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ApiKey), args.Error(1)
+}
+
+func (m *MockApiKeyService) Revoke(keyUuid, adminUuid uuid.UUID) error {
+	args := m.Called(keyUuid, adminUuid)
+	return args.Error(0)
+}
+
+func (m *MockApiKeyService) AuthenticateApiKey(key, ip string) (*auth.Claims, error) {
+	args := m.Called(key, ip)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*auth.Claims), args.Error(1)
+}
+
+type ApiKeyControllerTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	mockKeys   *MockApiKeyService
+	adminUuid  uuid.UUID
+	adminToken string
+	hakToken   string
+}
+
+func (suite *ApiKeyControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "apikey-ctrl-test-access-key",
+		RefreshKey: "apikey-ctrl-test-refresh-key",
+	}
+
+	suite.mockKeys = new(MockApiKeyService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IApiKeyService { return suite.mockKeys })
+
+	suite.router = gin.New()
+	controller.NewApiKeyController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.adminUuid = uuid.New()
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: suite.adminUuid, Role: model.RoleSuperAdmin})
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleHAK})
+	suite.Require().NoError(err)
+	suite.hakToken = "Bearer " + token
+}
+
+func (suite *ApiKeyControllerTestSuite) SetupTest() {
+	suite.mockKeys.ExpectedCalls = nil
+	suite.mockKeys.Calls = nil
+}
+
+func TestApiKeyController(t *testing.T) {
+	suite.Run(t, new(ApiKeyControllerTestSuite))
+}
+
+func (suite *ApiKeyControllerTestSuite) request(method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+const newApiKeyBody = `{
+	"name": "Inspection station",
+	"organisation": "HAK Zagreb",
+	"role": "hak",
+	"scopes": ["vehicle:read"],
+	"ipAllowlist": ["192.0.2.10"],
+	"expiresAt": "2030-01-01 00:00:00"
+}`
+
+func (suite *ApiKeyControllerTestSuite) TestCreate() {
+	created := &model.ApiKey{
+		Uuid:         uuid.New(),
+		Organisation: "HAK Zagreb",
+		Role:         model.RoleHAK,
+		Scopes:       []model.Permission{model.PermVehicleRead},
+		Prefix:       "epk_abcdefgh",
+		ExpiresAt:    time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local),
+	}
+	suite.mockKeys.On("Create", mock.MatchedBy(func(key *model.ApiKey) bool {
+		return key.Organisation == "HAK Zagreb" && key.Role == model.RoleHAK &&
+			len(key.Scopes) == 1 && key.Scopes[0] == model.PermVehicleRead
+	}), suite.adminUuid).Return("epk_secret", created, nil).Once()
+
+	w := suite.request(http.MethodPost, "/api/api-keys/", suite.adminToken, newApiKeyBody)
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var body map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), "epk_secret", body["key"])
+	assert.Equal(suite.T(), created.Uuid.String(), body["uuid"])
+	suite.mockKeys.AssertExpectations(suite.T())
+}
+
+func (suite *ApiKeyControllerTestSuite) TestCreate_Invalid() {
+	suite.mockKeys.On("Create", mock.Anything, suite.adminUuid).Return("", nil, cerror.ErrScopeNotAllowed).Once()
+
+	w := suite.request(http.MethodPost, "/api/api-keys/", suite.adminToken, newApiKeyBody)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request(http.MethodPost, "/api/api-keys/", suite.adminToken, strings.Replace(newApiKeyBody, "vehicle:read", "unknown", 1))
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *ApiKeyControllerTestSuite) TestOnlySuperadmin() {
+	w := suite.request(http.MethodGet, "/api/api-keys/", suite.hakToken, "")
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockKeys.AssertNotCalled(suite.T(), "GetAll", mock.Anything)
+}
+
+func (suite *ApiKeyControllerTestSuite) TestGetAll() {
+	suite.mockKeys.On("GetAll", "HAK Zagreb").Return([]model.ApiKey{{Uuid: uuid.New(), KeyHash: "hash"}}, nil).Once()
+
+	w := suite.request(http.MethodGet, "/api/api-keys/?organisation=HAK+Zagreb", suite.adminToken, "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "hash")
+}
+
+func (suite *ApiKeyControllerTestSuite) TestRevoke() {
+	keyUuid := uuid.New()
+	suite.mockKeys.On("Revoke", keyUuid, suite.adminUuid).Return(nil).Once()
+	suite.mockKeys.On("Revoke", mock.Anything, suite.adminUuid).Return(gorm.ErrRecordNotFound).Once()
+
+	w := suite.request(http.MethodDelete, "/api/api-keys/"+keyUuid.String(), suite.adminToken, "")
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/api-keys/"+uuid.NewString(), suite.adminToken, "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
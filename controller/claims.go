@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// loggedInClaims returns the claims stored by middleware.Protect and aborts
+// with 401 if the route isn't protected
+func loggedInClaims(ctx *gin.Context) (*auth.Claims, bool) {
+	claims, ok := middleware.GetClaims(ctx)
+	if !ok {
+		ctx.AbortWithError(http.StatusUnauthorized, cerror.ErrInvalidTokenFormat)
+		return nil, false
+	}
+	return claims, true
+}
+
+// loggedInUuid returns the uuid of the logged in user and aborts with 401 if
+// there is none
+func loggedInUuid(ctx *gin.Context) (uuid.UUID, bool) {
+	userUuid, ok := middleware.GetUserUuid(ctx)
+	if !ok {
+		ctx.AbortWithError(http.StatusUnauthorized, cerror.ErrInvalidTokenFormat)
+		return uuid.Nil, false
+	}
+	return userUuid, true
+}
+
+// abortForbidden aborts with 403 if an access policy denied the request
+func abortForbidden(ctx *gin.Context, err error) bool {
+	if !errors.Is(err, cerror.ErrForbidden) {
+		return false
+	}
+	ctx.AbortWithError(http.StatusForbidden, err)
+	return true
+}
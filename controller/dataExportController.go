@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/i18n"
+	"ePrometna_Server/util/middleware"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type DataExportController struct {
+	dataExportService service.IDataExportService
+	logger            *zap.SugaredLogger
+}
+
+func NewDataExportController() *DataExportController {
+	var controller *DataExportController
+	app.Invoke(func(dataExportService service.IDataExportService, logger *zap.SugaredLogger) {
+		controller = &DataExportController{
+			dataExportService: dataExportService,
+			logger:            logger,
+		}
+	})
+	return controller
+}
+
+func (c *DataExportController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/user")
+
+	// register Endpoints
+	group.GET("/my-data/export", middleware.Protect(), c.exportMyData)
+	group.GET("/:uuid/export", middleware.Protect(model.PermUserExport), c.exportUser)
+}
+
+// exportMyData godoc
+//
+//	@Summary		Export my data
+//	@Description	Downloads a ZIP of everything stored about the logged in user: JSON files of the
+//	@Description	profile, vehicles, driver grants and license, devices, shared data and access log,
+//	@Description	and a README.txt summary in the language of the Accept-Language header
+//	@Tags			user
+//	@Produce		application/zip
+//	@Success		200	{file}	file
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/user/my-data/export [get]
+func (c *DataExportController) exportMyData(ctx *gin.Context) {
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
+		return
+	}
+	// NOTE: support staff acting as the user see their data, they can't take it
+	if claims.IsImpersonation() {
+		ctx.AbortWithError(http.StatusForbidden, cerror.ErrForbidden)
+		return
+	}
+
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+	c.export(ctx, userUuid)
+}
+
+// exportUser godoc
+//
+//	@Summary		Export user data
+//	@Description	Downloads the same ZIP a user gets from /user/my-data/export, to answer a
+//	@Description	subject access request made outside of the app
+//	@Tags			user
+//	@Produce		application/zip
+//	@Param			uuid	path	string	true	"User UUID"
+//	@Success		200		{file}	file
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/user/{uuid}/export [get]
+func (c *DataExportController) exportUser(ctx *gin.Context) {
+	userUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+	c.logger.Infof("User %s exports the data of user %s", adminUuid, userUuid)
+	c.export(ctx, userUuid)
+}
+
+func (c *DataExportController) export(ctx *gin.Context, userUuid uuid.UUID) {
+	export, err := c.dataExportService.Export(userUuid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.logger.Errorf("Failed to export data of user %s err = %+v", userUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// NOTE: the archive is built before anything is sent, so a failure is still a 500
+	lang := i18n.Language(ctx.GetHeader("Accept-Language"))
+	archive, err := writeDataExport(dto.DataExportDto{}.FromModel(export), lang)
+	if err != nil {
+		c.logger.Errorf("Failed to write data export of user %s err = %+v", userUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("eprometna-%s-%s.zip", userUuid, export.GeneratedAt.Format("20060102"))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Data(http.StatusOK, "application/zip", archive)
+}
+
+// writeDataExport zips the summary and the JSON files of an export
+func writeDataExport(export dto.DataExportDto, lang string) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	readme, err := archive.Create("README.txt")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readme.Write([]byte(export.Summary(lang))); err != nil {
+		return nil, err
+	}
+
+	for _, file := range export.Files() {
+		w, err := archive.Create(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,171 @@
+package controller_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockDataExportService struct {
+	mock.Mock
+}
+
+func (m *MockDataExportService) Export(userUuid uuid.UUID) (*model.UserDataExport, error) {
+	args := m.Called(userUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.UserDataExport), args.Error(1)
+}
+
+type DataExportControllerTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	mockSvc    *MockDataExportService
+	user       *model.User
+	userToken  string
+	adminToken string
+}
+
+func (suite *DataExportControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "dataexport-ctrl-test-access-key",
+		RefreshKey: "dataexport-ctrl-test-refresh-key",
+	}
+
+	suite.mockSvc = new(MockDataExportService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IDataExportService { return suite.mockSvc })
+
+	suite.router = gin.New()
+	controller.NewDataExportController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.user = &model.User{Uuid: uuid.New(), Email: "citizen@test.hr", Role: model.RoleOsoba}
+	token, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+	suite.userToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleSuperAdmin})
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+}
+
+func (suite *DataExportControllerTestSuite) SetupTest() {
+	suite.mockSvc.ExpectedCalls = nil
+	suite.mockSvc.Calls = nil
+}
+
+func TestDataExportController(t *testing.T) {
+	suite.Run(t, new(DataExportControllerTestSuite))
+}
+
+func (suite *DataExportControllerTestSuite) request(path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept-Language", "hr")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *DataExportControllerTestSuite) export() *model.UserDataExport {
+	return &model.UserDataExport{
+		User:        *suite.user,
+		Vehicles:    []model.Vehicle{{Uuid: uuid.New(), Mark: "Skoda", VehicleModel: "Octavia"}},
+		GeneratedAt: time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func (suite *DataExportControllerTestSuite) TestExportMyData() {
+	suite.mockSvc.On("Export", suite.user.Uuid).Return(suite.export(), nil).Once()
+
+	w := suite.request("/api/user/my-data/export", suite.userToken)
+
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(suite.T(), w.Header().Get("Content-Disposition"), "eprometna-"+suite.user.Uuid.String()+"-20250314.zip")
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	suite.Require().NoError(err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		suite.Require().NoError(err)
+		files[file.Name], err = io.ReadAll(r)
+		suite.Require().NoError(err)
+	}
+	suite.Require().Contains(files, "README.txt")
+	assert.Contains(suite.T(), string(files["README.txt"]), "Skoda Octavia")
+
+	var vehicles []map[string]any
+	suite.Require().NoError(json.Unmarshal(files["vehicles.json"], &vehicles))
+	suite.Require().Len(vehicles, 1)
+	assert.Equal(suite.T(), "Skoda", vehicles[0]["mark"])
+	for _, name := range []string{"profile.json", "driver_license.json", "access_log.json"} {
+		assert.Contains(suite.T(), files, name)
+	}
+}
+
+func (suite *DataExportControllerTestSuite) TestExportMyData_Impersonation() {
+	token, err := auth.GenerateImpersonationToken(suite.user, &model.User{Uuid: uuid.New(), Role: model.RoleSuperAdmin}, uuid.NewString())
+	suite.Require().NoError(err)
+
+	w := suite.request("/api/user/my-data/export", "Bearer "+token)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockSvc.AssertNotCalled(suite.T(), "Export", mock.Anything)
+}
+
+func (suite *DataExportControllerTestSuite) TestExportUser() {
+	subjectUuid := uuid.New()
+	suite.mockSvc.On("Export", subjectUuid).Return(suite.export(), nil).Once()
+	suite.mockSvc.On("Export", mock.Anything).Return(nil, gorm.ErrRecordNotFound).Once()
+
+	w := suite.request("/api/user/"+subjectUuid.String()+"/export", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	w = suite.request("/api/user/"+uuid.NewString()+"/export", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request("/api/user/not-a-uuid/export", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request("/api/user/"+subjectUuid.String()+"/export", suite.userToken)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockSvc.AssertNumberOfCalls(suite.T(), "Export", 2)
+}
+
+func (suite *DataExportControllerTestSuite) TestRoutesNextToUserController() {
+	// the export routes share the /user group, gin panics on conflicting wildcards
+	app.Provide(func() service.IUserCrudService { return new(MockUserCrudService) })
+	app.Provide(func() service.IPoliceCodeService { return new(MockPoliceCodeService) })
+	router := gin.New()
+	assert.NotPanics(suite.T(), func() {
+		controller.NewUserController().RegisterEndpoints(router.Group("/api"))
+		controller.NewDataExportController().RegisterEndpoints(router.Group("/api"))
+	})
+}
@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type DeviceController struct {
+	deviceService service.IDeviceService
+	logger        *zap.SugaredLogger
+}
+
+func NewDeviceController() *DeviceController {
+	var controller *DeviceController
+	app.Invoke(func(deviceService service.IDeviceService, logger *zap.SugaredLogger) {
+		controller = &DeviceController{
+			deviceService: deviceService,
+			logger:        logger,
+		}
+	})
+	return controller
+}
+
+func (c *DeviceController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/devices")
+
+	// register Endpoints
+	group.GET("/", middleware.Protect(), c.getAll)
+	group.DELETE("/:uuid", middleware.Protect(), c.revoke)
+	group.POST("/:uuid/challenge", middleware.Protect(), c.challenge)
+	group.GET("/sessions", middleware.Protect(), c.getSessions)
+	group.DELETE("/sessions/:uuid", middleware.Protect(), c.revokeSession)
+	group.DELETE("/officer/:uuid", middleware.Protect(model.PermDeviceWipe), c.wipe)
+}
+
+// getAll godoc
+//
+//	@Summary		My devices
+//	@Description	Lists the mobile devices registered to the logged in user
+//	@Tags			devices
+//	@Produce		json
+//	@Success		200	{array}	dto.MobileDto
+//	@Failure		401
+//	@Failure		500
+//	@Router			/devices [get]
+func (c *DeviceController) getAll(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	devices, err := c.deviceService.GetDevices(userUuid)
+	if err != nil {
+		c.logger.Errorf("Failed to fetch devices err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.MobileDto, 0, len(devices))
+	for _, device := range devices {
+		dtos = append(dtos, dto.MobileDto{}.FromModel(&device))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// revoke godoc
+//
+//	@Summary		Revoke device
+//	@Description	Removes a device of the logged in user, its device token stops working
+//	@Tags			devices
+//	@Param			uuid	path	string	true	"Device UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		500
+//	@Router			/devices/{uuid} [delete]
+func (c *DeviceController) revoke(ctx *gin.Context) {
+	deviceUuid, ok := c.parseUuid(ctx)
+	if !ok {
+		return
+	}
+
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.deviceService.RevokeDevice(userUuid, deviceUuid); err != nil {
+		c.abortNotFound(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// challenge godoc
+//
+//	@Summary		Device challenge
+//	@Description	Issues a single use nonce to a device of the logged in user. The device signs "nonce\nMETHOD\npath" of the next sensitive request with its key and sends the nonce and base64 signature in the X-Device-Nonce and X-Device-Signature headers
+//	@Tags			devices
+//	@Produce		json
+//	@Param			uuid	path		string	true	"Device UUID"
+//	@Success		200		{object}	dto.DeviceChallengeDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		500
+//	@Router			/devices/{uuid}/challenge [post]
+func (c *DeviceController) challenge(ctx *gin.Context) {
+	deviceUuid, ok := c.parseUuid(ctx)
+	if !ok {
+		return
+	}
+
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	nonce, expiresAt, err := c.deviceService.IssueChallenge(userUuid, deviceUuid)
+	if err != nil {
+		if errors.Is(err, cerror.ErrNoDeviceKey) || errors.Is(err, cerror.ErrUnattestedDeviceKey) {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.abortNotFound(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DeviceChallengeDto{
+		Nonce:     nonce,
+		ExpiresAt: expiresAt.Format(format.DateTimeFormat),
+	})
+}
+
+// getSessions godoc
+//
+//	@Summary		My sessions
+//	@Description	Lists active logins of the logged in user with the time and ip of their last refresh
+//	@Tags			devices
+//	@Produce		json
+//	@Success		200	{array}	dto.SessionDto
+//	@Failure		401
+//	@Failure		500
+//	@Router			/devices/sessions [get]
+func (c *DeviceController) getSessions(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	sessions, err := c.deviceService.GetSessions(userUuid)
+	if err != nil {
+		c.logger.Errorf("Failed to fetch sessions err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.SessionDto, 0, len(sessions))
+	for _, session := range sessions {
+		dtos = append(dtos, dto.SessionDto{}.FromModel(&session))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// revokeSession godoc
+//
+//	@Summary		Revoke session
+//	@Description	Ends a login of the logged in user, its refresh token stops working
+//	@Tags			devices
+//	@Param			uuid	path	string	true	"Session UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		500
+//	@Router			/devices/sessions/{uuid} [delete]
+func (c *DeviceController) revokeSession(ctx *gin.Context) {
+	sessionUuid, ok := c.parseUuid(ctx)
+	if !ok {
+		return
+	}
+
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.deviceService.RevokeSession(userUuid, sessionUuid); err != nil {
+		c.abortNotFound(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// wipe godoc
+//
+//	@Summary		Wipe officer devices
+//	@Description	Removes every device of a police officer and revokes all of their tokens
+//	@Tags			devices
+//	@Param			uuid	path	string	true	"Officer UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/devices/officer/{uuid} [delete]
+func (c *DeviceController) wipe(ctx *gin.Context) {
+	officerUuid, ok := c.parseUuid(ctx)
+	if !ok {
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if _, err := c.deviceService.WipeOfficerDevices(officerUuid, adminUuid); err != nil {
+		if errors.Is(err, cerror.ErrNotPoliceOfficer) {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.abortNotFound(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *DeviceController) parseUuid(ctx *gin.Context) (uuid.UUID, bool) {
+	parsed, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		c.logger.Errorf("Error parsing UUID = %s", ctx.Param("uuid"))
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return uuid.Nil, false
+	}
+	return parsed, true
+}
+
+func (c *DeviceController) abortNotFound(ctx *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	c.logger.Errorf("Device request failed err = %+v", err)
+	ctx.AbortWithError(http.StatusInternalServerError, err)
+}
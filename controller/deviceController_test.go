@@ -0,0 +1,253 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockDeviceService struct {
+	mock.Mock
+}
+
+func (m *MockDeviceService) GetDevices(userUuid uuid.UUID) ([]model.Mobile, error) {
+	args := m.Called(userUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Mobile), args.Error(1)
+}
+
+func (m *MockDeviceService) GetSessions(userUuid uuid.UUID) ([]model.RefreshToken, error) {
+	args := m.Called(userUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.RefreshToken), args.Error(1)
+}
+
+func (m *MockDeviceService) RevokeDevice(userUuid, deviceUuid uuid.UUID) error {
+	args := m.Called(userUuid, deviceUuid)
+	return args.Error(0)
+}
+
+func (m *MockDeviceService) RevokeSession(userUuid, sessionUuid uuid.UUID) error {
+	args := m.Called(userUuid, sessionUuid)
+	return args.Error(0)
+}
+
+func (m *MockDeviceService) WipeOfficerDevices(officerUuid, adminUuid uuid.UUID) (int, error) {
+	args := m.Called(officerUuid, adminUuid)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDeviceService) IssueChallenge(userUuid, deviceUuid uuid.UUID) (string, time.Time, error) {
+	args := m.Called(userUuid, deviceUuid)
+	return args.String(0), args.Get(1).(time.Time), args.Error(2)
+}
+
+type DeviceControllerTestSuite struct {
+	suite.Suite
+	router       *gin.Engine
+	mockDevices  *MockDeviceService
+	userUuid     uuid.UUID
+	userToken    string
+	adminUuid    uuid.UUID
+	adminToken   string
+	officerToken string
+}
+
+func (suite *DeviceControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "device-ctrl-test-access-key",
+		RefreshKey: "device-ctrl-test-refresh-key",
+	}
+
+	suite.mockDevices = new(MockDeviceService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IDeviceService { return suite.mockDevices })
+
+	suite.router = gin.New()
+	controller.NewDeviceController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.userUuid = uuid.New()
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: suite.userUuid, Role: model.RoleOsoba})
+	suite.Require().NoError(err)
+	suite.userToken = "Bearer " + token
+
+	suite.adminUuid = uuid.New()
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: suite.adminUuid, Role: model.RoleMupADMIN})
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RolePolicija})
+	suite.Require().NoError(err)
+	suite.officerToken = "Bearer " + token
+}
+
+func (suite *DeviceControllerTestSuite) SetupTest() {
+	suite.mockDevices.ExpectedCalls = nil
+	suite.mockDevices.Calls = nil
+}
+
+func TestDeviceController(t *testing.T) {
+	suite.Run(t, new(DeviceControllerTestSuite))
+}
+
+func (suite *DeviceControllerTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *DeviceControllerTestSuite) TestGetAll() {
+	lastSeen := time.Now()
+	suite.mockDevices.On("GetDevices", suite.userUuid).Return([]model.Mobile{
+		{Uuid: uuid.New(), Platform: "Android", Brand: "Google", ModelName: "Pixel", DeviceId: "phone", ActivationToken: "secret-device-token", LastSeenAt: &lastSeen, LastSeenIp: "192.0.2.1"},
+		{Uuid: uuid.New(), Platform: "iOS", Brand: "Apple", ModelName: "iPad", DeviceId: "tablet", ActivationToken: "other-device-token"},
+	}, nil).Once()
+
+	w := suite.request(http.MethodGet, "/api/devices/", suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var dtos []dto.MobileDto
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &dtos))
+	suite.Require().Len(dtos, 2)
+	assert.Equal(suite.T(), "phone", dtos[0].DeviceId)
+	assert.Equal(suite.T(), "192.0.2.1", dtos[0].LastSeenIp)
+	assert.NotNil(suite.T(), dtos[0].LastSeenAt)
+	assert.Nil(suite.T(), dtos[1].LastSeenAt)
+	assert.NotContains(suite.T(), w.Body.String(), "secret-device-token")
+	suite.mockDevices.AssertExpectations(suite.T())
+}
+
+func (suite *DeviceControllerTestSuite) TestGetAll_Unauthorized() {
+	w := suite.request(http.MethodGet, "/api/devices/", "")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	suite.mockDevices.AssertNotCalled(suite.T(), "GetDevices", mock.Anything)
+}
+
+func (suite *DeviceControllerTestSuite) TestRevoke() {
+	deviceUuid := uuid.New()
+	suite.mockDevices.On("RevokeDevice", suite.userUuid, deviceUuid).Return(nil).Once()
+
+	w := suite.request(http.MethodDelete, "/api/devices/"+deviceUuid.String(), suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockDevices.AssertExpectations(suite.T())
+}
+
+func (suite *DeviceControllerTestSuite) TestRevoke_NotFound() {
+	deviceUuid := uuid.New()
+	suite.mockDevices.On("RevokeDevice", suite.userUuid, deviceUuid).Return(gorm.ErrRecordNotFound).Once()
+
+	w := suite.request(http.MethodDelete, "/api/devices/"+deviceUuid.String(), suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *DeviceControllerTestSuite) TestRevoke_BadUuid() {
+	w := suite.request(http.MethodDelete, "/api/devices/not-a-uuid", suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *DeviceControllerTestSuite) TestChallenge() {
+	deviceUuid := uuid.New()
+	suite.mockDevices.On("IssueChallenge", suite.userUuid, deviceUuid).Return("nonce", time.Now().Add(time.Minute), nil).Once()
+
+	w := suite.request(http.MethodPost, "/api/devices/"+deviceUuid.String()+"/challenge", suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var challenge dto.DeviceChallengeDto
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.Equal(suite.T(), "nonce", challenge.Nonce)
+	assert.NotEmpty(suite.T(), challenge.ExpiresAt)
+}
+
+func (suite *DeviceControllerTestSuite) TestChallenge_NoKey() {
+	deviceUuid := uuid.New()
+	suite.mockDevices.On("IssueChallenge", suite.userUuid, deviceUuid).Return("", time.Time{}, cerror.ErrNoDeviceKey).Once()
+
+	w := suite.request(http.MethodPost, "/api/devices/"+deviceUuid.String()+"/challenge", suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *DeviceControllerTestSuite) TestGetSessions() {
+	family := uuid.New()
+	suite.mockDevices.On("GetSessions", suite.userUuid).Return([]model.RefreshToken{
+		{Uuid: uuid.New(), FamilyUuid: family, ExpiresAt: time.Now().Add(time.Hour), Ip: "192.0.2.2"},
+	}, nil).Once()
+
+	w := suite.request(http.MethodGet, "/api/devices/sessions", suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var dtos []dto.SessionDto
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &dtos))
+	suite.Require().Len(dtos, 1)
+	assert.Equal(suite.T(), family.String(), dtos[0].Uuid)
+	assert.Equal(suite.T(), "192.0.2.2", dtos[0].Ip)
+}
+
+func (suite *DeviceControllerTestSuite) TestRevokeSession() {
+	family := uuid.New()
+	suite.mockDevices.On("RevokeSession", suite.userUuid, family).Return(nil).Once()
+
+	w := suite.request(http.MethodDelete, "/api/devices/sessions/"+family.String(), suite.userToken)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockDevices.AssertExpectations(suite.T())
+}
+
+func (suite *DeviceControllerTestSuite) TestWipe() {
+	officerUuid := uuid.New()
+	suite.mockDevices.On("WipeOfficerDevices", officerUuid, suite.adminUuid).Return(2, nil).Once()
+
+	w := suite.request(http.MethodDelete, "/api/devices/officer/"+officerUuid.String(), suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockDevices.AssertExpectations(suite.T())
+}
+
+func (suite *DeviceControllerTestSuite) TestWipe_NotOfficer() {
+	userUuid := uuid.New()
+	suite.mockDevices.On("WipeOfficerDevices", userUuid, suite.adminUuid).Return(0, cerror.ErrNotPoliceOfficer).Once()
+
+	w := suite.request(http.MethodDelete, "/api/devices/officer/"+userUuid.String(), suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *DeviceControllerTestSuite) TestWipe_Forbidden() {
+	w := suite.request(http.MethodDelete, "/api/devices/officer/"+uuid.NewString(), suite.officerToken)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockDevices.AssertNotCalled(suite.T(), "WipeOfficerDevices", mock.Anything, mock.Anything)
+}
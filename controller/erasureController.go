@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ErasureController struct {
+	erasureService service.IErasureService
+	userCrud       service.IUserCrudService
+	logger         *zap.SugaredLogger
+}
+
+func NewErasureController() *ErasureController {
+	var controller *ErasureController
+	app.Invoke(func(erasureService service.IErasureService, userCrud service.IUserCrudService, logger *zap.SugaredLogger) {
+		controller = &ErasureController{
+			erasureService: erasureService,
+			userCrud:       userCrud,
+			logger:         logger,
+		}
+	})
+	return controller
+}
+
+func (c *ErasureController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/erasure")
+	users := api.Group("/user")
+
+	// register Endpoints
+	group.GET("/", middleware.Protect(model.PermUserErase), c.getAll)
+	group.GET("/:uuid/certificate", middleware.Protect(model.PermUserErase), c.getCertificate)
+
+	users.POST("/my-data/erasure", middleware.Protect(), c.requestMyErasure)
+	users.DELETE("/my-data/erasure", middleware.Protect(), c.cancelMyErasure)
+	users.DELETE("/:uuid", middleware.Protect(model.PermUserManage), c.requestErasure)
+	users.DELETE("/:uuid/erasure", middleware.Protect(model.PermUserErase), c.cancelErasure)
+}
+
+// requestMyErasure godoc
+//
+//	@Summary		Request erasure of my data
+//	@Description	Schedules the erasure of the logged in user once the grace period passed, until then
+//	@Description	it can be cancelled. Records the law requires are kept for their retention period.
+//	@Description	The last owner of an organisation has to hand it over first.
+//	@Tags			erasure
+//	@Produce		json
+//	@Success		202	{object}	dto.ErasureRequestDto
+//	@Failure		401
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/user/my-data/erasure [post]
+func (c *ErasureController) requestMyErasure(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+	c.request(ctx, userUuid, userUuid)
+}
+
+// cancelMyErasure godoc
+//
+//	@Summary		Cancel erasure of my data
+//	@Description	Cancels the pending erasure request of the logged in user
+//	@Tags			erasure
+//	@Produce		json
+//	@Success		200	{object}	dto.ErasureRequestDto
+//	@Failure		401
+//	@Failure		409
+//	@Failure		500
+//	@Router			/user/my-data/erasure [delete]
+func (c *ErasureController) cancelMyErasure(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+	c.cancel(ctx, userUuid)
+}
+
+// requestErasure godoc
+//
+//	@Summary		Delete user
+//	@Description	Schedules the erasure of the user once the grace period passed, the user is then
+//	@Description	pseudonymized and records referring to them are purged by their retention rules.
+//	@Description	The last owner of an organisation has to hand it over first. Only superadmins
+//	@Description	can delete superadmins.
+//	@Tags			user
+//	@Produce		json
+//	@Param			uuid	path		string	true	"User UUID"
+//	@Success		202		{object}	dto.ErasureRequestDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/user/{uuid} [delete]
+func (c *ErasureController) requestErasure(ctx *gin.Context) {
+	userUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
+		return
+	}
+	if err := checkTargetRole(c.userCrud, claims, userUuid); err != nil {
+		switch {
+		case abortForbidden(ctx, err):
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		default:
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+	c.request(ctx, userUuid, adminUuid)
+}
+
+// cancelErasure godoc
+//
+//	@Summary		Cancel erasure of a user
+//	@Description	Cancels the pending erasure request of the user
+//	@Tags			erasure
+//	@Produce		json
+//	@Param			uuid	path		string	true	"User UUID"
+//	@Success		200		{object}	dto.ErasureRequestDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		409
+//	@Failure		500
+//	@Router			/user/{uuid}/erasure [delete]
+func (c *ErasureController) cancelErasure(ctx *gin.Context) {
+	userUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+	c.cancel(ctx, userUuid)
+}
+
+// getAll godoc
+//
+//	@Summary		Erasure requests
+//	@Description	Lists every erasure request, newest first
+//	@Tags			erasure
+//	@Produce		json
+//	@Success		200	{array}	dto.ErasureRequestDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/erasure/ [get]
+func (c *ErasureController) getAll(ctx *gin.Context) {
+	requests, err := c.erasureService.GetAll()
+	if err != nil {
+		c.logger.Errorf("Failed to get erasure requests err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.ErasureRequestDto, 0, len(requests))
+	for _, request := range requests {
+		dtos = append(dtos, dto.ErasureRequestDto{}.FromModel(&request))
+	}
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// getCertificate godoc
+//
+//	@Summary		Erasure certificate
+//	@Description	States what was erased for a completed request, records kept for their retention
+//	@Description	period are listed with the date they are purged and complete is false until then
+//	@Tags			erasure
+//	@Produce		json
+//	@Param			uuid	path		string	true	"Erasure request UUID"
+//	@Success		200		{object}	dto.ErasureCertificateDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/erasure/{uuid}/certificate [get]
+func (c *ErasureController) getCertificate(ctx *gin.Context) {
+	requestUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	request, err := c.erasureService.GetCertificate(requestUuid)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrErasureNotCompleted):
+			ctx.AbortWithError(http.StatusConflict, err)
+		default:
+			c.logger.Errorf("Failed to get erasure certificate %s err = %+v", requestUuid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.ErasureCertificateDto{}.FromModel(request, time.Now()))
+}
+
+func (c *ErasureController) request(ctx *gin.Context, userUuid, requestedByUuid uuid.UUID) {
+	request, err := c.erasureService.Request(userUuid, requestedByUuid)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrErasurePending), errors.Is(err, cerror.ErrLastOwner):
+			ctx.AbortWithError(http.StatusConflict, err)
+		default:
+			c.logger.Errorf("Failed to request erasure of user %s err = %+v", userUuid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, dto.ErasureRequestDto{}.FromModel(request))
+}
+
+func (c *ErasureController) cancel(ctx *gin.Context, userUuid uuid.UUID) {
+	request, err := c.erasureService.Cancel(userUuid)
+	if err != nil {
+		if errors.Is(err, cerror.ErrNoPendingErasure) {
+			ctx.AbortWithError(http.StatusConflict, err)
+			return
+		}
+		c.logger.Errorf("Failed to cancel erasure of user %s err = %+v", userUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.ErasureRequestDto{}.FromModel(request))
+}
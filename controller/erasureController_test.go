@@ -0,0 +1,217 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type MockErasureService struct {
+	mock.Mock
+}
+
+func (m *MockErasureService) Request(userUuid, requestedByUuid uuid.UUID) (*model.ErasureRequest, error) {
+	args := m.Called(userUuid, requestedByUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ErasureRequest), args.Error(1)
+}
+
+func (m *MockErasureService) Cancel(userUuid uuid.UUID) (*model.ErasureRequest, error) {
+	args := m.Called(userUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ErasureRequest), args.Error(1)
+}
+
+func (m *MockErasureService) GetAll() ([]model.ErasureRequest, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ErasureRequest), args.Error(1)
+}
+
+func (m *MockErasureService) GetCertificate(requestUuid uuid.UUID) (*model.ErasureRequest, error) {
+	args := m.Called(requestUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ErasureRequest), args.Error(1)
+}
+
+func (m *MockErasureService) Run() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+type ErasureControllerTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	mockSvc    *MockErasureService
+	mockUsers  *MockUserCrudService
+	user       *model.User
+	admin      *model.User
+	userToken  string
+	adminToken string
+	mupToken   string
+}
+
+func (suite *ErasureControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "erasure-ctrl-test-access-key",
+		RefreshKey: "erasure-ctrl-test-refresh-key",
+	}
+
+	suite.mockSvc = new(MockErasureService)
+	suite.mockUsers = new(MockUserCrudService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IErasureService { return suite.mockSvc })
+	app.Provide(func() service.IUserCrudService { return suite.mockUsers })
+
+	suite.router = gin.New()
+	controller.NewErasureController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.user = &model.User{Uuid: uuid.New(), Role: model.RoleOsoba}
+	token, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+	suite.userToken = "Bearer " + token
+
+	suite.admin = &model.User{Uuid: uuid.New(), Role: model.RoleSuperAdmin}
+	token, _, err = auth.GenerateTokens(suite.admin)
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleMupADMIN})
+	suite.Require().NoError(err)
+	suite.mupToken = "Bearer " + token
+}
+
+func (suite *ErasureControllerTestSuite) SetupTest() {
+	suite.mockSvc.ExpectedCalls = nil
+	suite.mockSvc.Calls = nil
+	suite.mockUsers.ExpectedCalls = nil
+	suite.mockUsers.Calls = nil
+}
+
+func TestErasureController(t *testing.T) {
+	suite.Run(t, new(ErasureControllerTestSuite))
+}
+
+func (suite *ErasureControllerTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *ErasureControllerTestSuite) TestRequestMyErasure() {
+	pending := &model.ErasureRequest{Uuid: uuid.New(), UserUuid: suite.user.Uuid, Status: model.ErasurePending, EraseAfter: time.Now()}
+	suite.mockSvc.On("Request", suite.user.Uuid, suite.user.Uuid).Return(pending, nil).Once()
+	suite.mockSvc.On("Request", suite.user.Uuid, suite.user.Uuid).Return(nil, cerror.ErrErasurePending).Once()
+
+	w := suite.request(http.MethodPost, "/api/user/my-data/erasure", suite.userToken)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	var body map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), model.ErasurePending, body["status"])
+
+	w = suite.request(http.MethodPost, "/api/user/my-data/erasure", suite.userToken)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *ErasureControllerTestSuite) TestCancelMyErasure() {
+	suite.mockSvc.On("Cancel", suite.user.Uuid).Return(nil, cerror.ErrNoPendingErasure).Once()
+
+	w := suite.request(http.MethodDelete, "/api/user/my-data/erasure", suite.userToken)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *ErasureControllerTestSuite) TestDeleteUserSchedulesErasure() {
+	subjectUuid := uuid.New()
+	suite.mockSvc.On("Request", subjectUuid, suite.admin.Uuid).
+		Return(&model.ErasureRequest{Uuid: uuid.New(), UserUuid: subjectUuid, Status: model.ErasurePending}, nil).Once()
+
+	w := suite.request(http.MethodDelete, "/api/user/"+subjectUuid.String(), suite.adminToken)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/user/"+subjectUuid.String(), suite.userToken)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockSvc.AssertNumberOfCalls(suite.T(), "Request", 1)
+}
+
+func (suite *ErasureControllerTestSuite) TestDeleteUser_OnlySuperadminsDeleteSuperadmins() {
+	citizen := &model.User{Uuid: uuid.New(), Role: model.RoleOsoba}
+	superadmin := &model.User{Uuid: uuid.New(), Role: model.RoleSuperAdmin}
+	suite.mockUsers.On("Read", citizen.Uuid).Return(citizen, nil)
+	suite.mockUsers.On("Read", superadmin.Uuid).Return(superadmin, nil)
+	for _, subject := range []*model.User{citizen, superadmin} {
+		suite.mockSvc.On("Request", subject.Uuid, mock.Anything).
+			Return(&model.ErasureRequest{Uuid: uuid.New(), UserUuid: subject.Uuid, Status: model.ErasurePending}, nil)
+	}
+
+	w := suite.request(http.MethodDelete, "/api/user/"+citizen.Uuid.String(), suite.mupToken)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/user/"+superadmin.Uuid.String(), suite.mupToken)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockSvc.AssertNotCalled(suite.T(), "Request", superadmin.Uuid, mock.Anything)
+
+	w = suite.request(http.MethodDelete, "/api/user/"+superadmin.Uuid.String(), suite.adminToken)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+}
+
+func (suite *ErasureControllerTestSuite) TestGetCertificate() {
+	requestUuid := uuid.New()
+	erasedAt := time.Now()
+	retainUntil := erasedAt.Add(time.Hour)
+	suite.mockSvc.On("GetCertificate", requestUuid).Return(&model.ErasureRequest{
+		Uuid: requestUuid, Status: model.ErasureCompleted, ErasedAt: &erasedAt,
+		Actions: []model.ErasureAction{
+			{Entity: "mobile", Action: model.ErasurePurge, Count: 1, DoneAt: &erasedAt},
+			{Entity: "owner_history", Action: model.ErasurePurge, Count: 2, RetainUntil: &retainUntil},
+		},
+	}, nil).Once()
+	suite.mockSvc.On("GetCertificate", mock.Anything).Return(nil, cerror.ErrErasureNotCompleted).Once()
+
+	w := suite.request(http.MethodGet, "/api/erasure/"+requestUuid.String()+"/certificate", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var body struct {
+		Complete bool             `json:"complete"`
+		Actions  []map[string]any `json:"actions"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.False(suite.T(), body.Complete)
+	suite.Require().Len(body.Actions, 2)
+	assert.NotEmpty(suite.T(), body.Actions[1]["retainUntil"])
+
+	w = suite.request(http.MethodGet, "/api/erasure/"+uuid.NewString()+"/certificate", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	w = suite.request(http.MethodGet, "/api/erasure/"+requestUuid.String()+"/certificate", suite.userToken)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ImpersonationController struct {
+	impersonationService service.IImpersonationService
+	logger               *zap.SugaredLogger
+}
+
+func NewImpersonationController() *ImpersonationController {
+	var controller *ImpersonationController
+	app.Invoke(func(impersonationService service.IImpersonationService, logger *zap.SugaredLogger) {
+		controller = &ImpersonationController{
+			impersonationService: impersonationService,
+			logger:               logger,
+		}
+	})
+	return controller
+}
+
+func (c *ImpersonationController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/impersonation")
+
+	// register Endpoints
+	group.GET("/sessions", middleware.Protect(model.PermImpersonate), c.getSessions)
+	group.GET("/sessions/:uuid/requests", middleware.Protect(model.PermImpersonate), c.getRequests)
+	// NOTE: the only mutating route an impersonation token is allowed to call
+	group.POST("/end", middleware.AllowImpersonation(), middleware.Protect(), c.end)
+	group.POST("/:uuid", middleware.Protect(model.PermImpersonate), c.start)
+}
+
+// start godoc
+//
+//	@Summary		Impersonate user
+//	@Description	Issues a short lived token to act as the user, requests made with it can't change
+//	@Description	data and are written to the audit trail. Superadmins can't be impersonated.
+//	@Tags			impersonation
+//	@Accept			json
+//	@Produce		json
+//	@Param			uuid	path		string				true	"User UUID"
+//	@Param			reason	body		dto.ImpersonateDto	true	"Why the user is impersonated"
+//	@Success		200		{object}	dto.ImpersonationTokenDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/impersonation/{uuid} [post]
+func (c *ImpersonationController) start(ctx *gin.Context) {
+	subjectUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	var impersonateDto dto.ImpersonateDto
+	if err := ctx.BindJSON(&impersonateDto); err != nil {
+		c.logger.Errorf("Invalid impersonation request err = %+v", err)
+		return
+	}
+
+	actorUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	token, session, err := c.impersonationService.Start(actorUuid, subjectUuid, impersonateDto.Reason, ctx.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrCannotImpersonate):
+			ctx.JSON(http.StatusBadRequest, err.Error())
+		case abortForbidden(ctx, err):
+		default:
+			c.logger.Errorf("Failed to impersonate user %s err = %+v", subjectUuid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.ImpersonationTokenDto{
+		AccessToken: token,
+		SessionUuid: session.Uuid.String(),
+		ExpiresAt:   session.ExpiresAt.Format(format.DateTimeFormat),
+	})
+}
+
+// end godoc
+//
+//	@Summary		End impersonation
+//	@Description	Ends the impersonation session of the token the request is made with and revokes it
+//	@Tags			impersonation
+//	@Success		204
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/impersonation/end [post]
+func (c *ImpersonationController) end(ctx *gin.Context) {
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.impersonationService.End(claims); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case abortForbidden(ctx, err):
+		default:
+			c.logger.Errorf("Failed to end impersonation session %s err = %+v", claims.ID, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// getSessions godoc
+//
+//	@Summary		Impersonation sessions
+//	@Description	Lists every impersonation session, newest first
+//	@Tags			impersonation
+//	@Produce		json
+//	@Success		200	{array}	dto.ImpersonationSessionDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/impersonation/sessions [get]
+func (c *ImpersonationController) getSessions(ctx *gin.Context) {
+	sessions, err := c.impersonationService.GetSessions()
+	if err != nil {
+		c.logger.Errorf("Failed to fetch impersonation sessions err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.ImpersonationSessionDto, 0, len(sessions))
+	for _, session := range sessions {
+		dtos = append(dtos, dto.ImpersonationSessionDto{}.FromModel(&session))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// getRequests godoc
+//
+//	@Summary		Impersonation audit trail
+//	@Description	Lists requests made during an impersonation session, including refused ones
+//	@Tags			impersonation
+//	@Produce		json
+//	@Param			uuid	path	string	true	"Session UUID"
+//	@Success		200		{array}	dto.ImpersonatedRequestDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/impersonation/sessions/{uuid}/requests [get]
+func (c *ImpersonationController) getRequests(ctx *gin.Context) {
+	sessionUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	requests, err := c.impersonationService.GetRequests(sessionUuid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		c.logger.Errorf("Failed to fetch requests of impersonation session %s err = %+v", sessionUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.ImpersonatedRequestDto, 0, len(requests))
+	for _, request := range requests {
+		dtos = append(dtos, dto.ImpersonatedRequestDto{}.FromModel(&request))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
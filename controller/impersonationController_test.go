@@ -0,0 +1,184 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockImpersonationService struct {
+	mock.Mock
+}
+
+func (m *MockImpersonationService) Start(actorUuid, subjectUuid uuid.UUID, reason, ip string) (string, *model.ImpersonationSession, error) {
+	args := m.Called(actorUuid, subjectUuid, reason, ip)
+	var res *model.ImpersonationSession
+	if v := args.Get(1); v != nil {
+		res = v.(*model.ImpersonationSession)
+	}
+	return args.String(0), res, args.Error(2)
+}
+
+func (m *MockImpersonationService) End(claims *auth.Claims) error {
+	args := m.Called(claims)
+	return args.Error(0)
+}
+
+func (m *MockImpersonationService) GetSessions() ([]model.ImpersonationSession, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ImpersonationSession), args.Error(1)
+}
+
+func (m *MockImpersonationService) GetRequests(sessionUuid uuid.UUID) ([]model.ImpersonationRequest, error) {
+	args := m.Called(sessionUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ImpersonationRequest), args.Error(1)
+}
+
+func (m *MockImpersonationService) RecordImpersonatedRequest(request auth.ImpersonatedRequest) {
+	m.Called(request)
+}
+
+type ImpersonationControllerTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	mockSvc    *MockImpersonationService
+	admin      *model.User
+	adminToken string
+	hakToken   string
+}
+
+func (suite *ImpersonationControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "impersonation-ctrl-test-access-key",
+		RefreshKey: "impersonation-ctrl-test-refresh-key",
+	}
+
+	suite.mockSvc = new(MockImpersonationService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IImpersonationService { return suite.mockSvc })
+
+	suite.router = gin.New()
+	controller.NewImpersonationController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.admin = &model.User{Uuid: uuid.New(), Email: "admin@test.hr", Role: model.RoleSuperAdmin}
+	token, _, err := auth.GenerateTokens(suite.admin)
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleHAK})
+	suite.Require().NoError(err)
+	suite.hakToken = "Bearer " + token
+}
+
+func (suite *ImpersonationControllerTestSuite) SetupTest() {
+	suite.mockSvc.ExpectedCalls = nil
+	suite.mockSvc.Calls = nil
+}
+
+func TestImpersonationController(t *testing.T) {
+	suite.Run(t, new(ImpersonationControllerTestSuite))
+}
+
+func (suite *ImpersonationControllerTestSuite) request(method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *ImpersonationControllerTestSuite) TestStart() {
+	subjectUuid := uuid.New()
+	session := &model.ImpersonationSession{Uuid: uuid.New(), ExpiresAt: time.Now().Add(auth.ImpersonationTokenDuration)}
+	suite.mockSvc.On("Start", suite.admin.Uuid, subjectUuid, "Ticket 42", mock.Anything).Return("token", session, nil).Once()
+
+	w := suite.request(http.MethodPost, "/api/impersonation/"+subjectUuid.String(), suite.adminToken, `{"reason": "Ticket 42"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var body map[string]string
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), "token", body["accessToken"])
+	assert.Equal(suite.T(), session.Uuid.String(), body["sessionUuid"])
+}
+
+func (suite *ImpersonationControllerTestSuite) TestStart_Errors() {
+	suite.mockSvc.On("Start", suite.admin.Uuid, mock.Anything, mock.Anything, mock.Anything).Return("", nil, cerror.ErrCannotImpersonate).Once()
+	w := suite.request(http.MethodPost, "/api/impersonation/"+uuid.NewString(), suite.adminToken, `{"reason": "Ticket 42"}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	suite.mockSvc.On("Start", suite.admin.Uuid, mock.Anything, mock.Anything, mock.Anything).Return("", nil, gorm.ErrRecordNotFound).Once()
+	w = suite.request(http.MethodPost, "/api/impersonation/"+uuid.NewString(), suite.adminToken, `{"reason": "Ticket 42"}`)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request(http.MethodPost, "/api/impersonation/"+uuid.NewString(), suite.adminToken, `{}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request(http.MethodPost, "/api/impersonation/"+uuid.NewString(), suite.hakToken, `{"reason": "Ticket 42"}`)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockSvc.AssertNumberOfCalls(suite.T(), "Start", 2)
+}
+
+func (suite *ImpersonationControllerTestSuite) TestImpersonationTokenOnlyEnds() {
+	subject := &model.User{Uuid: uuid.New(), Role: model.RoleOsoba}
+	token, err := auth.GenerateImpersonationToken(subject, suite.admin, uuid.NewString())
+	suite.Require().NoError(err)
+	suite.mockSvc.On("End", mock.MatchedBy(func(claims *auth.Claims) bool {
+		return claims.Uuid == subject.Uuid.String() && claims.Actor.Uuid == suite.admin.Uuid.String()
+	})).Return(nil).Once()
+
+	// Without the permission of the impersonated user a new session can't be started
+	w := suite.request(http.MethodPost, "/api/impersonation/"+uuid.NewString(), "Bearer "+token, `{"reason": "again"}`)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request(http.MethodPost, "/api/impersonation/end", "Bearer "+token, "")
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockSvc.AssertNotCalled(suite.T(), "Start", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *ImpersonationControllerTestSuite) TestGetRequests() {
+	sessionUuid := uuid.New()
+	suite.mockSvc.On("GetRequests", sessionUuid).Return([]model.ImpersonationRequest{
+		{SessionUuid: sessionUuid, Method: http.MethodDelete, Path: "/api/vehicle/1", Status: http.StatusForbidden, Blocked: true},
+	}, nil).Once()
+	suite.mockSvc.On("GetRequests", mock.Anything).Return(nil, gorm.ErrRecordNotFound).Once()
+
+	w := suite.request(http.MethodGet, "/api/impersonation/sessions/"+sessionUuid.String()+"/requests", suite.adminToken, "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var body []map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	suite.Require().Len(body, 1)
+	assert.Equal(suite.T(), true, body[0]["blocked"])
+
+	w = suite.request(http.MethodGet, "/api/impersonation/sessions/"+uuid.NewString()+"/requests", suite.adminToken, "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type KeyController struct {
+	keyService service.ISigningKeyService
+	logger     *zap.SugaredLogger
+}
+
+func NewKeyController() *KeyController {
+	var controller *KeyController
+	app.Invoke(func(keyService service.ISigningKeyService, logger *zap.SugaredLogger) {
+		controller = &KeyController{
+			keyService: keyService,
+			logger:     logger,
+		}
+	})
+	return controller
+}
+
+func (c *KeyController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/keys")
+	group.Use(middleware.Protect(model.PermKeyManage))
+
+	// register Endpoints
+	group.GET("/", c.getAll)
+	group.POST("/rotate", c.rotate)
+	group.DELETE("/:kid", c.retire)
+}
+
+// RegisterWellKnown registers public endpoints outside of the api group
+func (c *KeyController) RegisterWellKnown(router gin.IRoutes) {
+	router.GET("/.well-known/jwks.json", c.jwks)
+}
+
+// jwks godoc
+//
+//	@Summary		Public signing keys
+//	@Description	Returns public keys used to verify access and device tokens in JWKS format
+//	@Tags			keys
+//	@Produce		json
+//	@Success		200	{object}	auth.JSONWebKeySet
+//	@Router			/.well-known/jwks.json [get]
+func (c *KeyController) jwks(ctx *gin.Context) {
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JwksMaxAge.Seconds())))
+	ctx.JSON(http.StatusOK, auth.CurrentKeyring().JWKS())
+}
+
+// getAll godoc
+//
+//	@Summary		List signing keys
+//	@Description	Lists signing keys that are not retired, private keys are not returned
+//	@Tags			keys
+//	@Produce		json
+//	@Success		200	{array}	dto.SigningKeyDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/keys [get]
+func (c *KeyController) getAll(ctx *gin.Context) {
+	keys, err := c.keyService.GetAll()
+	if err != nil {
+		c.logger.Errorf("Failed to fetch signing keys err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	signingKid := ""
+	if current := model.CurrentSigningKey(keys, time.Now()); current != nil {
+		signingKid = current.Kid
+	}
+
+	dtos := make([]dto.SigningKeyDto, 0, len(keys))
+	for _, key := range keys {
+		dtos = append(dtos, dto.SigningKeyDto{}.FromModel(&key, signingKid))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// rotate godoc
+//
+//	@Summary		Rotate signing key
+//	@Description	Generates a new signing key that is published right away and signs once cached key sets expired,
+//	@Description	tokens signed with older keys stay valid until they expire or the key is retired
+//	@Tags			keys
+//	@Produce		json
+//	@Success		201	{object}	dto.SigningKeyDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/keys/rotate [post]
+func (c *KeyController) rotate(ctx *gin.Context) {
+	key, err := c.keyService.Rotate()
+	if err != nil {
+		c.logger.Errorf("Failed to rotate signing key err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// The new key only signs from its ActiveAt
+	ctx.JSON(http.StatusCreated, dto.SigningKeyDto{}.FromModel(key, ""))
+}
+
+// retire godoc
+//
+//	@Summary		Retire signing key
+//	@Description	Stops accepting tokens signed with the key, the current signing key can't be retired
+//	@Tags			keys
+//	@Param			kid	path	string	true	"Key id"
+//	@Success		204
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/keys/{kid} [delete]
+func (c *KeyController) retire(ctx *gin.Context) {
+	kid := ctx.Param("kid")
+	if err := c.keyService.Retire(kid); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.logger.Errorf("Signing key kid = %s not found", kid)
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrSigningKeyInUse):
+			c.logger.Errorf("Signing key kid = %s is in use", kid)
+			ctx.AbortWithError(http.StatusConflict, err)
+		default:
+			c.logger.Errorf("Failed to retire signing key kid = %s err = %+v", kid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
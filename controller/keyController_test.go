@@ -0,0 +1,184 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type MockSigningKeyService struct {
+	mock.Mock
+}
+
+func (m *MockSigningKeyService) Load() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockSigningKeyService) Rotate() (*model.SigningKey, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SigningKey), args.Error(1)
+}
+
+func (m *MockSigningKeyService) Retire(kid string) error {
+	args := m.Called(kid)
+	return args.Error(0)
+}
+
+func (m *MockSigningKeyService) GetAll() ([]model.SigningKey, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SigningKey), args.Error(1)
+}
+
+type KeyControllerTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	mockKeys   *MockSigningKeyService
+	adminToken string
+}
+
+func (suite *KeyControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "key-ctrl-test-access-key",
+		RefreshKey: "key-ctrl-test-refresh-key",
+	}
+
+	suite.mockKeys = new(MockSigningKeyService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.ISigningKeyService { return suite.mockKeys })
+
+	suite.router = gin.New()
+	keyController := controller.NewKeyController()
+	keyController.RegisterEndpoints(suite.router.Group("/api"))
+	keyController.RegisterWellKnown(suite.router)
+
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleSuperAdmin})
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+}
+
+func (suite *KeyControllerTestSuite) SetupTest() {
+	suite.mockKeys.ExpectedCalls = nil
+	suite.mockKeys.Calls = nil
+	auth.SetKeyring(nil)
+}
+
+func (suite *KeyControllerTestSuite) TearDownSuite() {
+	auth.SetKeyring(nil)
+}
+
+func TestKeyController(t *testing.T) {
+	suite.Run(t, new(KeyControllerTestSuite))
+}
+
+func (suite *KeyControllerTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *KeyControllerTestSuite) TestJwks() {
+	private, public, err := auth.GenerateKeyPair(auth.AlgRS256)
+	suite.Require().NoError(err)
+	key, err := auth.ParseSigningKey("kid-1", auth.AlgRS256, private, public)
+	suite.Require().NoError(err)
+	ring, err := auth.NewKeyring("kid-1", key)
+	suite.Require().NoError(err)
+	auth.SetKeyring(ring)
+
+	w := suite.request(http.MethodGet, "/.well-known/jwks.json", "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var set auth.JSONWebKeySet
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &set))
+	suite.Require().Len(set.Keys, 1)
+	assert.Equal(suite.T(), "kid-1", set.Keys[0].Kid)
+	assert.NotContains(suite.T(), w.Body.String(), "PRIVATE")
+}
+
+func (suite *KeyControllerTestSuite) TestJwks_NoKeyring() {
+	w := suite.request(http.MethodGet, "/.well-known/jwks.json", "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"keys":[]}`, w.Body.String())
+}
+
+func (suite *KeyControllerTestSuite) TestGetAll() {
+	activeAt := time.Now().Add(auth.JwksMaxAge)
+	suite.mockKeys.On("GetAll").Return([]model.SigningKey{
+		{Kid: "pending", Algorithm: auth.AlgRS256, PrivateKey: "secret", ActiveAt: &activeAt},
+		{Kid: "new", Algorithm: auth.AlgRS256, PrivateKey: "secret"},
+		{Kid: "old", Algorithm: auth.AlgRS256, PrivateKey: "secret"},
+	}, nil).Once()
+
+	w := suite.request(http.MethodGet, "/api/keys/", suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), "secret")
+	var keys []map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &keys))
+	suite.Require().Len(keys, 3)
+	assert.Equal(suite.T(), false, keys[0]["signing"])
+	assert.Equal(suite.T(), true, keys[1]["signing"])
+	assert.Equal(suite.T(), false, keys[2]["signing"])
+}
+
+func (suite *KeyControllerTestSuite) TestRotate() {
+	suite.mockKeys.On("Rotate").Return(&model.SigningKey{Kid: "rotated", Algorithm: auth.AlgEdDSA}, nil).Once()
+
+	w := suite.request(http.MethodPost, "/api/keys/rotate", suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "rotated")
+	suite.mockKeys.AssertExpectations(suite.T())
+}
+
+func (suite *KeyControllerTestSuite) TestRotate_Forbidden() {
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleMupADMIN})
+	suite.Require().NoError(err)
+
+	w := suite.request(http.MethodPost, "/api/keys/rotate", "Bearer "+token)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockKeys.AssertNotCalled(suite.T(), "Rotate")
+}
+
+func (suite *KeyControllerTestSuite) TestRetire() {
+	suite.mockKeys.On("Retire", "old").Return(nil).Once()
+	suite.mockKeys.On("Retire", "current").Return(cerror.ErrSigningKeyInUse).Once()
+
+	w := suite.request(http.MethodDelete, "/api/keys/old", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/keys/current", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
@@ -3,9 +3,12 @@ package controller
 import (
 	"ePrometna_Server/app"
 	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"ePrometna_Server/util/paging"
 	"errors"
 	"net/http"
 
@@ -17,6 +20,7 @@ import (
 
 type LicenseController struct {
 	LicenseService service.IDriverLicenseCrudService
+	AccessPolicy   service.IAccessPolicyService
 	logger         *zap.SugaredLogger
 }
 
@@ -24,10 +28,11 @@ func NewLicenseController() *LicenseController {
 	var controller *LicenseController
 
 	// Use the mock service for testing
-	app.Invoke(func(licenseService service.IDriverLicenseCrudService, logger *zap.SugaredLogger) {
+	app.Invoke(func(licenseService service.IDriverLicenseCrudService, accessPolicy service.IAccessPolicyService, logger *zap.SugaredLogger) {
 		// create controller
 		controller = &LicenseController{
 			LicenseService: licenseService,
+			AccessPolicy:   accessPolicy,
 			logger:         logger,
 		}
 	})
@@ -38,6 +43,7 @@ func NewLicenseController() *LicenseController {
 func (c *LicenseController) RegisterEndpoints(api *gin.RouterGroup) {
 	// create a group with the name of the router
 	group := api.Group("/license")
+	group.Use(middleware.Protect())
 
 	// register Endpoints
 	group.POST("/", c.createLicense)
@@ -67,16 +73,8 @@ func (c *LicenseController) createLicense(ctx *gin.Context) {
 		ctx.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
-	_, claims, err := auth.ParseToken(ctx.Request.Header.Get("Authorization"))
-	if err != nil {
-		c.logger.Errorf("Failed to parse token: %v", err)
-		ctx.AbortWithError(http.StatusUnauthorized, err)
-		return
-	}
-	ownerUuid, err := uuid.Parse(claims.Uuid)
-	if err != nil {
-		c.logger.Errorf("Failed to parse owner UUID: %v", err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner UUID"})
+	ownerUuid, ok := loggedInUuid(ctx)
+	if !ok {
 		return
 	}
 	license, err := licenseDto.ToModel()
@@ -113,6 +111,7 @@ func (c *LicenseController) createLicense(ctx *gin.Context) {
 //	@Produce	json
 //	@Success	200	{object}	dto.DriverLicenseDto
 //	@Failure	400
+//	@Failure	403
 //	@Failure	404
 //	@Failure	500
 //	@Param		uuid	path	string	true	"License UUID"
@@ -136,6 +135,10 @@ func (c *LicenseController) getLicense(ctx *gin.Context) {
 		return
 	}
 
+	if !c.checkAccess(ctx, license, c.AccessPolicy.CanViewLicense) {
+		return
+	}
+
 	var licenseDto dto.DriverLicenseDto
 	ctx.JSON(http.StatusOK, licenseDto.FromModel(license))
 }
@@ -144,18 +147,25 @@ func (c *LicenseController) getLicense(ctx *gin.Context) {
 //
 //	@Summary	Gets your licenses
 //	@Schemes
+//	@Description	Fetches a page of your licenses, or of every license with license:read-any.
+//	@Description	Filters: licenseNumber and category (also [contains]), issueDate, expiringDate
+//	@Description	and createdAt (also [gte] and [lte]).
 //	@Tags		license
 //	@Produce	json
+//	@Param		limit	query	int		false	"Page size, at most 100"
+//	@Param		offset	query	int		false	"Rows to skip, can't be used with cursor"
+//	@Param		cursor	query	string	false	"X-Next-Cursor of the previous page"
+//	@Param		sort	query	string	false	"Comma separated fields, - sorts descending"
+//	@Header		200		{int}		X-Total-Count	"Number of rows matching the filters"
+//	@Header		200		{string}	Link		"Links to the first, previous, next and last page"
 //	@Success	200	{object}	[]dto.DriverLicenseDto
 //	@Failure	400
 //	@Failure	404
 //	@Failure	500
 //	@Router		/license [get]
 func (c *LicenseController) getAllLicenses(ctx *gin.Context) {
-	_, claims, err := auth.ParseToken(ctx.Request.Header.Get("Authorization"))
-	if err != nil {
-		c.logger.Errorf("Failed to parse token: %v", err)
-		ctx.AbortWithError(http.StatusUnauthorized, err)
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
 		return
 	}
 	userUuid, err := uuid.Parse(claims.Uuid)
@@ -165,8 +175,23 @@ func (c *LicenseController) getAllLicenses(ctx *gin.Context) {
 		return
 	}
 
-	licenses, err := c.LicenseService.GetAll()
+	params, ok := bindPaging(ctx, service.LicenseListSpec)
+	if !ok {
+		return
+	}
+
+	// Users that can't see every license only get their own
+	var licenses []model.DriverLicense
+	var page *paging.Page
+	if claims.HasPermissions(model.PermLicenseReadAny) {
+		licenses, page, err = c.LicenseService.GetAll(params)
+	} else {
+		licenses, page, err = c.LicenseService.GetAllForUser(userUuid, params)
+	}
 	if err != nil {
+		if abortInvalidQuery(ctx, err) {
+			return
+		}
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.logger.Errorf("Licenses for user uuid = %s not found", userUuid)
 			ctx.AbortWithError(http.StatusNotFound, err)
@@ -182,6 +207,7 @@ func (c *LicenseController) getAllLicenses(ctx *gin.Context) {
 		licenseDtos = append(licenseDtos, *licenseDto.FromModel(&license))
 	}
 
+	setPageHeaders(ctx, page)
 	ctx.JSON(http.StatusOK, licenseDtos)
 }
 
@@ -193,6 +219,7 @@ func (c *LicenseController) getAllLicenses(ctx *gin.Context) {
 //	@Produce	json
 //	@Success	200	{object}	dto.DriverLicenseDto
 //	@Failure	400
+//	@Failure	403
 //	@Failure	404
 //	@Failure	500
 //	@Param		uuid	path	string					true	"License UUID"
@@ -212,13 +239,17 @@ func (c *LicenseController) updateLicense(ctx *gin.Context) {
 		ctx.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
-	model, err := updateDto.ToModel()
+	updated, err := updateDto.ToModel()
 	if err != nil {
 		ctx.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	updatedLicense, err := c.LicenseService.Update(licenseUuid, model)
+	if !c.canManage(ctx, licenseUuid) {
+		return
+	}
+
+	updatedLicense, err := c.LicenseService.Update(licenseUuid, updated)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.logger.Errorf("License with uuid = %s not found", licenseUuid)
@@ -239,6 +270,7 @@ func (c *LicenseController) updateLicense(ctx *gin.Context) {
 //	@Tags		license
 //	@Success	204
 //	@Failure	400
+//	@Failure	403
 //	@Failure	404
 //	@Failure	500
 //	@Param		uuid	path	string	true	"License UUID"
@@ -251,6 +283,10 @@ func (c *LicenseController) deleteLicense(ctx *gin.Context) {
 		return
 	}
 
+	if !c.canManage(ctx, licenseUuid) {
+		return
+	}
+
 	err = c.LicenseService.Delete(licenseUuid)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -264,3 +300,37 @@ func (c *LicenseController) deleteLicense(ctx *gin.Context) {
 
 	ctx.AbortWithStatus(http.StatusNoContent)
 }
+
+// canManage aborts the request if the license doesn't exist or the logged in
+// user may not change it
+func (c *LicenseController) canManage(ctx *gin.Context, licenseUuid uuid.UUID) bool {
+	license, err := c.LicenseService.GetByUuid(licenseUuid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.logger.Errorf("License with uuid = %s not found", licenseUuid)
+			ctx.AbortWithError(http.StatusNotFound, err)
+			return false
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return false
+	}
+
+	return c.checkAccess(ctx, license, c.AccessPolicy.CanManageLicense)
+}
+
+func (c *LicenseController) checkAccess(ctx *gin.Context, license *model.DriverLicense, policy func(*auth.Claims, *model.DriverLicense) error) bool {
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
+		return false
+	}
+
+	if err := policy(claims, license); err != nil {
+		if abortForbidden(ctx, err) {
+			return false
+		}
+		c.logger.Errorf("Failed to check access to license %s: %+v", license.Uuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
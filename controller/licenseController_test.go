@@ -10,6 +10,7 @@ import (
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -48,12 +49,28 @@ func (m *MockDriverLicenseCrudService) GetByUuid(id uuid.UUID) (*model.DriverLic
 	return args.Get(0).(*model.DriverLicense), args.Error(1)
 }
 
-func (m *MockDriverLicenseCrudService) GetAll() ([]model.DriverLicense, error) {
-	args := m.Called()
+func (m *MockDriverLicenseCrudService) GetAll(params *paging.Params) ([]model.DriverLicense, *paging.Page, error) {
+	args := m.Called(params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, page, args.Error(2)
+	}
+	return args.Get(0).([]model.DriverLicense), page, args.Error(2)
+}
+
+func (m *MockDriverLicenseCrudService) GetAllForUser(userUuid uuid.UUID, params *paging.Params) ([]model.DriverLicense, *paging.Page, error) {
+	args := m.Called(userUuid, params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
+	if args.Get(0) == nil {
+		return nil, page, args.Error(2)
 	}
-	return args.Get(0).([]model.DriverLicense), args.Error(1)
+	return args.Get(0).([]model.DriverLicense), page, args.Error(2)
 }
 
 func (m *MockDriverLicenseCrudService) Update(id uuid.UUID, updated *model.DriverLicense) (*model.DriverLicense, error) {
@@ -74,6 +91,7 @@ type LicenseControllerTestSuite struct {
 	suite.Suite
 	router             *gin.Engine
 	mockLicenseService *MockDriverLicenseCrudService
+	mockAccessPolicy   *MockAccessPolicyService
 	logger             *zap.SugaredLogger
 	logObserver        *observer.ObservedLogs
 }
@@ -93,10 +111,12 @@ func (suite *LicenseControllerTestSuite) SetupSuite() {
 	}
 
 	suite.mockLicenseService = new(MockDriverLicenseCrudService)
+	suite.mockAccessPolicy = new(MockAccessPolicyService)
 
 	app.Test()
 	app.Provide(func() *zap.SugaredLogger { return suite.logger })
 	app.Provide(func() service.IDriverLicenseCrudService { return suite.mockLicenseService })
+	app.Provide(func() service.IAccessPolicyService { return suite.mockAccessPolicy })
 
 	suite.router = gin.Default()
 	apiGroup := suite.router.Group("/api")
@@ -116,6 +136,8 @@ func (suite *LicenseControllerTestSuite) TearDownSuite() {
 func (suite *LicenseControllerTestSuite) SetupTest() {
 	suite.mockLicenseService.ExpectedCalls = nil
 	suite.mockLicenseService.Calls = nil
+	suite.mockAccessPolicy.ExpectedCalls = nil
+	suite.mockAccessPolicy.Calls = nil
 }
 
 // Helper to generate a token for a test user (can be shared or specific)
@@ -230,6 +252,7 @@ func (suite *LicenseControllerTestSuite) TestGetLicense_Success() {
 		IssueDate: time.Now().AddDate(-2, 0, 0), ExpiringDate: time.Now().AddDate(8, 0, 0),
 	}
 	suite.mockLicenseService.On("GetByUuid", targetLicenseUUID).Return(expectedLicense, nil).Once()
+	suite.mockAccessPolicy.On("CanViewLicense", mock.Anything, expectedLicense).Return(nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/license/"+targetLicenseUUID.String(), nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -269,7 +292,7 @@ func (suite *LicenseControllerTestSuite) TestGetAllLicenses_Success() {
 		{Uuid: uuid.New(), LicenseNumber: "L1", Category: "B", IssueDate: time.Now(), ExpiringDate: time.Now().AddDate(5, 0, 0)},
 		{Uuid: uuid.New(), LicenseNumber: "L2", Category: "C", IssueDate: time.Now(), ExpiringDate: time.Now().AddDate(3, 0, 0)},
 	}
-	suite.mockLicenseService.On("GetAll").Return(licenses, nil).Once()
+	suite.mockLicenseService.On("GetAllForUser", userUUID, mock.Anything).Return(licenses, &paging.Page{Total: 2, Limit: paging.DefaultLimit}, nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/license/", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -297,6 +320,10 @@ func (suite *LicenseControllerTestSuite) TestUpdateLicense_Success() {
 	}
 	updatedLicenseModel, _ := updateDto.ToModel()
 	updatedLicenseModel.Uuid = targetLicenseUUID
+	existing := &model.DriverLicense{Uuid: targetLicenseUUID}
+
+	suite.mockLicenseService.On("GetByUuid", targetLicenseUUID).Return(existing, nil).Once()
+	suite.mockAccessPolicy.On("CanManageLicense", mock.Anything, existing).Return(nil).Once()
 
 	suite.mockLicenseService.On("Update", targetLicenseUUID, mock.MatchedBy(func(l *model.DriverLicense) bool {
 		return l.LicenseNumber == updateDto.LicenseNumber && l.Category == updateDto.Category
@@ -323,6 +350,9 @@ func (suite *LicenseControllerTestSuite) TestDeleteLicense_Success() {
 	token := generateLicenseTestToken(userUUID, "deleter@example.com", model.RoleOsoba)
 	targetLicenseUUID := uuid.New()
 
+	existing := &model.DriverLicense{Uuid: targetLicenseUUID}
+	suite.mockLicenseService.On("GetByUuid", targetLicenseUUID).Return(existing, nil).Once()
+	suite.mockAccessPolicy.On("CanManageLicense", mock.Anything, existing).Return(nil).Once()
 	suite.mockLicenseService.On("Delete", targetLicenseUUID).Return(nil).Once()
 
 	req, _ := http.NewRequest(http.MethodDelete, "/api/license/"+targetLicenseUUID.String(), nil)
@@ -340,7 +370,7 @@ func (suite *LicenseControllerTestSuite) TestDeleteLicense_NotFound() {
 	token := generateLicenseTestToken(userUUID, "deleter@example.com", model.RoleOsoba)
 	targetLicenseUUID := uuid.New()
 
-	suite.mockLicenseService.On("Delete", targetLicenseUUID).Return(gorm.ErrRecordNotFound).Once()
+	suite.mockLicenseService.On("GetByUuid", targetLicenseUUID).Return(nil, gorm.ErrRecordNotFound).Once()
 
 	req, _ := http.NewRequest(http.MethodDelete, "/api/license/"+targetLicenseUUID.String(), nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -351,3 +381,65 @@ func (suite *LicenseControllerTestSuite) TestDeleteLicense_NotFound() {
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
 	suite.mockLicenseService.AssertExpectations(suite.T())
 }
+
+func (suite *LicenseControllerTestSuite) TestGetAllLicenses_Viewer() {
+	token := generateLicenseTestToken(uuid.New(), "officer@example.com", model.RolePolicija)
+
+	licenses := []model.DriverLicense{
+		{Uuid: uuid.New(), LicenseNumber: "L1", Category: "B", IssueDate: time.Now(), ExpiringDate: time.Now().AddDate(5, 0, 0)},
+	}
+	suite.mockLicenseService.On("GetAll", mock.Anything).Return(licenses, &paging.Page{Total: 1, Limit: paging.DefaultLimit}, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/license/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockLicenseService.AssertExpectations(suite.T())
+}
+
+func (suite *LicenseControllerTestSuite) TestGetLicense_NotOwner() {
+	token := generateLicenseTestToken(uuid.New(), "stranger@example.com", model.RoleOsoba)
+	targetLicenseUUID := uuid.New()
+	license := &model.DriverLicense{Uuid: targetLicenseUUID, LicenseNumber: "OTHER"}
+	suite.mockLicenseService.On("GetByUuid", targetLicenseUUID).Return(license, nil).Once()
+	suite.mockAccessPolicy.On("CanViewLicense", mock.Anything, license).Return(cerror.ErrForbidden).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/license/"+targetLicenseUUID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockAccessPolicy.AssertExpectations(suite.T())
+}
+
+func (suite *LicenseControllerTestSuite) TestDeleteLicense_NotOwner() {
+	token := generateLicenseTestToken(uuid.New(), "stranger@example.com", model.RoleOsoba)
+	targetLicenseUUID := uuid.New()
+	license := &model.DriverLicense{Uuid: targetLicenseUUID}
+	suite.mockLicenseService.On("GetByUuid", targetLicenseUUID).Return(license, nil).Once()
+	suite.mockAccessPolicy.On("CanManageLicense", mock.Anything, license).Return(cerror.ErrForbidden).Once()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/api/license/"+targetLicenseUUID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockLicenseService.AssertNotCalled(suite.T(), "Delete", targetLicenseUUID)
+}
+
+func (suite *LicenseControllerTestSuite) TestGetLicense_Unauthorized() {
+	req, _ := http.NewRequest(http.MethodGet, "/api/license/"+uuid.New().String(), nil)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	suite.mockLicenseService.AssertNotCalled(suite.T(), "GetByUuid", mock.Anything)
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type LockController struct {
+	throttleService service.ILoginThrottleService
+	logger          *zap.SugaredLogger
+}
+
+func NewLockController() *LockController {
+	var controller *LockController
+	app.Invoke(func(throttleService service.ILoginThrottleService, logger *zap.SugaredLogger) {
+		controller = &LockController{
+			throttleService: throttleService,
+			logger:          logger,
+		}
+	})
+	return controller
+}
+
+func (c *LockController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/locks")
+	group.Use(middleware.Protect(model.PermLockManage))
+
+	// register Endpoints
+	group.GET("/", c.getAll)
+	group.DELETE("/:uuid", c.unlock)
+}
+
+// getAll godoc
+//
+//	@Summary		List lock events
+//	@Description	Lists accounts, IP addresses and police code guessers locked after too many failed attempts
+//	@Tags			locks
+//	@Produce		json
+//	@Param			active	query	bool	false	"Only locks that are still active"
+//	@Success		200		{array}	dto.LockEventDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/locks [get]
+func (c *LockController) getAll(ctx *gin.Context) {
+	events, err := c.throttleService.GetLockEvents(ctx.Query("active") == "true")
+	if err != nil {
+		c.logger.Errorf("Failed to fetch lock events err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	dtos := make([]dto.LockEventDto, 0, len(events))
+	for _, event := range events {
+		dtos = append(dtos, dto.LockEventDto{}.FromModel(&event, now))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// unlock godoc
+//
+//	@Summary		Unlock
+//	@Description	Ends an active lock before it expires and clears its failed attempts
+//	@Tags			locks
+//	@Param			uuid	path	string	true	"Lock event UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/locks/{uuid} [delete]
+func (c *LockController) unlock(ctx *gin.Context) {
+	eventUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		c.logger.Errorf("Error parsing UUID = %s", ctx.Param("uuid"))
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.throttleService.Unlock(eventUuid, adminUuid); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.logger.Errorf("Lock event uuid = %s not found", eventUuid)
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrOutdated):
+			c.logger.Debugf("Lock event uuid = %s is no longer active", eventUuid)
+			ctx.AbortWithError(http.StatusConflict, err)
+		default:
+			c.logger.Errorf("Failed to unlock uuid = %s err = %+v", eventUuid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,165 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockLoginThrottleService struct {
+	mock.Mock
+}
+
+func (m *MockLoginThrottleService) Check(keys ...service.ThrottleKey) error {
+	args := m.Called(keys)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) Fail(keys ...service.ThrottleKey) error {
+	args := m.Called(keys)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) Reset(keys ...service.ThrottleKey) error {
+	args := m.Called(keys)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) GetLockEvents(activeOnly bool) ([]model.LockEvent, error) {
+	args := m.Called(activeOnly)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.LockEvent), args.Error(1)
+}
+
+func (m *MockLoginThrottleService) Unlock(eventUuid uuid.UUID, adminUuid uuid.UUID) error {
+	args := m.Called(eventUuid, adminUuid)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) Cleanup() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+type LockControllerTestSuite struct {
+	suite.Suite
+	router       *gin.Engine
+	mockThrottle *MockLoginThrottleService
+	adminUuid    uuid.UUID
+	adminToken   string
+}
+
+func (suite *LockControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "lock-ctrl-test-access-key",
+		RefreshKey: "lock-ctrl-test-refresh-key",
+	}
+
+	suite.mockThrottle = new(MockLoginThrottleService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.ILoginThrottleService { return suite.mockThrottle })
+
+	suite.router = gin.New()
+	controller.NewLockController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.adminUuid = uuid.New()
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: suite.adminUuid, Role: model.RoleMupADMIN})
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+}
+
+func (suite *LockControllerTestSuite) SetupTest() {
+	suite.mockThrottle.ExpectedCalls = nil
+	suite.mockThrottle.Calls = nil
+}
+
+func TestLockController(t *testing.T) {
+	suite.Run(t, new(LockControllerTestSuite))
+}
+
+func (suite *LockControllerTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *LockControllerTestSuite) TestGetAll() {
+	unlockedAt := time.Now()
+	suite.mockThrottle.On("GetLockEvents", true).Return([]model.LockEvent{
+		{Uuid: uuid.New(), Scope: model.ThrottleScopeEmail, Key: "user@example.com", Failures: 10, LockedUntil: time.Now().Add(time.Minute)},
+		{Uuid: uuid.New(), Scope: model.ThrottleScopeIp, Key: "192.0.2.1", Failures: 100, LockedUntil: time.Now().Add(time.Minute), UnlockedAt: &unlockedAt, UnlockedBy: &suite.adminUuid},
+	}, nil).Once()
+
+	w := suite.request(http.MethodGet, "/api/locks/?active=true", suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var events []map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &events))
+	suite.Require().Len(events, 2)
+	assert.Equal(suite.T(), "user@example.com", events[0]["key"])
+	assert.Equal(suite.T(), true, events[0]["active"])
+	assert.Equal(suite.T(), false, events[1]["active"])
+	assert.Equal(suite.T(), suite.adminUuid.String(), events[1]["unlockedBy"])
+	suite.mockThrottle.AssertExpectations(suite.T())
+}
+
+func (suite *LockControllerTestSuite) TestGetAll_Forbidden() {
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RolePolicija})
+	suite.Require().NoError(err)
+
+	w := suite.request(http.MethodGet, "/api/locks/", "Bearer "+token)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockThrottle.AssertNotCalled(suite.T(), "GetLockEvents", mock.Anything)
+}
+
+func (suite *LockControllerTestSuite) TestUnlock() {
+	eventUuid := uuid.New()
+	suite.mockThrottle.On("Unlock", eventUuid, suite.adminUuid).Return(nil).Once()
+
+	w := suite.request(http.MethodDelete, "/api/locks/"+eventUuid.String(), suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockThrottle.AssertExpectations(suite.T())
+}
+
+func (suite *LockControllerTestSuite) TestUnlock_Errors() {
+	notFound, expired := uuid.New(), uuid.New()
+	suite.mockThrottle.On("Unlock", notFound, suite.adminUuid).Return(gorm.ErrRecordNotFound).Once()
+	suite.mockThrottle.On("Unlock", expired, suite.adminUuid).Return(cerror.ErrOutdated).Once()
+
+	w := suite.request(http.MethodDelete, "/api/locks/"+notFound.String(), suite.adminToken)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/locks/"+expired.String(), suite.adminToken)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/locks/bad-uuid", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
@@ -2,17 +2,20 @@ package controller
 
 import (
 	"ePrometna_Server/app"
-	"ePrometna_Server/config"
 	"ePrometna_Server/dto"
 	"ePrometna_Server/model"
 	"ePrometna_Server/service"
-	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type LoginController struct {
@@ -42,6 +45,12 @@ func (c *LoginController) RegisterEndpoints(api *gin.RouterGroup) {
 	// register Endpoints
 	group.POST("/login", c.login)
 	group.POST("/refresh", c.RefreshToken)
+	group.POST("/mfa/verify", c.VerifyMfa)
+	group.POST("/mfa/enroll", c.BeginMfaEnrollment)
+	group.POST("/mfa/enroll/confirm", c.ConfirmMfaEnrollment)
+	group.POST("/logout", middleware.Protect(), c.Logout)
+	group.POST("/logout-all", middleware.Protect(), c.LogoutAll)
+	group.POST("/revoke/:uuid", middleware.Protect(model.PermTokenRevoke), c.RevokeUser)
 
 	// Add mobile-specific endpoints
 	group.POST("/user/register", c.RegisterMobile)
@@ -51,12 +60,15 @@ func (c *LoginController) RegisterEndpoints(api *gin.RouterGroup) {
 // Login godoc
 //
 //	@Summary		User login
-//	@Description	Authenticates a user and returns access and refresh tokens
+//	@Description	Authenticates a user and returns access and refresh tokens, roles that require
+//	@Description	a second factor get an mfaToken instead which is exchanged at /auth/mfa/verify
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			loginDto	body		dto.LoginDto	true	"Login credentials"
-//	@Success		200			{object}	dto.TokenDto
+//	@Success		200			{object}	dto.LoginResponseDto
+//	@Failure		401
+//	@Failure		429
 //	@Router			/auth/login [post]
 func (l *LoginController) login(c *gin.Context) {
 	var loginDto dto.LoginDto
@@ -66,19 +78,144 @@ func (l *LoginController) login(c *gin.Context) {
 		return
 	}
 
-	accessToken, refreshToken, err := l.loginService.Login(loginDto.Email, loginDto.Password)
+	result, err := l.loginService.Login(loginDto.Email, loginDto.Password, c.ClientIP())
 	if err != nil {
+		if abortThrottled(c, l.logger, err) {
+			return
+		}
 		l.logger.Errorf("Login failed err = %+v", err)
 		c.JSON(http.StatusUnauthorized, err.Error())
 		return
 	}
 
+	c.JSON(http.StatusOK, dto.LoginResponseDto{
+		AccessToken:       result.AccessToken,
+		RefreshToken:      result.RefreshToken,
+		MfaToken:          result.MfaToken,
+		MfaEnrollRequired: result.MfaEnrollRequired,
+	})
+}
+
+// VerifyMfa godoc
+//
+//	@Summary		Second login step
+//	@Description	Exchanges an mfaToken and a TOTP or recovery code for access and refresh tokens
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			mfaVerifyDto	body		dto.MfaVerifyDto	true	"Challenge and code"
+//	@Success		200				{object}	dto.TokenDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		429
+//	@Failure		500
+//	@Router			/auth/mfa/verify [post]
+func (l *LoginController) VerifyMfa(c *gin.Context) {
+	var verifyDto dto.MfaVerifyDto
+	if err := c.BindJSON(&verifyDto); err != nil {
+		l.logger.Errorf("Invalid mfa verify request err = %+v", err)
+		return
+	}
+
+	accessToken, refreshToken, err := l.loginService.VerifyMfa(verifyDto.MfaToken, verifyDto.Code, c.ClientIP())
+	if err != nil {
+		l.handleMfaError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.TokenDto{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 	})
 }
 
+// BeginMfaEnrollment godoc
+//
+//	@Summary		Start second factor enrollment during login
+//	@Description	Returns a new TOTP secret and otpauth URI for a user that has to enroll before logging in
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			mfaTokenDto	body		dto.MfaTokenDto	true	"Challenge"
+//	@Success		200			{object}	dto.MfaEnrollmentDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		409
+//	@Failure		500
+//	@Router			/auth/mfa/enroll [post]
+func (l *LoginController) BeginMfaEnrollment(c *gin.Context) {
+	var tokenDto dto.MfaTokenDto
+	if err := c.BindJSON(&tokenDto); err != nil {
+		l.logger.Errorf("Invalid mfa enroll request err = %+v", err)
+		return
+	}
+
+	enrollment, err := l.loginService.BeginMfaEnrollment(tokenDto.MfaToken)
+	if err != nil {
+		l.handleMfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MfaEnrollmentDto{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.Uri,
+	})
+}
+
+// ConfirmMfaEnrollment godoc
+//
+//	@Summary		Confirm second factor enrollment during login
+//	@Description	Confirms the TOTP secret with a code, returns tokens and single use recovery codes
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			mfaVerifyDto	body		dto.MfaVerifyDto	true	"Challenge and code"
+//	@Success		200				{object}	dto.MfaEnrollmentCompleteDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		429
+//	@Failure		500
+//	@Router			/auth/mfa/enroll/confirm [post]
+func (l *LoginController) ConfirmMfaEnrollment(c *gin.Context) {
+	var verifyDto dto.MfaVerifyDto
+	if err := c.BindJSON(&verifyDto); err != nil {
+		l.logger.Errorf("Invalid mfa confirm request err = %+v", err)
+		return
+	}
+
+	result, err := l.loginService.ConfirmMfaEnrollment(verifyDto.MfaToken, verifyDto.Code, c.ClientIP())
+	if err != nil {
+		l.handleMfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MfaEnrollmentCompleteDto{
+		AccessToken:   result.AccessToken,
+		RefreshToken:  result.RefreshToken,
+		RecoveryCodes: result.RecoveryCodes,
+	})
+}
+
+func (l *LoginController) handleMfaError(c *gin.Context, err error) {
+	if abortThrottled(c, l.logger, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, cerror.ErrInvalidMfaToken),
+		errors.Is(err, cerror.ErrInvalidMfaCode):
+		l.logger.Debugf("Second factor rejected err = %+v", err)
+		c.JSON(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, cerror.ErrMfaAlreadyEnrolled):
+		c.JSON(http.StatusConflict, err.Error())
+	case errors.Is(err, cerror.ErrMfaNotEnrolled):
+		c.JSON(http.StatusBadRequest, err.Error())
+	default:
+		l.logger.Errorf("Second factor failed err = %+v", err)
+		c.JSON(http.StatusInternalServerError, err.Error())
+	}
+}
+
 // LoginMobile godoc
 //
 //	@Summary		Mobile login with device registration
@@ -88,6 +225,8 @@ func (l *LoginController) login(c *gin.Context) {
 //	@Produce		json
 //	@Param			mobileLoginDto	body		dto.MobileRegisterDto	true	"Mobile login credentials"
 //	@Success		200				{object}	dto.DeviceLoginResponse
+//	@Failure		401
+//	@Failure		429
 //	@Router			/auth/user/register [post]
 func (l *LoginController) RegisterMobile(c *gin.Context) {
 	var loginDto dto.MobileRegisterDto
@@ -102,9 +241,13 @@ func (l *LoginController) RegisterMobile(c *gin.Context) {
 	result, err := l.loginService.LoginMobile(
 		loginDto.Email,
 		loginDto.Password,
+		c.ClientIP(),
 		loginDto.DeviceInfo,
 	)
 	if err != nil {
+		if abortThrottled(c, l.logger, err) {
+			return
+		}
 		l.logger.Errorf("Mobile login failed err = %+v", err)
 		c.JSON(http.StatusUnauthorized, err.Error())
 		return
@@ -121,11 +264,12 @@ func (l *LoginController) RegisterMobile(c *gin.Context) {
 // Refresh godoc
 //
 //	@Summary		Refresh Access Token
-//	@Description	Generates a new access token using a valid refresh token
+//	@Description	Rotates a refresh token, the used token is invalidated and a new pair is returned
 //	@Tags			auth
 //	@Produce		json
 //	@Param			refreshToken	body		dto.RefreshDto	true	"Refresh Token"
 //	@Success		200				{object}	dto.TokenDto
+//	@Failure		401
 //	@Router			/auth/refresh [post]
 func (l *LoginController) RefreshToken(c *gin.Context) {
 	var rToken dto.RefreshDto
@@ -135,39 +279,124 @@ func (l *LoginController) RefreshToken(c *gin.Context) {
 	}
 	l.logger.Debugf("Parsed token from body token = %+v", rToken)
 
-	var claims auth.Claims
-
-	_, err := jwt.ParseWithClaims(rToken.RefreshToken, &claims, func(token *jwt.Token) (any, error) {
-		return []byte(config.AppConfig.RefreshKey), nil
-	})
+	token, refreshNew, err := l.loginService.RefreshTokens(rToken.RefreshToken, c.ClientIP())
 	if err != nil {
-		l.logger.Errorf("Error Parsing clames err = %+v", err)
+		if errors.Is(err, cerror.ErrInvalidRefresh) || errors.Is(err, cerror.ErrRefreshReuse) {
+			l.logger.Debugf("Refresh rejected err = %+v", err)
+			c.JSON(http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		l.logger.Errorf("Refresh failed err = %+v", err)
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	userUuid, err := uuid.Parse(claims.Uuid)
-	if err != nil {
-		l.logger.Errorf("Error Parsing uuid err = %+v", err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+	c.JSON(http.StatusOK, dto.TokenDto{
+		AccessToken:  token,
+		RefreshToken: refreshNew,
+	})
+}
+
+// Logout godoc
+//
+//	@Summary		Logout
+//	@Description	Revokes the access token used for the request and, if given, the refresh token family
+//	@Tags			auth
+//	@Accept			json
+//	@Param			refreshToken	body	dto.RefreshDto	false	"Refresh Token"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		500
+//	@Router			/auth/logout [post]
+func (l *LoginController) Logout(c *gin.Context) {
+	claims, ok := loggedInClaims(c)
+	if !ok {
 		return
 	}
 
-	token, refreshNew, err := l.loginService.RefreshTokens(&model.User{
-		Uuid:  userUuid,
-		Email: claims.Email,
-		Role:  claims.Role,
-	})
+	// Body is optional, without it only the access token is revoked
+	var rToken dto.RefreshDto
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&rToken); err != nil {
+			l.logger.Errorf("Failed to bind refresh token JSON, err %+v", err)
+			return
+		}
+	}
+
+	if err := l.loginService.Logout(claims, rToken.RefreshToken); err != nil {
+		if errors.Is(err, cerror.ErrInvalidRefresh) || errors.Is(err, cerror.ErrInvalidTokenFormat) {
+			l.logger.Debugf("Logout rejected err = %+v", err)
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		l.logger.Errorf("Logout failed err = %+v", err)
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+//
+//	@Summary		Logout everywhere
+//	@Description	Revokes every access, device and refresh token of the logged in user
+//	@Tags			auth
+//	@Success		204
+//	@Failure		401
+//	@Failure		404
+//	@Failure		500
+//	@Router			/auth/logout-all [post]
+func (l *LoginController) LogoutAll(c *gin.Context) {
+	userUuid, ok := loggedInUuid(c)
+	if !ok {
+		return
+	}
+
+	l.logoutEverywhere(c, userUuid)
+}
+
+// RevokeUser godoc
+//
+//	@Summary		Revoke all tokens of a user
+//	@Description	Revokes every access, device and refresh token of a user, used to cut off a compromised device
+//	@Tags			auth
+//	@Param			uuid	path	string	true	"User UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/auth/revoke/{uuid} [post]
+func (l *LoginController) RevokeUser(c *gin.Context) {
+	userUuid, err := uuid.Parse(c.Param("uuid"))
 	if err != nil {
-		l.logger.Error("Refresh failed err = %+v", err)
-		c.JSON(http.StatusInternalServerError, err.Error())
+		l.logger.Errorf("Error parsing UUID = %s", c.Param("uuid"))
+		c.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.TokenDto{
-		AccessToken:  token,
-		RefreshToken: refreshNew,
-	})
+	l.logoutEverywhere(c, userUuid)
+}
+
+func (l *LoginController) logoutEverywhere(c *gin.Context, userUuid uuid.UUID) {
+	if err := l.loginService.LogoutEverywhere(userUuid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.logger.Errorf("User with uuid = %s not found", userUuid)
+			c.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		l.logger.Errorf("Failed to revoke tokens of user = %s, err = %+v", userUuid, err)
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
 // LoginPolice godoc
@@ -179,6 +408,8 @@ func (l *LoginController) RefreshToken(c *gin.Context) {
 //	@Produce		json
 //	@Param			mobileLoginDto	body		dto.PoliceRegisterDto	true	"Police login credentials"
 //	@Success		200				{object}	dto.DeviceLoginResponse
+//	@Failure		401
+//	@Failure		429
 //	@Router			/auth/police/register [post]
 func (l *LoginController) RegisterPolice(c *gin.Context) {
 	var loginDto dto.PoliceRegisterDto
@@ -198,9 +429,13 @@ func (l *LoginController) RegisterPolice(c *gin.Context) {
 	// Use the service to handle mobile login
 	result, err := l.loginService.RegisterPolice(
 		loginDto.Code,
+		c.ClientIP(),
 		loginDto.DeviceInfo,
 	)
 	if err != nil {
+		if abortThrottled(c, l.logger, err) {
+			return
+		}
 		l.logger.Errorf("Police login failed err = %+v", err)
 		c.JSON(http.StatusUnauthorized, err.Error())
 		return
@@ -213,3 +448,16 @@ func (l *LoginController) RegisterPolice(c *gin.Context) {
 		DeviceToken:  result.DeviceToken,
 	})
 }
+
+// abortThrottled responds with 429 and a Retry-After header if err is a rejected attempt
+func abortThrottled(c *gin.Context, logger *zap.SugaredLogger, err error) bool {
+	var throttled *service.ThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+
+	logger.Warnf("Attempt from ip = %s throttled, locked = %t", c.ClientIP(), throttled.Locked)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, err.Error())
+	return true
+}
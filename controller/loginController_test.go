@@ -20,13 +20,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
 )
 
 // --- Mock LoginService (remains the same) ---
@@ -35,13 +35,18 @@ type MockLoginService struct {
 }
 
 // RegisterPolice implements service.ILoginService.
-func (m *MockLoginService) RegisterPolice(code string, deviceInfo device.DeviceInfo) (*service.MobileLoginResult, error) {
-	panic("unimplemented")
+func (m *MockLoginService) RegisterPolice(code, ip string, deviceInfo device.DeviceInfo) (*service.MobileLoginResult, error) {
+	args := m.Called(code, ip, deviceInfo)
+	var res *service.MobileLoginResult
+	if v := args.Get(0); v != nil {
+		res = v.(*service.MobileLoginResult)
+	}
+	return res, args.Error(1)
 }
 
 // LoginMobile implements service.ILoginService.
-func (m *MockLoginService) LoginMobile(email string, password string, deviceInfo device.DeviceInfo) (*service.MobileLoginResult, error) {
-	args := m.Called(email, password, deviceInfo)
+func (m *MockLoginService) LoginMobile(email, password, ip string, deviceInfo device.DeviceInfo) (*service.MobileLoginResult, error) {
+	args := m.Called(email, password, ip, deviceInfo)
 	var res *service.MobileLoginResult
 	if v := args.Get(0); v != nil {
 		res = v.(*service.MobileLoginResult)
@@ -49,16 +54,67 @@ func (m *MockLoginService) LoginMobile(email string, password string, deviceInfo
 	return res, args.Error(1)
 }
 
-func (m *MockLoginService) Login(email, password string) (string, string, error) {
-	args := m.Called(email, password)
+func (m *MockLoginService) Login(email, password, ip string) (*service.LoginResult, error) {
+	args := m.Called(email, password, ip)
+	var res *service.LoginResult
+	if v := args.Get(0); v != nil {
+		res = v.(*service.LoginResult)
+	}
+	return res, args.Error(1)
+}
+
+func (m *MockLoginService) CompleteLogin(user *model.User, ip string) (*service.LoginResult, error) {
+	args := m.Called(user, ip)
+	var res *service.LoginResult
+	if v := args.Get(0); v != nil {
+		res = v.(*service.LoginResult)
+	}
+	return res, args.Error(1)
+}
+
+func (m *MockLoginService) VerifyMfa(mfaToken, code, ip string) (string, string, error) {
+	args := m.Called(mfaToken, code, ip)
 	return args.String(0), args.String(1), args.Error(2)
 }
 
-func (m *MockLoginService) RefreshTokens(user *model.User) (string, string, error) {
-	args := m.Called(user)
+func (m *MockLoginService) BeginMfaEnrollment(mfaToken string) (*service.TotpEnrollment, error) {
+	args := m.Called(mfaToken)
+	var res *service.TotpEnrollment
+	if v := args.Get(0); v != nil {
+		res = v.(*service.TotpEnrollment)
+	}
+	return res, args.Error(1)
+}
+
+func (m *MockLoginService) ConfirmMfaEnrollment(mfaToken, code, ip string) (*service.MfaEnrollmentResult, error) {
+	args := m.Called(mfaToken, code, ip)
+	var res *service.MfaEnrollmentResult
+	if v := args.Get(0); v != nil {
+		res = v.(*service.MfaEnrollmentResult)
+	}
+	return res, args.Error(1)
+}
+
+func (m *MockLoginService) RefreshTokens(refreshToken, ip string) (string, string, error) {
+	args := m.Called(refreshToken, ip)
 	return args.String(0), args.String(1), args.Error(2)
 }
 
+func (m *MockLoginService) RevokeUserTokens(userId uint) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+
+func (m *MockLoginService) Logout(claims *auth.Claims, refreshToken string) error {
+	args := m.Called(claims.Uuid, refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockLoginService) LogoutEverywhere(userUuid uuid.UUID) error {
+	args := m.Called(userUuid)
+	return args.Error(0)
+}
+
 // --- LoginController Test Suite ---
 type LoginControllerTestSuite struct {
 	suite.Suite
@@ -123,7 +179,7 @@ func (suite *LoginControllerTestSuite) TestLogin_Success() {
 	expectedAccessToken := "new.access.token"
 	expectedRefreshToken := "new.refresh.token"
 
-	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password).Return(expectedAccessToken, expectedRefreshToken, nil).Once()
+	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password, mock.AnythingOfType("string")).Return(&service.LoginResult{AccessToken: expectedAccessToken, RefreshToken: expectedRefreshToken}, nil).Once()
 
 	jsonValue, _ := json.Marshal(loginDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonValue))
@@ -145,7 +201,7 @@ func (suite *LoginControllerTestSuite) TestLogin_Success() {
 
 func (suite *LoginControllerTestSuite) TestLogin_InvalidCredentials() {
 	loginDto := dto.LoginDto{Email: "wrong@example.com", Password: "wrongpassword"}
-	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password).Return("", "", cerror.ErrInvalidCredentials).Once()
+	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password, mock.AnythingOfType("string")).Return(nil, cerror.ErrInvalidCredentials).Once()
 
 	jsonValue, _ := json.Marshal(loginDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonValue))
@@ -161,7 +217,7 @@ func (suite *LoginControllerTestSuite) TestLogin_InvalidCredentials() {
 
 func (suite *LoginControllerTestSuite) TestLogin_ServiceError() {
 	loginDto := dto.LoginDto{Email: "test@example.com", Password: "password123"}
-	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password).Return("", "", errors.New("internal server error")).Once()
+	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password, mock.AnythingOfType("string")).Return(nil, errors.New("internal server error")).Once()
 
 	jsonValue, _ := json.Marshal(loginDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonValue))
@@ -185,29 +241,174 @@ func (suite *LoginControllerTestSuite) TestLogin_BindingError() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 }
 
-func (suite *LoginControllerTestSuite) TestRefreshToken_Success() {
-	userUUID := uuid.New()
-	userEmail := "refresh@example.com"
-	userRole := model.RoleOsoba
-
-	claims := &auth.Claims{
-		Email: userEmail,
-		Uuid:  userUUID.String(),
-		Role:  userRole,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-		},
-	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	refreshTokenString, _ := refreshToken.SignedString([]byte(config.AppConfig.RefreshKey))
+func (suite *LoginControllerTestSuite) TestLogin_Throttled() {
+	loginDto := dto.LoginDto{Email: "test@example.com", Password: "password123"}
+	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password, mock.AnythingOfType("string")).Return(nil, &service.ThrottledError{RetryAfter: 1500 * time.Millisecond}).Once()
+
+	jsonValue, _ := json.Marshal(loginDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
 
-	refreshDto := dto.RefreshDto{RefreshToken: refreshTokenString}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Equal(suite.T(), "2", w.Header().Get("Retry-After"))
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestRegisterPolice_Throttled() {
+	policeDto := dto.PoliceRegisterDto{Code: "guess", DeviceInfo: device.DeviceInfo{DeviceID: "device"}}
+	suite.mockLoginService.On("RegisterPolice", policeDto.Code, mock.AnythingOfType("string"), policeDto.DeviceInfo).Return(nil, &service.ThrottledError{RetryAfter: time.Hour, Locked: true}).Once()
+
+	jsonValue, _ := json.Marshal(policeDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/police/register", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Equal(suite.T(), "3600", w.Header().Get("Retry-After"))
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestLogin_MfaChallenge() {
+	loginDto := dto.LoginDto{Email: "admin@example.com", Password: "password123"}
+	suite.mockLoginService.On("Login", loginDto.Email, loginDto.Password, mock.AnythingOfType("string")).Return(&service.LoginResult{MfaToken: "mfa.token", MfaEnrollRequired: true}, nil).Once()
+
+	jsonValue, _ := json.Marshal(loginDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var responseDto dto.LoginResponseDto
+	err := json.Unmarshal(w.Body.Bytes(), &responseDto)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), responseDto.AccessToken)
+	assert.Equal(suite.T(), "mfa.token", responseDto.MfaToken)
+	assert.True(suite.T(), responseDto.MfaEnrollRequired)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestVerifyMfa_Success() {
+	verifyDto := dto.MfaVerifyDto{MfaToken: "mfa.token", Code: "123456"}
+	suite.mockLoginService.On("VerifyMfa", verifyDto.MfaToken, verifyDto.Code, mock.AnythingOfType("string")).Return("new.access.token", "new.refresh.token", nil).Once()
+
+	jsonValue, _ := json.Marshal(verifyDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/mfa/verify", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var responseDto dto.TokenDto
+	err := json.Unmarshal(w.Body.Bytes(), &responseDto)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "new.access.token", responseDto.AccessToken)
+	assert.Equal(suite.T(), "new.refresh.token", responseDto.RefreshToken)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestVerifyMfa_InvalidCode() {
+	verifyDto := dto.MfaVerifyDto{MfaToken: "mfa.token", Code: "000000"}
+	suite.mockLoginService.On("VerifyMfa", verifyDto.MfaToken, verifyDto.Code, mock.AnythingOfType("string")).Return("", "", cerror.ErrInvalidMfaCode).Once()
+
+	jsonValue, _ := json.Marshal(verifyDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/mfa/verify", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestVerifyMfa_BindingError() {
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/mfa/verify", strings.NewReader(`{"mfaToken": "mfa.token"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *LoginControllerTestSuite) TestBeginMfaEnrollment_Success() {
+	tokenDto := dto.MfaTokenDto{MfaToken: "mfa.token"}
+	suite.mockLoginService.On("BeginMfaEnrollment", tokenDto.MfaToken).Return(&service.TotpEnrollment{Secret: "SECRET", Uri: "otpauth://totp/x"}, nil).Once()
+
+	jsonValue, _ := json.Marshal(tokenDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/mfa/enroll", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var responseDto dto.MfaEnrollmentDto
+	err := json.Unmarshal(w.Body.Bytes(), &responseDto)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "SECRET", responseDto.Secret)
+	assert.Equal(suite.T(), "otpauth://totp/x", responseDto.OtpauthUri)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestBeginMfaEnrollment_AlreadyEnrolled() {
+	tokenDto := dto.MfaTokenDto{MfaToken: "mfa.token"}
+	suite.mockLoginService.On("BeginMfaEnrollment", tokenDto.MfaToken).Return(nil, cerror.ErrMfaAlreadyEnrolled).Once()
+
+	jsonValue, _ := json.Marshal(tokenDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/mfa/enroll", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestConfirmMfaEnrollment_Success() {
+	verifyDto := dto.MfaVerifyDto{MfaToken: "mfa.token", Code: "123456"}
+	suite.mockLoginService.On("ConfirmMfaEnrollment", verifyDto.MfaToken, verifyDto.Code, mock.AnythingOfType("string")).Return(&service.MfaEnrollmentResult{
+		AccessToken:   "new.access.token",
+		RefreshToken:  "new.refresh.token",
+		RecoveryCodes: []string{"aaaaa-bbbbb"},
+	}, nil).Once()
+
+	jsonValue, _ := json.Marshal(verifyDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/mfa/enroll/confirm", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var responseDto dto.MfaEnrollmentCompleteDto
+	err := json.Unmarshal(w.Body.Bytes(), &responseDto)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "new.access.token", responseDto.AccessToken)
+	assert.Equal(suite.T(), []string{"aaaaa-bbbbb"}, responseDto.RecoveryCodes)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestRefreshToken_Success() {
+	refreshDto := dto.RefreshDto{RefreshToken: "old.refresh.token"}
 	expectedAccessToken := "new.access.token.after.refresh"
 	expectedNewRefreshToken := "new.refresh.token.after.refresh"
 
-	suite.mockLoginService.On("RefreshTokens", mock.MatchedBy(func(user *model.User) bool {
-		return user.Uuid == userUUID && user.Email == userEmail && user.Role == userRole
-	})).Return(expectedAccessToken, expectedNewRefreshToken, nil).Once()
+	suite.mockLoginService.On("RefreshTokens", refreshDto.RefreshToken, mock.AnythingOfType("string")).
+		Return(expectedAccessToken, expectedNewRefreshToken, nil).Once()
 
 	jsonValue, _ := json.Marshal(refreshDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/refresh", bytes.NewBuffer(jsonValue))
@@ -226,16 +427,11 @@ func (suite *LoginControllerTestSuite) TestRefreshToken_Success() {
 	suite.mockLoginService.AssertExpectations(suite.T())
 }
 
-func (suite *LoginControllerTestSuite) TestRefreshToken_InvalidToken_Signature() {
-	userUUID := uuid.New()
-	claims := &auth.Claims{
-		Email: "test@example.com", Uuid: userUUID.String(), Role: model.RoleOsoba,
-		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour))},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	invalidTokenString, _ := token.SignedString([]byte("wrong-refresh-key"))
+func (suite *LoginControllerTestSuite) TestRefreshToken_InvalidToken() {
+	refreshDto := dto.RefreshDto{RefreshToken: "invalid.refresh.token"}
+	suite.mockLoginService.On("RefreshTokens", refreshDto.RefreshToken, mock.AnythingOfType("string")).
+		Return("", "", cerror.ErrInvalidRefresh).Once()
 
-	refreshDto := dto.RefreshDto{RefreshToken: invalidTokenString}
 	jsonValue, _ := json.Marshal(refreshDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/refresh", bytes.NewBuffer(jsonValue))
 	req.Header.Set("Content-Type", "application/json")
@@ -243,20 +439,16 @@ func (suite *LoginControllerTestSuite) TestRefreshToken_InvalidToken_Signature()
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
-	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
-	assert.Contains(suite.T(), w.Body.String(), "signature is invalid")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), cerror.ErrInvalidRefresh.Error())
+	suite.mockLoginService.AssertExpectations(suite.T())
 }
 
-func (suite *LoginControllerTestSuite) TestRefreshToken_Expired() {
-	userUUID := uuid.New()
-	claims := &auth.Claims{
-		Email: "test@example.com", Uuid: userUUID.String(), Role: model.RoleOsoba,
-		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-1 * time.Hour))},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	expiredTokenString, _ := token.SignedString([]byte(config.AppConfig.RefreshKey))
+func (suite *LoginControllerTestSuite) TestRefreshToken_Reused() {
+	refreshDto := dto.RefreshDto{RefreshToken: "reused.refresh.token"}
+	suite.mockLoginService.On("RefreshTokens", refreshDto.RefreshToken, mock.AnythingOfType("string")).
+		Return("", "", cerror.ErrRefreshReuse).Once()
 
-	refreshDto := dto.RefreshDto{RefreshToken: expiredTokenString}
 	jsonValue, _ := json.Marshal(refreshDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/refresh", bytes.NewBuffer(jsonValue))
 	req.Header.Set("Content-Type", "application/json")
@@ -264,26 +456,15 @@ func (suite *LoginControllerTestSuite) TestRefreshToken_Expired() {
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
-	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
-	assert.Contains(suite.T(), w.Body.String(), "token is expired")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), cerror.ErrRefreshReuse.Error())
+	suite.mockLoginService.AssertExpectations(suite.T())
 }
 
 func (suite *LoginControllerTestSuite) TestRefreshToken_ServiceError() {
-	userUUID := uuid.New()
-	userEmail := "refresh.fail@example.com"
-	userRole := model.RoleFirma
-	claims := &auth.Claims{
-		Email: userEmail, Uuid: userUUID.String(), Role: userRole,
-		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour))},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	validRefreshTokenString, _ := token.SignedString([]byte(config.AppConfig.RefreshKey))
-
-	refreshDto := dto.RefreshDto{RefreshToken: validRefreshTokenString}
-
-	suite.mockLoginService.On("RefreshTokens", mock.MatchedBy(func(user *model.User) bool {
-		return user.Uuid == userUUID
-	})).Return("", "", errors.New("service failed to refresh")).Once()
+	refreshDto := dto.RefreshDto{RefreshToken: "valid.refresh.token"}
+	suite.mockLoginService.On("RefreshTokens", refreshDto.RefreshToken, mock.AnythingOfType("string")).
+		Return("", "", errors.New("service failed to refresh")).Once()
 
 	jsonValue, _ := json.Marshal(refreshDto)
 	req, _ := http.NewRequest(http.MethodPost, "/api/auth/refresh", bytes.NewBuffer(jsonValue))
@@ -325,7 +506,7 @@ func (suite *LoginControllerTestSuite) TestLoginMobile_Success() {
 		DeviceToken:  "mobile.device.token",
 	}
 
-	suite.mockLoginService.On("LoginMobile", mobileLoginDto.Email, mobileLoginDto.Password, mobileLoginDto.DeviceInfo).
+	suite.mockLoginService.On("LoginMobile", mobileLoginDto.Email, mobileLoginDto.Password, mock.AnythingOfType("string"), mobileLoginDto.DeviceInfo).
 		Return(expectedResult, nil).Once()
 
 	jsonValue, _ := json.Marshal(mobileLoginDto)
@@ -357,7 +538,7 @@ func (suite *LoginControllerTestSuite) TestLoginMobile_ServiceError() {
 	}
 	serviceErr := errors.New("device registration failed")
 
-	suite.mockLoginService.On("LoginMobile", mobileLoginDto.Email, mobileLoginDto.Password, mobileLoginDto.DeviceInfo).
+	suite.mockLoginService.On("LoginMobile", mobileLoginDto.Email, mobileLoginDto.Password, mock.AnythingOfType("string"), mobileLoginDto.DeviceInfo).
 		Return((*service.MobileLoginResult)(nil), serviceErr).Once()
 
 	jsonValue, _ := json.Marshal(mobileLoginDto)
@@ -383,3 +564,112 @@ func (suite *LoginControllerTestSuite) TestLoginMobile_BindingError() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 	assert.Contains(suite.T(), w.Body.String(), "Invalid request format")
 }
+
+func (suite *LoginControllerTestSuite) authHeader(role model.UserRole) (string, uuid.UUID) {
+	user := &model.User{Uuid: uuid.New(), Email: "logout@example.com", Role: role}
+	accessToken, _, err := auth.GenerateTokens(user)
+	suite.Require().NoError(err)
+	return "Bearer " + accessToken, user.Uuid
+}
+
+func (suite *LoginControllerTestSuite) TestLogout_Success() {
+	header, userUuid := suite.authHeader(model.RoleOsoba)
+	suite.mockLoginService.On("Logout", userUuid.String(), "").Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestLogout_WithRefreshToken() {
+	header, userUuid := suite.authHeader(model.RoleOsoba)
+	suite.mockLoginService.On("Logout", userUuid.String(), "some.refresh.token").Return(nil).Once()
+
+	jsonValue, _ := json.Marshal(dto.RefreshDto{RefreshToken: "some.refresh.token"})
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/logout", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestLogout_InvalidRefreshToken() {
+	header, userUuid := suite.authHeader(model.RoleOsoba)
+	suite.mockLoginService.On("Logout", userUuid.String(), "bad").Return(cerror.ErrInvalidRefresh).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/logout", strings.NewReader(`{"refreshToken":"bad"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *LoginControllerTestSuite) TestLogout_NoToken() {
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	suite.mockLoginService.AssertNotCalled(suite.T(), "Logout", mock.Anything, mock.Anything)
+}
+
+func (suite *LoginControllerTestSuite) TestLogoutAll_Success() {
+	header, userUuid := suite.authHeader(model.RolePolicija)
+	suite.mockLoginService.On("LogoutEverywhere", userUuid).Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/logout-all", nil)
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestRevokeUser_Success() {
+	header, _ := suite.authHeader(model.RoleMupADMIN)
+	target := uuid.New()
+	suite.mockLoginService.On("LogoutEverywhere", target).Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/revoke/"+target.String(), nil)
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockLoginService.AssertExpectations(suite.T())
+}
+
+func (suite *LoginControllerTestSuite) TestRevokeUser_NotFound() {
+	header, _ := suite.authHeader(model.RoleSuperAdmin)
+	target := uuid.New()
+	suite.mockLoginService.On("LogoutEverywhere", target).Return(gorm.ErrRecordNotFound).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/revoke/"+target.String(), nil)
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *LoginControllerTestSuite) TestRevokeUser_Forbidden() {
+	header, _ := suite.authHeader(model.RoleOsoba)
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/revoke/"+uuid.NewString(), nil)
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockLoginService.AssertNotCalled(suite.T(), "LogoutEverywhere", mock.Anything)
+}
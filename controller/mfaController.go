@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MfaController struct {
+	mfaService  service.IMfaService
+	userService service.IUserCrudService
+	logger      *zap.SugaredLogger
+}
+
+func NewMfaController() *MfaController {
+	var controller *MfaController
+	app.Invoke(func(mfaService service.IMfaService, userService service.IUserCrudService, logger *zap.SugaredLogger) {
+		controller = &MfaController{
+			mfaService:  mfaService,
+			userService: userService,
+			logger:      logger,
+		}
+	})
+	return controller
+}
+
+func (c *MfaController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/mfa")
+
+	// register Endpoints
+	group.POST("/setup", middleware.Protect(), c.setup)
+	group.POST("/setup/confirm", middleware.Protect(), c.confirm)
+	group.DELETE("/:uuid", middleware.Protect(model.PermMfaReset), c.reset)
+}
+
+// setup godoc
+//
+//	@Summary		Start second factor enrollment
+//	@Description	Returns a new TOTP secret and otpauth URI for the logged in user
+//	@Tags			mfa
+//	@Produce		json
+//	@Success		200	{object}	dto.MfaEnrollmentDto
+//	@Failure		401
+//	@Failure		409
+//	@Failure		500
+//	@Router			/mfa/setup [post]
+func (c *MfaController) setup(ctx *gin.Context) {
+	user, ok := c.loggedInUser(ctx)
+	if !ok {
+		return
+	}
+
+	enrollment, err := c.mfaService.BeginEnrollment(user)
+	if err != nil {
+		if errors.Is(err, cerror.ErrMfaAlreadyEnrolled) {
+			ctx.AbortWithError(http.StatusConflict, err)
+			return
+		}
+
+		c.logger.Errorf("Failed to start enrollment for user = %s, err = %+v", user.Uuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MfaEnrollmentDto{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.Uri,
+	})
+}
+
+// confirm godoc
+//
+//	@Summary		Confirm second factor enrollment
+//	@Description	Confirms the TOTP secret with a code and returns single use recovery codes
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			code	body		dto.MfaCodeDto	true	"TOTP code"
+//	@Success		200		{object}	dto.RecoveryCodesDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		500
+//	@Router			/mfa/setup/confirm [post]
+func (c *MfaController) confirm(ctx *gin.Context) {
+	var codeDto dto.MfaCodeDto
+	if err := ctx.BindJSON(&codeDto); err != nil {
+		c.logger.Errorf("Invalid mfa confirm request err = %+v", err)
+		return
+	}
+
+	user, ok := c.loggedInUser(ctx)
+	if !ok {
+		return
+	}
+
+	codes, err := c.mfaService.ConfirmEnrollment(user.ID, codeDto.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, cerror.ErrInvalidMfaCode):
+			ctx.AbortWithError(http.StatusUnauthorized, err)
+		case errors.Is(err, cerror.ErrMfaNotEnrolled):
+			ctx.AbortWithError(http.StatusBadRequest, err)
+		default:
+			c.logger.Errorf("Failed to confirm enrollment for user = %s, err = %+v", user.Uuid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.RecoveryCodesDto{RecoveryCodes: codes})
+}
+
+// reset godoc
+//
+//	@Summary		Reset second factor
+//	@Description	Removes the second factor of a user who lost the device, the user enrolls again on next login
+//	@Tags			mfa
+//	@Param			uuid	path	string	true	"User UUID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/mfa/{uuid} [delete]
+func (c *MfaController) reset(ctx *gin.Context) {
+	userUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		c.logger.Errorf("Error parsing UUID = %s", ctx.Param("uuid"))
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return
+	}
+
+	if err := c.mfaService.Reset(userUuid); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+
+		c.logger.Errorf("Failed to reset second factor of user = %s, err = %+v", userUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *MfaController) loggedInUser(ctx *gin.Context) (*model.User, bool) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := c.userService.Read(userUuid)
+	if err != nil {
+		c.logger.Errorf("Failed to fetch user with uuid = %s: %v", userUuid, err)
+		ctx.AbortWithError(http.StatusUnauthorized, err)
+		return nil, false
+	}
+
+	return user, true
+}
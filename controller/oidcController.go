@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type OidcController struct {
+	oidcService service.IOidcService
+	logger      *zap.SugaredLogger
+}
+
+func NewOidcController() *OidcController {
+	var controller *OidcController
+	app.Invoke(func(oidcService service.IOidcService, logger *zap.SugaredLogger) {
+		controller = &OidcController{
+			oidcService: oidcService,
+			logger:      logger,
+		}
+	})
+	return controller
+}
+
+func (c *OidcController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/auth/oidc")
+
+	// register Endpoints
+	group.GET("/authorize", c.authorize)
+	group.POST("/callback", c.callback)
+}
+
+// authorize godoc
+//
+//	@Summary		Start sign in through NIAS
+//	@Description	Returns the identity provider url the web app sends the user to, the
+//	@Description	provider redirects back to the configured redirect url with a code and state.
+//	@Description	The binding is kept by the web app and sent with the callback.
+//	@Tags			auth
+//	@Produce		json
+//	@Success		200	{object}	dto.OidcAuthorizeDto
+//	@Failure		404
+//	@Failure		502
+//	@Router			/auth/oidc/authorize [get]
+func (c *OidcController) authorize(ctx *gin.Context) {
+	url, binding, err := c.oidcService.AuthorizationUrl()
+	if err != nil {
+		c.abortOidc(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.OidcAuthorizeDto{Url: url, Binding: binding})
+}
+
+// callback godoc
+//
+//	@Summary		Complete sign in through NIAS
+//	@Description	Exchanges the code for tokens, a citizen signing in for the first time is
+//	@Description	linked to the account with the same OIB or a new account is created. The
+//	@Description	binding returned when the sign in was started has to be sent along.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			callback	body		dto.OidcCallbackDto	true	"Code and state from the redirect and the binding"
+//	@Success		200			{object}	dto.LoginResponseDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		409
+//	@Failure		502
+//	@Router			/auth/oidc/callback [post]
+func (c *OidcController) callback(ctx *gin.Context) {
+	var callbackDto dto.OidcCallbackDto
+	if err := ctx.BindJSON(&callbackDto); err != nil {
+		c.logger.Errorf("Invalid sign in callback err = %+v", err)
+		return
+	}
+
+	result, err := c.oidcService.Callback(callbackDto.Code, callbackDto.State, callbackDto.Binding, ctx.ClientIP())
+	if err != nil {
+		c.abortOidc(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.LoginResponseDto{
+		AccessToken:       result.AccessToken,
+		RefreshToken:      result.RefreshToken,
+		MfaToken:          result.MfaToken,
+		MfaEnrollRequired: result.MfaEnrollRequired,
+	})
+}
+
+func (c *OidcController) abortOidc(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, cerror.ErrOidcDisabled):
+		ctx.JSON(http.StatusNotFound, err.Error())
+	case errors.Is(err, cerror.ErrInvalidOidcState),
+		errors.Is(err, cerror.ErrInvalidIdToken),
+		errors.Is(err, cerror.ErrMissingClaim),
+		errors.Is(err, cerror.ErrBadRole):
+		c.logger.Debugf("Sign in rejected err = %+v", err)
+		ctx.JSON(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, cerror.ErrEmailTaken):
+		ctx.JSON(http.StatusConflict, err.Error())
+	case errors.Is(err, cerror.ErrOidcProvider):
+		c.logger.Errorf("Identity provider failed err = %+v", err)
+		ctx.JSON(http.StatusBadGateway, cerror.ErrOidcProvider.Error())
+	default:
+		c.logger.Errorf("Sign in failed err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,132 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type MockOidcService struct {
+	mock.Mock
+}
+
+func (m *MockOidcService) AuthorizationUrl() (string, string, error) {
+	args := m.Called()
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *MockOidcService) Callback(code, state, binding, ip string) (*service.LoginResult, error) {
+	args := m.Called(code, state, binding, ip)
+	var res *service.LoginResult
+	if v := args.Get(0); v != nil {
+		res = v.(*service.LoginResult)
+	}
+	return res, args.Error(1)
+}
+
+type OidcControllerTestSuite struct {
+	suite.Suite
+	router   *gin.Engine
+	mockOidc *MockOidcService
+}
+
+func (suite *OidcControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+
+	suite.mockOidc = new(MockOidcService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IOidcService { return suite.mockOidc })
+
+	suite.router = gin.New()
+	controller.NewOidcController().RegisterEndpoints(suite.router.Group("/api"))
+}
+
+func (suite *OidcControllerTestSuite) SetupTest() {
+	suite.mockOidc.ExpectedCalls = nil
+	suite.mockOidc.Calls = nil
+}
+
+func TestOidcController(t *testing.T) {
+	suite.Run(t, new(OidcControllerTestSuite))
+}
+
+func (suite *OidcControllerTestSuite) callback(body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, "/api/auth/oidc/callback", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *OidcControllerTestSuite) TestAuthorize() {
+	suite.mockOidc.On("AuthorizationUrl").Return("https://nias.example.com/authorize?state=s", "binding", nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/auth/oidc/authorize", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var body map[string]string
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), "https://nias.example.com/authorize?state=s", body["url"])
+	assert.Equal(suite.T(), "binding", body["binding"])
+}
+
+func (suite *OidcControllerTestSuite) TestAuthorize_Disabled() {
+	suite.mockOidc.On("AuthorizationUrl").Return("", "", cerror.ErrOidcDisabled).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/auth/oidc/authorize", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *OidcControllerTestSuite) TestCallback() {
+	suite.mockOidc.On("Callback", "code", "state", "binding", mock.Anything).
+		Return(&service.LoginResult{AccessToken: "access", RefreshToken: "refresh"}, nil).Once()
+
+	w := suite.callback(`{"code": "code", "state": "state", "binding": "binding"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var body map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), "access", body["accessToken"])
+	assert.Equal(suite.T(), "refresh", body["refreshToken"])
+}
+
+func (suite *OidcControllerTestSuite) TestCallback_Errors() {
+	cases := map[error]int{
+		cerror.ErrInvalidOidcState:                        http.StatusUnauthorized,
+		cerror.ErrBadRole:                                 http.StatusUnauthorized,
+		cerror.ErrEmailTaken:                              http.StatusConflict,
+		fmt.Errorf("%w: timeout", cerror.ErrOidcProvider): http.StatusBadGateway,
+	}
+	for err, status := range cases {
+		suite.mockOidc.On("Callback", "code", "state", "binding", mock.Anything).Return(nil, err).Once()
+
+		w := suite.callback(`{"code": "code", "state": "state", "binding": "binding"}`)
+		assert.Equal(suite.T(), status, w.Code, err.Error())
+	}
+
+	w := suite.callback(`{"code": "code"}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.callback(`{"code": "code", "state": "state"}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
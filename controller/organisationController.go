@@ -0,0 +1,490 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type OrganisationController struct {
+	organisationService service.IOrganisationService
+	accessPolicy        service.IAccessPolicyService
+	logger              *zap.SugaredLogger
+}
+
+func NewOrganisationController() *OrganisationController {
+	var controller *OrganisationController
+	app.Invoke(func(organisationService service.IOrganisationService, accessPolicy service.IAccessPolicyService, logger *zap.SugaredLogger) {
+		controller = &OrganisationController{
+			organisationService: organisationService,
+			accessPolicy:        accessPolicy,
+			logger:              logger,
+		}
+	})
+	return controller
+}
+
+func (c *OrganisationController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/organisation")
+
+	// register Endpoints
+	group.POST("/", middleware.Protect(model.PermOrgCreate), c.create)
+	group.GET("/", middleware.Protect(), c.myOrganisations)
+	group.GET("/invitation", middleware.Protect(), c.myInvitations)
+	group.POST("/invitation/:uuid/accept", middleware.Protect(), c.acceptInvitation)
+	group.DELETE("/invitation/:uuid", middleware.Protect(), c.declineInvitation)
+	group.GET("/:uuid", middleware.Protect(), c.get)
+	group.POST("/:uuid/invitation", middleware.Protect(), c.invite)
+	group.PUT("/:uuid/member/:userUuid", middleware.Protect(), c.changeRole)
+	group.DELETE("/:uuid/member/:userUuid", middleware.Protect(), c.removeMember)
+}
+
+// create godoc
+//
+//	@Summary		Register an organisation
+//	@Description	Registers a company, the logged in user becomes its owner. Administrators with
+//	@Description	organisation:manage-any can name another owner.
+//	@Tags			organisation
+//	@Accept			json
+//	@Produce		json
+//	@Param			model	body		dto.NewOrganisationDto	true	"Organisation"
+//	@Success		201		{object}	dto.OrganisationDetailsDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		422	{object}	dto.ValidationErrorDto
+//	@Failure		500
+//	@Router			/organisation [post]
+func (c *OrganisationController) create(ctx *gin.Context) {
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
+		return
+	}
+
+	var newDto dto.NewOrganisationDto
+	if err := ctx.BindJSON(&newDto); err != nil {
+		c.logger.Errorf("Invalid organisation err = %+v", err)
+		return
+	}
+	organisation, err := newDto.ToModel()
+	if err != nil {
+		abortValidation(ctx, err)
+		return
+	}
+
+	ownerUuid, err := uuid.Parse(claims.Uuid)
+	if err != nil {
+		ctx.AbortWithError(http.StatusUnauthorized, cerror.ErrInvalidTokenFormat)
+		return
+	}
+	if newDto.OwnerUuid != "" {
+		if !claims.HasPermissions(model.PermOrgManageAny) {
+			ctx.AbortWithError(http.StatusForbidden, cerror.ErrForbidden)
+			return
+		}
+		ownerUuid = uuid.MustParse(newDto.OwnerUuid)
+	}
+
+	created, err := c.organisationService.Create(organisation, ownerUuid)
+	if err != nil {
+		c.abortMemberError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.OrganisationDetailsDto{}.FromModel(created))
+}
+
+// myOrganisations godoc
+//
+//	@Summary		My organisations
+//	@Description	Lists the organisations the logged in user is a member of with their role
+//	@Tags			organisation
+//	@Produce		json
+//	@Success		200	{object}	[]dto.MembershipDto
+//	@Failure		401
+//	@Failure		500
+//	@Router			/organisation [get]
+func (c *OrganisationController) myOrganisations(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	members, err := c.organisationService.GetMemberships(userUuid)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rez := make([]dto.MembershipDto, 0, len(members))
+	for _, member := range members {
+		rez = append(rez, dto.MembershipDto{}.FromModel(&member))
+	}
+	ctx.JSON(http.StatusOK, rez)
+}
+
+// get godoc
+//
+//	@Summary		Get an organisation
+//	@Description	Returns an organisation with its members, only members and administrators can see it
+//	@Tags			organisation
+//	@Produce		json
+//	@Param			uuid	path		string	true	"Organisation uuid"
+//	@Success		200		{object}	dto.OrganisationDetailsDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/organisation/{uuid} [get]
+func (c *OrganisationController) get(ctx *gin.Context) {
+	organisation, claims, ok := c.organisation(ctx)
+	if !ok {
+		return
+	}
+	if !c.allowed(ctx, c.accessPolicy.CanViewOrganisation(claims, organisation)) {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.OrganisationDetailsDto{}.FromModel(organisation))
+}
+
+// invite godoc
+//
+//	@Summary		Invite a member
+//	@Description	Mails an invitation to a registered user, they become a member once they accept it.
+//	@Description	Owners invite any role, fleet managers invite drivers. The response is the same
+//	@Description	whether or not the email belongs to a user who can be invited.
+//	@Tags			organisation
+//	@Accept			json
+//	@Param			uuid		path	string					true	"Organisation uuid"
+//	@Param			invitation	body	dto.NewInvitationDto	true	"Email of the user and their role"
+//	@Success		202
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		422	{object}	dto.ValidationErrorDto
+//	@Failure		500
+//	@Router			/organisation/{uuid}/invitation [post]
+func (c *OrganisationController) invite(ctx *gin.Context) {
+	organisation, claims, ok := c.organisation(ctx)
+	if !ok {
+		return
+	}
+
+	var invitationDto dto.NewInvitationDto
+	if err := ctx.BindJSON(&invitationDto); err != nil {
+		c.logger.Errorf("Invalid organisation invitation err = %+v", err)
+		return
+	}
+	role, ok := bindOrganisationRole(ctx, invitationDto.Role)
+	if !ok {
+		return
+	}
+	if !c.allowed(ctx, c.accessPolicy.CanManageMember(claims, organisation, role)) {
+		return
+	}
+
+	inviterUuid, err := uuid.Parse(claims.Uuid)
+	if err != nil {
+		ctx.AbortWithError(http.StatusUnauthorized, cerror.ErrInvalidTokenFormat)
+		return
+	}
+	if err := c.organisationService.Invite(organisation.Uuid, invitationDto.Email, role, inviterUuid); err != nil {
+		c.abortMemberError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+// myInvitations godoc
+//
+//	@Summary		My invitations
+//	@Description	Lists the pending invitations of the logged in user to organisations
+//	@Tags			organisation
+//	@Produce		json
+//	@Success		200	{object}	[]dto.InvitationDto
+//	@Failure		401
+//	@Failure		500
+//	@Router			/organisation/invitation [get]
+func (c *OrganisationController) myInvitations(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	invitations, err := c.organisationService.GetInvitations(userUuid)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	rez := make([]dto.InvitationDto, 0, len(invitations))
+	for _, invitation := range invitations {
+		rez = append(rez, dto.InvitationDto{}.FromModel(&invitation))
+	}
+	ctx.JSON(http.StatusOK, rez)
+}
+
+// acceptInvitation godoc
+//
+//	@Summary		Accept an invitation
+//	@Description	Makes the logged in user a member of the organisation with the role of the invitation
+//	@Tags			organisation
+//	@Produce		json
+//	@Param			uuid	path		string	true	"Invitation uuid"
+//	@Success		201		{object}	dto.MembershipDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/organisation/invitation/{uuid}/accept [post]
+func (c *OrganisationController) acceptInvitation(ctx *gin.Context) {
+	invitationUuid, userUuid, ok := c.invitation(ctx)
+	if !ok {
+		return
+	}
+
+	member, err := c.organisationService.AcceptInvitation(invitationUuid, userUuid)
+	if err != nil {
+		c.abortMemberError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.MembershipDto{}.FromModel(member))
+}
+
+// declineInvitation godoc
+//
+//	@Summary		Decline an invitation
+//	@Description	Deletes an invitation of the logged in user
+//	@Tags			organisation
+//	@Param			uuid	path	string	true	"Invitation uuid"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		500
+//	@Router			/organisation/invitation/{uuid} [delete]
+func (c *OrganisationController) declineInvitation(ctx *gin.Context) {
+	invitationUuid, userUuid, ok := c.invitation(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.organisationService.DeclineInvitation(invitationUuid, userUuid); err != nil {
+		c.abortMemberError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// changeRole godoc
+//
+//	@Summary		Change the role of a member
+//	@Description	Owners change any role, fleet managers only manage drivers. The last owner can't be demoted.
+//	@Tags			organisation
+//	@Accept			json
+//	@Produce		json
+//	@Param			uuid		path		string				true	"Organisation uuid"
+//	@Param			userUuid	path		string				true	"User uuid of the member"
+//	@Param			role		body		dto.MemberRoleDto	true	"New role"
+//	@Success		200			{object}	dto.OrganisationMemberDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		422	{object}	dto.ValidationErrorDto
+//	@Failure		500
+//	@Router			/organisation/{uuid}/member/{userUuid} [put]
+func (c *OrganisationController) changeRole(ctx *gin.Context) {
+	organisation, claims, ok := c.organisation(ctx)
+	if !ok {
+		return
+	}
+	member, ok := c.member(ctx, organisation, claims)
+	if !ok {
+		return
+	}
+
+	var roleDto dto.MemberRoleDto
+	if err := ctx.BindJSON(&roleDto); err != nil {
+		c.logger.Errorf("Invalid organisation role err = %+v", err)
+		return
+	}
+	role, ok := bindOrganisationRole(ctx, roleDto.Role)
+	if !ok {
+		return
+	}
+	if !c.allowed(ctx, c.accessPolicy.CanManageMember(claims, organisation, role)) {
+		return
+	}
+
+	changed, err := c.organisationService.ChangeRole(organisation.Uuid, member.User.Uuid, role)
+	if err != nil {
+		c.abortMemberError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.OrganisationMemberDto{}.FromModel(changed))
+}
+
+// removeMember godoc
+//
+//	@Summary		Remove a member
+//	@Description	Owners remove anyone, fleet managers only remove drivers. The last owner can't be removed.
+//	@Tags			organisation
+//	@Param			uuid		path	string	true	"Organisation uuid"
+//	@Param			userUuid	path	string	true	"User uuid of the member"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/organisation/{uuid}/member/{userUuid} [delete]
+func (c *OrganisationController) removeMember(ctx *gin.Context) {
+	organisation, claims, ok := c.organisation(ctx)
+	if !ok {
+		return
+	}
+	member, ok := c.member(ctx, organisation, claims)
+	if !ok {
+		return
+	}
+
+	if err := c.organisationService.RemoveMember(organisation.Uuid, member.User.Uuid); err != nil {
+		c.abortMemberError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// organisation reads the organisation of the uuid path parameter, it aborts
+// the request on failure
+func (c *OrganisationController) organisation(ctx *gin.Context) (*model.Organisation, *auth.Claims, bool) {
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
+		return nil, nil, false
+	}
+
+	organisationUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return nil, nil, false
+	}
+
+	organisation, err := c.organisationService.Read(organisationUuid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, err)
+			return nil, nil, false
+		}
+		c.logger.Errorf("Failed to read organisation = %s err = %+v", organisationUuid, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+	return organisation, claims, true
+}
+
+// invitation parses the uuid path parameter of an invitation of the logged
+// in user, it aborts the request on failure
+func (c *OrganisationController) invitation(ctx *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	invitationUuid, err := uuid.Parse(ctx.Param("uuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return invitationUuid, userUuid, true
+}
+
+// member reads the member of the userUuid path parameter and checks the
+// logged in user may manage their current role
+func (c *OrganisationController) member(ctx *gin.Context, organisation *model.Organisation, claims *auth.Claims) (*model.OrganisationMember, bool) {
+	userUuid, err := uuid.Parse(ctx.Param("userUuid"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, cerror.ErrBadUuid)
+		return nil, false
+	}
+
+	for _, member := range organisation.Members {
+		if member.User.Uuid != userUuid {
+			continue
+		}
+		if !c.allowed(ctx, c.accessPolicy.CanManageMember(claims, organisation, member.Role)) {
+			return nil, false
+		}
+		return &member, true
+	}
+
+	// NOTE: outsiders learn nothing about who is a member
+	if !c.allowed(ctx, c.accessPolicy.CanViewOrganisation(claims, organisation)) {
+		return nil, false
+	}
+	ctx.AbortWithError(http.StatusNotFound, gorm.ErrRecordNotFound)
+	return nil, false
+}
+
+// allowed aborts the request if an access check failed
+func (c *OrganisationController) allowed(ctx *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	if abortForbidden(ctx, err) {
+		return false
+	}
+	c.logger.Errorf("Failed to check access to organisation err = %+v", err)
+	ctx.AbortWithError(http.StatusInternalServerError, err)
+	return false
+}
+
+func (c *OrganisationController) abortMemberError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.AbortWithError(http.StatusNotFound, err)
+	case errors.Is(err, cerror.ErrBadRole):
+		ctx.JSON(http.StatusBadRequest, err.Error())
+	case errors.Is(err, cerror.ErrOrganisationExists),
+		errors.Is(err, cerror.ErrAlreadyMember),
+		errors.Is(err, cerror.ErrLastOwner):
+		ctx.JSON(http.StatusConflict, err.Error())
+	default:
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// bindOrganisationRole parses a role of a member and responds with 422 if it is unknown
+func bindOrganisationRole(ctx *gin.Context, text string) (model.OrganisationRole, bool) {
+	role, err := model.StoOrganisationRole(text)
+	if err != nil {
+		abortValidation(ctx, &cerror.FieldError{Field: "role", Err: err})
+		return "", false
+	}
+	return role, true
+}
@@ -0,0 +1,260 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockOrganisationService struct {
+	mock.Mock
+}
+
+func (m *MockOrganisationService) Create(organisation *model.Organisation, ownerUuid uuid.UUID) (*model.Organisation, error) {
+	args := m.Called(organisation, ownerUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Organisation), args.Error(1)
+}
+
+func (m *MockOrganisationService) Read(organisationUuid uuid.UUID) (*model.Organisation, error) {
+	args := m.Called(organisationUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Organisation), args.Error(1)
+}
+
+func (m *MockOrganisationService) GetMemberships(userUuid uuid.UUID) ([]model.OrganisationMember, error) {
+	args := m.Called(userUuid)
+	return args.Get(0).([]model.OrganisationMember), args.Error(1)
+}
+
+func (m *MockOrganisationService) GetMember(organisationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error) {
+	args := m.Called(organisationUuid, userUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OrganisationMember), args.Error(1)
+}
+
+func (m *MockOrganisationService) Invite(organisationUuid uuid.UUID, email string, role model.OrganisationRole, inviterUuid uuid.UUID) error {
+	args := m.Called(organisationUuid, email, role, inviterUuid)
+	return args.Error(0)
+}
+
+func (m *MockOrganisationService) GetInvitations(userUuid uuid.UUID) ([]model.OrganisationInvitation, error) {
+	args := m.Called(userUuid)
+	return args.Get(0).([]model.OrganisationInvitation), args.Error(1)
+}
+
+func (m *MockOrganisationService) AcceptInvitation(invitationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error) {
+	args := m.Called(invitationUuid, userUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OrganisationMember), args.Error(1)
+}
+
+func (m *MockOrganisationService) DeclineInvitation(invitationUuid, userUuid uuid.UUID) error {
+	args := m.Called(invitationUuid, userUuid)
+	return args.Error(0)
+}
+
+func (m *MockOrganisationService) ChangeRole(organisationUuid, userUuid uuid.UUID, role model.OrganisationRole) (*model.OrganisationMember, error) {
+	args := m.Called(organisationUuid, userUuid, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OrganisationMember), args.Error(1)
+}
+
+func (m *MockOrganisationService) RemoveMember(organisationUuid, userUuid uuid.UUID) error {
+	args := m.Called(organisationUuid, userUuid)
+	return args.Error(0)
+}
+
+type OrganisationControllerTestSuite struct {
+	suite.Suite
+	router       *gin.Engine
+	mockSvc      *MockOrganisationService
+	mockPolicy   *MockAccessPolicyService
+	company      *model.User
+	companyToken string
+	userToken    string
+	organisation *model.Organisation
+}
+
+func (suite *OrganisationControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "organisation-ctrl-test-access-key",
+		RefreshKey: "organisation-ctrl-test-refresh-key",
+	}
+
+	suite.mockSvc = new(MockOrganisationService)
+	suite.mockPolicy = new(MockAccessPolicyService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IOrganisationService { return suite.mockSvc })
+	app.Provide(func() service.IAccessPolicyService { return suite.mockPolicy })
+
+	suite.router = gin.New()
+	controller.NewOrganisationController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.company = &model.User{Uuid: uuid.New(), Role: model.RoleFirma}
+	token, _, err := auth.GenerateTokens(suite.company)
+	suite.Require().NoError(err)
+	suite.companyToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleOsoba})
+	suite.Require().NoError(err)
+	suite.userToken = "Bearer " + token
+}
+
+func (suite *OrganisationControllerTestSuite) SetupTest() {
+	suite.mockSvc.ExpectedCalls = nil
+	suite.mockSvc.Calls = nil
+	suite.mockPolicy.ExpectedCalls = nil
+	suite.mockPolicy.Calls = nil
+
+	suite.organisation = &model.Organisation{
+		Uuid: uuid.New(),
+		Name: "Prijevoz d.o.o.",
+		OIB:  "69435151530",
+		Members: []model.OrganisationMember{
+			{User: *suite.company, Role: model.OrgRoleOwner},
+			{User: model.User{Uuid: uuid.New(), FirstName: "Ivo", Email: "ivo@example.com", OIB: "94577403194", Role: model.RoleOsoba}, Role: model.OrgRoleDriver},
+		},
+	}
+}
+
+func TestOrganisationController(t *testing.T) {
+	suite.Run(t, new(OrganisationControllerTestSuite))
+}
+
+func (suite *OrganisationControllerTestSuite) request(method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/api/organisation"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *OrganisationControllerTestSuite) TestCreate() {
+	suite.mockSvc.On("Create", mock.AnythingOfType("*model.Organisation"), suite.company.Uuid).Return(suite.organisation, nil).Once()
+
+	w := suite.request(http.MethodPost, "/", suite.companyToken, `{"name":"Prijevoz d.o.o.","oib":"69435151530"}`)
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"role":"owner"`)
+}
+
+func (suite *OrganisationControllerTestSuite) TestCreate_Rejected() {
+	w := suite.request(http.MethodPost, "/", suite.companyToken, `{"name":"Prijevoz d.o.o.","oib":"69435151531"}`)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "invalid_oib")
+
+	w = suite.request(http.MethodPost, "/", suite.companyToken, `{"name":"Prijevoz d.o.o.","oib":"69435151530","ownerUuid":"`+uuid.NewString()+`"}`)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	w = suite.request(http.MethodPost, "/", suite.userToken, `{"name":"Prijevoz d.o.o.","oib":"69435151530"}`)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	suite.mockSvc.On("Create", mock.Anything, suite.company.Uuid).Return(nil, cerror.ErrOrganisationExists).Once()
+	w = suite.request(http.MethodPost, "/", suite.companyToken, `{"name":"Prijevoz d.o.o.","oib":"69435151530"}`)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *OrganisationControllerTestSuite) TestGet_Forbidden() {
+	suite.mockSvc.On("Read", suite.organisation.Uuid).Return(suite.organisation, nil).Once()
+	suite.mockPolicy.On("CanViewOrganisation", mock.Anything, suite.organisation).Return(cerror.ErrForbidden).Once()
+
+	w := suite.request(http.MethodGet, "/"+suite.organisation.Uuid.String(), suite.userToken, "")
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *OrganisationControllerTestSuite) TestGet_MemberData() {
+	suite.mockSvc.On("Read", suite.organisation.Uuid).Return(suite.organisation, nil).Once()
+	suite.mockPolicy.On("CanViewOrganisation", mock.Anything, suite.organisation).Return(nil).Once()
+
+	w := suite.request(http.MethodGet, "/"+suite.organisation.Uuid.String(), suite.companyToken, "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"firstName":"Ivo"`)
+	assert.NotContains(suite.T(), w.Body.String(), "ivo@example.com")
+	assert.NotContains(suite.T(), w.Body.String(), "94577403194")
+}
+
+func (suite *OrganisationControllerTestSuite) TestInvite() {
+	suite.mockSvc.On("Read", suite.organisation.Uuid).Return(suite.organisation, nil)
+	suite.mockPolicy.On("CanManageMember", mock.Anything, suite.organisation, model.OrgRoleDriver).Return(nil).Once()
+	suite.mockSvc.On("Invite", suite.organisation.Uuid, "vozac@example.com", model.OrgRoleDriver, suite.company.Uuid).Return(nil).Once()
+
+	w := suite.request(http.MethodPost, "/"+suite.organisation.Uuid.String()+"/invitation", suite.companyToken, `{"email":"vozac@example.com","role":"driver"}`)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	assert.Empty(suite.T(), w.Body.String())
+
+	w = suite.request(http.MethodPost, "/"+suite.organisation.Uuid.String()+"/invitation", suite.companyToken, `{"email":"vozac@example.com","role":"boss"}`)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "unknown_role")
+}
+
+func (suite *OrganisationControllerTestSuite) TestInvitations() {
+	userUuid := suite.organisation.Members[1].User.Uuid
+	token, _, err := auth.GenerateTokens(&suite.organisation.Members[1].User)
+	suite.Require().NoError(err)
+	token = "Bearer " + token
+
+	invitation := model.OrganisationInvitation{Uuid: uuid.New(), Organisation: suite.organisation, Role: model.OrgRoleDriver}
+	suite.mockSvc.On("GetInvitations", userUuid).Return([]model.OrganisationInvitation{invitation}, nil).Once()
+	w := suite.request(http.MethodGet, "/invitation", token, "")
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), invitation.Uuid.String())
+
+	member := &model.OrganisationMember{Organisation: suite.organisation, Role: model.OrgRoleDriver}
+	suite.mockSvc.On("AcceptInvitation", invitation.Uuid, userUuid).Return(member, nil).Once()
+	w = suite.request(http.MethodPost, "/invitation/"+invitation.Uuid.String()+"/accept", token, "")
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), suite.organisation.Uuid.String())
+
+	suite.mockSvc.On("DeclineInvitation", invitation.Uuid, userUuid).Return(gorm.ErrRecordNotFound).Once()
+	w = suite.request(http.MethodDelete, "/invitation/"+invitation.Uuid.String(), token, "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	suite.mockSvc.AssertExpectations(suite.T())
+}
+
+func (suite *OrganisationControllerTestSuite) TestRemoveMember() {
+	owner := suite.organisation.Members[0]
+	suite.mockSvc.On("Read", suite.organisation.Uuid).Return(suite.organisation, nil)
+	suite.mockPolicy.On("CanManageMember", mock.Anything, suite.organisation, model.OrgRoleOwner).Return(nil)
+	suite.mockSvc.On("RemoveMember", suite.organisation.Uuid, owner.User.Uuid).Return(cerror.ErrLastOwner).Once()
+
+	w := suite.request(http.MethodDelete, "/"+suite.organisation.Uuid.String()+"/member/"+owner.User.Uuid.String(), suite.companyToken, "")
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	suite.mockPolicy.On("CanViewOrganisation", mock.Anything, suite.organisation).Return(nil).Once()
+	w = suite.request(http.MethodDelete, "/"+suite.organisation.Uuid.String()+"/member/"+uuid.NewString(), suite.companyToken, "")
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
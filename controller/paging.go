@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response headers of list endpoints, the Link header links to other pages
+const (
+	totalCountHeader = "X-Total-Count"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// bindPaging parses the list query of the request and aborts with 400 if it
+// is invalid
+func bindPaging(ctx *gin.Context, spec paging.Spec) (*paging.Params, bool) {
+	params, err := paging.Parse(ctx.Request.URL.Query(), spec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return params, true
+}
+
+// abortInvalidQuery aborts with 400 if a list query was rejected by the service
+func abortInvalidQuery(ctx *gin.Context, err error) bool {
+	if !errors.Is(err, cerror.ErrInvalidQuery) {
+		return false
+	}
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, err.Error())
+	return true
+}
+
+// setPageHeaders sets the pagination headers of a list response
+func setPageHeaders(ctx *gin.Context, page *paging.Page) {
+	if page == nil {
+		return
+	}
+	ctx.Header(totalCountHeader, strconv.FormatInt(page.Total, 10))
+	ctx.Header("Link", page.Link(ctx.Request.URL))
+	if page.NextCursor != "" {
+		ctx.Header(nextCursorHeader, page.NextCursor)
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"ePrometna_Server/dto"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/i18n"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// abortPasswordPolicy responds with localized violations if err is a password policy error
+func abortPasswordPolicy(ctx *gin.Context, err error) bool {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	lang := i18n.Language(ctx.GetHeader("Accept-Language"))
+	violations := make([]dto.ViolationDto, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		violations = append(violations, dto.ViolationDto{
+			Code:    v.Code,
+			Message: v.Message(lang),
+		})
+	}
+
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.ValidationErrorDto{
+		Error:      i18n.T(lang, "password.policy_failed"),
+		Violations: violations,
+	})
+	return true
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type PasswordResetController struct {
+	resetService service.IPasswordResetService
+	logger       *zap.SugaredLogger
+}
+
+func NewPasswordResetController() *PasswordResetController {
+	var controller *PasswordResetController
+	app.Invoke(func(resetService service.IPasswordResetService, logger *zap.SugaredLogger) {
+		controller = &PasswordResetController{
+			resetService: resetService,
+			logger:       logger,
+		}
+	})
+	return controller
+}
+
+func (c *PasswordResetController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/auth/password-reset")
+
+	// register Endpoints
+	group.POST("/request", c.request)
+	group.POST("/confirm", c.confirm)
+}
+
+// request godoc
+//
+//	@Summary		Request password reset
+//	@Description	Mails a single use reset code, the response is the same for unknown emails
+//	@Tags			auth
+//	@Accept			json
+//	@Param			request	body	dto.PasswordResetRequestDto	true	"Account email"
+//	@Success		202
+//	@Failure		400
+//	@Failure		429
+//	@Router			/auth/password-reset/request [post]
+func (c *PasswordResetController) request(ctx *gin.Context) {
+	var requestDto dto.PasswordResetRequestDto
+	if err := ctx.BindJSON(&requestDto); err != nil {
+		c.logger.Errorf("Invalid password reset request err = %+v", err)
+		return
+	}
+
+	if err := c.resetService.RequestReset(requestDto.Email, ctx.ClientIP()); err != nil {
+		if abortThrottled(ctx, c.logger, err) {
+			return
+		}
+		// The response stays the same so failures don't tell if the email is known
+		c.logger.Errorf("Failed to request password reset err = %+v", err)
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+// confirm godoc
+//
+//	@Summary		Confirm password reset
+//	@Description	Sets a new password with a reset code, every session of the user is logged out
+//	@Tags			auth
+//	@Accept			json
+//	@Param			confirm	body	dto.PasswordResetConfirmDto	true	"Reset code and new password"
+//	@Success		204
+//	@Failure		400
+//	@Failure		500
+//	@Router			/auth/password-reset/confirm [post]
+func (c *PasswordResetController) confirm(ctx *gin.Context) {
+	var confirmDto dto.PasswordResetConfirmDto
+	if err := ctx.BindJSON(&confirmDto); err != nil {
+		c.logger.Errorf("Invalid password reset confirm err = %+v", err)
+		return
+	}
+
+	if err := c.resetService.ConfirmReset(confirmDto.Token, confirmDto.Password); err != nil {
+		if abortPasswordPolicy(ctx, err) {
+			return
+		}
+		if errors.Is(err, cerror.ErrInvalidResetToken) {
+			c.logger.Debugf("Password reset rejected err = %+v", err)
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.logger.Errorf("Failed to reset password err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,131 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type MockPasswordResetService struct {
+	mock.Mock
+}
+
+func (m *MockPasswordResetService) RequestReset(email, ip string) error {
+	args := m.Called(email, ip)
+	return args.Error(0)
+}
+
+func (m *MockPasswordResetService) ConfirmReset(token, password string) error {
+	args := m.Called(token, password)
+	return args.Error(0)
+}
+
+type PasswordResetControllerTestSuite struct {
+	suite.Suite
+	router    *gin.Engine
+	mockReset *MockPasswordResetService
+}
+
+func (suite *PasswordResetControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+
+	suite.mockReset = new(MockPasswordResetService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IPasswordResetService { return suite.mockReset })
+
+	suite.router = gin.New()
+	controller.NewPasswordResetController().RegisterEndpoints(suite.router.Group("/api"))
+}
+
+func (suite *PasswordResetControllerTestSuite) SetupTest() {
+	suite.mockReset.ExpectedCalls = nil
+	suite.mockReset.Calls = nil
+}
+
+func TestPasswordResetController(t *testing.T) {
+	suite.Run(t, new(PasswordResetControllerTestSuite))
+}
+
+func (suite *PasswordResetControllerTestSuite) post(path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *PasswordResetControllerTestSuite) TestRequest() {
+	suite.mockReset.On("RequestReset", "user@example.com", mock.Anything).Return(nil).Once()
+
+	w := suite.post("/api/auth/password-reset/request", `{"email": "user@example.com"}`)
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	suite.mockReset.AssertExpectations(suite.T())
+}
+
+func (suite *PasswordResetControllerTestSuite) TestRequest_BadEmail() {
+	w := suite.post("/api/auth/password-reset/request", `{"email": "not-an-email"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockReset.AssertNotCalled(suite.T(), "RequestReset", mock.Anything, mock.Anything)
+}
+
+func (suite *PasswordResetControllerTestSuite) TestRequest_ServiceError() {
+	suite.mockReset.On("RequestReset", "user@example.com", mock.Anything).Return(errors.New("outbox down")).Once()
+
+	w := suite.post("/api/auth/password-reset/request", `{"email": "user@example.com"}`)
+
+	// Failures look like a sent mail
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+}
+
+func (suite *PasswordResetControllerTestSuite) TestRequest_Throttled() {
+	suite.mockReset.On("RequestReset", "user@example.com", mock.Anything).
+		Return(&service.ThrottledError{RetryAfter: time.Minute}).Once()
+
+	w := suite.post("/api/auth/password-reset/request", `{"email": "user@example.com"}`)
+
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Equal(suite.T(), "60", w.Header().Get("Retry-After"))
+}
+
+func (suite *PasswordResetControllerTestSuite) TestConfirm() {
+	suite.mockReset.On("ConfirmReset", "token", "newpassword").Return(nil).Once()
+
+	w := suite.post("/api/auth/password-reset/confirm", `{"token": "token", "password": "newpassword"}`)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockReset.AssertExpectations(suite.T())
+}
+
+func (suite *PasswordResetControllerTestSuite) TestConfirm_InvalidToken() {
+	suite.mockReset.On("ConfirmReset", "used", "newpassword").Return(cerror.ErrInvalidResetToken).Once()
+
+	w := suite.post("/api/auth/password-reset/confirm", `{"token": "used", "password": "newpassword"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), cerror.ErrInvalidResetToken.Error())
+}
+
+func (suite *PasswordResetControllerTestSuite) TestConfirm_ShortPassword() {
+	w := suite.post("/api/auth/password-reset/confirm", `{"token": "token", "password": "123"}`)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockReset.AssertNotCalled(suite.T(), "ConfirmReset", mock.Anything, mock.Anything)
+}
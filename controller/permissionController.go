@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type PermissionController struct {
+	permissionService service.IPermissionService
+	logger            *zap.SugaredLogger
+}
+
+func NewPermissionController() *PermissionController {
+	var controller *PermissionController
+	app.Invoke(func(permissionService service.IPermissionService, logger *zap.SugaredLogger) {
+		controller = &PermissionController{
+			permissionService: permissionService,
+			logger:            logger,
+		}
+	})
+	return controller
+}
+
+func (c *PermissionController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/permissions")
+	group.Use(middleware.Protect(model.PermPermissionManage))
+
+	// register Endpoints
+	group.GET("/", c.getAll)
+	group.GET("/roles", c.getRoles)
+	group.PUT("/roles/:role/:permission", c.grant)
+	group.DELETE("/roles/:role/:permission", c.revoke)
+}
+
+// getAll godoc
+//
+//	@Summary		Permissions
+//	@Description	Returns every permission that can be assigned to roles
+//	@Tags			permissions
+//	@Produce		json
+//	@Success		200	{array}	dto.PermissionDto
+//	@Failure		401
+//	@Failure		403
+//	@Router			/permissions [get]
+func (c *PermissionController) getAll(ctx *gin.Context) {
+	dtos := make([]dto.PermissionDto, 0, len(model.Permissions))
+	for permission, description := range model.Permissions {
+		dtos = append(dtos, dto.PermissionDto{Name: string(permission), Description: description})
+	}
+	slices.SortFunc(dtos, func(a, b dto.PermissionDto) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// getRoles godoc
+//
+//	@Summary		Role permissions
+//	@Description	Returns the permissions assigned to every role
+//	@Tags			permissions
+//	@Produce		json
+//	@Success		200	{array}	dto.RolePermissionsDto
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/permissions/roles [get]
+func (c *PermissionController) getRoles(ctx *gin.Context) {
+	permissions, err := c.permissionService.GetAll()
+	if err != nil {
+		c.logger.Errorf("Failed to fetch role permissions err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos := make([]dto.RolePermissionsDto, 0, len(model.Roles))
+	for _, role := range model.Roles {
+		dtos = append(dtos, dto.RolePermissionsDto{}.FromModel(role, permissions[role]))
+	}
+
+	ctx.JSON(http.StatusOK, dtos)
+}
+
+// grant godoc
+//
+//	@Summary		Grant permission
+//	@Description	Assigns a permission to a role, it applies to tokens already issued
+//	@Tags			permissions
+//	@Param			role		path	string	true	"Role"
+//	@Param			permission	path	string	true	"Permission"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/permissions/roles/{role}/{permission} [put]
+func (c *PermissionController) grant(ctx *gin.Context) {
+	role, permission, ok := c.parsePath(ctx)
+	if !ok {
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.permissionService.Grant(role, permission, adminUuid); err != nil {
+		c.logger.Errorf("Failed to grant %s to %s err = %+v", permission, role, err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// revoke godoc
+//
+//	@Summary		Revoke permission
+//	@Description	Removes a permission from a role, it applies to tokens already issued
+//	@Tags			permissions
+//	@Param			role		path	string	true	"Role"
+//	@Param			permission	path	string	true	"Permission"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Router			/permissions/roles/{role}/{permission} [delete]
+func (c *PermissionController) revoke(ctx *gin.Context) {
+	role, permission, ok := c.parsePath(ctx)
+	if !ok {
+		return
+	}
+
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.permissionService.Revoke(role, permission, adminUuid); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrProtectedPermission):
+			ctx.AbortWithError(http.StatusConflict, err)
+		default:
+			c.logger.Errorf("Failed to revoke %s from %s err = %+v", permission, role, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *PermissionController) parsePath(ctx *gin.Context) (model.UserRole, model.Permission, bool) {
+	role, err := model.StoUserRole(ctx.Param("role"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return "", "", false
+	}
+
+	permission, err := model.StoPermission(ctx.Param("permission"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return "", "", false
+	}
+
+	return role, permission, true
+}
@@ -0,0 +1,173 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MockPermissionService struct {
+	mock.Mock
+}
+
+func (m *MockPermissionService) Load() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MockPermissionService) GetAll() (map[model.UserRole][]model.Permission, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[model.UserRole][]model.Permission), args.Error(1)
+}
+
+func (m *MockPermissionService) Grant(role model.UserRole, permission model.Permission, adminUuid uuid.UUID) error {
+	args := m.Called(role, permission, adminUuid)
+	return args.Error(0)
+}
+
+func (m *MockPermissionService) Revoke(role model.UserRole, permission model.Permission, adminUuid uuid.UUID) error {
+	args := m.Called(role, permission, adminUuid)
+	return args.Error(0)
+}
+
+type PermissionControllerTestSuite struct {
+	suite.Suite
+	router         *gin.Engine
+	mockPermission *MockPermissionService
+	adminUuid      uuid.UUID
+	adminToken     string
+}
+
+func (suite *PermissionControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "permission-ctrl-test-access-key",
+		RefreshKey: "permission-ctrl-test-refresh-key",
+	}
+
+	suite.mockPermission = new(MockPermissionService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IPermissionService { return suite.mockPermission })
+
+	suite.router = gin.New()
+	controller.NewPermissionController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.adminUuid = uuid.New()
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: suite.adminUuid, Role: model.RoleSuperAdmin})
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+}
+
+func (suite *PermissionControllerTestSuite) SetupTest() {
+	suite.mockPermission.ExpectedCalls = nil
+	suite.mockPermission.Calls = nil
+}
+
+func TestPermissionController(t *testing.T) {
+	suite.Run(t, new(PermissionControllerTestSuite))
+}
+
+func (suite *PermissionControllerTestSuite) request(method, path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *PermissionControllerTestSuite) TestGetAll() {
+	w := suite.request(http.MethodGet, "/api/permissions/", suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var permissions []map[string]string
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &permissions))
+	assert.Len(suite.T(), permissions, len(model.Permissions))
+}
+
+func (suite *PermissionControllerTestSuite) TestGetRoles() {
+	suite.mockPermission.On("GetAll").Return(map[model.UserRole][]model.Permission{
+		model.RoleHAK: {model.PermVehicleManage, model.PermVehicleRegister},
+	}, nil).Once()
+
+	w := suite.request(http.MethodGet, "/api/permissions/roles", suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var roles []struct {
+		Role        string   `json:"role"`
+		Permissions []string `json:"permissions"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &roles))
+	suite.Require().Len(roles, len(model.Roles))
+	assert.Equal(suite.T(), string(model.RoleHAK), roles[0].Role)
+	assert.Equal(suite.T(), []string{"vehicle:manage", "vehicle:register"}, roles[0].Permissions)
+	assert.Empty(suite.T(), roles[1].Permissions)
+}
+
+func (suite *PermissionControllerTestSuite) TestGrant() {
+	suite.mockPermission.On("Grant", model.RoleHAK, model.PermUserRead, suite.adminUuid).Return(nil).Once()
+
+	w := suite.request(http.MethodPut, "/api/permissions/roles/hak/user:read", suite.adminToken)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockPermission.AssertExpectations(suite.T())
+}
+
+func (suite *PermissionControllerTestSuite) TestGrant_Unknown() {
+	w := suite.request(http.MethodPut, "/api/permissions/roles/hak/user:fly", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.request(http.MethodPut, "/api/permissions/roles/pilot/user:read", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	suite.mockPermission.AssertNotCalled(suite.T(), "Grant", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *PermissionControllerTestSuite) TestRevoke() {
+	suite.mockPermission.On("Revoke", model.RoleHAK, model.PermUserReadOib, suite.adminUuid).Return(nil).Once()
+	suite.mockPermission.On("Revoke", model.RoleOsoba, model.PermUserReadOib, suite.adminUuid).Return(gorm.ErrRecordNotFound).Once()
+	suite.mockPermission.On("Revoke", model.RoleSuperAdmin, model.PermPermissionManage, suite.adminUuid).Return(cerror.ErrProtectedPermission).Once()
+
+	w := suite.request(http.MethodDelete, "/api/permissions/roles/hak/user:read-oib", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/permissions/roles/osoba/user:read-oib", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+
+	w = suite.request(http.MethodDelete, "/api/permissions/roles/superadmin/permission:manage", suite.adminToken)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	suite.mockPermission.AssertExpectations(suite.T())
+}
+
+func (suite *PermissionControllerTestSuite) TestForbidden() {
+	token, _, err := auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleMupADMIN})
+	suite.Require().NoError(err)
+
+	w := suite.request(http.MethodPut, "/api/permissions/roles/mupadmin/permission:manage", "Bearer "+token)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.mockPermission.AssertNotCalled(suite.T(), "Grant", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/middleware"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ProfileController struct {
+	profileService service.IProfileService
+	logger         *zap.SugaredLogger
+}
+
+func NewProfileController() *ProfileController {
+	var controller *ProfileController
+	app.Invoke(func(profileService service.IProfileService, logger *zap.SugaredLogger) {
+		controller = &ProfileController{
+			profileService: profileService,
+			logger:         logger,
+		}
+	})
+	return controller
+}
+
+func (c *ProfileController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/user")
+
+	// register Endpoints
+	group.PUT("/my-data", middleware.Protect(), c.updateMyData)
+	group.POST("/email/confirm", c.confirmEmail)
+}
+
+// updateMyData godoc
+//
+//	@Summary		Update my data
+//	@Description	Changes the residence and email of the logged in user. A new email needs the
+//	@Description	current password, it is mailed a confirmation code and returned as pendingEmail
+//	@Description	until it is confirmed.
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			model	body		dto.MyDataUpdateDto	true	"New residence and email"
+//	@Success		200		{object}	dto.MyDataDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		422	{object}	dto.ValidationErrorDto
+//	@Failure		429
+//	@Failure		500
+//	@Router			/user/my-data [put]
+func (c *ProfileController) updateMyData(ctx *gin.Context) {
+	userUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+
+	var updateDto dto.MyDataUpdateDto
+	if err := ctx.BindJSON(&updateDto); err != nil {
+		c.logger.Errorf("Invalid my data update err = %+v", err)
+		return
+	}
+	residence, err := updateDto.ToModel()
+	if err != nil {
+		abortValidation(ctx, err)
+		return
+	}
+
+	user, pendingEmail, err := c.profileService.UpdateMyData(userUuid, residence, updateDto.Email, updateDto.CurrentPassword)
+	if err != nil {
+		switch {
+		case abortThrottled(ctx, c.logger, err):
+		case errors.Is(err, cerror.ErrWrongPassword):
+			ctx.JSON(http.StatusForbidden, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.AbortWithError(http.StatusNotFound, err)
+		case errors.Is(err, cerror.ErrEmailTaken):
+			ctx.JSON(http.StatusConflict, err.Error())
+		default:
+			c.logger.Errorf("Failed to update data of user %s err = %+v", userUuid, err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.MyDataDto{}.FromModel(user, pendingEmail))
+}
+
+// confirmEmail godoc
+//
+//	@Summary		Confirm email
+//	@Description	Sets the email a confirmation code was mailed to, the old address is notified
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			confirm	body		dto.EmailConfirmDto	true	"Confirmation code"
+//	@Success		200		{object}	dto.UserDto
+//	@Failure		400
+//	@Failure		409
+//	@Failure		500
+//	@Router			/user/email/confirm [post]
+func (c *ProfileController) confirmEmail(ctx *gin.Context) {
+	var confirmDto dto.EmailConfirmDto
+	if err := ctx.BindJSON(&confirmDto); err != nil {
+		c.logger.Errorf("Invalid email confirm err = %+v", err)
+		return
+	}
+
+	user, err := c.profileService.ConfirmEmail(confirmDto.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, cerror.ErrInvalidEmailToken):
+			ctx.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, cerror.ErrEmailTaken):
+			ctx.JSON(http.StatusConflict, err.Error())
+		default:
+			c.logger.Errorf("Failed to confirm email err = %+v", err)
+			ctx.AbortWithError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.UserDto{}.FromModel(user))
+}
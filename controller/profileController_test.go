@@ -0,0 +1,154 @@
+package controller_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type MockProfileService struct {
+	mock.Mock
+}
+
+func (m *MockProfileService) UpdateMyData(userUuid uuid.UUID, residence model.Address, email, currentPassword string) (*model.User, string, error) {
+	args := m.Called(userUuid, residence, email, currentPassword)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(*model.User), args.String(1), args.Error(2)
+}
+
+func (m *MockProfileService) ConfirmEmail(token string) (*model.User, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+type ProfileControllerTestSuite struct {
+	suite.Suite
+	router    *gin.Engine
+	mockSvc   *MockProfileService
+	user      *model.User
+	userToken string
+}
+
+func (suite *ProfileControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "profile-ctrl-test-access-key",
+		RefreshKey: "profile-ctrl-test-refresh-key",
+	}
+
+	suite.mockSvc = new(MockProfileService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IProfileService { return suite.mockSvc })
+
+	suite.router = gin.New()
+	controller.NewProfileController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.user = &model.User{Uuid: uuid.New(), Email: "citizen@test.hr", Role: model.RoleOsoba}
+	token, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+	suite.userToken = "Bearer " + token
+}
+
+func (suite *ProfileControllerTestSuite) SetupTest() {
+	suite.mockSvc.ExpectedCalls = nil
+	suite.mockSvc.Calls = nil
+}
+
+func TestProfileController(t *testing.T) {
+	suite.Run(t, new(ProfileControllerTestSuite))
+}
+
+func (suite *ProfileControllerTestSuite) request(method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+const splitResidence = `{"street": "Riva", "houseNumber": "10", "postalCode": "21000", "settlement": "Split"}`
+
+var splitAddress = model.Address{Street: "Riva", HouseNumber: "10", PostalCode: "21000", Settlement: "Split"}
+
+func (suite *ProfileControllerTestSuite) TestUpdateMyData() {
+	suite.mockSvc.On("UpdateMyData", suite.user.Uuid, splitAddress, "new@test.hr", "password123").
+		Return(&model.User{Uuid: suite.user.Uuid, Email: "citizen@test.hr", Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, Role: model.RoleOsoba}, "new@test.hr", nil).Once()
+
+	// fields users can't change are ignored
+	w := suite.request(http.MethodPut, "/api/user/my-data", suite.userToken,
+		`{"residence": `+splitResidence+`, "email": "new@test.hr", "currentPassword": "password123", "role": "superadmin", "oib": "69435151530"}`)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var body map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), "citizen@test.hr", body["email"])
+	assert.Equal(suite.T(), "new@test.hr", body["pendingEmail"])
+	assert.Equal(suite.T(), string(model.RoleOsoba), body["role"])
+}
+
+func (suite *ProfileControllerTestSuite) TestUpdateMyData_Errors() {
+	w := suite.request(http.MethodPut, "/api/user/my-data", suite.userToken, `{"residence": `+splitResidence+`, "email": "not-an-email"}`)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+
+	w = suite.request(http.MethodPut, "/api/user/my-data", suite.userToken,
+		`{"residence": {"street": "Riva", "houseNumber": "10", "postalCode": "2100X", "settlement": "Split"}, "email": "new@test.hr"}`)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"field":"residence.postalCode"`)
+
+	w = suite.request(http.MethodPut, "/api/user/my-data", "", `{"residence": `+splitResidence+`, "email": "new@test.hr"}`)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+
+	suite.mockSvc.On("UpdateMyData", suite.user.Uuid, splitAddress, "taken@test.hr", "").Return(nil, "", cerror.ErrEmailTaken).Once()
+	w = suite.request(http.MethodPut, "/api/user/my-data", suite.userToken, `{"residence": `+splitResidence+`, "email": "taken@test.hr"}`)
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+
+	suite.mockSvc.On("UpdateMyData", suite.user.Uuid, splitAddress, "new@test.hr", "wrong").Return(nil, "", cerror.ErrWrongPassword).Once()
+	w = suite.request(http.MethodPut, "/api/user/my-data", suite.userToken,
+		`{"residence": `+splitResidence+`, "email": "new@test.hr", "currentPassword": "wrong"}`)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	suite.mockSvc.On("UpdateMyData", suite.user.Uuid, splitAddress, "new@test.hr", "password123").
+		Return(nil, "", &service.ThrottledError{RetryAfter: time.Minute}).Once()
+	w = suite.request(http.MethodPut, "/api/user/my-data", suite.userToken,
+		`{"residence": `+splitResidence+`, "email": "new@test.hr", "currentPassword": "password123"}`)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+}
+
+func (suite *ProfileControllerTestSuite) TestConfirmEmail() {
+	suite.mockSvc.On("ConfirmEmail", "good").Return(&model.User{Uuid: suite.user.Uuid, Email: "new@test.hr"}, nil).Once()
+	suite.mockSvc.On("ConfirmEmail", "bad").Return(nil, cerror.ErrInvalidEmailToken).Once()
+
+	w := suite.request(http.MethodPost, "/api/user/email/confirm", "", `{"token": "good"}`)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "new@test.hr")
+
+	w = suite.request(http.MethodPost, "/api/user/email/confirm", "", `{"token": "bad"}`)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
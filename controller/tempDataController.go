@@ -5,7 +5,6 @@ import (
 	"ePrometna_Server/dto"
 	"ePrometna_Server/model"
 	"ePrometna_Server/service"
-	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/middleware"
 	"errors"
@@ -22,16 +21,18 @@ type TempDataController struct {
 	TempDataService service.ITempDataService
 	VehicleService  service.IVehicleService
 	UserService     service.IUserCrudService
+	AccessPolicy    service.IAccessPolicyService
 	logger          *zap.SugaredLogger
 }
 
 func NewTempDataController() *TempDataController {
 	var controller *TempDataController
-	app.Invoke(func(tempDataService service.ITempDataService, vehicleService service.IVehicleService, userService service.IUserCrudService, logger *zap.SugaredLogger) {
+	app.Invoke(func(tempDataService service.ITempDataService, vehicleService service.IVehicleService, userService service.IUserCrudService, accessPolicy service.IAccessPolicyService, logger *zap.SugaredLogger) {
 		controller = &TempDataController{
 			TempDataService: tempDataService,
 			VehicleService:  vehicleService,
 			UserService:     userService,
+			AccessPolicy:    accessPolicy,
 			logger:          logger,
 		}
 	})
@@ -42,8 +43,8 @@ func (c *TempDataController) RegisterEndpoints(api *gin.RouterGroup) {
 	// create a group with the name of the router
 	group := api.Group("/tempdata")
 	// register Endpoints
-	group.POST("/:uuid", middleware.Protect(model.RoleFirma, model.RoleOsoba), c.createTempData)
-	group.PUT("/:uuid", middleware.Protect(model.RolePolicija), c.getAndDeleteTempData)
+	group.POST("/:uuid", middleware.ProtectDevice(model.PermTempDataCreate), c.createTempData)
+	group.PUT("/:uuid", middleware.ProtectDevice(model.PermTempDataConsume), middleware.RequireDeviceSignature(), c.getAndDeleteTempData)
 }
 
 // createTempData godoc
@@ -56,6 +57,8 @@ func (c *TempDataController) RegisterEndpoints(api *gin.RouterGroup) {
 //	@Produce		json
 //	@Success		201	{object}	string
 //	@Failure		400
+//	@Failure		403
+//	@Failure		404
 //	@Failure		500
 //	@Router			/tempdata/{uuid} [post]
 func (c *TempDataController) createTempData(ctx *gin.Context) {
@@ -73,11 +76,8 @@ func (c *TempDataController) createTempData(ctx *gin.Context) {
 		return
 	}
 
-	// Parse JWT and get driver UUID
-	_, claims, err := auth.ParseToken(ctx.Request.Header.Get("Authorization"))
-	if err != nil {
-		c.logger.Errorf("Failed to parse token: %v", err)
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token")
+	claims, ok := loggedInClaims(ctx)
+	if !ok {
 		return
 	}
 
@@ -100,6 +100,17 @@ func (c *TempDataController) createTempData(ctx *gin.Context) {
 		return
 	}
 
+	// Only the owner and drivers of the vehicle can show it to the police
+	if err := c.AccessPolicy.CanDriveVehicle(claims, vehicle); err != nil {
+		if errors.Is(err, cerror.ErrForbidden) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, "Not allowed to drive the vehicle")
+			return
+		}
+		c.logger.Errorf("Failed to check driver rights: %+v", err)
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, "Failed to check driver rights")
+		return
+	}
+
 	driver, err := c.UserService.Read(driverUUID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
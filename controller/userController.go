@@ -6,9 +6,11 @@ import (
 	"ePrometna_Server/model"
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
 	"ePrometna_Server/util/middleware"
+	"ePrometna_Server/util/validate"
 	"errors"
-	"math/rand"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -18,19 +20,21 @@ import (
 )
 
 type UserController struct {
-	UserCrud service.IUserCrudService
-	logger   *zap.SugaredLogger
+	UserCrud    service.IUserCrudService
+	PoliceCodes service.IPoliceCodeService
+	logger      *zap.SugaredLogger
 }
 
 func NewUserController() *UserController {
 	var controller *UserController
 
 	// Call dependency injection
-	app.Invoke(func(UserService service.IUserCrudService, logger *zap.SugaredLogger) {
+	app.Invoke(func(UserService service.IUserCrudService, PoliceCodes service.IPoliceCodeService, logger *zap.SugaredLogger) {
 		// create controller
 		controller = &UserController{
-			UserCrud: UserService,
-			logger:   logger,
+			UserCrud:    UserService,
+			PoliceCodes: PoliceCodes,
+			logger:      logger,
 		}
 	})
 
@@ -48,22 +52,24 @@ func (u *UserController) RegisterEndpoints(api *gin.RouterGroup) {
 	group.GET("/my-device", middleware.Protect(), u.getLoggedInUserDevice)
 	group.DELETE("/my-device", middleware.Protect(), u.deleteLoggedInUserDevice)
 
-	group.GET("/police-officers", middleware.Protect(model.RoleMupADMIN), u.getAllPoliceOfficers)
-	group.GET("/oib/:oib", middleware.Protect(model.RoleHAK), u.getUserByOib)
+	group.GET("/police-officers", middleware.Protect(model.PermPoliceList), u.getAllPoliceOfficers)
+	// NOTE: the HAK web app has no device key, officers look up from their
+	// phone and must sign the request
+	group.GET("/oib/:oib", middleware.Protect(model.PermUserReadOib), middleware.RequireDeviceSignature(model.RolePolicija), u.getUserByOib)
 
 	// Police token endpoints
-	group.POST("/:uuid/generate-token", middleware.Protect(model.RoleSuperAdmin, model.RoleMupADMIN), u.generatePoliceToken)
-	group.PATCH("/:uuid/police-token", middleware.Protect(model.RoleSuperAdmin, model.RoleMupADMIN), u.setPoliceToken)
+	group.POST("/:uuid/generate-token", middleware.Protect(model.PermPoliceTokenIssue), u.generatePoliceToken)
+	group.PATCH("/:uuid/police-token", middleware.Protect(model.PermPoliceTokenIssue), u.setPoliceToken)
+	group.DELETE("/:uuid/police-token", middleware.Protect(model.PermPoliceTokenIssue), u.revokePoliceToken)
 
-	group.GET("/:uuid", middleware.Protect(model.RolePolicija, model.RoleSuperAdmin, model.RoleMupADMIN), u.get)
+	group.GET("/:uuid", middleware.Protect(model.PermUserRead), u.get)
 
 	// register Endpoints
-	group.Use(middleware.Protect(model.RoleSuperAdmin, model.RoleMupADMIN))
+	group.GET("/all-users", middleware.Protect(model.PermUserList), u.getAllUsersForSuperAdmin)
+	group.Use(middleware.Protect(model.PermUserManage))
 	group.POST("/", u.create)
 	group.PUT("/:uuid", u.update)
-	group.DELETE("/:uuid", u.delete)
-	group.GET("/all-users", u.getAllUsersForSuperAdmin)
-	group.GET("/search", u.searchUsersByName)
+	group.GET("/search", u.searchUsers)
 }
 
 // UserExample godoc
@@ -110,7 +116,9 @@ func (u *UserController) get(c *gin.Context) {
 //	@Produce	json
 //	@Success	201	{object}	dto.UserDto
 //	@Failure	400
+//	@Failure	403
 //	@Failure	404
+//	@Failure	422	{object}	dto.ValidationErrorDto
 //	@Failure	500
 //	@Param		model	body	dto.NewUserDto	true	"Data for new user"
 //	@Router		/user [post]
@@ -123,60 +131,75 @@ func (u *UserController) create(c *gin.Context) {
 
 	newUser, err := dto.ToModel()
 	if err != nil {
+		if abortValidation(c, err) {
+			return
+		}
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	// Handle police token based on role
-	if newUser.Role == model.RolePolicija {
-		// For police officers, ensure token is set if provided
-		if dto.PoliceToken != "" {
-			tokenValue := dto.PoliceToken
-			newUser.PoliceToken = &tokenValue
+	claims, ok := loggedInClaims(c)
+	if !ok {
+		return
+	}
+	if newUser.Role == model.RoleSuperAdmin && claims.Role != model.RoleSuperAdmin {
+		c.AbortWithError(http.StatusForbidden, cerror.ErrForbidden)
+		return
+	}
+
+	// The first activation code of an officer can be chosen by the admin
+	policeToken := ""
+	if newUser.Role == model.RolePolicija && dto.PoliceToken != "" {
+		if err := auth.ValidateActivationCode(dto.PoliceToken); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
 		}
-	} else {
-		// For non-police users, explicitly set to nil
-		newUser.PoliceToken = nil
+		policeToken = dto.PoliceToken
+	}
+
+	adminUuid, ok := loggedInUuid(c)
+	if !ok {
+		return
 	}
 
 	user, err := u.UserCrud.Create(newUser, dto.Password)
 	if err != nil {
+		if abortPasswordPolicy(c, err) {
+			return
+		}
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	// For police officers, reload to ensure we have the latest state
-	if user.Role == model.RolePolicija {
-		refreshedUser, err := u.UserCrud.Read(user.Uuid)
-		if err == nil {
-			user = refreshedUser
+	if policeToken != "" {
+		if _, err := u.PoliceCodes.Set(user.Uuid, policeToken, adminUuid); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
 		}
 	}
 
-	// Log the response for debugging
 	responseDto := dto.FromModel(user)
-	tokenValue := ""
-	if user.PoliceToken != nil {
-		tokenValue = *user.PoliceToken
-	}
-	u.logger.Infof("Response DTO: %+v", responseDto)
-	u.logger.Infof("Response PoliceToken: %q", tokenValue)
-
 	c.JSON(http.StatusCreated, responseDto)
 }
 
 // UserExample godoc
 //
-//	@Summary	Update user with new dat
-//	@Tags		user
-//	@Produce	json
-//	@Success	200	{object}	dto.UserDto
-//	@Failure	400
-//	@Failure	404
-//	@Failure	500
-//	@Param		uuid	path	string		true	"uuid of user to be updated"
-//	@Param		model	body	dto.UserDto	true	"Data for updating user"
-//	@Router		/user/{uuid} [put]
+//	@Summary		Update user with new dat
+//	@Description	Administrators change every field of a user including OIB and role,
+//	@Description	users change their own data through /user/my-data. Only superadmins
+//	@Description	change superadmins or make one, nobody changes their own role.
+//	@Tags			user
+//	@Produce		json
+//	@Success		200	{object}	dto.UserDto
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		422	{object}	dto.ValidationErrorDto
+//	@Failure		500
+//	@Param			uuid	path	string				true	"uuid of user to be updated"
+//	@Param			model	body	dto.AdminUserDto	true	"Data for updating user"
+//	@Router			/user/{uuid} [put]
 func (u *UserController) update(c *gin.Context) {
 	userUuid, err := uuid.Parse(c.Param("uuid"))
 	if err != nil {
@@ -185,61 +208,83 @@ func (u *UserController) update(c *gin.Context) {
 		return
 	}
 
-	var dto dto.UserDto
-	if err := c.BindJSON(&dto); err != nil {
+	var adminDto dto.AdminUserDto
+	if err := c.BindJSON(&adminDto); err != nil {
 		u.logger.Errorf("Failed to bind error = %+v", err)
 		return
 	}
 
-	newUser, err := dto.ToModel()
+	newUser, err := adminDto.ToModel()
 	if err != nil {
+		if abortValidation(c, err) {
+			return
+		}
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	user, err := u.UserCrud.Update(userUuid, newUser)
-	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+	claims, ok := loggedInClaims(c)
+	if !ok {
 		return
 	}
-
-	c.JSON(http.StatusOK, dto.FromModel(user))
-}
-
-// UserExample  godoc
-//
-//	@Summary		delete user with uuid
-//	@Description	delete a user with uuid
-//	@Tags			user
-//	@Produce		json
-//	@Success		204
-//	@Failure		400
-//	@Failure		404
-//	@Failure		500
-//	@Param			uuid	path	string	true	"user uuid"
-//	@Router			/user/{uuid} [delete]
-func (u *UserController) delete(c *gin.Context) {
-	userUuid, err := uuid.Parse(c.Param("uuid"))
-	if err != nil {
-		u.logger.Errorf("error parsing uuid value = %s", c.Param("uuid"))
-		c.AbortWithError(http.StatusBadRequest, err)
+	if err := u.checkRoleChange(claims, userUuid, newUser.Role); err != nil {
+		switch {
+		case abortForbidden(c, err):
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.AbortWithError(http.StatusNotFound, err)
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
 		return
 	}
 
-	err = u.UserCrud.Delete(userUuid)
+	user, err := u.UserCrud.Update(userUuid, newUser)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			u.logger.Errorf("User with uuid = %s not found", userUuid)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			c.AbortWithError(http.StatusNotFound, err)
-			return
+		case errors.Is(err, cerror.ErrEmailTaken):
+			c.JSON(http.StatusConflict, err.Error())
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
 		}
-
-		u.logger.Errorf("Failed to delete user with uuid = %s", userUuid)
-		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	c.JSON(http.StatusNoContent, nil)
+	c.JSON(http.StatusOK, dto.UserDto{}.FromModel(user))
+}
+
+// checkRoleChange returns cerror.ErrForbidden if the caller may not give the
+// user the role, only superadmins manage superadmins and nobody changes
+// their own role
+func (u *UserController) checkRoleChange(claims *auth.Claims, userUuid uuid.UUID, role model.UserRole) error {
+	if claims.Uuid == userUuid.String() && claims.Role != role {
+		return cerror.ErrForbidden
+	}
+	if claims.Role == model.RoleSuperAdmin {
+		return nil
+	}
+	if role == model.RoleSuperAdmin {
+		return cerror.ErrForbidden
+	}
+	return checkTargetRole(u.UserCrud, claims, userUuid)
+}
+
+// checkTargetRole returns cerror.ErrForbidden if the user is a superadmin and
+// the caller is not, only superadmins manage superadmins
+func checkTargetRole(userCrud service.IUserCrudService, claims *auth.Claims, userUuid uuid.UUID) error {
+	if claims.Role == model.RoleSuperAdmin {
+		return nil
+	}
+
+	user, err := userCrud.Read(userUuid)
+	if err != nil {
+		return err
+	}
+	if user.Role == model.RoleSuperAdmin {
+		return cerror.ErrForbidden
+	}
+	return nil
 }
 
 // GetLoggedInUser godoc
@@ -255,17 +300,8 @@ func (u *UserController) delete(c *gin.Context) {
 //	@Failure		500
 //	@Router			/user/my-data [get]
 func (u *UserController) getLoggedInUser(c *gin.Context) {
-	_, claims, err := auth.ParseToken(c.Request.Header.Get("Authorization"))
-	if err != nil {
-		u.logger.Errorf("Failed to parse token: %v", err)
-		c.AbortWithError(http.StatusUnauthorized, err)
-		return
-	}
-
-	userUuid, err := uuid.Parse(claims.Uuid)
-	if err != nil {
-		u.logger.Errorf("Error parsing UUID = %s", err)
-		c.AbortWithError(http.StatusBadRequest, err)
+	userUuid, ok := loggedInUuid(c)
+	if !ok {
 		return
 	}
 
@@ -289,30 +325,33 @@ func (u *UserController) getLoggedInUser(c *gin.Context) {
 // GetAllUsers godoc
 //
 //	@Summary		Get all users for superadmin
-//	@Description	Fetches all users for superadmin
+//	@Description	Fetches a page of users for superadmin. Filters: firstName, lastName and email
+//	@Description	(also [contains]), oib, role, birthDate and createdAt (also [gte] and [lte]).
 //	@Tags			user
 //	@Produce		json
-//	@Success		200	{array}	dto.UserDto
+//	@Param			limit	query	int		false	"Page size, at most 100"
+//	@Param			offset	query	int		false	"Rows to skip, can't be used with cursor"
+//	@Param			cursor	query	string	false	"X-Next-Cursor of the previous page"
+//	@Param			sort	query	string	false	"Comma separated fields, - sorts descending"
+//	@Header			200		{int}		X-Total-Count	"Number of rows matching the filters"
+//	@Header			200		{string}	Link			"Links to the first, previous, next and last page"
+//	@Success		200		{array}		dto.UserDto
+//	@Failure		400
 //	@Failure		401
 //	@Failure		403
 //	@Failure		500
 //	@Router			/user/all-users [get]
 func (u *UserController) getAllUsersForSuperAdmin(c *gin.Context) {
-	_, claims, err := auth.ParseToken(c.Request.Header.Get("Authorization"))
-	if err != nil {
-		u.logger.Errorf("Failed to parse token: %v", err)
-		c.AbortWithError(http.StatusUnauthorized, err)
-		return
-	}
-
-	if claims.Role != model.RoleSuperAdmin {
-		u.logger.Warnf("Unauthorized access attempt by user with role: %s", claims.Role)
-		c.AbortWithStatus(http.StatusForbidden)
+	params, ok := bindPaging(c, service.UserListSpec)
+	if !ok {
 		return
 	}
 
-	users, err := u.UserCrud.GetAllUsers()
+	users, page, err := u.UserCrud.GetAllUsers(params)
 	if err != nil {
+		if abortInvalidQuery(c, err) {
+			return
+		}
 		u.logger.Errorf("Failed to fetch users: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -324,62 +363,88 @@ func (u *UserController) getAllUsersForSuperAdmin(c *gin.Context) {
 		userDtos = append(userDtos, dto.FromModel(&user))
 	}
 
+	setPageHeaders(c, page)
 	c.JSON(http.StatusOK, userDtos)
 }
 
 // GetAllPoliceOfficers godoc
 //
 //	@Summary		Get all police officers for MUP Admin
-//	@Description	Fetches all police officers for MUP Admin
+//	@Description	Fetches a page of police officers for MUP Admin. Filters: firstName, lastName
+//	@Description	and email (also [contains]), createdAt (also [gte] and [lte]).
 //	@Tags			user
 //	@Produce		json
-//	@Success		200	{array}	dto.UserDto
+//	@Param			limit	query	int		false	"Page size, at most 100"
+//	@Param			offset	query	int		false	"Rows to skip, can't be used with cursor"
+//	@Param			cursor	query	string	false	"X-Next-Cursor of the previous page"
+//	@Param			sort	query	string	false	"Comma separated fields, - sorts descending"
+//	@Header			200		{int}		X-Total-Count	"Number of rows matching the filters"
+//	@Header			200		{string}	Link			"Links to the first, previous, next and last page"
+//	@Success		200		{array}		dto.PoliceOfficerDto
+//	@Failure		400
 //	@Failure		401
 //	@Failure		403
 //	@Failure		500
 //	@Router			/user/police-officers [get]
 func (u *UserController) getAllPoliceOfficers(c *gin.Context) {
-	_, claims, err := auth.ParseToken(c.Request.Header.Get("Authorization"))
-	if err != nil {
-		u.logger.Errorf("Failed to parse token: %v", err)
-		c.AbortWithError(http.StatusUnauthorized, err)
+	params, ok := bindPaging(c, service.PoliceOfficerListSpec)
+	if !ok {
 		return
 	}
 
-	if claims.Role != model.RoleMupADMIN {
-		u.logger.Warnf("Unauthorized access attempt by user with role: %s", claims.Role)
-		c.AbortWithStatus(http.StatusForbidden)
+	users, page, err := u.UserCrud.GetAllPoliceOfficers(params)
+	if err != nil {
+		if abortInvalidQuery(c, err) {
+			return
+		}
+		u.logger.Errorf("Failed to fetch police officers: %v", err)
+		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	users, err := u.UserCrud.GetAllPoliceOfficers()
+	ids := make([]uint, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+
+	codes, err := u.PoliceCodes.GetStatuses(ids)
 	if err != nil {
-		u.logger.Errorf("Failed to fetch police officers: %v", err)
+		u.logger.Errorf("Failed to fetch activation codes: %v", err)
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
-	userDtos := make([]dto.UserDto, 0, len(users))
+	officerDtos := make([]dto.PoliceOfficerDto, 0, len(users))
 	for _, user := range users {
-		dto := dto.UserDto{}
-		userDtos = append(userDtos, dto.FromModel(&user))
+		var code *model.PoliceActivationCode
+		if found, ok := codes[user.ID]; ok {
+			code = &found
+		}
+		officerDtos = append(officerDtos, dto.PoliceOfficerDto{}.FromModel(&user, code))
 	}
 
-	c.JSON(http.StatusOK, userDtos)
+	setPageHeaders(c, page)
+	c.JSON(http.StatusOK, officerDtos)
 }
 
-// SearchUsersByName godoc
+// SearchUsers godoc
 //
-//	@Summary		Search users by name
-//	@Description	Performs a fuzzy search for users by first name, last name, or full name with similarity matching
+//	@Summary		Search users
+//	@Description	Fuzzy search of users by name, email and residence, or by OIB prefix if the query
+//	@Description	is a number. Users are ordered by how well they match, best first.
 //	@Tags			user
 //	@Produce		json
-//	@Param			query	query	string	true	"Search query"
-//	@Success		200		{array}	dto.UserDto
+//	@Param			query	query		string	true	"Search query"
+//	@Param			field	query		string	false	"Only search one field"	Enums(name, oib, email, residence)
+//	@Param			limit	query		int		false	"Page size, at most 100"
+//	@Param			offset	query		int		false	"Rows to skip"
+//	@Header			200		{int}		X-Total-Count	"Number of matching users"
+//	@Header			200		{string}	Link			"Links to the first, previous, next and last page"
+//	@Success		200		{array}		dto.UserSearchResultDto
 //	@Failure		400
 //	@Failure		500
 //	@Router			/user/search [get]
-func (u *UserController) searchUsersByName(c *gin.Context) {
+func (u *UserController) searchUsers(c *gin.Context) {
 	query := c.Query("query")
 	if query == "" {
 		u.logger.Warn("Search query is empty")
@@ -387,33 +452,43 @@ func (u *UserController) searchUsersByName(c *gin.Context) {
 		return
 	}
 
+	params, ok := bindPaging(c, service.UserSearchSpec)
+	if !ok {
+		return
+	}
+
 	u.logger.Infof("Searching users with query: %s", query)
 
-	users, err := u.UserCrud.SearchUsersByName(query)
+	users, page, err := u.UserCrud.SearchUsers(query, service.UserSearchField(c.Query("field")), params)
 	if err != nil {
+		if abortInvalidQuery(c, err) {
+			return
+		}
 		u.logger.Errorf("Failed to search users: %v", err)
 		c.JSON(http.StatusInternalServerError, "Failed to search users")
 		return
 	}
 
-	userDtos := make([]dto.UserDto, 0, len(users))
+	resultDtos := make([]dto.UserSearchResultDto, 0, len(users))
 	for _, user := range users {
-		dto := dto.UserDto{}
-		userDtos = append(userDtos, dto.FromModel(&user))
+		resultDtos = append(resultDtos, dto.UserSearchResultDto{}.FromModel(&user.User, user.Score))
 	}
 
-	c.JSON(http.StatusOK, userDtos)
+	setPageHeaders(c, page)
+	c.JSON(http.StatusOK, resultDtos)
 }
 
 // GetUserByOIB godoc
 //
 //	@Summary		get user with oib
-//	@Description	get a user with oib
+//	@Description	get a user with oib, police officers have to sign the request with their device key
 //	@Tags			user
 //	@Produce		json
 //	@Success		200	{object}	dto.UserDto
 //	@Failure		400
+//	@Failure		401
 //	@Failure		404
+//	@Failure		422	{object}	dto.ValidationErrorDto
 //	@Failure		500
 //	@Param			oib	path	string	true	"user oib"
 //	@Router			/user/oib/{oib} [get]
@@ -424,6 +499,10 @@ func (u *UserController) getUserByOib(c *gin.Context) {
 		c.AbortWithError(http.StatusBadRequest, errors.New("OIB parameter is required"))
 		return
 	}
+	if err := validate.Oib(oib); err != nil {
+		abortValidation(c, &cerror.FieldError{Field: "oib", Err: err})
+		return
+	}
 
 	user, err := u.UserCrud.GetUserByOIB(oib)
 	if err != nil {
@@ -442,19 +521,18 @@ func (u *UserController) getUserByOib(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.FromModel(user))
 }
 
-// Backend - Add to controller/userController.go
-
 // GeneratePoliceToken godoc
 //
-//	@Summary	Generate a new police token for a user
-//	@Tags		user
-//	@Produce	json
-//	@Success	200
-//	@Failure	400
-//	@Failure	404
-//	@Failure	500
-//	@Param		uuid	path	string	true	"User UUID"
-//	@Router		/user/{uuid}/generate-token [post]
+//	@Summary		Generate a new police token for a user
+//	@Description	Issues a single use activation code, the code is only shown in this response. Earlier codes of the officer are revoked
+//	@Tags			user
+//	@Produce		json
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Param			uuid	path	string	true	"User UUID"
+//	@Router			/user/{uuid}/generate-token [post]
 func (u *UserController) generatePoliceToken(c *gin.Context) {
 	userUuid, err := uuid.Parse(c.Param("uuid"))
 	if err != nil {
@@ -463,50 +541,42 @@ func (u *UserController) generatePoliceToken(c *gin.Context) {
 		return
 	}
 
-	user, err := u.UserCrud.Read(userUuid)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			u.logger.Errorf("User with UUID = %s not found", userUuid)
-			c.AbortWithError(http.StatusNotFound, err)
-			return
-		}
-		c.AbortWithError(http.StatusInternalServerError, err)
+	adminUuid, ok := loggedInUuid(c)
+	if !ok {
 		return
 	}
 
-	// Only allow generating police token for police officers
-	if user.Role != model.RolePolicija {
-		u.logger.Warnf("Attempted to generate police token for non-police user: %s", user.Role)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Police token can only be generated for police officers"})
-		return
-	}
-
-	token := u.generateToken()
-	user.PoliceToken = &token
-
-	// Save the updated user
-	_, err = u.UserCrud.Update(userUuid, user)
+	token, code, err := u.PoliceCodes.Issue(userUuid, adminUuid)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		if errors.Is(err, cerror.ErrNotPoliceOfficer) {
+			u.logger.Warnf("Attempted to generate police token for non-police user: %s", userUuid)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Police token can only be generated for police officers"})
+			return
+		}
+		u.abortPoliceCode(c, userUuid, err)
 		return
 	}
 
 	// Return the generated token to the client
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"expiresAt": code.ExpiresAt.Format(format.DateTimeFormat),
+	})
 }
 
 // SetPoliceToken godoc
 //
-//	@Summary	Set police token for a user
-//	@Tags		user
-//	@Produce	json
-//	@Success	200
-//	@Failure	400
-//	@Failure	404
-//	@Failure	500
-//	@Param		uuid	path	string	true	"User UUID"
-//	@Param		model	body	object	true	"Police token"
-//	@Router		/user/{uuid}/police-token [patch]
+//	@Summary		Set police token for a user
+//	@Description	Stores an activation code chosen by the admin, earlier codes of the officer are revoked
+//	@Tags			user
+//	@Produce		json
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Param			uuid	path	string	true	"User UUID"
+//	@Param			model	body	object	true	"Police token"
+//	@Router			/user/{uuid}/police-token [patch]
 func (u *UserController) setPoliceToken(c *gin.Context) {
 	userUuid, err := uuid.Parse(c.Param("uuid"))
 	if err != nil {
@@ -525,45 +595,70 @@ func (u *UserController) setPoliceToken(c *gin.Context) {
 		return
 	}
 
-	user, err := u.UserCrud.Read(userUuid)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			u.logger.Errorf("User with UUID = %s not found", userUuid)
-			c.AbortWithError(http.StatusNotFound, err)
-			return
-		}
-		c.AbortWithError(http.StatusInternalServerError, err)
+	adminUuid, ok := loggedInUuid(c)
+	if !ok {
 		return
 	}
 
-	// Only allow setting police token for police officers
-	if user.Role != model.RolePolicija {
-		u.logger.Warnf("Attempted to set police token for non-police user: %s", user.Role)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Police token can only be set for police officers"})
+	if _, err := u.PoliceCodes.Set(userUuid, tokenRequest.PoliceToken, adminUuid); err != nil {
+		switch {
+		case errors.Is(err, cerror.ErrNotPoliceOfficer):
+			u.logger.Warnf("Attempted to set police token for non-police user: %s", userUuid)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Police token can only be set for police officers"})
+		case errors.Is(err, cerror.ErrWeakActivationCode):
+			c.AbortWithError(http.StatusBadRequest, err)
+		default:
+			u.abortPoliceCode(c, userUuid, err)
+		}
 		return
 	}
 
-	// Update user with token
-	tokenValue := tokenRequest.PoliceToken
-	user.PoliceToken = &tokenValue
+	c.Status(http.StatusOK)
+}
 
-	_, err = u.UserCrud.Update(userUuid, user)
+// RevokePoliceToken godoc
+//
+//	@Summary		Revoke police token of a user
+//	@Description	Revokes the activation code of an officer that was not used yet
+//	@Tags			user
+//	@Success		204
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Param			uuid	path	string	true	"User UUID"
+//	@Router			/user/{uuid}/police-token [delete]
+func (u *UserController) revokePoliceToken(c *gin.Context) {
+	userUuid, err := uuid.Parse(c.Param("uuid"))
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		u.logger.Errorf("Error parsing UUID = %s", c.Param("uuid"))
+		c.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
 
-	c.Status(http.StatusOK)
+	adminUuid, ok := loggedInUuid(c)
+	if !ok {
+		return
+	}
+
+	if err := u.PoliceCodes.Revoke(userUuid, adminUuid); err != nil {
+		if errors.Is(err, cerror.ErrNotPoliceOfficer) || errors.Is(err, cerror.ErrNoActivationCode) {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		u.abortPoliceCode(c, userUuid, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
-// Generate police token
-func (u *UserController) generateToken() string {
-	digits := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	token := ""
-	for i := 0; i < 8; i++ {
-		token += string(digits[rand.Intn(len(digits))])
+func (u *UserController) abortPoliceCode(c *gin.Context, userUuid uuid.UUID, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		u.logger.Errorf("User with UUID = %s not found", userUuid)
+		c.AbortWithError(http.StatusNotFound, err)
+		return
 	}
-	return token
+	c.AbortWithError(http.StatusInternalServerError, err)
 }
 
 // GetLoggedInUserDevice godoc
@@ -579,18 +674,8 @@ func (u *UserController) generateToken() string {
 //	@Failure		500
 //	@Router			/user/my-device [get]
 func (u *UserController) getLoggedInUserDevice(c *gin.Context) {
-	// Get user UUID from JWT token
-	_, claims, err := auth.ParseToken(c.Request.Header.Get("Authorization"))
-	if err != nil {
-		u.logger.Errorf("Failed to parse token: %v", err)
-		c.AbortWithError(http.StatusUnauthorized, errors.New("invalid or expired token"))
-		return
-	}
-
-	userUUID, err := uuid.Parse(claims.Uuid)
-	if err != nil {
-		u.logger.Errorf("Error parsing UUID from claims: %v", err)
-		c.AbortWithError(http.StatusBadRequest, errors.New("invalid user identifier"))
+	userUUID, ok := loggedInUuid(c)
+	if !ok {
 		return
 	}
 
@@ -619,7 +704,7 @@ func (u *UserController) getLoggedInUserDevice(c *gin.Context) {
 	}
 
 	// Return device information
-	c.JSON(http.StatusOK, device)
+	c.JSON(http.StatusOK, dto.MobileDto{}.FromModel(device))
 }
 
 // DeleteLoggedInUserDevice godoc
@@ -635,23 +720,13 @@ func (u *UserController) getLoggedInUserDevice(c *gin.Context) {
 //	@Failure		500
 //	@Router			/user/my-device [delete]
 func (u *UserController) deleteLoggedInUserDevice(c *gin.Context) {
-	// Get user UUID from JWT token
-	_, claims, err := auth.ParseToken(c.Request.Header.Get("Authorization"))
-	if err != nil {
-		u.logger.Errorf("Failed to parse token: %v", err)
-		c.AbortWithError(http.StatusUnauthorized, errors.New("invalid or expired token"))
-		return
-	}
-
-	userUUID, err := uuid.Parse(claims.Uuid)
-	if err != nil {
-		u.logger.Errorf("Error parsing UUID from claims: %v", err)
-		c.AbortWithError(http.StatusBadRequest, errors.New("invalid user identifier"))
+	userUUID, ok := loggedInUuid(c)
+	if !ok {
 		return
 	}
 
 	// Delete user's device
-	err = u.UserCrud.DeleteUserDevice(userUUID)
+	err := u.UserCrud.DeleteUserDevice(userUUID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.AbortWithError(http.StatusNotFound, errors.New("device not found"))
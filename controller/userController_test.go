@@ -9,6 +9,9 @@ import (
 	"ePrometna_Server/model"
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/paging"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -69,33 +72,37 @@ func (m *MockUserCrudService) Update(id uuid.UUID, user *model.User) (*model.Use
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
-func (m *MockUserCrudService) Delete(id uuid.UUID) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
-
-func (m *MockUserCrudService) GetAllUsers() ([]model.User, error) {
-	args := m.Called()
+func (m *MockUserCrudService) GetAllUsers(params *paging.Params) ([]model.User, *paging.Page, error) {
+	args := m.Called(params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, page, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	return args.Get(0).([]model.User), page, args.Error(2)
 }
 
-func (m *MockUserCrudService) GetAllPoliceOfficers() ([]model.User, error) {
-	args := m.Called()
+func (m *MockUserCrudService) GetAllPoliceOfficers(params *paging.Params) ([]model.User, *paging.Page, error) {
+	args := m.Called(params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, page, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	return args.Get(0).([]model.User), page, args.Error(2)
 }
 
-func (m *MockUserCrudService) SearchUsersByName(query string) ([]model.User, error) {
-	args := m.Called(query)
+func (m *MockUserCrudService) SearchUsers(query string, field service.UserSearchField, params *paging.Params) ([]service.UserWithScore, *paging.Page, error) {
+	args := m.Called(query, field, params)
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, nil, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	page, _ := args.Get(1).(*paging.Page)
+	return args.Get(0).([]service.UserWithScore), page, args.Error(2)
 }
 
 func (m *MockUserCrudService) GetUserByOIB(oib string) (*model.User, error) {
@@ -114,11 +121,59 @@ func (m *MockUserCrudService) GetUserDevice(userId uint) (*model.Mobile, error)
 	return args.Get(0).(*model.Mobile), args.Error(1)
 }
 
+// --- Mock PoliceCodeService ---
+type MockPoliceCodeService struct {
+	mock.Mock
+}
+
+func (m *MockPoliceCodeService) Issue(officerUuid, adminUuid uuid.UUID) (string, *model.PoliceActivationCode, error) {
+	args := m.Called(officerUuid, adminUuid)
+	if args.Get(1) == nil {
+		return args.String(0), nil, args.Error(2)
+	}
+	return args.String(0), args.Get(1).(*model.PoliceActivationCode), args.Error(2)
+}
+
+func (m *MockPoliceCodeService) Set(officerUuid uuid.UUID, code string, adminUuid uuid.UUID) (*model.PoliceActivationCode, error) {
+	args := m.Called(officerUuid, code, adminUuid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.PoliceActivationCode), args.Error(1)
+}
+
+func (m *MockPoliceCodeService) Revoke(officerUuid, adminUuid uuid.UUID) error {
+	args := m.Called(officerUuid, adminUuid)
+	return args.Error(0)
+}
+
+func (m *MockPoliceCodeService) Redeem(code string) (*model.User, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockPoliceCodeService) GetStatuses(userIds []uint) (map[uint]model.PoliceActivationCode, error) {
+	args := m.Called(userIds)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uint]model.PoliceActivationCode), args.Error(1)
+}
+
+func (m *MockPoliceCodeService) ExpireCodes() (int64, error) {
+	args := m.Called()
+	return int64(args.Int(0)), args.Error(1)
+}
+
 // --- UserController Test Suite ---
 type UserControllerTestSuite struct {
 	suite.Suite
 	router              *gin.Engine
 	mockUserCrudService *MockUserCrudService
+	mockPoliceCodes     *MockPoliceCodeService
 	logger              *zap.SugaredLogger
 	logObserver         *observer.ObservedLogs
 }
@@ -138,10 +193,12 @@ func (suite *UserControllerTestSuite) SetupSuite() {
 	}
 
 	suite.mockUserCrudService = new(MockUserCrudService)
+	suite.mockPoliceCodes = new(MockPoliceCodeService)
 
 	app.Test()
 	app.Provide(func() *zap.SugaredLogger { return suite.logger })
 	app.Provide(func() service.IUserCrudService { return suite.mockUserCrudService })
+	app.Provide(func() service.IPoliceCodeService { return suite.mockPoliceCodes })
 
 	suite.router = gin.Default()
 	apiGroup := suite.router.Group("/api")
@@ -161,6 +218,8 @@ func (suite *UserControllerTestSuite) TearDownSuite() {
 func (suite *UserControllerTestSuite) SetupTest() {
 	suite.mockUserCrudService.ExpectedCalls = nil
 	suite.mockUserCrudService.Calls = nil
+	suite.mockPoliceCodes.ExpectedCalls = nil
+	suite.mockPoliceCodes.Calls = nil
 }
 
 // Helper to generate a token for a test user
@@ -183,8 +242,8 @@ func TestUserController(t *testing.T) {
 func (suite *UserControllerTestSuite) TestCreateUser_Success() {
 	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleSuperAdmin)
 	newUserDto := dto.NewUserDto{
-		FirstName: "Test", LastName: "User", OIB: "12345678901",
-		Residence: "Testville", BirthDate: "1990-01-01", Email: "test@example.com",
+		FirstName: "Test", LastName: "User", OIB: "12345678903",
+		Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, BirthDate: "1990-01-01", Email: "test@example.com",
 		Password: "password123", Role: "osoba",
 	}
 	expectedUserUUID := uuid.New()
@@ -217,6 +276,63 @@ func (suite *UserControllerTestSuite) TestCreateUser_Success() {
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
+func (suite *UserControllerTestSuite) TestCreateUser_InvalidIdentity() {
+	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleSuperAdmin)
+	newUserDto := dto.NewUserDto{
+		FirstName: "Test", LastName: "User", OIB: "12345678901",
+		Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, BirthDate: time.Now().AddDate(1, 0, 0).Format(format.DateFormat), Email: "test@example.com",
+		Password: "password", Role: "osoba",
+	}
+
+	jsonValue, _ := json.Marshal(newUserDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	var responseDto dto.ValidationErrorDto
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &responseDto))
+	suite.Require().Len(responseDto.Violations, 2)
+	assert.Equal(suite.T(), dto.ViolationDto{Field: "oib", Code: "invalid_oib", Message: "OIB must be 11 digits with a valid check digit"}, responseDto.Violations[0])
+	assert.Equal(suite.T(), "birthDate", responseDto.Violations[1].Field)
+	suite.mockUserCrudService.AssertNotCalled(suite.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (suite *UserControllerTestSuite) TestCreateUser_WeakPassword() {
+	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleSuperAdmin)
+	newUserDto := dto.NewUserDto{
+		FirstName: "Test", LastName: "User", OIB: "12345678903",
+		Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, BirthDate: "1990-01-01", Email: "test@example.com",
+		Password: "password", Role: "osoba",
+	}
+	suite.mockUserCrudService.On("Create", mock.AnythingOfType("*model.User"), newUserDto.Password).
+		Return(nil, &auth.PasswordPolicyError{Violations: []auth.PasswordViolation{
+			{Code: auth.ViolationClasses, Args: []any{3}},
+			{Code: auth.ViolationBreached},
+		}}).Once()
+
+	jsonValue, _ := json.Marshal(newUserDto)
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Accept-Language", "hr-HR,hr;q=0.9,en;q=0.8")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	var responseDto dto.ValidationErrorDto
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &responseDto))
+	suite.Require().Len(responseDto.Violations, 2)
+	assert.Equal(suite.T(), auth.ViolationClasses, responseDto.Violations[0].Code)
+	assert.Contains(suite.T(), responseDto.Violations[0].Message, "barem 3")
+	assert.Equal(suite.T(), auth.ViolationBreached, responseDto.Violations[1].Code)
+	suite.mockUserCrudService.AssertExpectations(suite.T())
+}
+
 func (suite *UserControllerTestSuite) TestCreateUser_Forbidden() {
 	nonAdminToken := generateUserTestToken(uuid.New(), "user@example.com", model.RoleOsoba)
 	newUserDto := dto.NewUserDto{FirstName: "Test", Role: "osoba"}
@@ -230,6 +346,21 @@ func (suite *UserControllerTestSuite) TestCreateUser_Forbidden() {
 	suite.router.ServeHTTP(w, req)
 	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
 
+	// only superadmins create superadmins
+	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	jsonValue, _ = json.Marshal(dto.NewUserDto{
+		FirstName: "Test", LastName: "User", OIB: "12345678903",
+		Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, BirthDate: "1990-01-01", Email: "test@example.com",
+		Password: "password123", Role: "superadmin",
+	})
+	req, _ = http.NewRequest(http.MethodPost, "/api/user/", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
@@ -251,7 +382,7 @@ func (suite *UserControllerTestSuite) TestGetUser_Success() {
 	targetUserUUID := uuid.New()
 	expectedUser := &model.User{
 		Uuid: targetUserUUID, FirstName: "Target", LastName: "User", Role: model.RoleOsoba,
-		BirthDate: time.Now().AddDate(-20, 0, 0), OIB: "98765432109", Email: "target@example.com",
+		BirthDate: time.Now().AddDate(-20, 0, 0), OIB: "98765432106", Email: "target@example.com",
 	}
 	suite.mockUserCrudService.On("Read", targetUserUUID).Return(expectedUser, nil).Once()
 
@@ -287,9 +418,9 @@ func (suite *UserControllerTestSuite) TestGetUser_NotFound() {
 func (suite *UserControllerTestSuite) TestUpdateUser_Success() {
 	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleSuperAdmin)
 	targetUserUUID := uuid.New()
-	updateDto := dto.UserDto{ // UserDto is used for update
-		Uuid: targetUserUUID.String(), FirstName: "UpdatedFirst", LastName: "UpdatedLast",
-		OIB: "11122233344", Residence: "Updated Residence", BirthDate: "1985-05-15",
+	updateDto := dto.AdminUserDto{
+		FirstName: "UpdatedFirst", LastName: "UpdatedLast",
+		OIB: "11122233343", Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, BirthDate: "1985-05-15",
 		Email: "updated.email@example.com", Role: "firma",
 	}
 	updatedUserModel, _ := updateDto.ToModel()
@@ -314,18 +445,38 @@ func (suite *UserControllerTestSuite) TestUpdateUser_Success() {
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
-func (suite *UserControllerTestSuite) TestDeleteUser_Success() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleSuperAdmin)
+func (suite *UserControllerTestSuite) TestUpdateUser_RoleForbidden() {
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
-	suite.mockUserCrudService.On("Delete", targetUserUUID).Return(nil).Once()
+	updateDto := dto.AdminUserDto{
+		FirstName: "Ana", LastName: "Anić",
+		OIB: "11122233343", Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, BirthDate: "1985-05-15",
+		Email: "ana@example.com", Role: "superadmin",
+	}
+	put := func(userUUID uuid.UUID) int {
+		jsonValue, _ := json.Marshal(updateDto)
+		req, _ := http.NewRequest(http.MethodPut, "/api/user/"+userUUID.String(), bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		return w.Code
+	}
 
-	req, _ := http.NewRequest(http.MethodDelete, "/api/user/"+targetUserUUID.String(), nil)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
+	// promoting to superadmin, also themselves
+	assert.Equal(suite.T(), http.StatusForbidden, put(targetUserUUID))
+	assert.Equal(suite.T(), http.StatusForbidden, put(adminUUID))
 
-	w := httptest.NewRecorder()
-	suite.router.ServeHTTP(w, req)
+	// changing their own role
+	updateDto.Role = "firma"
+	assert.Equal(suite.T(), http.StatusForbidden, put(adminUUID))
 
-	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	// changing a superadmin
+	suite.mockUserCrudService.On("Read", targetUserUUID).Return(&model.User{Uuid: targetUserUUID, Role: model.RoleSuperAdmin}, nil).Once()
+	assert.Equal(suite.T(), http.StatusForbidden, put(targetUserUUID))
+
+	suite.mockUserCrudService.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything)
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
@@ -337,7 +488,7 @@ func (suite *UserControllerTestSuite) TestGetLoggedInUser_Success() {
 
 	expectedUser := &model.User{
 		Uuid: loggedInUserUUID, FirstName: "Logged", LastName: "In", Role: loggedInUserRole,
-		BirthDate: time.Now().AddDate(-20, 0, 0), OIB: "55566677788", Email: loggedInUserEmail,
+		BirthDate: time.Now().AddDate(-20, 0, 0), OIB: "55566677789", Email: loggedInUserEmail,
 	}
 	suite.mockUserCrudService.On("Read", loggedInUserUUID).Return(expectedUser, nil).Once()
 
@@ -362,7 +513,7 @@ func (suite *UserControllerTestSuite) TestGetAllUsersForSuperAdmin_Success() {
 		{Uuid: uuid.New(), FirstName: "UserA", Role: model.RoleOsoba, BirthDate: time.Now()},
 		{Uuid: uuid.New(), FirstName: "UserB", Role: model.RoleFirma, BirthDate: time.Now()},
 	}
-	suite.mockUserCrudService.On("GetAllUsers").Return(users, nil).Once()
+	suite.mockUserCrudService.On("GetAllUsers", mock.Anything).Return(users, &paging.Page{Total: 2, Limit: paging.DefaultLimit}, nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/user/all-users", nil)
 	req.Header.Set("Authorization", "Bearer "+superAdminToken)
@@ -379,13 +530,49 @@ func (suite *UserControllerTestSuite) TestGetAllUsersForSuperAdmin_Success() {
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
+func (suite *UserControllerTestSuite) TestGetAllUsersForSuperAdmin_Paged() {
+	superAdminToken := generateUserTestToken(uuid.New(), "super@admin.com", model.RoleSuperAdmin)
+	users := []model.User{{Uuid: uuid.New(), FirstName: "UserA", Role: model.RoleOsoba, BirthDate: time.Now()}}
+	suite.mockUserCrudService.On("GetAllUsers", mock.MatchedBy(func(params *paging.Params) bool {
+		return params.Limit == 1 && params.Offset == 1 && params.Sort[0].Name == "email" && params.Sort[0].Desc
+	})).Return(users, &paging.Page{Total: 3, Limit: 1, Offset: 1, NextCursor: "next"}, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/all-users?limit=1&offset=1&sort=-email", nil)
+	req.Header.Set("Authorization", "Bearer "+superAdminToken)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "3", w.Header().Get("X-Total-Count"))
+	assert.Equal(suite.T(), "next", w.Header().Get("X-Next-Cursor"))
+	assert.Contains(suite.T(), w.Header().Get("Link"), `offset=2&sort=-email>; rel="next"`)
+	suite.mockUserCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *UserControllerTestSuite) TestGetAllUsersForSuperAdmin_InvalidQuery() {
+	superAdminToken := generateUserTestToken(uuid.New(), "super@admin.com", model.RoleSuperAdmin)
+
+	for _, query := range []string{"limit=1000", "sort=passwordHash", "residence=Zagreb"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/user/all-users?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+superAdminToken)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Code, query)
+	}
+	suite.mockUserCrudService.AssertNotCalled(suite.T(), "GetAllUsers", mock.Anything)
+}
+
 func (suite *UserControllerTestSuite) TestGetAllPoliceOfficers_Success() {
 	mupAdminToken := generateUserTestToken(uuid.New(), "mup@admin.com", model.RoleMupADMIN)
 	policeOfficers := []model.User{
-		{Uuid: uuid.New(), FirstName: "OfficerA", Role: model.RolePolicija, BirthDate: time.Now()},
-		{Uuid: uuid.New(), FirstName: "OfficerB", Role: model.RolePolicija, BirthDate: time.Now()},
+		{Model: gorm.Model{ID: 1}, Uuid: uuid.New(), FirstName: "OfficerA", Role: model.RolePolicija, BirthDate: time.Now()},
+		{Model: gorm.Model{ID: 2}, Uuid: uuid.New(), FirstName: "OfficerB", Role: model.RolePolicija, BirthDate: time.Now()},
 	}
-	suite.mockUserCrudService.On("GetAllPoliceOfficers").Return(policeOfficers, nil).Once()
+	suite.mockUserCrudService.On("GetAllPoliceOfficers", mock.Anything).Return(policeOfficers, &paging.Page{Total: 2, Limit: paging.DefaultLimit}, nil).Once()
+	suite.mockPoliceCodes.On("GetStatuses", []uint{1, 2}).Return(map[uint]model.PoliceActivationCode{
+		1: {Uuid: uuid.New(), Status: model.ActivationIssued, Attempts: 2, ExpiresAt: time.Now().Add(time.Hour)},
+	}, nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/user/police-officers", nil)
 	req.Header.Set("Authorization", "Bearer "+mupAdminToken)
@@ -394,22 +581,28 @@ func (suite *UserControllerTestSuite) TestGetAllPoliceOfficers_Success() {
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
-	var responseDtos []dto.UserDto
+	var responseDtos []dto.PoliceOfficerDto
 	err := json.Unmarshal(w.Body.Bytes(), &responseDtos)
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), responseDtos, 2)
 	assert.Equal(suite.T(), policeOfficers[0].FirstName, responseDtos[0].FirstName)
+	suite.Require().NotNil(responseDtos[0].Activation)
+	assert.Equal(suite.T(), "issued", responseDtos[0].Activation.Status)
+	assert.Equal(suite.T(), 2, responseDtos[0].Activation.Attempts)
+	assert.Nil(suite.T(), responseDtos[1].Activation)
 	suite.mockUserCrudService.AssertExpectations(suite.T())
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
 }
 
-func (suite *UserControllerTestSuite) TestSearchUsersByName_Success() {
+func (suite *UserControllerTestSuite) TestSearchUsers_Success() {
 	adminToken := generateUserTestToken(uuid.New(), "adminsearch@example.com", model.RoleSuperAdmin)
 	searchQuery := "John"
-	foundUsers := []model.User{
-		{Uuid: uuid.New(), FirstName: "John", LastName: "Doe", Role: model.RoleOsoba, BirthDate: time.Now()},
-		{Uuid: uuid.New(), FirstName: "Johnny", LastName: "Smith", Role: model.RoleFirma, BirthDate: time.Now()},
+	foundUsers := []service.UserWithScore{
+		{User: model.User{Uuid: uuid.New(), FirstName: "John", LastName: "Doe", Role: model.RoleOsoba, BirthDate: time.Now()}, Score: 1},
+		{User: model.User{Uuid: uuid.New(), FirstName: "Johnny", LastName: "Smith", Role: model.RoleFirma, BirthDate: time.Now()}, Score: 0.4},
 	}
-	suite.mockUserCrudService.On("SearchUsersByName", searchQuery).Return(foundUsers, nil).Once()
+	suite.mockUserCrudService.On("SearchUsers", searchQuery, service.SearchAll, mock.Anything).
+		Return(foundUsers, &paging.Page{Total: 2, Limit: paging.DefaultLimit}, nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/user/search?query="+searchQuery, nil)
 	req.Header.Set("Authorization", "Bearer "+adminToken)
@@ -418,15 +611,50 @@ func (suite *UserControllerTestSuite) TestSearchUsersByName_Success() {
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
-	var responseDtos []dto.UserDto
+	assert.Equal(suite.T(), "2", w.Header().Get("X-Total-Count"))
+	var responseDtos []dto.UserSearchResultDto
 	err := json.Unmarshal(w.Body.Bytes(), &responseDtos)
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), responseDtos, 2)
-	assert.Equal(suite.T(), foundUsers[0].FirstName, responseDtos[0].FirstName)
+	assert.Equal(suite.T(), foundUsers[0].User.FirstName, responseDtos[0].FirstName)
+	assert.Equal(suite.T(), 0.4, responseDtos[1].Score)
+	suite.mockUserCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *UserControllerTestSuite) TestSearchUsers_FieldAndPage() {
+	adminToken := generateUserTestToken(uuid.New(), "adminsearch@example.com", model.RoleSuperAdmin)
+	suite.mockUserCrudService.On("SearchUsers", "123", service.SearchOib, mock.MatchedBy(func(params *paging.Params) bool {
+		return params.Limit == 5 && params.Offset == 5
+	})).Return([]service.UserWithScore{}, &paging.Page{Total: 7, Limit: 5, Offset: 5}, nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/search?query=123&field=oib&limit=5&offset=5", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Header().Get("Link"), `rel="prev"`)
+	assert.NotContains(suite.T(), w.Header().Get("Link"), `rel="next"`)
+	suite.mockUserCrudService.AssertExpectations(suite.T())
+}
+
+func (suite *UserControllerTestSuite) TestSearchUsers_InvalidField() {
+	adminToken := generateUserTestToken(uuid.New(), "adminsearch@example.com", model.RoleSuperAdmin)
+	suite.mockUserCrudService.On("SearchUsers", "John", service.UserSearchField("password"), mock.Anything).
+		Return(nil, nil, fmt.Errorf("%w: can't search by %q", cerror.ErrInvalidQuery, "password")).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/search?query=John&field=password", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
-func (suite *UserControllerTestSuite) TestSearchUsersByName_EmptyQuery() {
+func (suite *UserControllerTestSuite) TestSearchUsers_EmptyQuery() {
 	adminToken := generateUserTestToken(uuid.New(), "adminsearch@example.com", model.RoleSuperAdmin)
 	req, _ := http.NewRequest(http.MethodGet, "/api/user/search?query=", nil) // Empty query
 	req.Header.Set("Authorization", "Bearer "+adminToken)
@@ -439,7 +667,7 @@ func (suite *UserControllerTestSuite) TestSearchUsersByName_EmptyQuery() {
 
 func (suite *UserControllerTestSuite) TestGetUserByOib_Success() {
 	hakToken := generateUserTestToken(uuid.New(), "hak@example.com", model.RoleHAK)
-	targetOIB := "11223344556"
+	targetOIB := "11223344553"
 	expectedUser := &model.User{
 		Uuid: uuid.New(), FirstName: "OIB", LastName: "User", Role: model.RoleOsoba,
 		BirthDate: time.Now().AddDate(-30, 0, 0), OIB: targetOIB, Email: "oib.user@example.com",
@@ -461,9 +689,24 @@ func (suite *UserControllerTestSuite) TestGetUserByOib_Success() {
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
+func (suite *UserControllerTestSuite) TestGetUserByOib_PoliceMustSign() {
+	config.AppConfig.DeviceSignatures = true
+	defer func() { config.AppConfig.DeviceSignatures = false }()
+	policeToken := generateUserTestToken(uuid.New(), "officer@example.com", model.RolePolicija)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/oib/11223344553", nil)
+	req.Header.Set("Authorization", "Bearer "+policeToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Device signature required")
+	suite.mockUserCrudService.AssertNotCalled(suite.T(), "GetUserByOIB", mock.Anything)
+}
+
 func (suite *UserControllerTestSuite) TestGetUserByOib_NotFound() {
 	hakToken := generateUserTestToken(uuid.New(), "hak@example.com", model.RoleHAK)
-	targetOIB := "00000000000" // Non-existent OIB
+	targetOIB := "00000000001" // Non-existent OIB
 	suite.mockUserCrudService.On("GetUserByOIB", targetOIB).Return(nil, gorm.ErrRecordNotFound).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/user/oib/"+targetOIB, nil)
@@ -475,21 +718,30 @@ func (suite *UserControllerTestSuite) TestGetUserByOib_NotFound() {
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
+func (suite *UserControllerTestSuite) TestGetUserByOib_InvalidChecksum() {
+	hakToken := generateUserTestToken(uuid.New(), "hak@example.com", model.RoleHAK)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/oib/11223344556", nil)
+	req.Header.Set("Authorization", "Bearer "+hakToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	var responseDto dto.ValidationErrorDto
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &responseDto))
+	suite.Require().Len(responseDto.Violations, 1)
+	assert.Equal(suite.T(), "oib", responseDto.Violations[0].Field)
+	suite.mockUserCrudService.AssertNotCalled(suite.T(), "GetUserByOIB", mock.Anything)
+}
+
 func (suite *UserControllerTestSuite) TestGeneratePoliceToken_Success() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
-	policeUser := &model.User{
-		Uuid: targetUserUUID, FirstName: "Officer", LastName: "Test", Role: model.RolePolicija,
-		BirthDate: time.Now().AddDate(-25, 0, 0), OIB: "POLICE00100", Email: "officer.test@example.com",
-	}
 
-	// Mock UserCrud.Read to return the police user
-	suite.mockUserCrudService.On("Read", targetUserUUID).Return(policeUser, nil).Once()
-	// Mock UserCrud.Update to simulate saving the user with the new token
-	// We expect the policeToken field to be non-nil and have a length of 8 after generation.
-	suite.mockUserCrudService.On("Update", targetUserUUID, mock.MatchedBy(func(u *model.User) bool {
-		return u.Uuid == targetUserUUID && u.PoliceToken != nil && len(*u.PoliceToken) == 8
-	})).Return(policeUser, nil).Once() // The returned user here would have the token
+	suite.mockPoliceCodes.On("Issue", targetUserUUID, adminUUID).
+		Return("ABCDEFGHJKLM", &model.PoliceActivationCode{Status: model.ActivationIssued, ExpiresAt: time.Now().Add(time.Hour)}, nil).
+		Once()
 
 	req, _ := http.NewRequest(http.MethodPost, "/api/user/"+targetUserUUID.String()+"/generate-token", nil)
 	req.Header.Set("Authorization", "Bearer "+adminToken)
@@ -501,16 +753,18 @@ func (suite *UserControllerTestSuite) TestGeneratePoliceToken_Success() {
 	var response map[string]string
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.NotEmpty(suite.T(), response["token"])
-	assert.Len(suite.T(), response["token"], 8)
-	suite.mockUserCrudService.AssertExpectations(suite.T())
+	assert.Equal(suite.T(), "ABCDEFGHJKLM", response["token"])
+	assert.NotEmpty(suite.T(), response["expiresAt"])
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
+	suite.mockUserCrudService.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything)
 }
 
 func (suite *UserControllerTestSuite) TestGeneratePoliceToken_UserNotFound() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
 
-	suite.mockUserCrudService.On("Read", targetUserUUID).Return(nil, gorm.ErrRecordNotFound).Once()
+	suite.mockPoliceCodes.On("Issue", targetUserUUID, adminUUID).Return("", nil, gorm.ErrRecordNotFound).Once()
 
 	req, _ := http.NewRequest(http.MethodPost, "/api/user/"+targetUserUUID.String()+"/generate-token", nil)
 	req.Header.Set("Authorization", "Bearer "+adminToken)
@@ -519,18 +773,15 @@ func (suite *UserControllerTestSuite) TestGeneratePoliceToken_UserNotFound() {
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
-	suite.mockUserCrudService.AssertExpectations(suite.T())
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
 }
 
 func (suite *UserControllerTestSuite) TestGeneratePoliceToken_NotPoliceRole() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
-	nonPoliceUser := &model.User{
-		Uuid: targetUserUUID, FirstName: "Civilian", LastName: "Test", Role: model.RoleOsoba,
-	}
 
-	suite.mockUserCrudService.On("Read", targetUserUUID).Return(nonPoliceUser, nil).Once()
-	// Update should not be called if role is not police
+	suite.mockPoliceCodes.On("Issue", targetUserUUID, adminUUID).Return("", nil, cerror.ErrNotPoliceOfficer).Once()
 
 	req, _ := http.NewRequest(http.MethodPost, "/api/user/"+targetUserUUID.String()+"/generate-token", nil)
 	req.Header.Set("Authorization", "Bearer "+adminToken)
@@ -540,21 +791,18 @@ func (suite *UserControllerTestSuite) TestGeneratePoliceToken_NotPoliceRole() {
 
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 	assert.Contains(suite.T(), w.Body.String(), "Police token can only be generated for police officers")
-	suite.mockUserCrudService.AssertExpectations(suite.T())
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
 }
 
 func (suite *UserControllerTestSuite) TestSetPoliceToken_Success() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
-	policeUser := &model.User{
-		Uuid: targetUserUUID, FirstName: "OfficerSet", LastName: "Token", Role: model.RolePolicija,
-	}
-	tokenToSet := "SETTOKEN"
+	tokenToSet := "SETTOKEN42"
 
-	suite.mockUserCrudService.On("Read", targetUserUUID).Return(policeUser, nil).Once()
-	suite.mockUserCrudService.On("Update", targetUserUUID, mock.MatchedBy(func(u *model.User) bool {
-		return u.Uuid == targetUserUUID && u.PoliceToken != nil && *u.PoliceToken == tokenToSet
-	})).Return(policeUser, nil).Once()
+	suite.mockPoliceCodes.On("Set", targetUserUUID, tokenToSet, adminUUID).
+		Return(&model.PoliceActivationCode{Status: model.ActivationIssued}, nil).
+		Once()
 
 	tokenPayload := fmt.Sprintf(`{"police_token": "%s"}`, tokenToSet)
 	req, _ := http.NewRequest(http.MethodPatch, "/api/user/"+targetUserUUID.String()+"/police-token", strings.NewReader(tokenPayload))
@@ -565,15 +813,34 @@ func (suite *UserControllerTestSuite) TestSetPoliceToken_Success() {
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
-	suite.mockUserCrudService.AssertExpectations(suite.T())
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
+}
+
+func (suite *UserControllerTestSuite) TestSetPoliceToken_TooShort() {
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
+	targetUserUUID := uuid.New()
+
+	suite.mockPoliceCodes.On("Set", targetUserUUID, "SHORT", adminUUID).Return(nil, cerror.ErrWeakActivationCode).Once()
+
+	req, _ := http.NewRequest(http.MethodPatch, "/api/user/"+targetUserUUID.String()+"/police-token", strings.NewReader(`{"police_token": "SHORT"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
 }
 
 func (suite *UserControllerTestSuite) TestSetPoliceToken_UserNotFound() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
-	tokenToSet := "ANYTOKEN"
+	tokenToSet := "ANYTOKEN42"
 
-	suite.mockUserCrudService.On("Read", targetUserUUID).Return(nil, gorm.ErrRecordNotFound).Once()
+	suite.mockPoliceCodes.On("Set", targetUserUUID, tokenToSet, adminUUID).Return(nil, gorm.ErrRecordNotFound).Once()
 
 	tokenPayload := fmt.Sprintf(`{"police_token": "%s"}`, tokenToSet)
 	req, _ := http.NewRequest(http.MethodPatch, "/api/user/"+targetUserUUID.String()+"/police-token", strings.NewReader(tokenPayload))
@@ -584,18 +851,16 @@ func (suite *UserControllerTestSuite) TestSetPoliceToken_UserNotFound() {
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
-	suite.mockUserCrudService.AssertExpectations(suite.T())
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
 }
 
 func (suite *UserControllerTestSuite) TestSetPoliceToken_NotPoliceRole() {
-	adminToken := generateUserTestToken(uuid.New(), "admin@example.com", model.RoleMupADMIN)
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
 	targetUserUUID := uuid.New()
-	nonPoliceUser := &model.User{
-		Uuid: targetUserUUID, FirstName: "CivilianSet", LastName: "Token", Role: model.RoleOsoba,
-	}
-	tokenToSet := "ANYTOKEN"
+	tokenToSet := "ANYTOKEN42"
 
-	suite.mockUserCrudService.On("Read", targetUserUUID).Return(nonPoliceUser, nil).Once()
+	suite.mockPoliceCodes.On("Set", targetUserUUID, tokenToSet, adminUUID).Return(nil, cerror.ErrNotPoliceOfficer).Once()
 
 	tokenPayload := fmt.Sprintf(`{"police_token": "%s"}`, tokenToSet)
 	req, _ := http.NewRequest(http.MethodPatch, "/api/user/"+targetUserUUID.String()+"/police-token", strings.NewReader(tokenPayload))
@@ -607,7 +872,24 @@ func (suite *UserControllerTestSuite) TestSetPoliceToken_NotPoliceRole() {
 
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 	assert.Contains(suite.T(), w.Body.String(), "Police token can only be set for police officers")
-	suite.mockUserCrudService.AssertExpectations(suite.T())
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
+}
+
+func (suite *UserControllerTestSuite) TestRevokePoliceToken() {
+	adminUUID := uuid.New()
+	adminToken := generateUserTestToken(adminUUID, "admin@example.com", model.RoleMupADMIN)
+	targetUserUUID := uuid.New()
+
+	suite.mockPoliceCodes.On("Revoke", targetUserUUID, adminUUID).Return(nil).Once()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/api/user/"+targetUserUUID.String()+"/police-token", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Code)
+	suite.mockPoliceCodes.AssertExpectations(suite.T())
 }
 
 func (suite *UserControllerTestSuite) TestSetPoliceToken_BindingError() {
@@ -624,8 +906,7 @@ func (suite *UserControllerTestSuite) TestSetPoliceToken_BindingError() {
 
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 	// No service calls expected due to binding error
-	suite.mockUserCrudService.AssertNotCalled(suite.T(), "Read", mock.Anything)
-	suite.mockUserCrudService.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything)
+	suite.mockPoliceCodes.AssertNotCalled(suite.T(), "Set", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func (suite *UserControllerTestSuite) TestGetLoggedInUserDevice_Success() {
@@ -643,7 +924,7 @@ func (suite *UserControllerTestSuite) TestGetLoggedInUserDevice_Success() {
 		LastName:  "User",
 		Role:      loggedInUserRole,
 		BirthDate: time.Now().AddDate(-20, 0, 0),
-		OIB:       "55566677788",
+		OIB:       "55566677789",
 		Email:     loggedInUserEmail,
 	}
 
@@ -664,11 +945,12 @@ func (suite *UserControllerTestSuite) TestGetLoggedInUserDevice_Success() {
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(suite.T(), http.StatusOK, w.Code)
-	var responseDevice model.Mobile
+	var responseDevice dto.MobileDto
 	err := json.Unmarshal(w.Body.Bytes(), &responseDevice)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), expectedDevice.Uuid, responseDevice.Uuid)
+	assert.Equal(suite.T(), expectedDevice.Uuid.String(), responseDevice.Uuid)
 	assert.Equal(suite.T(), expectedDevice.RegisteredDevice, responseDevice.RegisteredDevice)
+	assert.NotContains(suite.T(), w.Body.String(), expectedDevice.ActivationToken)
 	suite.mockUserCrudService.AssertExpectations(suite.T())
 }
 
@@ -687,7 +969,7 @@ func (suite *UserControllerTestSuite) TestGetLoggedInUserDevice_NoDevice() {
 		LastName:  "Device",
 		Role:      loggedInUserRole,
 		BirthDate: time.Now().AddDate(-20, 0, 0),
-		OIB:       "99988877766",
+		OIB:       "99988877762",
 		Email:     loggedInUserEmail,
 	}
 
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"bytes"
+	"ePrometna_Server/app"
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/i18n"
+	"ePrometna_Server/util/middleware"
+	"ePrometna_Server/util/sheet"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxImportFileSize is the largest sheet accepted by the import
+	maxImportFileSize = 5 << 20
+	// maxImportRows is the most users one sheet can add
+	maxImportRows = 1000
+)
+
+type UserImportController struct {
+	importService service.IUserImportService
+	logger        *zap.SugaredLogger
+}
+
+func NewUserImportController() *UserImportController {
+	var controller *UserImportController
+	app.Invoke(func(importService service.IUserImportService, logger *zap.SugaredLogger) {
+		controller = &UserImportController{
+			importService: importService,
+			logger:        logger,
+		}
+	})
+	return controller
+}
+
+func (c *UserImportController) RegisterEndpoints(api *gin.RouterGroup) {
+	// create a group with the name of the router
+	group := api.Group("/user")
+
+	// register Endpoints
+	group.POST("/import", middleware.Protect(model.PermUserManage), c.importUsers)
+}
+
+// importUsers godoc
+//
+//	@Summary		Import users
+//	@Description	Creates the users of a CSV or XLSX sheet with the columns firstName, lastName, oib,
+//	@Description	street, houseNumber, postalCode, settlement, birthDate, email and role in the header row. Every row is validated first,
+//	@Description	nothing is created if it is a dry run or any row has errors. Imported police officers
+//	@Description	are issued activation codes, with format=csv they are returned as a CSV sheet.
+//	@Tags			user
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"CSV or XLSX sheet"
+//	@Param			dryRun	query		bool	false	"Only validate the sheet"
+//	@Param			format	query		string	false	"csv to download the activation codes"
+//	@Success		200		{object}	dto.UserImportReportDto	"Dry run"
+//	@Success		201		{object}	dto.UserImportReportDto
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		413
+//	@Failure		422	{object}	dto.UserImportReportDto
+//	@Failure		500
+//	@Router			/user/import [post]
+func (c *UserImportController) importUsers(ctx *gin.Context) {
+	adminUuid, ok := loggedInUuid(ctx)
+	if !ok {
+		return
+	}
+	dryRun := ctx.Query("dryRun") == "true"
+
+	data, err := c.readFile(ctx)
+	if err != nil {
+		return
+	}
+
+	cells, err := sheet.Read(data)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := dto.UserImportRowsFromSheet(cells, maxImportRows)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := c.importService.Import(rows, adminUuid, dryRun)
+	if err != nil {
+		c.logger.Errorf("Failed to import users err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	report := importReport(i18n.Language(ctx.GetHeader("Accept-Language")), rows, created, dryRun)
+	switch {
+	case len(report.Errors) > 0:
+		ctx.JSON(http.StatusUnprocessableEntity, report)
+	case dryRun:
+		ctx.JSON(http.StatusOK, report)
+	case ctx.Query("format") == "csv":
+		c.sendCodes(ctx, report.ActivationCodes)
+	default:
+		ctx.JSON(http.StatusCreated, report)
+	}
+}
+
+// readFile reads the uploaded sheet, it aborts the request on failure
+func (c *UserImportController) readFile(ctx *gin.Context) ([]byte, error) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportFileSize)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ctx.AbortWithError(http.StatusRequestEntityTooLarge, err)
+		} else {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+		}
+		return nil, err
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.logger.Errorf("Failed to open uploaded sheet err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.logger.Errorf("Failed to read uploaded sheet err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// sendCodes responds with the issued activation codes as a CSV attachment
+func (c *UserImportController) sendCodes(ctx *gin.Context, codes []dto.ImportedCodeDto) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(dto.ImportedCodeSheetHeader)
+	for _, code := range codes {
+		writer.Write(code.SheetRow())
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		c.logger.Errorf("Failed to write activation codes err = %+v", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("activation-codes-%s.csv", time.Now().Format("20060102-150405"))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	ctx.Data(http.StatusCreated, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// importReport returns the report of the imported rows with localized errors
+func importReport(lang string, rows []model.UserImportRow, created int, dryRun bool) dto.UserImportReportDto {
+	report := dto.UserImportReportDto{
+		DryRun:          dryRun,
+		Total:           len(rows),
+		Created:         created,
+		Errors:          []dto.UserImportErrorDto{},
+		ActivationCodes: []dto.ImportedCodeDto{},
+	}
+	for i := range rows {
+		row := &rows[i]
+		if len(row.Errors) == 0 {
+			report.Valid++
+		}
+		for _, fieldErr := range row.Errors {
+			report.Errors = append(report.Errors, dto.UserImportErrorDto{
+				Row:          row.Line,
+				ViolationDto: violation(lang, fieldErr),
+			})
+		}
+		if row.ActivationCode != "" {
+			report.ActivationCodes = append(report.ActivationCodes, dto.ImportedCodeDto{}.FromModel(row))
+		}
+	}
+	return report
+}
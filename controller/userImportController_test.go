@@ -0,0 +1,187 @@
+package controller_test
+
+import (
+	"bytes"
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/controller"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type MockUserImportService struct {
+	mock.Mock
+}
+
+func (m *MockUserImportService) Import(rows []model.UserImportRow, adminUuid uuid.UUID, dryRun bool) (int, error) {
+	args := m.Called(rows, adminUuid, dryRun)
+	return args.Int(0), args.Error(1)
+}
+
+const importSheet = "firstName;lastName;oib;street;houseNumber;postalCode;settlement;birthDate;email;role\n" +
+	"Ivan;Horvat;69435151530;Ilica;1;10000;Zagreb;20.03.1995.;ivan@example.com;policija\n" +
+	"Ana;Kovač;94577403194;Riva;10;21000;Split;1990-01-01;ana@example.com;osoba\n"
+
+type UserImportControllerTestSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	mockSvc    *MockUserImportService
+	admin      *model.User
+	adminToken string
+	userToken  string
+}
+
+func (suite *UserImportControllerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "user-import-ctrl-test-access-key",
+		RefreshKey: "user-import-ctrl-test-refresh-key",
+	}
+
+	suite.mockSvc = new(MockUserImportService)
+	app.Test()
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(func() service.IUserImportService { return suite.mockSvc })
+
+	suite.router = gin.New()
+	controller.NewUserImportController().RegisterEndpoints(suite.router.Group("/api"))
+
+	suite.admin = &model.User{Uuid: uuid.New(), Role: model.RoleMupADMIN}
+	token, _, err := auth.GenerateTokens(suite.admin)
+	suite.Require().NoError(err)
+	suite.adminToken = "Bearer " + token
+
+	token, _, err = auth.GenerateTokens(&model.User{Uuid: uuid.New(), Role: model.RoleOsoba})
+	suite.Require().NoError(err)
+	suite.userToken = "Bearer " + token
+}
+
+func (suite *UserImportControllerTestSuite) SetupTest() {
+	suite.mockSvc.ExpectedCalls = nil
+	suite.mockSvc.Calls = nil
+}
+
+func TestUserImportController(t *testing.T) {
+	suite.Run(t, new(UserImportControllerTestSuite))
+}
+
+func (suite *UserImportControllerTestSuite) upload(query, token, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "users.csv")
+	suite.Require().NoError(err)
+	part.Write([]byte(content))
+	suite.Require().NoError(writer.Close())
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/import"+query, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// issueCodes imitates the service issuing a code to every officer
+func issueCodes(args mock.Arguments) {
+	rows := args.Get(0).([]model.UserImportRow)
+	for i := range rows {
+		if rows[i].User.Role == model.RolePolicija {
+			rows[i].ActivationCode = "ABCD-EFGH-JKLM"
+			rows[i].ActivationExpiresAt = time.Now().Add(time.Hour)
+		}
+	}
+}
+
+func (suite *UserImportControllerTestSuite) TestImport() {
+	suite.mockSvc.On("Import", mock.Anything, suite.admin.Uuid, false).Run(issueCodes).Return(2, nil).Once()
+
+	w := suite.upload("", suite.adminToken, importSheet)
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var body map[string]any
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), float64(2), body["total"])
+	assert.Equal(suite.T(), float64(2), body["valid"])
+	assert.Equal(suite.T(), float64(2), body["created"])
+	codes := body["activationCodes"].([]any)
+	suite.Require().Len(codes, 1)
+	assert.Equal(suite.T(), "ABCD-EFGH-JKLM", codes[0].(map[string]any)["code"])
+	assert.Equal(suite.T(), "ivan@example.com", codes[0].(map[string]any)["email"])
+}
+
+func (suite *UserImportControllerTestSuite) TestImport_CodeSheet() {
+	suite.mockSvc.On("Import", mock.Anything, suite.admin.Uuid, false).Run(issueCodes).Return(2, nil).Once()
+
+	w := suite.upload("?format=csv", suite.adminToken, importSheet)
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	assert.Contains(suite.T(), w.Header().Get("Content-Disposition"), "attachment; filename=\"activation-codes-")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	suite.Require().Len(lines, 2)
+	assert.Equal(suite.T(), "row,uuid,email,firstName,lastName,code,expiresAt", lines[0])
+	assert.Contains(suite.T(), lines[1], "ABCD-EFGH-JKLM")
+}
+
+func (suite *UserImportControllerTestSuite) TestImport_DryRun() {
+	suite.mockSvc.On("Import", mock.Anything, suite.admin.Uuid, true).Return(0, nil).Once()
+
+	w := suite.upload("?dryRun=true", suite.adminToken, importSheet)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"dryRun":true`)
+}
+
+func (suite *UserImportControllerTestSuite) TestImport_RowErrors() {
+	suite.mockSvc.On("Import", mock.Anything, suite.admin.Uuid, false).Run(func(args mock.Arguments) {
+		rows := args.Get(0).([]model.UserImportRow)
+		rows[1].Errors = append(rows[1].Errors, &cerror.FieldError{Field: "email", Err: cerror.ErrEmailTaken})
+	}).Return(0, nil).Once()
+
+	sheet := importSheet + "Marko;Babić;12345678900;Europska avenija;2;31000;Osijek;1990-01-01;marko@example.com;osoba\n"
+	w := suite.upload("", suite.adminToken, sheet)
+
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	var body struct {
+		Valid  int `json:"valid"`
+		Errors []struct {
+			Row   int    `json:"row"`
+			Field string `json:"field"`
+			Code  string `json:"code"`
+		} `json:"errors"`
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(suite.T(), 1, body.Valid)
+	suite.Require().Len(body.Errors, 2)
+	assert.Equal(suite.T(), 3, body.Errors[0].Row)
+	assert.Equal(suite.T(), "email_taken", body.Errors[0].Code)
+	assert.Equal(suite.T(), 4, body.Errors[1].Row)
+	assert.Equal(suite.T(), "oib", body.Errors[1].Field)
+	assert.Equal(suite.T(), "invalid_oib", body.Errors[1].Code)
+}
+
+func (suite *UserImportControllerTestSuite) TestImport_Rejected() {
+	w := suite.upload("", suite.adminToken, "name,email\nIvan,ivan@example.com\n")
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = suite.upload("", suite.userToken, importSheet)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	suite.mockSvc.AssertNotCalled(suite.T(), "Import", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"ePrometna_Server/dto"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/i18n"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// violationCodes are the codes of field validation errors, messages are
+// localized with the validation.<code> key
+var violationCodes = map[error]string{
+	cerror.ErrInvalidOib:       "invalid_oib",
+	cerror.ErrInvalidBirthDate: "invalid_birth_date",
+	cerror.ErrInvalidEmail:     "invalid_email",
+	cerror.ErrEmailTaken:       "email_taken",
+	cerror.ErrOibTaken:         "oib_taken",
+	cerror.ErrUnknownRole:      "unknown_role",
+	cerror.ErrUnknownOrgRole:   "unknown_role",
+	cerror.ErrBadRole:          "role_not_allowed",
+	cerror.ErrBadDateFormat:    "bad_date",
+	cerror.ErrRequired:         "required",
+	cerror.ErrBadPostalCode:    "bad_postal_code",
+	cerror.ErrBadSettlement:    "bad_settlement",
+}
+
+// abortValidation responds with 422 and localized violations if err has
+// field validation errors
+func abortValidation(ctx *gin.Context, err error) bool {
+	fieldErrs := cerror.FieldErrors(err)
+	if len(fieldErrs) == 0 {
+		return false
+	}
+
+	lang := i18n.Language(ctx.GetHeader("Accept-Language"))
+	violations := make([]dto.ViolationDto, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		violations = append(violations, violation(lang, fieldErr))
+	}
+
+	ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, dto.ValidationErrorDto{
+		Error:      i18n.T(lang, "validation.failed"),
+		Violations: violations,
+	})
+	return true
+}
+
+// violation returns the code and localized message of a field error
+func violation(lang string, fieldErr *cerror.FieldError) dto.ViolationDto {
+	code, ok := violationCodes[fieldErr.Err]
+	message := i18n.T(lang, "validation."+code)
+	if !ok {
+		code, message = "invalid", fieldErr.Err.Error()
+	}
+	return dto.ViolationDto{
+		Field:   fieldErr.Field,
+		Code:    code,
+		Message: message,
+	}
+}
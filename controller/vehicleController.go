@@ -5,7 +5,6 @@ import (
 	"ePrometna_Server/dto"
 	"ePrometna_Server/model"
 	"ePrometna_Server/service"
-	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/middleware"
 	"errors"
@@ -19,14 +18,16 @@ import (
 
 type VehicleController struct {
 	VehicleService service.IVehicleService
+	AccessPolicy   service.IAccessPolicyService
 	logger         *zap.SugaredLogger
 }
 
 func NewVehicleController() *VehicleController {
 	var controller *VehicleController
-	app.Invoke(func(vehicleService service.IVehicleService, logger *zap.SugaredLogger) {
+	app.Invoke(func(vehicleService service.IVehicleService, accessPolicy service.IAccessPolicyService, logger *zap.SugaredLogger) {
 		controller = &VehicleController{
 			VehicleService: vehicleService,
+			AccessPolicy:   accessPolicy,
 			logger:         logger,
 		}
 	})
@@ -37,22 +38,17 @@ func (c *VehicleController) RegisterEndpoints(api *gin.RouterGroup) {
 	group := api.Group("/vehicle")
 
 	// Publicly accessible or role-specific GETs
-	group.GET("/:uuid", middleware.Protect(model.RoleHAK, model.RoleFirma, model.RoleOsoba, model.RolePolicija), c.get)
-	group.GET("/", middleware.Protect(model.RoleFirma, model.RoleOsoba), c.myVehicles)
-	group.GET("/vin/:vin", middleware.Protect(model.RoleHAK, model.RoleFirma, model.RoleOsoba), c.getByVin)
-
-	// Endpoints requiring HAK role
-	// Create a new sub-group for HAK specific middleware
-	hakGroup := group.Group("")
-	hakGroup.Use(middleware.Protect(model.RoleHAK))
-	{
-		hakGroup.POST("/", c.create)
-		hakGroup.PUT("/:uuid", c.update)
-		hakGroup.DELETE("/:uuid", c.delete)
-		hakGroup.PUT("/change-owner", c.changeOwner)
-		hakGroup.PUT("/registration/:uuid", c.registration)
-		hakGroup.PUT("/deregister/:uuid", c.deregister)
-	}
+	group.GET("/:uuid", middleware.Protect(model.PermVehicleRead), c.get)
+	group.GET("/", middleware.Protect(model.PermVehicleReadOwn), c.myVehicles)
+	group.GET("/vin/:vin", middleware.Protect(model.PermVehicleReadVin), c.getByVin)
+
+	// Endpoints for HAK
+	group.POST("/", middleware.Protect(model.PermVehicleManage), c.create)
+	group.PUT("/:uuid", middleware.Protect(model.PermVehicleManage), c.update)
+	group.DELETE("/:uuid", middleware.Protect(model.PermVehicleManage), c.delete)
+	group.PUT("/change-owner", middleware.Protect(model.PermVehicleManage), c.changeOwner)
+	group.PUT("/registration/:uuid", middleware.Protect(model.PermVehicleRegister), c.registration)
+	group.PUT("/deregister/:uuid", middleware.Protect(model.PermVehicleRegister), c.deregister)
 }
 
 // DeleteVehicle godoc
@@ -154,6 +150,7 @@ func (v *VehicleController) create(c *gin.Context) {
 //	@Produce	json
 //	@Success	200	{object}	dto.VehicleDetailsDto
 //	@Failure	400
+//	@Failure	403
 //	@Failure	404
 //	@Failure	500
 //	@Param		uuid	path	string	true	"Vehicle UUID"
@@ -178,6 +175,10 @@ func (v *VehicleController) get(c *gin.Context) {
 		return
 	}
 
+	if !v.canView(c, vehicle) {
+		return
+	}
+
 	var detailsDto dto.VehicleDetailsDto
 	c.JSON(http.StatusOK, detailsDto.FromModel(vehicle))
 }
@@ -186,8 +187,16 @@ func (v *VehicleController) get(c *gin.Context) {
 //
 //	@Summary	Gets your vehicles
 //	@Schemes
+//	@Description	Fetches a page of your vehicles. Filters: mark and model (also [contains]),
+//	@Description	vehicleType, vehicleCategory and createdAt (also [gte] and [lte]).
 //	@Tags		vehicle
 //	@Produce	json
+//	@Param		limit	query	int		false	"Page size, at most 100"
+//	@Param		offset	query	int		false	"Rows to skip, can't be used with cursor"
+//	@Param		cursor	query	string	false	"X-Next-Cursor of the previous page"
+//	@Param		sort	query	string	false	"Comma separated fields, - sorts descending"
+//	@Header		200		{int}		X-Total-Count	"Number of rows matching the filters"
+//	@Header		200		{string}	Link		"Links to the first, previous, next and last page"
 //	@Success	200	{object}	[]dto.VehicleDto
 //	@Failure	400
 //	@Failure	401
@@ -195,26 +204,27 @@ func (v *VehicleController) get(c *gin.Context) {
 //	@Failure	500
 //	@Router		/vehicle [get]
 func (v *VehicleController) myVehicles(c *gin.Context) {
-	_, claims, err := auth.ParseToken(c.Request.Header.Get("Authorization"))
-	if err != nil {
-		v.logger.Errorf("Failed to parse token: %v", err)
-		c.AbortWithError(http.StatusUnauthorized, err)
+	userUuid, ok := loggedInUuid(c)
+	if !ok {
 		return
 	}
-	userUuid, err := uuid.Parse(claims.Uuid)
-	if err != nil {
-		v.logger.Errorf("Failed to parse uuid from token claims = %s, err + %+v", claims.Uuid, err)
-		c.AbortWithError(http.StatusBadRequest, err)
+
+	params, ok := bindPaging(c, service.VehicleListSpec)
+	if !ok {
 		return
 	}
 
-	vehicles, err := v.VehicleService.ReadAll(userUuid)
+	vehicles, page, err := v.VehicleService.ReadAll(userUuid, params)
 	if err != nil {
+		if abortInvalidQuery(c, err) {
+			return
+		}
 		v.logger.Errorf("Failed to read vehicles for user %s: %+v", userUuid, err)
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 	var dtos dto.VehiclesDto
+	setPageHeaders(c, page)
 	c.JSON(http.StatusOK, dtos.FromModel(vehicles))
 }
 
@@ -333,6 +343,7 @@ func (v *VehicleController) registration(c *gin.Context) {
 //	@Produce	json
 //	@Success	200	{object}	dto.VehicleDetailsDto
 //	@Failure	400	{object}	object{error=string}	"Invalid request"
+//	@Failure	403	{object}	object{error=string}	"Not owner or driver of the vehicle"
 //	@Failure	404	{object}	object{error=string}	"Vehicle not found"
 //	@Failure	500	{object}	object{error=string}	"Internal server error"
 //	@Param		vin	path		string					true	"Vehicle VIN number"
@@ -357,6 +368,10 @@ func (v *VehicleController) getByVin(c *gin.Context) {
 		return
 	}
 
+	if !v.canView(c, vehicle) {
+		return
+	}
+
 	var detailsDto dto.VehicleDetailsDto
 	c.JSON(http.StatusOK, detailsDto.FromModel(vehicle))
 }
@@ -450,3 +465,21 @@ func (v *VehicleController) update(c *gin.Context) {
 	var respDto dto.VehicleDto
 	c.JSON(http.StatusCreated, respDto.FromModel(createdVehicle))
 }
+
+// canView aborts the request if the logged in user may not see the vehicle
+func (v *VehicleController) canView(c *gin.Context, vehicle *model.Vehicle) bool {
+	claims, ok := loggedInClaims(c)
+	if !ok {
+		return false
+	}
+
+	if err := v.AccessPolicy.CanViewVehicle(claims, vehicle); err != nil {
+		if abortForbidden(c, err) {
+			return false
+		}
+		v.logger.Errorf("Failed to check access to vehicle %s: %+v", vehicle.Uuid, err)
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
@@ -10,6 +10,7 @@ import (
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,6 +29,41 @@ import (
 	"gorm.io/gorm"
 )
 
+// --- Mock AccessPolicyService ---
+type MockAccessPolicyService struct {
+	mock.Mock
+}
+
+func (m *MockAccessPolicyService) CanViewVehicle(claims *auth.Claims, vehicle *model.Vehicle) error {
+	args := m.Called(claims, vehicle)
+	return args.Error(0)
+}
+
+func (m *MockAccessPolicyService) CanDriveVehicle(claims *auth.Claims, vehicle *model.Vehicle) error {
+	args := m.Called(claims, vehicle)
+	return args.Error(0)
+}
+
+func (m *MockAccessPolicyService) CanViewLicense(claims *auth.Claims, license *model.DriverLicense) error {
+	args := m.Called(claims, license)
+	return args.Error(0)
+}
+
+func (m *MockAccessPolicyService) CanManageLicense(claims *auth.Claims, license *model.DriverLicense) error {
+	args := m.Called(claims, license)
+	return args.Error(0)
+}
+
+func (m *MockAccessPolicyService) CanViewOrganisation(claims *auth.Claims, organisation *model.Organisation) error {
+	args := m.Called(claims, organisation)
+	return args.Error(0)
+}
+
+func (m *MockAccessPolicyService) CanManageMember(claims *auth.Claims, organisation *model.Organisation, role model.OrganisationRole) error {
+	args := m.Called(claims, organisation, role)
+	return args.Error(0)
+}
+
 // --- Mock VehicleService ---
 type MockVehicleService struct {
 	mock.Mock
@@ -58,12 +94,16 @@ func (m *MockVehicleService) Read(id uuid.UUID) (*model.Vehicle, error) {
 	return args.Get(0).(*model.Vehicle), args.Error(1)
 }
 
-func (m *MockVehicleService) ReadAll(driverUuid uuid.UUID) ([]model.Vehicle, error) {
-	args := m.Called(driverUuid)
+func (m *MockVehicleService) ReadAll(driverUuid uuid.UUID, params *paging.Params) ([]model.Vehicle, *paging.Page, error) {
+	args := m.Called(driverUuid, params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, page, args.Error(2)
 	}
-	return args.Get(0).([]model.Vehicle), args.Error(1)
+	return args.Get(0).([]model.Vehicle), page, args.Error(2)
 }
 
 func (m *MockVehicleService) Delete(id uuid.UUID) error {
@@ -98,6 +138,7 @@ func (m *MockVehicleService) Deregister(vehicleUuid uuid.UUID) error {
 var (
 	testSugarLogger    *zap.SugaredLogger
 	mockVehicleService *MockVehicleService
+	mockAccessPolicy   *MockAccessPolicyService
 	testRouter         *gin.Engine
 )
 
@@ -120,11 +161,13 @@ func setupTestEnvironment() {
 	}
 
 	mockVehicleService = new(MockVehicleService)
+	mockAccessPolicy = new(MockAccessPolicyService)
 
 	// Setup DIG
 	app.Test() // Initialize the container
 	app.Provide(func() *zap.SugaredLogger { return testSugarLogger })
 	app.Provide(func() service.IVehicleService { return mockVehicleService }) // Provide the mock
+	app.Provide(func() service.IAccessPolicyService { return mockAccessPolicy })
 
 	// Create router and register controller
 	testRouter = gin.Default()
@@ -319,6 +362,9 @@ func TestGetVehicle_Controller_Success(t *testing.T) {
 		RegistrationID: func(id uint) *uint { return &id }(1),
 	}
 	mockVehicleService.On("Read", vehicleUUID).Return(expectedVehicle, nil).Once()
+	mockAccessPolicy.On("CanViewVehicle", mock.MatchedBy(func(c *auth.Claims) bool {
+		return c.Uuid == tokenUserUUID.String()
+	}), expectedVehicle).Return(nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/vehicle/"+vehicleUUID.String(), nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -338,6 +384,30 @@ func TestGetVehicle_Controller_Success(t *testing.T) {
 	mockVehicleService.AssertExpectations(t)
 }
 
+func TestGetVehicle_Controller_NotOwner(t *testing.T) {
+	mockVehicleService.ExpectedCalls = nil
+	mockVehicleService.Calls = nil
+	vehicleUUID := uuid.New()
+	token := generateTestToken(uuid.New(), "stranger@example.com", model.RoleOsoba)
+
+	expectedVehicle := &model.Vehicle{
+		Uuid:  vehicleUUID,
+		Owner: &model.User{Uuid: uuid.New()},
+	}
+	mockVehicleService.On("Read", vehicleUUID).Return(expectedVehicle, nil).Once()
+	mockAccessPolicy.On("CanViewVehicle", mock.Anything, expectedVehicle).Return(cerror.ErrForbidden).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/vehicle/"+vehicleUUID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	mockVehicleService.AssertExpectations(t)
+	mockAccessPolicy.AssertExpectations(t)
+}
+
 func TestGetVehicle_Controller_NotFound(t *testing.T) {
 	mockVehicleService.ExpectedCalls = nil
 	mockVehicleService.Calls = nil
@@ -377,7 +447,7 @@ func TestMyVehicles_Controller_Success(t *testing.T) {
 		{Uuid: v1UUID, VehicleModel: "Civic", Registration: &model.RegistrationInfo{Registration: "ZG-MY-01"}},
 		{Uuid: uuid.New(), VehicleModel: "Accord", Registration: &model.RegistrationInfo{Registration: "ZG-MY-02"}},
 	}
-	mockVehicleService.On("ReadAll", userUUID).Return(expectedVehicles, nil).Once()
+	mockVehicleService.On("ReadAll", userUUID, mock.Anything).Return(expectedVehicles, &paging.Page{Total: 2, Limit: paging.DefaultLimit}, nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/vehicle/", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -402,7 +472,7 @@ func TestMyVehicles_Controller_ServiceError(t *testing.T) {
 	userUUID := uuid.New()
 	token := generateTestToken(userUUID, "myvehicles@example.com", model.RoleFirma)
 
-	mockVehicleService.On("ReadAll", userUUID).Return(nil, errors.New("some internal service error")).Once()
+	mockVehicleService.On("ReadAll", userUUID, mock.Anything).Return(nil, nil, errors.New("some internal service error")).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/vehicle/", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -665,6 +735,7 @@ func (suite *UserControllerTestSuite) TestGetVehicleByVin_Controller_Success() {
 		Owner:         &model.User{Uuid: uuid.New(), FirstName: "VIN Owner"},
 	}
 	mockVehicleService.On("ReadByVin", targetVIN).Return(expectedVehicle, nil).Once()
+	mockAccessPolicy.On("CanViewVehicle", mock.Anything, expectedVehicle).Return(nil).Once()
 
 	req, _ := http.NewRequest(http.MethodGet, "/api/vehicle/vin/"+targetVIN, nil)
 	req.Header.Set("Authorization", "Bearer "+token)
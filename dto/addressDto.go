@@ -0,0 +1,34 @@
+package dto
+
+import "ePrometna_Server/model"
+
+// AddressDto is a residence address, the county is taken from the postal
+// codebook and ignored in requests. Missing fields are reported by
+// validate.Address since user dtos are also part of bound responses.
+type AddressDto struct {
+	Street      string `json:"street" binding:"max=255"`
+	HouseNumber string `json:"houseNumber" binding:"max=20"`
+	PostalCode  string `json:"postalCode" binding:"max=5"`
+	Settlement  string `json:"settlement" binding:"max=100"`
+	County      string `json:"county"`
+}
+
+func (dto AddressDto) ToModel() model.Address {
+	return model.Address{
+		Street:      dto.Street,
+		HouseNumber: dto.HouseNumber,
+		PostalCode:  dto.PostalCode,
+		Settlement:  dto.Settlement,
+	}
+}
+
+// FromModel returns a dto from model struct
+func (dto AddressDto) FromModel(m *model.Address) AddressDto {
+	return AddressDto{
+		Street:      m.Street,
+		HouseNumber: m.HouseNumber,
+		PostalCode:  m.PostalCode,
+		Settlement:  m.Settlement,
+		County:      m.County,
+	}
+}
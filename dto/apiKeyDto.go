@@ -0,0 +1,97 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"time"
+)
+
+type NewApiKeyDto struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	Organisation string   `json:"organisation" binding:"required,max=255"`
+	Role         string   `json:"role" binding:"required"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	IpAllowlist  []string `json:"ipAllowlist"`
+	ExpiresAt    string   `json:"expiresAt" binding:"required"`
+}
+
+// ToModel creates a key without its secret, the service generates it
+func (dto *NewApiKeyDto) ToModel() (*model.ApiKey, error) {
+	role, err := model.StoUserRole(dto.Role)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]model.Permission, 0, len(dto.Scopes))
+	for _, scope := range dto.Scopes {
+		permission, err := model.StoPermission(scope)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, permission)
+	}
+	expiresAt, err := time.ParseInLocation(format.DateTimeFormat, dto.ExpiresAt, time.Local)
+	if err != nil {
+		return nil, cerror.ErrBadDateTimeFormat
+	}
+
+	ipAllowlist := dto.IpAllowlist
+	if ipAllowlist == nil {
+		ipAllowlist = []string{}
+	}
+
+	return &model.ApiKey{
+		Name:         dto.Name,
+		Organisation: dto.Organisation,
+		Role:         role,
+		Scopes:       scopes,
+		IpAllowlist:  ipAllowlist,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// ApiKeyDto describes a key, the key itself is only returned once in CreatedApiKeyDto
+type ApiKeyDto struct {
+	Uuid         string   `json:"uuid"`
+	Name         string   `json:"name"`
+	Organisation string   `json:"organisation"`
+	Role         string   `json:"role"`
+	Scopes       []string `json:"scopes"`
+	IpAllowlist  []string `json:"ipAllowlist"`
+	Prefix       string   `json:"prefix"`
+	CreatedAt    string   `json:"createdAt"`
+	ExpiresAt    string   `json:"expiresAt"`
+	LastUsedAt   *string  `json:"lastUsedAt,omitempty"`
+	LastUsedIp   string   `json:"lastUsedIp,omitempty"`
+	RevokedAt    *string  `json:"revokedAt,omitempty"`
+}
+
+type CreatedApiKeyDto struct {
+	ApiKeyDto
+	Key string `json:"key"`
+}
+
+// FromModel returns a dto from model struct
+func (dto ApiKeyDto) FromModel(m *model.ApiKey) ApiKeyDto {
+	rez := ApiKeyDto{
+		Uuid:         m.Uuid.String(),
+		Name:         m.Name,
+		Organisation: m.Organisation,
+		Role:         string(m.Role),
+		Scopes:       make([]string, 0, len(m.Scopes)),
+		IpAllowlist:  m.IpAllowlist,
+		Prefix:       m.Prefix,
+		CreatedAt:    m.CreatedAt.Format(format.DateTimeFormat),
+		ExpiresAt:    m.ExpiresAt.Format(format.DateTimeFormat),
+		LastUsedAt:   formatOptional(m.LastUsedAt),
+		LastUsedIp:   m.LastUsedIp,
+		RevokedAt:    formatOptional(m.RevokedAt),
+	}
+	for _, scope := range m.Scopes {
+		rez.Scopes = append(rez.Scopes, string(scope))
+	}
+	if rez.IpAllowlist == nil {
+		rez.IpAllowlist = []string{}
+	}
+	return rez
+}
@@ -0,0 +1,314 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/i18n"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DataExportDto is the content of a data export archive, every field but
+// GeneratedAt is one JSON file of it
+type DataExportDto struct {
+	GeneratedAt   string
+	Profile       DataExportProfileDto
+	Vehicles      []DataExportVehicleDto
+	PastVehicles  []DataExportVehicleDto
+	DriverGrants  []DataExportGrantDto
+	License       *DriverLicenseDto
+	Devices       []DataExportDeviceDto
+	TempData      []DataExportTempDataDto
+	Organisations DataExportOrganisationsDto
+	SignIn        DataExportSignInDto
+	AccessLog     DataExportAccessLogDto
+}
+
+type DataExportProfileDto struct {
+	UserDto
+	// ResidenceLegacy is the residence as entered before residences were addresses
+	ResidenceLegacy *string `json:"residenceLegacy,omitempty"`
+	CreatedAt       string  `json:"createdAt"`
+	UpdatedAt       string  `json:"updatedAt"`
+}
+
+type DataExportVehicleDto struct {
+	Uuid          string `json:"uuid"`
+	Mark          string `json:"mark"`
+	Model         string `json:"model"`
+	ChassisNumber string `json:"chassisNumber"`
+	Registration  string `json:"registration"`
+	// OwnedUntil is when a vehicle owned before got a new owner
+	OwnedUntil *string `json:"ownedUntil,omitempty"`
+}
+
+type DataExportGrantDto struct {
+	Uuid    string               `json:"uuid"`
+	Vehicle DataExportVehicleDto `json:"vehicle"`
+	Given   string               `json:"given"`
+	// Until is empty if the grant doesn't expire
+	Until     string  `json:"until"`
+	RemovedAt *string `json:"removedAt,omitempty"`
+}
+
+type DataExportDeviceDto struct {
+	MobileDto
+	RemovedAt *string `json:"removedAt,omitempty"`
+}
+
+type DataExportTempDataDto struct {
+	Uuid      string               `json:"uuid"`
+	Vehicle   DataExportVehicleDto `json:"vehicle"`
+	SharedAt  string               `json:"sharedAt"`
+	ExpiresAt string               `json:"expiresAt"`
+	RemovedAt *string              `json:"removedAt,omitempty"`
+}
+
+type DataExportOrganisationsDto struct {
+	Memberships []DataExportMembershipDto `json:"memberships"`
+	Invitations []InvitationDto           `json:"invitations"`
+}
+
+type DataExportMembershipDto struct {
+	MembershipDto
+	JoinedAt string `json:"joinedAt"`
+}
+
+type DataExportSignInDto struct {
+	MfaEnabled     bool                    `json:"mfaEnabled"`
+	MfaConfirmedAt *string                 `json:"mfaConfirmedAt,omitempty"`
+	Identities     []DataExportIdentityDto `json:"identities"`
+}
+
+// DataExportIdentityDto is an account of an identity provider linked to the user
+type DataExportIdentityDto struct {
+	Issuer      string  `json:"issuer"`
+	Subject     string  `json:"subject"`
+	LinkedAt    string  `json:"linkedAt"`
+	LastLoginAt *string `json:"lastLoginAt,omitempty"`
+}
+
+type DataExportAccessLogDto struct {
+	Sessions       []DataExportSessionDto    `json:"sessions"`
+	LockEvents     []LockEventDto            `json:"lockEvents"`
+	Impersonations []ImpersonationSessionDto `json:"impersonations"`
+}
+
+// DataExportSessionDto is a refresh token issued on login or refresh
+type DataExportSessionDto struct {
+	SessionUuid string  `json:"sessionUuid"`
+	IssuedAt    string  `json:"issuedAt"`
+	Ip          string  `json:"ip"`
+	ExpiresAt   string  `json:"expiresAt"`
+	UsedAt      *string `json:"usedAt,omitempty"`
+	RevokedAt   *string `json:"revokedAt,omitempty"`
+}
+
+// DataExportFile is a file of the data export archive
+type DataExportFile struct {
+	Name    string
+	Content any
+}
+
+// FromModel returns a dto from everything stored about a user
+func (dto DataExportDto) FromModel(m *model.UserDataExport) DataExportDto {
+	rez := DataExportDto{
+		GeneratedAt: m.GeneratedAt.Format(format.DateTimeFormat),
+		Profile: DataExportProfileDto{
+			UserDto:         UserDto{}.FromModel(&m.User),
+			ResidenceLegacy: m.User.ResidenceLegacy,
+			CreatedAt:       m.User.CreatedAt.Format(format.DateTimeFormat),
+			UpdatedAt:       m.User.UpdatedAt.Format(format.DateTimeFormat),
+		},
+		Vehicles:     make([]DataExportVehicleDto, 0, len(m.Vehicles)),
+		PastVehicles: make([]DataExportVehicleDto, 0, len(m.OwnerHistory)),
+		DriverGrants: make([]DataExportGrantDto, 0, len(m.DriverGrants)),
+		Devices:      make([]DataExportDeviceDto, 0, len(m.Devices)),
+		TempData:     make([]DataExportTempDataDto, 0, len(m.TempData)),
+		Organisations: DataExportOrganisationsDto{
+			Memberships: make([]DataExportMembershipDto, 0, len(m.Memberships)),
+			Invitations: make([]InvitationDto, 0, len(m.Invitations)),
+		},
+		SignIn: DataExportSignInDto{
+			Identities: make([]DataExportIdentityDto, 0, len(m.Identities)),
+		},
+		AccessLog: DataExportAccessLogDto{
+			Sessions:       make([]DataExportSessionDto, 0, len(m.Sessions)),
+			LockEvents:     make([]LockEventDto, 0, len(m.LockEvents)),
+			Impersonations: make([]ImpersonationSessionDto, 0, len(m.Impersonations)),
+		},
+	}
+
+	for _, vehicle := range m.Vehicles {
+		rez.Vehicles = append(rez.Vehicles, exportVehicle(&vehicle))
+	}
+	for _, history := range m.OwnerHistory {
+		vehicle := m.Referenced[history.VehicleId]
+		past := exportVehicle(&vehicle)
+		past.OwnedUntil = formatOptional(&history.CreatedAt)
+		rez.PastVehicles = append(rez.PastVehicles, past)
+	}
+	for _, grant := range m.DriverGrants {
+		vehicle := m.Referenced[grant.VehicleId]
+		until := ""
+		if !grant.Until.IsZero() {
+			until = grant.Until.Format(format.DateFormat)
+		}
+		rez.DriverGrants = append(rez.DriverGrants, DataExportGrantDto{
+			Uuid:      grant.Uuid.String(),
+			Vehicle:   exportVehicle(&vehicle),
+			Given:     grant.Given.Format(format.DateFormat),
+			Until:     until,
+			RemovedAt: formatDeleted(grant.DeletedAt),
+		})
+	}
+	if m.License != nil {
+		rez.License = (&DriverLicenseDto{}).FromModel(m.License)
+	}
+	for _, device := range m.Devices {
+		rez.Devices = append(rez.Devices, DataExportDeviceDto{
+			MobileDto: MobileDto{}.FromModel(&device),
+			RemovedAt: formatDeleted(device.DeletedAt),
+		})
+	}
+	for _, temp := range m.TempData {
+		vehicle := m.Referenced[temp.VehicleId]
+		rez.TempData = append(rez.TempData, DataExportTempDataDto{
+			Uuid:      temp.Uuid.String(),
+			Vehicle:   exportVehicle(&vehicle),
+			SharedAt:  temp.CreatedAt.Format(format.DateTimeFormat),
+			ExpiresAt: temp.Expiring.Format(format.DateTimeFormat),
+			RemovedAt: formatDeleted(temp.DeletedAt),
+		})
+	}
+
+	for _, member := range m.Memberships {
+		rez.Organisations.Memberships = append(rez.Organisations.Memberships, DataExportMembershipDto{
+			MembershipDto: MembershipDto{}.FromModel(&member),
+			JoinedAt:      member.CreatedAt.Format(format.DateTimeFormat),
+		})
+	}
+	for _, invitation := range m.Invitations {
+		rez.Organisations.Invitations = append(rez.Organisations.Invitations, InvitationDto{}.FromModel(&invitation))
+	}
+
+	if m.Totp != nil {
+		rez.SignIn.MfaEnabled = m.Totp.ConfirmedAt != nil
+		rez.SignIn.MfaConfirmedAt = formatOptional(m.Totp.ConfirmedAt)
+	}
+	for _, identity := range m.Identities {
+		rez.SignIn.Identities = append(rez.SignIn.Identities, DataExportIdentityDto{
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			LinkedAt:    identity.CreatedAt.Format(format.DateTimeFormat),
+			LastLoginAt: formatOptional(identity.LastLoginAt),
+		})
+	}
+
+	for _, session := range m.Sessions {
+		rez.AccessLog.Sessions = append(rez.AccessLog.Sessions, DataExportSessionDto{
+			SessionUuid: session.FamilyUuid.String(),
+			IssuedAt:    session.CreatedAt.Format(format.DateTimeFormat),
+			Ip:          session.Ip,
+			ExpiresAt:   session.ExpiresAt.Format(format.DateTimeFormat),
+			UsedAt:      formatOptional(session.UsedAt),
+			RevokedAt:   formatOptional(session.RevokedAt),
+		})
+	}
+	for _, event := range m.LockEvents {
+		rez.AccessLog.LockEvents = append(rez.AccessLog.LockEvents, LockEventDto{}.FromModel(&event, m.GeneratedAt))
+	}
+	for _, session := range m.Impersonations {
+		rez.AccessLog.Impersonations = append(rez.AccessLog.Impersonations, ImpersonationSessionDto{}.FromModel(&session))
+	}
+
+	return rez
+}
+
+// Files returns the JSON files of the archive in the order they are listed
+// in the summary
+func (dto DataExportDto) Files() []DataExportFile {
+	return []DataExportFile{
+		{"profile.json", dto.Profile},
+		{"vehicles.json", dto.Vehicles},
+		{"past_vehicles.json", dto.PastVehicles},
+		{"driver_grants.json", dto.DriverGrants},
+		{"driver_license.json", dto.License},
+		{"devices.json", dto.Devices},
+		{"temp_data.json", dto.TempData},
+		{"organisations.json", dto.Organisations},
+		{"sign_in.json", dto.SignIn},
+		{"access_log.json", dto.AccessLog},
+	}
+}
+
+// Summary describes the export for people in lang, it is the README of the archive
+func (dto DataExportDto) Summary(lang string) string {
+	var b strings.Builder
+	line := func(key string, args ...any) {
+		b.WriteString(i18n.T(lang, key, args...))
+		b.WriteString("\n")
+	}
+
+	p := dto.Profile
+	line("export.title")
+	line("export.generated", dto.GeneratedAt)
+	b.WriteString("\n")
+	line("export.person", p.FirstName, p.LastName, p.OIB, p.BirthDate)
+	line("export.contact", p.Email, p.Residence.ToModel().String())
+	line("export.account", p.Role, p.CreatedAt)
+	b.WriteString("\n")
+
+	line("export.vehicles", len(dto.Vehicles))
+	for _, vehicle := range dto.Vehicles {
+		b.WriteString(fmt.Sprintf("  - %s %s %s\n", vehicle.Mark, vehicle.Model, vehicle.Registration))
+	}
+	line("export.past_vehicles", len(dto.PastVehicles))
+	line("export.driver_grants", len(dto.DriverGrants))
+	if dto.License != nil {
+		line("export.license", dto.License.LicenseNumber, dto.License.Category, dto.License.ExpiringDate)
+	} else {
+		line("export.no_license")
+	}
+	line("export.devices", len(dto.Devices))
+	line("export.temp_data", len(dto.TempData))
+	line("export.organisations", len(dto.Organisations.Memberships))
+	if dto.SignIn.MfaEnabled {
+		line("export.mfa_enabled")
+	} else {
+		line("export.mfa_disabled")
+	}
+	line("export.identities", len(dto.SignIn.Identities))
+	line("export.sessions", len(dto.AccessLog.Sessions))
+	line("export.lock_events", len(dto.AccessLog.LockEvents))
+	line("export.impersonations", len(dto.AccessLog.Impersonations))
+	b.WriteString("\n")
+
+	line("export.files")
+	for _, file := range dto.Files() {
+		b.WriteString("  " + file.Name + "\n")
+	}
+	return b.String()
+}
+
+func exportVehicle(m *model.Vehicle) DataExportVehicleDto {
+	rez := DataExportVehicleDto{
+		Uuid:          m.Uuid.String(),
+		Mark:          m.Mark,
+		Model:         m.VehicleModel,
+		ChassisNumber: m.ChassisNumber,
+	}
+	if m.Registration != nil {
+		rez.Registration = m.Registration.Registration
+	}
+	return rez
+}
+
+func formatDeleted(deletedAt gorm.DeletedAt) *string {
+	if !deletedAt.Valid {
+		return nil
+	}
+	return formatOptional(&deletedAt.Time)
+}
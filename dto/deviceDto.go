@@ -22,3 +22,9 @@ type DeviceLoginResponse struct {
 	RefreshToken string `json:"refreshToken"`
 	DeviceToken  string `json:"deviceToken"`
 }
+
+// DeviceChallengeDto is a nonce the device signs to authorize one request
+type DeviceChallengeDto struct {
+	Nonce     string `json:"nonce"`
+	ExpiresAt string `json:"expiresAt"`
+}
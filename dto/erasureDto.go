@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+	"time"
+)
+
+type ErasureRequestDto struct {
+	Uuid            string  `json:"uuid"`
+	UserUuid        string  `json:"userUuid"`
+	RequestedByUuid string  `json:"requestedByUuid"`
+	Status          string  `json:"status"`
+	RequestedAt     string  `json:"requestedAt"`
+	EraseAfter      string  `json:"eraseAfter"`
+	CancelledAt     *string `json:"cancelledAt,omitempty"`
+	ErasedAt        *string `json:"erasedAt,omitempty"`
+}
+
+// ErasureCertificateDto states what was done to the personal data of an
+// erased user, Complete is false while records are kept for their retention
+type ErasureCertificateDto struct {
+	ErasureRequestDto
+	Actions  []ErasureActionDto `json:"actions"`
+	Complete bool               `json:"complete"`
+	IssuedAt string             `json:"issuedAt"`
+}
+
+type ErasureActionDto struct {
+	Entity      string  `json:"entity"`
+	Action      string  `json:"action"`
+	Count       int64   `json:"count"`
+	RetainUntil *string `json:"retainUntil,omitempty"`
+	DoneAt      *string `json:"doneAt,omitempty"`
+}
+
+// FromModel returns a dto from model struct
+func (dto ErasureRequestDto) FromModel(m *model.ErasureRequest) ErasureRequestDto {
+	return ErasureRequestDto{
+		Uuid:            m.Uuid.String(),
+		UserUuid:        m.UserUuid.String(),
+		RequestedByUuid: m.RequestedByUuid.String(),
+		Status:          m.Status,
+		RequestedAt:     m.CreatedAt.Format(format.DateTimeFormat),
+		EraseAfter:      m.EraseAfter.Format(format.DateTimeFormat),
+		CancelledAt:     formatOptional(m.CancelledAt),
+		ErasedAt:        formatOptional(m.ErasedAt),
+	}
+}
+
+// FromModel returns a dto from a completed request with its actions
+func (dto ErasureCertificateDto) FromModel(m *model.ErasureRequest, issuedAt time.Time) ErasureCertificateDto {
+	rez := ErasureCertificateDto{
+		ErasureRequestDto: ErasureRequestDto{}.FromModel(m),
+		Actions:           make([]ErasureActionDto, 0, len(m.Actions)),
+		Complete:          true,
+		IssuedAt:          issuedAt.Format(format.DateTimeFormat),
+	}
+	for _, action := range m.Actions {
+		rez.Actions = append(rez.Actions, ErasureActionDto{
+			Entity:      action.Entity,
+			Action:      action.Action,
+			Count:       action.Count,
+			RetainUntil: formatOptional(action.RetainUntil),
+			DoneAt:      formatOptional(action.DoneAt),
+		})
+		if action.DoneAt == nil {
+			rez.Complete = false
+		}
+	}
+	return rez
+}
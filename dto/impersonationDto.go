@@ -0,0 +1,64 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+)
+
+type ImpersonateDto struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// ImpersonationTokenDto is the short lived access token of an impersonated
+// user, there is no refresh token
+type ImpersonationTokenDto struct {
+	AccessToken string `json:"accessToken"`
+	SessionUuid string `json:"sessionUuid"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+type ImpersonationSessionDto struct {
+	Uuid        string  `json:"uuid"`
+	ActorUuid   string  `json:"actorUuid"`
+	SubjectUuid string  `json:"subjectUuid"`
+	Reason      string  `json:"reason"`
+	Ip          string  `json:"ip"`
+	StartedAt   string  `json:"startedAt"`
+	ExpiresAt   string  `json:"expiresAt"`
+	EndedAt     *string `json:"endedAt,omitempty"`
+}
+
+type ImpersonatedRequestDto struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Status  int    `json:"status"`
+	Ip      string `json:"ip"`
+	Blocked bool   `json:"blocked"`
+	At      string `json:"at"`
+}
+
+// FromModel returns a dto from model struct
+func (dto ImpersonationSessionDto) FromModel(m *model.ImpersonationSession) ImpersonationSessionDto {
+	return ImpersonationSessionDto{
+		Uuid:        m.Uuid.String(),
+		ActorUuid:   m.ActorUuid.String(),
+		SubjectUuid: m.SubjectUuid.String(),
+		Reason:      m.Reason,
+		Ip:          m.Ip,
+		StartedAt:   m.CreatedAt.Format(format.DateTimeFormat),
+		ExpiresAt:   m.ExpiresAt.Format(format.DateTimeFormat),
+		EndedAt:     formatOptional(m.EndedAt),
+	}
+}
+
+// FromModel returns a dto from model struct
+func (dto ImpersonatedRequestDto) FromModel(m *model.ImpersonationRequest) ImpersonatedRequestDto {
+	return ImpersonatedRequestDto{
+		Method:  m.Method,
+		Path:    m.Path,
+		Status:  m.Status,
+		Ip:      m.Ip,
+		Blocked: m.Blocked,
+		At:      m.CreatedAt.Format(format.DateTimeFormat),
+	}
+}
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+	"time"
+)
+
+type LockEventDto struct {
+	Uuid        string  `json:"uuid"`
+	Scope       string  `json:"scope"`
+	Key         string  `json:"key"`
+	Failures    int     `json:"failures"`
+	LockedAt    string  `json:"lockedAt"`
+	LockedUntil string  `json:"lockedUntil"`
+	Active      bool    `json:"active"`
+	UnlockedAt  *string `json:"unlockedAt,omitempty"`
+	UnlockedBy  *string `json:"unlockedBy,omitempty"`
+}
+
+// FromModel returns a dto from model struct
+func (dto LockEventDto) FromModel(m *model.LockEvent, now time.Time) LockEventDto {
+	rez := LockEventDto{
+		Uuid:        m.Uuid.String(),
+		Scope:       string(m.Scope),
+		Key:         m.Key,
+		Failures:    m.Failures,
+		LockedAt:    m.CreatedAt.Format(format.DateTimeFormat),
+		LockedUntil: m.LockedUntil.Format(format.DateTimeFormat),
+		Active:      m.IsActive(now),
+	}
+
+	if m.UnlockedAt != nil {
+		unlockedAt := m.UnlockedAt.Format(format.DateTimeFormat)
+		rez.UnlockedAt = &unlockedAt
+	}
+	if m.UnlockedBy != nil {
+		unlockedBy := m.UnlockedBy.String()
+		rez.UnlockedBy = &unlockedBy
+	}
+
+	return rez
+}
@@ -0,0 +1,37 @@
+package dto
+
+// LoginResponseDto contains tokens, or a second factor challenge when MfaToken is set
+type LoginResponseDto struct {
+	AccessToken       string `json:"accessToken"`
+	RefreshToken      string `json:"refreshToken"`
+	MfaToken          string `json:"mfaToken,omitempty"`
+	MfaEnrollRequired bool   `json:"mfaEnrollRequired,omitempty"`
+}
+
+type MfaTokenDto struct {
+	MfaToken string `json:"mfaToken" binding:"required"`
+}
+
+type MfaVerifyDto struct {
+	MfaToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MfaCodeDto struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MfaEnrollmentDto struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauthUri"`
+}
+
+type RecoveryCodesDto struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MfaEnrollmentCompleteDto struct {
+	AccessToken   string   `json:"accessToken"`
+	RefreshToken  string   `json:"refreshToken"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -1,6 +1,46 @@
 package dto
 
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+)
+
 type MobileDto struct {
-	RegisteredDevice string `json:"registeredDevice" binding:"required"`
-	CreatedAt        string `json:"createdAt" binding:"required"`
+	Uuid             string  `json:"uuid"`
+	Platform         string  `json:"platform"`
+	Brand            string  `json:"brand"`
+	ModelName        string  `json:"modelName"`
+	DeviceId         string  `json:"deviceId"`
+	RegisteredDevice string  `json:"registeredDevice" binding:"required"`
+	CreatedAt        string  `json:"createdAt" binding:"required"`
+	LastSeenAt       *string `json:"lastSeenAt,omitempty"`
+	LastSeenIp       string  `json:"lastSeenIp,omitempty"`
+	KeyRegistered    bool    `json:"keyRegistered"`
+	AttestedAt       *string `json:"attestedAt,omitempty"`
+}
+
+// FromModel returns a dto from model struct
+func (dto MobileDto) FromModel(m *model.Mobile) MobileDto {
+	rez := MobileDto{
+		Uuid:             m.Uuid.String(),
+		Platform:         m.Platform,
+		Brand:            m.Brand,
+		ModelName:        m.ModelName,
+		DeviceId:         m.DeviceId,
+		RegisteredDevice: m.RegisteredDevice,
+		CreatedAt:        m.CreatedAt.Format(format.DateTimeFormat),
+		LastSeenIp:       m.LastSeenIp,
+		KeyRegistered:    m.PublicKey != "",
+	}
+
+	if m.LastSeenAt != nil {
+		lastSeenAt := m.LastSeenAt.Format(format.DateTimeFormat)
+		rez.LastSeenAt = &lastSeenAt
+	}
+	if m.AttestedAt != nil {
+		attestedAt := m.AttestedAt.Format(format.DateTimeFormat)
+		rez.AttestedAt = &attestedAt
+	}
+
+	return rez
 }
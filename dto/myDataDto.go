@@ -0,0 +1,47 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/validate"
+	"errors"
+)
+
+// MyDataUpdateDto holds the fields users may change themselves, names, OIB,
+// birth date and role are changed by administrators
+type MyDataUpdateDto struct {
+	Residence AddressDto `json:"residence"`
+	Email     string     `json:"email" binding:"required,max=100"`
+	// CurrentPassword is required when the email changes
+	CurrentPassword string `json:"currentPassword"`
+}
+
+// ToModel checks the residence and email and returns the residence as
+// written in the postal codebook, errors are *cerror.FieldError
+func (dto *MyDataUpdateDto) ToModel() (model.Address, error) {
+	var errs []error
+	residence := dto.Residence.ToModel()
+	if err := validate.Address("residence", &residence); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validate.Email(dto.Email); err != nil {
+		errs = append(errs, &cerror.FieldError{Field: "email", Err: err})
+	}
+	return residence, errors.Join(errs...)
+}
+
+// MyDataDto is the logged in user, PendingEmail is set while a new email
+// waits to be confirmed
+type MyDataDto struct {
+	UserDto
+	PendingEmail string `json:"pendingEmail,omitempty"`
+}
+
+// FromModel returns a dto from model struct
+func (dto MyDataDto) FromModel(m *model.User, pendingEmail string) MyDataDto {
+	return MyDataDto{UserDto: UserDto{}.FromModel(m), PendingEmail: pendingEmail}
+}
+
+type EmailConfirmDto struct {
+	Token string `json:"token" binding:"required"`
+}
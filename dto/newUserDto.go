@@ -4,6 +4,7 @@ import (
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/validate"
 	"fmt"
 	"time"
 
@@ -12,19 +13,20 @@ import (
 )
 
 type NewUserDto struct {
-	Uuid        string `json:"uuid"`
-	FirstName   string `json:"firstName" binding:"required,min=2,max=100"`
-	LastName    string `json:"lastName" binding:"required,min=2,max=100"`
-	OIB         string `json:"oib" binding:"required,len=11"`
-	Residence   string `json:"residence" binding:"required,max=255"`
-	BirthDate   string `json:"birthDate" binding:"required,datetime=2006-01-02"`
-	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=6"`
-	Role        string `json:"role" binding:"required,oneof=hak mupadmin osoba firma policija superadmin"`
-	PoliceToken string `json:"policeToken"`
+	Uuid        string     `json:"uuid"`
+	FirstName   string     `json:"firstName" binding:"required,min=2,max=100"`
+	LastName    string     `json:"lastName" binding:"required,min=2,max=100"`
+	OIB         string     `json:"oib" binding:"required,len=11"`
+	Residence   AddressDto `json:"residence"`
+	BirthDate   string     `json:"birthDate" binding:"required,datetime=2006-01-02"`
+	Email       string     `json:"email" binding:"required,email"`
+	Password    string     `json:"password" binding:"required,min=6"`
+	Role        string     `json:"role" binding:"required,oneof=hak mupadmin osoba firma policija superadmin"`
+	PoliceToken string     `json:"policeToken"`
 }
 
-// ToModel create a model from a dto
+// ToModel create a model from a dto, identity fields failing validation are
+// returned as *cerror.FieldError
 func (dto *NewUserDto) ToModel() (*model.User, error) {
 	bod, err := time.Parse(format.DateFormat, dto.BirthDate)
 	if err != nil {
@@ -44,17 +46,20 @@ func (dto *NewUserDto) ToModel() (*model.User, error) {
 		}
 	}
 
-	return &model.User{
-		Uuid:        uuid.New(),
-		FirstName:   dto.FirstName,
-		LastName:    dto.LastName,
-		OIB:         dto.OIB,
-		Residence:   dto.Residence,
-		BirthDate:   bod,
-		Email:       dto.Email,
-		Role:        role,
-		PoliceToken: &dto.PoliceToken,
-	}, nil
+	user := &model.User{
+		Uuid:      uuid.New(),
+		FirstName: dto.FirstName,
+		LastName:  dto.LastName,
+		OIB:       dto.OIB,
+		Residence: dto.Residence.ToModel(),
+		BirthDate: bod,
+		Email:     dto.Email,
+		Role:      role,
+	}
+	if err := validate.User(user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 // FromModel returns a dto from model struct
@@ -64,16 +69,10 @@ func (dto *NewUserDto) FromModel(m *model.User) *NewUserDto {
 		FirstName: m.FirstName,
 		LastName:  m.LastName,
 		OIB:       m.OIB,
-		Residence: m.Residence,
+		Residence: AddressDto{}.FromModel(&m.Residence),
 		BirthDate: m.BirthDate.Format(format.DateFormat),
 		Email:     m.Email,
 		Role:      fmt.Sprint(m.Role),
-		PoliceToken: func() string {
-			if m.PoliceToken != nil {
-				return *m.PoliceToken
-			}
-			return ""
-		}(),
 	}
 	return dto
 }
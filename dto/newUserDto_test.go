@@ -30,8 +30,8 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				// Uuid: "", // Intentionally empty, ToModel should generate it
 				FirstName: "Test",
 				LastName:  "User",
-				OIB:       "11223344556",
-				Residence: "Test Residence",
+				OIB:       "11223344553",
+				Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 				BirthDate: validDateStr,
 				Email:     "test.user@example.com",
 				Password:  "password123",
@@ -41,8 +41,8 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				// Uuid will be checked for non-nil
 				FirstName: "Test",
 				LastName:  "User",
-				OIB:       "11223344556",
-				Residence: "Test Residence",
+				OIB:       "11223344553",
+				Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 				BirthDate: validTime,
 				Email:     "test.user@example.com",
 				Role:      model.RoleOsoba,
@@ -56,8 +56,8 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				Uuid:      userUUID.String(),
 				FirstName: "Another",
 				LastName:  "User",
-				OIB:       "66778899001",
-				Residence: "Another Residence",
+				OIB:       "66778899007",
+				Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 				BirthDate: validDateStr,
 				Email:     "another.user@example.com",
 				Password:  "securepass",
@@ -67,8 +67,8 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				// Uuid will be checked for non-nil (ToModel generates a new one regardless of DTO input)
 				FirstName: "Another",
 				LastName:  "User",
-				OIB:       "66778899001",
-				Residence: "Another Residence",
+				OIB:       "66778899007",
+				Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 				BirthDate: validTime,
 				Email:     "another.user@example.com",
 				Role:      model.RoleFirma,
@@ -82,10 +82,10 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				LastName:  "Date",
 				BirthDate: "20-03-1995", // Wrong format
 				Role:      "hak",
-				OIB:       "12345678901",
+				OIB:       "12345678903",
 				Email:     "bad.date@example.com",
 				Password:  "password",
-				Residence: "Some place",
+				Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 			},
 			want:    nil,
 			wantErr: cerror.ErrBadDateFormat,
@@ -97,10 +97,10 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				LastName:  "Role",
 				BirthDate: validDateStr,
 				Role:      "nonexistent_role",
-				OIB:       "12345678901",
+				OIB:       "12345678903",
 				Email:     "bad.role@example.com",
 				Password:  "password",
-				Residence: "Some place",
+				Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 			},
 			want:    nil,
 			wantErr: cerror.ErrUnknownRole,
@@ -113,10 +113,10 @@ func TestNewUserDto_ToModel(t *testing.T) {
 				LastName:  "UUID",
 				BirthDate: validDateStr,
 				Role:      "osoba",
-				OIB:       "12345678901",
+				OIB:       "12345678903",
 				Email:     "bad.uuid@example.com",
 				Password:  "password",
-				Residence: "Some place",
+				Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 			},
 			want:    nil,
 			wantErr: cerror.ErrBadUuid,
@@ -152,8 +152,8 @@ func TestNewUserDto_FromModel(t *testing.T) {
 		Uuid:         userUUID,
 		FirstName:    "ModelF",
 		LastName:     "ModelL",
-		OIB:          "55443322110",
-		Residence:    "Model Residence",
+		OIB:          "55443322117",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		BirthDate:    birthTime,
 		Email:        "model.user@example.com",
 		PasswordHash: "somehash", // Not included in NewUserDto
@@ -164,8 +164,8 @@ func TestNewUserDto_FromModel(t *testing.T) {
 		Uuid:      userUUID.String(),
 		FirstName: "ModelF",
 		LastName:  "ModelL",
-		OIB:       "55443322110",
-		Residence: "Model Residence",
+		OIB:       "55443322117",
+		Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		BirthDate: "1992-11-05",
 		Email:     "model.user@example.com",
 		Password:  "", // Password is not part of FromModel for NewUserDto
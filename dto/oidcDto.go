@@ -0,0 +1,17 @@
+package dto
+
+// OidcAuthorizeDto is the identity provider url the user is sent to and the
+// binding of the started sign in
+type OidcAuthorizeDto struct {
+	Url string `json:"url"`
+	// Binding is kept by the web app, e.g. in session storage, and sent with the callback
+	Binding string `json:"binding"`
+}
+
+// OidcCallbackDto is the code and state the identity provider redirected back
+// with and the binding returned when the sign in was started
+type OidcCallbackDto struct {
+	Code    string `json:"code" binding:"required"`
+	State   string `json:"state" binding:"required"`
+	Binding string `json:"binding" binding:"required"`
+}
@@ -0,0 +1,127 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/validate"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type OrganisationDto struct {
+	Uuid string `json:"uuid"`
+	Name string `json:"name"`
+	OIB  string `json:"oib"`
+}
+
+// FromModel returns a dto from model struct
+func (dto OrganisationDto) FromModel(m *model.Organisation) OrganisationDto {
+	return OrganisationDto{
+		Uuid: m.Uuid.String(),
+		Name: m.Name,
+		OIB:  m.OIB,
+	}
+}
+
+// OrganisationDetailsDto is an organisation with its members
+type OrganisationDetailsDto struct {
+	OrganisationDto
+	Members []OrganisationMemberDto `json:"members"`
+}
+
+// FromModel returns a dto from an organisation with preloaded members
+func (dto OrganisationDetailsDto) FromModel(m *model.Organisation) OrganisationDetailsDto {
+	rez := OrganisationDetailsDto{
+		OrganisationDto: OrganisationDto{}.FromModel(m),
+		Members:         make([]OrganisationMemberDto, 0, len(m.Members)),
+	}
+	for _, member := range m.Members {
+		rez.Members = append(rez.Members, OrganisationMemberDto{}.FromModel(&member))
+	}
+	return rez
+}
+
+// OrganisationMemberDto is a member as the other members see them
+type OrganisationMemberDto struct {
+	Uuid      string `json:"uuid"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Role      string `json:"role"`
+}
+
+// FromModel returns a dto from a member with a preloaded user
+func (dto OrganisationMemberDto) FromModel(m *model.OrganisationMember) OrganisationMemberDto {
+	return OrganisationMemberDto{
+		Uuid:      m.User.Uuid.String(),
+		FirstName: m.User.FirstName,
+		LastName:  m.User.LastName,
+		Role:      string(m.Role),
+	}
+}
+
+// MembershipDto is an organisation the logged in user is a member of
+type MembershipDto struct {
+	Organisation OrganisationDto `json:"organisation"`
+	Role         string          `json:"role"`
+}
+
+// FromModel returns a dto from a member with a preloaded organisation
+func (dto MembershipDto) FromModel(m *model.OrganisationMember) MembershipDto {
+	rez := MembershipDto{Role: string(m.Role)}
+	if m.Organisation != nil {
+		rez.Organisation = OrganisationDto{}.FromModel(m.Organisation)
+	}
+	return rez
+}
+
+// NewOrganisationDto registers an organisation, the logged in user becomes
+// its owner unless an administrator names another
+type NewOrganisationDto struct {
+	Name      string `json:"name" binding:"required,max=255"`
+	OIB       string `json:"oib" binding:"required"`
+	OwnerUuid string `json:"ownerUuid" binding:"omitempty,uuid"`
+}
+
+// ToModel checks the OIB, errors are *cerror.FieldError
+func (dto *NewOrganisationDto) ToModel() (*model.Organisation, error) {
+	if err := validate.Oib(dto.OIB); err != nil {
+		return nil, &cerror.FieldError{Field: "oib", Err: err}
+	}
+	return &model.Organisation{
+		Uuid: uuid.New(),
+		Name: strings.TrimSpace(dto.Name),
+		OIB:  dto.OIB,
+	}, nil
+}
+
+// InvitationDto is an invitation of the logged in user to an organisation
+type InvitationDto struct {
+	Uuid         string          `json:"uuid"`
+	Organisation OrganisationDto `json:"organisation"`
+	Role         string          `json:"role"`
+	ExpiresAt    string          `json:"expiresAt"`
+}
+
+// FromModel returns a dto from an invitation with a preloaded organisation
+func (dto InvitationDto) FromModel(m *model.OrganisationInvitation) InvitationDto {
+	rez := InvitationDto{
+		Uuid:      m.Uuid.String(),
+		Role:      string(m.Role),
+		ExpiresAt: m.ExpiresAt.Format(format.DateTimeFormat),
+	}
+	if m.Organisation != nil {
+		rez.Organisation = OrganisationDto{}.FromModel(m.Organisation)
+	}
+	return rez
+}
+
+type NewInvitationDto struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type MemberRoleDto struct {
+	Role string `json:"role" binding:"required"`
+}
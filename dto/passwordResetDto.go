@@ -0,0 +1,10 @@
+package dto
+
+type PasswordResetRequestDto struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type PasswordResetConfirmDto struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
@@ -0,0 +1,25 @@
+package dto
+
+import "ePrometna_Server/model"
+
+type PermissionDto struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type RolePermissionsDto struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// FromModel returns a dto from model struct
+func (dto RolePermissionsDto) FromModel(role model.UserRole, permissions []model.Permission) RolePermissionsDto {
+	rez := RolePermissionsDto{
+		Role:        string(role),
+		Permissions: make([]string, 0, len(permissions)),
+	}
+	for _, permission := range permissions {
+		rez.Permissions = append(rez.Permissions, string(permission))
+	}
+	return rez
+}
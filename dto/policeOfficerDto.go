@@ -0,0 +1,58 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+	"time"
+)
+
+// PoliceOfficerDto is an officer with the state of their latest activation code
+type PoliceOfficerDto struct {
+	UserDto
+	Activation *ActivationCodeDto `json:"activation"`
+}
+
+// ActivationCodeDto shows the lifecycle of an activation code, never the code itself
+type ActivationCodeDto struct {
+	Uuid       string  `json:"uuid"`
+	Status     string  `json:"status"`
+	Attempts   int     `json:"attempts"`
+	IssuedAt   string  `json:"issuedAt"`
+	ExpiresAt  string  `json:"expiresAt"`
+	RedeemedAt *string `json:"redeemedAt,omitempty"`
+	ExpiredAt  *string `json:"expiredAt,omitempty"`
+	RevokedAt  *string `json:"revokedAt,omitempty"`
+}
+
+// FromModel returns a dto from an officer and their latest code, code is nil
+// if the officer never had one
+func (dto PoliceOfficerDto) FromModel(m *model.User, code *model.PoliceActivationCode) PoliceOfficerDto {
+	rez := PoliceOfficerDto{UserDto: UserDto{}.FromModel(m)}
+	if code != nil {
+		activation := ActivationCodeDto{}.FromModel(code)
+		rez.Activation = &activation
+	}
+	return rez
+}
+
+// FromModel returns a dto from model struct
+func (dto ActivationCodeDto) FromModel(m *model.PoliceActivationCode) ActivationCodeDto {
+	return ActivationCodeDto{
+		Uuid:       m.Uuid.String(),
+		Status:     string(m.Status),
+		Attempts:   m.Attempts,
+		IssuedAt:   m.CreatedAt.Format(format.DateTimeFormat),
+		ExpiresAt:  m.ExpiresAt.Format(format.DateTimeFormat),
+		RedeemedAt: formatOptional(m.RedeemedAt),
+		ExpiredAt:  formatOptional(m.ExpiredAt),
+		RevokedAt:  formatOptional(m.RevokedAt),
+	}
+}
+
+func formatOptional(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	rez := t.Format(format.DateTimeFormat)
+	return &rez
+}
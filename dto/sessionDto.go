@@ -0,0 +1,24 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+)
+
+// SessionDto is a login of a user, it lasts as long as its refresh tokens are rotated
+type SessionDto struct {
+	Uuid       string `json:"uuid"`
+	LastSeenAt string `json:"lastSeenAt"`
+	Ip         string `json:"ip"`
+	ExpiresAt  string `json:"expiresAt"`
+}
+
+// FromModel returns a dto from the latest refresh token of a session
+func (dto SessionDto) FromModel(m *model.RefreshToken) SessionDto {
+	return SessionDto{
+		Uuid:       m.FamilyUuid.String(),
+		LastSeenAt: m.CreatedAt.Format(format.DateTimeFormat),
+		Ip:         m.Ip,
+		ExpiresAt:  m.ExpiresAt.Format(format.DateTimeFormat),
+	}
+}
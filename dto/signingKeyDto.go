@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/format"
+)
+
+type SigningKeyDto struct {
+	Kid       string `json:"kid"`
+	Algorithm string `json:"algorithm"`
+	CreatedAt string `json:"createdAt"`
+	// ActiveAt is when the key starts signing new tokens
+	ActiveAt string `json:"activeAt"`
+	Signing  bool   `json:"signing"`
+}
+
+// FromModel returns a dto from model struct, private key is never included
+func (dto SigningKeyDto) FromModel(m *model.SigningKey, signingKid string) SigningKeyDto {
+	activeAt := m.CreatedAt
+	if m.ActiveAt != nil {
+		activeAt = *m.ActiveAt
+	}
+	return SigningKeyDto{
+		Kid:       m.Kid,
+		Algorithm: m.Algorithm,
+		CreatedAt: m.CreatedAt.Format(format.DateTimeFormat),
+		ActiveAt:  activeAt.Format(format.DateTimeFormat),
+		Signing:   m.Kid == signingKid,
+	}
+}
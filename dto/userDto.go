@@ -4,6 +4,7 @@ import (
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/validate"
 	"fmt"
 	"time"
 
@@ -12,15 +13,14 @@ import (
 )
 
 type UserDto struct {
-	Uuid        string `json:"uuid"`
-	FirstName   string `json:"firstName"`
-	LastName    string `json:"lastName"`
-	OIB         string `json:"oib"`
-	Residence   string `json:"residence"`
-	BirthDate   string `json:"birthDate"`
-	Email       string `json:"email"`
-	Role        string `json:"role"`
-	PoliceToken string `json:"policeToken"`
+	Uuid      string     `json:"uuid"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	OIB       string     `json:"oib"`
+	Residence AddressDto `json:"residence"`
+	BirthDate string     `json:"birthDate"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
 }
 
 func (dto *UserDto) ToModel() (*model.User, error) {
@@ -42,17 +42,59 @@ func (dto *UserDto) ToModel() (*model.User, error) {
 		return nil, cerror.ErrUnknownRole
 	}
 
-	return &model.User{
-		Uuid:        uuid,
-		FirstName:   dto.FirstName,
-		LastName:    dto.LastName,
-		OIB:         dto.OIB,
-		Residence:   dto.Residence,
-		BirthDate:   bod,
-		Email:       dto.Email,
-		Role:        role,
-		PoliceToken: &dto.PoliceToken,
-	}, nil
+	user := &model.User{
+		Uuid:      uuid,
+		FirstName: dto.FirstName,
+		LastName:  dto.LastName,
+		OIB:       dto.OIB,
+		Residence: dto.Residence.ToModel(),
+		BirthDate: bod,
+		Email:     dto.Email,
+		Role:      role,
+	}
+	if err := validate.User(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminUserDto is the user data administrators may change
+type AdminUserDto struct {
+	FirstName string     `json:"firstName" binding:"required"`
+	LastName  string     `json:"lastName" binding:"required"`
+	OIB       string     `json:"oib" binding:"required"`
+	Residence AddressDto `json:"residence"`
+	BirthDate string     `json:"birthDate" binding:"required"`
+	Email     string     `json:"email" binding:"required"`
+	Role      string     `json:"role" binding:"required"`
+}
+
+func (dto *AdminUserDto) ToModel() (*model.User, error) {
+	bod, err := time.Parse(format.DateFormat, dto.BirthDate)
+	if err != nil {
+		zap.S().Errorf("Failed to parse BirthDate = %s, err = %+v", dto.BirthDate, err)
+		return nil, cerror.ErrBadDateFormat
+	}
+
+	role, err := model.StoUserRole(dto.Role)
+	if err != nil {
+		zap.S().Errorf("Failed to parse role = %+v, err = %+v", dto.Role, err)
+		return nil, cerror.ErrUnknownRole
+	}
+
+	user := &model.User{
+		FirstName: dto.FirstName,
+		LastName:  dto.LastName,
+		OIB:       dto.OIB,
+		Residence: dto.Residence.ToModel(),
+		BirthDate: bod,
+		Email:     dto.Email,
+		Role:      role,
+	}
+	if err := validate.User(user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 // FromModel returns a dto from model struct
@@ -62,16 +104,22 @@ func (dto UserDto) FromModel(m *model.User) UserDto {
 		FirstName: m.FirstName,
 		LastName:  m.LastName,
 		OIB:       m.OIB,
-		Residence: m.Residence,
+		Residence: AddressDto{}.FromModel(&m.Residence),
 		BirthDate: m.BirthDate.Format(format.DateFormat),
 		Email:     m.Email,
 		Role:      fmt.Sprint(m.Role),
-		PoliceToken: func() string {
-			if m.PoliceToken != nil {
-				return *m.PoliceToken
-			}
-			return ""
-		}(),
 	}
 	return dto
 }
+
+// UserSearchResultDto is a user found by a search and how well they matched,
+// the score is between 0 and 1
+type UserSearchResultDto struct {
+	UserDto
+	Score float64 `json:"score"`
+}
+
+// FromModel returns a dto from a found user and their score
+func (dto UserSearchResultDto) FromModel(m *model.User, score float64) UserSearchResultDto {
+	return UserSearchResultDto{UserDto: UserDto{}.FromModel(m), Score: score}
+}
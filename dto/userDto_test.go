@@ -29,8 +29,8 @@ func TestUserDto_ToModel(t *testing.T) {
 				Uuid:      validUUID.String(),
 				FirstName: "John",
 				LastName:  "Doe",
-				OIB:       "12345678901",
-				Residence: "123 Main St",
+				OIB:       "12345678903",
+				Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 				BirthDate: validDateStr,
 				Email:     "john.doe@example.com",
 				Role:      "osoba",
@@ -39,8 +39,8 @@ func TestUserDto_ToModel(t *testing.T) {
 				Uuid:      validUUID,
 				FirstName: "John",
 				LastName:  "Doe",
-				OIB:       "12345678901",
-				Residence: "123 Main St",
+				OIB:       "12345678903",
+				Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 				BirthDate: validTime,
 				Email:     "john.doe@example.com",
 				Role:      model.RoleOsoba,
@@ -114,8 +114,8 @@ func TestUserDto_FromModel(t *testing.T) {
 		Uuid:      userUUID,
 		FirstName: "Alice",
 		LastName:  "Smith",
-		OIB:       "09876543210",
-		Residence: "456 Oak Ave",
+		OIB:       "09876543211",
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		BirthDate: birthTime,
 		Email:     "alice.smith@example.com",
 		Role:      model.RoleFirma,
@@ -125,8 +125,8 @@ func TestUserDto_FromModel(t *testing.T) {
 		Uuid:      userUUID.String(),
 		FirstName: "Alice",
 		LastName:  "Smith",
-		OIB:       "09876543210",
-		Residence: "456 Oak Ave",
+		OIB:       "09876543211",
+		Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		BirthDate: "1985-07-20",
 		Email:     "alice.smith@example.com",
 		Role:      "firma",
@@ -0,0 +1,205 @@
+package dto
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/validate"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// userImportColumns are the header cells of an import sheet, in any order
+var userImportColumns = []string{
+	"firstName", "lastName", "oib", "street", "houseNumber", "postalCode", "settlement", "birthDate", "email", "role",
+}
+
+// importDateFormats are the birth date formats accepted besides spreadsheet
+// date cells, Croatian locale writes dates as 31.12.1990.
+var importDateFormats = []string{format.DateFormat, "02.01.2006.", "02.01.2006", "2.1.2006."}
+
+// excelEpoch is day zero of spreadsheet date serial numbers
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// UserImportRowsFromSheet maps the rows of an import sheet to users, the
+// first row is the header. Rows that fail validation keep their field errors.
+func UserImportRowsFromSheet(rows [][]string, maxRows int) ([]model.UserImportRow, error) {
+	if len(rows) == 0 {
+		return nil, cerror.ErrInvalidSheet
+	}
+	if len(rows)-1 > maxRows {
+		return nil, fmt.Errorf("%w, at most %d are allowed", cerror.ErrTooManyRows, maxRows)
+	}
+
+	columns := map[string]int{}
+	for i, cell := range rows[0] {
+		columns[headerKey(cell)] = i
+	}
+	for _, column := range userImportColumns {
+		if _, ok := columns[headerKey(column)]; !ok {
+			return nil, fmt.Errorf("%w, missing column %s", cerror.ErrInvalidSheet, column)
+		}
+	}
+
+	rez := make([]model.UserImportRow, 0, len(rows)-1)
+	for i, cells := range rows[1:] {
+		if isEmptyRow(cells) {
+			continue
+		}
+		cell := func(column string) string {
+			if col := columns[headerKey(column)]; col < len(cells) {
+				return cells[col]
+			}
+			return ""
+		}
+		rez = append(rez, userImportRow(i+2, cell))
+	}
+	return rez, nil
+}
+
+func userImportRow(line int, cell func(column string) string) model.UserImportRow {
+	row := model.UserImportRow{
+		Line: line,
+		User: model.User{
+			Uuid:      uuid.New(),
+			FirstName: cell("firstName"),
+			LastName:  cell("lastName"),
+			OIB:       cell("oib"),
+			Residence: model.Address{
+				Street:      cell("street"),
+				HouseNumber: cell("houseNumber"),
+				PostalCode:  cell("postalCode"),
+				Settlement:  cell("settlement"),
+			},
+			Email: strings.ToLower(cell("email")),
+		},
+	}
+	fail := func(field string, err error) {
+		row.Errors = append(row.Errors, &cerror.FieldError{Field: field, Err: err})
+	}
+
+	for _, column := range userImportColumns {
+		if cell(column) == "" {
+			fail(column, cerror.ErrRequired)
+		}
+	}
+	if row.User.OIB != "" {
+		if err := validate.Oib(row.User.OIB); err != nil {
+			fail("oib", err)
+		}
+	}
+	if row.User.Email != "" {
+		if err := validate.Email(row.User.Email); err != nil {
+			fail("email", err)
+		}
+	}
+	if address := row.User.Residence; address.Street != "" && address.HouseNumber != "" &&
+		address.PostalCode != "" && address.Settlement != "" {
+		if err := validate.Address("", &row.User.Residence); err != nil {
+			row.Errors = append(row.Errors, cerror.FieldErrors(err)...)
+		}
+	}
+	if text := cell("birthDate"); text != "" {
+		birthDate, err := parseImportDate(text)
+		if err == nil {
+			err = validate.BirthDate(birthDate)
+		}
+		if err != nil {
+			fail("birthDate", err)
+		}
+		row.User.BirthDate = birthDate
+	}
+	if text := cell("role"); text != "" {
+		role, err := model.StoUserRole(strings.ToLower(text))
+		switch {
+		case err != nil:
+			fail("role", cerror.ErrUnknownRole)
+		case role == model.RoleSuperAdmin:
+			// super admins are never created in bulk
+			fail("role", cerror.ErrBadRole)
+		}
+		row.User.Role = role
+	}
+	return row
+}
+
+// parseImportDate parses a date written as text or a spreadsheet date serial number
+func parseImportDate(text string) (time.Time, error) {
+	for _, layout := range importDateFormats {
+		if date, err := time.Parse(layout, text); err == nil {
+			return date, nil
+		}
+	}
+	if days, err := strconv.Atoi(text); err == nil && days > 0 {
+		return excelEpoch.AddDate(0, 0, days), nil
+	}
+	return time.Time{}, cerror.ErrBadDateFormat
+}
+
+// headerKey matches header cells regardless of case, spaces and underscores
+func headerKey(cell string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(cell))
+}
+
+func isEmptyRow(cells []string) bool {
+	for _, cell := range cells {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// UserImportErrorDto is a violation found on a row of an import sheet
+type UserImportErrorDto struct {
+	Row int `json:"row"`
+	ViolationDto
+}
+
+// ImportedCodeDto is the activation code issued to an imported police
+// officer, unlike ActivationCodeDto it has the code itself
+type ImportedCodeDto struct {
+	Row       int    `json:"row"`
+	Uuid      string `json:"uuid"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Code      string `json:"code"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// FromModel returns a dto from an imported row
+func (dto ImportedCodeDto) FromModel(m *model.UserImportRow) ImportedCodeDto {
+	return ImportedCodeDto{
+		Row:       m.Line,
+		Uuid:      m.User.Uuid.String(),
+		Email:     m.User.Email,
+		FirstName: m.User.FirstName,
+		LastName:  m.User.LastName,
+		Code:      m.ActivationCode,
+		ExpiresAt: m.ActivationExpiresAt.Format(format.DateTimeFormat),
+	}
+}
+
+// ImportedCodeSheetHeader is the header row of the activation code sheet
+var ImportedCodeSheetHeader = []string{"row", "uuid", "email", "firstName", "lastName", "code", "expiresAt"}
+
+// SheetRow returns the code as a row of the activation code sheet
+func (dto ImportedCodeDto) SheetRow() []string {
+	return []string{strconv.Itoa(dto.Row), dto.Uuid, dto.Email, dto.FirstName, dto.LastName, dto.Code, dto.ExpiresAt}
+}
+
+// UserImportReportDto is the result of an import, nothing is created if
+// it is a dry run or any row has errors
+type UserImportReportDto struct {
+	DryRun          bool                 `json:"dryRun"`
+	Total           int                  `json:"total"`
+	Valid           int                  `json:"valid"`
+	Created         int                  `json:"created"`
+	Errors          []UserImportErrorDto `json:"errors"`
+	ActivationCodes []ImportedCodeDto    `json:"activationCodes"`
+}
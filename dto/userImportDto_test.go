@@ -0,0 +1,69 @@
+package dto_test
+
+import (
+	"ePrometna_Server/dto"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserImportRowsFromSheet(t *testing.T) {
+	rows, err := dto.UserImportRowsFromSheet([][]string{
+		{"Email", "First Name", "last_name", "OIB", "street", "House Number", "postal_code", "settlement", "birthDate", "role"},
+		{"Ivan@Example.com", "Ivan", "Horvat", "69435151530", "Ilica", "1", "10000", "Zagreb", "20.03.1995.", "Policija"},
+		{},
+		{"ana@example.com", "Ana", "Kovač", "94577403194", "Riva", "10", "21000", "Split", "34778", "osoba"},
+		{"bad", "", "Perić", "12345678900", "Korzo", "1", "510", "Rijeka", "1995/03/20", "admin"},
+		{"marko@example.com", "Marko", "Babić", "12345678903", "Europska avenija", "2", "31000", "Osijek", "1995-03-20", "superadmin"},
+	}, 10)
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+
+	assert.Equal(t, 2, rows[0].Line)
+	assert.Empty(t, rows[0].Errors)
+	assert.Equal(t, "ivan@example.com", rows[0].User.Email)
+	assert.Equal(t, "Horvat", rows[0].User.LastName)
+	assert.Equal(t, model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}, rows[0].User.Residence)
+	assert.Equal(t, model.RolePolicija, rows[0].User.Role)
+	assert.Equal(t, time.Date(1995, 3, 20, 0, 0, 0, 0, time.UTC), rows[0].User.BirthDate)
+	assert.NotEmpty(t, rows[0].User.Uuid)
+
+	// the empty row is skipped, lines still match the sheet
+	assert.Equal(t, 4, rows[1].Line)
+	assert.Empty(t, rows[1].Errors)
+	assert.Equal(t, time.Date(1995, 3, 20, 0, 0, 0, 0, time.UTC), rows[1].User.BirthDate)
+
+	fields := map[string]error{}
+	for _, fieldErr := range rows[2].Errors {
+		fields[fieldErr.Field] = fieldErr.Err
+	}
+	assert.Equal(t, map[string]error{
+		"firstName":  cerror.ErrRequired,
+		"oib":        cerror.ErrInvalidOib,
+		"email":      cerror.ErrInvalidEmail,
+		"postalCode": cerror.ErrBadPostalCode,
+		"birthDate":  cerror.ErrBadDateFormat,
+		"role":       cerror.ErrUnknownRole,
+	}, fields)
+
+	require.Len(t, rows[3].Errors, 1)
+	assert.ErrorIs(t, rows[3].Errors[0], cerror.ErrBadRole)
+}
+
+func TestUserImportRowsFromSheet_Invalid(t *testing.T) {
+	_, err := dto.UserImportRowsFromSheet(nil, 10)
+	assert.ErrorIs(t, err, cerror.ErrInvalidSheet)
+
+	_, err = dto.UserImportRowsFromSheet([][]string{{"firstName", "lastName", "oib", "street", "houseNumber", "settlement", "email", "role"}}, 10)
+	assert.ErrorIs(t, err, cerror.ErrInvalidSheet)
+	assert.ErrorContains(t, err, "postalCode")
+
+	_, err = dto.UserImportRowsFromSheet([][]string{
+		{"firstName", "lastName", "oib", "street", "houseNumber", "postalCode", "settlement", "birthDate", "email", "role"}, {"a"}, {"b"},
+	}, 1)
+	assert.ErrorIs(t, err, cerror.ErrTooManyRows)
+}
@@ -0,0 +1,15 @@
+package dto
+
+type ViolationDto struct {
+	// Field is set if the violation is about a single input field
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorDto is returned when input breaks one or more rules,
+// messages are localized with the Accept-Language header
+type ValidationErrorDto struct {
+	Error      string         `json:"error"`
+	Violations []ViolationDto `json:"violations"`
+}
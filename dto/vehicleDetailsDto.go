@@ -12,6 +12,7 @@ type VehicleDetailsDto struct {
 	Uuid             string            `json:"uuid"`
 	Registration     string            `json:"registration"`
 	Owner            UserDto           `json:"owner"`
+	Organisation     *OrganisationDto  `json:"organisation,omitempty"`
 	Drivers          []UserDto         `json:"drivers"`
 	PastOwners       []UserDto         `json:"pastOwners"`
 	PastRegistration []RegistrationDto `json:"pastRegistration"`
@@ -179,6 +180,10 @@ func (dto VehicleDetailsDto) FromModel(m *model.Vehicle) VehicleDetailsDto {
 	if m.Owner != nil {
 		result.Owner = UserDto{}.FromModel(m.Owner)
 	}
+	if m.Organisation != nil {
+		organisation := OrganisationDto{}.FromModel(m.Organisation)
+		result.Organisation = &organisation
+	}
 
 	// Convert drivers
 	if len(m.Drivers) != 0 {
@@ -199,10 +204,10 @@ func (dto VehicleDetailsDto) FromModel(m *model.Vehicle) VehicleDetailsDto {
 	if len(m.PastOwners) != 0 {
 		for _, pastOwnerEntry := range m.PastOwners {
 			// Check if the User field within OwnerHistory was preloaded
-			if pastOwnerEntry.User.ID != 0 { // Check if User is a valid, non-zero-ID user
+			if pastOwnerEntry.User != nil && pastOwnerEntry.User.ID != 0 { // Check if User is a valid, non-zero-ID user
 				var pastOwnerUserDto UserDto
-				result.PastOwners = append(result.PastOwners, pastOwnerUserDto.FromModel(&pastOwnerEntry.User))
-			} else {
+				result.PastOwners = append(result.PastOwners, pastOwnerUserDto.FromModel(pastOwnerEntry.User))
+			} else if pastOwnerEntry.OrganisationId == nil {
 				zap.S().Warnf("Vehicle UUID %s: Past owner entry (OwnerHistory ID: %d) has no preloaded User details (or User ID is 0). Skipping.", m.Uuid, pastOwnerEntry.ID)
 			}
 		}
@@ -98,7 +98,7 @@ func TestVehicleDetailsDto_FromModel(t *testing.T) {
 			FirstName: "OwnerF",
 			LastName:  "OwnerL",
 			OIB:       "12312312312",
-			Residence: "Owner Residence",
+			Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 			BirthDate: ownerBirthDate,
 			Email:     "owner@example.com",
 			Role:      model.RoleOsoba,
@@ -129,7 +129,7 @@ func TestVehicleDetailsDto_FromModel(t *testing.T) {
 			FirstName: "OwnerF",
 			LastName:  "OwnerL",
 			OIB:       "12312312312",
-			Residence: "Owner Residence",
+			Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 			BirthDate: "1980-01-01",
 			Email:     "owner@example.com",
 			Role:      "osoba",
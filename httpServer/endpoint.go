@@ -31,4 +31,21 @@ func setupHandlers(router *gin.Engine) {
 	controller.NewVehicleController().RegisterEndpoints(api)
 	controller.NewLicenseController().RegisterEndpoints(api)
 	controller.NewTempDataController().RegisterEndpoints(api)
+	controller.NewMfaController().RegisterEndpoints(api)
+	controller.NewLockController().RegisterEndpoints(api)
+	controller.NewPasswordResetController().RegisterEndpoints(api)
+	controller.NewOidcController().RegisterEndpoints(api)
+	controller.NewPermissionController().RegisterEndpoints(api)
+	controller.NewDeviceController().RegisterEndpoints(api)
+	controller.NewApiKeyController().RegisterEndpoints(api)
+	controller.NewImpersonationController().RegisterEndpoints(api)
+	controller.NewDataExportController().RegisterEndpoints(api)
+	controller.NewErasureController().RegisterEndpoints(api)
+	controller.NewProfileController().RegisterEndpoints(api)
+	controller.NewUserImportController().RegisterEndpoints(api)
+	controller.NewOrganisationController().RegisterEndpoints(api)
+
+	keyController := controller.NewKeyController()
+	keyController.RegisterEndpoints(api)
+	keyController.RegisterWellKnown(router)
 }
@@ -2,7 +2,9 @@ package httpServer
 
 import (
 	"context"
+	"ePrometna_Server/app"
 	"ePrometna_Server/config"
+	"ePrometna_Server/service"
 	"fmt"
 	"net/http"
 	"os"
@@ -17,6 +19,15 @@ import (
 
 var signalNotificationCh = make(chan os.Signal, 1)
 
+const (
+	revokedTokenCleanupInterval  = time.Hour
+	revokedTokenReloadInterval   = 15 * time.Second
+	signingKeyReloadInterval     = time.Minute
+	loginThrottleCleanupInterval = time.Hour
+	permissionReloadInterval     = time.Minute
+	erasureRunInterval           = time.Hour
+)
+
 func Start() {
 	// relay selected signals to channel
 	// - os.Interrupt, ctrl-c
@@ -33,6 +44,30 @@ func Start() {
 	go checkInterrupt(schedulerCtx, &schedulerWg, schedulerCancel)
 	zap.S().Debugf("Started CheckInterrupt")
 
+	schedulerWg.Add(1)
+	go cleanupRevokedTokens(schedulerCtx, &schedulerWg)
+	zap.S().Debugf("Started revoked token cleanup")
+
+	schedulerWg.Add(1)
+	go reloadRevokedTokens(schedulerCtx, &schedulerWg)
+	zap.S().Debugf("Started revoked token reload")
+
+	schedulerWg.Add(1)
+	go reloadSigningKeys(schedulerCtx, &schedulerWg)
+	zap.S().Debugf("Started signing key reload")
+
+	schedulerWg.Add(1)
+	go cleanupLoginThrottles(schedulerCtx, &schedulerWg)
+	zap.S().Debugf("Started login throttle cleanup")
+
+	schedulerWg.Add(1)
+	go reloadPermissions(schedulerCtx, &schedulerWg)
+	zap.S().Debugf("Started permission reload")
+
+	schedulerWg.Add(1)
+	go runErasures(schedulerCtx, &schedulerWg)
+	zap.S().Debugf("Started erasure and retention run")
+
 	schedulerWg.Add(1)
 	go run(schedulerCtx, &schedulerWg)
 	zap.S().Debugf("Started HTTP server")
@@ -59,6 +94,169 @@ func checkInterrupt(ctx context.Context, wg *sync.WaitGroup, schedulerCancel con
 	}
 }
 
+// cleanupRevokedTokens periodically drops denylist entries of tokens that expired
+func cleanupRevokedTokens(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var store service.ITokenRevocationService
+	app.Invoke(func(s service.ITokenRevocationService) {
+		store = s
+	})
+
+	ticker := time.NewTicker(revokedTokenCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			zap.S().Debugf("Terminated revoked token cleanup")
+			return
+
+		case <-ticker.C:
+			if err := store.Cleanup(); err != nil {
+				zap.S().Errorf("Revoked token cleanup failed, err = %+v", err)
+			}
+		}
+	}
+}
+
+// reloadRevokedTokens picks up tokens revoked by other instances
+func reloadRevokedTokens(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var store service.ITokenRevocationService
+	app.Invoke(func(s service.ITokenRevocationService) {
+		store = s
+	})
+
+	ticker := time.NewTicker(revokedTokenReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			zap.S().Debugf("Terminated revoked token reload")
+			return
+
+		case <-ticker.C:
+			if err := store.Load(); err != nil {
+				zap.S().Errorf("Revoked token reload failed, err = %+v", err)
+			}
+		}
+	}
+}
+
+// reloadSigningKeys picks up keys rotated or retired by other instances
+func reloadSigningKeys(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var keys service.ISigningKeyService
+	app.Invoke(func(s service.ISigningKeyService) {
+		keys = s
+	})
+
+	ticker := time.NewTicker(signingKeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			zap.S().Debugf("Terminated signing key reload")
+			return
+
+		case <-ticker.C:
+			if err := keys.Load(); err != nil {
+				zap.S().Errorf("Signing key reload failed, err = %+v", err)
+			}
+		}
+	}
+}
+
+// cleanupLoginThrottles periodically drops failed attempt counters that expired
+func cleanupLoginThrottles(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var throttle service.ILoginThrottleService
+	app.Invoke(func(s service.ILoginThrottleService) {
+		throttle = s
+	})
+
+	ticker := time.NewTicker(loginThrottleCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			zap.S().Debugf("Terminated login throttle cleanup")
+			return
+
+		case <-ticker.C:
+			if err := throttle.Cleanup(); err != nil {
+				zap.S().Errorf("Login throttle cleanup failed, err = %+v", err)
+			}
+		}
+	}
+}
+
+// reloadPermissions picks up permissions changed by other instances
+func reloadPermissions(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var permissions service.IPermissionService
+	app.Invoke(func(s service.IPermissionService) {
+		permissions = s
+	})
+
+	ticker := time.NewTicker(permissionReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			zap.S().Debugf("Terminated permission reload")
+			return
+
+		case <-ticker.C:
+			if err := permissions.Load(); err != nil {
+				zap.S().Errorf("Permission reload failed, err = %+v", err)
+			}
+		}
+	}
+}
+
+// runErasures periodically erases users whose grace period passed and purges
+// records whose retention period passed
+func runErasures(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var erasure service.IErasureService
+	app.Invoke(func(s service.IErasureService) {
+		erasure = s
+	})
+
+	ticker := time.NewTicker(erasureRunInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			zap.S().Debugf("Terminated erasure and retention run")
+			return
+
+		case <-ticker.C:
+			if err := erasure.Run(); err != nil {
+				zap.S().Errorf("Erasure and retention run failed, err = %+v", err)
+			}
+		}
+	}
+}
+
 func run(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -66,6 +264,9 @@ func run(ctx context.Context, wg *sync.WaitGroup) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	router := gin.Default()
+	if err := router.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		zap.S().Panicf("Invalid trusted proxies err = %+v", err)
+	}
 	setupHandlers(router)
 
 	addr := fmt.Sprintf(":%d", config.AppConfig.Port)
@@ -5,7 +5,11 @@ import (
 	"ePrometna_Server/config"
 	"ePrometna_Server/httpServer"
 	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/device"
+	"ePrometna_Server/util/postal"
 	"ePrometna_Server/util/seed"
+	"ePrometna_Server/util/validate"
 
 	"go.uber.org/zap"
 )
@@ -25,6 +29,88 @@ func main() {
 	app.Provide(service.NewVehicleService)
 	app.Provide(service.NewDriverLicenseService)
 	app.Provide(service.NewTempDataService)
+	app.Provide(service.NewAccessPolicyService)
+	app.Provide(service.NewTokenRevocationService)
+	app.Provide(service.NewSigningKeyService)
+	app.Provide(service.NewMfaService)
+	app.Provide(service.NewLoginThrottleService)
+	app.Provide(service.NewOutboxService)
+	app.Provide(service.NewMailer)
+	app.Provide(service.NewPasswordResetService)
+	app.Provide(service.NewPermissionService)
+	app.Provide(service.NewDeviceService)
+	app.Provide(service.NewPoliceCodeService)
+	app.Provide(service.NewOidcService)
+	app.Provide(service.NewApiKeyService)
+	app.Provide(service.NewImpersonationService)
+	app.Provide(service.NewDataExportService)
+	app.Provide(service.NewErasureService)
+	app.Provide(service.NewProfileService)
+	app.Provide(service.NewUserImportService)
+	app.Provide(service.NewOrganisationService)
+
+	// Access and device tokens are signed with keys from the database
+	app.Invoke(func(keys service.ISigningKeyService) {
+		if err := keys.Load(); err != nil {
+			zap.S().Panicf("Failed to load signing keys, err = %+v", err)
+		}
+	})
+
+	// Revoked tokens are checked by middleware.Protect
+	app.Invoke(func(store service.ITokenRevocationService) {
+		if err := store.Load(); err != nil {
+			zap.S().Panicf("Failed to load revoked tokens, err = %+v", err)
+		}
+		auth.SetRevocationStore(store)
+	})
+
+	// Permissions are checked by middleware.Protect
+	app.Invoke(func(permissions service.IPermissionService) {
+		if err := permissions.Load(); err != nil {
+			zap.S().Panicf("Failed to load permissions, err = %+v", err)
+		}
+	})
+
+	// Integrations call protected routes with API keys
+	app.Invoke(func(keys service.IApiKeyService) {
+		auth.SetApiKeyStore(keys)
+	})
+
+	// Requests made while impersonating a user are written to the audit trail
+	app.Invoke(func(impersonation service.IImpersonationService) {
+		auth.SetImpersonationAuditor(impersonation)
+	})
+
+	// Mobile routes only accept the token stored on the registered device
+	auth.SetDeviceStore(device.NewDeviceManager())
+
+	// Sensitive mobile routes are signed with attested device keys
+	if err := device.ConfigureAttestation(config.AppConfig); err != nil {
+		zap.S().Panicf("Failed to configure device attestation, err = %+v", err)
+	}
+	if !config.AppConfig.DeviceSignatures {
+		zap.S().Warn("Device signatures are off, sensitive mobile routes only need a device token")
+	}
+
+	// New passwords are checked against the policy
+	policy, err := auth.NewPasswordPolicy(
+		config.AppConfig.PasswordMinLength,
+		config.AppConfig.PasswordMinClasses,
+		config.AppConfig.PasswordBreachedList,
+	)
+	if err != nil {
+		zap.S().Panicf("Failed to load password policy, err = %+v", err)
+	}
+	auth.SetPasswordPolicy(policy)
+	zap.S().Infof("Loaded password policy with %d breached passwords", policy.BreachedCount())
+
+	// Residence addresses are checked against the postal codebook
+	codebook, err := postal.LoadAtLeast(config.AppConfig.PostalCodebook, config.AppConfig.PostalCodebookMinPlaces)
+	if err != nil {
+		zap.S().Panicf("Failed to load postal codebook, err = %+v", err)
+	}
+	validate.SetPostalCodebook(codebook)
+	zap.S().Infof("Loaded postal codebook with %d places", codebook.Len())
 
 	zap.S().Infof("Database: http://localhost:8080")
 	zap.S().Infof("swagger: http://localhost:8090/swagger/index.html")
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"strings"
+)
+
+// Address is a residence address, the postal code, settlement and county
+// come from the postal codebook
+type Address struct {
+	Street      string `gorm:"type:varchar(255);not null;default:''"`
+	HouseNumber string `gorm:"type:varchar(20);not null;default:''"`
+	PostalCode  string `gorm:"type:char(5);not null;default:''"`
+	Settlement  string `gorm:"type:varchar(100);not null;default:''"`
+	County      string `gorm:"type:varchar(100);not null;default:''"`
+}
+
+// ResidenceColumns are the columns of User.Residence
+var ResidenceColumns = []string{
+	"residence_street", "residence_house_number", "residence_postal_code",
+	"residence_settlement", "residence_county",
+}
+
+// String formats the address as it's written on letters, e.g. Ilica 1, 10000 Zagreb
+func (a Address) String() string {
+	street := strings.TrimSpace(a.Street + " " + a.HouseNumber)
+	place := strings.TrimSpace(a.PostalCode + " " + a.Settlement)
+	if street == "" || place == "" {
+		return street + place
+	}
+	return street + ", " + place
+}
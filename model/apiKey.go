@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ApiKey lets a system of an organisation call the API without a user login.
+// Requests get the role of the key limited to its scopes, only a hash of the
+// key is stored.
+type ApiKey struct {
+	gorm.Model
+	Uuid         uuid.UUID    `gorm:"type:uuid;unique;not null"`
+	Name         string       `gorm:"type:varchar(100);not null"`
+	Organisation string       `gorm:"type:varchar(255);index;not null"`
+	Role         UserRole     `gorm:"type:varchar(20);not null"`
+	Scopes       []Permission `gorm:"type:text;serializer:json;not null"`
+	// IpAllowlist holds addresses and CIDR ranges, an empty list allows any address
+	IpAllowlist []string `gorm:"type:text;serializer:json;not null"`
+	// Prefix is the start of the key shown to tell keys apart
+	Prefix     string     `gorm:"type:varchar(16);not null"`
+	KeyHash    string     `gorm:"type:char(64);unique;not null"`
+	ExpiresAt  time.Time  `gorm:"type:timestamp;not null"`
+	LastUsedAt *time.Time `gorm:"type:timestamp;null"`
+	LastUsedIp string     `gorm:"type:varchar(45)"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid;not null"`
+	RevokedAt  *time.Time `gorm:"type:timestamp;null"`
+	RevokedBy  *uuid.UUID `gorm:"type:uuid;null"`
+}
+
+// IsActive reports whether the key can still be used
+func (k *ApiKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
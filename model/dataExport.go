@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// UserDataExport is everything stored about a user, it answers a subject
+// access request. Secrets (password and TOTP secret, tokens, key hashes) are
+// not part of it.
+type UserDataExport struct {
+	User User
+	// Vehicles are owned by the user now
+	Vehicles []Vehicle
+	// OwnerHistory are vehicles the user owned before, CreatedAt is when the
+	// vehicle got a new owner
+	OwnerHistory []OwnerHistory
+	// DriverGrants let the user drive vehicles of other owners
+	DriverGrants []VehicleDrivers
+	License      *DriverLicense
+	Devices      []Mobile
+	TempData     []TempData
+	Totp         *UserTotp
+	Identities   []OidcIdentity
+	// Sessions are the refresh tokens issued to the user, one per login or refresh
+	Sessions       []RefreshToken
+	LockEvents     []LockEvent
+	Impersonations []ImpersonationSession
+	// Memberships are the organisations of the user with the organisation loaded
+	Memberships []OrganisationMember
+	// Invitations are pending invitations to organisations with the organisation loaded
+	Invitations []OrganisationInvitation
+	// Referenced are the vehicles history, grants and temp data refer to, by id
+	Referenced  map[uint]Vehicle
+	GeneratedAt time.Time
+}
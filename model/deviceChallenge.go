@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeviceChallenge is a nonce issued to a device, the device signs it with its
+// key to authorize a single sensitive request. Only a hash of the nonce is stored.
+type DeviceChallenge struct {
+	gorm.Model
+	MobileId  uint       `gorm:"type:uint;index;not null"`
+	Mobile    Mobile     `gorm:"foreignKey:MobileId;constraint:OnDelete:CASCADE"`
+	NonceHash string     `gorm:"type:char(64);unique;not null"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp;null"`
+}
+
+// IsActive reports whether the challenge can still be answered
+func (c *DeviceChallenge) IsActive(now time.Time) bool {
+	return c.UsedAt == nil && now.Before(c.ExpiresAt)
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailChangeToken is a single use token mailed to the new address of a
+// user, the address is changed once it is confirmed. Only a hash of the
+// token is stored.
+type EmailChangeToken struct {
+	gorm.Model
+	UserId    uint       `gorm:"type:uint;index;not null"`
+	User      User       `gorm:"foreignKey:UserId"`
+	NewEmail  string     `gorm:"type:varchar(100);not null"`
+	TokenHash string     `gorm:"type:char(64);unique;not null"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp;null"`
+}
+
+// IsActive reports whether the token can still be used
+func (t *EmailChangeToken) IsActive(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
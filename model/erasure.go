@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ErasurePending   = "pending"
+	ErasureCancelled = "cancelled"
+	ErasureCompleted = "completed"
+)
+
+// Actions taken on the records of an entity when a user is erased
+const (
+	ErasurePseudonymize = "pseudonymize"
+	ErasureUnlink       = "unlink"
+	ErasurePurge        = "purge"
+)
+
+// ErasureRequest asks for the personal data of a user to be erased, it can be
+// cancelled until EraseAfter. UserUuid is kept since the user is pseudonymized.
+type ErasureRequest struct {
+	gorm.Model
+	Uuid            uuid.UUID       `gorm:"type:uuid;unique;not null"`
+	UserId          uint            `gorm:"type:uint;index;not null"`
+	UserUuid        uuid.UUID       `gorm:"type:uuid;index;not null"`
+	RequestedByUuid uuid.UUID       `gorm:"type:uuid;not null"`
+	Status          string          `gorm:"type:varchar(20);index;not null"`
+	EraseAfter      time.Time       `gorm:"type:timestamp;not null"`
+	CancelledAt     *time.Time      `gorm:"type:timestamp;null"`
+	ErasedAt        *time.Time      `gorm:"type:timestamp;null"`
+	Actions         []ErasureAction `gorm:"foreignKey:ErasureRequestId"`
+}
+
+// ErasureAction is what was done to the records of an entity that referred to
+// an erased user. Records under a retention period are purged by a later run
+// once RetainUntil passed, DoneAt is set when nothing is left to do.
+type ErasureAction struct {
+	gorm.Model
+	ErasureRequestId uint       `gorm:"type:uint;index;not null"`
+	Entity           string     `gorm:"type:varchar(50);not null"`
+	Action           string     `gorm:"type:varchar(20);not null"`
+	Count            int64      `gorm:"not null"`
+	RetainUntil      *time.Time `gorm:"type:timestamp;null"`
+	DoneAt           *time.Time `gorm:"type:timestamp;null"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImpersonationSession is started when a superadmin acts as another user,
+// Uuid is the id (jti) of the impersonation token
+type ImpersonationSession struct {
+	gorm.Model
+	Uuid        uuid.UUID  `gorm:"type:uuid;unique;not null"`
+	ActorUuid   uuid.UUID  `gorm:"type:uuid;index;not null"`
+	SubjectUuid uuid.UUID  `gorm:"type:uuid;index;not null"`
+	Reason      string     `gorm:"type:varchar(500);not null"`
+	Ip          string     `gorm:"type:varchar(45)"`
+	ExpiresAt   time.Time  `gorm:"type:timestamp;not null"`
+	EndedAt     *time.Time `gorm:"type:timestamp;null"`
+}
+
+// IsActive reports whether the impersonation token can still be used
+func (s *ImpersonationSession) IsActive(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// ImpersonationRequest is the audit trail entry of a request made during an
+// impersonation session
+type ImpersonationRequest struct {
+	gorm.Model
+	SessionUuid uuid.UUID `gorm:"type:uuid;index;not null"`
+	Method      string    `gorm:"type:varchar(10);not null"`
+	Path        string    `gorm:"type:varchar(255);not null"`
+	Status      int       `gorm:"not null"`
+	Ip          string    `gorm:"type:varchar(45)"`
+	// Blocked is set when the request was refused because of the impersonation
+	Blocked bool `gorm:"not null;default:false"`
+}
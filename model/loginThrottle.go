@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ThrottleScope string
+
+const (
+	// ThrottleScopeEmail counts failed logins per account email
+	ThrottleScopeEmail ThrottleScope = "email"
+	// ThrottleScopeIp counts failed logins per client IP
+	ThrottleScopeIp ThrottleScope = "ip"
+	// ThrottleScopePolice counts failed police code registrations per client IP
+	ThrottleScopePolice ThrottleScope = "police"
+	// ThrottleScopeReset counts password reset requests per account email
+	ThrottleScopeReset ThrottleScope = "reset"
+	// ThrottleScopeResetIp counts password reset requests per client IP
+	ThrottleScopeResetIp ThrottleScope = "reset_ip"
+	// ThrottleScopeEmailChange counts email confirmation mails per user uuid
+	ThrottleScopeEmailChange ThrottleScope = "email_change"
+)
+
+// LoginThrottle counts failed attempts for a scope and key (email or IP).
+// The row is removed on successful login or when an admin unlocks it.
+type LoginThrottle struct {
+	gorm.Model
+	Scope         ThrottleScope `gorm:"type:varchar(20);uniqueIndex:idx_login_throttle_key;not null"`
+	Key           string        `gorm:"type:varchar(255);uniqueIndex:idx_login_throttle_key;not null"`
+	Failures      int           `gorm:"not null;default:0"`
+	LastFailureAt time.Time     `gorm:"type:timestamp;index;not null"`
+	LockedUntil   *time.Time    `gorm:"type:timestamp;null"`
+}
+
+// LockEvent is recorded every time a throttle key gets locked, it is kept
+// after the lock expires so admins can review it
+type LockEvent struct {
+	gorm.Model
+	Uuid        uuid.UUID     `gorm:"type:uuid;unique;not null"`
+	Scope       ThrottleScope `gorm:"type:varchar(20);not null"`
+	Key         string        `gorm:"type:varchar(255);index;not null"`
+	Failures    int           `gorm:"not null"`
+	LockedUntil time.Time     `gorm:"type:timestamp;not null"`
+	UnlockedAt  *time.Time    `gorm:"type:timestamp;null"`
+	UnlockedBy  *uuid.UUID    `gorm:"type:uuid;null"`
+}
+
+// IsActive reports whether the lock still blocks attempts
+func (e *LockEvent) IsActive(now time.Time) bool {
+	return e.UnlockedAt == nil && now.Before(e.LockedUntil)
+}
@@ -1,15 +1,44 @@
 package model
 
 import (
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Mobile is a device registered to a user, the activation token is the only
+// device token accepted from it. PublicKey is the key the app signs request
+// challenges with, AttestedAt is set when the key was attested by the platform.
 type Mobile struct {
 	gorm.Model
-	Uuid             uuid.UUID `gorm:"type:uuid;unique;not null"`
-	UserId           uint      `gorm:"type:uint;unique;null"`
-	CreatorId        uint      `gorm:"type:uint;not null"`
-	RegisteredDevice string    `gorm:"type:varchar(50);null"`
-	ActivationToken  string    `gorm:"type:varchar(255);unique;not null"`
+	Uuid             uuid.UUID  `gorm:"type:uuid;unique;not null"`
+	UserId           uint       `gorm:"type:uint;index;not null"`
+	CreatorId        uint       `gorm:"type:uint;not null"`
+	Platform         string     `gorm:"type:varchar(30)"`
+	Brand            string     `gorm:"type:varchar(50)"`
+	ModelName        string     `gorm:"type:varchar(50)"`
+	DeviceId         string     `gorm:"type:varchar(100);not null;uniqueIndex:idx_mobile_device_id"`
+	RegisteredDevice string     `gorm:"type:varchar(255);null"`
+	ActivationToken  string     `gorm:"type:varchar(1024);unique;not null"`
+	LastSeenAt       *time.Time `gorm:"type:timestamp;null"`
+	LastSeenIp       string     `gorm:"type:varchar(45)"`
+	PublicKey        string     `gorm:"type:text"`
+	AttestedAt       *time.Time `gorm:"type:timestamp;null"`
+}
+
+// ParseDeviceName splits a name formatted as "Brand Model (Platform) [ID:id]",
+// parts that are missing are returned empty
+func ParseDeviceName(name string) (platform, brand, modelName, deviceId string) {
+	if start := strings.LastIndex(name, "[ID:"); start >= 0 && strings.HasSuffix(name, "]") {
+		deviceId = name[start+len("[ID:") : len(name)-1]
+		name = strings.TrimSpace(name[:start])
+	}
+	if start := strings.LastIndex(name, "("); start >= 0 && strings.HasSuffix(name, ")") {
+		platform = name[start+1 : len(name)-1]
+		name = strings.TrimSpace(name[:start])
+	}
+	brand, modelName, _ = strings.Cut(name, " ")
+	return platform, brand, modelName, deviceId
 }
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OidcIdentity links the subject of an external identity provider to a user
+type OidcIdentity struct {
+	gorm.Model
+	UserId      uint       `gorm:"type:uint;index;not null"`
+	User        User       `gorm:"foreignKey:UserId"`
+	Issuer      string     `gorm:"type:varchar(255);uniqueIndex:idx_oidc_subject;not null"`
+	Subject     string     `gorm:"type:varchar(255);uniqueIndex:idx_oidc_subject;not null"`
+	LastLoginAt *time.Time `gorm:"type:timestamp;null"`
+}
+
+// OidcLoginState is a sign in started at the identity provider, it is used
+// once when the provider redirects back. Only hashes of the state and of the
+// binding kept by the browser that started it are stored.
+type OidcLoginState struct {
+	gorm.Model
+	StateHash    string     `gorm:"type:char(64);unique;not null"`
+	BindingHash  string     `gorm:"type:char(64);not null;default:''"`
+	Nonce        string     `gorm:"type:varchar(64);not null"`
+	CodeVerifier string     `gorm:"type:varchar(128);not null"`
+	ExpiresAt    time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt       *time.Time `gorm:"type:timestamp;null"`
+}
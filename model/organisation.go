@@ -0,0 +1,77 @@
+package model
+
+import (
+	"ePrometna_Server/util/cerror"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OrganisationRole is the role of a member inside an organisation
+type OrganisationRole string
+
+const (
+	OrgRoleOwner        OrganisationRole = "owner"
+	OrgRoleFleetManager OrganisationRole = "fleet_manager"
+	OrgRoleDriver       OrganisationRole = "driver"
+)
+
+// StoOrganisationRole parses a known organisation role
+func StoOrganisationRole(text string) (OrganisationRole, error) {
+	switch role := OrganisationRole(text); role {
+	case OrgRoleOwner, OrgRoleFleetManager, OrgRoleDriver:
+		return role, nil
+	default:
+		return "", cerror.ErrUnknownOrgRole
+	}
+}
+
+// CanManage reports whether a member with the role may add, change and
+// remove members with other role, owners manage everyone and fleet
+// managers manage drivers
+func (r OrganisationRole) CanManage(other OrganisationRole) bool {
+	switch r {
+	case OrgRoleOwner:
+		return true
+	case OrgRoleFleetManager:
+		return other == OrgRoleDriver
+	default:
+		return false
+	}
+}
+
+// Organisation is a registered company, its vehicles are used by its members
+type Organisation struct {
+	gorm.Model
+	Uuid     uuid.UUID            `gorm:"type:uuid;unique;not null"`
+	Name     string               `gorm:"type:varchar(255);not null"`
+	OIB      string               `gorm:"type:char(11);unique;not null"`
+	Members  []OrganisationMember `gorm:"foreignKey:OrganisationId"`
+	Vehicles []Vehicle            `gorm:"foreignKey:OrganisationId"`
+}
+
+// OrganisationMember gives a user a role inside an organisation, a user is a
+// member at most once
+type OrganisationMember struct {
+	gorm.Model
+	OrganisationId uint             `gorm:"type:uint;not null;uniqueIndex:idx_organisation_member"`
+	Organisation   *Organisation    `gorm:"foreignKey:OrganisationId"`
+	UserId         uint             `gorm:"type:uint;not null;uniqueIndex:idx_organisation_member"`
+	User           User             `gorm:"foreignKey:UserId"`
+	Role           OrganisationRole `gorm:"type:varchar(20);not null"`
+}
+
+// OrganisationInvitation offers a user a role inside an organisation, they
+// become a member once they accept it. A user has at most one invitation to
+// an organisation.
+type OrganisationInvitation struct {
+	gorm.Model
+	Uuid           uuid.UUID        `gorm:"type:uuid;unique;not null"`
+	OrganisationId uint             `gorm:"type:uint;not null;uniqueIndex:idx_organisation_invitation"`
+	Organisation   *Organisation    `gorm:"foreignKey:OrganisationId"`
+	UserId         uint             `gorm:"type:uint;not null;uniqueIndex:idx_organisation_invitation"`
+	User           User             `gorm:"foreignKey:UserId"`
+	Role           OrganisationRole `gorm:"type:varchar(20);not null"`
+	ExpiresAt      time.Time        `gorm:"not null"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxMessage is an email waiting to be delivered, SentAt is set by whatever
+// delivers it
+type OutboxMessage struct {
+	gorm.Model
+	Uuid      uuid.UUID  `gorm:"type:uuid;unique;not null"`
+	Recipient string     `gorm:"type:varchar(100);index;not null"`
+	Subject   string     `gorm:"type:varchar(255);not null"`
+	Body      string     `gorm:"type:text;not null"`
+	SentAt    *time.Time `gorm:"type:timestamp;null"`
+}
@@ -9,12 +9,21 @@ type OwnerHistory struct {
 	gorm.Model
 	Uuid      uuid.UUID `gorm:"type:uuid;unique;not null"`
 	VehicleId uint      `gorm:"type:uint;not null"`
-	UserId    uint      `gorm:"type:uint;not null"`
-	User      User      `gorm:"foreignKey:UserId"`
+	// Either UserId or OrganisationId is set
+	UserId         *uint         `gorm:"type:uint;null"`
+	User           *User         `gorm:"foreignKey:UserId"`
+	OrganisationId *uint         `gorm:"type:uint;null"`
+	Organisation   *Organisation `gorm:"foreignKey:OrganisationId"`
 }
 
 func (m *OwnerHistory) FromUser(user User) *OwnerHistory {
-	m.UserId = user.ID
+	m.UserId = &user.ID
+	m.Uuid = uuid.New()
+	return m
+}
+
+func (m *OwnerHistory) FromOrganisation(organisation Organisation) *OwnerHistory {
+	m.OrganisationId = &organisation.ID
 	m.Uuid = uuid.New()
 	return m
 }
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken is a single use token sent to the user email,
+// only a hash of the token is stored
+type PasswordResetToken struct {
+	gorm.Model
+	UserId    uint       `gorm:"type:uint;index;not null"`
+	User      User       `gorm:"foreignKey:UserId"`
+	TokenHash string     `gorm:"type:char(64);unique;not null"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt    *time.Time `gorm:"type:timestamp;null"`
+}
+
+// IsActive reports whether the token can still be used
+func (t *PasswordResetToken) IsActive(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
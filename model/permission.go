@@ -0,0 +1,168 @@
+package model
+
+import (
+	"ePrometna_Server/util/cerror"
+
+	"gorm.io/gorm"
+)
+
+// Permission is a named action that can be assigned to roles
+type Permission string
+
+const (
+	PermVehicleRead      Permission = "vehicle:read"
+	PermVehicleReadOwn   Permission = "vehicle:read-own"
+	PermVehicleReadVin   Permission = "vehicle:read-vin"
+	PermVehicleReadAny   Permission = "vehicle:read-any"
+	PermVehicleManage    Permission = "vehicle:manage"
+	PermVehicleRegister  Permission = "vehicle:register"
+	PermLicenseReadAny   Permission = "license:read-any"
+	PermLicenseManageAny Permission = "license:manage-any"
+	PermTempDataCreate   Permission = "tempdata:create"
+	PermTempDataConsume  Permission = "tempdata:consume"
+	PermUserRead         Permission = "user:read"
+	PermUserReadOib      Permission = "user:read-oib"
+	PermUserManage       Permission = "user:manage"
+	PermUserList         Permission = "user:list"
+	PermPoliceList       Permission = "police:list"
+	PermPoliceTokenIssue Permission = "police-token:issue"
+	PermTokenRevoke      Permission = "token:revoke"
+	PermLockManage       Permission = "lock:manage"
+	PermMfaReset         Permission = "mfa:reset"
+	PermKeyManage        Permission = "key:manage"
+	PermPermissionManage Permission = "permission:manage"
+	PermDeviceWipe       Permission = "device:wipe"
+	PermApiKeyManage     Permission = "apikey:manage"
+	PermImpersonate      Permission = "user:impersonate"
+	PermUserExport       Permission = "user:export"
+	PermUserErase        Permission = "user:erase"
+	PermOrgCreate        Permission = "organisation:create"
+	PermOrgManageAny     Permission = "organisation:manage-any"
+)
+
+// Permissions lists every known permission with a short description
+var Permissions = map[Permission]string{
+	PermVehicleRead:      "View a vehicle by uuid",
+	PermVehicleReadOwn:   "List own vehicles",
+	PermVehicleReadVin:   "View a vehicle by VIN",
+	PermVehicleReadAny:   "View vehicles of other users",
+	PermVehicleManage:    "Create, update, delete vehicles and change owners",
+	PermVehicleRegister:  "Register and deregister vehicles",
+	PermLicenseReadAny:   "View driver licenses of other users",
+	PermLicenseManageAny: "Change driver licenses of other users",
+	PermTempDataCreate:   "Share a vehicle with the police",
+	PermTempDataConsume:  "Read vehicle data shared with the police",
+	PermUserRead:         "View a user by uuid",
+	PermUserReadOib:      "Find a user by OIB",
+	PermUserManage:       "Create, update, delete and search users",
+	PermUserList:         "List all users",
+	PermPoliceList:       "List police officers",
+	PermPoliceTokenIssue: "Issue police activation codes",
+	PermTokenRevoke:      "Revoke all tokens of a user",
+	PermLockManage:       "View and end login lockouts",
+	PermMfaReset:         "Reset the second factor of a user",
+	PermKeyManage:        "Rotate and retire signing keys",
+	PermPermissionManage: "Assign permissions to roles",
+	PermDeviceWipe:       "Remove all devices of a police officer",
+	PermApiKeyManage:     "Issue and revoke API keys of integrations",
+	PermImpersonate:      "Act as another user to see what they see",
+	PermUserExport:       "Export everything stored about a user",
+	PermUserErase:        "View and cancel erasure requests and their certificates",
+	PermOrgCreate:        "Register a company organisation",
+	PermOrgManageAny:     "View and change members of every organisation",
+}
+
+// Roles lists every role users can have
+var Roles = []UserRole{RoleHAK, RoleMupADMIN, RoleOsoba, RoleFirma, RolePolicija, RoleSuperAdmin}
+
+// DefaultRolePermissions are seeded into an empty database, they match the
+// access roles had before permissions were configurable
+var DefaultRolePermissions = map[UserRole][]Permission{
+	RoleHAK: {
+		PermVehicleRead, PermVehicleReadVin, PermVehicleReadAny, PermVehicleManage, PermVehicleRegister,
+		PermLicenseReadAny, PermUserReadOib,
+	},
+	RoleMupADMIN: {
+		PermVehicleReadAny, PermLicenseReadAny, PermLicenseManageAny, PermUserRead, PermUserManage,
+		PermPoliceList, PermPoliceTokenIssue, PermTokenRevoke, PermLockManage, PermDeviceWipe,
+		PermUserErase, PermOrgManageAny,
+	},
+	RoleOsoba: {
+		PermVehicleRead, PermVehicleReadOwn, PermVehicleReadVin, PermTempDataCreate,
+	},
+	RoleFirma: {
+		PermVehicleRead, PermVehicleReadOwn, PermVehicleReadVin, PermTempDataCreate, PermOrgCreate,
+	},
+	RolePolicija: {
+		PermVehicleRead, PermVehicleReadAny, PermLicenseReadAny, PermTempDataConsume, PermUserRead,
+		PermUserReadOib,
+	},
+	RoleSuperAdmin: {
+		PermVehicleReadAny, PermLicenseReadAny, PermLicenseManageAny, PermUserRead, PermUserManage,
+		PermUserList, PermPoliceTokenIssue, PermTokenRevoke, PermLockManage, PermMfaReset,
+		PermKeyManage, PermPermissionManage, PermDeviceWipe, PermApiKeyManage, PermImpersonate,
+		PermUserExport, PermUserErase, PermOrgManageAny,
+	},
+}
+
+// PermissionSeed grants the default permissions added in one version, roles
+// keep the grants of DefaultRolePermissions
+type PermissionSeed struct {
+	Version int
+	Grants  map[UserRole][]Permission
+}
+
+// PermissionSeeds are the versions of DefaultRolePermissions after the first,
+// a database gets the seeds it hasn't applied yet so permissions revoked by
+// an admin are not granted again. Add a seed when a default grant is added.
+var PermissionSeeds = []PermissionSeed{
+	{Version: 2, Grants: map[UserRole][]Permission{
+		RoleMupADMIN: {PermDeviceWipe}, RoleSuperAdmin: {PermDeviceWipe},
+	}},
+	{Version: 3, Grants: map[UserRole][]Permission{
+		RoleSuperAdmin: {PermApiKeyManage},
+	}},
+	{Version: 4, Grants: map[UserRole][]Permission{
+		RoleSuperAdmin: {PermImpersonate},
+	}},
+	{Version: 5, Grants: map[UserRole][]Permission{
+		RoleSuperAdmin: {PermUserExport},
+	}},
+	{Version: 6, Grants: map[UserRole][]Permission{
+		RoleMupADMIN: {PermUserErase}, RoleSuperAdmin: {PermUserErase},
+	}},
+	{Version: 7, Grants: map[UserRole][]Permission{
+		RoleFirma: {PermOrgCreate}, RoleMupADMIN: {PermOrgManageAny}, RoleSuperAdmin: {PermOrgManageAny},
+	}},
+	{Version: 8, Grants: map[UserRole][]Permission{
+		RolePolicija: {PermUserReadOib},
+	}},
+}
+
+// LatestPermissionSeed returns the version of DefaultRolePermissions
+func LatestPermissionSeed() int {
+	return PermissionSeeds[len(PermissionSeeds)-1].Version
+}
+
+// StoPermission parses a known permission
+func StoPermission(text string) (Permission, error) {
+	permission := Permission(text)
+	if _, ok := Permissions[permission]; !ok {
+		return "", cerror.ErrUnknownPermission
+	}
+	return permission, nil
+}
+
+// RolePermission assigns a permission to a role
+type RolePermission struct {
+	gorm.Model
+	Role       UserRole   `gorm:"type:varchar(20);not null;uniqueIndex:idx_role_permission"`
+	Permission Permission `gorm:"type:varchar(50);not null;uniqueIndex:idx_role_permission"`
+}
+
+// AppliedPermissionSeed records a version of the default permissions that
+// was granted
+type AppliedPermissionSeed struct {
+	gorm.Model
+	Version int `gorm:"not null;uniqueIndex"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ActivationCodeStatus string
+
+const (
+	ActivationIssued   ActivationCodeStatus = "issued"
+	ActivationRedeemed ActivationCodeStatus = "redeemed"
+	ActivationExpired  ActivationCodeStatus = "expired"
+	ActivationRevoked  ActivationCodeStatus = "revoked"
+)
+
+// PoliceActivationCode is a single use code an officer registers their device
+// with. Only a keyed hash of the code is stored, Lookup is a keyed hash of
+// the start of the code so failed guesses can be counted against the code
+// they were aimed at. Rows are kept after use as the record of the code
+// lifecycle.
+type PoliceActivationCode struct {
+	gorm.Model
+	Uuid     uuid.UUID            `gorm:"type:uuid;unique;not null"`
+	UserId   uint                 `gorm:"type:uint;index;not null"`
+	User     User                 `gorm:"foreignKey:UserId"`
+	Lookup   string               `gorm:"type:varchar(16);index;not null"`
+	CodeHash string               `gorm:"type:char(64);not null"`
+	Status   ActivationCodeStatus `gorm:"type:varchar(20);index;not null"`
+	Attempts int                  `gorm:"not null;default:0"`
+	// IssuedBy is the admin that issued the code, nil for migrated codes
+	IssuedBy   *uuid.UUID `gorm:"type:uuid;null"`
+	ExpiresAt  time.Time  `gorm:"type:timestamp;not null"`
+	RedeemedAt *time.Time `gorm:"type:timestamp;null"`
+	ExpiredAt  *time.Time `gorm:"type:timestamp;null"`
+	RevokedAt  *time.Time `gorm:"type:timestamp;null"`
+	// RevokedBy is the admin that revoked the code, nil when it was revoked
+	// after too many failed attempts
+	RevokedBy *uuid.UUID `gorm:"type:uuid;null"`
+}
+
+// IsActive reports whether the code can still be redeemed
+func (c *PoliceActivationCode) IsActive(now time.Time) bool {
+	return c.Status == ActivationIssued && now.Before(c.ExpiresAt)
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a server side record of an issued refresh token.
+// Tokens issued from the same login share a FamilyUuid, every refresh
+// marks the used token and issues a new one in the same family.
+type RefreshToken struct {
+	gorm.Model
+	Uuid       uuid.UUID  `gorm:"type:uuid;unique;not null"`
+	FamilyUuid uuid.UUID  `gorm:"type:uuid;index;not null"`
+	UserId     uint       `gorm:"type:uint;index;not null"`
+	User       User       `gorm:"foreignKey:UserId"`
+	ExpiresAt  time.Time  `gorm:"type:timestamp;not null"`
+	UsedAt     *time.Time `gorm:"type:timestamp;null"`
+	RevokedAt  *time.Time `gorm:"type:timestamp;null"`
+	// Ip is the client address the token was issued to
+	Ip string `gorm:"type:varchar(45)"`
+}
+
+// IsActive reports whether the token can still be exchanged for a new pair
+func (t *RefreshToken) IsActive(now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
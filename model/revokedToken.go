@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RevokedToken is a denylist entry, it either revokes a single token by its
+// jti or every token of a user issued before IssuedBefore.
+// Entries are removed once ExpiresAt passes since no matching token is valid anymore.
+type RevokedToken struct {
+	gorm.Model
+	Jti          *string    `gorm:"type:varchar(64);unique;null"`
+	UserUuid     *uuid.UUID `gorm:"type:uuid;uniqueIndex;null"`
+	IssuedBefore *time.Time `gorm:"type:timestamp;null"`
+	ExpiresAt    time.Time  `gorm:"type:timestamp;index;not null"`
+}
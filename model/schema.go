@@ -15,5 +15,29 @@ func GetAllModels() []any {
 		&Mobile{},
 		&RegistrationInfo{},
 		&TempData{},
+		&RefreshToken{},
+		&RevokedToken{},
+		&SigningKey{},
+		&UserTotp{},
+		&RecoveryCode{},
+		&LoginThrottle{},
+		&LockEvent{},
+		&OutboxMessage{},
+		&PasswordResetToken{},
+		&EmailChangeToken{},
+		&RolePermission{},
+		&AppliedPermissionSeed{},
+		&PoliceActivationCode{},
+		&DeviceChallenge{},
+		&OidcIdentity{},
+		&OidcLoginState{},
+		&ApiKey{},
+		&ImpersonationSession{},
+		&ImpersonationRequest{},
+		&ErasureRequest{},
+		&ErasureAction{},
+		&Organisation{},
+		&OrganisationMember{},
+		&OrganisationInvitation{},
 	}
 }
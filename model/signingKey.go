@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey is a key pair used to sign access and device tokens.
+// The newest active key that is not retired signs new tokens, every key that
+// is not retired is published in JWKS and accepted when verifying.
+// The private key is stored encrypted.
+type SigningKey struct {
+	gorm.Model
+	Kid        string `gorm:"type:varchar(64);unique;not null"`
+	Algorithm  string `gorm:"type:varchar(16);not null"`
+	PrivateKey string `gorm:"type:text;not null"`
+	PublicKey  string `gorm:"type:text;not null"`
+	// ActiveAt is when the key starts signing, keys stored before activation
+	// was delayed have none and sign from the start
+	ActiveAt  *time.Time `gorm:"type:timestamp;null"`
+	RetiredAt *time.Time `gorm:"type:timestamp;null"`
+}
+
+// IsActive reports whether the key may sign new tokens at given time
+func (k *SigningKey) IsActive(now time.Time) bool {
+	return k.ActiveAt == nil || !k.ActiveAt.After(now)
+}
+
+// CurrentSigningKey returns the newest active key of keys ordered newest
+// first, or nil if none is active
+func CurrentSigningKey(keys []SigningKey, now time.Time) *SigningKey {
+	for i := range keys {
+		if keys[i].IsActive(now) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"ePrometna_Server/util/cerror"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -53,7 +54,8 @@ type User struct {
 	FirstName        string           `gorm:"type:varchar(100);not null"`
 	LastName         string           `gorm:"type:varchar(100);not null"`
 	OIB              string           `gorm:"type:char(11);unique;not null"`
-	Residence        string           `gorm:"type:varchar(255);not null"`
+	Residence        Address          `gorm:"embedded;embeddedPrefix:residence_"`
+	ResidenceLegacy  *string          `gorm:"type:text"`
 	BirthDate        time.Time        `gorm:"type:date;not null"`
 	Email            string           `gorm:"type:varchar(100);unique;not null"`
 	PasswordHash     string           `gorm:"type:varchar(255);not null"`
@@ -65,16 +67,10 @@ type User struct {
 	CreatedDevices   []Mobile         `gorm:"foreignKey:CreatorId"`
 	TemporaryData    *TempData        `gorm:"foreignKey:DriverId"`
 	License          *DriverLicense   `gorm:"foreignKey:UserId"`
-	PoliceToken      *string          `gorm:"column:police_token;null"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
-	validRoles := map[UserRole]bool{
-		RoleHAK: true, RoleMupADMIN: true, RoleOsoba: true,
-		RoleFirma: true, RolePolicija: true, RoleSuperAdmin: true,
-	}
-
-	if _, ok := validRoles[u.Role]; !ok {
+	if !slices.Contains(Roles, u.Role) {
 		return errors.New("invalid user role")
 	}
 	return nil
@@ -88,7 +84,6 @@ func (u *User) Update(user *User) *User {
 	u.Residence = user.Residence
 	u.Email = user.Email
 	u.Role = user.Role
-	u.PoliceToken = user.PoliceToken
 
 	return u
 }
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"ePrometna_Server/util/cerror"
+	"time"
+)
+
+// UserImportRow is a user read from a row of an import sheet, Line is the
+// row number in the sheet with the header on line 1
+type UserImportRow struct {
+	Line   int
+	User   User
+	Errors []*cerror.FieldError
+	// ActivationCode is issued to imported police officers, it is only
+	// known until the import response is sent
+	ActivationCode      string
+	ActivationExpiresAt time.Time
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserTotp is the TOTP second factor of a user, it is used on login only
+// after the user confirms the enrollment with a valid code. The secret is
+// sealed with auth.SealTotpSecret.
+type UserTotp struct {
+	gorm.Model
+	UserId       uint       `gorm:"type:uint;uniqueIndex;not null"`
+	User         User       `gorm:"foreignKey:UserId"`
+	Secret       string     `gorm:"type:varchar(255);not null"`
+	ConfirmedAt  *time.Time `gorm:"type:timestamp;null"`
+	LastUsedStep int64      `gorm:"not null;default:0"`
+}
+
+// RecoveryCode is a single use code that replaces a TOTP code when the device is lost
+type RecoveryCode struct {
+	gorm.Model
+	UserId   uint       `gorm:"type:uint;index;not null"`
+	User     User       `gorm:"foreignKey:UserId"`
+	CodeHash string     `gorm:"type:char(64);not null"`
+	UsedAt   *time.Time `gorm:"type:timestamp;null"`
+}
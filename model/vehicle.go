@@ -7,9 +7,12 @@ import (
 
 type Vehicle struct {
 	gorm.Model
-	Uuid             uuid.UUID          `gorm:"type:uuid;unique;not null"`
-	UserId           *uint              `gorm:"type:uint;null"`
-	Owner            *User              `gorm:"foreignKey:UserId;OnDelete:SET NULL"`
+	Uuid   uuid.UUID `gorm:"type:uuid;unique;not null"`
+	UserId *uint     `gorm:"type:uint;null"`
+	Owner  *User     `gorm:"foreignKey:UserId;OnDelete:SET NULL"`
+	// OrganisationId is set instead of UserId for vehicles of a company
+	OrganisationId   *uint              `gorm:"type:uint;null;index"`
+	Organisation     *Organisation      `gorm:"foreignKey:OrganisationId"`
 	Drivers          []VehicleDrivers   `gorm:"foreignKey:VehicleId;null"`
 	PastOwners       []OwnerHistory     `gorm:"foreignKey:VehicleId;null"`
 	TemporaryData    *TempData          `gorm:"foreignKey:VehicleId;null"`
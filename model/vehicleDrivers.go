@@ -29,3 +29,12 @@ func (cd *VehicleDrivers) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// IsActive reports whether the driver may use the vehicle at given time,
+// a zero Until means the right doesn't expire
+func (cd *VehicleDrivers) IsActive(now time.Time) bool {
+	if now.Before(cd.Given) {
+		return false
+	}
+	return cd.Until.IsZero() || now.Before(cd.Until)
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IAccessPolicyService interface {
+	// CanViewVehicle allows roles with model.PermVehicleReadAny, the owner and active drivers of the vehicle
+	CanViewVehicle(claims *auth.Claims, vehicle *model.Vehicle) error
+	// CanDriveVehicle allows only the owner, members of the owning organisation and active drivers of the vehicle
+	CanDriveVehicle(claims *auth.Claims, vehicle *model.Vehicle) error
+	// CanViewOrganisation allows roles with model.PermOrgManageAny and members of the organisation
+	CanViewOrganisation(claims *auth.Claims, organisation *model.Organisation) error
+	// CanManageMember allows roles with model.PermOrgManageAny and members whose role can manage the given role
+	CanManageMember(claims *auth.Claims, organisation *model.Organisation, role model.OrganisationRole) error
+	// CanViewLicense allows roles with model.PermLicenseReadAny and the owner of the license
+	CanViewLicense(claims *auth.Claims, license *model.DriverLicense) error
+	// CanManageLicense allows roles with model.PermLicenseManageAny and the owner of the license
+	CanManageLicense(claims *auth.Claims, license *model.DriverLicense) error
+}
+
+type AccessPolicyService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewAccessPolicyService() IAccessPolicyService {
+	var service IAccessPolicyService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &AccessPolicyService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// CanViewVehicle implements IAccessPolicyService.
+func (s *AccessPolicyService) CanViewVehicle(claims *auth.Claims, vehicle *model.Vehicle) error {
+	if claims.HasPermissions(model.PermVehicleReadAny) {
+		return nil
+	}
+	return s.CanDriveVehicle(claims, vehicle)
+}
+
+// CanDriveVehicle implements IAccessPolicyService.
+func (s *AccessPolicyService) CanDriveVehicle(claims *auth.Claims, vehicle *model.Vehicle) error {
+	userId, err := s.userId(claims)
+	if err != nil {
+		return err
+	}
+	if vehicle.UserId != nil && *vehicle.UserId == userId {
+		return nil
+	}
+	if vehicle.OrganisationId != nil {
+		member, err := s.member(*vehicle.OrganisationId, userId)
+		if err != nil {
+			return err
+		}
+		if member != nil {
+			return nil
+		}
+	}
+
+	var drivers []model.VehicleDrivers
+	if err := s.db.
+		Where("vehicle_id = ? AND user_id = ?", vehicle.ID, userId).
+		Find(&drivers).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query drivers of vehicle = %s, error = %+v", vehicle.Uuid, err)
+		return err
+	}
+
+	now := time.Now()
+	for _, driver := range drivers {
+		if driver.IsActive(now) {
+			return nil
+		}
+	}
+
+	s.logger.Warnf("User = %s denied access to vehicle = %s", claims.Uuid, vehicle.Uuid)
+	return cerror.ErrForbidden
+}
+
+// CanViewLicense implements IAccessPolicyService.
+func (s *AccessPolicyService) CanViewLicense(claims *auth.Claims, license *model.DriverLicense) error {
+	if claims.HasPermissions(model.PermLicenseReadAny) {
+		return nil
+	}
+	return s.ownsLicense(claims, license)
+}
+
+// CanManageLicense implements IAccessPolicyService.
+func (s *AccessPolicyService) CanManageLicense(claims *auth.Claims, license *model.DriverLicense) error {
+	if claims.HasPermissions(model.PermLicenseManageAny) {
+		return nil
+	}
+	return s.ownsLicense(claims, license)
+}
+
+// CanViewOrganisation implements IAccessPolicyService.
+func (s *AccessPolicyService) CanViewOrganisation(claims *auth.Claims, organisation *model.Organisation) error {
+	if claims.HasPermissions(model.PermOrgManageAny) {
+		return nil
+	}
+	userId, err := s.userId(claims)
+	if err != nil {
+		return err
+	}
+	member, err := s.member(organisation.ID, userId)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		s.logger.Warnf("User = %s denied access to organisation = %s", claims.Uuid, organisation.Uuid)
+		return cerror.ErrForbidden
+	}
+	return nil
+}
+
+// CanManageMember implements IAccessPolicyService.
+func (s *AccessPolicyService) CanManageMember(claims *auth.Claims, organisation *model.Organisation, role model.OrganisationRole) error {
+	if claims.HasPermissions(model.PermOrgManageAny) {
+		return nil
+	}
+	userId, err := s.userId(claims)
+	if err != nil {
+		return err
+	}
+	member, err := s.member(organisation.ID, userId)
+	if err != nil {
+		return err
+	}
+	if member == nil || !member.Role.CanManage(role) {
+		s.logger.Warnf("User = %s denied managing %s members of organisation = %s", claims.Uuid, role, organisation.Uuid)
+		return cerror.ErrForbidden
+	}
+	return nil
+}
+
+func (s *AccessPolicyService) ownsLicense(claims *auth.Claims, license *model.DriverLicense) error {
+	userId, err := s.userId(claims)
+	if err != nil {
+		return err
+	}
+	if license.UserId != userId {
+		s.logger.Warnf("User = %s denied access to license = %s", claims.Uuid, license.Uuid)
+		return cerror.ErrForbidden
+	}
+	return nil
+}
+
+// member returns the membership of the user in the organisation, nil if they aren't a member
+func (s *AccessPolicyService) member(organisationId, userId uint) (*model.OrganisationMember, error) {
+	var members []model.OrganisationMember
+	if err := s.db.
+		Where("organisation_id = ? AND user_id = ?", organisationId, userId).
+		Limit(1).
+		Find(&members).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query members of organisation = %d, error = %+v", organisationId, err)
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return &members[0], nil
+}
+
+// userId resolves the database id of the logged in user, users that no
+// longer exist are denied
+func (s *AccessPolicyService) userId(claims *auth.Claims) (uint, error) {
+	var user model.User
+	if err := s.db.Select("id").Where("uuid = ?", claims.Uuid).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, cerror.ErrForbidden
+		}
+		s.logger.Errorf("Failed to query user = %s, error = %+v", claims.Uuid, err)
+		return 0, err
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type AccessPolicyServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IAccessPolicyService
+	owner   *model.User
+	driver  *model.User
+	other   *model.User
+	vehicle *model.Vehicle
+	license *model.DriverLicense
+}
+
+func (suite *AccessPolicyServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:accesspolicy_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewAccessPolicyService()
+}
+
+func (suite *AccessPolicyServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *AccessPolicyServiceTestSuite) SetupTest() {
+	for _, m := range []any{
+		&model.VehicleDrivers{}, &model.DriverLicense{}, &model.Vehicle{},
+		&model.OrganisationMember{}, &model.Organisation{}, &model.User{},
+	} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+
+	suite.owner = suite.createUser("owner@example.com", "12345678903")
+	suite.driver = suite.createUser("driver@example.com", "12345678904")
+	suite.other = suite.createUser("other@example.com", "12345678905")
+
+	suite.vehicle = &model.Vehicle{Uuid: uuid.New(), UserId: &suite.owner.ID}
+	suite.Require().NoError(suite.db.Create(suite.vehicle).Error)
+
+	suite.license = &model.DriverLicense{
+		Uuid:          uuid.New(),
+		UserId:        suite.owner.ID,
+		LicenseNumber: "POLICY-1",
+		IssueDate:     time.Now().AddDate(-1, 0, 0),
+		ExpiringDate:  time.Now().AddDate(9, 0, 0),
+		Category:      "B",
+	}
+	suite.Require().NoError(suite.db.Create(suite.license).Error)
+}
+
+func (suite *AccessPolicyServiceTestSuite) createUser(email, oib string) *model.User {
+	user := &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Policy",
+		LastName:     "User",
+		OIB:          oib,
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        email,
+		PasswordHash: "hash",
+		Role:         model.RoleOsoba,
+	}
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *AccessPolicyServiceTestSuite) addDriver(given, until time.Time) {
+	suite.Require().NoError(suite.db.Create(&model.VehicleDrivers{
+		Uuid:      uuid.New(),
+		VehicleId: suite.vehicle.ID,
+		UserId:    suite.driver.ID,
+		Given:     given,
+		Until:     until,
+	}).Error)
+}
+
+func claimsOf(user *model.User) *auth.Claims {
+	return &auth.Claims{Uuid: user.Uuid.String(), Role: user.Role}
+}
+
+func TestAccessPolicyServiceSuite(t *testing.T) {
+	suite.Run(t, new(AccessPolicyServiceTestSuite))
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestVehicle_Owner() {
+	assert.NoError(suite.T(), suite.service.CanViewVehicle(claimsOf(suite.owner), suite.vehicle))
+	assert.NoError(suite.T(), suite.service.CanDriveVehicle(claimsOf(suite.owner), suite.vehicle))
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestVehicle_OtherPerson() {
+	assert.ErrorIs(suite.T(), suite.service.CanViewVehicle(claimsOf(suite.other), suite.vehicle), cerror.ErrForbidden)
+	assert.ErrorIs(suite.T(), suite.service.CanDriveVehicle(claimsOf(suite.other), suite.vehicle), cerror.ErrForbidden)
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestVehicle_ActiveDriver() {
+	suite.addDriver(time.Now().AddDate(0, -1, 0), time.Time{})
+
+	assert.NoError(suite.T(), suite.service.CanViewVehicle(claimsOf(suite.driver), suite.vehicle))
+	assert.NoError(suite.T(), suite.service.CanDriveVehicle(claimsOf(suite.driver), suite.vehicle))
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestVehicle_ExpiredDriver() {
+	suite.addDriver(time.Now().AddDate(0, -2, 0), time.Now().AddDate(0, -1, 0))
+
+	assert.ErrorIs(suite.T(), suite.service.CanDriveVehicle(claimsOf(suite.driver), suite.vehicle), cerror.ErrForbidden)
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestVehicle_ViewerRole() {
+	police := &auth.Claims{Uuid: uuid.NewString(), Role: model.RolePolicija}
+
+	assert.NoError(suite.T(), suite.service.CanViewVehicle(police, suite.vehicle))
+	assert.ErrorIs(suite.T(), suite.service.CanDriveVehicle(police, suite.vehicle), cerror.ErrForbidden)
+}
+
+// createOrganisation makes the owner an owner and the driver a driver of an
+// organisation that owns a vehicle
+func (suite *AccessPolicyServiceTestSuite) createOrganisation() (*model.Organisation, *model.Vehicle) {
+	organisation := &model.Organisation{Uuid: uuid.New(), Name: "Policy d.o.o.", OIB: "69435151530"}
+	suite.Require().NoError(suite.db.Create(organisation).Error)
+	for user, role := range map[*model.User]model.OrganisationRole{suite.owner: model.OrgRoleOwner, suite.driver: model.OrgRoleDriver} {
+		suite.Require().NoError(suite.db.Create(&model.OrganisationMember{
+			OrganisationId: organisation.ID, UserId: user.ID, Role: role,
+		}).Error)
+	}
+
+	vehicle := &model.Vehicle{Uuid: uuid.New(), OrganisationId: &organisation.ID}
+	suite.Require().NoError(suite.db.Create(vehicle).Error)
+	return organisation, vehicle
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestVehicle_OrganisationMember() {
+	_, vehicle := suite.createOrganisation()
+
+	assert.NoError(suite.T(), suite.service.CanDriveVehicle(claimsOf(suite.owner), vehicle))
+	assert.NoError(suite.T(), suite.service.CanViewVehicle(claimsOf(suite.driver), vehicle))
+	assert.NoError(suite.T(), suite.service.CanDriveVehicle(claimsOf(suite.driver), vehicle))
+	assert.ErrorIs(suite.T(), suite.service.CanViewVehicle(claimsOf(suite.other), vehicle), cerror.ErrForbidden)
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestOrganisation() {
+	organisation, _ := suite.createOrganisation()
+
+	assert.NoError(suite.T(), suite.service.CanViewOrganisation(claimsOf(suite.driver), organisation))
+	assert.ErrorIs(suite.T(), suite.service.CanViewOrganisation(claimsOf(suite.other), organisation), cerror.ErrForbidden)
+
+	assert.NoError(suite.T(), suite.service.CanManageMember(claimsOf(suite.owner), organisation, model.OrgRoleOwner))
+	assert.ErrorIs(suite.T(), suite.service.CanManageMember(claimsOf(suite.driver), organisation, model.OrgRoleDriver), cerror.ErrForbidden)
+	assert.ErrorIs(suite.T(), suite.service.CanManageMember(claimsOf(suite.other), organisation, model.OrgRoleDriver), cerror.ErrForbidden)
+
+	suite.Require().NoError(suite.db.Model(&model.OrganisationMember{}).
+		Where("user_id = ?", suite.driver.ID).Update("role", model.OrgRoleFleetManager).Error)
+	assert.NoError(suite.T(), suite.service.CanManageMember(claimsOf(suite.driver), organisation, model.OrgRoleDriver))
+	assert.ErrorIs(suite.T(), suite.service.CanManageMember(claimsOf(suite.driver), organisation, model.OrgRoleOwner), cerror.ErrForbidden)
+
+	admin := &auth.Claims{Uuid: uuid.NewString(), Role: model.RoleMupADMIN}
+	assert.NoError(suite.T(), suite.service.CanViewOrganisation(admin, organisation))
+	assert.NoError(suite.T(), suite.service.CanManageMember(admin, organisation, model.OrgRoleOwner))
+}
+
+func (suite *AccessPolicyServiceTestSuite) TestLicense() {
+	assert.NoError(suite.T(), suite.service.CanViewLicense(claimsOf(suite.owner), suite.license))
+	assert.NoError(suite.T(), suite.service.CanManageLicense(claimsOf(suite.owner), suite.license))
+	assert.ErrorIs(suite.T(), suite.service.CanViewLicense(claimsOf(suite.other), suite.license), cerror.ErrForbidden)
+	assert.ErrorIs(suite.T(), suite.service.CanManageLicense(claimsOf(suite.other), suite.license), cerror.ErrForbidden)
+
+	hak := &auth.Claims{Uuid: uuid.NewString(), Role: model.RoleHAK}
+	assert.NoError(suite.T(), suite.service.CanViewLicense(hak, suite.license))
+	assert.ErrorIs(suite.T(), suite.service.CanManageLicense(hak, suite.license), cerror.ErrForbidden)
+
+	admin := &auth.Claims{Uuid: uuid.NewString(), Role: model.RoleMupADMIN}
+	assert.NoError(suite.T(), suite.service.CanManageLicense(admin, suite.license))
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefixLength is the number of characters of a key stored in plain text
+	apiKeyPrefixLength = 12
+	// apiKeyUseInterval limits how often the use of a key is written
+	apiKeyUseInterval = time.Minute
+)
+
+type IApiKeyService interface {
+	// Create issues a key described by an unsaved model, the key is only returned here
+	Create(key *model.ApiKey, adminUuid uuid.UUID) (string, *model.ApiKey, error)
+	// GetAll returns every key, organisation filters them if it isn't empty
+	GetAll(organisation string) ([]model.ApiKey, error)
+	// Revoke revokes a key, it stops working immediately
+	Revoke(keyUuid, adminUuid uuid.UUID) error
+	// AuthenticateApiKey checks a key, it is installed as the auth.ApiKeyStore
+	AuthenticateApiKey(key, ip string) (*auth.Claims, error)
+}
+
+type ApiKeyService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewApiKeyService() IApiKeyService {
+	var service IApiKeyService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &ApiKeyService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Create implements IApiKeyService.
+func (s *ApiKeyService) Create(key *model.ApiKey, adminUuid uuid.UUID) (string, *model.ApiKey, error) {
+	if err := s.validate(key); err != nil {
+		return "", nil, err
+	}
+
+	secret, err := auth.GenerateApiKey()
+	if err != nil {
+		s.logger.Errorf("Failed to generate API key, error = %+v", err)
+		return "", nil, err
+	}
+
+	key.Uuid = uuid.New()
+	key.Prefix = secret[:apiKeyPrefixLength]
+	key.KeyHash = auth.HashApiKey(secret)
+	key.CreatedBy = adminUuid
+	if err := s.db.Create(key).Error; err != nil {
+		s.logger.Errorf("Failed to store API key, error = %+v", err)
+		return "", nil, err
+	}
+
+	s.logger.Infof("Admin = %s issued API key = %s to %s with role = %s and scopes %v",
+		adminUuid, key.Uuid, key.Organisation, key.Role, key.Scopes)
+	return secret, key, nil
+}
+
+// GetAll implements IApiKeyService.
+func (s *ApiKeyService) GetAll(organisation string) ([]model.ApiKey, error) {
+	query := s.db.Order("organisation, created_at DESC")
+	if organisation != "" {
+		query = query.Where("organisation = ?", organisation)
+	}
+
+	var keys []model.ApiKey
+	if err := query.Find(&keys).Error; err != nil {
+		s.logger.Errorf("Failed to query API keys, error = %+v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke implements IApiKeyService.
+func (s *ApiKeyService) Revoke(keyUuid, adminUuid uuid.UUID) error {
+	var key model.ApiKey
+	if err := s.db.Where("uuid = ?", keyUuid).First(&key).Error; err != nil {
+		return err
+	}
+
+	rez := s.db.
+		Model(&model.ApiKey{}).
+		Where("id = ? AND revoked_at IS NULL", key.ID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_by": adminUuid})
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke API key = %s, error = %+v", keyUuid, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	s.logger.Infof("Admin = %s revoked API key = %s of %s", adminUuid, keyUuid, key.Organisation)
+	return nil
+}
+
+// AuthenticateApiKey implements IApiKeyService.
+func (s *ApiKeyService) AuthenticateApiKey(secret, ip string) (*auth.Claims, error) {
+	var key model.ApiKey
+	if err := s.db.Where("key_hash = ?", auth.HashApiKey(secret)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cerror.ErrInvalidApiKey
+		}
+		s.logger.Errorf("Failed to query API key, error = %+v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, cerror.ErrInvalidApiKey
+	}
+	if !ipAllowed(key.IpAllowlist, ip) {
+		s.logger.Warnf("API key = %s of %s used from address %s outside of its allowlist", key.Uuid, key.Organisation, ip)
+		return nil, cerror.ErrApiKeyIpDenied
+	}
+	s.touch(&key, ip, now)
+
+	return &auth.Claims{
+		Uuid:   key.Uuid.String(),
+		Role:   key.Role,
+		ApiKey: key.Uuid.String(),
+		Scopes: key.Scopes,
+	}, nil
+}
+
+// validate checks a new key, scopes have to be granted to its role,
+// superadmin keys and keys that manage keys are never issued
+func (s *ApiKeyService) validate(key *model.ApiKey) error {
+	if key.Role == model.RoleSuperAdmin || !slices.Contains(model.Roles, key.Role) {
+		return cerror.ErrBadRole
+	}
+	if len(key.Scopes) == 0 {
+		return cerror.ErrScopeNotAllowed
+	}
+	for _, scope := range key.Scopes {
+		if _, ok := model.Permissions[scope]; !ok {
+			return cerror.ErrUnknownPermission
+		}
+		if scope == model.PermApiKeyManage {
+			return cerror.ErrScopeNotAllowed
+		}
+		if !auth.HasPermissions(key.Role, scope) {
+			return cerror.ErrScopeNotAllowed
+		}
+	}
+
+	allowlist := make([]string, 0, len(key.IpAllowlist))
+	for _, entry := range key.IpAllowlist {
+		entry = strings.TrimSpace(entry)
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return cerror.ErrInvalidIpAllowlist
+			}
+		}
+		allowlist = append(allowlist, entry)
+	}
+	key.IpAllowlist = allowlist
+
+	now := time.Now()
+	if !key.ExpiresAt.After(now) || key.ExpiresAt.After(now.Add(config.AppConfig.ApiKeyMaxLifetime())) {
+		return cerror.ErrInvalidExpiry
+	}
+	return nil
+}
+
+func (s *ApiKeyService) touch(key *model.ApiKey, ip string, now time.Time) {
+	if key.LastUsedAt != nil && key.LastUsedAt.After(now.Add(-apiKeyUseInterval)) && key.LastUsedIp == ip {
+		return
+	}
+	if err := s.db.
+		Model(&model.ApiKey{}).
+		Where("id = ?", key.ID).
+		Updates(map[string]any{"last_used_at": now, "last_used_ip": ip}).
+		Error; err != nil {
+		s.logger.Errorf("Failed to update last use of API key = %s, error = %+v", key.Uuid, err)
+	}
+}
+
+// ipAllowed reports whether ip matches an address or range of the allowlist,
+// an empty allowlist allows every address
+func ipAllowed(allowlist []string, ip string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowlist {
+		if allowed := net.ParseIP(entry); allowed != nil {
+			if allowed.Equal(addr) {
+				return true
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
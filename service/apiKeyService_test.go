@@ -0,0 +1,168 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type ApiKeyServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IApiKeyService
+	admin   uuid.UUID
+}
+
+func (suite *ApiKeyServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:apikeyservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev, ApiKeyMaxDays: 90}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewApiKeyService()
+	suite.admin = uuid.New()
+}
+
+func (suite *ApiKeyServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *ApiKeyServiceTestSuite) SetupTest() {
+	suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.ApiKey{})
+}
+
+func TestApiKeyServiceSuite(t *testing.T) {
+	suite.Run(t, new(ApiKeyServiceTestSuite))
+}
+
+func (suite *ApiKeyServiceTestSuite) newKey() *model.ApiKey {
+	return &model.ApiKey{
+		Name:         "Inspection station",
+		Organisation: "HAK Zagreb",
+		Role:         model.RoleHAK,
+		Scopes:       []model.Permission{model.PermVehicleRead, model.PermVehicleReadVin},
+		IpAllowlist:  []string{"192.0.2.10", "198.51.100.0/24"},
+		ExpiresAt:    time.Now().Add(30 * 24 * time.Hour),
+	}
+}
+
+func (suite *ApiKeyServiceTestSuite) TestCreateStoresOnlyHash() {
+	secret, key, err := suite.service.Create(suite.newKey(), suite.admin)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), auth.IsApiKey(secret))
+
+	var stored model.ApiKey
+	suite.Require().NoError(suite.db.First(&stored, key.ID).Error)
+	assert.Equal(suite.T(), auth.HashApiKey(secret), stored.KeyHash)
+	assert.Equal(suite.T(), secret[:len(stored.Prefix)], stored.Prefix)
+	assert.Less(suite.T(), len(stored.Prefix), len(secret))
+	assert.Equal(suite.T(), []model.Permission{model.PermVehicleRead, model.PermVehicleReadVin}, stored.Scopes)
+	assert.Equal(suite.T(), []string{"192.0.2.10", "198.51.100.0/24"}, stored.IpAllowlist)
+	assert.Equal(suite.T(), suite.admin, stored.CreatedBy)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestAuthenticate() {
+	secret, key, err := suite.service.Create(suite.newKey(), suite.admin)
+	suite.Require().NoError(err)
+
+	claims, err := suite.service.AuthenticateApiKey(secret, "198.51.100.7")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), key.Uuid.String(), claims.ApiKey)
+	assert.Equal(suite.T(), model.RoleHAK, claims.Role)
+	assert.True(suite.T(), claims.HasPermissions(model.PermVehicleRead))
+	assert.False(suite.T(), claims.HasPermissions(model.PermVehicleManage), "role has it but the key isn't scoped for it")
+
+	var stored model.ApiKey
+	suite.Require().NoError(suite.db.First(&stored, key.ID).Error)
+	assert.NotNil(suite.T(), stored.LastUsedAt)
+	assert.Equal(suite.T(), "198.51.100.7", stored.LastUsedIp)
+
+	_, err = suite.service.AuthenticateApiKey(secret, "203.0.113.1")
+	assert.ErrorIs(suite.T(), err, cerror.ErrApiKeyIpDenied)
+
+	_, err = suite.service.AuthenticateApiKey(secret+"x", "192.0.2.10")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidApiKey)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestRevokedAndExpired() {
+	secret, key, err := suite.service.Create(suite.newKey(), suite.admin)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.service.Revoke(key.Uuid, suite.admin))
+	assert.ErrorIs(suite.T(), suite.service.Revoke(key.Uuid, suite.admin), gorm.ErrRecordNotFound)
+	_, err = suite.service.AuthenticateApiKey(secret, "192.0.2.10")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidApiKey)
+
+	secret, key, err = suite.service.Create(suite.newKey(), suite.admin)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Model(key).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err = suite.service.AuthenticateApiKey(secret, "192.0.2.10")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidApiKey)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestCreate_Validation() {
+	key := suite.newKey()
+	key.Scopes = []model.Permission{model.PermUserManage}
+	_, _, err := suite.service.Create(key, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrScopeNotAllowed)
+
+	key = suite.newKey()
+	key.Role = model.RoleSuperAdmin
+	key.Scopes = []model.Permission{model.PermUserList}
+	_, _, err = suite.service.Create(key, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadRole)
+
+	key = suite.newKey()
+	key.IpAllowlist = []string{"not-an-ip"}
+	_, _, err = suite.service.Create(key, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidIpAllowlist)
+
+	key = suite.newKey()
+	key.ExpiresAt = time.Now().Add(91 * 24 * time.Hour)
+	_, _, err = suite.service.Create(key, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidExpiry)
+
+	key = suite.newKey()
+	key.ExpiresAt = time.Now().Add(-time.Hour)
+	_, _, err = suite.service.Create(key, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidExpiry)
+}
+
+func (suite *ApiKeyServiceTestSuite) TestGetAll() {
+	_, _, err := suite.service.Create(suite.newKey(), suite.admin)
+	suite.Require().NoError(err)
+	other := suite.newKey()
+	other.Organisation = "CVH Split"
+	_, _, err = suite.service.Create(other, suite.admin)
+	suite.Require().NoError(err)
+
+	keys, err := suite.service.GetAll("")
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), keys, 2)
+
+	keys, err = suite.service.GetAll("CVH Split")
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), keys, 1)
+	assert.Equal(suite.T(), "CVH Split", keys[0].Organisation)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IDataExportService interface {
+	// Export gathers everything stored about the user, removed rows included
+	Export(userUuid uuid.UUID) (*model.UserDataExport, error)
+}
+
+type DataExportService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewDataExportService() IDataExportService {
+	var service IDataExportService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &DataExportService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Export implements IDataExportService.
+func (s *DataExportService) Export(userUuid uuid.UUID) (*model.UserDataExport, error) {
+	export := &model.UserDataExport{GeneratedAt: time.Now()}
+	if err := s.db.Where("uuid = ?", userUuid).First(&export.User).Error; err != nil {
+		return nil, err
+	}
+	userId := export.User.ID
+
+	// NOTE: removed rows are still stored, so they are exported too
+	db := s.db.Unscoped().Session(&gorm.Session{})
+	lists := []struct {
+		dest  any
+		query *gorm.DB
+	}{
+		{&export.Vehicles, db.Preload("Registration").Where("user_id = ?", userId)},
+		{&export.OwnerHistory, db.Where("user_id = ?", userId)},
+		{&export.DriverGrants, db.Where("user_id = ?", userId)},
+		{&export.Devices, db.Where("user_id = ?", userId)},
+		{&export.TempData, db.Where("driver_id = ?", userId)},
+		{&export.Identities, db.Where("user_id = ?", userId)},
+		{&export.Sessions, db.Where("user_id = ?", userId)},
+		{&export.LockEvents, db.Where("scope IN ? AND key = ?", []model.ThrottleScope{model.ThrottleScopeEmail, model.ThrottleScopeReset}, strings.ToLower(export.User.Email))},
+		{&export.Impersonations, db.Where("subject_uuid = ?", userUuid)},
+		{&export.Memberships, db.Preload("Organisation").Where("user_id = ?", userId)},
+		{&export.Invitations, db.Preload("Organisation").Where("user_id = ?", userId)},
+	}
+	for _, list := range lists {
+		if err := list.query.Order("created_at, id").Find(list.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if export.License, err = findOptional[model.DriverLicense](db.Where("user_id = ?", userId)); err != nil {
+		return nil, err
+	}
+	if export.Totp, err = findOptional[model.UserTotp](db.Where("user_id = ?", userId)); err != nil {
+		return nil, err
+	}
+
+	if export.Referenced, err = s.referencedVehicles(export); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Exported data of user %s", userUuid)
+	return export, nil
+}
+
+// referencedVehicles loads the vehicles other records of the export refer to
+func (s *DataExportService) referencedVehicles(export *model.UserDataExport) (map[uint]model.Vehicle, error) {
+	var ids []uint
+	for _, history := range export.OwnerHistory {
+		ids = append(ids, history.VehicleId)
+	}
+	for _, grant := range export.DriverGrants {
+		ids = append(ids, grant.VehicleId)
+	}
+	for _, temp := range export.TempData {
+		ids = append(ids, temp.VehicleId)
+	}
+
+	referenced := make(map[uint]model.Vehicle, len(ids))
+	if len(ids) == 0 {
+		return referenced, nil
+	}
+
+	var vehicles []model.Vehicle
+	if err := s.db.Unscoped().Preload("Registration").Where("id IN ?", ids).Find(&vehicles).Error; err != nil {
+		return nil, err
+	}
+	for _, vehicle := range vehicles {
+		referenced[vehicle.ID] = vehicle
+	}
+	return referenced, nil
+}
+
+// findOptional returns the first row of the query, nil if there is none
+func findOptional[T any](query *gorm.DB) (*T, error) {
+	var row T
+	if err := query.First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &row, nil
+}
@@ -0,0 +1,101 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type DataExportServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IDataExportService
+}
+
+func (suite *DataExportServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:dataexportservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewDataExportService()
+}
+
+func (suite *DataExportServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestDataExportServiceSuite(t *testing.T) {
+	suite.Run(t, new(DataExportServiceTestSuite))
+}
+
+func (suite *DataExportServiceTestSuite) TestExport() {
+	user := model.User{Uuid: uuid.New(), Email: "Export@Test.hr", Role: model.RoleOsoba, OIB: "69435151530"}
+	other := model.User{Uuid: uuid.New(), Email: "other@test.hr", Role: model.RoleOsoba, OIB: "94577403194"}
+	suite.Require().NoError(suite.db.Create(&user).Error)
+	suite.Require().NoError(suite.db.Create(&other).Error)
+
+	owned := model.Vehicle{Uuid: uuid.New(), UserId: &user.ID, Mark: "Skoda", VehicleModel: "Octavia"}
+	sold := model.Vehicle{Uuid: uuid.New(), UserId: &other.ID, Mark: "Fiat", VehicleModel: "Punto"}
+	suite.Require().NoError(suite.db.Create(&owned).Error)
+	suite.Require().NoError(suite.db.Create(&sold).Error)
+	suite.Require().NoError(suite.db.Create((&model.OwnerHistory{VehicleId: sold.ID}).FromUser(user)).Error)
+
+	grant := model.VehicleDrivers{Uuid: uuid.New(), VehicleId: sold.ID, UserId: user.ID, Given: time.Now()}
+	suite.Require().NoError(suite.db.Create(&grant).Error)
+	// removed rows are exported as well
+	suite.Require().NoError(suite.db.Delete(&grant).Error)
+
+	device := model.Mobile{Uuid: uuid.New(), UserId: user.ID, CreatorId: user.ID, DeviceId: "export-device", ActivationToken: "export-token"}
+	suite.Require().NoError(suite.db.Create(&device).Error)
+	suite.Require().NoError(suite.db.Create(&model.RefreshToken{
+		Uuid: uuid.New(), FamilyUuid: uuid.New(), UserId: user.ID, ExpiresAt: time.Now().Add(time.Hour), Ip: testIp,
+	}).Error)
+	suite.Require().NoError(suite.db.Create(&model.RefreshToken{
+		Uuid: uuid.New(), FamilyUuid: uuid.New(), UserId: other.ID, ExpiresAt: time.Now().Add(time.Hour), Ip: testIp,
+	}).Error)
+
+	organisation := model.Organisation{Uuid: uuid.New(), Name: "Prijevoz d.o.o.", OIB: "12345678903"}
+	suite.Require().NoError(suite.db.Create(&organisation).Error)
+	suite.Require().NoError(suite.db.Create(&model.OrganisationMember{OrganisationId: organisation.ID, UserId: user.ID, Role: model.OrgRoleDriver}).Error)
+	suite.Require().NoError(suite.db.Create(&model.OrganisationMember{OrganisationId: organisation.ID, UserId: other.ID, Role: model.OrgRoleOwner}).Error)
+
+	export, err := suite.service.Export(user.Uuid)
+	suite.Require().NoError(err)
+
+	assert.Equal(suite.T(), user.ID, export.User.ID)
+	suite.Require().Len(export.Vehicles, 1)
+	assert.Equal(suite.T(), owned.Uuid, export.Vehicles[0].Uuid)
+	suite.Require().Len(export.OwnerHistory, 1)
+	suite.Require().Len(export.DriverGrants, 1)
+	assert.True(suite.T(), export.DriverGrants[0].DeletedAt.Valid)
+	assert.Len(suite.T(), export.Devices, 1)
+	assert.Len(suite.T(), export.Sessions, 1)
+	suite.Require().Len(export.Memberships, 1)
+	assert.Equal(suite.T(), organisation.Uuid, export.Memberships[0].Organisation.Uuid)
+	assert.Equal(suite.T(), model.OrgRoleDriver, export.Memberships[0].Role)
+	assert.Nil(suite.T(), export.License)
+	assert.Nil(suite.T(), export.Totp)
+	assert.Equal(suite.T(), "Fiat", export.Referenced[sold.ID].Mark)
+}
+
+func (suite *DataExportServiceTestSuite) TestExport_UnknownUser() {
+	_, err := suite.service.Export(uuid.New())
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/device"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IDeviceService interface {
+	// GetDevices returns the mobile devices registered to a user
+	GetDevices(userUuid uuid.UUID) ([]model.Mobile, error)
+	// GetSessions returns the active logins of a user, the latest refresh token of every family
+	GetSessions(userUuid uuid.UUID) ([]model.RefreshToken, error)
+	// RevokeDevice removes a device of the user and revokes its device token
+	RevokeDevice(userUuid, deviceUuid uuid.UUID) error
+	// RevokeSession ends a login of the user, the session uuid is its refresh token family
+	RevokeSession(userUuid, sessionUuid uuid.UUID) error
+	// WipeOfficerDevices removes every device of a police officer and revokes all of their tokens
+	WipeOfficerDevices(officerUuid, adminUuid uuid.UUID) (int, error)
+	// IssueChallenge returns a nonce a device of the user signs to authorize a sensitive request
+	IssueChallenge(userUuid, deviceUuid uuid.UUID) (string, time.Time, error)
+}
+
+type DeviceService struct {
+	db            *gorm.DB
+	logger        *zap.SugaredLogger
+	deviceManager *device.DeviceManager
+}
+
+func NewDeviceService() IDeviceService {
+	var service IDeviceService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &DeviceService{
+			db:            db,
+			logger:        logger,
+			deviceManager: device.NewDeviceManager(),
+		}
+	})
+
+	return service
+}
+
+// GetDevices implements IDeviceService.
+func (s *DeviceService) GetDevices(userUuid uuid.UUID) ([]model.Mobile, error) {
+	user, err := s.user(userUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.deviceManager.FindUserDevices(user.ID)
+	if err != nil {
+		s.logger.Errorf("Failed to query devices of user = %s, error = %+v", userUuid, err)
+		return nil, err
+	}
+	return devices, nil
+}
+
+// GetSessions implements IDeviceService.
+func (s *DeviceService) GetSessions(userUuid uuid.UUID) ([]model.RefreshToken, error) {
+	user, err := s.user(userUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []model.RefreshToken
+	if err := s.db.
+		Where("user_id = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query sessions of user = %s, error = %+v", userUuid, err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeDevice implements IDeviceService.
+func (s *DeviceService) RevokeDevice(userUuid, deviceUuid uuid.UUID) error {
+	user, err := s.user(userUuid)
+	if err != nil {
+		return err
+	}
+
+	var mobile model.Mobile
+	if err := s.db.
+		Where("uuid = ? AND user_id = ?", deviceUuid, user.ID).
+		First(&mobile).
+		Error; err != nil {
+		return err
+	}
+
+	if err := s.deviceManager.RevokeDevices([]model.Mobile{mobile}); err != nil {
+		return err
+	}
+
+	s.logger.Infof("User = %s revoked device = %s", userUuid, deviceUuid)
+	return nil
+}
+
+// RevokeSession implements IDeviceService.
+func (s *DeviceService) RevokeSession(userUuid, sessionUuid uuid.UUID) error {
+	user, err := s.user(userUuid)
+	if err != nil {
+		return err
+	}
+
+	rez := s.db.
+		Model(&model.RefreshToken{}).
+		Where("family_uuid = ? AND user_id = ? AND revoked_at IS NULL", sessionUuid, user.ID).
+		Update("revoked_at", time.Now())
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke session = %s, error = %+v", sessionUuid, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	s.logger.Infof("User = %s revoked session = %s", userUuid, sessionUuid)
+	return nil
+}
+
+// WipeOfficerDevices implements IDeviceService.
+func (s *DeviceService) WipeOfficerDevices(officerUuid, adminUuid uuid.UUID) (int, error) {
+	officer, err := s.user(officerUuid)
+	if err != nil {
+		return 0, err
+	}
+	if officer.Role != model.RolePolicija {
+		return 0, cerror.ErrNotPoliceOfficer
+	}
+
+	devices, err := s.deviceManager.FindUserDevices(officer.ID)
+	if err != nil {
+		s.logger.Errorf("Failed to query devices of officer = %s, error = %+v", officerUuid, err)
+		return 0, err
+	}
+	if err := s.deviceManager.RevokeDevices(devices); err != nil {
+		return 0, err
+	}
+
+	// NOTE: access tokens issued with the device login are revoked as well
+	if err := auth.RevokeUser(officer.Uuid.String(), time.Now()); err != nil {
+		s.logger.Errorf("Failed to revoke tokens of officer = %s, error = %+v", officerUuid, err)
+		return 0, err
+	}
+	if err := s.db.
+		Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", officer.ID).
+		Update("revoked_at", time.Now()).
+		Error; err != nil {
+		s.logger.Errorf("Failed to revoke refresh tokens of officer = %s, error = %+v", officerUuid, err)
+		return 0, err
+	}
+
+	s.logger.Warnf("Admin = %s wiped %d devices of officer = %s", adminUuid, len(devices), officerUuid)
+	return len(devices), nil
+}
+
+// IssueChallenge implements IDeviceService.
+func (s *DeviceService) IssueChallenge(userUuid, deviceUuid uuid.UUID) (string, time.Time, error) {
+	user, err := s.user(userUuid)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var mobile model.Mobile
+	if err := s.db.
+		Where("uuid = ? AND user_id = ?", deviceUuid, user.ID).
+		First(&mobile).
+		Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	return s.deviceManager.IssueChallenge(&mobile)
+}
+
+func (s *DeviceService) user(userUuid uuid.UUID) (*model.User, error) {
+	var user model.User
+	if err := s.db.Where("uuid = ?", userUuid).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,334 @@
+package service_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/device"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type DeviceServiceTestSuite struct {
+	suite.Suite
+	db        *gorm.DB
+	service   service.IDeviceService
+	deviceMgr *device.DeviceManager
+	citizen   *model.User
+	officer   *model.User
+}
+
+func (suite *DeviceServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:deviceservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:          config.Dev,
+		AccessKey:    "device-service-test-access-key",
+		RefreshKey:   "device-service-test-refresh-key",
+		DeviceLimits: map[string]int{string(model.RoleOsoba): 2},
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewDeviceService()
+	suite.deviceMgr = device.NewDeviceManager()
+}
+
+func (suite *DeviceServiceTestSuite) TearDownSuite() {
+	auth.SetRevocationStore(auth.NewMemoryRevocationStore())
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *DeviceServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.DeviceChallenge{}, &model.Mobile{}, &model.RefreshToken{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+	auth.SetRevocationStore(auth.NewMemoryRevocationStore())
+
+	suite.citizen = suite.createUser("citizen@example.com", "12345678911", model.RoleOsoba)
+	suite.officer = suite.createUser("officer@example.com", "12345678912", model.RolePolicija)
+}
+
+func TestDeviceServiceSuite(t *testing.T) {
+	suite.Run(t, new(DeviceServiceTestSuite))
+}
+
+func (suite *DeviceServiceTestSuite) createUser(email, oib string, role model.UserRole) *model.User {
+	user := &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Device",
+		LastName:     "User",
+		OIB:          oib,
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        email,
+		PasswordHash: "hash",
+		Role:         role,
+	}
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *DeviceServiceTestSuite) register(user *model.User, deviceId string) (string, error) {
+	token, _, err := suite.deviceMgr.ValidateDeviceRegistration(user, device.DeviceInfo{
+		Platform:  "Android",
+		Brand:     "Google",
+		ModelName: "Pixel",
+		DeviceID:  deviceId,
+	}, "192.0.2.20")
+	return token, err
+}
+
+func (suite *DeviceServiceTestSuite) registerWithKey(user *model.User, deviceId string) (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	suite.Require().NoError(err)
+
+	_, _, err = suite.deviceMgr.ValidateDeviceRegistration(user, device.DeviceInfo{
+		Platform:    "Android",
+		Brand:       "Google",
+		ModelName:   "Pixel",
+		DeviceID:    deviceId,
+		PublicKey:   base64.StdEncoding.EncodeToString(der),
+		Attestation: "attestation",
+	}, "192.0.2.20")
+	return key, err
+}
+
+func sign(key *ecdsa.PrivateKey, nonce, method, path string) string {
+	digest := sha256.Sum256(device.ChallengeMessage(nonce, method, path))
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func (suite *DeviceServiceTestSuite) createSession(user *model.User, ip string, used bool) *model.RefreshToken {
+	session := &model.RefreshToken{
+		Uuid:       uuid.New(),
+		FamilyUuid: uuid.New(),
+		UserId:     user.ID,
+		ExpiresAt:  time.Now().Add(time.Hour),
+		Ip:         ip,
+	}
+	if used {
+		now := time.Now()
+		session.UsedAt = &now
+	}
+	suite.Require().NoError(suite.db.Create(session).Error)
+	return session
+}
+
+func (suite *DeviceServiceTestSuite) TestDeviceLimitPerRole() {
+	_, err := suite.register(suite.citizen, "citizen-phone")
+	suite.Require().NoError(err)
+	_, err = suite.register(suite.citizen, "citizen-tablet")
+	suite.Require().NoError(err)
+	_, err = suite.register(suite.citizen, "citizen-third")
+	assert.ErrorIs(suite.T(), err, cerror.ErrDeviceLimit)
+
+	// Roles without a configured limit keep a single device
+	_, err = suite.register(suite.officer, "officer-phone")
+	suite.Require().NoError(err)
+	_, err = suite.register(suite.officer, "officer-second")
+	assert.ErrorIs(suite.T(), err, cerror.ErrDeviceLimit)
+
+	devices, err := suite.service.GetDevices(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(devices, 2)
+	assert.Equal(suite.T(), "citizen-phone", devices[0].DeviceId)
+	assert.Equal(suite.T(), "Google", devices[0].Brand)
+	assert.Equal(suite.T(), "192.0.2.20", devices[0].LastSeenIp)
+	assert.NotNil(suite.T(), devices[0].LastSeenAt)
+}
+
+func (suite *DeviceServiceTestSuite) TestDeviceIdIsMatchedExactly() {
+	_, err := suite.register(suite.citizen, "phone-1")
+	suite.Require().NoError(err)
+
+	// NOTE: ids containing the id of another device used to match it
+	_, err = suite.register(suite.officer, "phone-10")
+	suite.Require().NoError(err)
+
+	found, err := suite.deviceMgr.FindDeviceByID("phone-1")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.citizen.ID, found.UserId)
+}
+
+func (suite *DeviceServiceTestSuite) TestRevokeDevice() {
+	token, err := suite.register(suite.citizen, "revoked-phone")
+	suite.Require().NoError(err)
+	devices, err := suite.service.GetDevices(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(devices, 1)
+
+	// Devices of other users can't be revoked
+	err = suite.service.RevokeDevice(suite.officer.Uuid, devices[0].Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	suite.Require().NoError(suite.service.RevokeDevice(suite.citizen.Uuid, devices[0].Uuid))
+
+	devices, err = suite.service.GetDevices(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), devices)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), auth.IsRevoked(claims), "Device token should not work on other routes either")
+}
+
+func (suite *DeviceServiceTestSuite) TestReloginRevokesReplacedToken() {
+	oldToken, err := suite.register(suite.citizen, "relogin-phone")
+	suite.Require().NoError(err)
+	newToken, err := suite.register(suite.citizen, "relogin-phone")
+	suite.Require().NoError(err)
+
+	_, oldClaims, err := auth.ParseToken("Bearer " + oldToken)
+	suite.Require().NoError(err)
+	_, newClaims, err := auth.ParseToken("Bearer " + newToken)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), auth.IsRevoked(oldClaims))
+	assert.False(suite.T(), auth.IsRevoked(newClaims))
+}
+
+func (suite *DeviceServiceTestSuite) TestSessions() {
+	active := suite.createSession(suite.citizen, "192.0.2.30", false)
+	suite.createSession(suite.citizen, "192.0.2.31", true)
+	suite.createSession(suite.officer, "192.0.2.32", false)
+
+	sessions, err := suite.service.GetSessions(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(sessions, 1)
+	assert.Equal(suite.T(), active.FamilyUuid, sessions[0].FamilyUuid)
+	assert.Equal(suite.T(), "192.0.2.30", sessions[0].Ip)
+
+	// Sessions of other users can't be revoked
+	err = suite.service.RevokeSession(suite.officer.Uuid, active.FamilyUuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	suite.Require().NoError(suite.service.RevokeSession(suite.citizen.Uuid, active.FamilyUuid))
+	sessions, err = suite.service.GetSessions(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), sessions)
+}
+
+func (suite *DeviceServiceTestSuite) TestWipeOfficerDevices() {
+	token, err := suite.register(suite.officer, "wiped-phone")
+	suite.Require().NoError(err)
+	suite.createSession(suite.officer, "192.0.2.40", false)
+	adminUuid := uuid.New()
+
+	count, err := suite.service.WipeOfficerDevices(suite.officer.Uuid, adminUuid)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 1, count)
+
+	devices, err := suite.service.GetDevices(suite.officer.Uuid)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), devices)
+	sessions, err := suite.service.GetSessions(suite.officer.Uuid)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), sessions)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), auth.IsRevoked(claims))
+}
+
+func (suite *DeviceServiceTestSuite) TestWipeOfficerDevices_NotOfficer() {
+	_, err := suite.register(suite.citizen, "citizen-kept")
+	suite.Require().NoError(err)
+
+	_, err = suite.service.WipeOfficerDevices(suite.citizen.Uuid, uuid.New())
+	assert.ErrorIs(suite.T(), err, cerror.ErrNotPoliceOfficer)
+
+	devices, err := suite.service.GetDevices(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), devices, 1)
+}
+
+func (suite *DeviceServiceTestSuite) TestSignedChallenge() {
+	device.SetAttestationVerifier(device.StubAttestationVerifier{})
+	defer device.SetAttestationVerifier(nil)
+
+	key, err := suite.registerWithKey(suite.officer, "signing-phone")
+	suite.Require().NoError(err)
+	devices, err := suite.service.GetDevices(suite.officer.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(devices, 1)
+	assert.NotNil(suite.T(), devices[0].AttestedAt)
+
+	// Devices of other users can't be challenged
+	_, _, err = suite.service.IssueChallenge(suite.citizen.Uuid, devices[0].Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	claims := &auth.Claims{Uuid: suite.officer.Uuid.String()}
+	nonce, expiresAt, err := suite.service.IssueChallenge(suite.officer.Uuid, devices[0].Uuid)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), expiresAt.After(time.Now()))
+	signature := sign(key, nonce, "GET", "/api/user/oib/12345678912")
+	suite.Require().NoError(suite.deviceMgr.VerifyDeviceSignature(claims, nonce, signature, "GET", "/api/user/oib/12345678912"))
+
+	// A nonce can only be used once
+	err = suite.deviceMgr.VerifyDeviceSignature(claims, nonce, signature, "GET", "/api/user/oib/12345678912")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidSignature)
+
+	// The signature covers the route
+	nonce, _, err = suite.service.IssueChallenge(suite.officer.Uuid, devices[0].Uuid)
+	suite.Require().NoError(err)
+	err = suite.deviceMgr.VerifyDeviceSignature(claims, nonce, sign(key, nonce, "GET", "/api/user/oib/1"), "PUT", "/api/tempdata/1")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidSignature)
+
+	// Other users can't answer the challenge
+	nonce, _, err = suite.service.IssueChallenge(suite.officer.Uuid, devices[0].Uuid)
+	suite.Require().NoError(err)
+	err = suite.deviceMgr.VerifyDeviceSignature(&auth.Claims{Uuid: suite.citizen.Uuid.String()}, nonce, sign(key, nonce, "GET", "/x"), "GET", "/x")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidSignature)
+}
+
+func (suite *DeviceServiceTestSuite) TestChallenge_NoKey() {
+	_, err := suite.register(suite.citizen, "keyless-phone")
+	suite.Require().NoError(err)
+	devices, err := suite.service.GetDevices(suite.citizen.Uuid)
+	suite.Require().NoError(err)
+
+	_, _, err = suite.service.IssueChallenge(suite.citizen.Uuid, devices[0].Uuid)
+	assert.ErrorIs(suite.T(), err, cerror.ErrNoDeviceKey)
+}
+
+func (suite *DeviceServiceTestSuite) TestAttestationFailure() {
+	device.SetAttestationVerifier(device.StubAttestationVerifier{Err: errors.New("not genuine")})
+	defer device.SetAttestationVerifier(nil)
+
+	_, err := suite.registerWithKey(suite.citizen, "rooted-phone")
+	assert.ErrorIs(suite.T(), err, cerror.ErrAttestationFailed)
+
+	_, _, err = suite.deviceMgr.ValidateDeviceRegistration(suite.citizen, device.DeviceInfo{
+		DeviceID:  "bad-key-phone",
+		PublicKey: "not a key",
+	}, "192.0.2.20")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidDeviceKey)
+}
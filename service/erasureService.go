@@ -0,0 +1,359 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IErasureService interface {
+	// Request schedules the erasure of the user after the grace period
+	Request(userUuid, requestedByUuid uuid.UUID) (*model.ErasureRequest, error)
+	// Cancel cancels the pending erasure request of the user
+	Cancel(userUuid uuid.UUID) (*model.ErasureRequest, error)
+	// GetAll returns every erasure request, newest first
+	GetAll() ([]model.ErasureRequest, error)
+	// GetCertificate returns a completed erasure request with its actions
+	GetCertificate(requestUuid uuid.UUID) (*model.ErasureRequest, error)
+	// Run erases users whose grace period passed and purges records whose
+	// retention period passed
+	Run() error
+}
+
+// retentionRule is a kind of record that refers to a user by column, the
+// records are purged when the user is erased or once their retention passed
+type retentionRule struct {
+	entity string
+	model  any
+	column string
+}
+
+// NOTE: names are the keys of RETENTION_DAYS
+var retentionRules = []retentionRule{
+	{"mobile", &model.Mobile{}, "user_id"},
+	{"temp_data", &model.TempData{}, "driver_id"},
+	{"vehicle_drivers", &model.VehicleDrivers{}, "user_id"},
+	{"driver_license", &model.DriverLicense{}, "user_id"},
+	{"owner_history", &model.OwnerHistory{}, "user_id"},
+	{"organisation_member", &model.OrganisationMember{}, "user_id"},
+	{"organisation_invitation", &model.OrganisationInvitation{}, "user_id"},
+	{"refresh_token", &model.RefreshToken{}, "user_id"},
+	{"password_reset_token", &model.PasswordResetToken{}, "user_id"},
+	{"email_change_token", &model.EmailChangeToken{}, "user_id"},
+	{"police_activation_code", &model.PoliceActivationCode{}, "user_id"},
+	{"oidc_identity", &model.OidcIdentity{}, "user_id"},
+	{"user_totp", &model.UserTotp{}, "user_id"},
+	{"recovery_code", &model.RecoveryCode{}, "user_id"},
+}
+
+func findRetentionRule(entity string) (retentionRule, bool) {
+	for _, rule := range retentionRules {
+		if rule.entity == entity {
+			return rule, true
+		}
+	}
+	return retentionRule{}, false
+}
+
+func (r retentionRule) records(tx *gorm.DB, userId uint) *gorm.DB {
+	return tx.Unscoped().Model(r.model).Where(r.column+" = ?", userId)
+}
+
+type ErasureService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewErasureService() IErasureService {
+	var service IErasureService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &ErasureService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Request implements IErasureService.
+func (s *ErasureService) Request(userUuid, requestedByUuid uuid.UUID) (*model.ErasureRequest, error) {
+	var user model.User
+	if err := s.db.Where("uuid = ?", userUuid).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var pending int64
+	if err := s.db.Model(&model.ErasureRequest{}).
+		Where("user_id = ? AND status = ?", user.ID, model.ErasurePending).
+		Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, cerror.ErrErasurePending
+	}
+	if err := s.keepOwner(s.db, user.ID); err != nil {
+		return nil, err
+	}
+
+	request := &model.ErasureRequest{
+		Uuid:            uuid.New(),
+		UserId:          user.ID,
+		UserUuid:        user.Uuid,
+		RequestedByUuid: requestedByUuid,
+		Status:          model.ErasurePending,
+		EraseAfter:      time.Now().Add(config.AppConfig.ErasureGrace()),
+	}
+	if err := s.db.Create(request).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("User %s requested erasure of user %s after %s", requestedByUuid, userUuid, request.EraseAfter)
+	return request, nil
+}
+
+// Cancel implements IErasureService.
+func (s *ErasureService) Cancel(userUuid uuid.UUID) (*model.ErasureRequest, error) {
+	var request model.ErasureRequest
+	if err := s.db.Where("user_uuid = ? AND status = ?", userUuid, model.ErasurePending).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cerror.ErrNoPendingErasure
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	// NOTE: conditional update so a request that is being erased can't be cancelled
+	rez := s.db.Model(&request).
+		Where("status = ?", model.ErasurePending).
+		Updates(map[string]any{"status": model.ErasureCancelled, "cancelled_at": now})
+	if rez.Error != nil {
+		return nil, rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return nil, cerror.ErrNoPendingErasure
+	}
+	request.Status = model.ErasureCancelled
+	request.CancelledAt = &now
+
+	s.logger.Infof("Erasure request %s of user %s cancelled", request.Uuid, userUuid)
+	return &request, nil
+}
+
+// GetAll implements IErasureService.
+func (s *ErasureService) GetAll() ([]model.ErasureRequest, error) {
+	var requests []model.ErasureRequest
+	if err := s.db.Order("created_at DESC, id DESC").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// GetCertificate implements IErasureService.
+func (s *ErasureService) GetCertificate(requestUuid uuid.UUID) (*model.ErasureRequest, error) {
+	var request model.ErasureRequest
+	if err := s.db.
+		Preload("Actions", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("uuid = ?", requestUuid).
+		First(&request).Error; err != nil {
+		return nil, err
+	}
+	if request.Status != model.ErasureCompleted {
+		return nil, cerror.ErrErasureNotCompleted
+	}
+	return &request, nil
+}
+
+// Run implements IErasureService.
+func (s *ErasureService) Run() error {
+	now := time.Now()
+
+	var due []model.ErasureRequest
+	if err := s.db.Where("status = ? AND erase_after <= ?", model.ErasurePending, now).Find(&due).Error; err != nil {
+		return err
+	}
+	for _, request := range due {
+		if err := s.erase(&request, now); err != nil {
+			if errors.Is(err, cerror.ErrNoPendingErasure) {
+				s.logger.Infof("Erasure request %s is no longer pending, skipped", request.Uuid)
+				continue
+			}
+			// NOTE: the request stays pending, the next run tries again
+			s.logger.Errorf("Failed to erase user %s of request %s err = %+v", request.UserUuid, request.Uuid, err)
+			continue
+		}
+		if err := auth.RevokeUser(request.UserUuid.String(), now); err != nil {
+			s.logger.Errorf("Failed to revoke tokens of erased user %s err = %+v", request.UserUuid, err)
+		}
+		s.logger.Infof("Erased user %s of request %s", request.UserUuid, request.Uuid)
+	}
+
+	return s.purgeRetained(now)
+}
+
+// erase pseudonymizes the user and purges or schedules the purge of every
+// record that refers to them
+func (s *ErasureService) erase(request *model.ErasureRequest, now time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// NOTE: conditional update so a request cancelled after it was loaded,
+		// or claimed by another run, is not erased
+		rez := tx.Model(&model.ErasureRequest{}).
+			Where("id = ? AND status = ?", request.ID, model.ErasurePending).
+			Updates(map[string]any{"status": model.ErasureCompleted, "erased_at": now})
+		if rez.Error != nil {
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return cerror.ErrNoPendingErasure
+		}
+
+		var user model.User
+		if err := tx.Unscoped().First(&user, request.UserId).Error; err != nil {
+			return err
+		}
+		// NOTE: the user may have become the last owner during the grace period
+		if err := s.keepOwner(tx, user.ID); err != nil {
+			return err
+		}
+
+		// NOTE: vehicles stay in the registry, the previous owner is remembered
+		// in the owner history that is kept for its retention period
+		var vehicles []model.Vehicle
+		if err := tx.Where("user_id = ?", user.ID).Find(&vehicles).Error; err != nil {
+			return err
+		}
+		for _, vehicle := range vehicles {
+			if err := tx.Create((&model.OwnerHistory{VehicleId: vehicle.ID}).FromUser(user)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&model.Vehicle{}).Where("user_id = ?", user.ID).Update("user_id", nil).Error; err != nil {
+			return err
+		}
+		actions := []model.ErasureAction{
+			{Entity: "vehicle", Action: model.ErasureUnlink, Count: int64(len(vehicles)), DoneAt: &now},
+		}
+
+		for _, rule := range retentionRules {
+			action := model.ErasureAction{Entity: rule.entity, Action: model.ErasurePurge}
+			if retain := config.AppConfig.RetentionPeriod(rule.entity); retain > 0 {
+				if err := rule.records(tx, user.ID).Count(&action.Count).Error; err != nil {
+					return err
+				}
+				until := now.Add(retain)
+				action.RetainUntil = &until
+			} else {
+				rez := rule.records(tx, user.ID).Delete(rule.model)
+				if rez.Error != nil {
+					return rez.Error
+				}
+				action.Count = rez.RowsAffected
+			}
+			if action.RetainUntil == nil || action.Count == 0 {
+				action.DoneAt = &now
+			}
+			actions = append(actions, action)
+		}
+
+		// Retained sessions must not be refreshed
+		if err := tx.Model(&model.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		user.FirstName = "Deleted"
+		user.LastName = "User"
+		user.OIB = fmt.Sprintf("000000%05d", user.ID)
+		user.BirthDate = time.Time{}
+		user.Residence = model.Address{Street: "Anonymized"}
+		user.ResidenceLegacy = nil
+		user.Email = fmt.Sprintf("deleted_%s@example.com", user.Uuid)
+		user.PasswordHash = ""
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		actions = append(actions, model.ErasureAction{Entity: "user", Action: model.ErasurePseudonymize, Count: 1, DoneAt: &now})
+
+		for i := range actions {
+			actions[i].ErasureRequestId = request.ID
+		}
+		if err := tx.Create(&actions).Error; err != nil {
+			return err
+		}
+
+		request.Status = model.ErasureCompleted
+		request.ErasedAt = &now
+		return nil
+	})
+}
+
+// keepOwner fails with cerror.ErrLastOwner if the user is the only owner of
+// an organisation, they have to hand it over before they can be erased
+func (s *ErasureService) keepOwner(tx *gorm.DB, userId uint) error {
+	var owned int64
+	if err := tx.Model(&model.OrganisationMember{}).
+		Where("user_id = ? AND role = ?", userId, model.OrgRoleOwner).
+		Where("NOT EXISTS (?)", tx.
+			Table("organisation_members AS other").
+			Select("1").
+			Where("other.organisation_id = organisation_members.organisation_id AND other.role = ? AND other.user_id <> ? AND other.deleted_at IS NULL",
+				model.OrgRoleOwner, userId)).
+		Count(&owned).
+		Error; err != nil {
+		return err
+	}
+	if owned > 0 {
+		return cerror.ErrLastOwner
+	}
+	return nil
+}
+
+// purgeRetained purges records of erased users whose retention period passed
+func (s *ErasureService) purgeRetained(now time.Time) error {
+	var actions []model.ErasureAction
+	if err := s.db.
+		Where("done_at IS NULL AND retain_until <= ?", now).
+		Find(&actions).Error; err != nil {
+		return err
+	}
+
+	for _, action := range actions {
+		rule, ok := findRetentionRule(action.Entity)
+		if !ok {
+			s.logger.Errorf("Unknown retention entity %s of erasure action %d", action.Entity, action.ID)
+			continue
+		}
+		var request model.ErasureRequest
+		if err := s.db.First(&request, action.ErasureRequestId).Error; err != nil {
+			return err
+		}
+
+		var purged int64
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			rez := rule.records(tx, request.UserId).Delete(rule.model)
+			if rez.Error != nil {
+				return rez.Error
+			}
+			purged = rez.RowsAffected
+			return tx.Model(&action).Update("done_at", now).Error
+		})
+		if err != nil {
+			return err
+		}
+		s.logger.Infof("Purged %d %s records of erased user %s", purged, action.Entity, request.UserUuid)
+	}
+	return nil
+}
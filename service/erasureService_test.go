@@ -0,0 +1,186 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type ErasureServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IErasureService
+}
+
+func (suite *ErasureServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:erasureservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewErasureService()
+}
+
+func (suite *ErasureServiceTestSuite) SetupTest() {
+	config.AppConfig = &config.AppConfiguration{
+		Env:              config.Dev,
+		ErasureGraceDays: 30,
+		RetentionDays:    map[string]int{"owner_history": 3650, "refresh_token": 90},
+	}
+}
+
+func (suite *ErasureServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestErasureServiceSuite(t *testing.T) {
+	suite.Run(t, new(ErasureServiceTestSuite))
+}
+
+func (suite *ErasureServiceTestSuite) seedUser(email, oib string) model.User {
+	user := model.User{Uuid: uuid.New(), FirstName: "Ana", LastName: "Horvat", Email: email, Role: model.RoleOsoba, OIB: oib, Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"}}
+	suite.Require().NoError(suite.db.Create(&user).Error)
+	return user
+}
+
+func (suite *ErasureServiceTestSuite) TestRequestAndCancel() {
+	user := suite.seedUser("cancel@test.hr", "69435151530")
+
+	request, err := suite.service.Request(user.Uuid, user.Uuid)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.ErasurePending, request.Status)
+	assert.WithinDuration(suite.T(), time.Now().Add(30*24*time.Hour), request.EraseAfter, time.Minute)
+
+	_, err = suite.service.Request(user.Uuid, uuid.New())
+	assert.ErrorIs(suite.T(), err, cerror.ErrErasurePending)
+
+	// the grace period has not passed
+	suite.Require().NoError(suite.service.Run())
+	var stored model.User
+	suite.Require().NoError(suite.db.First(&stored, user.ID).Error)
+	assert.Equal(suite.T(), "Ana", stored.FirstName)
+
+	cancelled, err := suite.service.Cancel(user.Uuid)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.ErasureCancelled, cancelled.Status)
+	assert.NotNil(suite.T(), cancelled.CancelledAt)
+
+	_, err = suite.service.Cancel(user.Uuid)
+	assert.ErrorIs(suite.T(), err, cerror.ErrNoPendingErasure)
+	_, err = suite.service.GetCertificate(request.Uuid)
+	assert.ErrorIs(suite.T(), err, cerror.ErrErasureNotCompleted)
+}
+
+func (suite *ErasureServiceTestSuite) TestRunErasesAndRetains() {
+	config.AppConfig.ErasureGraceDays = 0
+	user := suite.seedUser("erase@test.hr", "94577403194")
+
+	vehicle := model.Vehicle{Uuid: uuid.New(), UserId: &user.ID, Mark: "Skoda"}
+	suite.Require().NoError(suite.db.Create(&vehicle).Error)
+	suite.Require().NoError(suite.db.Create(&model.Mobile{
+		Uuid: uuid.New(), UserId: user.ID, CreatorId: user.ID, DeviceId: "erase-device", ActivationToken: "erase-token",
+	}).Error)
+	suite.Require().NoError(suite.db.Create(&model.RefreshToken{
+		Uuid: uuid.New(), FamilyUuid: uuid.New(), UserId: user.ID, ExpiresAt: time.Now().Add(time.Hour),
+	}).Error)
+
+	request, err := suite.service.Request(user.Uuid, uuid.New())
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.service.Run())
+
+	var erased model.User
+	suite.Require().NoError(suite.db.Unscoped().First(&erased, user.ID).Error)
+	assert.True(suite.T(), erased.DeletedAt.Valid)
+	assert.Equal(suite.T(), "Deleted", erased.FirstName)
+	assert.Empty(suite.T(), erased.PasswordHash)
+	assert.NotEqual(suite.T(), user.OIB, erased.OIB)
+
+	suite.Require().NoError(suite.db.First(&vehicle, vehicle.ID).Error)
+	assert.Nil(suite.T(), vehicle.UserId)
+	var count int64
+	suite.db.Unscoped().Model(&model.Mobile{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Zero(suite.T(), count)
+	var session model.RefreshToken
+	suite.Require().NoError(suite.db.Where("user_id = ?", user.ID).First(&session).Error)
+	assert.NotNil(suite.T(), session.RevokedAt)
+
+	certificate, err := suite.service.GetCertificate(request.Uuid)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.ErasureCompleted, certificate.Status)
+	actions := map[string]model.ErasureAction{}
+	for _, action := range certificate.Actions {
+		actions[action.Entity] = action
+	}
+	assert.EqualValues(suite.T(), 1, actions["vehicle"].Count)
+	assert.EqualValues(suite.T(), 1, actions["mobile"].Count)
+	assert.NotNil(suite.T(), actions["mobile"].DoneAt)
+	assert.Equal(suite.T(), model.ErasurePseudonymize, actions["user"].Action)
+	history := actions["owner_history"]
+	assert.EqualValues(suite.T(), 1, history.Count)
+	assert.Nil(suite.T(), history.DoneAt)
+	suite.Require().NotNil(history.RetainUntil)
+	assert.WithinDuration(suite.T(), time.Now().Add(3650*24*time.Hour), *history.RetainUntil, time.Minute)
+
+	// once the retention period passed the next run purges the records
+	suite.Require().NoError(suite.db.Model(&model.ErasureAction{}).
+		Where("id = ?", history.ID).
+		Update("retain_until", time.Now().Add(-time.Minute)).Error)
+	suite.Require().NoError(suite.service.Run())
+
+	suite.db.Unscoped().Model(&model.OwnerHistory{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Zero(suite.T(), count)
+	certificate, err = suite.service.GetCertificate(request.Uuid)
+	suite.Require().NoError(err)
+	for _, action := range certificate.Actions {
+		if action.Entity == "owner_history" {
+			assert.NotNil(suite.T(), action.DoneAt)
+			assert.EqualValues(suite.T(), 1, action.Count)
+		}
+	}
+}
+
+func (suite *ErasureServiceTestSuite) TestLastOwner() {
+	config.AppConfig.ErasureGraceDays = 0
+	owner := suite.seedUser("owner@test.hr", "12345678903")
+	other := suite.seedUser("coowner@test.hr", "10000000000")
+	organisation := model.Organisation{Uuid: uuid.New(), Name: "Prijevoz d.o.o.", OIB: "20000000009"}
+	suite.Require().NoError(suite.db.Create(&organisation).Error)
+	suite.Require().NoError(suite.db.Create(&model.OrganisationMember{OrganisationId: organisation.ID, UserId: owner.ID, Role: model.OrgRoleOwner}).Error)
+
+	_, err := suite.service.Request(owner.Uuid, owner.Uuid)
+	assert.ErrorIs(suite.T(), err, cerror.ErrLastOwner)
+
+	coOwner := model.OrganisationMember{OrganisationId: organisation.ID, UserId: other.ID, Role: model.OrgRoleOwner}
+	suite.Require().NoError(suite.db.Create(&coOwner).Error)
+	request, err := suite.service.Request(owner.Uuid, owner.Uuid)
+	suite.Require().NoError(err)
+
+	// the co-owner was demoted during the grace period
+	suite.Require().NoError(suite.db.Model(&coOwner).Update("role", model.OrgRoleDriver).Error)
+	suite.Require().NoError(suite.service.Run())
+	suite.Require().NoError(suite.db.First(&request, request.ID).Error)
+	assert.Equal(suite.T(), model.ErasurePending, request.Status)
+
+	suite.Require().NoError(suite.db.Model(&coOwner).Update("role", model.OrgRoleOwner).Error)
+	suite.Require().NoError(suite.service.Run())
+	suite.Require().NoError(suite.db.First(&request, request.ID).Error)
+	assert.Equal(suite.T(), model.ErasureCompleted, request.Status)
+}
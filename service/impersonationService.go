@@ -0,0 +1,168 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxAuditPathLength is the length of paths stored in the audit trail
+const maxAuditPathLength = 255
+
+type IImpersonationService interface {
+	// Start lets a superadmin act as the subject, it returns the impersonation token
+	Start(actorUuid, subjectUuid uuid.UUID, reason, ip string) (string, *model.ImpersonationSession, error)
+	// End ends the session of an impersonation token and revokes the token
+	End(claims *auth.Claims) error
+	// GetSessions returns every impersonation session, newest first
+	GetSessions() ([]model.ImpersonationSession, error)
+	// GetRequests returns the audit trail of a session
+	GetRequests(sessionUuid uuid.UUID) ([]model.ImpersonationRequest, error)
+	// RecordImpersonatedRequest writes the audit trail, it is installed as the auth.ImpersonationAuditor
+	RecordImpersonatedRequest(request auth.ImpersonatedRequest)
+}
+
+type ImpersonationService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewImpersonationService() IImpersonationService {
+	var service IImpersonationService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &ImpersonationService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Start implements IImpersonationService.
+func (s *ImpersonationService) Start(actorUuid, subjectUuid uuid.UUID, reason, ip string) (string, *model.ImpersonationSession, error) {
+	var actor model.User
+	if err := s.db.Where("uuid = ?", actorUuid).First(&actor).Error; err != nil {
+		return "", nil, err
+	}
+	if actor.Role != model.RoleSuperAdmin {
+		return "", nil, cerror.ErrForbidden
+	}
+
+	var subject model.User
+	if err := s.db.Where("uuid = ?", subjectUuid).First(&subject).Error; err != nil {
+		return "", nil, err
+	}
+	// superadmins are never impersonated, it would hide who changed access
+	if subject.Role == model.RoleSuperAdmin || subject.Uuid == actor.Uuid {
+		return "", nil, cerror.ErrCannotImpersonate
+	}
+
+	session := &model.ImpersonationSession{
+		Uuid:        uuid.New(),
+		ActorUuid:   actor.Uuid,
+		SubjectUuid: subject.Uuid,
+		Reason:      reason,
+		Ip:          ip,
+		ExpiresAt:   time.Now().Add(auth.ImpersonationTokenDuration),
+	}
+	token, err := auth.GenerateImpersonationToken(&subject, &actor, session.Uuid.String())
+	if err != nil {
+		s.logger.Errorf("Failed to generate impersonation token, error = %+v", err)
+		return "", nil, err
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		s.logger.Errorf("Failed to store impersonation session, error = %+v", err)
+		return "", nil, err
+	}
+
+	s.logger.Infof("Superadmin = %s started impersonating user = %s, session = %s, reason: %s",
+		actor.Uuid, subject.Uuid, session.Uuid, reason)
+	return token, session, nil
+}
+
+// End implements IImpersonationService.
+func (s *ImpersonationService) End(claims *auth.Claims) error {
+	if !claims.IsImpersonation() {
+		return cerror.ErrForbidden
+	}
+
+	rez := s.db.
+		Model(&model.ImpersonationSession{}).
+		Where("uuid = ? AND ended_at IS NULL", claims.ID).
+		Update("ended_at", time.Now())
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to end impersonation session = %s, error = %+v", claims.ID, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	if err := auth.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Errorf("Failed to revoke impersonation token = %s, error = %+v", claims.ID, err)
+		return err
+	}
+
+	s.logger.Infof("Superadmin = %s stopped impersonating user = %s, session = %s", claims.Actor.Uuid, claims.Uuid, claims.ID)
+	return nil
+}
+
+// GetSessions implements IImpersonationService.
+func (s *ImpersonationService) GetSessions() ([]model.ImpersonationSession, error) {
+	var sessions []model.ImpersonationSession
+	if err := s.db.Order("created_at DESC").Find(&sessions).Error; err != nil {
+		s.logger.Errorf("Failed to query impersonation sessions, error = %+v", err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetRequests implements IImpersonationService.
+func (s *ImpersonationService) GetRequests(sessionUuid uuid.UUID) ([]model.ImpersonationRequest, error) {
+	var session model.ImpersonationSession
+	if err := s.db.Where("uuid = ?", sessionUuid).First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	var requests []model.ImpersonationRequest
+	if err := s.db.Where("session_uuid = ?", sessionUuid).Order("created_at, id").Find(&requests).Error; err != nil {
+		s.logger.Errorf("Failed to query impersonated requests of session = %s, error = %+v", sessionUuid, err)
+		return nil, err
+	}
+	return requests, nil
+}
+
+// RecordImpersonatedRequest implements IImpersonationService.
+func (s *ImpersonationService) RecordImpersonatedRequest(request auth.ImpersonatedRequest) {
+	sessionUuid, err := uuid.Parse(request.Claims.ID)
+	if err != nil {
+		s.logger.Errorf("Impersonated request %s %s has a token without a session, jti = %s",
+			request.Method, request.Path, request.Claims.ID)
+		return
+	}
+
+	path := request.Path
+	if len(path) > maxAuditPathLength {
+		path = path[:maxAuditPathLength]
+	}
+	entry := &model.ImpersonationRequest{
+		SessionUuid: sessionUuid,
+		Method:      request.Method,
+		Path:        path,
+		Status:      request.Status,
+		Ip:          request.Ip,
+		Blocked:     request.Blocked,
+	}
+	if err := s.db.Create(entry).Error; err != nil {
+		// NOTE: the response was already written, failing to audit is only logged
+		s.logger.Errorf("Failed to audit impersonated request %s %s of session = %s, error = %+v",
+			request.Method, request.Path, sessionUuid, err)
+	}
+}
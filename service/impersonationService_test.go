@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type ImpersonationServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IImpersonationService
+	admin   model.User
+	citizen model.User
+}
+
+func (suite *ImpersonationServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:impersonationservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev, AccessKey: "impersonation-test-access-key"}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewImpersonationService()
+
+	suite.admin = model.User{Uuid: uuid.New(), Email: "admin@test.hr", Role: model.RoleSuperAdmin, OIB: "11111111111"}
+	suite.citizen = model.User{Uuid: uuid.New(), Email: "citizen@test.hr", Role: model.RoleOsoba, OIB: "22222222222"}
+	suite.Require().NoError(suite.db.Create(&suite.admin).Error)
+	suite.Require().NoError(suite.db.Create(&suite.citizen).Error)
+}
+
+func (suite *ImpersonationServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func TestImpersonationServiceSuite(t *testing.T) {
+	suite.Run(t, new(ImpersonationServiceTestSuite))
+}
+
+func (suite *ImpersonationServiceTestSuite) TestStartAndEnd() {
+	token, session, err := suite.service.Start(suite.admin.Uuid, suite.citizen.Uuid, "Ticket 42", testIp)
+	suite.Require().NoError(err)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.citizen.Uuid.String(), claims.Uuid)
+	assert.Equal(suite.T(), model.RoleOsoba, claims.Role)
+	assert.Equal(suite.T(), suite.admin.Uuid.String(), claims.Actor.Uuid)
+	assert.Equal(suite.T(), session.Uuid.String(), claims.ID)
+	assert.WithinDuration(suite.T(), session.ExpiresAt, claims.ExpiresAt.Time, time.Second)
+
+	suite.service.RecordImpersonatedRequest(auth.ImpersonatedRequest{
+		Claims: claims, Method: http.MethodGet, Path: "/api/vehicle/", Ip: testIp, Status: http.StatusOK,
+	})
+	suite.service.RecordImpersonatedRequest(auth.ImpersonatedRequest{
+		Claims: claims, Method: http.MethodDelete, Path: "/api/vehicle/1", Ip: testIp, Status: http.StatusForbidden, Blocked: true,
+	})
+	requests, err := suite.service.GetRequests(session.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(requests, 2)
+	assert.Equal(suite.T(), "/api/vehicle/", requests[0].Path)
+	assert.True(suite.T(), requests[1].Blocked)
+
+	suite.Require().NoError(suite.service.End(claims))
+	assert.True(suite.T(), auth.IsRevoked(claims))
+	assert.ErrorIs(suite.T(), suite.service.End(claims), gorm.ErrRecordNotFound)
+
+	sessions, err := suite.service.GetSessions()
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(sessions)
+	assert.Equal(suite.T(), "Ticket 42", sessions[0].Reason)
+	assert.NotNil(suite.T(), sessions[0].EndedAt)
+}
+
+func (suite *ImpersonationServiceTestSuite) TestStart_NotAllowed() {
+	_, _, err := suite.service.Start(suite.citizen.Uuid, suite.admin.Uuid, "reason", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrForbidden)
+
+	_, _, err = suite.service.Start(suite.admin.Uuid, suite.admin.Uuid, "reason", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrCannotImpersonate)
+
+	_, _, err = suite.service.Start(suite.admin.Uuid, uuid.New(), "reason", testIp)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *ImpersonationServiceTestSuite) TestEnd_RegularToken() {
+	err := suite.service.End(&auth.Claims{Uuid: suite.admin.Uuid.String(), Role: model.RoleSuperAdmin})
+	assert.ErrorIs(suite.T(), err, cerror.ErrForbidden)
+}
@@ -4,6 +4,7 @@ import (
 	"ePrometna_Server/app"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -13,11 +14,24 @@ import (
 type IDriverLicenseCrudService interface {
 	Create(license *model.DriverLicense, ownerUuid uuid.UUID) (*model.DriverLicense, error)
 	GetByUuid(uuid uuid.UUID) (*model.DriverLicense, error)
-	GetAll() ([]model.DriverLicense, error)
+	GetAll(params *paging.Params) ([]model.DriverLicense, *paging.Page, error)
+	GetAllForUser(userUuid uuid.UUID, params *paging.Params) ([]model.DriverLicense, *paging.Page, error)
 	Update(uuid uuid.UUID, updated *model.DriverLicense) (*model.DriverLicense, error)
 	Delete(uuid uuid.UUID) error
 }
 
+// LicenseListSpec is the list contract of driver licenses
+var LicenseListSpec = paging.Spec{
+	Fields: map[string]paging.Field{
+		"licenseNumber": {Column: "driver_licenses.license_number", Sortable: true, Filter: paging.FilterText},
+		"category":      {Column: "driver_licenses.category", Sortable: true, Filter: paging.FilterText},
+		"issueDate":     {Column: "driver_licenses.issue_date", Sortable: true, Filter: paging.FilterRange},
+		"expiringDate":  {Column: "driver_licenses.expiring_date", Sortable: true, Filter: paging.FilterRange},
+		"createdAt":     {Column: "driver_licenses.created_at", Sortable: true, Filter: paging.FilterRange},
+	},
+	DefaultSort: []string{"-createdAt"},
+}
+
 type DriverLicenseCrudService struct {
 	db          *gorm.DB
 	userService IUserCrudService
@@ -71,14 +85,30 @@ func (s *DriverLicenseCrudService) GetByUuid(uuid uuid.UUID) (*model.DriverLicen
 }
 
 // GetAll implements IDriverLicenseService.
-func (s *DriverLicenseCrudService) GetAll() ([]model.DriverLicense, error) {
+func (s *DriverLicenseCrudService) GetAll(params *paging.Params) ([]model.DriverLicense, *paging.Page, error) {
 	var licenses []model.DriverLicense
 	s.logger.Debug("Getting all driver licenses")
-	if err := s.db.Find(&licenses).Error; err != nil {
+	page, err := paging.Find(s.db, params, &licenses)
+	if err != nil {
 		s.logger.Errorf("Error getting all driver licenses: %+v", err)
-		return nil, err
+		return nil, nil, err
+	}
+	return licenses, page, nil
+}
+
+// GetAllForUser implements IDriverLicenseService.
+func (s *DriverLicenseCrudService) GetAllForUser(userUuid uuid.UUID, params *paging.Params) ([]model.DriverLicense, *paging.Page, error) {
+	var licenses []model.DriverLicense
+	s.logger.Debugf("Getting driver licenses of user = %s", userUuid)
+	query := s.db.
+		Joins("inner join users on driver_licenses.user_id = users.id").
+		Where("users.uuid = ?", userUuid)
+	page, err := paging.Find(query, params, &licenses)
+	if err != nil {
+		s.logger.Errorf("Error getting driver licenses of user = %s: %+v", userUuid, err)
+		return nil, nil, err
 	}
-	return licenses, nil
+	return licenses, page, nil
 }
 
 // Update implements IDriverLicenseService.
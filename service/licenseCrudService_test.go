@@ -7,6 +7,7 @@ import (
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
 	"errors"
 	"fmt"
 	"strings"
@@ -71,33 +72,37 @@ func (m *MockUserCrudServiceForLicense) Update(id uuid.UUID, user *model.User) (
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
-func (m *MockUserCrudServiceForLicense) Delete(id uuid.UUID) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
-
-func (m *MockUserCrudServiceForLicense) GetAllUsers() ([]model.User, error) {
-	args := m.Called()
+func (m *MockUserCrudServiceForLicense) GetAllUsers(params *paging.Params) ([]model.User, *paging.Page, error) {
+	args := m.Called(params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, page, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	return args.Get(0).([]model.User), page, args.Error(2)
 }
 
-func (m *MockUserCrudServiceForLicense) GetAllPoliceOfficers() ([]model.User, error) {
-	args := m.Called()
+func (m *MockUserCrudServiceForLicense) GetAllPoliceOfficers(params *paging.Params) ([]model.User, *paging.Page, error) {
+	args := m.Called(params)
+	var page *paging.Page
+	if v := args.Get(1); v != nil {
+		page = v.(*paging.Page)
+	}
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, page, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	return args.Get(0).([]model.User), page, args.Error(2)
 }
 
-func (m *MockUserCrudServiceForLicense) SearchUsersByName(query string) ([]model.User, error) {
-	args := m.Called(query)
+func (m *MockUserCrudServiceForLicense) SearchUsers(query string, field service.UserSearchField, params *paging.Params) ([]service.UserWithScore, *paging.Page, error) {
+	args := m.Called(query, field, params)
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, nil, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	page, _ := args.Get(1).(*paging.Page)
+	return args.Get(0).([]service.UserWithScore), page, args.Error(2)
 }
 
 func (m *MockUserCrudServiceForLicense) GetUserByOIB(oib string) (*model.User, error) {
@@ -212,7 +217,7 @@ func (suite *DriverLicenseCrudServiceTestSuite) seedUserForLicenseTest(email str
 		PasswordHash: hashedPassword,
 		Role:         role,
 		BirthDate:    time.Now().AddDate(-30, 0, 0),
-		Residence:    "License Test Residence",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	err := suite.db.Create(user).Error
 	suite.Require().NoError(err)
@@ -315,9 +320,14 @@ func (suite *DriverLicenseCrudServiceTestSuite) TestGetAllLicenses_Success() {
 	suite.db.Create(&model.DriverLicense{Uuid: uuid.New(), UserId: owner1.ID, LicenseNumber: "LICA1", Category: "A"})
 	suite.db.Create(&model.DriverLicense{Uuid: uuid.New(), UserId: owner2.ID, LicenseNumber: "LICB1", Category: "B"})
 
-	licenses, err := suite.licenseService.GetAll()
+	licenses, page, err := suite.licenseService.GetAll(listParams(suite.T(), service.LicenseListSpec, ""))
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), licenses, 2)
+	assert.EqualValues(suite.T(), 2, page.Total)
+
+	licenses, _, err = suite.licenseService.GetAll(listParams(suite.T(), service.LicenseListSpec, "category=B"))
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), licenses, 1)
 }
 
 func (suite *DriverLicenseCrudServiceTestSuite) TestUpdateLicense_Success() {
@@ -7,7 +7,9 @@ import (
 	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/device"
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -19,17 +21,44 @@ type MobileLoginResult struct {
 	DeviceToken  string
 }
 
+// LoginResult contains tokens, or a challenge when a second factor is required
+type LoginResult struct {
+	AccessToken  string
+	RefreshToken string
+	// MfaToken is returned instead of tokens and is exchanged through VerifyMfa
+	MfaToken string
+	// MfaEnrollRequired is set when the user has to enroll a second factor first
+	MfaEnrollRequired bool
+}
+
+// MfaEnrollmentResult is returned when the enrollment during login is confirmed
+type MfaEnrollmentResult struct {
+	AccessToken   string
+	RefreshToken  string
+	RecoveryCodes []string
+}
+
 type ILoginService interface {
-	Login(email, password string) (string, string, error)
-	RefreshTokens(user *model.User) (string, string, error)
-	LoginMobile(email, password string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error)
-	RegisterPolice(code string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error)
+	Login(email, password, ip string) (*LoginResult, error)
+	CompleteLogin(user *model.User, ip string) (*LoginResult, error)
+	VerifyMfa(mfaToken, code, ip string) (string, string, error)
+	BeginMfaEnrollment(mfaToken string) (*TotpEnrollment, error)
+	ConfirmMfaEnrollment(mfaToken, code, ip string) (*MfaEnrollmentResult, error)
+	RefreshTokens(refreshToken, ip string) (string, string, error)
+	RevokeUserTokens(userId uint) error
+	Logout(claims *auth.Claims, refreshToken string) error
+	LogoutEverywhere(userUuid uuid.UUID) error
+	LoginMobile(email, password, ip string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error)
+	RegisterPolice(code, ip string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error)
 }
 
 type LoginService struct {
 	db            *gorm.DB
 	logger        *zap.SugaredLogger
 	deviceManager *device.DeviceManager
+	mfa           IMfaService
+	throttle      ILoginThrottleService
+	policeCodes   IPoliceCodeService
 }
 
 func NewLoginService() ILoginService {
@@ -43,45 +72,187 @@ func NewLoginService() ILoginService {
 			db:            db,
 			logger:        logger,
 			deviceManager: deviceManager,
+			mfa:           NewMfaService(),
+			throttle:      NewLoginThrottleService(),
+			policeCodes:   NewPoliceCodeService(),
 		}
 	})
 
 	return service
 }
 
-func (s *LoginService) Login(email, password string) (string, string, error) {
+// Login authenticates a user, failed attempts are counted per email and per
+// client ip and further attempts are delayed or locked
+func (s *LoginService) Login(email, password, ip string) (*LoginResult, error) {
+	keys := []ThrottleKey{EmailKey(email), IpKey(ip)}
+	if err := s.throttle.Check(keys...); err != nil {
+		return nil, err
+	}
+
 	var user model.User
 	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			s.logger.Debugf("User not found Email = %s", email)
-			return "", "", cerror.ErrInvalidCredentials
+			s.recordFailure(keys...)
+			return nil, cerror.ErrInvalidCredentials
 		}
 
 		s.logger.Errorf("Failed to query user, error = %+v", err)
-		return "", "", err
+		return nil, err
 	}
 
 	if !auth.VerifyPassword(user.PasswordHash, password) {
 		s.logger.Debugf("Invalid password for user Email: %s, uuid: %s", user.Email, user.Uuid)
-		return "", "", cerror.ErrInvalidCredentials
+		s.recordFailure(keys...)
+		return nil, cerror.ErrInvalidCredentials
+	}
+
+	if err := s.throttle.Reset(EmailKey(email)); err != nil {
+		return nil, err
+	}
+	if auth.NeedsRehash(user.PasswordHash) {
+		s.rehashPassword(&user, password)
 	}
 
-	token, refresh, err := auth.GenerateTokens(&user)
+	return s.CompleteLogin(&user, ip)
+}
+
+// CompleteLogin issues tokens to a user that was authenticated by other means,
+// the second factor is still required for roles that need it
+func (s *LoginService) CompleteLogin(user *model.User, ip string) (*LoginResult, error) {
+	// Second factor is checked before any token is issued
+	if s.mfa.IsRequired(user.Role) {
+		enrolled, err := s.mfa.IsEnrolled(user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		mfaToken, err := auth.GenerateMfaToken(user)
+		if err != nil {
+			s.logger.Errorf("Failed to generate mfa token error = %+v", err)
+			return nil, err
+		}
+
+		s.logger.Debugf("Second factor required for user uuid = %s, enrolled = %t", user.Uuid, enrolled)
+		return &LoginResult{
+			MfaToken:          mfaToken,
+			MfaEnrollRequired: !enrolled,
+		}, nil
+	}
+
+	accessToken, refreshToken, err := s.issueTokens(user, uuid.New(), ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// VerifyMfa completes a login with a TOTP or recovery code
+func (s *LoginService) VerifyMfa(mfaToken, code, ip string) (string, string, error) {
+	user, claims, err := s.userFromMfaToken(mfaToken)
 	if err != nil {
-		s.logger.Errorf("Failed to generate token error = %+v", err)
 		return "", "", err
 	}
 
-	return token, refresh, nil
+	// Codes are short so guesses count against the account like passwords
+	if err := s.throttle.Check(EmailKey(user.Email)); err != nil {
+		return "", "", err
+	}
+	if err := s.mfa.Verify(user.ID, code); err != nil {
+		if errors.Is(err, cerror.ErrInvalidMfaCode) {
+			s.recordFailure(EmailKey(user.Email))
+		}
+		return "", "", err
+	}
+
+	s.consumeMfaToken(claims)
+	return s.issueTokens(user, uuid.New(), ip)
+}
+
+// BeginMfaEnrollment starts the enrollment of a user that has to enroll before logging in
+func (s *LoginService) BeginMfaEnrollment(mfaToken string) (*TotpEnrollment, error) {
+	user, _, err := s.userFromMfaToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.mfa.BeginEnrollment(user)
+}
+
+// ConfirmMfaEnrollment confirms the enrollment and completes the login
+func (s *LoginService) ConfirmMfaEnrollment(mfaToken, code, ip string) (*MfaEnrollmentResult, error) {
+	user, claims, err := s.userFromMfaToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// A stolen challenge token could otherwise guess codes of a new secret
+	if err := s.throttle.Check(EmailKey(user.Email)); err != nil {
+		return nil, err
+	}
+	codes, err := s.mfa.ConfirmEnrollment(user.ID, code)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidMfaCode) {
+			s.recordFailure(EmailKey(user.Email))
+		}
+		return nil, err
+	}
+
+	s.consumeMfaToken(claims)
+	accessToken, refreshToken, err := s.issueTokens(user, uuid.New(), ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MfaEnrollmentResult{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// userFromMfaToken checks the challenge token and reloads its user
+func (s *LoginService) userFromMfaToken(mfaToken string) (*model.User, *auth.Claims, error) {
+	claims, err := auth.ParseMfaToken(mfaToken)
+	if err != nil || auth.IsRevoked(claims) {
+		s.logger.Debugf("Invalid mfa token, error = %+v", err)
+		return nil, nil, cerror.ErrInvalidMfaToken
+	}
+
+	var user model.User
+	if err := s.db.Where("uuid = ?", claims.Uuid).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, cerror.ErrInvalidMfaToken
+		}
+		s.logger.Errorf("Failed to query user, error = %+v", err)
+		return nil, nil, err
+	}
+
+	return &user, claims, nil
+}
+
+// consumeMfaToken makes a challenge token single use
+func (s *LoginService) consumeMfaToken(claims *auth.Claims) {
+	if err := auth.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Errorf("Failed to revoke mfa token, error = %+v", err)
+	}
 }
 
 // LoginMobile authenticates a user and manages their device registration
-func (s *LoginService) LoginMobile(email, password string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error) {
+func (s *LoginService) LoginMobile(email, password, ip string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error) {
 	// Authenticate user
-	accessToken, refreshToken, err := s.Login(email, password)
+	login, err := s.Login(email, password, ip)
 	if err != nil {
 		return nil, err
 	}
+	// NOTE: mobile apps are used by citizens and officers, privileged roles log in through the web
+	if login.MfaToken != "" {
+		return nil, cerror.ErrMfaRequired
+	}
 
 	// Get user from database
 	var user model.User
@@ -91,60 +262,255 @@ func (s *LoginService) LoginMobile(email, password string, deviceInfo device.Dev
 	}
 
 	// Handle device registration through the device manager
-	deviceToken, _, err := s.deviceManager.ValidateDeviceRegistration(&user, deviceInfo)
+	deviceToken, _, err := s.deviceManager.ValidateDeviceRegistration(&user, deviceInfo, ip)
 	if err != nil {
 		return nil, err
 	}
 
 	// Return all tokens
 	return &MobileLoginResult{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:  login.AccessToken,
+		RefreshToken: login.RefreshToken,
 		DeviceToken:  deviceToken,
 	}, nil
 }
 
-func (s *LoginService) RefreshTokens(user *model.User) (string, string, error) {
-	return auth.GenerateTokens(user)
-}
+// RefreshTokens rotates a refresh token, the used token is invalidated and a new
+// pair is issued in the same family. Presenting an already used token revokes
+// the whole family since it means the token was copied.
+func (s *LoginService) RefreshTokens(refreshToken, ip string) (string, string, error) {
+	claims, err := auth.ParseRefreshToken(refreshToken)
+	if err != nil {
+		s.logger.Debugf("Failed to parse refresh token, error = %+v", err)
+		return "", "", cerror.ErrInvalidRefresh
+	}
 
-func (s *LoginService) RegisterPolice(code string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error) {
-	// Get user from database
+	tokenUuid, err := uuid.Parse(claims.ID)
+	if err != nil {
+		s.logger.Debugf("Refresh token has a bad id = %s", claims.ID)
+		return "", "", cerror.ErrInvalidRefresh
+	}
+
+	var stored model.RefreshToken
+	if err := s.db.
+		Where("uuid = ?", tokenUuid).
+		First(&stored).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Debugf("Refresh token %s is not known", tokenUuid)
+			return "", "", cerror.ErrInvalidRefresh
+		}
+		s.logger.Errorf("Failed to query refresh token, error = %+v", err)
+		return "", "", err
+	}
+
+	now := time.Now()
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return "", "", s.handleReuse(&stored)
+	}
+	if !stored.IsActive(now) {
+		return "", "", cerror.ErrInvalidRefresh
+	}
+
+	// NOTE: conditional update so two parallel refreshes can't both succeed
+	rez := s.db.
+		Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", stored.ID).
+		Update("used_at", now)
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to mark refresh token as used, error = %+v", rez.Error)
+		return "", "", rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return "", "", s.handleReuse(&stored)
+	}
+
+	// Reload user so role changes and deletions are applied
 	var user model.User
+	if err := s.db.First(&user, stored.UserId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Debugf("User with id = %d no longer exists", stored.UserId)
+			return "", "", cerror.ErrInvalidRefresh
+		}
+		s.logger.Errorf("Failed to query user, error = %+v", err)
+		return "", "", err
+	}
+
+	return s.issueTokens(&user, stored.FamilyUuid, ip)
+}
+
+// RevokeUserTokens revokes every active refresh token of a user
+func (s *LoginService) RevokeUserTokens(userId uint) error {
+	rez := s.db.
+		Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now())
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke refresh tokens for user id = %d, error = %+v", userId, rez.Error)
+		return rez.Error
+	}
+
+	s.logger.Debugf("Revoked %d refresh tokens for user id = %d", rez.RowsAffected, userId)
+	return nil
+}
+
+// Logout revokes the access token with given claims and, if given, the
+// refresh token family it was issued with
+func (s *LoginService) Logout(claims *auth.Claims, refreshToken string) error {
+	if claims == nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return cerror.ErrInvalidTokenFormat
+	}
+
+	if err := auth.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.Errorf("Failed to revoke access token, error = %+v", err)
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	refreshClaims, err := auth.ParseRefreshToken(refreshToken)
+	if err != nil || refreshClaims.Uuid != claims.Uuid {
+		s.logger.Debugf("Refresh token on logout is not valid for user = %s", claims.Uuid)
+		return cerror.ErrInvalidRefresh
+	}
+
+	tokenUuid, err := uuid.Parse(refreshClaims.ID)
+	if err != nil {
+		return cerror.ErrInvalidRefresh
+	}
+
+	var stored model.RefreshToken
 	if err := s.db.
-		Where("police_token = ?", code).
-		First(&user).
+		Where("uuid = ?", tokenUuid).
+		First(&stored).
 		Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			s.logger.Debugf("Failed to register officer", err)
-			return nil, cerror.ErrInvalidCredentials
+			return cerror.ErrInvalidRefresh
 		}
+		s.logger.Errorf("Failed to query refresh token, error = %+v", err)
+		return err
+	}
 
-		s.logger.Errorf("Error finding police officer, error = %+v", err)
-		return nil, err
+	return s.revokeFamily(stored.FamilyUuid)
+}
+
+// LogoutEverywhere revokes every access, device and refresh token of a user
+func (s *LoginService) LogoutEverywhere(userUuid uuid.UUID) error {
+	var user model.User
+	if err := s.db.
+		Where("uuid = ?", userUuid).
+		First(&user).
+		Error; err != nil {
+		return err
+	}
+
+	if err := auth.RevokeUser(user.Uuid.String(), time.Now()); err != nil {
+		s.logger.Errorf("Failed to revoke tokens of user = %s, error = %+v", userUuid, err)
+		return err
+	}
+
+	return s.RevokeUserTokens(user.ID)
+}
+
+// rehashPassword upgrades an old hash after the password was verified,
+// an error is only logged since the login itself succeeded
+func (s *LoginService) rehashPassword(user *model.User, password string) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		s.logger.Errorf("Failed to rehash password of user = %s, error = %+v", user.Uuid, err)
+		return
+	}
+
+	if err := s.db.Model(user).Update("password_hash", hash).Error; err != nil {
+		s.logger.Errorf("Failed to store rehashed password of user = %s, error = %+v", user.Uuid, err)
+		return
+	}
+	s.logger.Infof("Rehashed password of user = %s", user.Uuid)
+}
+
+// recordFailure counts a failed attempt, an error is only logged so the
+// caller still gets the original error
+func (s *LoginService) recordFailure(keys ...ThrottleKey) {
+	if err := s.throttle.Fail(keys...); err != nil {
+		s.logger.Errorf("Failed to record failed attempt, error = %+v", err)
+	}
+}
+
+// handleReuse revokes the family of a token that was presented more than once
+func (s *LoginService) handleReuse(stored *model.RefreshToken) error {
+	s.logger.Warnf("Refresh token reuse detected, token = %s, family = %s, user id = %d", stored.Uuid, stored.FamilyUuid, stored.UserId)
+	if err := s.revokeFamily(stored.FamilyUuid); err != nil {
+		return err
+	}
+	return cerror.ErrRefreshReuse
+}
+
+func (s *LoginService) revokeFamily(family uuid.UUID) error {
+	rez := s.db.
+		Model(&model.RefreshToken{}).
+		Where("family_uuid = ? AND revoked_at IS NULL", family).
+		Update("revoked_at", time.Now())
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke refresh token family = %s, error = %+v", family, rez.Error)
+		return rez.Error
 	}
 
-	// Hash the police token after successful authentication
-	hashedToken, err := auth.HashPassword(code)
+	s.logger.Infof("Revoked refresh token family = %s", family)
+	return nil
+}
+
+// issueTokens generates a new token pair and stores the refresh token in the
+// given family, ip is shown in the sessions of the user
+func (s *LoginService) issueTokens(user *model.User, family uuid.UUID, ip string) (string, string, error) {
+	stored := model.RefreshToken{
+		Uuid:       uuid.New(),
+		FamilyUuid: family,
+		UserId:     user.ID,
+		ExpiresAt:  time.Now().Add(auth.RefreshTokenDuration),
+		Ip:         ip,
+	}
+
+	token, refresh, err := auth.GenerateTokenPair(user, stored.Uuid.String())
 	if err != nil {
-		s.logger.Errorf("Failed to hash police token, error = %+v", err)
+		s.logger.Errorf("Failed to generate token error = %+v", err)
+		return "", "", err
+	}
+
+	if err := s.db.Create(&stored).Error; err != nil {
+		s.logger.Errorf("Failed to store refresh token, error = %+v", err)
+		return "", "", err
+	}
+
+	return token, refresh, nil
+}
+
+// RegisterPolice registers an officer device with a one time code, failed
+// guesses are counted per client ip and against the code they were aimed at
+func (s *LoginService) RegisterPolice(code, ip string, deviceInfo device.DeviceInfo) (*MobileLoginResult, error) {
+	if err := s.throttle.Check(PoliceKey(ip)); err != nil {
 		return nil, err
 	}
 
-	// Update the police token with the hashed version
-	if err := s.db.Model(&user).Update("police_token", hashedToken).Error; err != nil {
-		s.logger.Errorf("Failed to update police token, error = %+v", err)
+	// NOTE: the code is used up before the device is registered, if the
+	// registration fails the officer needs a new code
+	user, err := s.policeCodes.Redeem(code)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidCredentials) {
+			s.logger.Debugf("Failed to register officer, err = %+v", err)
+			s.recordFailure(PoliceKey(ip))
+		}
 		return nil, err
 	}
 
-	accessToken, refreshToken, err := auth.GenerateTokens(&user)
+	accessToken, refreshToken, err := s.issueTokens(user, uuid.New(), ip)
 	if err != nil {
-		s.logger.Errorf("Failed to generate token error = %+v", err)
 		return nil, err
 	}
 
 	// Handle device registration through the device manager
-	deviceToken, _, err := s.deviceManager.ValidateDeviceRegistration(&user, deviceInfo)
+	deviceToken, _, err := s.deviceManager.ValidateDeviceRegistration(user, deviceInfo, ip)
 	if err != nil {
 		return nil, err
 	}
@@ -19,6 +19,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -33,6 +34,9 @@ type LoginServiceTestSuite struct {
 	logObserver  *observer.ObservedLogs
 }
 
+// testIp is the client ip used for logins in tests
+const testIp = "192.0.2.1"
+
 // SetupSuite runs once before all tests in the suite
 func (suite *LoginServiceTestSuite) SetupSuite() {
 	core, obs := observer.New(zap.InfoLevel)
@@ -85,6 +89,16 @@ func (suite *LoginServiceTestSuite) clearTables(tables ...string) {
 			modelInstance = &model.User{}
 		case "mobiles":
 			modelInstance = &model.Mobile{}
+		case "refresh_tokens":
+			modelInstance = &model.RefreshToken{}
+		case "user_totps":
+			modelInstance = &model.UserTotp{}
+		case "recovery_codes":
+			modelInstance = &model.RecoveryCode{}
+		case "login_throttles":
+			modelInstance = &model.LoginThrottle{}
+		case "lock_events":
+			modelInstance = &model.LockEvent{}
 		default:
 			suite.T().Fatalf("Unsupported table for clearing: %s", table)
 		}
@@ -95,8 +109,19 @@ func (suite *LoginServiceTestSuite) clearTables(tables ...string) {
 
 // SetupTest runs before each test
 func (suite *LoginServiceTestSuite) SetupTest() {
-	suite.logObserver.TakeAll()           // Clear observed logs
-	suite.clearTables("users", "mobiles") // Clear relevant tables
+	suite.logObserver.TakeAll()                                                                                               // Clear observed logs
+	suite.clearTables("users", "mobiles", "refresh_tokens", "user_totps", "recovery_codes", "login_throttles", "lock_events") // Clear relevant tables
+	config.AppConfig.MfaRoles = nil
+	auth.SetRevocationStore(auth.NewMemoryRevocationStore())
+}
+
+// login helper returns tokens of a login without a second factor
+func (suite *LoginServiceTestSuite) login(email, password string) (string, string, error) {
+	result, err := suite.loginService.Login(email, password, testIp)
+	if err != nil {
+		return "", "", err
+	}
+	return result.AccessToken, result.RefreshToken, nil
 }
 
 // Helper to create a user with a hashed password
@@ -112,7 +137,7 @@ func (suite *LoginServiceTestSuite) createTestUser(email, plainPassword string,
 		PasswordHash: hashedPassword,
 		Role:         role,
 		BirthDate:    time.Now().AddDate(-25, 0, 0),
-		Residence:    "Test Residence",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	err = suite.db.Create(user).Error
 	suite.Require().NoError(err, "Failed to create user for test")
@@ -131,7 +156,7 @@ func (suite *LoginServiceTestSuite) TestLogin_Success() {
 	password := "password123"
 	suite.createTestUser(email, password, model.RoleOsoba)
 
-	accessToken, refreshToken, err := suite.loginService.Login(email, password)
+	accessToken, refreshToken, err := suite.login(email, password)
 
 	assert.NoError(suite.T(), err)
 	assert.NotEmpty(suite.T(), accessToken)
@@ -139,7 +164,7 @@ func (suite *LoginServiceTestSuite) TestLogin_Success() {
 }
 
 func (suite *LoginServiceTestSuite) TestLogin_UserNotFound() {
-	accessToken, refreshToken, err := suite.loginService.Login("nonexistent@example.com", "password123")
+	accessToken, refreshToken, err := suite.login("nonexistent@example.com", "password123")
 
 	assert.Error(suite.T(), err)
 	assert.True(suite.T(), errors.Is(err, cerror.ErrInvalidCredentials))
@@ -152,7 +177,7 @@ func (suite *LoginServiceTestSuite) TestLogin_IncorrectPassword() {
 	password := "password123"
 	suite.createTestUser(email, password, model.RoleOsoba)
 
-	accessToken, refreshToken, err := suite.loginService.Login(email, "wrongPassword")
+	accessToken, refreshToken, err := suite.login(email, "wrongPassword")
 
 	assert.Error(suite.T(), err)
 	assert.True(suite.T(), errors.Is(err, cerror.ErrInvalidCredentials))
@@ -161,24 +186,469 @@ func (suite *LoginServiceTestSuite) TestLogin_IncorrectPassword() {
 }
 
 func (suite *LoginServiceTestSuite) TestRefreshTokens_Success() {
-	user := suite.createTestUser("refreshuser@example.com", "password123", model.RoleFirma)
+	email := "refreshuser@example.com"
+	password := "password123"
+	user := suite.createTestUser(email, password, model.RoleFirma)
+
+	_, refreshToken, err := suite.login(email, password)
+	suite.Require().NoError(err)
 
-	accessToken, refreshToken, err := suite.loginService.RefreshTokens(user)
+	accessToken, newRefreshToken, err := suite.loginService.RefreshTokens(refreshToken, testIp)
 
 	assert.NoError(suite.T(), err)
 	assert.NotEmpty(suite.T(), accessToken)
-	assert.NotEmpty(suite.T(), refreshToken)
+	assert.NotEmpty(suite.T(), newRefreshToken)
+	assert.NotEqual(suite.T(), refreshToken, newRefreshToken)
 
 	_, accessClaims, errAccess := auth.ParseToken("Bearer " + accessToken)
 	suite.Require().NoError(errAccess)
 	assert.Equal(suite.T(), user.Uuid.String(), accessClaims.Uuid)
 
 	var refreshClaims auth.Claims
-	_, errRefresh := jwt.ParseWithClaims(refreshToken, &refreshClaims, func(token *jwt.Token) (interface{}, error) {
+	_, errRefresh := jwt.ParseWithClaims(newRefreshToken, &refreshClaims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(config.AppConfig.RefreshKey), nil
 	})
 	suite.Require().NoError(errRefresh)
 	assert.Equal(suite.T(), user.Uuid.String(), refreshClaims.Uuid)
+
+	// Both tokens belong to the same family
+	var stored []model.RefreshToken
+	suite.Require().NoError(suite.db.Where("user_id = ?", user.ID).Find(&stored).Error)
+	suite.Require().Len(stored, 2)
+	assert.Equal(suite.T(), stored[0].FamilyUuid, stored[1].FamilyUuid)
+}
+
+func (suite *LoginServiceTestSuite) TestRefreshTokens_ReloadsUser() {
+	email := "refresh.role@example.com"
+	password := "password123"
+	user := suite.createTestUser(email, password, model.RoleOsoba)
+
+	_, refreshToken, err := suite.login(email, password)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.db.Model(user).Update("role", model.RoleFirma).Error)
+
+	accessToken, _, err := suite.loginService.RefreshTokens(refreshToken, testIp)
+	suite.Require().NoError(err)
+
+	_, claims, err := auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.RoleFirma, claims.Role)
+}
+
+func (suite *LoginServiceTestSuite) TestRefreshTokens_ReuseRevokesFamily() {
+	email := "refresh.reuse@example.com"
+	password := "password123"
+	user := suite.createTestUser(email, password, model.RoleOsoba)
+
+	_, refreshToken, err := suite.login(email, password)
+	suite.Require().NoError(err)
+
+	_, rotatedToken, err := suite.loginService.RefreshTokens(refreshToken, testIp)
+	suite.Require().NoError(err)
+
+	// Old token is presented again
+	_, _, err = suite.loginService.RefreshTokens(refreshToken, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrRefreshReuse)
+
+	// Rotated token is revoked together with the family
+	_, _, err = suite.loginService.RefreshTokens(rotatedToken, testIp)
+	assert.Error(suite.T(), err)
+
+	var active int64
+	suite.db.Model(&model.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	assert.Equal(suite.T(), int64(0), active)
+}
+
+func (suite *LoginServiceTestSuite) TestRefreshTokens_InvalidSignature() {
+	user := suite.createTestUser("refresh.signature@example.com", "password123", model.RoleOsoba)
+	claims := &auth.Claims{
+		Email: user.Email, Uuid: user.Uuid.String(), Role: user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("wrong-refresh-key"))
+
+	_, _, err := suite.loginService.RefreshTokens(token, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidRefresh)
+}
+
+func (suite *LoginServiceTestSuite) TestRefreshTokens_UnknownToken() {
+	user := suite.createTestUser("refresh.unknown@example.com", "password123", model.RoleOsoba)
+
+	// Signed correctly but never stored on the server
+	_, refreshToken, err := auth.GenerateTokens(user)
+	suite.Require().NoError(err)
+
+	_, _, err = suite.loginService.RefreshTokens(refreshToken, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidRefresh)
+}
+
+func (suite *LoginServiceTestSuite) TestRevokeUserTokens() {
+	email := "refresh.revoke@example.com"
+	password := "password123"
+	user := suite.createTestUser(email, password, model.RoleOsoba)
+
+	_, refreshToken, err := suite.login(email, password)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.loginService.RevokeUserTokens(user.ID))
+
+	_, _, err = suite.loginService.RefreshTokens(refreshToken, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrRefreshReuse)
+}
+
+func (suite *LoginServiceTestSuite) TestLogout_RevokesAccessAndRefresh() {
+	email := "logout@example.com"
+	password := "password123"
+	user := suite.createTestUser(email, password, model.RoleOsoba)
+
+	accessToken, refreshToken, err := suite.login(email, password)
+	suite.Require().NoError(err)
+	_, claims, err := auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.loginService.Logout(claims, refreshToken))
+
+	assert.True(suite.T(), auth.IsRevoked(claims))
+	_, _, err = suite.loginService.RefreshTokens(refreshToken, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrRefreshReuse)
+
+	// A new login is not affected
+	accessToken, _, err = suite.login(email, password)
+	suite.Require().NoError(err)
+	_, claims, err = auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), auth.IsRevoked(claims))
+	assert.Equal(suite.T(), user.Uuid.String(), claims.Uuid)
+}
+
+func (suite *LoginServiceTestSuite) TestLogout_ForeignRefreshToken() {
+	suite.createTestUser("logout.a@example.com", "password123", model.RoleOsoba)
+	suite.createTestUser("logout.b@example.com", "password123", model.RoleOsoba)
+
+	accessToken, _, err := suite.login("logout.a@example.com", "password123")
+	suite.Require().NoError(err)
+	_, otherRefresh, err := suite.login("logout.b@example.com", "password123")
+	suite.Require().NoError(err)
+	_, claims, err := auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+
+	err = suite.loginService.Logout(claims, otherRefresh)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidRefresh)
+
+	// Other user's session stays usable
+	_, _, err = suite.loginService.RefreshTokens(otherRefresh, testIp)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *LoginServiceTestSuite) TestLogoutEverywhere() {
+	email := "logout.all@example.com"
+	password := "password123"
+	user := suite.createTestUser(email, password, model.RolePolicija)
+
+	accessToken, refreshToken, err := suite.login(email, password)
+	suite.Require().NoError(err)
+	deviceToken, err := auth.GenerateDeviceToken(user, uuid.New())
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.loginService.LogoutEverywhere(user.Uuid))
+
+	for _, token := range []string{accessToken, deviceToken} {
+		_, claims, err := auth.ParseToken("Bearer " + token)
+		suite.Require().NoError(err)
+		assert.True(suite.T(), auth.IsRevoked(claims))
+	}
+
+	_, _, err = suite.loginService.RefreshTokens(refreshToken, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrRefreshReuse)
+
+	// A login in the same second is not revoked
+	time.Sleep(2 * time.Millisecond)
+	accessToken, _, err = suite.login(email, password)
+	suite.Require().NoError(err)
+	_, claims, err := auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), auth.IsRevoked(claims))
+}
+
+func (suite *LoginServiceTestSuite) TestLogoutEverywhere_UnknownUser() {
+	err := suite.loginService.LogoutEverywhere(uuid.New())
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+// enrollMfa enrolls a second factor through the login flow and returns the secret and recovery codes
+func (suite *LoginServiceTestSuite) enrollMfa(email, password string) (string, []string) {
+	result, err := suite.loginService.Login(email, password, testIp)
+	suite.Require().NoError(err)
+	suite.Require().True(result.MfaEnrollRequired)
+
+	enrollment, err := suite.loginService.BeginMfaEnrollment(result.MfaToken)
+	suite.Require().NoError(err)
+	code, err := auth.TotpCode(enrollment.Secret, auth.TotpStep(time.Now()))
+	suite.Require().NoError(err)
+
+	completed, err := suite.loginService.ConfirmMfaEnrollment(result.MfaToken, code, testIp)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(completed.AccessToken)
+	suite.Require().Len(completed.RecoveryCodes, 10)
+
+	// Mark the step as used long ago so the test can log in again in the same period
+	suite.db.Model(&model.UserTotp{}).
+		Where("user_id = (?)", suite.db.Model(&model.User{}).Select("id").Where("email = ?", email)).
+		Update("last_used_step", 0)
+	return enrollment.Secret, completed.RecoveryCodes
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_MfaNotRequiredForRole() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleSuperAdmin)}
+	suite.createTestUser("mfa.osoba@example.com", "password123", model.RoleOsoba)
+
+	result, err := suite.loginService.Login("mfa.osoba@example.com", "password123", testIp)
+
+	suite.Require().NoError(err)
+	assert.NotEmpty(suite.T(), result.AccessToken)
+	assert.Empty(suite.T(), result.MfaToken)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_MfaEnrollmentRequired() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleSuperAdmin)}
+	suite.createTestUser("mfa.admin@example.com", "password123", model.RoleSuperAdmin)
+
+	result, err := suite.loginService.Login("mfa.admin@example.com", "password123", testIp)
+
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), result.AccessToken)
+	assert.Empty(suite.T(), result.RefreshToken)
+	assert.NotEmpty(suite.T(), result.MfaToken)
+	assert.True(suite.T(), result.MfaEnrollRequired)
+
+	// Challenge token is not an access token
+	_, _, err = auth.ParseToken("Bearer " + result.MfaToken)
+	assert.Error(suite.T(), err)
+	_, err = auth.ParseRefreshToken(result.MfaToken)
+	assert.Error(suite.T(), err)
+
+	var refreshCount int64
+	suite.db.Model(&model.RefreshToken{}).Count(&refreshCount)
+	assert.Equal(suite.T(), int64(0), refreshCount)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_MfaVerify() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleMupADMIN)}
+	user := suite.createTestUser("mfa.mup@example.com", "password123", model.RoleMupADMIN)
+	secret, _ := suite.enrollMfa("mfa.mup@example.com", "password123")
+
+	result, err := suite.loginService.Login("mfa.mup@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+	suite.Require().False(result.MfaEnrollRequired)
+	suite.Require().NotEmpty(result.MfaToken)
+
+	_, _, err = suite.loginService.VerifyMfa(result.MfaToken, "000000", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidMfaCode)
+
+	code, _ := auth.TotpCode(secret, auth.TotpStep(time.Now()))
+	accessToken, refreshToken, err := suite.loginService.VerifyMfa(result.MfaToken, code, testIp)
+	suite.Require().NoError(err)
+	assert.NotEmpty(suite.T(), refreshToken)
+	_, claims, err := auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), user.Uuid.String(), claims.Uuid)
+
+	// Challenge and code are single use
+	_, _, err = suite.loginService.VerifyMfa(result.MfaToken, code, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidMfaToken)
+
+	again, err := suite.loginService.Login("mfa.mup@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+	_, _, err = suite.loginService.VerifyMfa(again.MfaToken, code, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidMfaCode)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_MfaRecoveryCode() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleSuperAdmin)}
+	suite.createTestUser("mfa.recovery@example.com", "password123", model.RoleSuperAdmin)
+	_, recoveryCodes := suite.enrollMfa("mfa.recovery@example.com", "password123")
+
+	result, err := suite.loginService.Login("mfa.recovery@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+	_, _, err = suite.loginService.VerifyMfa(result.MfaToken, recoveryCodes[0], testIp)
+	suite.Require().NoError(err)
+
+	result, err = suite.loginService.Login("mfa.recovery@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+	_, _, err = suite.loginService.VerifyMfa(result.MfaToken, recoveryCodes[0], testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidMfaCode)
+}
+
+func (suite *LoginServiceTestSuite) TestBeginMfaEnrollment_AlreadyEnrolled() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleSuperAdmin)}
+	suite.createTestUser("mfa.twice@example.com", "password123", model.RoleSuperAdmin)
+	suite.enrollMfa("mfa.twice@example.com", "password123")
+
+	result, err := suite.loginService.Login("mfa.twice@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+
+	_, err = suite.loginService.BeginMfaEnrollment(result.MfaToken)
+	assert.ErrorIs(suite.T(), err, cerror.ErrMfaAlreadyEnrolled)
+}
+
+func (suite *LoginServiceTestSuite) TestVerifyMfa_InvalidToken() {
+	_, _, err := suite.loginService.VerifyMfa("not.a.token", "123456", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidMfaToken)
+}
+
+func (suite *LoginServiceTestSuite) TestLoginMobile_MfaRequired() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleOsoba)}
+	suite.createTestUser("mfa.mobile@example.com", "password123", model.RoleOsoba)
+
+	result, err := suite.loginService.LoginMobile("mfa.mobile@example.com", "password123", testIp, device.DeviceInfo{DeviceID: "mfa-device"})
+
+	assert.ErrorIs(suite.T(), err, cerror.ErrMfaRequired)
+	assert.Nil(suite.T(), result)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_RehashesBcryptPassword() {
+	user := suite.createTestUser("bcrypt@example.com", "password123", model.RoleOsoba)
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suite.Require().NoError(err)
+	suite.db.Model(user).Update("password_hash", string(bcryptHash))
+
+	_, _, err = suite.login("bcrypt@example.com", "password123")
+	suite.Require().NoError(err)
+
+	var updated model.User
+	suite.Require().NoError(suite.db.First(&updated, user.ID).Error)
+	assert.NotEqual(suite.T(), string(bcryptHash), updated.PasswordHash)
+	assert.False(suite.T(), auth.NeedsRehash(updated.PasswordHash))
+	assert.True(suite.T(), auth.VerifyPassword(updated.PasswordHash, "password123"))
+
+	// Failed login doesn't touch the hash
+	_, _, err = suite.login("bcrypt@example.com", "wrong")
+	suite.Require().Error(err)
+	var unchanged model.User
+	suite.Require().NoError(suite.db.First(&unchanged, user.ID).Error)
+	assert.Equal(suite.T(), updated.PasswordHash, unchanged.PasswordHash)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_FailedAttemptsAreDelayed() {
+	suite.createTestUser("throttle@example.com", "password123", model.RoleOsoba)
+	policy := service.ThrottlePolicies[model.ThrottleScopeEmail]
+
+	// Free attempts plus the first one that starts the delay
+	for range policy.FreeAttempts + 1 {
+		_, err := suite.loginService.Login("throttle@example.com", "wrong", testIp)
+		suite.Require().ErrorIs(err, cerror.ErrInvalidCredentials)
+	}
+
+	// Correct password is rejected too until the delay passes
+	_, err := suite.loginService.Login("throttle@example.com", "password123", testIp)
+	suite.Require().ErrorIs(err, cerror.ErrTooManyAttempts)
+	var throttled *service.ThrottledError
+	suite.Require().ErrorAs(err, &throttled)
+	assert.False(suite.T(), throttled.Locked)
+	assert.LessOrEqual(suite.T(), throttled.RetryAfter, policy.BaseDelay)
+
+	// Other accounts from the same ip are not delayed yet
+	suite.createTestUser("other@example.com", "password123", model.RoleOsoba)
+	_, err = suite.loginService.Login("other@example.com", "password123", testIp)
+	assert.NoError(suite.T(), err)
+
+	// Once the delay passed the login works and failures are forgotten
+	suite.db.Model(&model.LoginThrottle{}).
+		Where("scope = ?", model.ThrottleScopeEmail).
+		Update("last_failure_at", time.Now().Add(-time.Minute))
+	_, err = suite.loginService.Login("throttle@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+
+	var count int64
+	suite.db.Model(&model.LoginThrottle{}).Where("scope = ?", model.ThrottleScopeEmail).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_UnknownEmailIsCounted() {
+	_, err := suite.loginService.Login("nobody@example.com", "wrong", testIp)
+	suite.Require().ErrorIs(err, cerror.ErrInvalidCredentials)
+
+	var throttles []model.LoginThrottle
+	suite.db.Order("scope").Find(&throttles)
+	suite.Require().Len(throttles, 2)
+	assert.Equal(suite.T(), "nobody@example.com", throttles[0].Key)
+	assert.Equal(suite.T(), testIp, throttles[1].Key)
+}
+
+func (suite *LoginServiceTestSuite) TestLogin_Locked() {
+	suite.createTestUser("locked@example.com", "password123", model.RoleOsoba)
+	suite.db.Create(&model.LoginThrottle{
+		Scope:         model.ThrottleScopeEmail,
+		Key:           "locked@example.com",
+		Failures:      10,
+		LastFailureAt: time.Now().Add(-time.Minute),
+		LockedUntil:   func() *time.Time { t := time.Now().Add(10 * time.Minute); return &t }(),
+	})
+
+	_, err := suite.loginService.Login("locked@example.com", "password123", testIp)
+
+	var throttled *service.ThrottledError
+	suite.Require().ErrorAs(err, &throttled)
+	assert.True(suite.T(), throttled.Locked)
+	assert.Greater(suite.T(), throttled.RetryAfter, 9*time.Minute)
+}
+
+func (suite *LoginServiceTestSuite) TestRegisterPolice_GuessesAreDelayed() {
+	policy := service.ThrottlePolicies[model.ThrottleScopePolice]
+	for range policy.FreeAttempts + 1 {
+		_, err := suite.loginService.RegisterPolice("guess", testIp, device.DeviceInfo{DeviceID: "police-device"})
+		suite.Require().ErrorIs(err, cerror.ErrInvalidCredentials)
+	}
+
+	_, err := suite.loginService.RegisterPolice("guess", testIp, device.DeviceInfo{DeviceID: "police-device"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrTooManyAttempts)
+
+	// Other addresses are not affected
+	_, err = suite.loginService.RegisterPolice("guess", "198.51.100.1", device.DeviceInfo{DeviceID: "police-device"})
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+}
+
+func (suite *LoginServiceTestSuite) TestVerifyMfa_FailedCodesAreCounted() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleSuperAdmin)}
+	suite.createTestUser("mfa.guess@example.com", "password123", model.RoleSuperAdmin)
+	suite.enrollMfa("mfa.guess@example.com", "password123")
+
+	result, err := suite.loginService.Login("mfa.guess@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+
+	policy := service.ThrottlePolicies[model.ThrottleScopeEmail]
+	for range policy.FreeAttempts + 1 {
+		_, _, err := suite.loginService.VerifyMfa(result.MfaToken, "000000", testIp)
+		suite.Require().ErrorIs(err, cerror.ErrInvalidMfaCode)
+	}
+
+	_, _, err = suite.loginService.VerifyMfa(result.MfaToken, "000000", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrTooManyAttempts)
+}
+
+func (suite *LoginServiceTestSuite) TestConfirmMfaEnrollment_FailedCodesAreCounted() {
+	config.AppConfig.MfaRoles = []string{string(model.RoleSuperAdmin)}
+	suite.createTestUser("mfa.enroll.guess@example.com", "password123", model.RoleSuperAdmin)
+
+	result, err := suite.loginService.Login("mfa.enroll.guess@example.com", "password123", testIp)
+	suite.Require().NoError(err)
+	enrollment, err := suite.loginService.BeginMfaEnrollment(result.MfaToken)
+	suite.Require().NoError(err)
+
+	policy := service.ThrottlePolicies[model.ThrottleScopeEmail]
+	for range policy.FreeAttempts + 1 {
+		_, err := suite.loginService.ConfirmMfaEnrollment(result.MfaToken, "000000", testIp)
+		suite.Require().ErrorIs(err, cerror.ErrInvalidMfaCode)
+	}
+
+	// The right code is refused too once the account is throttled
+	code, err := auth.TotpCode(enrollment.Secret, auth.TotpStep(time.Now()))
+	suite.Require().NoError(err)
+	_, err = suite.loginService.ConfirmMfaEnrollment(result.MfaToken, code, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrTooManyAttempts)
 }
 
 func (suite *LoginServiceTestSuite) TestLoginMobile_Success_NewDevice() {
@@ -192,7 +662,7 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_Success_NewDevice() {
 		DeviceID:  "newDeviceID123",
 	}
 
-	result, err := suite.loginService.LoginMobile(email, password, deviceInfo)
+	result, err := suite.loginService.LoginMobile(email, password, testIp, deviceInfo)
 
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), result)
@@ -222,25 +692,26 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_Success_ExistingDevice_SameU
 	formattedName := deviceMgr.FormatDeviceName(deviceInfo)
 
 	// Pre-register the device
-	initialDeviceToken, _ := auth.GenerateDeviceToken(user)
+	initialDeviceToken, _ := auth.GenerateDeviceToken(user, uuid.New())
 	initialMobile := model.Mobile{
 		Uuid:             uuid.New(),
 		UserId:           user.ID,
 		CreatorId:        user.ID,
+		DeviceId:         deviceInfo.DeviceID,
 		RegisteredDevice: formattedName,
 		ActivationToken:  initialDeviceToken,
 	}
 	errCreate := suite.db.Create(&initialMobile).Error
 	suite.Require().NoError(errCreate)
 
-	result, err := suite.loginService.LoginMobile(email, password, deviceInfo)
+	result, err := suite.loginService.LoginMobile(email, password, testIp, deviceInfo)
 
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), result)
 	assert.NotEmpty(suite.T(), result.AccessToken)
 	assert.NotEmpty(suite.T(), result.RefreshToken)
 	assert.NotEmpty(suite.T(), result.DeviceToken)
-	assert.Equal(suite.T(), initialDeviceToken, result.DeviceToken, "Device token should be updated")
+	assert.NotEqual(suite.T(), initialDeviceToken, result.DeviceToken, "Device token should be updated")
 
 	// Verify device token was updated in DB
 	var mobileRec model.Mobile
@@ -268,11 +739,12 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_Error_DeviceRegisteredToAnot
 	formattedName := deviceMgr.FormatDeviceName(deviceInfo)
 
 	// Register device to user1
-	deviceTokenUser1, _ := auth.GenerateDeviceToken(user1)
+	deviceTokenUser1, _ := auth.GenerateDeviceToken(user1, uuid.New())
 	mobileForUser1 := model.Mobile{
 		Uuid:             uuid.New(),
 		UserId:           user1.ID,
 		CreatorId:        user1.ID,
+		DeviceId:         deviceInfo.DeviceID,
 		RegisteredDevice: formattedName,
 		ActivationToken:  deviceTokenUser1,
 	}
@@ -280,11 +752,11 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_Error_DeviceRegisteredToAnot
 	suite.Require().NoError(errCreate)
 
 	// User2 attempts to login with the same device
-	result, err := suite.loginService.LoginMobile(emailUser2, passwordUser2, deviceInfo)
+	result, err := suite.loginService.LoginMobile(emailUser2, passwordUser2, testIp, deviceInfo)
 
 	assert.Error(suite.T(), err)
 	assert.Nil(suite.T(), result)
-	assert.EqualError(suite.T(), err, "this device is already registered to another user")
+	assert.ErrorIs(suite.T(), err, cerror.ErrDeviceTaken)
 }
 
 func (suite *LoginServiceTestSuite) TestLoginMobile_Error_UserAlreadyHasDifferentDevice() {
@@ -296,11 +768,12 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_Error_UserAlreadyHasDifferen
 	initialDeviceInfo := device.DeviceInfo{DeviceID: "initialUserDeviceABC"}
 	deviceMgr := device.NewDeviceManager()
 	formattedInitialName := deviceMgr.FormatDeviceName(initialDeviceInfo)
-	initialDeviceToken, _ := auth.GenerateDeviceToken(user)
+	initialDeviceToken, _ := auth.GenerateDeviceToken(user, uuid.New())
 	initialMobile := model.Mobile{
 		Uuid:             uuid.New(),
 		UserId:           user.ID,
 		CreatorId:        user.ID,
+		DeviceId:         initialDeviceInfo.DeviceID,
 		RegisteredDevice: formattedInitialName,
 		ActivationToken:  initialDeviceToken,
 	}
@@ -314,11 +787,11 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_Error_UserAlreadyHasDifferen
 		ModelName: "BrowserModel",
 		DeviceID:  "newDifferentDeviceIDXYZ",
 	}
-	result, err := suite.loginService.LoginMobile(email, password, newDeviceInfo)
+	result, err := suite.loginService.LoginMobile(email, password, testIp, newDeviceInfo)
 
 	assert.Error(suite.T(), err)
 	assert.Nil(suite.T(), result)
-	assert.EqualError(suite.T(), err, "you already have a different device registered to your account")
+	assert.ErrorIs(suite.T(), err, cerror.ErrDeviceLimit)
 }
 
 func (suite *LoginServiceTestSuite) TestLoginMobile_LoginFailed() {
@@ -329,7 +802,7 @@ func (suite *LoginServiceTestSuite) TestLoginMobile_LoginFailed() {
 
 	deviceInfo := device.DeviceInfo{DeviceID: "deviceForLoginFail"}
 
-	result, err := suite.loginService.LoginMobile(email, "wrongPasswordForLoginFail", deviceInfo)
+	result, err := suite.loginService.LoginMobile(email, "wrongPasswordForLoginFail", testIp, deviceInfo)
 
 	assert.Error(suite.T(), err)
 	assert.True(suite.T(), errors.Is(err, cerror.ErrInvalidCredentials))
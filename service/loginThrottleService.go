@@ -0,0 +1,382 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ThrottlePolicy describes how failed attempts of a scope are slowed down.
+// Each failure after FreeAttempts doubles the wait before the next attempt,
+// starting at BaseDelay up to MaxDelay. After MaxFailures the key is locked
+// for LockDuration. Failures are forgotten ResetAfter the last one.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	MaxFailures  int
+	LockDuration time.Duration
+	ResetAfter   time.Duration
+}
+
+// ThrottlePolicies are used by LoginThrottleService, IP limits are higher
+// since many users can share an address
+var ThrottlePolicies = map[model.ThrottleScope]ThrottlePolicy{
+	model.ThrottleScopeEmail: {
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		MaxFailures:  10,
+		LockDuration: 15 * time.Minute,
+		ResetAfter:   time.Hour,
+	},
+	model.ThrottleScopeIp: {
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		MaxFailures:  100,
+		LockDuration: time.Hour,
+		ResetAfter:   time.Hour,
+	},
+	model.ThrottleScopePolice: {
+		FreeAttempts: 3,
+		BaseDelay:    5 * time.Second,
+		MaxDelay:     time.Minute,
+		MaxFailures:  10,
+		LockDuration: time.Hour,
+		ResetAfter:   24 * time.Hour,
+	},
+	model.ThrottleScopeReset: {
+		FreeAttempts: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     15 * time.Minute,
+		MaxFailures:  10,
+		LockDuration: time.Hour,
+		ResetAfter:   24 * time.Hour,
+	},
+	model.ThrottleScopeResetIp: {
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxFailures:  100,
+		LockDuration: time.Hour,
+		ResetAfter:   time.Hour,
+	},
+	model.ThrottleScopeEmailChange: {
+		FreeAttempts: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     15 * time.Minute,
+		MaxFailures:  10,
+		LockDuration: time.Hour,
+		ResetAfter:   24 * time.Hour,
+	},
+}
+
+// Delay returns how long to wait after the given number of failures
+func (p ThrottlePolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// ThrottleKey identifies what failed attempts are counted for
+type ThrottleKey struct {
+	Scope model.ThrottleScope
+	Key   string
+}
+
+func EmailKey(email string) ThrottleKey {
+	return ThrottleKey{Scope: model.ThrottleScopeEmail, Key: strings.ToLower(strings.TrimSpace(email))}
+}
+
+func IpKey(ip string) ThrottleKey {
+	return ThrottleKey{Scope: model.ThrottleScopeIp, Key: ip}
+}
+
+func PoliceKey(ip string) ThrottleKey {
+	return ThrottleKey{Scope: model.ThrottleScopePolice, Key: ip}
+}
+
+// ResetKey counts reset requests apart from logins, so requests for someone
+// else's email can't lock them out of logging in
+func ResetKey(email string) ThrottleKey {
+	return ThrottleKey{Scope: model.ThrottleScopeReset, Key: strings.ToLower(strings.TrimSpace(email))}
+}
+
+func ResetIpKey(ip string) ThrottleKey {
+	return ThrottleKey{Scope: model.ThrottleScopeResetIp, Key: ip}
+}
+
+func EmailChangeKey(userUuid uuid.UUID) ThrottleKey {
+	return ThrottleKey{Scope: model.ThrottleScopeEmailChange, Key: userUuid.String()}
+}
+
+// ThrottledError is returned when an attempt is rejected, it wraps
+// cerror.ErrTooManyAttempts
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", cerror.ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return cerror.ErrTooManyAttempts
+}
+
+type ILoginThrottleService interface {
+	// Check returns a *ThrottledError if any key is locked or has to wait
+	Check(keys ...ThrottleKey) error
+	// Fail records a failed attempt for every key and locks keys over the limit
+	Fail(keys ...ThrottleKey) error
+	// Reset forgets failed attempts of keys, it is called after a successful login
+	Reset(keys ...ThrottleKey) error
+	// GetLockEvents returns lock events newest first, only active ones if activeOnly
+	GetLockEvents(activeOnly bool) ([]model.LockEvent, error)
+	// Unlock ends an active lock before it expires
+	Unlock(eventUuid uuid.UUID, adminUuid uuid.UUID) error
+	// Cleanup removes counters that are no longer relevant
+	Cleanup() error
+}
+
+type LoginThrottleService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewLoginThrottleService() ILoginThrottleService {
+	var service ILoginThrottleService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &LoginThrottleService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Check implements ILoginThrottleService.
+func (s *LoginThrottleService) Check(keys ...ThrottleKey) error {
+	now := time.Now()
+	var rejected *ThrottledError
+
+	for _, key := range keys {
+		policy, ok := ThrottlePolicies[key.Scope]
+		if !ok || key.Key == "" {
+			continue
+		}
+
+		throttle, err := s.find(s.db, key)
+		if err != nil {
+			return err
+		}
+		if throttle == nil || s.expired(throttle, policy, now) {
+			continue
+		}
+
+		var wait time.Duration
+		locked := false
+		if throttle.LockedUntil != nil && now.Before(*throttle.LockedUntil) {
+			wait = throttle.LockedUntil.Sub(now)
+			locked = true
+		} else if next := throttle.LastFailureAt.Add(policy.Delay(throttle.Failures)); now.Before(next) {
+			wait = next.Sub(now)
+		}
+
+		if wait > 0 && (rejected == nil || wait > rejected.RetryAfter) {
+			rejected = &ThrottledError{RetryAfter: wait, Locked: locked}
+		}
+	}
+
+	if rejected != nil {
+		s.logger.Debugf("Attempt rejected for %+v, retry after %s", keys, rejected.RetryAfter)
+		return rejected
+	}
+	return nil
+}
+
+// Fail implements ILoginThrottleService.
+func (s *LoginThrottleService) Fail(keys ...ThrottleKey) error {
+	now := time.Now()
+
+	for _, key := range keys {
+		policy, ok := ThrottlePolicies[key.Scope]
+		if !ok || key.Key == "" {
+			continue
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			throttle, err := s.find(tx.Clauses(clause.Locking{Strength: "UPDATE"}), key)
+			if err != nil {
+				return err
+			}
+			if throttle == nil {
+				throttle = &model.LoginThrottle{Scope: key.Scope, Key: key.Key}
+			} else if s.expired(throttle, policy, now) {
+				throttle.Failures = 0
+				throttle.LockedUntil = nil
+			}
+
+			throttle.Failures++
+			throttle.LastFailureAt = now
+			if throttle.Failures >= policy.MaxFailures && throttle.LockedUntil == nil {
+				lockedUntil := now.Add(policy.LockDuration)
+				throttle.LockedUntil = &lockedUntil
+
+				if err := tx.Create(&model.LockEvent{
+					Uuid:        uuid.New(),
+					Scope:       key.Scope,
+					Key:         key.Key,
+					Failures:    throttle.Failures,
+					LockedUntil: lockedUntil,
+				}).Error; err != nil {
+					return err
+				}
+				s.logger.Warnf("Locked %s = %s after %d failed attempts until %s", key.Scope, key.Key, throttle.Failures, lockedUntil)
+			}
+
+			return tx.Save(throttle).Error
+		})
+		if err != nil {
+			s.logger.Errorf("Failed to record failed attempt for %s = %s, error = %+v", key.Scope, key.Key, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset implements ILoginThrottleService.
+func (s *LoginThrottleService) Reset(keys ...ThrottleKey) error {
+	for _, key := range keys {
+		// NOTE: locked keys stay locked, a correct password doesn't end a lock
+		if err := s.db.
+			Unscoped().
+			Where("scope = ? AND key = ? AND locked_until IS NULL", key.Scope, key.Key).
+			Delete(&model.LoginThrottle{}).
+			Error; err != nil {
+			s.logger.Errorf("Failed to reset %s = %s, error = %+v", key.Scope, key.Key, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLockEvents implements ILoginThrottleService.
+func (s *LoginThrottleService) GetLockEvents(activeOnly bool) ([]model.LockEvent, error) {
+	query := s.db.Order("id DESC")
+	if activeOnly {
+		query = query.Where("unlocked_at IS NULL AND locked_until > ?", time.Now())
+	}
+
+	var events []model.LockEvent
+	if err := query.Find(&events).Error; err != nil {
+		s.logger.Errorf("Failed to query lock events, error = %+v", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// Unlock implements ILoginThrottleService.
+func (s *LoginThrottleService) Unlock(eventUuid uuid.UUID, adminUuid uuid.UUID) error {
+	var event model.LockEvent
+	if err := s.db.Where("uuid = ?", eventUuid).First(&event).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if !event.IsActive(now) {
+		return cerror.ErrOutdated
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(&event).
+			Updates(map[string]any{"unlocked_at": now, "unlocked_by": adminUuid}).
+			Error; err != nil {
+			return err
+		}
+		return tx.
+			Unscoped().
+			Where("scope = ? AND key = ?", event.Scope, event.Key).
+			Delete(&model.LoginThrottle{}).
+			Error
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to unlock %s = %s, error = %+v", event.Scope, event.Key, err)
+		return err
+	}
+
+	s.logger.Infof("Admin = %s unlocked %s = %s", adminUuid, event.Scope, event.Key)
+	return nil
+}
+
+// Cleanup implements ILoginThrottleService.
+func (s *LoginThrottleService) Cleanup() error {
+	now := time.Now()
+	var throttles []model.LoginThrottle
+	if err := s.db.Find(&throttles).Error; err != nil {
+		return err
+	}
+
+	var ids []uint
+	for _, throttle := range throttles {
+		if policy, ok := ThrottlePolicies[throttle.Scope]; !ok || s.expired(&throttle, policy, now) {
+			ids = append(ids, throttle.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rez := s.db.Unscoped().Delete(&model.LoginThrottle{}, ids)
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to cleanup login throttles, error = %+v", rez.Error)
+		return rez.Error
+	}
+
+	s.logger.Debugf("Removed %d expired login throttles", rez.RowsAffected)
+	return nil
+}
+
+func (s *LoginThrottleService) find(db *gorm.DB, key ThrottleKey) (*model.LoginThrottle, error) {
+	var throttle model.LoginThrottle
+	if err := db.
+		Where("scope = ? AND key = ?", key.Scope, key.Key).
+		First(&throttle).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		s.logger.Errorf("Failed to query login throttle, error = %+v", err)
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// expired reports whether a counter can be forgotten, either its lock ended
+// or there was no failure for ResetAfter
+func (s *LoginThrottleService) expired(throttle *model.LoginThrottle, policy ThrottlePolicy, now time.Time) bool {
+	if throttle.LockedUntil != nil {
+		return !now.Before(*throttle.LockedUntil)
+	}
+	return now.Sub(throttle.LastFailureAt) > policy.ResetAfter
+}
@@ -0,0 +1,173 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type LoginThrottleServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.ILoginThrottleService
+	policy  service.ThrottlePolicy
+	key     service.ThrottleKey
+}
+
+func (suite *LoginThrottleServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:loginthrottle_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewLoginThrottleService()
+	suite.policy = service.ThrottlePolicies[model.ThrottleScopeEmail]
+	suite.key = service.EmailKey("Locked@Example.com ")
+}
+
+func (suite *LoginThrottleServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *LoginThrottleServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.LoginThrottle{}, &model.LockEvent{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+}
+
+func TestLoginThrottleServiceSuite(t *testing.T) {
+	suite.Run(t, new(LoginThrottleServiceTestSuite))
+}
+
+// lock fails the key until it gets locked
+func (suite *LoginThrottleServiceTestSuite) lock() model.LockEvent {
+	for range suite.policy.MaxFailures {
+		suite.Require().NoError(suite.service.Fail(suite.key))
+	}
+
+	var event model.LockEvent
+	suite.Require().NoError(suite.db.First(&event).Error)
+	return event
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestDelay() {
+	policy := service.ThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	assert.Equal(suite.T(), time.Duration(0), policy.Delay(2))
+	assert.Equal(suite.T(), time.Second, policy.Delay(3))
+	assert.Equal(suite.T(), 2*time.Second, policy.Delay(4))
+	assert.Equal(suite.T(), 4*time.Second, policy.Delay(5))
+	assert.Equal(suite.T(), 5*time.Second, policy.Delay(6))
+	assert.Equal(suite.T(), 5*time.Second, policy.Delay(100))
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestEmailKeyIsNormalized() {
+	assert.Equal(suite.T(), "locked@example.com", suite.key.Key)
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestFreeAttempts() {
+	for range suite.policy.FreeAttempts {
+		suite.Require().NoError(suite.service.Fail(suite.key))
+	}
+	assert.NoError(suite.T(), suite.service.Check(suite.key))
+
+	suite.Require().NoError(suite.service.Fail(suite.key))
+	assert.ErrorIs(suite.T(), suite.service.Check(suite.key), cerror.ErrTooManyAttempts)
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestLock() {
+	event := suite.lock()
+
+	assert.Equal(suite.T(), model.ThrottleScopeEmail, event.Scope)
+	assert.Equal(suite.T(), "locked@example.com", event.Key)
+	assert.Equal(suite.T(), suite.policy.MaxFailures, event.Failures)
+	assert.WithinDuration(suite.T(), time.Now().Add(suite.policy.LockDuration), event.LockedUntil, 5*time.Second)
+
+	err := suite.service.Check(suite.key)
+	var throttled *service.ThrottledError
+	suite.Require().ErrorAs(err, &throttled)
+	assert.True(suite.T(), throttled.Locked)
+
+	// Further failures don't create more events
+	suite.Require().NoError(suite.service.Fail(suite.key))
+	var count int64
+	suite.db.Model(&model.LockEvent{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+
+	// Reset after a successful login doesn't end the lock
+	suite.Require().NoError(suite.service.Reset(suite.key))
+	assert.ErrorIs(suite.T(), suite.service.Check(suite.key), cerror.ErrTooManyAttempts)
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestLockExpires() {
+	suite.lock()
+	suite.db.Model(&model.LoginThrottle{}).Where("key = ?", suite.key.Key).Update("locked_until", time.Now().Add(-time.Second))
+	suite.db.Model(&model.LockEvent{}).Where("key = ?", suite.key.Key).Update("locked_until", time.Now().Add(-time.Second))
+
+	assert.NoError(suite.T(), suite.service.Check(suite.key))
+
+	active, err := suite.service.GetLockEvents(true)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), active)
+	all, err := suite.service.GetLockEvents(false)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), all, 1)
+
+	// Counting starts again after the lock
+	suite.Require().NoError(suite.service.Fail(suite.key))
+	var throttle model.LoginThrottle
+	suite.Require().NoError(suite.db.First(&throttle).Error)
+	assert.Equal(suite.T(), 1, throttle.Failures)
+	assert.Nil(suite.T(), throttle.LockedUntil)
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestUnlock() {
+	event := suite.lock()
+	admin := uuid.New()
+
+	suite.Require().NoError(suite.service.Unlock(event.Uuid, admin))
+
+	assert.NoError(suite.T(), suite.service.Check(suite.key))
+	var unlocked model.LockEvent
+	suite.Require().NoError(suite.db.First(&unlocked, event.ID).Error)
+	assert.NotNil(suite.T(), unlocked.UnlockedAt)
+	assert.Equal(suite.T(), admin, *unlocked.UnlockedBy)
+
+	assert.ErrorIs(suite.T(), suite.service.Unlock(event.Uuid, admin), cerror.ErrOutdated)
+	assert.ErrorIs(suite.T(), suite.service.Unlock(uuid.New(), admin), gorm.ErrRecordNotFound)
+}
+
+func (suite *LoginThrottleServiceTestSuite) TestCleanup() {
+	suite.Require().NoError(suite.service.Fail(suite.key))
+	suite.Require().NoError(suite.service.Fail(service.IpKey("192.0.2.1")))
+	suite.db.Model(&model.LoginThrottle{}).
+		Where("scope = ?", model.ThrottleScopeEmail).
+		Update("last_failure_at", time.Now().Add(-2*suite.policy.ResetAfter))
+
+	suite.Require().NoError(suite.service.Cleanup())
+
+	var throttles []model.LoginThrottle
+	suite.db.Find(&throttles)
+	suite.Require().Len(throttles, 1)
+	assert.Equal(suite.T(), model.ThrottleScopeIp, throttles[0].Scope)
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// TotpEnrollment is returned when enrollment starts, the secret is shown only once
+type TotpEnrollment struct {
+	Secret string
+	Uri    string
+}
+
+type IMfaService interface {
+	// IsRequired reports whether users with role must use a second factor
+	IsRequired(role model.UserRole) bool
+	// IsEnrolled reports whether the user has a confirmed TOTP factor
+	IsEnrolled(userId uint) (bool, error)
+	// BeginEnrollment generates a new unconfirmed secret, it fails if a confirmed one exists
+	BeginEnrollment(user *model.User) (*TotpEnrollment, error)
+	// ConfirmEnrollment confirms the secret with a code and returns new recovery codes
+	ConfirmEnrollment(userId uint, code string) ([]string, error)
+	// Verify checks a TOTP or a recovery code of an enrolled user
+	Verify(userId uint, code string) error
+	// Reset removes the second factor of a user so it can be enrolled again
+	Reset(userUuid uuid.UUID) error
+}
+
+type MfaService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewMfaService() IMfaService {
+	var service IMfaService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &MfaService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// IsRequired implements IMfaService.
+func (s *MfaService) IsRequired(role model.UserRole) bool {
+	return slices.Contains(config.AppConfig.MfaRoles, string(role))
+}
+
+// IsEnrolled implements IMfaService.
+func (s *MfaService) IsEnrolled(userId uint) (bool, error) {
+	var count int64
+	if err := s.db.
+		Model(&model.UserTotp{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userId).
+		Count(&count).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query totp of user id = %d, error = %+v", userId, err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BeginEnrollment implements IMfaService.
+func (s *MfaService) BeginEnrollment(user *model.User) (*TotpEnrollment, error) {
+	enrolled, err := s.IsEnrolled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolled {
+		return nil, cerror.ErrMfaAlreadyEnrolled
+	}
+
+	secret, err := auth.GenerateTotpSecret()
+	if err != nil {
+		s.logger.Errorf("Failed to generate totp secret, error = %+v", err)
+		return nil, err
+	}
+
+	sealed, err := auth.SealTotpSecret(user.ID, secret)
+	if err != nil {
+		s.logger.Errorf("Failed to seal totp secret, error = %+v", err)
+		return nil, err
+	}
+
+	// Replace an unfinished enrollment
+	if err := s.db.
+		Unscoped().
+		Where("user_id = ?", user.ID).
+		Delete(&model.UserTotp{}).
+		Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&model.UserTotp{
+		UserId: user.ID,
+		Secret: sealed,
+	}).Error; err != nil {
+		s.logger.Errorf("Failed to store totp of user id = %d, error = %+v", user.ID, err)
+		return nil, err
+	}
+
+	s.logger.Infof("Started totp enrollment for user = %s", user.Uuid)
+	return &TotpEnrollment{
+		Secret: secret,
+		Uri:    auth.TotpUri(config.AppConfig.MfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment implements IMfaService.
+func (s *MfaService) ConfirmEnrollment(userId uint, code string) ([]string, error) {
+	var totp model.UserTotp
+	if err := s.db.
+		Where("user_id = ? AND confirmed_at IS NULL", userId).
+		First(&totp).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cerror.ErrMfaNotEnrolled
+		}
+		return nil, err
+	}
+
+	secret, err := s.openSecret(&totp)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	step, ok := auth.ValidateTotp(secret, code, now, totp.LastUsedStep)
+	if !ok {
+		s.logger.Debugf("Invalid totp code on enrollment for user id = %d", userId)
+		return nil, cerror.ErrInvalidMfaCode
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(&totp).
+			Updates(map[string]any{"confirmed_at": now, "last_used_step": step}).
+			Error; err != nil {
+			return err
+		}
+		if err := tx.
+			Unscoped().
+			Where("user_id = ?", userId).
+			Delete(&model.RecoveryCode{}).
+			Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := tx.Create(&model.RecoveryCode{
+				UserId:   userId,
+				CodeHash: auth.HashRecoveryCode(code),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to confirm totp of user id = %d, error = %+v", userId, err)
+		return nil, err
+	}
+
+	s.logger.Infof("Confirmed totp enrollment for user id = %d", userId)
+	return codes, nil
+}
+
+// Verify implements IMfaService.
+func (s *MfaService) Verify(userId uint, code string) error {
+	var totp model.UserTotp
+	if err := s.db.
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userId).
+		First(&totp).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cerror.ErrMfaNotEnrolled
+		}
+		return err
+	}
+
+	secret, err := s.openSecret(&totp)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := auth.ValidateTotp(secret, code, time.Now(), totp.LastUsedStep); ok {
+		// NOTE: conditional update so the same code can't be used by two parallel logins
+		rez := s.db.
+			Model(&model.UserTotp{}).
+			Where("id = ? AND last_used_step < ?", totp.ID, step).
+			Update("last_used_step", step)
+		if rez.Error != nil {
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return cerror.ErrInvalidMfaCode
+		}
+		return nil
+	}
+
+	rez := s.db.
+		Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, auth.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if rez.Error != nil {
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		s.logger.Debugf("Invalid second factor for user id = %d", userId)
+		return cerror.ErrInvalidMfaCode
+	}
+
+	s.logger.Infof("Recovery code used by user id = %d", userId)
+	return nil
+}
+
+// openSecret decrypts the secret of a totp
+func (s *MfaService) openSecret(totp *model.UserTotp) (string, error) {
+	secret, err := auth.OpenTotpSecret(totp.UserId, totp.Secret)
+	if err != nil {
+		s.logger.Errorf("Failed to open totp secret of user id = %d, error = %+v", totp.UserId, err)
+		return "", err
+	}
+	return secret, nil
+}
+
+// Reset implements IMfaService.
+func (s *MfaService) Reset(userUuid uuid.UUID) error {
+	var user model.User
+	if err := s.db.Where("uuid = ?", userUuid).First(&user).Error; err != nil {
+		return err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&model.UserTotp{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to reset second factor of user = %s, error = %+v", userUuid, err)
+		return err
+	}
+
+	s.logger.Infof("Reset second factor of user = %s", userUuid)
+	return nil
+}
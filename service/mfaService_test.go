@@ -0,0 +1,151 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type MfaServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IMfaService
+	user    *model.User
+}
+
+func (suite *MfaServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:mfaservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:       config.Dev,
+		MfaRoles:  []string{string(model.RoleSuperAdmin), string(model.RoleMupADMIN)},
+		MfaIssuer: "ePrometna",
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewMfaService()
+}
+
+func (suite *MfaServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *MfaServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.RecoveryCode{}, &model.UserTotp{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+
+	suite.user = &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Mfa",
+		LastName:     "Admin",
+		OIB:          "12345678903",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        "mfa@example.com",
+		PasswordHash: "hash",
+		Role:         model.RoleSuperAdmin,
+	}
+	suite.Require().NoError(suite.db.Create(suite.user).Error)
+}
+
+func TestMfaServiceSuite(t *testing.T) {
+	suite.Run(t, new(MfaServiceTestSuite))
+}
+
+func (suite *MfaServiceTestSuite) TestIsRequired() {
+	assert.True(suite.T(), suite.service.IsRequired(model.RoleSuperAdmin))
+	assert.True(suite.T(), suite.service.IsRequired(model.RoleMupADMIN))
+	assert.False(suite.T(), suite.service.IsRequired(model.RoleOsoba))
+}
+
+func (suite *MfaServiceTestSuite) TestEnrollment() {
+	enrollment, err := suite.service.BeginEnrollment(suite.user)
+	suite.Require().NoError(err)
+	assert.Contains(suite.T(), enrollment.Uri, "otpauth://totp/ePrometna:mfa@example.com")
+
+	// The secret is stored sealed
+	var totp model.UserTotp
+	suite.Require().NoError(suite.db.Where("user_id = ?", suite.user.ID).First(&totp).Error)
+	assert.True(suite.T(), auth.IsSealed(totp.Secret))
+	assert.NotContains(suite.T(), totp.Secret, enrollment.Secret)
+
+	enrolled, err := suite.service.IsEnrolled(suite.user.ID)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), enrolled, "Unconfirmed secret is not enrolled")
+
+	_, err = suite.service.ConfirmEnrollment(suite.user.ID, "000000")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidMfaCode)
+
+	code, _ := auth.TotpCode(enrollment.Secret, auth.TotpStep(time.Now()))
+	codes, err := suite.service.ConfirmEnrollment(suite.user.ID, code)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), codes, 10)
+
+	enrolled, _ = suite.service.IsEnrolled(suite.user.ID)
+	assert.True(suite.T(), enrolled)
+
+	// Only hashes are stored
+	var stored []model.RecoveryCode
+	suite.db.Where("user_id = ?", suite.user.ID).Find(&stored)
+	suite.Require().Len(stored, 10)
+	for _, s := range stored {
+		assert.NotContains(suite.T(), codes, s.CodeHash)
+	}
+}
+
+func (suite *MfaServiceTestSuite) TestVerify_PlainSecret() {
+	// Secrets stored before they were sealed still verify
+	secret, err := auth.GenerateTotpSecret()
+	suite.Require().NoError(err)
+	confirmedAt := time.Now()
+	suite.Require().NoError(suite.db.Create(&model.UserTotp{
+		UserId: suite.user.ID, Secret: secret, ConfirmedAt: &confirmedAt,
+	}).Error)
+
+	code, _ := auth.TotpCode(secret, auth.TotpStep(time.Now()))
+	assert.NoError(suite.T(), suite.service.Verify(suite.user.ID, code))
+}
+
+func (suite *MfaServiceTestSuite) TestVerify_NotEnrolled() {
+	assert.ErrorIs(suite.T(), suite.service.Verify(suite.user.ID, "123456"), cerror.ErrMfaNotEnrolled)
+}
+
+func (suite *MfaServiceTestSuite) TestReset() {
+	enrollment, err := suite.service.BeginEnrollment(suite.user)
+	suite.Require().NoError(err)
+	code, _ := auth.TotpCode(enrollment.Secret, auth.TotpStep(time.Now()))
+	_, err = suite.service.ConfirmEnrollment(suite.user.ID, code)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.service.Reset(suite.user.Uuid))
+
+	enrolled, _ := suite.service.IsEnrolled(suite.user.ID)
+	assert.False(suite.T(), enrolled)
+	var count int64
+	suite.db.Model(&model.RecoveryCode{}).Where("user_id = ?", suite.user.ID).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+
+	assert.ErrorIs(suite.T(), suite.service.Reset(uuid.New()), gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"crypto/subtle"
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"ePrometna_Server/util/oidc"
+	"ePrometna_Server/util/validate"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// oidcStateDuration is how long the user has to sign in at the identity provider
+const oidcStateDuration = 10 * time.Minute
+
+type IOidcService interface {
+	// AuthorizationUrl starts a sign in and returns the provider url the user is sent to
+	// and the binding the browser that started it has to complete it with
+	AuthorizationUrl() (string, string, error)
+	// Callback completes a sign in with the code and state the provider redirected back with
+	Callback(code, state, binding, ip string) (*LoginResult, error)
+}
+
+type OidcService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+	client *oidc.Client
+	login  ILoginService
+}
+
+func NewOidcService() IOidcService {
+	var service IOidcService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		var client *oidc.Client
+		if config.AppConfig.OidcEnabled() {
+			client = oidc.NewClient(oidc.Config{
+				Issuer:       config.AppConfig.OidcIssuer,
+				ClientId:     config.AppConfig.OidcClientId,
+				ClientSecret: config.AppConfig.OidcClientSecret,
+				RedirectUrl:  config.AppConfig.OidcRedirectUrl,
+				Scopes:       config.AppConfig.OidcScopes,
+			}, nil)
+		}
+
+		service = &OidcService{
+			db:     db,
+			logger: logger,
+			client: client,
+			login:  NewLoginService(),
+		}
+	})
+
+	return service
+}
+
+// AuthorizationUrl implements IOidcService.
+func (s *OidcService) AuthorizationUrl() (string, string, error) {
+	if s.client == nil {
+		return "", "", cerror.ErrOidcDisabled
+	}
+
+	state, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	// NOTE: the state travels through the provider redirect, the binding
+	// stays with the browser so a redirect can't be completed by another one
+	binding, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.GenerateCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	authUrl, err := s.client.AuthCodeUrl(state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		s.logger.Errorf("Failed to build authorization url, error = %+v", err)
+		return "", "", err
+	}
+
+	now := time.Now()
+	stored := model.OidcLoginState{
+		StateHash:    auth.HashOpaqueToken(state),
+		BindingHash:  auth.HashOpaqueToken(binding),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcStateDuration),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Finished and abandoned sign ins are no longer needed
+		if err := tx.
+			Unscoped().
+			Where("used_at IS NOT NULL OR expires_at < ?", now).
+			Delete(&model.OidcLoginState{}).
+			Error; err != nil {
+			return err
+		}
+		return tx.Create(&stored).Error
+	})
+	if err != nil {
+		s.logger.Errorf("Failed to store sign in state, error = %+v", err)
+		return "", "", err
+	}
+
+	return authUrl, binding, nil
+}
+
+// Callback implements IOidcService.
+func (s *OidcService) Callback(code, state, binding, ip string) (*LoginResult, error) {
+	if s.client == nil {
+		return nil, cerror.ErrOidcDisabled
+	}
+
+	stored, err := s.useState(state, binding)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := s.client.Exchange(code, stored.CodeVerifier)
+	if err != nil {
+		s.logger.Warnf("Failed to exchange authorization code, error = %+v", err)
+		return nil, err
+	}
+	claims, err := s.client.VerifyIdToken(idToken, stored.Nonce)
+	if err != nil {
+		s.logger.Warnf("Rejected id token, error = %+v", err)
+		return nil, err
+	}
+
+	user, err := s.linkUser(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("User = %s signed in through %s", user.Uuid, s.client.Issuer())
+	return s.login.CompleteLogin(user, ip)
+}
+
+// useState marks the state as used, the condition makes sure a redirect
+// can't be replayed. A state sent without the binding of the browser that
+// started the sign in is rejected and stays unused.
+func (s *OidcService) useState(state, binding string) (*model.OidcLoginState, error) {
+	var stored model.OidcLoginState
+	if err := s.db.Where("state_hash = ?", auth.HashOpaqueToken(state)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cerror.ErrInvalidOidcState
+		}
+		s.logger.Errorf("Failed to query sign in state, error = %+v", err)
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.BindingHash), []byte(auth.HashOpaqueToken(binding))) != 1 {
+		s.logger.Warnf("Sign in state = %d completed without its binding", stored.ID)
+		return nil, cerror.ErrInvalidOidcState
+	}
+
+	now := time.Now()
+	rez := s.db.
+		Model(&model.OidcLoginState{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", stored.ID, now).
+		Update("used_at", now)
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to use sign in state, error = %+v", rez.Error)
+		return nil, rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return nil, cerror.ErrInvalidOidcState
+	}
+
+	return &stored, nil
+}
+
+// linkUser finds the user of the external subject. A subject seen for the
+// first time is linked to the user with the same OIB, or a citizen account
+// is created for it. Only citizens can sign in this way.
+func (s *OidcService) linkUser(claims oidc.Claims) (*model.User, error) {
+	issuer := s.client.Issuer()
+	var user model.User
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var identity model.OidcIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, claims.Subject()).First(&identity).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, identity.UserId).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.findOrCreateUser(tx, claims, &user); err != nil {
+				return err
+			}
+			identity = model.OidcIdentity{
+				UserId:  user.ID,
+				Issuer:  issuer,
+				Subject: claims.Subject(),
+			}
+			if err := tx.Create(&identity).Error; err != nil {
+				return err
+			}
+			s.logger.Infof("Linked subject of %s to user = %s", issuer, user.Uuid)
+		default:
+			return err
+		}
+
+		if user.Role != model.RoleOsoba {
+			return cerror.ErrBadRole
+		}
+		return tx.Model(&identity).Update("last_login_at", time.Now()).Error
+	})
+	if err != nil {
+		if !errors.Is(err, cerror.ErrBadRole) && !errors.Is(err, cerror.ErrMissingClaim) && !errors.Is(err, cerror.ErrEmailTaken) {
+			s.logger.Errorf("Failed to link external subject, error = %+v", err)
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// findOrCreateUser finds the user by the OIB claim or creates a citizen
+func (s *OidcService) findOrCreateUser(tx *gorm.DB, claims oidc.Claims, user *model.User) error {
+	oib := claims.String(config.AppConfig.OidcOibClaim)
+	if err := validate.Oib(oib); err != nil {
+		return fmt.Errorf("%w: %s: %w", cerror.ErrMissingClaim, config.AppConfig.OidcOibClaim, err)
+	}
+
+	err := tx.Where("oib = ?", oib).First(user).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// NOTE: the account is created just in time, the email is needed to
+	// reach the user and can't belong to someone else
+	email := claims.String("email")
+	if email == "" {
+		return fmt.Errorf("%w: email", cerror.ErrMissingClaim)
+	}
+	var taken int64
+	if err := tx.Model(&model.User{}).Where("email = ?", email).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return cerror.ErrEmailTaken
+	}
+
+	// The user has no password until they set one through a password reset
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	passwordHash, err := auth.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+
+	birthDate, _ := time.Parse(format.DateFormat, claims.String("birthdate"))
+	*user = model.User{
+		Uuid:         uuid.New(),
+		FirstName:    claims.String("given_name"),
+		LastName:     claims.String("family_name"),
+		OIB:          oib,
+		BirthDate:    birthDate,
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         model.RoleOsoba,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	s.logger.Infof("Created user = %s on first sign in through %s", user.Uuid, s.client.Issuer())
+	return nil
+}
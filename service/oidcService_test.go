@@ -0,0 +1,248 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type OidcServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	idp     *oidctest.Server
+	service service.IOidcService
+}
+
+func (suite *OidcServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:oidcservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	suite.idp, err = oidctest.NewServer("eprometna")
+	suite.Require().NoError(err)
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:             config.Dev,
+		AccessKey:       "oidc-test-access-key",
+		RefreshKey:      "oidc-test-refresh-key",
+		OidcIssuer:      suite.idp.Issuer(),
+		OidcClientId:    "eprometna",
+		OidcRedirectUrl: "http://localhost:5173/auth/callback",
+		OidcScopes:      []string{"openid", "profile", "email"},
+		OidcOibClaim:    "oib",
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewOidcService()
+}
+
+func (suite *OidcServiceTestSuite) TearDownSuite() {
+	suite.idp.Close()
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *OidcServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.OidcIdentity{}, &model.OidcLoginState{}, &model.RefreshToken{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+}
+
+func TestOidcServiceSuite(t *testing.T) {
+	suite.Run(t, new(OidcServiceTestSuite))
+}
+
+// signIn goes through the provider with the given claims
+func (suite *OidcServiceTestSuite) signIn(claims map[string]any) (*service.LoginResult, error) {
+	authUrl, binding, err := suite.service.AuthorizationUrl()
+	suite.Require().NoError(err)
+	code, state, err := suite.idp.Authorize(authUrl, claims)
+	suite.Require().NoError(err)
+	return suite.service.Callback(code, state, binding, testIp)
+}
+
+func (suite *OidcServiceTestSuite) citizenClaims(subject, oib string) map[string]any {
+	return map[string]any{
+		"sub":         subject,
+		"oib":         oib,
+		"email":       subject + "@example.com",
+		"given_name":  "Ana",
+		"family_name": "Horvat",
+		"birthdate":   "1990-05-17",
+	}
+}
+
+func (suite *OidcServiceTestSuite) createUser(email, oib string, role model.UserRole) *model.User {
+	user := &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Existing",
+		LastName:     "User",
+		OIB:          oib,
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        email,
+		PasswordHash: "hash",
+		Role:         role,
+	}
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *OidcServiceTestSuite) TestCreatesCitizenJustInTime() {
+	result, err := suite.signIn(suite.citizenClaims("subject-1", "12345678903"))
+	suite.Require().NoError(err)
+	assert.NotEmpty(suite.T(), result.AccessToken)
+	assert.NotEmpty(suite.T(), result.RefreshToken)
+
+	var user model.User
+	suite.Require().NoError(suite.db.Where("oib = ?", "12345678903").First(&user).Error)
+	assert.Equal(suite.T(), model.RoleOsoba, user.Role)
+	assert.Equal(suite.T(), "Ana", user.FirstName)
+	assert.Equal(suite.T(), "subject-1@example.com", user.Email)
+	assert.Equal(suite.T(), "1990-05-17", user.BirthDate.Format("2006-01-02"))
+
+	_, claims, err := auth.ParseToken("Bearer " + result.AccessToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), user.Uuid.String(), claims.Uuid)
+
+	// The second sign in uses the link, the OIB is no longer needed
+	claimsWithoutOib := suite.citizenClaims("subject-1", "")
+	_, err = suite.signIn(claimsWithoutOib)
+	suite.Require().NoError(err)
+
+	var count int64
+	suite.db.Model(&model.User{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+
+	var identity model.OidcIdentity
+	suite.Require().NoError(suite.db.Where("subject = ?", "subject-1").First(&identity).Error)
+	assert.Equal(suite.T(), user.ID, identity.UserId)
+	assert.Equal(suite.T(), suite.idp.Issuer(), identity.Issuer)
+	assert.NotNil(suite.T(), identity.LastLoginAt)
+}
+
+func (suite *OidcServiceTestSuite) TestLinksExistingUserByOib() {
+	existing := suite.createUser("citizen@example.com", "12345678903", model.RoleOsoba)
+
+	_, err := suite.signIn(suite.citizenClaims("subject-2", "12345678903"))
+	suite.Require().NoError(err)
+
+	var identity model.OidcIdentity
+	suite.Require().NoError(suite.db.Where("subject = ?", "subject-2").First(&identity).Error)
+	assert.Equal(suite.T(), existing.ID, identity.UserId)
+
+	var user model.User
+	suite.Require().NoError(suite.db.First(&user, existing.ID).Error)
+	assert.Equal(suite.T(), "Existing", user.FirstName)
+}
+
+func (suite *OidcServiceTestSuite) TestOnlyCitizens() {
+	suite.createUser("officer@example.com", "12345678903", model.RolePolicija)
+
+	_, err := suite.signIn(suite.citizenClaims("subject-3", "12345678903"))
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadRole)
+
+	var count int64
+	suite.db.Model(&model.OidcIdentity{}).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+}
+
+func (suite *OidcServiceTestSuite) TestMissingClaims() {
+	_, err := suite.signIn(suite.citizenClaims("subject-4", ""))
+	assert.ErrorIs(suite.T(), err, cerror.ErrMissingClaim)
+
+	claims := suite.citizenClaims("subject-4", "12345678903")
+	delete(claims, "email")
+	_, err = suite.signIn(claims)
+	assert.ErrorIs(suite.T(), err, cerror.ErrMissingClaim)
+}
+
+func (suite *OidcServiceTestSuite) TestEmailTaken() {
+	suite.createUser("subject-5@example.com", "12345678911", model.RoleOsoba)
+
+	_, err := suite.signIn(suite.citizenClaims("subject-5", "12345678903"))
+	assert.ErrorIs(suite.T(), err, cerror.ErrEmailTaken)
+}
+
+func (suite *OidcServiceTestSuite) TestStateIsSingleUse() {
+	authUrl, binding, err := suite.service.AuthorizationUrl()
+	suite.Require().NoError(err)
+	code, state, err := suite.idp.Authorize(authUrl, suite.citizenClaims("subject-6", "12345678903"))
+	suite.Require().NoError(err)
+
+	_, err = suite.service.Callback(code, "unknown-state", binding, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidOidcState)
+
+	_, err = suite.service.Callback(code, state, binding, testIp)
+	suite.Require().NoError(err)
+
+	_, err = suite.service.Callback(code, state, binding, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidOidcState)
+}
+
+func (suite *OidcServiceTestSuite) TestStateIsBound() {
+	authUrl, binding, err := suite.service.AuthorizationUrl()
+	suite.Require().NoError(err)
+	code, state, err := suite.idp.Authorize(authUrl, suite.citizenClaims("subject-8", "12345678903"))
+	suite.Require().NoError(err)
+
+	// a redirect completed by another browser is rejected
+	_, otherBinding, err := suite.service.AuthorizationUrl()
+	suite.Require().NoError(err)
+	_, err = suite.service.Callback(code, state, otherBinding, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidOidcState)
+	_, err = suite.service.Callback(code, state, "", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidOidcState)
+
+	// the state is still usable by the browser that started the sign in
+	_, err = suite.service.Callback(code, state, binding, testIp)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *OidcServiceTestSuite) TestExpiredState() {
+	authUrl, binding, err := suite.service.AuthorizationUrl()
+	suite.Require().NoError(err)
+	code, state, err := suite.idp.Authorize(authUrl, suite.citizenClaims("subject-7", "12345678903"))
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.db.
+		Session(&gorm.Session{AllowGlobalUpdate: true}).
+		Model(&model.OidcLoginState{}).
+		Update("expires_at", time.Now().Add(-time.Minute)).
+		Error)
+
+	_, err = suite.service.Callback(code, state, binding, testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidOidcState)
+}
+
+func TestOidcService_Disabled(t *testing.T) {
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+	app.Test()
+	app.Provide(func() *gorm.DB { return nil })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+
+	oidcService := service.NewOidcService()
+	_, _, err := oidcService.AuthorizationUrl()
+	assert.ErrorIs(t, err, cerror.ErrOidcDisabled)
+	_, err = oidcService.Callback("code", "state", "binding", testIp)
+	assert.ErrorIs(t, err, cerror.ErrOidcDisabled)
+}
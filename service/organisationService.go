@@ -0,0 +1,409 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/mail"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// OrganisationInvitationDuration is how long an invited user can accept
+const OrganisationInvitationDuration = 7 * 24 * time.Hour
+
+type IOrganisationService interface {
+	// Create registers an organisation owned by the given user
+	Create(organisation *model.Organisation, ownerUuid uuid.UUID) (*model.Organisation, error)
+	// Read returns an organisation with its members
+	Read(organisationUuid uuid.UUID) (*model.Organisation, error)
+	// GetMemberships returns the organisations of a user
+	GetMemberships(userUuid uuid.UUID) ([]model.OrganisationMember, error)
+	// GetMember returns the membership of a user, gorm.ErrRecordNotFound if they aren't a member
+	GetMember(organisationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error)
+	// Invite invites the user with the email to the organisation and mails
+	// them, unknown emails, users who can't be members and members are
+	// ignored so the endpoint can't be used to discover accounts
+	Invite(organisationUuid uuid.UUID, email string, role model.OrganisationRole, inviterUuid uuid.UUID) error
+	// GetInvitations returns the pending invitations of a user
+	GetInvitations(userUuid uuid.UUID) ([]model.OrganisationInvitation, error)
+	// AcceptInvitation makes the user a member with the role of their invitation
+	AcceptInvitation(invitationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error)
+	// DeclineInvitation deletes an invitation of the user
+	DeclineInvitation(invitationUuid, userUuid uuid.UUID) error
+	// ChangeRole changes the role of a member, the last owner can't be demoted
+	ChangeRole(organisationUuid, userUuid uuid.UUID, role model.OrganisationRole) (*model.OrganisationMember, error)
+	// RemoveMember removes a member, the last owner can't be removed
+	RemoveMember(organisationUuid, userUuid uuid.UUID) error
+}
+
+type OrganisationService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+	mailer mail.Mailer
+}
+
+func NewOrganisationService() IOrganisationService {
+	var service IOrganisationService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, mailer mail.Mailer) {
+		service = &OrganisationService{
+			db:     db,
+			logger: logger,
+			mailer: mailer,
+		}
+	})
+
+	return service
+}
+
+// Create implements IOrganisationService.
+func (s *OrganisationService) Create(organisation *model.Organisation, ownerUuid uuid.UUID) (*model.Organisation, error) {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		owner, err := s.memberUser(tx.Where("uuid = ?", ownerUuid))
+		if err != nil {
+			return err
+		}
+
+		var taken int64
+		if err := tx.Model(&model.Organisation{}).Where("oib = ?", organisation.OIB).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return cerror.ErrOrganisationExists
+		}
+
+		if err := tx.Create(organisation).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.OrganisationMember{
+			OrganisationId: organisation.ID,
+			UserId:         owner.ID,
+			Role:           model.OrgRoleOwner,
+		}).Error
+	}); err != nil {
+		if !isOrganisationError(err) {
+			s.logger.Errorf("Failed to create organisation with OIB = %s, error = %+v", organisation.OIB, err)
+		}
+		return nil, err
+	}
+
+	s.logger.Infof("User = %s registered organisation = %s", ownerUuid, organisation.Uuid)
+	return s.Read(organisation.Uuid)
+}
+
+// Read implements IOrganisationService.
+func (s *OrganisationService) Read(organisationUuid uuid.UUID) (*model.Organisation, error) {
+	var organisation model.Organisation
+	if err := s.db.
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("organisation_members.id") }).
+		Preload("Members.User").
+		Where("uuid = ?", organisationUuid).
+		First(&organisation).
+		Error; err != nil {
+		return nil, err
+	}
+	return &organisation, nil
+}
+
+// GetMemberships implements IOrganisationService.
+func (s *OrganisationService) GetMemberships(userUuid uuid.UUID) ([]model.OrganisationMember, error) {
+	var members []model.OrganisationMember
+	if err := s.db.
+		Preload("Organisation").
+		Joins("inner join users on users.id = organisation_members.user_id").
+		Where("users.uuid = ?", userUuid).
+		Order("organisation_members.id").
+		Find(&members).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query memberships of user = %s, error = %+v", userUuid, err)
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetMember implements IOrganisationService.
+func (s *OrganisationService) GetMember(organisationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error) {
+	return s.member(s.db, organisationUuid, userUuid)
+}
+
+// Invite implements IOrganisationService.
+func (s *OrganisationService) Invite(organisationUuid uuid.UUID, email string, role model.OrganisationRole, inviterUuid uuid.UUID) error {
+	var invitation model.OrganisationInvitation
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var organisation model.Organisation
+		if err := tx.Where("uuid = ?", organisationUuid).First(&organisation).Error; err != nil {
+			return err
+		}
+		user, err := s.memberUser(tx.Where("lower(email) = ?", strings.ToLower(email)))
+		if err != nil {
+			return err
+		}
+		if err := s.notMember(tx, organisation.ID, user.ID); err != nil {
+			return err
+		}
+
+		// NOTE: inviting again replaces the pending invitation
+		if err := tx.
+			Unscoped().
+			Where("organisation_id = ? AND user_id = ?", organisation.ID, user.ID).
+			Delete(&model.OrganisationInvitation{}).
+			Error; err != nil {
+			return err
+		}
+		invitation = model.OrganisationInvitation{
+			Uuid:           uuid.New(),
+			OrganisationId: organisation.ID,
+			Organisation:   &organisation,
+			UserId:         user.ID,
+			User:           *user,
+			Role:           role,
+			ExpiresAt:      time.Now().Add(OrganisationInvitationDuration),
+		}
+		return tx.Omit("Organisation", "User").Create(&invitation).Error
+	}); err != nil {
+		if isOrganisationError(err) {
+			s.logger.Debugf("Invitation to organisation = %s by %s ignored, error = %v", organisationUuid, inviterUuid, err)
+			return nil
+		}
+		s.logger.Errorf("Failed to invite member to organisation = %s, error = %+v", organisationUuid, err)
+		return err
+	}
+
+	// NOTE: the invitation is listed in the app, a failed mail must not
+	// answer differently than an unknown email
+	if err := s.mailer.Send(mail.Message{
+		To:      invitation.User.Email,
+		Subject: "ePrometna organisation invitation",
+		Body:    invitationMailBody(&invitation),
+	}); err != nil {
+		s.logger.Errorf("Failed to send invitation mail to user = %s, error = %+v", invitation.User.Uuid, err)
+	}
+
+	s.logger.Infof("User = %s invited user = %s to organisation = %s as %s", inviterUuid, invitation.User.Uuid, organisationUuid, role)
+	return nil
+}
+
+// GetInvitations implements IOrganisationService.
+func (s *OrganisationService) GetInvitations(userUuid uuid.UUID) ([]model.OrganisationInvitation, error) {
+	var invitations []model.OrganisationInvitation
+	if err := s.db.
+		Preload("Organisation").
+		Where("user_id = (?) AND expires_at > ?", s.db.Model(&model.User{}).Select("id").Where("uuid = ?", userUuid), time.Now()).
+		Order("id").
+		Find(&invitations).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query invitations of user = %s, error = %+v", userUuid, err)
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// AcceptInvitation implements IOrganisationService.
+func (s *OrganisationService) AcceptInvitation(invitationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error) {
+	var member model.OrganisationMember
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := s.invitation(tx, invitationUuid, userUuid)
+		if err != nil {
+			return err
+		}
+		if invitation.ExpiresAt.Before(time.Now()) {
+			return gorm.ErrRecordNotFound
+		}
+		// NOTE: the role of the user may have changed since the invitation
+		user, err := s.memberUser(tx.Where("id = ?", invitation.UserId))
+		if err != nil {
+			return err
+		}
+		if err := s.notMember(tx, invitation.OrganisationId, user.ID); err != nil {
+			return err
+		}
+
+		member = model.OrganisationMember{
+			OrganisationId: invitation.OrganisationId,
+			Organisation:   invitation.Organisation,
+			UserId:         user.ID,
+			User:           *user,
+			Role:           invitation.Role,
+		}
+		if err := tx.Omit("Organisation", "User").Create(&member).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(invitation).Error
+	}); err != nil {
+		if !isOrganisationError(err) {
+			s.logger.Errorf("Failed to accept invitation = %s, error = %+v", invitationUuid, err)
+		}
+		return nil, err
+	}
+
+	s.logger.Infof("User = %s joined organisation = %s as %s", userUuid, member.Organisation.Uuid, member.Role)
+	return &member, nil
+}
+
+// DeclineInvitation implements IOrganisationService.
+func (s *OrganisationService) DeclineInvitation(invitationUuid, userUuid uuid.UUID) error {
+	invitation, err := s.invitation(s.db, invitationUuid, userUuid)
+	if err != nil {
+		if !isOrganisationError(err) {
+			s.logger.Errorf("Failed to query invitation = %s, error = %+v", invitationUuid, err)
+		}
+		return err
+	}
+	if err := s.db.Unscoped().Delete(invitation).Error; err != nil {
+		s.logger.Errorf("Failed to decline invitation = %s, error = %+v", invitationUuid, err)
+		return err
+	}
+
+	s.logger.Infof("User = %s declined invitation = %s", userUuid, invitationUuid)
+	return nil
+}
+
+// ChangeRole implements IOrganisationService.
+func (s *OrganisationService) ChangeRole(organisationUuid, userUuid uuid.UUID, role model.OrganisationRole) (*model.OrganisationMember, error) {
+	var member *model.OrganisationMember
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		member, err = s.member(tx, organisationUuid, userUuid)
+		if err != nil {
+			return err
+		}
+		if member.Role == model.OrgRoleOwner && role != model.OrgRoleOwner {
+			if err := s.keepOwner(tx, member); err != nil {
+				return err
+			}
+		}
+
+		member.Role = role
+		return tx.Model(member).Update("role", role).Error
+	}); err != nil {
+		if !isOrganisationError(err) {
+			s.logger.Errorf("Failed to change role of member = %s in organisation = %s, error = %+v", userUuid, organisationUuid, err)
+		}
+		return nil, err
+	}
+
+	s.logger.Infof("Member = %s of organisation = %s is now %s", userUuid, organisationUuid, role)
+	return member, nil
+}
+
+// RemoveMember implements IOrganisationService.
+func (s *OrganisationService) RemoveMember(organisationUuid, userUuid uuid.UUID) error {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		member, err := s.member(tx, organisationUuid, userUuid)
+		if err != nil {
+			return err
+		}
+		if member.Role == model.OrgRoleOwner {
+			if err := s.keepOwner(tx, member); err != nil {
+				return err
+			}
+		}
+		// NOTE: members are deleted for good so the user can be added again
+		return tx.Unscoped().Delete(member).Error
+	}); err != nil {
+		if !isOrganisationError(err) {
+			s.logger.Errorf("Failed to remove member = %s from organisation = %s, error = %+v", userUuid, organisationUuid, err)
+		}
+		return err
+	}
+
+	s.logger.Infof("Member = %s removed from organisation = %s", userUuid, organisationUuid)
+	return nil
+}
+
+// member returns the membership of a user with the user and organisation loaded
+func (s *OrganisationService) member(tx *gorm.DB, organisationUuid, userUuid uuid.UUID) (*model.OrganisationMember, error) {
+	var member model.OrganisationMember
+	if err := tx.
+		Preload("Organisation").
+		Preload("User").
+		Where("organisation_id = (?) AND user_id = (?)",
+			tx.Model(&model.Organisation{}).Select("id").Where("uuid = ?", organisationUuid),
+			tx.Model(&model.User{}).Select("id").Where("uuid = ?", userUuid)).
+		First(&member).
+		Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// invitation returns an invitation of a user with the organisation loaded
+func (s *OrganisationService) invitation(tx *gorm.DB, invitationUuid, userUuid uuid.UUID) (*model.OrganisationInvitation, error) {
+	var invitation model.OrganisationInvitation
+	if err := tx.
+		Preload("Organisation").
+		Where("uuid = ? AND user_id = (?)", invitationUuid, tx.Model(&model.User{}).Select("id").Where("uuid = ?", userUuid)).
+		First(&invitation).
+		Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// notMember fails if the user is already a member of the organisation
+func (s *OrganisationService) notMember(tx *gorm.DB, organisationId, userId uint) error {
+	var existing int64
+	if err := tx.Model(&model.OrganisationMember{}).
+		Where("organisation_id = ? AND user_id = ?", organisationId, userId).
+		Count(&existing).
+		Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return cerror.ErrAlreadyMember
+	}
+	return nil
+}
+
+// memberUser finds the user a query selects, only citizens and companies
+// can be members of an organisation
+func (s *OrganisationService) memberUser(query *gorm.DB) (*model.User, error) {
+	var user model.User
+	if err := query.First(&user).Error; err != nil {
+		return nil, err
+	}
+	if user.Role != model.RoleOsoba && user.Role != model.RoleFirma {
+		return nil, cerror.ErrBadRole
+	}
+	return &user, nil
+}
+
+// keepOwner fails if the member is the only owner of their organisation
+func (s *OrganisationService) keepOwner(tx *gorm.DB, member *model.OrganisationMember) error {
+	var owners int64
+	if err := tx.Model(&model.OrganisationMember{}).
+		Where("organisation_id = ? AND role = ?", member.OrganisationId, model.OrgRoleOwner).
+		Count(&owners).
+		Error; err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return cerror.ErrLastOwner
+	}
+	return nil
+}
+
+func invitationMailBody(invitation *model.OrganisationInvitation) string {
+	return fmt.Sprintf("You were invited to join %s as %s on ePrometna.\n\n"+
+		"Open the app to accept or decline the invitation, it expires in %d days.\n",
+		invitation.Organisation.Name, invitation.Role, int(OrganisationInvitationDuration.Hours()/24))
+}
+
+// isOrganisationError reports whether err is an expected outcome that isn't worth an error log
+func isOrganisationError(err error) bool {
+	for _, expected := range []error{
+		gorm.ErrRecordNotFound, cerror.ErrBadRole, cerror.ErrOrganisationExists,
+		cerror.ErrAlreadyMember, cerror.ErrLastOwner,
+	} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type OrganisationServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IOrganisationService
+	outbox  service.IOutboxService
+	owner   *model.User
+	manager *model.User
+}
+
+func (suite *OrganisationServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:organisation_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewOutboxService)
+	app.Provide(service.NewMailer)
+	app.Invoke(func(outbox service.IOutboxService) { suite.outbox = outbox })
+	suite.service = service.NewOrganisationService()
+}
+
+func (suite *OrganisationServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *OrganisationServiceTestSuite) SetupTest() {
+	for _, m := range []any{
+		&model.OrganisationInvitation{}, &model.OrganisationMember{}, &model.Organisation{},
+		&model.OutboxMessage{}, &model.User{},
+	} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+
+	suite.owner = suite.createUser("owner@example.com", "12345678903", model.RoleFirma)
+	suite.manager = suite.createUser("manager@example.com", "10000000000", model.RoleOsoba)
+}
+
+func TestOrganisationService(t *testing.T) {
+	suite.Run(t, new(OrganisationServiceTestSuite))
+}
+
+func (suite *OrganisationServiceTestSuite) createUser(email, oib string, role model.UserRole) *model.User {
+	user := &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Org",
+		LastName:     "User",
+		OIB:          oib,
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        email,
+		PasswordHash: "hash",
+		Role:         role,
+	}
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *OrganisationServiceTestSuite) createOrganisation() *model.Organisation {
+	organisation, err := suite.service.Create(&model.Organisation{
+		Uuid: uuid.New(),
+		Name: "Prijevoz d.o.o.",
+		OIB:  "69435151530",
+	}, suite.owner.Uuid)
+	suite.Require().NoError(err)
+	return organisation
+}
+
+// join invites the user and accepts the invitation for them
+func (suite *OrganisationServiceTestSuite) join(organisation *model.Organisation, user *model.User, role model.OrganisationRole) (*model.OrganisationMember, error) {
+	suite.Require().NoError(suite.service.Invite(organisation.Uuid, user.Email, role, suite.owner.Uuid))
+	invitations, err := suite.service.GetInvitations(user.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(invitations)
+	return suite.service.AcceptInvitation(invitations[len(invitations)-1].Uuid, user.Uuid)
+}
+
+func (suite *OrganisationServiceTestSuite) TestCreate() {
+	organisation := suite.createOrganisation()
+
+	suite.Require().Len(organisation.Members, 1)
+	assert.Equal(suite.T(), suite.owner.Uuid, organisation.Members[0].User.Uuid)
+	assert.Equal(suite.T(), model.OrgRoleOwner, organisation.Members[0].Role)
+
+	_, err := suite.service.Create(&model.Organisation{Uuid: uuid.New(), Name: "Kopija", OIB: "69435151530"}, suite.manager.Uuid)
+	assert.ErrorIs(suite.T(), err, cerror.ErrOrganisationExists)
+}
+
+func (suite *OrganisationServiceTestSuite) TestCreate_BadOwner() {
+	admin := suite.createUser("admin@example.com", "20000000009", model.RoleMupADMIN)
+
+	_, err := suite.service.Create(&model.Organisation{Uuid: uuid.New(), Name: "MUP", OIB: "69435151530"}, admin.Uuid)
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadRole)
+
+	_, err = suite.service.Create(&model.Organisation{Uuid: uuid.New(), Name: "Nitko", OIB: "69435151530"}, uuid.New())
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *OrganisationServiceTestSuite) TestMembers() {
+	organisation := suite.createOrganisation()
+
+	member, err := suite.join(organisation, suite.manager, model.OrgRoleFleetManager)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.manager.Uuid, member.User.Uuid)
+
+	memberships, err := suite.service.GetMemberships(suite.manager.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(memberships, 1)
+	assert.Equal(suite.T(), organisation.Uuid, memberships[0].Organisation.Uuid)
+	assert.Equal(suite.T(), model.OrgRoleFleetManager, memberships[0].Role)
+
+	member, err = suite.service.ChangeRole(organisation.Uuid, suite.manager.Uuid, model.OrgRoleDriver)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.OrgRoleDriver, member.Role)
+
+	suite.Require().NoError(suite.service.RemoveMember(organisation.Uuid, suite.manager.Uuid))
+	_, err = suite.service.GetMember(organisation.Uuid, suite.manager.Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	// removed members can be invited again
+	_, err = suite.join(organisation, suite.manager, model.OrgRoleDriver)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *OrganisationServiceTestSuite) TestInvite() {
+	organisation := suite.createOrganisation()
+
+	suite.Require().NoError(suite.service.Invite(organisation.Uuid, "Manager@Example.com", model.OrgRoleDriver, suite.owner.Uuid))
+	// inviting again replaces the invitation
+	suite.Require().NoError(suite.service.Invite(organisation.Uuid, "manager@example.com", model.OrgRoleFleetManager, suite.owner.Uuid))
+
+	invitations, err := suite.service.GetInvitations(suite.manager.Uuid)
+	suite.Require().NoError(err)
+	suite.Require().Len(invitations, 1)
+	assert.Equal(suite.T(), model.OrgRoleFleetManager, invitations[0].Role)
+	assert.Equal(suite.T(), organisation.Uuid, invitations[0].Organisation.Uuid)
+
+	messages, err := suite.outbox.GetForRecipient("manager@example.com")
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), messages, 2)
+
+	// only the invited user can accept
+	_, err = suite.service.AcceptInvitation(invitations[0].Uuid, suite.owner.Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+	_, err = suite.service.GetMember(organisation.Uuid, suite.manager.Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	suite.Require().NoError(suite.service.DeclineInvitation(invitations[0].Uuid, suite.manager.Uuid))
+	invitations, err = suite.service.GetInvitations(suite.manager.Uuid)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), invitations)
+}
+
+func (suite *OrganisationServiceTestSuite) TestInvite_Ignored() {
+	organisation := suite.createOrganisation()
+	officer := suite.createUser("officer@example.com", "20000000009", model.RolePolicija)
+
+	// unknown emails, users who can't be members and members look the same
+	for _, email := range []string{"nobody@example.com", officer.Email, suite.owner.Email} {
+		assert.NoError(suite.T(), suite.service.Invite(organisation.Uuid, email, model.OrgRoleDriver, suite.owner.Uuid), email)
+	}
+
+	var count int64
+	suite.db.Model(&model.OrganisationInvitation{}).Count(&count)
+	assert.Zero(suite.T(), count)
+	suite.db.Model(&model.OutboxMessage{}).Count(&count)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *OrganisationServiceTestSuite) TestAcceptInvitation_Expired() {
+	organisation := suite.createOrganisation()
+	suite.Require().NoError(suite.service.Invite(organisation.Uuid, suite.manager.Email, model.OrgRoleDriver, suite.owner.Uuid))
+
+	var invitation model.OrganisationInvitation
+	suite.Require().NoError(suite.db.First(&invitation).Error)
+	suite.Require().NoError(suite.db.Model(&invitation).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	invitations, err := suite.service.GetInvitations(suite.manager.Uuid)
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), invitations)
+
+	_, err = suite.service.AcceptInvitation(invitation.Uuid, suite.manager.Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *OrganisationServiceTestSuite) TestLastOwner() {
+	organisation := suite.createOrganisation()
+
+	_, err := suite.service.ChangeRole(organisation.Uuid, suite.owner.Uuid, model.OrgRoleDriver)
+	assert.ErrorIs(suite.T(), err, cerror.ErrLastOwner)
+	assert.ErrorIs(suite.T(), suite.service.RemoveMember(organisation.Uuid, suite.owner.Uuid), cerror.ErrLastOwner)
+
+	_, err = suite.join(organisation, suite.manager, model.OrgRoleOwner)
+	suite.Require().NoError(err)
+	assert.NoError(suite.T(), suite.service.RemoveMember(organisation.Uuid, suite.owner.Uuid))
+}
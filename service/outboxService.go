@@ -0,0 +1,78 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/mail"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IOutboxService interface {
+	mail.Mailer
+	// GetForRecipient returns messages sent to an address, newest first
+	GetForRecipient(recipient string) ([]model.OutboxMessage, error)
+}
+
+// OutboxService stores mail in the outbox table
+type OutboxService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewOutboxService() IOutboxService {
+	var service IOutboxService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &OutboxService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// NewMailer returns the configured mailer, a directory outbox if
+// MAIL_OUTBOX_DIR is set and the outbox table otherwise
+func NewMailer(outbox IOutboxService, logger *zap.SugaredLogger) (mail.Mailer, error) {
+	if dir := config.AppConfig.MailOutboxDir; dir != "" {
+		logger.Infof("Writing outgoing mail to directory = %s", dir)
+		return mail.NewDirectoryMailer(dir)
+	}
+	return outbox, nil
+}
+
+// Send implements mail.Mailer.
+func (s *OutboxService) Send(msg mail.Message) error {
+	message := model.OutboxMessage{
+		Uuid:      uuid.New(),
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		Body:      msg.Body,
+	}
+	if err := s.db.Create(&message).Error; err != nil {
+		s.logger.Errorf("Failed to store mail to = %s, error = %+v", msg.To, err)
+		return err
+	}
+
+	s.logger.Debugf("Stored mail uuid = %s in outbox", message.Uuid)
+	return nil
+}
+
+// GetForRecipient implements IOutboxService.
+func (s *OutboxService) GetForRecipient(recipient string) ([]model.OutboxMessage, error) {
+	var messages []model.OutboxMessage
+	if err := s.db.
+		Where("recipient = ?", recipient).
+		Order("id DESC").
+		Find(&messages).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query outbox, error = %+v", err)
+		return nil, err
+	}
+
+	return messages, nil
+}
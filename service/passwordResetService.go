@@ -0,0 +1,222 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/mail"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const PasswordResetTokenDuration = time.Hour
+
+// MaxOutstandingResetTokens is how many unused reset tokens a user can have,
+// further requests are ignored until one is used or expires
+const MaxOutstandingResetTokens = 3
+
+type IPasswordResetService interface {
+	// RequestReset mails a reset token to the user, unknown emails are
+	// ignored so the endpoint can't be used to discover accounts. Only a
+	// *ThrottledError is returned, the mail is sent in the background.
+	RequestReset(email, ip string) error
+	// ConfirmReset sets a new password and ends every session of the user,
+	// the password has to satisfy the password policy
+	ConfirmReset(token, password string) error
+}
+
+type PasswordResetService struct {
+	db       *gorm.DB
+	logger   *zap.SugaredLogger
+	mailer   mail.Mailer
+	throttle ILoginThrottleService
+}
+
+func NewPasswordResetService() IPasswordResetService {
+	var service IPasswordResetService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, mailer mail.Mailer) {
+		service = &PasswordResetService{
+			db:       db,
+			logger:   logger,
+			mailer:   mailer,
+			throttle: NewLoginThrottleService(),
+		}
+	})
+
+	return service
+}
+
+// RequestReset implements IPasswordResetService.
+func (s *PasswordResetService) RequestReset(email, ip string) error {
+	keys := []ThrottleKey{ResetKey(email), ResetIpKey(ip)}
+	if err := s.throttle.Check(keys...); err != nil {
+		return err
+	}
+	// Every request is counted, known and unknown emails alike
+	if err := s.throttle.Fail(keys...); err != nil {
+		s.logger.Errorf("Failed to record reset request, error = %+v", err)
+	}
+
+	// NOTE: the token is issued in the background so the response takes as
+	// long for unknown emails and doesn't tell if a mail was sent
+	go s.issueToken(email)
+	return nil
+}
+
+// issueToken mails a reset token to the user of the email, errors are only
+// logged since the request was already answered
+func (s *PasswordResetService) issueToken(email string) {
+	var user model.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Debugf("Password reset requested for unknown email = %s", email)
+			return
+		}
+		s.logger.Errorf("Failed to query user, error = %+v", err)
+		return
+	}
+
+	now := time.Now()
+	var outstanding int64
+	if err := s.db.
+		Model(&model.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL AND expires_at > ?", user.ID, now).
+		Count(&outstanding).
+		Error; err != nil {
+		s.logger.Errorf("Failed to count reset tokens, error = %+v", err)
+		return
+	}
+	if outstanding >= MaxOutstandingResetTokens {
+		s.logger.Warnf("Password reset for user = %s skipped, %d tokens are outstanding", user.Uuid, outstanding)
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		s.logger.Errorf("Failed to generate reset token, error = %+v", err)
+		return
+	}
+
+	stored := model.PasswordResetToken{
+		UserId:    user.ID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: now.Add(PasswordResetTokenDuration),
+	}
+	if err := s.db.Create(&stored).Error; err != nil {
+		s.logger.Errorf("Failed to store reset token, error = %+v", err)
+		return
+	}
+
+	if err := s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "ePrometna password reset",
+		Body:    resetMailBody(token),
+	}); err != nil {
+		s.logger.Errorf("Failed to send reset mail to user = %s, error = %+v", user.Uuid, err)
+		return
+	}
+
+	s.logger.Infof("Password reset requested for user = %s", user.Uuid)
+}
+
+// ConfirmReset implements IPasswordResetService.
+func (s *PasswordResetService) ConfirmReset(token, password string) error {
+	if err := auth.ValidatePassword(password); err != nil {
+		return err
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var stored model.PasswordResetToken
+	if err := s.db.
+		Where("token_hash = ?", auth.HashOpaqueToken(token)).
+		First(&stored).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cerror.ErrInvalidResetToken
+		}
+		s.logger.Errorf("Failed to query reset token, error = %+v", err)
+		return err
+	}
+
+	now := time.Now()
+	if !stored.IsActive(now) {
+		return cerror.ErrInvalidResetToken
+	}
+
+	var user model.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// NOTE: conditional update so a token can't be used by two parallel requests
+		rez := tx.
+			Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", now)
+		if rez.Error != nil {
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return cerror.ErrInvalidResetToken
+		}
+
+		if err := tx.First(&user, stored.UserId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return cerror.ErrInvalidResetToken
+			}
+			return err
+		}
+		if err := tx.Model(&user).Update("password_hash", hash).Error; err != nil {
+			return err
+		}
+
+		// Other tokens sent before the reset are no longer needed
+		if err := tx.
+			Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).
+			Error; err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&model.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).
+			Error
+	})
+	if err != nil {
+		if !errors.Is(err, cerror.ErrInvalidResetToken) {
+			s.logger.Errorf("Failed to reset password, error = %+v", err)
+		}
+		return err
+	}
+
+	// Access and device tokens issued before the reset stop working
+	if err := auth.RevokeUser(user.Uuid.String(), now); err != nil {
+		s.logger.Errorf("Failed to revoke tokens of user = %s, error = %+v", user.Uuid, err)
+		return err
+	}
+
+	s.logger.Infof("Password reset completed for user = %s", user.Uuid)
+	return nil
+}
+
+func resetMailBody(token string) string {
+	body := fmt.Sprintf("A password reset was requested for your ePrometna account.\n\n"+
+		"Reset code: %s\n\n", token)
+	if config.AppConfig.AppUrl != "" {
+		body += fmt.Sprintf("Or open: %s/reset-password?token=%s\n\n", config.AppConfig.AppUrl, url.QueryEscape(token))
+	}
+	body += fmt.Sprintf("The code expires in %d minutes. If you didn't request it, ignore this message.\n",
+		int(PasswordResetTokenDuration.Minutes()))
+	return body
+}
@@ -0,0 +1,228 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/mail"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type PasswordResetServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	outbox  service.IOutboxService
+	service service.IPasswordResetService
+	user    *model.User
+}
+
+func (suite *PasswordResetServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:passwordreset_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:        config.Dev,
+		AccessKey:  "reset-test-access-key",
+		RefreshKey: "reset-test-refresh-key",
+		AppUrl:     "https://eprometna.example.com",
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewOutboxService)
+	app.Provide(service.NewMailer)
+	app.Invoke(func(outbox service.IOutboxService, mailer mail.Mailer) {
+		suite.outbox = outbox
+		suite.Require().Equal(outbox, mailer, "Outbox table is the default mailer")
+	})
+	suite.service = service.NewPasswordResetService()
+}
+
+func (suite *PasswordResetServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *PasswordResetServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.PasswordResetToken{}, &model.OutboxMessage{}, &model.RefreshToken{}, &model.LoginThrottle{}, &model.LockEvent{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+	auth.SetRevocationStore(auth.NewMemoryRevocationStore())
+
+	hash, err := auth.HashPassword("oldpassword")
+	suite.Require().NoError(err)
+	suite.user = &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Reset",
+		LastName:     "User",
+		OIB:          "12345678903",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        "reset@example.com",
+		PasswordHash: hash,
+		Role:         model.RoleOsoba,
+	}
+	suite.Require().NoError(suite.db.Create(suite.user).Error)
+}
+
+func TestPasswordResetServiceSuite(t *testing.T) {
+	suite.Run(t, new(PasswordResetServiceTestSuite))
+}
+
+var resetCodePattern = regexp.MustCompile(`Reset code: (\S+)`)
+
+// requestToken requests a reset and reads the token from the newest mail,
+// the mail is sent in the background
+func (suite *PasswordResetServiceTestSuite) requestToken() string {
+	sent := suite.mails()
+	suite.Require().NoError(suite.service.RequestReset(suite.user.Email, testIp))
+
+	var messages []model.OutboxMessage
+	suite.Require().Eventually(func() bool {
+		messages = suite.mails()
+		return len(messages) > len(sent)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	match := resetCodePattern.FindStringSubmatch(messages[0].Body)
+	suite.Require().Len(match, 2)
+	return match[1]
+}
+
+func (suite *PasswordResetServiceTestSuite) mails() []model.OutboxMessage {
+	messages, err := suite.outbox.GetForRecipient(suite.user.Email)
+	suite.Require().NoError(err)
+	return messages
+}
+
+func (suite *PasswordResetServiceTestSuite) TestRequestReset() {
+	token := suite.requestToken()
+
+	messages, _ := suite.outbox.GetForRecipient(suite.user.Email)
+	assert.Contains(suite.T(), messages[0].Body, "https://eprometna.example.com/reset-password?token="+token)
+
+	var stored model.PasswordResetToken
+	suite.Require().NoError(suite.db.First(&stored).Error)
+	assert.Equal(suite.T(), auth.HashOpaqueToken(token), stored.TokenHash)
+	assert.NotContains(suite.T(), stored.TokenHash, token)
+	assert.WithinDuration(suite.T(), time.Now().Add(service.PasswordResetTokenDuration), stored.ExpiresAt, 5*time.Second)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestRequestReset_UnknownEmail() {
+	assert.NoError(suite.T(), suite.service.RequestReset("nobody@example.com", testIp))
+	suite.requestToken()
+
+	var count int64
+	suite.db.Model(&model.OutboxMessage{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestRequestReset_OutstandingTokensAreCapped() {
+	for range service.MaxOutstandingResetTokens {
+		suite.requestToken()
+	}
+
+	suite.Require().NoError(suite.service.RequestReset(suite.user.Email, testIp))
+	assert.Never(suite.T(), func() bool {
+		return len(suite.mails()) > service.MaxOutstandingResetTokens
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestRequestReset_Throttled() {
+	policy := service.ThrottlePolicies[model.ThrottleScopeReset]
+	for range policy.FreeAttempts + 1 {
+		suite.Require().NoError(suite.service.RequestReset("nobody@example.com", testIp))
+	}
+
+	// Unknown emails are throttled like known ones
+	err := suite.service.RequestReset("nobody@example.com", testIp)
+	assert.ErrorIs(suite.T(), err, cerror.ErrTooManyAttempts)
+
+	// Other emails from the address and logins are not affected
+	assert.NoError(suite.T(), suite.service.RequestReset("somebody@example.com", testIp))
+	var logins int64
+	suite.db.Model(&model.LoginThrottle{}).Where("scope = ?", model.ThrottleScopeEmail).Count(&logins)
+	assert.Zero(suite.T(), logins)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestConfirmReset() {
+	token := suite.requestToken()
+	suite.Require().NoError(suite.db.Create(&model.RefreshToken{
+		Uuid:       uuid.New(),
+		FamilyUuid: uuid.New(),
+		UserId:     suite.user.ID,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}).Error)
+	accessToken, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.service.ConfirmReset(token, "newpassword"))
+
+	var user model.User
+	suite.Require().NoError(suite.db.First(&user, suite.user.ID).Error)
+	assert.True(suite.T(), auth.VerifyPassword(user.PasswordHash, "newpassword"))
+	assert.False(suite.T(), auth.VerifyPassword(user.PasswordHash, "oldpassword"))
+
+	// Sessions are ended
+	var active int64
+	suite.db.Model(&model.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	assert.Equal(suite.T(), int64(0), active)
+	_, claims, err := auth.ParseToken("Bearer " + accessToken)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), auth.IsRevoked(claims))
+
+	// Token is single use
+	assert.ErrorIs(suite.T(), suite.service.ConfirmReset(token, "anotherpassword"), cerror.ErrInvalidResetToken)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestConfirmReset_InvalidatesOtherTokens() {
+	first := suite.requestToken()
+	second := suite.requestToken()
+
+	suite.Require().NoError(suite.service.ConfirmReset(second, "newpassword"))
+
+	assert.ErrorIs(suite.T(), suite.service.ConfirmReset(first, "anotherpassword"), cerror.ErrInvalidResetToken)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestConfirmReset_WeakPassword() {
+	policy, err := auth.NewPasswordPolicy(10, 0, "")
+	suite.Require().NoError(err)
+	auth.SetPasswordPolicy(policy)
+	defer auth.SetPasswordPolicy(nil)
+	token := suite.requestToken()
+
+	assert.ErrorIs(suite.T(), suite.service.ConfirmReset(token, "short"), cerror.ErrWeakPassword)
+
+	// Token is not used up by a rejected password
+	assert.NoError(suite.T(), suite.service.ConfirmReset(token, "long enough password"))
+}
+
+func (suite *PasswordResetServiceTestSuite) TestConfirmReset_Expired() {
+	token := suite.requestToken()
+	suite.db.Model(&model.PasswordResetToken{}).
+		Where("user_id = ?", suite.user.ID).
+		Update("expires_at", time.Now().Add(-time.Minute))
+
+	assert.ErrorIs(suite.T(), suite.service.ConfirmReset(token, "newpassword"), cerror.ErrInvalidResetToken)
+}
+
+func (suite *PasswordResetServiceTestSuite) TestConfirmReset_UnknownToken() {
+	assert.ErrorIs(suite.T(), suite.service.ConfirmReset("unknown", "newpassword"), cerror.ErrInvalidResetToken)
+}
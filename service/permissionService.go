@@ -0,0 +1,187 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IPermissionService interface {
+	// Load installs role permissions from the database into auth, default
+	// permissions of seeds the database hasn't applied are granted first
+	Load() error
+	// GetAll returns the permissions of every role
+	GetAll() (map[model.UserRole][]model.Permission, error)
+	// Grant assigns a permission to a role, granting it twice is not an error
+	Grant(role model.UserRole, permission model.Permission, adminUuid uuid.UUID) error
+	// Revoke removes a permission from a role
+	Revoke(role model.UserRole, permission model.Permission, adminUuid uuid.UUID) error
+}
+
+type PermissionService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewPermissionService() IPermissionService {
+	var service IPermissionService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &PermissionService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Load implements IPermissionService.
+func (s *PermissionService) Load() error {
+	if err := s.seed(); err != nil {
+		return err
+	}
+
+	permissions, err := s.GetAll()
+	if err != nil {
+		return err
+	}
+
+	auth.SetPermissionStore(auth.StaticPermissionStore(permissions))
+	s.logger.Debugf("Loaded permissions of %d roles", len(permissions))
+	return nil
+}
+
+// GetAll implements IPermissionService.
+func (s *PermissionService) GetAll() (map[model.UserRole][]model.Permission, error) {
+	var assigned []model.RolePermission
+	if err := s.db.Order("role, permission").Find(&assigned).Error; err != nil {
+		s.logger.Errorf("Failed to query role permissions, error = %+v", err)
+		return nil, err
+	}
+
+	permissions := make(map[model.UserRole][]model.Permission, len(model.Roles))
+	for _, rp := range assigned {
+		permissions[rp.Role] = append(permissions[rp.Role], rp.Permission)
+	}
+	return permissions, nil
+}
+
+// Grant implements IPermissionService.
+func (s *PermissionService) Grant(role model.UserRole, permission model.Permission, adminUuid uuid.UUID) error {
+	err := s.db.
+		Where(model.RolePermission{Role: role, Permission: permission}).
+		FirstOrCreate(&model.RolePermission{}).
+		Error
+	if err != nil {
+		s.logger.Errorf("Failed to grant %s to %s, error = %+v", permission, role, err)
+		return err
+	}
+
+	s.logger.Infof("Admin = %s granted %s to %s", adminUuid, permission, role)
+	return s.Load()
+}
+
+// Revoke implements IPermissionService.
+func (s *PermissionService) Revoke(role model.UserRole, permission model.Permission, adminUuid uuid.UUID) error {
+	// NOTE: without it nobody could assign permissions anymore
+	if role == model.RoleSuperAdmin && permission == model.PermPermissionManage {
+		return cerror.ErrProtectedPermission
+	}
+
+	rez := s.db.
+		Unscoped().
+		Where("role = ? AND permission = ?", role, permission).
+		Delete(&model.RolePermission{})
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke %s from %s, error = %+v", permission, role, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	s.logger.Infof("Admin = %s revoked %s from %s", adminUuid, permission, role)
+	return s.Load()
+}
+
+// seed grants the permissions of every seed newer than the last applied one,
+// an empty database gets DefaultRolePermissions
+func (s *PermissionService) seed() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var applied int
+		if err := tx.
+			Model(&model.AppliedPermissionSeed{}).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&applied).
+			Error; err != nil {
+			s.logger.Errorf("Failed to query applied permission seeds, error = %+v", err)
+			return err
+		}
+
+		if applied == 0 {
+			var count int64
+			if err := tx.Model(&model.RolePermission{}).Count(&count).Error; err != nil {
+				s.logger.Errorf("Failed to count role permissions, error = %+v", err)
+				return err
+			}
+			if count == 0 {
+				s.logger.Infof("No role permissions found, seeding defaults")
+				if err := s.grantSeed(tx, model.DefaultRolePermissions); err != nil {
+					return err
+				}
+				return s.recordSeed(tx, model.LatestPermissionSeed())
+			}
+
+			// NOTE: databases seeded before seeds were versioned have the first one
+			applied = 1
+		}
+
+		for _, seed := range model.PermissionSeeds {
+			if seed.Version <= applied {
+				continue
+			}
+
+			s.logger.Infof("Seeding permissions of version %d", seed.Version)
+			if err := s.grantSeed(tx, seed.Grants); err != nil {
+				return err
+			}
+			if err := s.recordSeed(tx, seed.Version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PermissionService) grantSeed(tx *gorm.DB, grants map[model.UserRole][]model.Permission) error {
+	for _, role := range model.Roles {
+		for _, permission := range grants[role] {
+			// NOTE: another instance may be seeding at the same time
+			if err := tx.
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&model.RolePermission{Role: role, Permission: permission}).
+				Error; err != nil {
+				s.logger.Errorf("Failed to seed %s for %s, error = %+v", permission, role, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *PermissionService) recordSeed(tx *gorm.DB, version int) error {
+	if err := tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.AppliedPermissionSeed{Version: version}).
+		Error; err != nil {
+		s.logger.Errorf("Failed to record permission seed %d, error = %+v", version, err)
+		return err
+	}
+	return nil
+}
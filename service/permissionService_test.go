@@ -0,0 +1,150 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type PermissionServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IPermissionService
+	admin   uuid.UUID
+}
+
+func (suite *PermissionServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:permissionservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewPermissionService()
+	suite.admin = uuid.New()
+}
+
+func (suite *PermissionServiceTestSuite) TearDownSuite() {
+	// Other suites expect the default permissions
+	auth.SetPermissionStore(auth.StaticPermissionStore(model.DefaultRolePermissions))
+
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *PermissionServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.RolePermission{}, &model.AppliedPermissionSeed{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+	suite.Require().NoError(suite.service.Load())
+}
+
+func TestPermissionServiceSuite(t *testing.T) {
+	suite.Run(t, new(PermissionServiceTestSuite))
+}
+
+func (suite *PermissionServiceTestSuite) TestLoad_SeedsDefaults() {
+	permissions, err := suite.service.GetAll()
+	suite.Require().NoError(err)
+
+	for _, role := range model.Roles {
+		assert.ElementsMatch(suite.T(), model.DefaultRolePermissions[role], permissions[role], "role %s", role)
+	}
+	assert.True(suite.T(), auth.HasPermissions(model.RoleHAK, model.PermVehicleRegister))
+	assert.False(suite.T(), auth.HasPermissions(model.RoleOsoba, model.PermVehicleRegister))
+}
+
+func (suite *PermissionServiceTestSuite) TestLoad_KeepsChanges() {
+	suite.Require().NoError(suite.service.Revoke(model.RoleHAK, model.PermUserReadOib, suite.admin))
+	suite.Require().NoError(suite.service.Load())
+
+	assert.False(suite.T(), auth.HasPermissions(model.RoleHAK, model.PermUserReadOib))
+}
+
+func (suite *PermissionServiceTestSuite) TestLoad_UpgradesSeeds() {
+	// a database seeded with the first defaults where an admin revoked one
+	for _, m := range []any{&model.RolePermission{}, &model.AppliedPermissionSeed{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+	added := map[model.UserRole]map[model.Permission]bool{}
+	for _, seed := range model.PermissionSeeds {
+		for role, permissions := range seed.Grants {
+			if added[role] == nil {
+				added[role] = map[model.Permission]bool{}
+			}
+			for _, permission := range permissions {
+				added[role][permission] = true
+			}
+		}
+	}
+	for role, permissions := range model.DefaultRolePermissions {
+		for _, permission := range permissions {
+			if added[role][permission] || (role == model.RoleHAK && permission == model.PermUserReadOib) {
+				continue
+			}
+			suite.Require().NoError(suite.db.Create(&model.RolePermission{Role: role, Permission: permission}).Error)
+		}
+	}
+
+	suite.Require().NoError(suite.service.Load())
+	assert.True(suite.T(), auth.HasPermissions(model.RoleSuperAdmin, model.PermUserExport))
+	assert.True(suite.T(), auth.HasPermissions(model.RoleFirma, model.PermOrgCreate))
+	assert.False(suite.T(), auth.HasPermissions(model.RoleHAK, model.PermUserReadOib))
+
+	// seeds are applied once
+	suite.Require().NoError(suite.service.Revoke(model.RoleSuperAdmin, model.PermUserExport, suite.admin))
+	suite.Require().NoError(suite.service.Load())
+	assert.False(suite.T(), auth.HasPermissions(model.RoleSuperAdmin, model.PermUserExport))
+}
+
+func (suite *PermissionServiceTestSuite) TestSeeds_MatchDefaults() {
+	for _, seed := range model.PermissionSeeds {
+		for role, permissions := range seed.Grants {
+			assert.Subset(suite.T(), model.DefaultRolePermissions[role], permissions, "seed %d, role %s", seed.Version, role)
+		}
+	}
+}
+
+func (suite *PermissionServiceTestSuite) TestGrantAndRevoke() {
+	suite.Require().NoError(suite.service.Grant(model.RoleOsoba, model.PermUserReadOib, suite.admin))
+	suite.Require().NoError(suite.service.Grant(model.RoleOsoba, model.PermUserReadOib, suite.admin))
+	assert.True(suite.T(), auth.HasPermissions(model.RoleOsoba, model.PermUserReadOib))
+
+	var count int64
+	suite.db.Model(&model.RolePermission{}).Where("role = ? AND permission = ?", model.RoleOsoba, model.PermUserReadOib).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+
+	suite.Require().NoError(suite.service.Revoke(model.RoleOsoba, model.PermUserReadOib, suite.admin))
+	assert.False(suite.T(), auth.HasPermissions(model.RoleOsoba, model.PermUserReadOib))
+
+	// Granting again after a revoke works with the unique index
+	suite.Require().NoError(suite.service.Grant(model.RoleOsoba, model.PermUserReadOib, suite.admin))
+	assert.True(suite.T(), auth.HasPermissions(model.RoleOsoba, model.PermUserReadOib))
+}
+
+func (suite *PermissionServiceTestSuite) TestRevoke_Errors() {
+	err := suite.service.Revoke(model.RoleOsoba, model.PermKeyManage, suite.admin)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+
+	err = suite.service.Revoke(model.RoleSuperAdmin, model.PermPermissionManage, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrProtectedPermission)
+	assert.True(suite.T(), auth.HasPermissions(model.RoleSuperAdmin, model.PermPermissionManage))
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxActivationAttempts is the number of failed guesses after which a code is revoked
+const maxActivationAttempts = 5
+
+type IPoliceCodeService interface {
+	// Issue generates a new activation code for an officer, the code is only returned here
+	Issue(officerUuid, adminUuid uuid.UUID) (string, *model.PoliceActivationCode, error)
+	// Set stores an activation code chosen by an admin
+	Set(officerUuid uuid.UUID, code string, adminUuid uuid.UUID) (*model.PoliceActivationCode, error)
+	// Revoke revokes the active code of an officer
+	Revoke(officerUuid, adminUuid uuid.UUID) error
+	// Redeem uses up a code and returns the officer it was issued to
+	Redeem(code string) (*model.User, error)
+	// GetStatuses returns the latest code of every given user id
+	GetStatuses(userIds []uint) (map[uint]model.PoliceActivationCode, error)
+	// ExpireCodes marks issued codes past their expiry as expired
+	ExpireCodes() (int64, error)
+}
+
+type PoliceCodeService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewPoliceCodeService() IPoliceCodeService {
+	var service IPoliceCodeService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &PoliceCodeService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Issue implements IPoliceCodeService.
+func (s *PoliceCodeService) Issue(officerUuid, adminUuid uuid.UUID) (string, *model.PoliceActivationCode, error) {
+	code, err := auth.GenerateActivationCode()
+	if err != nil {
+		s.logger.Errorf("Failed to generate activation code, error = %+v", err)
+		return "", nil, err
+	}
+
+	stored, err := s.store(officerUuid, code, &adminUuid)
+	if err != nil {
+		return "", nil, err
+	}
+	return code, stored, nil
+}
+
+// Set implements IPoliceCodeService.
+func (s *PoliceCodeService) Set(officerUuid uuid.UUID, code string, adminUuid uuid.UUID) (*model.PoliceActivationCode, error) {
+	if err := auth.ValidateActivationCode(code); err != nil {
+		return nil, err
+	}
+	return s.store(officerUuid, code, &adminUuid)
+}
+
+// Revoke implements IPoliceCodeService.
+func (s *PoliceCodeService) Revoke(officerUuid, adminUuid uuid.UUID) error {
+	officer, err := s.officer(officerUuid)
+	if err != nil {
+		return err
+	}
+
+	rez := s.revokeIssued(s.db, officer.ID, &adminUuid)
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke activation code of officer = %s, error = %+v", officerUuid, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return cerror.ErrNoActivationCode
+	}
+
+	s.logger.Infof("Admin = %s revoked activation code of officer = %s", adminUuid, officerUuid)
+	return nil
+}
+
+// Redeem implements IPoliceCodeService.
+func (s *PoliceCodeService) Redeem(code string) (*model.User, error) {
+	var codes []model.PoliceActivationCode
+	if err := s.db.
+		Where("lookup = ? AND status = ?", auth.ActivationCodeLookup(code), model.ActivationIssued).
+		Find(&codes).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query activation codes, error = %+v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	live := make([]model.PoliceActivationCode, 0, len(codes))
+	for _, stored := range codes {
+		if !stored.IsActive(now) {
+			s.expire(&stored, now)
+			continue
+		}
+		if auth.CheckActivationCode(code, stored.CodeHash) {
+			return s.redeem(&stored, now)
+		}
+		live = append(live, stored)
+	}
+
+	// NOTE: the guess can't be told apart from a typo, it counts against
+	// every code its lookup matched
+	for _, stored := range live {
+		s.recordAttempt(&stored, now)
+	}
+	return nil, cerror.ErrInvalidCredentials
+}
+
+// GetStatuses implements IPoliceCodeService.
+func (s *PoliceCodeService) GetStatuses(userIds []uint) (map[uint]model.PoliceActivationCode, error) {
+	statuses := map[uint]model.PoliceActivationCode{}
+	if len(userIds) == 0 {
+		return statuses, nil
+	}
+	if _, err := s.ExpireCodes(); err != nil {
+		return nil, err
+	}
+
+	var codes []model.PoliceActivationCode
+	if err := s.db.
+		Where("user_id IN ?", userIds).
+		Order("created_at DESC, id DESC").
+		Find(&codes).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query activation codes, error = %+v", err)
+		return nil, err
+	}
+
+	for _, code := range codes {
+		if _, ok := statuses[code.UserId]; !ok {
+			statuses[code.UserId] = code
+		}
+	}
+	return statuses, nil
+}
+
+// ExpireCodes implements IPoliceCodeService.
+func (s *PoliceCodeService) ExpireCodes() (int64, error) {
+	now := time.Now()
+	rez := s.db.
+		Model(&model.PoliceActivationCode{}).
+		Where("status = ? AND expires_at <= ?", model.ActivationIssued, now).
+		Updates(map[string]any{"status": model.ActivationExpired, "expired_at": now})
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to expire activation codes, error = %+v", rez.Error)
+		return 0, rez.Error
+	}
+	return rez.RowsAffected, nil
+}
+
+// store replaces the active code of an officer, only one code can be active
+func (s *PoliceCodeService) store(officerUuid uuid.UUID, code string, adminUuid *uuid.UUID) (*model.PoliceActivationCode, error) {
+	officer, err := s.officer(officerUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := newActivationCode(officer.ID, code, adminUuid)
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.revokeIssued(tx, officer.ID, adminUuid).Error; err != nil {
+			return err
+		}
+		return tx.Create(&stored).Error
+	}); err != nil {
+		s.logger.Errorf("Failed to store activation code of officer = %s, error = %+v", officerUuid, err)
+		return nil, err
+	}
+
+	s.logger.Infof("Activation code issued to officer = %s", officerUuid)
+	return &stored, nil
+}
+
+// newActivationCode returns an issued code for the user that expires after
+// the configured validity, only the hash of code is kept
+func newActivationCode(userId uint, code string, adminUuid *uuid.UUID) model.PoliceActivationCode {
+	return model.PoliceActivationCode{
+		Uuid:      uuid.New(),
+		UserId:    userId,
+		Lookup:    auth.ActivationCodeLookup(code),
+		CodeHash:  auth.HashActivationCode(code),
+		Status:    model.ActivationIssued,
+		IssuedBy:  adminUuid,
+		ExpiresAt: time.Now().Add(config.AppConfig.ActivationCodeValidity()),
+	}
+}
+
+func (s *PoliceCodeService) revokeIssued(tx *gorm.DB, userId uint, adminUuid *uuid.UUID) *gorm.DB {
+	return tx.
+		Model(&model.PoliceActivationCode{}).
+		Where("user_id = ? AND status = ?", userId, model.ActivationIssued).
+		Updates(map[string]any{
+			"status":     model.ActivationRevoked,
+			"revoked_at": time.Now(),
+			"revoked_by": adminUuid,
+		})
+}
+
+// redeem marks the code as used, the status condition makes sure two
+// concurrent registrations can't both use it
+func (s *PoliceCodeService) redeem(code *model.PoliceActivationCode, now time.Time) (*model.User, error) {
+	var officer model.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		rez := tx.
+			Model(&model.PoliceActivationCode{}).
+			Where("id = ? AND status = ?", code.ID, model.ActivationIssued).
+			Updates(map[string]any{"status": model.ActivationRedeemed, "redeemed_at": now})
+		if rez.Error != nil {
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return cerror.ErrInvalidCredentials
+		}
+
+		if err := tx.Where("id = ? AND role = ?", code.UserId, model.RolePolicija).First(&officer).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return cerror.ErrInvalidCredentials
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, cerror.ErrInvalidCredentials) {
+			s.logger.Errorf("Failed to redeem activation code = %s, error = %+v", code.Uuid, err)
+		}
+		return nil, err
+	}
+
+	s.logger.Infof("Activation code = %s redeemed by officer = %s", code.Uuid, officer.Uuid)
+	return &officer, nil
+}
+
+func (s *PoliceCodeService) expire(code *model.PoliceActivationCode, now time.Time) {
+	if err := s.db.
+		Model(&model.PoliceActivationCode{}).
+		Where("id = ? AND status = ?", code.ID, model.ActivationIssued).
+		Updates(map[string]any{"status": model.ActivationExpired, "expired_at": now}).
+		Error; err != nil {
+		s.logger.Errorf("Failed to expire activation code = %s, error = %+v", code.Uuid, err)
+	}
+}
+
+// recordAttempt counts a failed guess on the code row, the code is revoked
+// after too many. Counting in the database keeps concurrent guesses exact.
+func (s *PoliceCodeService) recordAttempt(code *model.PoliceActivationCode, now time.Time) {
+	if err := s.db.
+		Model(&model.PoliceActivationCode{}).
+		Where("id = ? AND status = ?", code.ID, model.ActivationIssued).
+		Update("attempts", gorm.Expr("attempts + 1")).
+		Error; err != nil {
+		s.logger.Errorf("Failed to count attempt on activation code = %s, error = %+v", code.Uuid, err)
+		return
+	}
+
+	rez := s.db.
+		Model(&model.PoliceActivationCode{}).
+		Where("id = ? AND status = ? AND attempts >= ?", code.ID, model.ActivationIssued, maxActivationAttempts).
+		Updates(map[string]any{"status": model.ActivationRevoked, "revoked_at": now})
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to revoke activation code = %s, error = %+v", code.Uuid, rez.Error)
+		return
+	}
+	if rez.RowsAffected > 0 {
+		s.logger.Warnf("Activation code = %s revoked after %d failed attempts", code.Uuid, maxActivationAttempts)
+	}
+}
+
+func (s *PoliceCodeService) officer(officerUuid uuid.UUID) (*model.User, error) {
+	var officer model.User
+	if err := s.db.Where("uuid = ?", officerUuid).First(&officer).Error; err != nil {
+		return nil, err
+	}
+	if officer.Role != model.RolePolicija {
+		return nil, cerror.ErrNotPoliceOfficer
+	}
+	return &officer, nil
+}
@@ -0,0 +1,213 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type PoliceCodeServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.IPoliceCodeService
+	officer *model.User
+	citizen *model.User
+	admin   uuid.UUID
+}
+
+func (suite *PoliceCodeServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:policecodeservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:               config.Dev,
+		RefreshKey:        "police-code-test-refresh-key",
+		ActivationCodeKey: "police-code-test-code-key",
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewPoliceCodeService()
+}
+
+func (suite *PoliceCodeServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *PoliceCodeServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.PoliceActivationCode{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+
+	suite.officer = suite.createUser("officer@example.com", "12345678921", model.RolePolicija)
+	suite.citizen = suite.createUser("citizen@example.com", "12345678922", model.RoleOsoba)
+	suite.admin = uuid.New()
+}
+
+func TestPoliceCodeServiceSuite(t *testing.T) {
+	suite.Run(t, new(PoliceCodeServiceTestSuite))
+}
+
+func (suite *PoliceCodeServiceTestSuite) createUser(email, oib string, role model.UserRole) *model.User {
+	user := &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Code",
+		LastName:     "User",
+		OIB:          oib,
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        email,
+		PasswordHash: "hash",
+		Role:         role,
+	}
+	suite.Require().NoError(suite.db.Create(user).Error)
+	return user
+}
+
+func (suite *PoliceCodeServiceTestSuite) latest() model.PoliceActivationCode {
+	statuses, err := suite.service.GetStatuses([]uint{suite.officer.ID})
+	suite.Require().NoError(err)
+	code, ok := statuses[suite.officer.ID]
+	suite.Require().True(ok)
+	return code
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestIssueStoresOnlyHash() {
+	code, stored, err := suite.service.Issue(suite.officer.Uuid, suite.admin)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), code, 12)
+
+	var row model.PoliceActivationCode
+	suite.Require().NoError(suite.db.First(&row, stored.ID).Error)
+	assert.NotContains(suite.T(), row.CodeHash, code)
+	assert.NotContains(suite.T(), row.Lookup, code[:4])
+	assert.Equal(suite.T(), auth.ActivationCodeLookup(code), row.Lookup)
+	assert.Equal(suite.T(), model.ActivationIssued, row.Status)
+	assert.Equal(suite.T(), suite.admin, *row.IssuedBy)
+	assert.WithinDuration(suite.T(), time.Now().Add(72*time.Hour), row.ExpiresAt, time.Minute)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestIssue_NotOfficer() {
+	_, _, err := suite.service.Issue(suite.citizen.Uuid, suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrNotPoliceOfficer)
+
+	_, _, err = suite.service.Issue(uuid.New(), suite.admin)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestRedeemIsSingleUse() {
+	code, _, err := suite.service.Issue(suite.officer.Uuid, suite.admin)
+	suite.Require().NoError(err)
+
+	officer, err := suite.service.Redeem(code)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.officer.Uuid, officer.Uuid)
+
+	_, err = suite.service.Redeem(code)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+
+	latest := suite.latest()
+	assert.Equal(suite.T(), model.ActivationRedeemed, latest.Status)
+	assert.NotNil(suite.T(), latest.RedeemedAt)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestNewCodeRevokesPrevious() {
+	first, _, err := suite.service.Issue(suite.officer.Uuid, suite.admin)
+	suite.Require().NoError(err)
+	_, err = suite.service.Set(suite.officer.Uuid, "CHOSENCODE1", suite.admin)
+	suite.Require().NoError(err)
+
+	_, err = suite.service.Redeem(first)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+
+	var revoked model.PoliceActivationCode
+	suite.Require().NoError(suite.db.Where("status = ?", model.ActivationRevoked).First(&revoked).Error)
+	assert.Equal(suite.T(), suite.admin, *revoked.RevokedBy)
+
+	officer, err := suite.service.Redeem("CHOSENCODE1")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.officer.ID, officer.ID)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestSet_TooShort() {
+	_, err := suite.service.Set(suite.officer.Uuid, "SHORT", suite.admin)
+	assert.ErrorIs(suite.T(), err, cerror.ErrWeakActivationCode)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestFailedAttemptsRevokeCode() {
+	code, _, err := suite.service.Issue(suite.officer.Uuid, suite.admin)
+	suite.Require().NoError(err)
+
+	guess := code[:4] + "00000000"
+	for i := 0; i < 4; i++ {
+		_, err = suite.service.Redeem(guess)
+		assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+	}
+	assert.Equal(suite.T(), 4, suite.latest().Attempts)
+	assert.Equal(suite.T(), model.ActivationIssued, suite.latest().Status)
+
+	// guesses aimed at other codes don't count
+	other := "22220000000"
+	if code[:4] == other[:4] {
+		other = "33330000000"
+	}
+	_, err = suite.service.Redeem(other)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+	assert.Equal(suite.T(), 4, suite.latest().Attempts)
+
+	_, err = suite.service.Redeem(guess)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+
+	// The right code no longer works after too many guesses
+	_, err = suite.service.Redeem(code)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+
+	latest := suite.latest()
+	assert.Equal(suite.T(), model.ActivationRevoked, latest.Status)
+	assert.Equal(suite.T(), 5, latest.Attempts)
+	assert.Nil(suite.T(), latest.RevokedBy)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestExpiredCode() {
+	code, stored, err := suite.service.Issue(suite.officer.Uuid, suite.admin)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Model(stored).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	_, err = suite.service.Redeem(code)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+
+	latest := suite.latest()
+	assert.Equal(suite.T(), model.ActivationExpired, latest.Status)
+	assert.NotNil(suite.T(), latest.ExpiredAt)
+}
+
+func (suite *PoliceCodeServiceTestSuite) TestRevoke() {
+	code, _, err := suite.service.Issue(suite.officer.Uuid, suite.admin)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.service.Revoke(suite.officer.Uuid, suite.admin))
+	assert.ErrorIs(suite.T(), suite.service.Revoke(suite.officer.Uuid, suite.admin), cerror.ErrNoActivationCode)
+
+	_, err = suite.service.Redeem(code)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidCredentials)
+	assert.Equal(suite.T(), model.ActivationRevoked, suite.latest().Status)
+}
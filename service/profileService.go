@@ -0,0 +1,216 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/mail"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const EmailChangeTokenDuration = 24 * time.Hour
+
+type IProfileService interface {
+	// UpdateMyData changes the fields users may change themselves. A new email
+	// needs the current password and is only mailed a confirmation code, it is
+	// returned as the pending email.
+	UpdateMyData(userUuid uuid.UUID, residence model.Address, email, currentPassword string) (*model.User, string, error)
+	// ConfirmEmail sets the email the code was mailed to
+	ConfirmEmail(token string) (*model.User, error)
+}
+
+type ProfileService struct {
+	db       *gorm.DB
+	logger   *zap.SugaredLogger
+	mailer   mail.Mailer
+	throttle ILoginThrottleService
+}
+
+func NewProfileService() IProfileService {
+	var service IProfileService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger, mailer mail.Mailer) {
+		service = &ProfileService{
+			db:       db,
+			logger:   logger,
+			mailer:   mailer,
+			throttle: NewLoginThrottleService(),
+		}
+	})
+
+	return service
+}
+
+// UpdateMyData implements IProfileService.
+func (s *ProfileService) UpdateMyData(userUuid uuid.UUID, residence model.Address, email, currentPassword string) (*model.User, string, error) {
+	var user model.User
+	if err := s.db.Where("uuid = ?", userUuid).First(&user).Error; err != nil {
+		return nil, "", err
+	}
+
+	emailChanged := !strings.EqualFold(user.Email, email)
+	if emailChanged {
+		if err := s.checkEmailChange(&user, email, currentPassword); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if user.Residence != residence {
+		user.Residence = residence
+		if err := s.db.Model(&user).Select(model.ResidenceColumns).Updates(&user).Error; err != nil {
+			return nil, "", err
+		}
+	}
+
+	if !emailChanged {
+		return &user, "", nil
+	}
+
+	// Every confirmation mail is counted so a session can't flood addresses
+	if err := s.throttle.Fail(EmailChangeKey(user.Uuid)); err != nil {
+		s.logger.Errorf("Failed to record email change, error = %+v", err)
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	stored := model.EmailChangeToken{
+		UserId:    user.ID,
+		NewEmail:  email,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: time.Now().Add(EmailChangeTokenDuration),
+	}
+	if err := s.db.Create(&stored).Error; err != nil {
+		return nil, "", err
+	}
+
+	if err := s.mailer.Send(mail.Message{
+		To:      email,
+		Subject: "ePrometna email confirmation",
+		Body:    emailChangeMailBody(token),
+	}); err != nil {
+		s.logger.Errorf("Failed to send email confirmation to user = %s, error = %+v", user.Uuid, err)
+		return nil, "", err
+	}
+
+	s.logger.Infof("Email change requested for user = %s", user.Uuid)
+	return &user, email, nil
+}
+
+// ConfirmEmail implements IProfileService.
+func (s *ProfileService) ConfirmEmail(token string) (*model.User, error) {
+	var stored model.EmailChangeToken
+	if err := s.db.Where("token_hash = ?", auth.HashOpaqueToken(token)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, cerror.ErrInvalidEmailToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !stored.IsActive(now) {
+		return nil, cerror.ErrInvalidEmailToken
+	}
+
+	var user model.User
+	var oldEmail string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// NOTE: conditional update so a token can't be used by two parallel requests
+		rez := tx.
+			Model(&model.EmailChangeToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", now)
+		if rez.Error != nil {
+			return rez.Error
+		}
+		if rez.RowsAffected == 0 {
+			return cerror.ErrInvalidEmailToken
+		}
+
+		if err := tx.First(&user, stored.UserId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return cerror.ErrInvalidEmailToken
+			}
+			return err
+		}
+		// The address could have been taken since the code was sent
+		if err := s.emailAvailable(tx, stored.NewEmail); err != nil {
+			return err
+		}
+		oldEmail = user.Email
+		if err := tx.Model(&user).Update("email", stored.NewEmail).Error; err != nil {
+			return err
+		}
+
+		// Codes sent to other addresses before are no longer valid
+		return tx.
+			Model(&model.EmailChangeToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the old address is told so a hijacked session can't quietly take the account
+	if err := s.mailer.Send(mail.Message{
+		To:      oldEmail,
+		Subject: "ePrometna email changed",
+		Body:    fmt.Sprintf("The email of your ePrometna account was changed to %s.\n", user.Email),
+	}); err != nil {
+		s.logger.Errorf("Failed to notify old email of user = %s, error = %+v", user.Uuid, err)
+	}
+
+	s.logger.Infof("Email change confirmed for user = %s", user.Uuid)
+	return &user, nil
+}
+
+// checkEmailChange checks the current password before a confirmation code is
+// mailed, a bearer token alone must not move the account to another address
+func (s *ProfileService) checkEmailChange(user *model.User, email, currentPassword string) error {
+	// NOTE: wrong passwords count as failed logins of the account
+	if err := s.throttle.Check(EmailKey(user.Email), EmailChangeKey(user.Uuid)); err != nil {
+		return err
+	}
+	if !auth.VerifyPassword(user.PasswordHash, currentPassword) {
+		s.logger.Debugf("Wrong password on email change of user = %s", user.Uuid)
+		if err := s.throttle.Fail(EmailKey(user.Email)); err != nil {
+			s.logger.Errorf("Failed to record failed attempt, error = %+v", err)
+		}
+		return cerror.ErrWrongPassword
+	}
+	return s.emailAvailable(s.db, email)
+}
+
+func (s *ProfileService) emailAvailable(tx *gorm.DB, email string) error {
+	var taken int64
+	if err := tx.Model(&model.User{}).Where("lower(email) = ?", strings.ToLower(email)).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return cerror.ErrEmailTaken
+	}
+	return nil
+}
+
+func emailChangeMailBody(token string) string {
+	body := fmt.Sprintf("Confirm this address for your ePrometna account.\n\n"+
+		"Confirmation code: %s\n\n", token)
+	if config.AppConfig.AppUrl != "" {
+		body += fmt.Sprintf("Or open: %s/confirm-email?token=%s\n\n", config.AppConfig.AppUrl, url.QueryEscape(token))
+	}
+	body += fmt.Sprintf("The code expires in %d hours. If you didn't change your email, ignore this message.\n",
+		int(EmailChangeTokenDuration.Hours()))
+	return body
+}
@@ -0,0 +1,193 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type ProfileServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	outbox  service.IOutboxService
+	service service.IProfileService
+	user    *model.User
+}
+
+func (suite *ProfileServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:profileservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{Env: config.Dev, AppUrl: "https://eprometna.example.com"}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	app.Provide(service.NewOutboxService)
+	app.Provide(service.NewMailer)
+	suite.outbox = service.NewOutboxService()
+	suite.service = service.NewProfileService()
+}
+
+func (suite *ProfileServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *ProfileServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.EmailChangeToken{}, &model.OutboxMessage{}, &model.LoginThrottle{}, &model.LockEvent{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+
+	hash, err := auth.HashPassword(profilePassword)
+	suite.Require().NoError(err)
+	suite.user = &model.User{
+		Uuid:         uuid.New(),
+		FirstName:    "Profile",
+		LastName:     "User",
+		OIB:          "12345678903",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+		BirthDate:    time.Now().AddDate(-30, 0, 0),
+		Email:        "profile@example.com",
+		PasswordHash: hash,
+		Role:         model.RoleOsoba,
+	}
+	suite.Require().NoError(suite.db.Create(suite.user).Error)
+}
+
+func TestProfileServiceSuite(t *testing.T) {
+	suite.Run(t, new(ProfileServiceTestSuite))
+}
+
+var emailCodePattern = regexp.MustCompile(`Confirmation code: (\S+)`)
+
+const profilePassword = "profilePassword1"
+
+// requestChange changes the email and reads the code from the mail sent to it
+func (suite *ProfileServiceTestSuite) requestChange(email string) string {
+	_, pending, err := suite.service.UpdateMyData(suite.user.Uuid, suite.user.Residence, email, profilePassword)
+	suite.Require().NoError(err)
+	suite.Require().Equal(email, pending)
+
+	messages, err := suite.outbox.GetForRecipient(email)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(messages)
+	match := emailCodePattern.FindStringSubmatch(messages[0].Body)
+	suite.Require().Len(match, 2)
+	return match[1]
+}
+
+func (suite *ProfileServiceTestSuite) TestUpdateMyData_ResidenceOnly() {
+	split := model.Address{Street: "Riva", HouseNumber: "10", PostalCode: "21000", Settlement: "Split", County: "Splitsko-dalmatinska"}
+	user, pending, err := suite.service.UpdateMyData(suite.user.Uuid, split, "Profile@Example.com", "")
+	suite.Require().NoError(err)
+
+	assert.Empty(suite.T(), pending)
+	assert.Equal(suite.T(), split, user.Residence)
+	var stored model.User
+	suite.Require().NoError(suite.db.Where("uuid = ?", suite.user.Uuid).First(&stored).Error)
+	assert.Equal(suite.T(), split, stored.Residence)
+	assert.Equal(suite.T(), "profile@example.com", user.Email)
+	var count int64
+	suite.db.Model(&model.OutboxMessage{}).Count(&count)
+	assert.Zero(suite.T(), count)
+}
+
+func (suite *ProfileServiceTestSuite) TestUpdateMyData_WrongPassword() {
+	split := model.Address{Street: "Riva", HouseNumber: "10", PostalCode: "21000", Settlement: "Split"}
+	for _, password := range []string{"", "wrongPassword1"} {
+		_, _, err := suite.service.UpdateMyData(suite.user.Uuid, split, "new@example.com", password)
+		assert.ErrorIs(suite.T(), err, cerror.ErrWrongPassword)
+	}
+
+	// Nothing is changed or mailed
+	var stored model.User
+	suite.Require().NoError(suite.db.First(&stored, suite.user.ID).Error)
+	assert.Equal(suite.T(), suite.user.Residence, stored.Residence)
+	var count int64
+	suite.db.Model(&model.OutboxMessage{}).Count(&count)
+	assert.Zero(suite.T(), count)
+
+	// Guesses count as failed logins of the account
+	var throttle model.LoginThrottle
+	suite.Require().NoError(suite.db.Where("scope = ? AND key = ?", model.ThrottleScopeEmail, suite.user.Email).First(&throttle).Error)
+	assert.Equal(suite.T(), 2, throttle.Failures)
+}
+
+func (suite *ProfileServiceTestSuite) TestUpdateMyData_MailsAreThrottled() {
+	policy := service.ThrottlePolicies[model.ThrottleScopeEmailChange]
+	for i := range policy.FreeAttempts + 1 {
+		suite.requestChange(fmt.Sprintf("new%d@example.com", i))
+	}
+
+	_, _, err := suite.service.UpdateMyData(suite.user.Uuid, suite.user.Residence, "one.more@example.com", profilePassword)
+	assert.ErrorIs(suite.T(), err, cerror.ErrTooManyAttempts)
+	messages, err := suite.outbox.GetForRecipient("one.more@example.com")
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), messages)
+}
+
+func (suite *ProfileServiceTestSuite) TestConfirmEmail() {
+	token := suite.requestChange("new@example.com")
+
+	// the email doesn't change before it is confirmed
+	var stored model.User
+	suite.Require().NoError(suite.db.First(&stored, suite.user.ID).Error)
+	assert.Equal(suite.T(), "profile@example.com", stored.Email)
+
+	user, err := suite.service.ConfirmEmail(token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "new@example.com", user.Email)
+
+	notices, err := suite.outbox.GetForRecipient("profile@example.com")
+	suite.Require().NoError(err)
+	suite.Require().Len(notices, 1)
+	assert.Contains(suite.T(), notices[0].Body, "new@example.com")
+
+	_, err = suite.service.ConfirmEmail(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidEmailToken)
+}
+
+func (suite *ProfileServiceTestSuite) TestConfirmEmail_Taken() {
+	token := suite.requestChange("taken@example.com")
+	suite.Require().NoError(suite.db.Create(&model.User{
+		Uuid: uuid.New(), OIB: "69435151530", Email: "taken@example.com", Role: model.RoleOsoba,
+	}).Error)
+
+	_, err := suite.service.ConfirmEmail(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrEmailTaken)
+
+	_, _, err = suite.service.UpdateMyData(suite.user.Uuid, suite.user.Residence, "taken@example.com", profilePassword)
+	assert.ErrorIs(suite.T(), err, cerror.ErrEmailTaken)
+}
+
+func (suite *ProfileServiceTestSuite) TestConfirmEmail_Expired() {
+	token := suite.requestChange("late@example.com")
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).
+		Model(&model.EmailChangeToken{}).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	_, err := suite.service.ConfirmEmail(token)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidEmailToken)
+	_, err = suite.service.ConfirmEmail("unknown")
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidEmailToken)
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ISigningKeyService interface {
+	// Load installs keys from the database into the auth keyring,
+	// a first key is generated if there is none
+	Load() error
+	// Rotate generates a new signing key that signs once cached key sets have
+	// it, older keys keep verifying tokens
+	Rotate() (*model.SigningKey, error)
+	// Retire stops accepting tokens signed with the key
+	Retire(kid string) error
+	// GetAll returns all keys that are not retired, newest first
+	GetAll() ([]model.SigningKey, error)
+}
+
+type SigningKeyService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewSigningKeyService() ISigningKeyService {
+	var service ISigningKeyService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &SigningKeyService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Load implements ISigningKeyService.
+func (s *SigningKeyService) Load() error {
+	keys, err := s.GetAll()
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		s.logger.Infof("No signing keys found, generating one")
+		// NOTE: no verifier has cached a key set yet, the first key signs right away
+		_, err := s.create(time.Now())
+		return err
+	}
+
+	parsed := make([]*auth.SigningKey, 0, len(keys))
+	for i := range keys {
+		key := &keys[i]
+		private, err := auth.OpenPrivateKey(key.Kid, key.PrivateKey)
+		if err != nil {
+			s.logger.Errorf("Failed to decrypt signing key kid = %s, error = %+v", key.Kid, err)
+			return err
+		}
+		if !auth.IsSealed(key.PrivateKey) {
+			s.seal(key, private)
+		}
+
+		signingKey, err := auth.ParseSigningKey(key.Kid, key.Algorithm, private, key.PublicKey)
+		if err != nil {
+			s.logger.Errorf("Failed to parse signing key kid = %s, error = %+v", key.Kid, err)
+			return err
+		}
+		parsed = append(parsed, signingKey)
+	}
+
+	signing := model.CurrentSigningKey(keys, time.Now())
+	if signing == nil {
+		// Only keys waiting to sign are left, the oldest was published first
+		signing = &keys[len(keys)-1]
+	}
+	keyring, err := auth.NewKeyring(signing.Kid, parsed...)
+	if err != nil {
+		return err
+	}
+
+	// Retired keys count too, HS256 tokens were no longer issued once the first key existed
+	var first model.SigningKey
+	if err := s.db.Unscoped().Select("created_at").Order("created_at").First(&first).Error; err != nil {
+		s.logger.Errorf("Failed to query first signing key, error = %+v", err)
+		return err
+	}
+	keyring.WithLegacyCutoff(first.CreatedAt)
+
+	auth.SetKeyring(keyring)
+	s.logger.Debugf("Loaded %d signing keys, signing with kid = %s", len(parsed), keyring.SigningKid())
+	return nil
+}
+
+// Rotate implements ISigningKeyService.
+func (s *SigningKeyService) Rotate() (*model.SigningKey, error) {
+	// NOTE: verifiers cache the key set, a token signed with a key missing
+	// from their copy would be rejected until it expires
+	return s.create(time.Now().Add(auth.JwksMaxAge))
+}
+
+// create generates and stores a key pair that signs from activeAt
+func (s *SigningKeyService) create(activeAt time.Time) (*model.SigningKey, error) {
+	private, public, err := auth.GenerateKeyPair(config.AppConfig.JwtAlgorithm)
+	if err != nil {
+		s.logger.Errorf("Failed to generate signing key, error = %+v", err)
+		return nil, err
+	}
+
+	kid := uuid.NewString()
+	sealed, err := auth.SealPrivateKey(kid, private)
+	if err != nil {
+		s.logger.Errorf("Failed to encrypt signing key, error = %+v", err)
+		return nil, err
+	}
+
+	key := model.SigningKey{
+		Kid:        kid,
+		Algorithm:  config.AppConfig.JwtAlgorithm,
+		PrivateKey: sealed,
+		PublicKey:  public,
+		ActiveAt:   &activeAt,
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		s.logger.Errorf("Failed to store signing key, error = %+v", err)
+		return nil, err
+	}
+
+	s.logger.Infof("Created signing key kid = %s, algorithm = %s, signing from %s", key.Kid, key.Algorithm, activeAt)
+	return &key, s.Load()
+}
+
+// seal encrypts a private key stored before keys were encrypted, an error is
+// only logged since the key can still be used
+func (s *SigningKeyService) seal(key *model.SigningKey, private string) {
+	sealed, err := auth.SealPrivateKey(key.Kid, private)
+	if err != nil {
+		s.logger.Errorf("Failed to encrypt signing key kid = %s, error = %+v", key.Kid, err)
+		return
+	}
+
+	// The condition keeps instances loading at the same time from sealing twice
+	if err := s.db.
+		Model(&model.SigningKey{}).
+		Where("id = ? AND private_key = ?", key.ID, key.PrivateKey).
+		Update("private_key", sealed).
+		Error; err != nil {
+		s.logger.Errorf("Failed to store encrypted signing key kid = %s, error = %+v", key.Kid, err)
+		return
+	}
+
+	s.logger.Infof("Encrypted stored signing key kid = %s", key.Kid)
+}
+
+// Retire implements ISigningKeyService.
+func (s *SigningKeyService) Retire(kid string) error {
+	keys, err := s.GetAll()
+	if err != nil {
+		return err
+	}
+	if current := model.CurrentSigningKey(keys, time.Now()); current != nil && current.Kid == kid {
+		return cerror.ErrSigningKeyInUse
+	}
+
+	rez := s.db.
+		Model(&model.SigningKey{}).
+		Where("kid = ? AND retired_at IS NULL", kid).
+		Update("retired_at", time.Now())
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to retire signing key kid = %s, error = %+v", kid, rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	s.logger.Infof("Retired signing key kid = %s", kid)
+	return s.Load()
+}
+
+// GetAll implements ISigningKeyService.
+func (s *SigningKeyService) GetAll() ([]model.SigningKey, error) {
+	var keys []model.SigningKey
+	if err := s.db.
+		Where("retired_at IS NULL").
+		Order("id DESC").
+		Find(&keys).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query signing keys, error = %+v", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
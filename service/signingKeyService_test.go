@@ -0,0 +1,168 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type SigningKeyServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.ISigningKeyService
+	user    *model.User
+}
+
+func (suite *SigningKeyServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:signingkey_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:          config.Dev,
+		AccessKey:    "signing-key-test-access-key",
+		RefreshKey:   "signing-key-test-refresh-key",
+		JwtAlgorithm: auth.AlgEdDSA,
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewSigningKeyService()
+	suite.user = &model.User{Uuid: uuid.New(), Email: "keys@example.com", Role: model.RoleOsoba}
+}
+
+func (suite *SigningKeyServiceTestSuite) TearDownSuite() {
+	auth.SetKeyring(nil)
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *SigningKeyServiceTestSuite) SetupTest() {
+	suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.SigningKey{})
+	auth.SetKeyring(nil)
+}
+
+func TestSigningKeyServiceSuite(t *testing.T) {
+	suite.Run(t, new(SigningKeyServiceTestSuite))
+}
+
+func (suite *SigningKeyServiceTestSuite) TestLoad_GeneratesFirstKey() {
+	suite.Require().NoError(suite.service.Load())
+
+	keys, err := suite.service.GetAll()
+	suite.Require().NoError(err)
+	suite.Require().Len(keys, 1)
+	assert.Equal(suite.T(), auth.AlgEdDSA, keys[0].Algorithm)
+	suite.Require().NotNil(auth.CurrentKeyring())
+	assert.Equal(suite.T(), keys[0].Kid, auth.CurrentKeyring().SigningKid())
+
+	// Loading again reuses the stored key
+	suite.Require().NoError(suite.service.Load())
+	keys, _ = suite.service.GetAll()
+	assert.Len(suite.T(), keys, 1)
+}
+
+// activate makes a rotated key sign as if cached key sets had expired
+func (suite *SigningKeyServiceTestSuite) activate(key *model.SigningKey) {
+	suite.Require().NoError(suite.db.
+		Model(&model.SigningKey{}).
+		Where("kid = ?", key.Kid).
+		Update("active_at", time.Now().Add(-time.Second)).
+		Error)
+	suite.Require().NoError(suite.service.Load())
+}
+
+func (suite *SigningKeyServiceTestSuite) TestRotate_OldTokensStayValid() {
+	suite.Require().NoError(suite.service.Load())
+	oldToken, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+	oldKid := auth.CurrentKeyring().SigningKid()
+
+	newKey, err := suite.service.Rotate()
+	suite.Require().NoError(err)
+	assert.NotEqual(suite.T(), oldKid, newKey.Kid)
+
+	// The new key is published but only signs once cached key sets have it
+	assert.Equal(suite.T(), oldKid, auth.CurrentKeyring().SigningKid())
+	assert.Len(suite.T(), auth.CurrentKeyring().JWKS().Keys, 2)
+	suite.Require().NotNil(newKey.ActiveAt)
+	assert.WithinDuration(suite.T(), time.Now().Add(auth.JwksMaxAge), *newKey.ActiveAt, time.Minute)
+
+	suite.activate(newKey)
+	assert.Equal(suite.T(), newKey.Kid, auth.CurrentKeyring().SigningKid())
+
+	_, _, err = auth.ParseToken("Bearer " + oldToken)
+	assert.NoError(suite.T(), err)
+
+	newToken, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+	token, _, err := auth.ParseToken("Bearer " + newToken)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), newKey.Kid, token.Header["kid"])
+	assert.Len(suite.T(), auth.CurrentKeyring().JWKS().Keys, 2)
+}
+
+func (suite *SigningKeyServiceTestSuite) TestRetire() {
+	suite.Require().NoError(suite.service.Load())
+	oldToken, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+	oldKid := auth.CurrentKeyring().SigningKid()
+
+	newKey, err := suite.service.Rotate()
+	suite.Require().NoError(err)
+
+	// The old key signs until the new one is active
+	assert.ErrorIs(suite.T(), suite.service.Retire(oldKid), cerror.ErrSigningKeyInUse)
+	suite.activate(newKey)
+
+	assert.ErrorIs(suite.T(), suite.service.Retire(newKey.Kid), cerror.ErrSigningKeyInUse)
+	assert.ErrorIs(suite.T(), suite.service.Retire("unknown"), gorm.ErrRecordNotFound)
+
+	suite.Require().NoError(suite.service.Retire(oldKid))
+	_, _, err = auth.ParseToken("Bearer " + oldToken)
+	assert.Error(suite.T(), err)
+
+	keys, err := suite.service.GetAll()
+	suite.Require().NoError(err)
+	suite.Require().Len(keys, 1)
+	assert.Equal(suite.T(), newKey.Kid, keys[0].Kid)
+}
+
+func (suite *SigningKeyServiceTestSuite) TestPrivateKeysAreEncrypted() {
+	suite.Require().NoError(suite.service.Load())
+	token, _, err := auth.GenerateTokens(suite.user)
+	suite.Require().NoError(err)
+
+	var key model.SigningKey
+	suite.Require().NoError(suite.db.First(&key).Error)
+	assert.True(suite.T(), auth.IsSealed(key.PrivateKey))
+	assert.NotContains(suite.T(), key.PrivateKey, "PRIVATE KEY")
+
+	// Keys stored before they were encrypted are encrypted when loaded
+	private, err := auth.OpenPrivateKey(key.Kid, key.PrivateKey)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Model(&key).Update("private_key", private).Error)
+	suite.Require().NoError(suite.service.Load())
+
+	suite.Require().NoError(suite.db.First(&key, key.ID).Error)
+	assert.True(suite.T(), auth.IsSealed(key.PrivateKey))
+	_, _, err = auth.ParseToken("Bearer " + token)
+	assert.NoError(suite.T(), err)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// revocationLoadMargin is how far back a reload looks before the previous one
+const revocationLoadMargin = time.Minute
+
+type ITokenRevocationService interface {
+	auth.RevocationStore
+	// Load fills the in memory cache with entries stored in the database, later
+	// calls add the entries stored since by other instances
+	Load() error
+	// Cleanup removes entries that can no longer match a valid token
+	Cleanup() error
+}
+
+// TokenRevocationService is a RevocationStore that keeps entries in the database
+// and answers IsRevoked from an in memory cache so Protect does not hit the database
+type TokenRevocationService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+	cache  *auth.MemoryRevocationStore
+
+	loadMutex sync.Mutex
+	// loadedAt is when the last Load started, zero before the first one
+	loadedAt time.Time
+}
+
+func NewTokenRevocationService() ITokenRevocationService {
+	var service ITokenRevocationService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &TokenRevocationService{
+			db:     db,
+			logger: logger,
+			cache:  auth.NewMemoryRevocationStore(),
+		}
+	})
+
+	return service
+}
+
+// RevokeToken implements ITokenRevocationService.
+func (s *TokenRevocationService) RevokeToken(jti string, until time.Time) error {
+	entry := model.RevokedToken{}
+	if err := s.db.
+		Where("jti = ?", jti).
+		Assign(model.RevokedToken{ExpiresAt: until}).
+		FirstOrCreate(&entry, model.RevokedToken{Jti: &jti}).
+		Error; err != nil {
+		s.logger.Errorf("Failed to revoke token jti = %s, error = %+v", jti, err)
+		return err
+	}
+
+	s.logger.Debugf("Revoked token jti = %s until %s", jti, until)
+	return s.cache.RevokeToken(jti, until)
+}
+
+// RevokeUser implements ITokenRevocationService.
+func (s *TokenRevocationService) RevokeUser(userUuid string, issuedBefore time.Time) error {
+	_uuid, err := uuid.Parse(userUuid)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: tokens carry their issue time in milliseconds, see auth.Claims
+	issuedBefore = issuedBefore.Truncate(time.Millisecond)
+	entry := model.RevokedToken{}
+	if err := s.db.
+		Where("user_uuid = ?", _uuid).
+		Assign(model.RevokedToken{
+			IssuedBefore: &issuedBefore,
+			ExpiresAt:    issuedBefore.Add(auth.MaxTokenDuration),
+		}).
+		FirstOrCreate(&entry, model.RevokedToken{UserUuid: &_uuid}).
+		Error; err != nil {
+		s.logger.Errorf("Failed to revoke tokens of user = %s, error = %+v", userUuid, err)
+		return err
+	}
+
+	s.logger.Infof("Revoked all tokens of user = %s issued before %s", userUuid, issuedBefore)
+	return s.cache.RevokeUser(userUuid, issuedBefore)
+}
+
+// IsRevoked implements ITokenRevocationService.
+func (s *TokenRevocationService) IsRevoked(claims *auth.Claims) bool {
+	return s.cache.IsRevoked(claims)
+}
+
+// Load implements ITokenRevocationService.
+func (s *TokenRevocationService) Load() error {
+	s.loadMutex.Lock()
+	defer s.loadMutex.Unlock()
+
+	now := time.Now()
+	query := s.db.Where("expires_at > ?", now)
+	if !s.loadedAt.IsZero() {
+		// NOTE: the margin covers clock skew between instances and entries
+		// committed after the last load started, loading one twice is harmless
+		query = query.Where("updated_at > ?", s.loadedAt.Add(-revocationLoadMargin))
+	}
+
+	var entries []model.RevokedToken
+	if err := query.Find(&entries).Error; err != nil {
+		s.logger.Errorf("Failed to load revoked tokens, error = %+v", err)
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Jti != nil {
+			_ = s.cache.RevokeToken(*entry.Jti, entry.ExpiresAt)
+		}
+		if entry.UserUuid != nil && entry.IssuedBefore != nil {
+			_ = s.cache.RevokeUser(entry.UserUuid.String(), *entry.IssuedBefore)
+		}
+	}
+
+	if s.loadedAt.IsZero() {
+		s.logger.Infof("Loaded %d revoked token entries", len(entries))
+	} else {
+		s.logger.Debugf("Reloaded %d revoked token entries", len(entries))
+	}
+	s.loadedAt = now
+	return nil
+}
+
+// Cleanup implements ITokenRevocationService.
+func (s *TokenRevocationService) Cleanup() error {
+	now := time.Now()
+	rez := s.db.
+		Unscoped().
+		Where("expires_at <= ?", now).
+		Delete(&model.RevokedToken{})
+	if rez.Error != nil {
+		s.logger.Errorf("Failed to clean up revoked tokens, error = %+v", rez.Error)
+		return rez.Error
+	}
+
+	s.cache.Cleanup(now)
+	s.logger.Debugf("Removed %d expired revoked token entries", rez.RowsAffected)
+	return nil
+}
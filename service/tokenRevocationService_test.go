@@ -0,0 +1,123 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/auth"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type TokenRevocationServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service service.ITokenRevocationService
+}
+
+func (suite *TokenRevocationServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:tokenrevocation_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewTokenRevocationService()
+}
+
+func (suite *TokenRevocationServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *TokenRevocationServiceTestSuite) SetupTest() {
+	suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&model.RevokedToken{})
+}
+
+func TestTokenRevocationServiceSuite(t *testing.T) {
+	suite.Run(t, new(TokenRevocationServiceTestSuite))
+}
+
+func revocationClaims(userUuid, jti string, issuedAt time.Time) *auth.Claims {
+	return &auth.Claims{
+		Uuid: userUuid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       jti,
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+		},
+	}
+}
+
+func (suite *TokenRevocationServiceTestSuite) TestRevokedEntriesSurviveRestart() {
+	userUuid := uuid.NewString()
+	jti := uuid.NewString()
+	issuedAt := time.Now().Add(-time.Hour)
+
+	suite.Require().NoError(suite.service.RevokeToken(jti, time.Now().Add(time.Hour)))
+	suite.Require().NoError(suite.service.RevokeUser(userUuid, time.Now()))
+	// Revoking twice updates the existing entries
+	suite.Require().NoError(suite.service.RevokeToken(jti, time.Now().Add(2*time.Hour)))
+	suite.Require().NoError(suite.service.RevokeUser(userUuid, time.Now()))
+
+	var count int64
+	suite.db.Model(&model.RevokedToken{}).Count(&count)
+	assert.Equal(suite.T(), int64(2), count)
+
+	// Fresh instance only knows what is in the database
+	restarted := service.NewTokenRevocationService()
+	assert.False(suite.T(), restarted.IsRevoked(revocationClaims(uuid.NewString(), jti, issuedAt)))
+	suite.Require().NoError(restarted.Load())
+
+	assert.True(suite.T(), restarted.IsRevoked(revocationClaims(uuid.NewString(), jti, issuedAt)))
+	assert.True(suite.T(), restarted.IsRevoked(revocationClaims(userUuid, uuid.NewString(), issuedAt)))
+	assert.False(suite.T(), restarted.IsRevoked(revocationClaims(userUuid, uuid.NewString(), time.Now().Add(time.Minute))))
+}
+
+func (suite *TokenRevocationServiceTestSuite) TestLoadPicksUpOtherInstances() {
+	other := service.NewTokenRevocationService()
+	suite.Require().NoError(other.Load())
+
+	userUuid := uuid.NewString()
+	jti := uuid.NewString()
+	issuedAt := time.Now().Add(-time.Hour)
+	suite.Require().NoError(suite.service.RevokeToken(jti, time.Now().Add(time.Hour)))
+	suite.Require().NoError(suite.service.RevokeUser(userUuid, time.Now()))
+	assert.False(suite.T(), other.IsRevoked(revocationClaims(uuid.NewString(), jti, issuedAt)))
+
+	suite.Require().NoError(other.Load())
+	assert.True(suite.T(), other.IsRevoked(revocationClaims(uuid.NewString(), jti, issuedAt)))
+	assert.True(suite.T(), other.IsRevoked(revocationClaims(userUuid, uuid.NewString(), issuedAt)))
+}
+
+func (suite *TokenRevocationServiceTestSuite) TestCleanupRemovesExpired() {
+	expired := uuid.NewString()
+	active := uuid.NewString()
+	suite.Require().NoError(suite.service.RevokeToken(expired, time.Now().Add(-time.Minute)))
+	suite.Require().NoError(suite.service.RevokeToken(active, time.Now().Add(time.Hour)))
+
+	suite.Require().NoError(suite.service.Cleanup())
+
+	var entries []model.RevokedToken
+	suite.Require().NoError(suite.db.Find(&entries).Error)
+	suite.Require().Len(entries, 1)
+	assert.Equal(suite.T(), active, *entries[0].Jti)
+	assert.False(suite.T(), suite.service.IsRevoked(revocationClaims(uuid.NewString(), expired, time.Now())))
+	assert.True(suite.T(), suite.service.IsRevoked(revocationClaims(uuid.NewString(), active, time.Now())))
+}
+
+func (suite *TokenRevocationServiceTestSuite) TestRevokeUser_BadUuid() {
+	assert.Error(suite.T(), suite.service.RevokeUser("not-a-uuid", time.Now()))
+}
@@ -4,12 +4,12 @@ import (
 	"ePrometna_Server/app"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/device"
+	"ePrometna_Server/util/paging"
+	"ePrometna_Server/util/search"
 	"fmt"
-	"sort"
 	"strings"
-	"time"
-
-	"github.com/xrash/smetrics"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -21,20 +21,67 @@ type IUserCrudService interface {
 	Read(uuid uuid.UUID) (*model.User, error)
 	ReadAll() ([]model.User, error)
 	Update(uuid uuid.UUID, user *model.User) (*model.User, error)
-	Delete(uuid uuid.UUID) error
-	GetAllUsers() ([]model.User, error)
-	GetAllPoliceOfficers() ([]model.User, error)
-	SearchUsersByName(query string) ([]model.User, error)
+	GetAllUsers(params *paging.Params) ([]model.User, *paging.Page, error)
+	GetAllPoliceOfficers(params *paging.Params) ([]model.User, *paging.Page, error)
+	// SearchUsers finds users similar to the query ordered by their score
+	SearchUsers(query string, field UserSearchField, params *paging.Params) ([]UserWithScore, *paging.Page, error)
 	GetUserByOIB(oib string) (*model.User, error)
 	GetUserDevice(userId uint) (*model.Mobile, error)
 	DeleteUserDevice(userUUID uuid.UUID) error
 }
 
+// UserListSpec is the list contract of users
+var UserListSpec = paging.Spec{
+	Fields: map[string]paging.Field{
+		"firstName": {Column: "users.first_name", Sortable: true, Filter: paging.FilterText},
+		"lastName":  {Column: "users.last_name", Sortable: true, Filter: paging.FilterText},
+		"email":     {Column: "users.email", Sortable: true, Filter: paging.FilterText},
+		"oib":       {Column: "users.oib", Filter: paging.FilterExact},
+		"role":      {Column: "users.role", Sortable: true, Filter: paging.FilterExact},
+		"birthDate": {Column: "users.birth_date", Sortable: true, Filter: paging.FilterRange},
+		"createdAt": {Column: "users.created_at", Sortable: true, Filter: paging.FilterRange},
+	},
+	DefaultSort: []string{"lastName", "firstName"},
+}
+
+// PoliceOfficerListSpec is the list contract of police officers
+var PoliceOfficerListSpec = paging.Spec{
+	Fields: map[string]paging.Field{
+		"firstName": {Column: "users.first_name", Sortable: true, Filter: paging.FilterText},
+		"lastName":  {Column: "users.last_name", Sortable: true, Filter: paging.FilterText},
+		"email":     {Column: "users.email", Sortable: true, Filter: paging.FilterText},
+		"createdAt": {Column: "users.created_at", Sortable: true, Filter: paging.FilterRange},
+	},
+	DefaultSort: []string{"lastName", "firstName"},
+}
+
+// UserSearchField limits a user search to one field
+type UserSearchField string
+
+const (
+	// SearchAll searches names, emails and residences, or OIB prefixes if the
+	// query is a number
+	SearchAll       UserSearchField = ""
+	SearchName      UserSearchField = "name"
+	SearchOib       UserSearchField = "oib"
+	SearchEmail     UserSearchField = "email"
+	SearchResidence UserSearchField = "residence"
+)
+
+// UserSearchSpec is the list contract of the user search, results are ordered
+// by score and paged by offset
+var UserSearchSpec = paging.Spec{
+	Fields: map[string]paging.Field{},
+	Params: []string{"query", "field"},
+}
+
 type UserCrudService struct {
-	db     *gorm.DB
-	logger *zap.SugaredLogger
+	db            *gorm.DB
+	logger        *zap.SugaredLogger
+	deviceManager *device.DeviceManager
 }
 
+// UserWithScore is a user found by a search, the score is between 0 and 1
 type UserWithScore struct {
 	User  model.User
 	Score float64
@@ -44,8 +91,9 @@ func NewUserCrudService() IUserCrudService {
 	var service IUserCrudService
 	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
 		service = &UserCrudService{
-			db:     db,
-			logger: logger,
+			db:            db,
+			logger:        logger,
+			deviceManager: device.NewDeviceManager(),
 		}
 	})
 
@@ -62,45 +110,6 @@ func (u *UserCrudService) ReadAll() ([]model.User, error) {
 	return users, nil
 }
 
-// Delete implements IUserCrudService.
-func (u *UserCrudService) Delete(_uuid uuid.UUID) error {
-	var user model.User
-	rez := u.db.Preload("License").Where("uuid = ?", _uuid).First(&user)
-	if rez.Error != nil {
-		if rez.RowsAffected == 0 {
-			u.logger.Debugf("User with UUID %s not found", _uuid)
-			return gorm.ErrRecordNotFound
-		}
-		u.logger.Errorf("Error finding user with UUID %s: %v", _uuid, rez.Error)
-		return rez.Error
-	}
-
-	if user.License != nil {
-		u.logger.Debugf("Deleting driver license with UUID %s", user.License.Uuid)
-		if err := u.db.Where("uuid = ?", user.License.Uuid).Delete(&user.License).Error; err != nil {
-			u.logger.Errorf("Error deleting driver license with UUID %s: %v", user.License.Uuid, err)
-			return err
-		}
-	}
-
-	user.FirstName = "Deleted"
-	user.LastName = "User"
-	user.OIB = fmt.Sprintf("000000%05d", user.ID)
-	user.BirthDate = time.Time{}
-	user.Residence = "Anonymized"
-	user.Email = fmt.Sprintf("deleted_%s@example.com", _uuid.String())
-	user.PasswordHash = ""
-
-	saveRez := u.db.Save(&user)
-	if saveRez.Error != nil {
-		u.logger.Errorf("Error saving anonymized user with UUID %s: %v", _uuid, saveRez.Error)
-		return saveRez.Error
-	}
-
-	u.logger.Debugf("User with UUID %s anonymized successfully", _uuid)
-	return nil
-}
-
 // Read implements IUserCrudService.
 func (u *UserCrudService) Read(_uuid uuid.UUID) (*model.User, error) {
 	var user model.User
@@ -121,6 +130,18 @@ func (u *UserCrudService) Update(_uuid uuid.UUID, user *model.User) (*model.User
 		return nil, err
 	}
 
+	if !strings.EqualFold(userOld.Email, user.Email) {
+		var taken int64
+		if err := u.db.Model(&model.User{}).
+			Where("lower(email) = ? AND id <> ?", strings.ToLower(user.Email), userOld.ID).
+			Count(&taken).Error; err != nil {
+			return nil, err
+		}
+		if taken > 0 {
+			return nil, cerror.ErrEmailTaken
+		}
+	}
+
 	u.logger.Debugf("Updating user %+v", userOld)
 	userOld = userOld.Update(user)
 
@@ -135,6 +156,11 @@ func (u *UserCrudService) Update(_uuid uuid.UUID, user *model.User) (*model.User
 }
 
 func (u *UserCrudService) Create(user *model.User, password string) (*model.User, error) {
+	if err := auth.ValidatePassword(password); err != nil {
+		u.logger.Debugf("Password rejected by policy, err = %+v", err)
+		return nil, err
+	}
+
 	hash, err := auth.HashPassword(password)
 	if err != nil {
 		return nil, err
@@ -142,115 +168,122 @@ func (u *UserCrudService) Create(user *model.User, password string) (*model.User
 
 	user.PasswordHash = hash
 
-	// Handle police token based on role
-	if user.Role != model.RolePolicija {
-		// For non-police users, ensure the token is nil
-		user.PoliceToken = nil
-	}
-
-	// Debug logging
-	tokenValue := "nil"
-	if user.PoliceToken != nil {
-		tokenValue = *user.PoliceToken
-	}
-	u.logger.Infof("Creating user: %s %s, role: %s, token: %s",
-		user.FirstName, user.LastName, user.Role, tokenValue)
-
-	// Create the user
 	rez := u.db.Create(&user)
 	if rez.Error != nil {
 		return nil, rez.Error
 	}
 
-	// Verify the token was saved correctly for police officers
-	if user.Role == model.RolePolicija && user.PoliceToken != nil && *user.PoliceToken != "" {
-		var savedUser model.User
-		if err := u.db.Where("uuid = ?", user.Uuid).First(&savedUser).Error; err != nil {
-			u.logger.Errorf("Could not verify saved user: %v", err)
-		} else {
-			savedTokenValue := "nil"
-			if savedUser.PoliceToken != nil {
-				savedTokenValue = *savedUser.PoliceToken
-			}
-			u.logger.Infof("Saved user: %s %s, role: %s, token: %s",
-				savedUser.FirstName, savedUser.LastName, savedUser.Role, savedTokenValue)
-
-			// If token not saved correctly, try direct update
-			if (savedUser.PoliceToken == nil || *savedUser.PoliceToken == "") &&
-				user.PoliceToken != nil && *user.PoliceToken != "" {
-				u.logger.Infof("Token not saved correctly, trying direct update")
-				if err := u.db.Model(&savedUser).Update("police_token", user.PoliceToken).Error; err != nil {
-					u.logger.Errorf("Failed to update token directly: %v", err)
-				} else {
-					u.logger.Infof("Token updated directly")
-					// Re-fetch the user to confirm the update
-					if err := u.db.Where("uuid = ?", user.Uuid).First(&savedUser).Error; err != nil {
-						u.logger.Errorf("Could not fetch updated user: %v", err)
-					} else {
-						// Return the updated user
-						return &savedUser, nil
-					}
-				}
-			}
-		}
-	}
-
 	return user, nil
 }
 
-// Gets all users except super admin
-func (u *UserCrudService) GetAllUsers() ([]model.User, error) {
+// Gets a page of users except super admin
+func (u *UserCrudService) GetAllUsers(params *paging.Params) ([]model.User, *paging.Page, error) {
 	var users []model.User
-	rez := u.db.
-		Where("role != ?", model.RoleSuperAdmin).
-		Find(&users)
-	if rez.Error != nil {
-		return nil, rez.Error
+	page, err := paging.Find(u.db.Where("role != ?", model.RoleSuperAdmin), params, &users)
+	if err != nil {
+		return nil, nil, err
 	}
-	return users, nil
+	return users, page, nil
 }
 
-// Gets all police officers users
-func (u *UserCrudService) GetAllPoliceOfficers() ([]model.User, error) {
+// Gets a page of police officers users
+func (u *UserCrudService) GetAllPoliceOfficers(params *paging.Params) ([]model.User, *paging.Page, error) {
 	var users []model.User
-	rez := u.db.
-		Where("role = ?", model.RolePolicija).
-		Find(&users)
-	if rez.Error != nil {
-		return nil, rez.Error
+	page, err := paging.Find(u.db.Where("role = ?", model.RolePolicija), params, &users)
+	if err != nil {
+		return nil, nil, err
 	}
-	return users, nil
+	return users, page, nil
 }
 
-// SearchUsersByName searches for users by name and surname
-func (u *UserCrudService) SearchUsersByName(query string) ([]model.User, error) {
-	normalizedQuery := strings.ToLower(strings.TrimSpace(query))
-
-	var users []model.User
-	err := u.db.Find(&users).Error
+// SearchUsers implements IUserCrudService.
+func (u *UserCrudService) SearchUsers(query string, field UserSearchField, params *paging.Params) ([]UserWithScore, *paging.Page, error) {
+	if params.Cursor != "" {
+		return nil, nil, fmt.Errorf("%w: search results are paged by offset", cerror.ErrInvalidQuery)
+	}
+	condition, err := u.searchCondition(strings.TrimSpace(query), field)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var scoredUsers []UserWithScore
-	for _, user := range users {
-		fullName := strings.ToLower(user.FirstName + " " + user.LastName)
-		score := smetrics.JaroWinkler(normalizedQuery, fullName, 0.7, 4)
-		scoredUsers = append(scoredUsers, UserWithScore{User: user, Score: score})
+	matches := u.db.Model(&model.User{}).Where(condition.Where).Session(&gorm.Session{})
+	page := &paging.Page{Limit: params.Limit, Offset: params.Offset}
+	if err := matches.Count(&page.Total).Error; err != nil {
+		return nil, nil, err
 	}
 
-	sort.Slice(scoredUsers, func(i, j int) bool {
-		return scoredUsers[i].Score > scoredUsers[j].Score
-	})
+	var hits []struct {
+		ID    uint
+		Score float64
+	}
+	if err := matches.
+		Select("users.id AS id, ? AS score", condition.Score).
+		Order("score DESC, users.id").
+		Limit(params.Limit).
+		Offset(params.Offset).
+		Scan(&hits).
+		Error; err != nil {
+		return nil, nil, err
+	}
+	if len(hits) == 0 {
+		return []UserWithScore{}, page, nil
+	}
 
-	var filteredUsers []model.User
-	for _, scoredUser := range scoredUsers {
-		if scoredUser.Score >= 0.8 {
-			filteredUsers = append(filteredUsers, scoredUser.User)
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	var users []model.User
+	if err := u.db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+	byId := make(map[uint]model.User, len(users))
+	for _, user := range users {
+		byId[user.ID] = user
+	}
+
+	results := make([]UserWithScore, 0, len(hits))
+	for _, hit := range hits {
+		if user, ok := byId[hit.ID]; ok {
+			results = append(results, UserWithScore{User: user, Score: hit.Score})
 		}
 	}
+	return results, page, nil
+}
+
+// searchCondition matches the searched field, a search of every field
+// matches OIB prefixes if the query is a number and text fields otherwise
+func (u *UserCrudService) searchCondition(query string, field UserSearchField) (search.Condition, error) {
+	if query == "" {
+		return search.Condition{}, fmt.Errorf("%w: search query is empty", cerror.ErrInvalidQuery)
+	}
 
-	return filteredUsers, nil
+	// NOTE: expressions must stay the same as the indexes created by app
+	name := search.Similar(u.db, "LOWER(users.first_name || ' ' || users.last_name)", query)
+	email := search.Similar(u.db, "LOWER(users.email)", query)
+	residence := search.Similar(u.db, "LOWER(users.residence_street || ' ' || users.residence_settlement)", query)
+	isNumber := strings.IndexFunc(query, func(r rune) bool { return r < '0' || r > '9' }) < 0
+
+	switch field {
+	case SearchAll:
+		if isNumber {
+			return search.Prefix("users.oib", query), nil
+		}
+		return search.Any(u.db, name, email, residence), nil
+	case SearchName:
+		return name, nil
+	case SearchOib:
+		if !isNumber {
+			return search.Condition{}, fmt.Errorf("%w: OIB search query must be a number", cerror.ErrInvalidQuery)
+		}
+		return search.Prefix("users.oib", query), nil
+	case SearchEmail:
+		return email, nil
+	case SearchResidence:
+		return residence, nil
+	default:
+		return search.Condition{}, fmt.Errorf("%w: can't search by %q", cerror.ErrInvalidQuery, field)
+	}
 }
 
 // GetUserByOIB implements IUserCrudService.
@@ -279,17 +312,15 @@ func (u *UserCrudService) DeleteUserDevice(userUUID uuid.UUID) error {
 		return err
 	}
 
-	var deviceCount int64
-	if err := u.db.Model(&model.Mobile{}).Where("user_id = ?", user.ID).Count(&deviceCount).Error; err != nil {
+	devices, err := u.deviceManager.FindUserDevices(user.ID)
+	if err != nil {
 		return err
 	}
-	if deviceCount == 0 {
+	if len(devices) == 0 {
 		return gorm.ErrRecordNotFound
 	}
 
-	if err := u.db.Unscoped().Where("user_id = ?", user.ID).Delete(&model.Mobile{}).Error; err != nil {
-		return err
-	}
-
-	return nil
+	// NOTE: device tokens also pass routes that don't check the device, they
+	// have to be revoked and not only lose their device
+	return u.deviceManager.RevokeDevices(devices)
 }
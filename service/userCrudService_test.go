@@ -8,17 +8,21 @@ import (
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/auth"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
+	"ePrometna_Server/util/search"
 	"errors"
+	"fmt"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -41,7 +45,7 @@ func (suite *UserCrudServiceTestSuite) SetupSuite() {
 	suite.logObserver = obs
 	zap.ReplaceGlobals(zap.New(core))
 
-	db, err := gorm.Open(sqlite.Open("file:usercrudservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+	db, err := gorm.Open(search.OpenSqlite("file:usercrudservice_test.db?mode=memory&cache=shared"), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	suite.Require().NoError(err, "Failed to connect to SQLite for UserCrudService tests")
@@ -103,7 +107,7 @@ func (suite *UserCrudServiceTestSuite) seedUser(email string, role model.UserRol
 		PasswordHash: hashedPassword,
 		Role:         role,
 		BirthDate:    time.Now().AddDate(-30, 0, 0),
-		Residence:    "Seed Residence",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	err := suite.db.Create(user).Error
 	suite.Require().NoError(err)
@@ -112,6 +116,15 @@ func (suite *UserCrudServiceTestSuite) seedUser(email string, role model.UserRol
 	return user
 }
 
+// listParams parses the query of a list request
+func listParams(t *testing.T, spec paging.Spec, query string) *paging.Params {
+	values, err := url.ParseQuery(query)
+	require.NoError(t, err)
+	params, err := paging.Parse(values, spec)
+	require.NoError(t, err)
+	return params
+}
+
 func TestUserCrudServiceSuite(t *testing.T) {
 	suite.Run(t, new(UserCrudServiceTestSuite))
 }
@@ -127,7 +140,7 @@ func (suite *UserCrudServiceTestSuite) TestCreateUser_Success() {
 		Email:     "john.doe.create@example.com",
 		Role:      model.RoleOsoba,
 		BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
-		Residence: "123 Main St",
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	plainPassword := "password123"
 
@@ -161,7 +174,7 @@ func (suite *UserCrudServiceTestSuite) TestCreateUser_DuplicateEmail() {
 		Email:     email, // Same email
 		Role:      model.RoleOsoba,
 		BirthDate: time.Date(1992, 2, 2, 0, 0, 0, 0, time.UTC),
-		Residence: "456 Oak St",
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	_, err := suite.userCrudService.Create(newUser, "newPassword")
 
@@ -184,7 +197,7 @@ func (suite *UserCrudServiceTestSuite) TestCreateUser_DuplicateOIB() {
 		Email:     email2, // Different email
 		Role:      model.RoleOsoba,
 		BirthDate: time.Date(1995, 5, 5, 0, 0, 0, 0, time.UTC),
-		Residence: "Neverland",
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	_, err := suite.userCrudService.Create(newUser, "lostboy")
 
@@ -192,6 +205,36 @@ func (suite *UserCrudServiceTestSuite) TestCreateUser_DuplicateOIB() {
 	assert.Contains(suite.T(), strings.ToLower(err.Error()), "unique constraint failed")
 }
 
+func (suite *UserCrudServiceTestSuite) TestCreateUser_WeakPassword() {
+	policy, err := auth.NewPasswordPolicy(10, 3, "")
+	suite.Require().NoError(err)
+	auth.SetPasswordPolicy(policy)
+	defer auth.SetPasswordPolicy(nil)
+
+	newUser := &model.User{
+		Uuid:      uuid.New(),
+		FirstName: "Weak",
+		LastName:  "Password",
+		OIB:       "55544433322",
+		Email:     "weak.password@example.com",
+		Role:      model.RoleOsoba,
+		BirthDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+	}
+
+	_, err = suite.userCrudService.Create(newUser, "password")
+
+	var policyErr *auth.PasswordPolicyError
+	suite.Require().ErrorAs(err, &policyErr)
+	assert.Len(suite.T(), policyErr.Violations, 2)
+	var count int64
+	suite.db.Model(&model.User{}).Where("email = ?", newUser.Email).Count(&count)
+	assert.Equal(suite.T(), int64(0), count)
+
+	_, err = suite.userCrudService.Create(newUser, "Strong-Passw0rd")
+	assert.NoError(suite.T(), err)
+}
+
 func (suite *UserCrudServiceTestSuite) TestReadUser_Success() {
 	seededUser := suite.seedUser("read.user@example.com", model.RoleHAK, "88877766655", "seed")
 
@@ -217,15 +260,39 @@ func (suite *UserCrudServiceTestSuite) TestReadAllUsers_Success() {
 	suite.seedUser("user2.readall@example.com", model.RoleFirma, "10000000002", "seed")
 	suite.seedUser("super.readall@example.com", model.RoleSuperAdmin, "10000000003", "seed") // This one should be excluded by GetAllUsers
 
-	users, err := suite.userCrudService.GetAllUsers() // GetAllUsers specifically excludes superadmin
+	users, page, err := suite.userCrudService.GetAllUsers(listParams(suite.T(), service.UserListSpec, "")) // GetAllUsers specifically excludes superadmin
 
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), users, 2) // Only user1 and user2
+	assert.EqualValues(suite.T(), 2, page.Total)
 	for _, u := range users {
 		assert.NotEqual(suite.T(), model.RoleSuperAdmin, u.Role)
 	}
 }
 
+func (suite *UserCrudServiceTestSuite) TestGetAllUsers_Paged() {
+	suite.seedUser("user1.paged@example.com", model.RoleOsoba, "10000000011", "seed")
+	suite.seedUser("user2.paged@example.com", model.RoleFirma, "10000000012", "seed")
+	suite.seedUser("user3.paged@example.com", model.RoleOsoba, "10000000013", "seed")
+
+	users, page, err := suite.userCrudService.GetAllUsers(listParams(suite.T(), service.UserListSpec, "limit=1&sort=-email&role=osoba"))
+	suite.Require().NoError(err)
+	suite.Require().Len(users, 1)
+	assert.Equal(suite.T(), "user3.paged@example.com", users[0].Email)
+	assert.EqualValues(suite.T(), 2, page.Total)
+	suite.Require().NotEmpty(page.NextCursor)
+
+	users, page, err = suite.userCrudService.GetAllUsers(listParams(suite.T(), service.UserListSpec, "limit=1&sort=-email&role=osoba&cursor="+page.NextCursor))
+	suite.Require().NoError(err)
+	suite.Require().Len(users, 1)
+	assert.Equal(suite.T(), "user1.paged@example.com", users[0].Email)
+	assert.Empty(suite.T(), page.NextCursor)
+
+	users, _, err = suite.userCrudService.GetAllUsers(listParams(suite.T(), service.UserListSpec, "email[contains]=USER2.PAGED"))
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), users, 1)
+}
+
 func (suite *UserCrudServiceTestSuite) TestUpdateUser_Success() {
 	seededUser := suite.seedUser("update.user@example.com", model.RoleOsoba, "77766655544", "seed")
 	updateData := &model.User{
@@ -235,7 +302,7 @@ func (suite *UserCrudServiceTestSuite) TestUpdateUser_Success() {
 		Email:     "updated.john.doe@example.com", // Email can change if unique
 		Role:      model.RoleFirma,                // Role can change
 		BirthDate: time.Date(1985, 5, 15, 0, 0, 0, 0, time.UTC),
-		Residence: "Updated Address",
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 
 	updatedUser, err := suite.userCrudService.Update(seededUser.Uuid, updateData)
@@ -253,6 +320,16 @@ func (suite *UserCrudServiceTestSuite) TestUpdateUser_Success() {
 	assert.Equal(suite.T(), updateData.FirstName, dbUser.FirstName)
 }
 
+func (suite *UserCrudServiceTestSuite) TestUpdateUser_EmailTaken() {
+	suite.seedUser("first.owner@example.com", model.RoleOsoba, "77766655541", "seed")
+	seededUser := suite.seedUser("second.owner@example.com", model.RoleOsoba, "77766655542", "seed")
+	updateData := *seededUser
+	updateData.Email = "First.Owner@example.com"
+
+	_, err := suite.userCrudService.Update(seededUser.Uuid, &updateData)
+	assert.ErrorIs(suite.T(), err, cerror.ErrEmailTaken)
+}
+
 func (suite *UserCrudServiceTestSuite) TestUpdateUser_NotFound() {
 	nonExistentUUID := uuid.New()
 	updateData := &model.User{FirstName: "NoOne"}
@@ -262,31 +339,12 @@ func (suite *UserCrudServiceTestSuite) TestUpdateUser_NotFound() {
 	assert.True(suite.T(), errors.Is(err, gorm.ErrRecordNotFound))
 }
 
-func (suite *UserCrudServiceTestSuite) TestDeleteUser_Success() {
-	seededUser := suite.seedUser("delete.user@example.com", model.RoleOsoba, "66655544433", "seed")
-	err := suite.userCrudService.Delete(seededUser.Uuid)
-	assert.NoError(suite.T(), err)
-
-	// Verify soft delete (or hard delete if GORM default is changed)
-	var dbUser model.User
-	errDb := suite.db.Unscoped().First(&dbUser, seededUser.ID).Error
-	assert.NoError(suite.T(), errDb)
-	assert.NotNil(suite.T(), dbUser.DeletedAt)
-}
-
-func (suite *UserCrudServiceTestSuite) TestDeleteUser_NotFound() {
-	nonExistentUUID := uuid.New()
-	err := suite.userCrudService.Delete(nonExistentUUID)
-	assert.Error(suite.T(), err)
-	assert.True(suite.T(), errors.Is(err, gorm.ErrRecordNotFound))
-}
-
 func (suite *UserCrudServiceTestSuite) TestGetAllPoliceOfficers_Success() {
 	suite.seedUser("officer1@example.com", model.RolePolicija, "20000000001", "seed")
 	suite.seedUser("officer2@example.com", model.RolePolicija, "20000000002", "seed")
 	suite.seedUser("notanofficer@example.com", model.RoleOsoba, "20000000003", "seed")
 
-	officers, err := suite.userCrudService.GetAllPoliceOfficers()
+	officers, _, err := suite.userCrudService.GetAllPoliceOfficers(listParams(suite.T(), service.PoliceOfficerListSpec, ""))
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), officers, 2)
 	for _, officer := range officers {
@@ -294,43 +352,89 @@ func (suite *UserCrudServiceTestSuite) TestGetAllPoliceOfficers_Success() {
 	}
 }
 
-func (suite *UserCrudServiceTestSuite) TestSearchUsersByName_Found() {
+// searchNames returns the first names of search results
+func searchNames(results []service.UserWithScore) []string {
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.User.FirstName)
+	}
+	return names
+}
+
+func (suite *UserCrudServiceTestSuite) TestSearchUsers_Found() {
 	suite.seedUser("john.search@example.com", model.RoleOsoba, "30000000001", "John")
 	suite.seedUser("jane.search@example.com", model.RoleFirma, "30000000002", "Jane")
 	suite.seedUser("jonathan.search@example.com", model.RoleHAK, "30000000003", "Jonathan")
+	params := listParams(suite.T(), service.UserSearchSpec, "")
 
 	// Test exact match
-	users, err := suite.userCrudService.SearchUsersByName("John")
+	users, page, err := suite.userCrudService.SearchUsers("John", service.SearchAll, params)
 	assert.NoError(suite.T(), err)
-	assert.NotEmpty(suite.T(), users)
-	foundJohn := false
-	for _, u := range users {
-		if u.FirstName == "John" {
-			foundJohn = true
-			break
-		}
+	require.NotEmpty(suite.T(), users)
+	assert.Equal(suite.T(), "John", users[0].User.FirstName, "John should be the best match")
+	assert.EqualValues(suite.T(), len(users), page.Total)
+	for i := 1; i < len(users); i++ {
+		assert.GreaterOrEqual(suite.T(), users[i-1].Score, users[i].Score)
 	}
-	assert.True(suite.T(), foundJohn, "Should find John")
 
-	// Test partial match (Jaro-Winkler should pick up Jonathan for Jon)
-	users, err = suite.userCrudService.SearchUsersByName("Jon")
+	// Test partial match, Jonathan contains the query
+	users, _, err = suite.userCrudService.SearchUsers("Jon", service.SearchName, params)
 	assert.NoError(suite.T(), err)
-	assert.NotEmpty(suite.T(), users)
-	foundJonathanOrJohn := false
-	for _, u := range users {
-		if strings.HasPrefix(u.FirstName, "Jon") {
-			foundJonathanOrJohn = true
-			break
-		}
+	assert.Contains(suite.T(), searchNames(users), "Jonathan")
+
+	// Test typo
+	users, _, err = suite.userCrudService.SearchUsers("Jonatan", service.SearchName, params)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), searchNames(users), "Jonathan")
+}
+
+func (suite *UserCrudServiceTestSuite) TestSearchUsers_Fields() {
+	suite.seedUser("ivana.field@example.com", model.RoleOsoba, "31234500001", "Ivana")
+	suite.seedUser("marko.field@example.com", model.RoleOsoba, "31234600002", "Marko")
+	params := listParams(suite.T(), service.UserSearchSpec, "")
+
+	users, _, err := suite.userCrudService.SearchUsers("312345", service.SearchAll, params)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"Ivana"}, searchNames(users))
+	assert.Equal(suite.T(), 1.0, users[0].Score)
+
+	users, _, err = suite.userCrudService.SearchUsers("marko.field@", service.SearchEmail, params)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"Marko"}, searchNames(users))
+
+	users, _, err = suite.userCrudService.SearchUsers("ilica zagreb", service.SearchResidence, params)
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), searchNames(users), "Ivana")
+
+	_, _, err = suite.userCrudService.SearchUsers("Marko", service.SearchOib, params)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidQuery)
+
+	_, _, err = suite.userCrudService.SearchUsers("Marko", service.UserSearchField("passwordHash"), params)
+	assert.ErrorIs(suite.T(), err, cerror.ErrInvalidQuery)
+}
+
+func (suite *UserCrudServiceTestSuite) TestSearchUsers_Paged() {
+	for i, name := range []string{"Petra", "Petrica", "Petrovic"} {
+		suite.seedUser(fmt.Sprintf("page.search%d@example.com", i), model.RoleOsoba, fmt.Sprintf("3200000000%d", i), name)
 	}
-	assert.True(suite.T(), foundJonathanOrJohn, "Should find Jonathan or John for query 'Jon'")
+
+	first, page, err := suite.userCrudService.SearchUsers("petr", service.SearchName, listParams(suite.T(), service.UserSearchSpec, "limit=2"))
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), first, 2)
+	assert.EqualValues(suite.T(), 3, page.Total)
+
+	rest, _, err := suite.userCrudService.SearchUsers("petr", service.SearchName, listParams(suite.T(), service.UserSearchSpec, "limit=2&offset=2"))
+	assert.NoError(suite.T(), err)
+	require.Len(suite.T(), rest, 1)
+	assert.NotContains(suite.T(), searchNames(first), rest[0].User.FirstName)
 }
 
-func (suite *UserCrudServiceTestSuite) TestSearchUsersByName_NotFound() {
+func (suite *UserCrudServiceTestSuite) TestSearchUsers_NotFound() {
 	suite.seedUser("no.match@example.com", model.RoleOsoba, "30000000004", "Zzz")
-	users, err := suite.userCrudService.SearchUsersByName("NonExistentName")
+	users, page, err := suite.userCrudService.SearchUsers("NonExistentName", service.SearchAll, listParams(suite.T(), service.UserSearchSpec, ""))
 	assert.NoError(suite.T(), err)
 	assert.Empty(suite.T(), users)
+	assert.EqualValues(suite.T(), 0, page.Total)
 }
 
 func (suite *UserCrudServiceTestSuite) TestGetUserByOIB_Success() {
@@ -361,7 +465,7 @@ func (suite *UserCrudServiceTestSuite) TestCreateUser_InvalidRoleInModel() {
 		Email:        "bad.role.model@example.com",
 		Role:         model.UserRole("nonexistentrole"), // Invalid role string
 		BirthDate:    time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
-		Residence:    "123 Error St",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		PasswordHash: "somehash",
 	}
 
@@ -372,113 +476,61 @@ func (suite *UserCrudServiceTestSuite) TestCreateUser_InvalidRoleInModel() {
 	dtoWithBadRole := dto.NewUserDto{
 		FirstName: "DtoBad", LastName: "RoleDto", OIB: "50000000002",
 		Email: "bad.role.dto@example.com", Role: "verybadrole", Password: "password",
-		BirthDate: "1990-01-01", Residence: "Dto Error St",
+		BirthDate: "1990-01-01", Residence: dto.AddressDto{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	_, errDto := dtoWithBadRole.ToModel() // This calls model.StoUserRole
 	assert.Error(suite.T(), errDto)
 	assert.True(suite.T(), errors.Is(errDto, cerror.ErrUnknownRole))
 }
 
-func (suite *UserCrudServiceTestSuite) TestCreateUser_PoliceRole_WithToken() {
-	policeTokenValue := "POLICETOKEN123"
+func (suite *UserCrudServiceTestSuite) TestCreateUser_PoliceRole() {
 	newUser := &model.User{
-		Uuid:        uuid.New(),
-		FirstName:   "Officer",
-		LastName:    "WithToken",
-		OIB:         "POLICE00001",
-		Email:       "officer.withtoken@example.com",
-		Role:        model.RolePolicija,
-		BirthDate:   time.Date(1988, 8, 8, 0, 0, 0, 0, time.UTC),
-		Residence:   "Police Station 1",
-		PoliceToken: &policeTokenValue, // Explicitly set token for police role
+		Uuid:      uuid.New(),
+		FirstName: "Officer",
+		LastName:  "Created",
+		OIB:       "POLICE00001",
+		Email:     "officer.created@example.com",
+		Role:      model.RolePolicija,
+		BirthDate: time.Date(1988, 8, 8, 0, 0, 0, 0, time.UTC),
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
-	plainPassword := "officerPass"
 
-	createdUser, err := suite.userCrudService.Create(newUser, plainPassword)
+	createdUser, err := suite.userCrudService.Create(newUser, "officerPass1!")
 
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), createdUser)
-	assert.Equal(suite.T(), model.RolePolicija, createdUser.Role)
-	assert.NotNil(suite.T(), createdUser.PoliceToken, "PoliceToken should be set for police officer")
-	if createdUser.PoliceToken != nil {
-		assert.Equal(suite.T(), policeTokenValue, *createdUser.PoliceToken)
-	}
 
-	// Verify in DB
-	var dbUser model.User
-	errDb := suite.db.First(&dbUser, createdUser.ID).Error
-	assert.NoError(suite.T(), errDb)
-	assert.Equal(suite.T(), model.RolePolicija, dbUser.Role)
-	assert.NotNil(suite.T(), dbUser.PoliceToken)
-	if dbUser.PoliceToken != nil {
-		assert.Equal(suite.T(), policeTokenValue, *dbUser.PoliceToken)
-	}
+	// Activation codes are issued separately, none exists after creation
+	var codes int64
+	suite.db.Model(&model.PoliceActivationCode{}).Where("user_id = ?", createdUser.ID).Count(&codes)
+	assert.Zero(suite.T(), codes)
 }
 
-func (suite *UserCrudServiceTestSuite) TestCreateUser_PoliceRole_WithoutTokenInModel() {
-	// Test case where the PoliceToken field in the input model.User is nil,
-	// but the role is policija. The service should not automatically generate one here;
-	// token generation/setting is a separate admin action via UserController.
-	newUser := &model.User{
-		Uuid:        uuid.New(),
-		FirstName:   "Officer",
-		LastName:    "NoTokenInModel",
-		OIB:         "POLICE00002",
-		Email:       "officer.notokenmodel@example.com",
-		Role:        model.RolePolicija,
-		BirthDate:   time.Date(1989, 9, 9, 0, 0, 0, 0, time.UTC),
-		Residence:   "Police Station 2",
-		PoliceToken: nil, // Token is nil in the model being passed to Create
-	}
-	plainPassword := "officerPassNoToken"
-
-	createdUser, err := suite.userCrudService.Create(newUser, plainPassword)
-
-	assert.NoError(suite.T(), err)
-	assert.NotNil(suite.T(), createdUser)
-	assert.Equal(suite.T(), model.RolePolicija, createdUser.Role)
-	// If the input DTO (and thus the model passed to Create) had no token,
-	// the created user's PoliceToken should also be nil or empty string after creation.
-	// The service's Create method will set it to nil if the role is not policija,
-	// or use the provided value if it is policija. If nil is provided for policija, it stays nil.
-	assert.Nil(suite.T(), createdUser.PoliceToken, "PoliceToken should be nil if not provided for police officer during creation")
+func (suite *UserCrudServiceTestSuite) TestDeleteUserDevice_RevokesToken() {
+	auth.SetRevocationStore(auth.NewMemoryRevocationStore())
+	user := suite.seedUser("device.owner@example.com", model.RolePolicija, "DEVICE00001", "Device")
 
-	// Verify in DB
-	var dbUser model.User
-	errDb := suite.db.First(&dbUser, createdUser.ID).Error
-	assert.NoError(suite.T(), errDb)
-	assert.Equal(suite.T(), model.RolePolicija, dbUser.Role)
-	assert.Nil(suite.T(), dbUser.PoliceToken)
-}
+	deviceUuid := uuid.New()
+	deviceToken, err := auth.GenerateDeviceToken(user, deviceUuid)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Create(&model.Mobile{
+		Uuid:            deviceUuid,
+		UserId:          user.ID,
+		CreatorId:       user.ID,
+		DeviceId:        "device-owner-phone",
+		ActivationToken: deviceToken,
+	}).Error)
 
-func (suite *UserCrudServiceTestSuite) TestCreateUser_NonPoliceRole_IgnoresPoliceTokenField() {
-	// If a non-police role user is created, any value in PoliceToken field of the input model
-	// should be ignored and set to nil by the service.
-	ignoredTokenValue := "SHOULD BE IGNORED"
-	newUser := &model.User{
-		Uuid:        uuid.New(),
-		FirstName:   "Civilian",
-		LastName:    "WithSuperfluousToken",
-		OIB:         "CIVIL00001",
-		Email:       "civilian.withtoken@example.com",
-		Role:        model.RoleOsoba, // Non-police role
-		BirthDate:   time.Date(1991, 1, 1, 0, 0, 0, 0, time.UTC),
-		Residence:   "Civilian Residence",
-		PoliceToken: &ignoredTokenValue, // Provide a token, but it should be ignored
-	}
-	plainPassword := "civilianPass"
+	suite.Require().NoError(suite.userCrudService.DeleteUserDevice(user.Uuid))
 
-	createdUser, err := suite.userCrudService.Create(newUser, plainPassword)
+	_, claims, err := auth.ParseToken("Bearer " + deviceToken)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), auth.IsRevoked(claims))
 
-	assert.NoError(suite.T(), err)
-	assert.NotNil(suite.T(), createdUser)
-	assert.Equal(suite.T(), model.RoleOsoba, createdUser.Role)
-	assert.Nil(suite.T(), createdUser.PoliceToken, "PoliceToken should be nil for non-police officer, even if provided")
+	var devices int64
+	suite.db.Unscoped().Model(&model.Mobile{}).Where("user_id = ?", user.ID).Count(&devices)
+	assert.Zero(suite.T(), devices)
 
-	// Verify in DB
-	var dbUser model.User
-	errDb := suite.db.First(&dbUser, createdUser.ID).Error
-	assert.NoError(suite.T(), errDb)
-	assert.Equal(suite.T(), model.RoleOsoba, dbUser.Role)
-	assert.Nil(suite.T(), dbUser.PoliceToken)
+	err = suite.userCrudService.DeleteUserDevice(user.Uuid)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
 }
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// importBatchSize is the number of users inserted by one statement
+const importBatchSize = 100
+
+type IUserImportService interface {
+	// Import adds errors to rows whose email or OIB is taken, by another row or
+	// an existing user. Unless it is a dry run or a row has errors every user is
+	// created in one transaction and police officers are issued activation
+	// codes. It returns the number of created users.
+	Import(rows []model.UserImportRow, adminUuid uuid.UUID, dryRun bool) (int, error)
+}
+
+type UserImportService struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewUserImportService() IUserImportService {
+	var service IUserImportService
+	app.Invoke(func(db *gorm.DB, logger *zap.SugaredLogger) {
+		service = &UserImportService{
+			db:     db,
+			logger: logger,
+		}
+	})
+
+	return service
+}
+
+// Import implements IUserImportService.
+func (s *UserImportService) Import(rows []model.UserImportRow, adminUuid uuid.UUID, dryRun bool) (int, error) {
+	if err := s.checkTaken(rows); err != nil {
+		return 0, err
+	}
+	if dryRun || hasImportErrors(rows) {
+		return 0, nil
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		// The users have no password until they set one through a password
+		// reset or redeem their activation code, the secret is thrown away so
+		// one hash serves every row instead of hashing a thousand times
+		secret, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			return err
+		}
+		passwordHash, err := auth.HashPassword(secret)
+		if err != nil {
+			return err
+		}
+
+		users := make([]*model.User, 0, len(rows))
+		for i := range rows {
+			rows[i].User.PasswordHash = passwordHash
+			users = append(users, &rows[i].User)
+		}
+		if err := tx.CreateInBatches(users, importBatchSize).Error; err != nil {
+			return err
+		}
+
+		codes := []model.PoliceActivationCode{}
+		for i := range rows {
+			if rows[i].User.Role != model.RolePolicija {
+				continue
+			}
+			code, err := auth.GenerateActivationCode()
+			if err != nil {
+				return err
+			}
+			stored := newActivationCode(rows[i].User.ID, code, &adminUuid)
+			rows[i].ActivationCode = code
+			rows[i].ActivationExpiresAt = stored.ExpiresAt
+			codes = append(codes, stored)
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(codes, importBatchSize).Error
+	}); err != nil {
+		s.logger.Errorf("Failed to import %d users, error = %+v", len(rows), err)
+		for i := range rows {
+			rows[i].ActivationCode = ""
+		}
+		return 0, err
+	}
+
+	s.logger.Infof("Admin = %s imported %d users", adminUuid, len(rows))
+	return len(rows), nil
+}
+
+// checkTaken adds an error to every row with an email or OIB already used by
+// an earlier row or by a user, erased users keep theirs until they are purged
+func (s *UserImportService) checkTaken(rows []model.UserImportRow) error {
+	emails := make([]string, 0, len(rows))
+	oibs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		emails = append(emails, row.User.Email)
+		oibs = append(oibs, row.User.OIB)
+	}
+
+	var existing []model.User
+	if err := s.db.
+		Unscoped().
+		Select("email", "oib").
+		Where("lower(email) IN ? OR oib IN ?", emails, oibs).
+		Find(&existing).
+		Error; err != nil {
+		s.logger.Errorf("Failed to query users for import, error = %+v", err)
+		return err
+	}
+
+	takenEmails := map[string]bool{}
+	takenOibs := map[string]bool{}
+	for _, user := range existing {
+		takenEmails[strings.ToLower(user.Email)] = true
+		takenOibs[user.OIB] = true
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		if row.User.Email != "" && takenEmails[row.User.Email] {
+			row.Errors = append(row.Errors, &cerror.FieldError{Field: "email", Err: cerror.ErrEmailTaken})
+		}
+		if row.User.OIB != "" && takenOibs[row.User.OIB] {
+			row.Errors = append(row.Errors, &cerror.FieldError{Field: "oib", Err: cerror.ErrOibTaken})
+		}
+		takenEmails[row.User.Email] = true
+		takenOibs[row.User.OIB] = true
+	}
+	return nil
+}
+
+func hasImportErrors(rows []model.UserImportRow) bool {
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
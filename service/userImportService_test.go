@@ -0,0 +1,165 @@
+package service_test
+
+import (
+	"ePrometna_Server/app"
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/service"
+	"ePrometna_Server/util/cerror"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type UserImportServiceTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	service     service.IUserImportService
+	policeCodes service.IPoliceCodeService
+	admin       uuid.UUID
+}
+
+func (suite *UserImportServiceTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open("file:userimportservice_test.db?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	suite.Require().NoError(err, "Failed to connect to SQLite")
+	suite.db = db
+	suite.Require().NoError(suite.db.AutoMigrate(model.GetAllModels()...))
+
+	config.AppConfig = &config.AppConfiguration{
+		Env:               config.Dev,
+		RefreshKey:        "user-import-test-refresh-key",
+		ActivationCodeKey: "user-import-test-code-key",
+	}
+
+	app.Test()
+	app.Provide(func() *gorm.DB { return suite.db })
+	app.Provide(func() *zap.SugaredLogger { return zap.NewNop().Sugar() })
+	suite.service = service.NewUserImportService()
+	suite.policeCodes = service.NewPoliceCodeService()
+	suite.admin = uuid.New()
+}
+
+func (suite *UserImportServiceTestSuite) TearDownSuite() {
+	sqlDB, _ := suite.db.DB()
+	suite.Require().NoError(sqlDB.Close())
+}
+
+func (suite *UserImportServiceTestSuite) SetupTest() {
+	for _, m := range []any{&model.PoliceActivationCode{}, &model.User{}} {
+		suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m)
+	}
+
+	suite.Require().NoError(suite.db.Create(&model.User{
+		Uuid:      uuid.New(),
+		FirstName: "Existing",
+		LastName:  "User",
+		OIB:       "12345678903",
+		BirthDate: time.Now().AddDate(-40, 0, 0),
+		Email:     "Existing@Example.com",
+		Role:      model.RoleOsoba,
+	}).Error)
+}
+
+func TestUserImportServiceSuite(t *testing.T) {
+	suite.Run(t, new(UserImportServiceTestSuite))
+}
+
+func importRow(line int, oib, email string, role model.UserRole) model.UserImportRow {
+	return model.UserImportRow{
+		Line: line,
+		User: model.User{
+			Uuid:      uuid.New(),
+			FirstName: "Imported",
+			LastName:  "User",
+			OIB:       oib,
+			Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+			BirthDate: time.Now().AddDate(-30, 0, 0),
+			Email:     email,
+			Role:      role,
+		},
+	}
+}
+
+func (suite *UserImportServiceTestSuite) countUsers() int64 {
+	var count int64
+	suite.db.Model(&model.User{}).Count(&count)
+	return count
+}
+
+func (suite *UserImportServiceTestSuite) TestImport() {
+	rows := []model.UserImportRow{
+		importRow(2, "10000000000", "officer@example.com", model.RolePolicija),
+		importRow(3, "20000000009", "citizen@example.com", model.RoleOsoba),
+	}
+
+	created, err := suite.service.Import(rows, suite.admin, false)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 2, created)
+	assert.Equal(suite.T(), int64(3), suite.countUsers())
+
+	// only the officer is issued a code and it can be redeemed
+	assert.NotEmpty(suite.T(), rows[0].ActivationCode)
+	assert.True(suite.T(), rows[0].ActivationExpiresAt.After(time.Now()))
+	assert.Empty(suite.T(), rows[1].ActivationCode)
+
+	officer, err := suite.policeCodes.Redeem(rows[0].ActivationCode)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), rows[0].User.Uuid, officer.Uuid)
+}
+
+func (suite *UserImportServiceTestSuite) TestImport_DryRun() {
+	rows := []model.UserImportRow{importRow(2, "10000000000", "officer@example.com", model.RolePolicija)}
+
+	created, err := suite.service.Import(rows, suite.admin, true)
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), created)
+	assert.Empty(suite.T(), rows[0].Errors)
+	assert.Empty(suite.T(), rows[0].ActivationCode)
+	assert.Equal(suite.T(), int64(1), suite.countUsers())
+}
+
+func (suite *UserImportServiceTestSuite) TestImport_Taken() {
+	rows := []model.UserImportRow{
+		importRow(2, "12345678903", "new@example.com", model.RoleOsoba),
+		importRow(3, "20000000009", "existing@example.com", model.RoleOsoba),
+		importRow(4, "30000000008", "twice@example.com", model.RoleOsoba),
+		importRow(5, "30000000008", "twice@example.com", model.RoleOsoba),
+		importRow(6, "40000000007", "valid@example.com", model.RoleOsoba),
+	}
+
+	created, err := suite.service.Import(rows, suite.admin, false)
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), created)
+	assert.Equal(suite.T(), int64(1), suite.countUsers())
+
+	suite.Require().Len(rows[0].Errors, 1)
+	assert.Equal(suite.T(), "oib", rows[0].Errors[0].Field)
+	assert.ErrorIs(suite.T(), rows[0].Errors[0], cerror.ErrOibTaken)
+	suite.Require().Len(rows[1].Errors, 1)
+	assert.ErrorIs(suite.T(), rows[1].Errors[0], cerror.ErrEmailTaken)
+	// the first of two equal rows is fine, the second is taken
+	assert.Empty(suite.T(), rows[2].Errors)
+	assert.Len(suite.T(), rows[3].Errors, 2)
+	assert.Empty(suite.T(), rows[4].Errors)
+}
+
+func (suite *UserImportServiceTestSuite) TestImport_RowErrors() {
+	invalid := importRow(3, "20000000009", "citizen@example.com", model.RoleOsoba)
+	invalid.Errors = []*cerror.FieldError{{Field: "residence", Err: cerror.ErrRequired}}
+	rows := []model.UserImportRow{importRow(2, "10000000000", "officer@example.com", model.RolePolicija), invalid}
+
+	created, err := suite.service.Import(rows, suite.admin, false)
+	suite.Require().NoError(err)
+	assert.Zero(suite.T(), created)
+	assert.Empty(suite.T(), rows[0].ActivationCode)
+	assert.Equal(suite.T(), int64(1), suite.countUsers())
+}
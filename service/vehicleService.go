@@ -4,6 +4,7 @@ import (
 	"ePrometna_Server/app"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
 	"errors"
 	"time"
 
@@ -13,17 +14,32 @@ import (
 )
 
 type IVehicleService interface {
-	ReadAll(driverUuid uuid.UUID) ([]model.Vehicle, error)
+	// ReadAll returns the vehicles of a user and of the organisations they are a member of
+	ReadAll(driverUuid uuid.UUID, params *paging.Params) ([]model.Vehicle, *paging.Page, error)
 	Read(uuid uuid.UUID) (*model.Vehicle, error)
 	ReadByVin(vin string) (*model.Vehicle, error)
+	// Create adds a vehicle owned by the user or organisation with ownerUuid
 	Create(newVehicle *model.Vehicle, ownerUuid uuid.UUID) (*model.Vehicle, error)
 	Delete(uuid uuid.UUID) error
+	// ChangeOwner moves a vehicle to the user or organisation with newOwner
 	ChangeOwner(vehicle uuid.UUID, newOwner uuid.UUID) error
 	Registration(vehicleUuid uuid.UUID, model model.RegistrationInfo) error
 	Update(vehicleUuid uuid.UUID, model model.Vehicle) (*model.Vehicle, error)
 	Deregister(vehicleUuid uuid.UUID) error
 }
 
+// VehicleListSpec is the list contract of vehicles
+var VehicleListSpec = paging.Spec{
+	Fields: map[string]paging.Field{
+		"mark":            {Column: "vehicles.mark", Sortable: true, Filter: paging.FilterText},
+		"model":           {Column: "vehicles.vehicle_model", Sortable: true, Filter: paging.FilterText},
+		"vehicleType":     {Column: "vehicles.vehicle_type", Sortable: true, Filter: paging.FilterExact},
+		"vehicleCategory": {Column: "vehicles.vehicle_category", Sortable: true, Filter: paging.FilterExact},
+		"createdAt":       {Column: "vehicles.created_at", Sortable: true, Filter: paging.FilterRange},
+	},
+	DefaultSort: []string{"createdAt"},
+}
+
 // TODO: implement service
 type VehicleService struct {
 	db          *gorm.DB
@@ -47,19 +63,24 @@ func NewVehicleService() IVehicleService {
 func (v *VehicleService) Create(vehicle *model.Vehicle, ownerUuid uuid.UUID) (*model.Vehicle, error) {
 	// TODO: Create other objects
 
-	owner, err := v.userService.Read(ownerUuid)
+	organisation, err := v.organisation(ownerUuid)
 	if err != nil {
-		v.logger.Errorf("Error reading user with uuid = %s, err = %+v", ownerUuid, err)
 		return nil, err
 	}
-
-	// NOTE: Users that are not roles Firma or Osoba are now allowed to own a car
-	if owner.Role != model.RoleFirma && owner.Role != model.RoleOsoba {
-		v.logger.Errorf("User with role %+v can't own a car", owner.Role)
-		return nil, cerror.ErrBadRole
+	if organisation != nil {
+		vehicle.OrganisationId = &organisation.ID
+	} else {
+		owner, err := v.userService.Read(ownerUuid)
+		if err != nil {
+			v.logger.Errorf("Error reading user with uuid = %s, err = %+v", ownerUuid, err)
+			return nil, err
+		}
+		if err := canOwnVehicle(owner); err != nil {
+			v.logger.Errorf("User with role %+v can't own a car", owner.Role)
+			return nil, err
+		}
+		vehicle.UserId = &owner.ID
 	}
-
-	vehicle.UserId = &owner.ID
 	vehicle.Registration.TechnicalDate = time.Now()
 
 	v.logger.Debugf("Creating new vehicle %+v", vehicle)
@@ -97,6 +118,7 @@ func (v *VehicleService) Delete(_uuid uuid.UUID) error {
 
 			// TODO: write a service for removing users and putting them into past oners
 			vehicle.UserId = nil
+			vehicle.OrganisationId = nil
 
 			rez = tx.Save(&vehicle)
 			v.logger.Debugf("Update statment on uuid = %s, rez %+v", _uuid, rez)
@@ -125,6 +147,7 @@ func (v *VehicleService) Read(_uuid uuid.UUID) (*model.Vehicle, error) {
 	rez := v.db.
 		InnerJoins("Registration").
 		Preload("Owner").
+		Preload("Organisation").
 		Where("vehicles.uuid = ?", _uuid).
 		First(&vehicle)
 
@@ -140,48 +163,57 @@ func (v *VehicleService) Read(_uuid uuid.UUID) (*model.Vehicle, error) {
 }
 
 // ReadAll implements IVehicleService.
-func (v *VehicleService) ReadAll(driverUuid uuid.UUID) ([]model.Vehicle, error) {
+func (v *VehicleService) ReadAll(driverUuid uuid.UUID, params *paging.Params) ([]model.Vehicle, *paging.Page, error) {
 	vehicles := make([]model.Vehicle, 0)
 
 	// TODO: read vehicles that other people borrowd you
-	rez := v.db.
-		Joins("inner join users on vehicles.user_id = users.id").
-		Where("users.uuid = ?", driverUuid).
-		Find(&vehicles)
+	user := v.db.Model(&model.User{}).Select("id").Where("uuid = ?", driverUuid)
+	query := v.db.
+		Where("vehicles.user_id IN (?) OR vehicles.organisation_id IN (?)",
+			user,
+			v.db.Model(&model.OrganisationMember{}).Select("organisation_id").Where("user_id IN (?)", user))
 
-	if rez.Error != nil {
-		return nil, rez.Error
+	page, err := paging.Find(query, params, &vehicles)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	for i := 0; i < len(vehicles); i++ {
 		if err := v.loadRegistration(&vehicles[i]); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	return vehicles, nil
+	return vehicles, page, nil
 }
 
 // ChangeOwner implements IVehicleService.
 func (v *VehicleService) ChangeOwner(vehicleUUID uuid.UUID, newOwnerUuid uuid.UUID) error {
+	newOrganisation, err := v.organisation(newOwnerUuid)
+	if err != nil {
+		return err
+	}
+
 	var newOwner model.User
-	rez := v.db.
-		Where("uuid = ?", newOwnerUuid).
-		First(&newOwner)
+	if newOrganisation == nil {
+		rez := v.db.
+			Where("uuid = ?", newOwnerUuid).
+			First(&newOwner)
 
-	if rez.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
-	if rez.Error != nil {
-		return rez.Error
-	}
-	if newOwner.Role != model.RoleFirma && newOwner.Role != model.RoleOsoba {
-		v.logger.Errorf("New owner (UUID: %s) with role '%s' cannot own a vehicle", newOwnerUuid, newOwner.Role)
-		return cerror.ErrBadRole
+		if rez.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if rez.Error != nil {
+			return rez.Error
+		}
+		if err := canOwnVehicle(&newOwner); err != nil {
+			v.logger.Errorf("New owner (UUID: %s) with role '%s' cannot own a vehicle", newOwnerUuid, newOwner.Role)
+			return err
+		}
 	}
 
 	var vehicle model.Vehicle
-	rez = v.db.
+	rez := v.db.
 		Preload("Owner").
 		Preload("PastOwners").
 		Where("uuid = ?", vehicleUUID).
@@ -194,18 +226,26 @@ func (v *VehicleService) ChangeOwner(vehicleUUID uuid.UUID, newOwnerUuid uuid.UU
 		return rez.Error
 	}
 
-	if vehicle.Owner != nil && vehicle.UserId != nil {
+	if (vehicle.Owner != nil && vehicle.UserId != nil) || vehicle.OrganisationId != nil {
 		pastOwnerEntry := model.OwnerHistory{
-			Uuid:      uuid.New(),
-			VehicleId: vehicle.ID,
-			UserId:    *vehicle.UserId, // Old owner
+			Uuid:           uuid.New(),
+			VehicleId:      vehicle.ID,
+			UserId:         vehicle.UserId, // Old owner
+			OrganisationId: vehicle.OrganisationId,
 		}
 		if err := v.db.Create(&pastOwnerEntry).Error; err != nil {
 			return err
 		}
 	}
-	vehicle.UserId = &newOwner.ID
-	vehicle.Owner = &newOwner
+	if newOrganisation != nil {
+		vehicle.UserId = nil
+		vehicle.Owner = nil
+		vehicle.OrganisationId = &newOrganisation.ID
+	} else {
+		vehicle.UserId = &newOwner.ID
+		vehicle.Owner = &newOwner
+		vehicle.OrganisationId = nil
+	}
 
 	rez = v.db.
 		Save(&vehicle)
@@ -276,6 +316,7 @@ func (v *VehicleService) ReadByVin(vin string) (*model.Vehicle, error) {
 	rez := v.db.
 		InnerJoins("Registration").
 		Preload("Owner").
+		Preload("Organisation").
 		Preload("PastRegistration").
 		Where("vehicles.chassis_number = ?", vin).
 		First(&vehicle)
@@ -363,6 +404,29 @@ func (v *VehicleService) Update(vehicleUuid uuid.UUID, newVehicle model.Vehicle)
 	return &existingVehicle, nil
 }
 
+// organisation returns the organisation with the uuid, nil if the uuid
+// isn't an organisation
+func (v *VehicleService) organisation(ownerUuid uuid.UUID) (*model.Organisation, error) {
+	var organisations []model.Organisation
+	if err := v.db.Where("uuid = ?", ownerUuid).Limit(1).Find(&organisations).Error; err != nil {
+		v.logger.Errorf("Failed to query organisation = %s, err = %+v", ownerUuid, err)
+		return nil, err
+	}
+	if len(organisations) == 0 {
+		return nil, nil
+	}
+	return &organisations[0], nil
+}
+
+// canOwnVehicle allows citizens to own vehicles, companies own them through
+// their organisation
+func canOwnVehicle(owner *model.User) error {
+	if owner.Role != model.RoleOsoba {
+		return cerror.ErrBadRole
+	}
+	return nil
+}
+
 func (v *VehicleService) loadRegistration(vehicle *model.Vehicle) error {
 	var pastRegs []model.RegistrationInfo
 
@@ -6,6 +6,7 @@ import (
 	"ePrometna_Server/model"
 	"ePrometna_Server/service"
 	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
 	"errors"
 	"fmt"
 	"strings"
@@ -80,33 +81,29 @@ func (m *MockUserCrudService) Update(id uuid.UUID, user *model.User) (*model.Use
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
-func (m *MockUserCrudService) Delete(id uuid.UUID) error {
-	args := m.Called(id)
-	return args.Error(0)
-}
-
-func (m *MockUserCrudService) GetAllUsers() ([]model.User, error) {
-	args := m.Called()
-	if len(args) < 2 || args.Get(0) == nil {
-		return nil, args.Error(1)
+func (m *MockUserCrudService) GetAllUsers(params *paging.Params) ([]model.User, *paging.Page, error) {
+	args := m.Called(params)
+	if len(args) < 3 || args.Get(0) == nil {
+		return nil, nil, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	return args.Get(0).([]model.User), args.Get(1).(*paging.Page), args.Error(2)
 }
 
-func (m *MockUserCrudService) GetAllPoliceOfficers() ([]model.User, error) {
-	args := m.Called()
-	if len(args) < 2 || args.Get(0) == nil {
-		return nil, args.Error(1)
+func (m *MockUserCrudService) GetAllPoliceOfficers(params *paging.Params) ([]model.User, *paging.Page, error) {
+	args := m.Called(params)
+	if len(args) < 3 || args.Get(0) == nil {
+		return nil, nil, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	return args.Get(0).([]model.User), args.Get(1).(*paging.Page), args.Error(2)
 }
 
-func (m *MockUserCrudService) SearchUsersByName(query string) ([]model.User, error) {
-	args := m.Called(query)
-	if len(args) < 2 || args.Get(0) == nil {
-		return nil, args.Error(1)
+func (m *MockUserCrudService) SearchUsers(query string, field service.UserSearchField, params *paging.Params) ([]service.UserWithScore, *paging.Page, error) {
+	args := m.Called(query, field, params)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
 	}
-	return args.Get(0).([]model.User), args.Error(1)
+	page, _ := args.Get(1).(*paging.Page)
+	return args.Get(0).([]service.UserWithScore), page, args.Error(2)
 }
 
 // --- Test Suite ---
@@ -170,7 +167,7 @@ func (suite *VehicleServiceTestSuite) SetupTest() {
 	defer suite.db.Exec("PRAGMA foreign_keys = ON")
 	tables := []string{
 		"owner_histories", "registration_infos", "vehicle_drivers", "temp_data",
-		"vehicles", "driver_licenses", "mobiles", "users",
+		"vehicles", "driver_licenses", "mobiles", "organisation_members", "organisations", "users",
 	}
 	for _, table := range tables {
 		err := suite.db.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error
@@ -195,7 +192,7 @@ func createTestUserInDB(db *gorm.DB, s *suite.Suite, role model.UserRole, userUU
 		Email:        fmt.Sprintf("db.test.%s.%s@example.com", string(role), emailSuffix),
 		Role:         role,
 		BirthDate:    time.Now().AddDate(-25, 0, 0),
-		Residence:    "DB Test Residence",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		PasswordHash: "db-dummy-hash-bcrypt-valid",
 	}
 	err := db.Create(user).Error
@@ -327,7 +324,7 @@ func (suite *VehicleServiceTestSuite) TestReadVehicle_Success() {
 
 func (suite *VehicleServiceTestSuite) TestChangeOwner_Success() {
 	oldOwner := createTestUserInDB(suite.db, &suite.Suite, model.RoleOsoba, uuid.New())
-	newOwner := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, uuid.New())
+	newOwner := createTestUserInDB(suite.db, &suite.Suite, model.RoleOsoba, uuid.New())
 	vehicle := createTestVehicleWithInitialReg(suite.db, &suite.Suite, oldOwner.ID, uuid.New(), "ZG-CHOWN-01")
 
 	err := suite.vehicleService.ChangeOwner(vehicle.Uuid, newOwner.Uuid)
@@ -349,10 +346,105 @@ func (suite *VehicleServiceTestSuite) TestChangeOwner_Success() {
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), ownerHistory, 1, "Should have one history record for the old owner")
 	if len(ownerHistory) > 0 {
-		assert.Equal(suite.T(), oldOwner.ID, ownerHistory[0].UserId)
+		assert.Equal(suite.T(), oldOwner.ID, *ownerHistory[0].UserId)
 	}
 }
 
+// createTestOrganisation registers an organisation with the user as its owner
+func createTestOrganisation(db *gorm.DB, s *suite.Suite, owner *model.User, oib string) *model.Organisation {
+	organisation := &model.Organisation{Uuid: uuid.New(), Name: "Test d.o.o.", OIB: oib}
+	s.Require().NoError(db.Create(organisation).Error)
+	s.Require().NoError(db.Create(&model.OrganisationMember{
+		OrganisationId: organisation.ID,
+		UserId:         owner.ID,
+		Role:           model.OrgRoleOwner,
+	}).Error)
+	return organisation
+}
+
+func (suite *VehicleServiceTestSuite) TestCreateVehicle_Organisation() {
+	owner := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, uuid.New())
+	organisation := createTestOrganisation(suite.db, &suite.Suite, owner, "69435151530")
+
+	newVehicle := &model.Vehicle{
+		Uuid:          uuid.New(),
+		VehicleModel:  "Fleet Car",
+		ChassisNumber: "CHASSIS_ORG",
+		Registration:  &model.RegistrationInfo{Uuid: uuid.New(), Registration: "ZG-ORG-01"},
+	}
+	created, err := suite.vehicleService.Create(newVehicle, organisation.Uuid)
+
+	suite.Require().NoError(err)
+	assert.Nil(suite.T(), created.UserId)
+	suite.Require().NotNil(created.OrganisationId)
+	assert.Equal(suite.T(), organisation.ID, *created.OrganisationId)
+	suite.mockUserSvc.AssertNotCalled(suite.T(), "Read", mock.Anything)
+}
+
+func (suite *VehicleServiceTestSuite) TestCreateVehicle_CompanyLoginRejected() {
+	ownerUUID := uuid.New()
+	company := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, ownerUUID)
+	suite.mockUserSvc.On("Read", ownerUUID).Return(company, nil)
+
+	_, err := suite.vehicleService.Create(&model.Vehicle{Uuid: uuid.New()}, ownerUUID)
+	assert.ErrorIs(suite.T(), err, cerror.ErrBadRole)
+}
+
+func (suite *VehicleServiceTestSuite) TestChangeOwner_Organisation() {
+	citizen := createTestUserInDB(suite.db, &suite.Suite, model.RoleOsoba, uuid.New())
+	company := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, uuid.New())
+	organisation := createTestOrganisation(suite.db, &suite.Suite, company, "69435151530")
+	vehicle := createTestVehicleWithInitialReg(suite.db, &suite.Suite, citizen.ID, uuid.New(), "ZG-CHOWN-ORG")
+
+	// sold to the company and back again
+	suite.Require().NoError(suite.vehicleService.ChangeOwner(vehicle.Uuid, organisation.Uuid))
+	var dbVehicle model.Vehicle
+	suite.Require().NoError(suite.db.First(&dbVehicle, vehicle.ID).Error)
+	assert.Nil(suite.T(), dbVehicle.UserId)
+	assert.Equal(suite.T(), organisation.ID, *dbVehicle.OrganisationId)
+
+	suite.Require().NoError(suite.vehicleService.ChangeOwner(vehicle.Uuid, citizen.Uuid))
+	suite.Require().NoError(suite.db.First(&dbVehicle, vehicle.ID).Error)
+	assert.Equal(suite.T(), citizen.ID, *dbVehicle.UserId)
+	assert.Nil(suite.T(), dbVehicle.OrganisationId)
+
+	var history []model.OwnerHistory
+	suite.Require().NoError(suite.db.Where("vehicle_id = ?", vehicle.ID).Order("id").Find(&history).Error)
+	suite.Require().Len(history, 2)
+	assert.Equal(suite.T(), citizen.ID, *history[0].UserId)
+	assert.Nil(suite.T(), history[1].UserId)
+	assert.Equal(suite.T(), organisation.ID, *history[1].OrganisationId)
+}
+
+func (suite *VehicleServiceTestSuite) TestReadAllVehicles_OrganisationMember() {
+	company := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, uuid.New())
+	organisation := createTestOrganisation(suite.db, &suite.Suite, company, "69435151530")
+	driver := createTestUserInDB(suite.db, &suite.Suite, model.RoleOsoba, uuid.New())
+	suite.Require().NoError(suite.db.Create(&model.OrganisationMember{
+		OrganisationId: organisation.ID, UserId: driver.ID, Role: model.OrgRoleDriver,
+	}).Error)
+
+	fleetVehicle := createTestVehicleWithInitialReg(suite.db, &suite.Suite, company.ID, uuid.New(), "ZG-FLEET-01")
+	suite.Require().NoError(suite.db.Model(fleetVehicle).Updates(map[string]any{"user_id": nil, "organisation_id": organisation.ID}).Error)
+	ownVehicle := createTestVehicleWithInitialReg(suite.db, &suite.Suite, driver.ID, uuid.New(), "ZG-OWN-01")
+	outsider := createTestUserInDB(suite.db, &suite.Suite, model.RoleOsoba, uuid.New())
+	_ = createTestVehicleWithInitialReg(suite.db, &suite.Suite, outsider.ID, uuid.New(), "ZG-OTHER-01")
+
+	vehicles, page, err := suite.vehicleService.ReadAll(driver.Uuid, listParams(suite.T(), service.VehicleListSpec, ""))
+	suite.Require().NoError(err)
+	assert.EqualValues(suite.T(), 2, page.Total)
+	uuids := []uuid.UUID{}
+	for _, v := range vehicles {
+		uuids = append(uuids, v.Uuid)
+	}
+	assert.ElementsMatch(suite.T(), []uuid.UUID{fleetVehicle.Uuid, ownVehicle.Uuid}, uuids)
+
+	vehicles, _, err = suite.vehicleService.ReadAll(company.Uuid, listParams(suite.T(), service.VehicleListSpec, ""))
+	suite.Require().NoError(err)
+	suite.Require().Len(vehicles, 1)
+	assert.Equal(suite.T(), fleetVehicle.Uuid, vehicles[0].Uuid)
+}
+
 func (suite *VehicleServiceTestSuite) TestChangeOwner_NewOwnerNotFound() {
 	oldOwner := createTestUserInDB(suite.db, &suite.Suite, model.RoleOsoba, uuid.New())
 	vehicle := createTestVehicleWithInitialReg(suite.db, &suite.Suite, oldOwner.ID, uuid.New(), "ZG-CHOWN-02")
@@ -454,8 +546,9 @@ func (suite *VehicleServiceTestSuite) TestReadAllVehicles_OwnerHasVehicles() {
 	otherOwner := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, uuid.New())
 	_ = createTestVehicleWithInitialReg(suite.db, &suite.Suite, otherOwner.ID, uuid.New(), "KA-OTHER-01")
 
-	retrievedVehicles, err := suite.vehicleService.ReadAll(ownerUser.Uuid)
+	retrievedVehicles, page, err := suite.vehicleService.ReadAll(ownerUser.Uuid, listParams(suite.T(), service.VehicleListSpec, ""))
 	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), 2, page.Total)
 	assert.NotNil(suite.T(), retrievedVehicles)
 	assert.Len(suite.T(), retrievedVehicles, 2, "Should retrieve two vehicles for the owner")
 
@@ -484,7 +577,7 @@ func (suite *VehicleServiceTestSuite) TestReadAllVehicles_OwnerHasNoVehicles() {
 	otherOwner := createTestUserInDB(suite.db, &suite.Suite, model.RoleFirma, uuid.New())
 	_ = createTestVehicleWithInitialReg(suite.db, &suite.Suite, otherOwner.ID, uuid.New(), "KA-OTHER-02")
 
-	retrievedVehicles, err := suite.vehicleService.ReadAll(ownerWithNoVehicles.Uuid)
+	retrievedVehicles, _, err := suite.vehicleService.ReadAll(ownerWithNoVehicles.Uuid, listParams(suite.T(), service.VehicleListSpec, ""))
 	assert.NoError(suite.T(), err)
 	assert.NotNil(suite.T(), retrievedVehicles)
 	assert.Len(suite.T(), retrievedVehicles, 0, "Should retrieve an empty list for an owner with no vehicles")
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"ePrometna_Server/config"
+	"ePrometna_Server/util/cerror"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+const (
+	// activationCodeAlphabet leaves out characters that are easy to mistake for each other
+	activationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	activationCodeLength   = 12
+
+	// ActivationLookupLength is the number of leading characters a lookup is
+	// derived from to find the code a guess was aimed at
+	ActivationLookupLength = 4
+	// activationLookupBytes of the lookup keyed hash are stored
+	activationLookupBytes = 8
+	// MinActivationCodeLength leaves enough secret characters after the lookup
+	MinActivationCodeLength = 10
+)
+
+// GenerateActivationCode returns a random police activation code
+func GenerateActivationCode() (string, error) {
+	max := big.NewInt(int64(len(activationCodeAlphabet)))
+	code := make([]byte, activationCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = activationCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// NormalizeActivationCode trims a code typed in by an officer
+func NormalizeActivationCode(code string) string {
+	return strings.TrimSpace(code)
+}
+
+// ValidateActivationCode checks a code chosen by an admin
+func ValidateActivationCode(code string) error {
+	if len(NormalizeActivationCode(code)) < MinActivationCodeLength {
+		return cerror.ErrWeakActivationCode
+	}
+	return nil
+}
+
+// ActivationCodeLookup returns the stored lookup of a code, a keyed hash of
+// its first characters so a leaked row doesn't reveal part of the code
+func ActivationCodeLookup(code string) string {
+	code = NormalizeActivationCode(code)
+	if len(code) > ActivationLookupLength {
+		code = code[:ActivationLookupLength]
+	}
+	return ActivationPrefixLookup(code)
+}
+
+// ActivationPrefixLookup returns the lookup of the first characters of a
+// code, rows stored before lookups were hashed are migrated with it
+func ActivationPrefixLookup(prefix string) string {
+	mac := hmac.New(sha256.New, activationLookupKey())
+	mac.Write([]byte(prefix))
+	return hex.EncodeToString(mac.Sum(nil)[:activationLookupBytes])
+}
+
+// HashActivationCode hashes a code with the configured key, codes are short
+// so a plain hash of a leaked row could be brute forced
+func HashActivationCode(code string) string {
+	mac := hmac.New(sha256.New, activationCodeKey())
+	mac.Write([]byte(NormalizeActivationCode(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func activationCodeKey() []byte {
+	if config.AppConfig.ActivationCodeKey != "" {
+		return []byte(config.AppConfig.ActivationCodeKey)
+	}
+	return []byte(config.AppConfig.RefreshKey)
+}
+
+// activationLookupKey is the configured lookup key, or one derived from the
+// code key so the lookup never shares a key with the hash
+func activationLookupKey() []byte {
+	if config.AppConfig.ActivationLookupKey != "" {
+		return []byte(config.AppConfig.ActivationLookupKey)
+	}
+	mac := hmac.New(sha256.New, activationCodeKey())
+	mac.Write([]byte("activation-code-lookup"))
+	return mac.Sum(nil)
+}
+
+// CheckActivationCode compares a code with a stored hash in constant time
+func CheckActivationCode(code, hash string) bool {
+	return hmac.Equal([]byte(HashActivationCode(code)), []byte(hash))
+}
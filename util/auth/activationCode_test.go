@@ -0,0 +1,50 @@
+package auth_test
+
+import (
+	"ePrometna_Server/config"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivationCode(t *testing.T) {
+	config.AppConfig = &config.AppConfiguration{RefreshKey: "activation-test-refresh-key"}
+
+	code, err := auth.GenerateActivationCode()
+	assert.NoError(t, err)
+	assert.NoError(t, auth.ValidateActivationCode(code))
+	lookup := auth.ActivationCodeLookup(code)
+	assert.Len(t, lookup, 16)
+	assert.NotContains(t, lookup, code[:auth.ActivationLookupLength])
+	// codes that start the same way share the lookup
+	assert.Equal(t, lookup, auth.ActivationCodeLookup(" "+code[:auth.ActivationLookupLength]+"ZZZZZZZZ"))
+	assert.Equal(t, lookup, auth.ActivationPrefixLookup(code[:auth.ActivationLookupLength]))
+
+	hash := auth.HashActivationCode(code)
+	assert.Len(t, hash, 64)
+	assert.NotContains(t, hash, code)
+	assert.True(t, auth.CheckActivationCode(" "+code+" ", hash))
+	assert.False(t, auth.CheckActivationCode(code+"X", hash))
+
+	// The hash depends on the key
+	config.AppConfig.ActivationCodeKey = "activation-test-code-key"
+	assert.False(t, auth.CheckActivationCode(code, hash))
+
+	// The lookup has its own key
+	derived := auth.ActivationCodeLookup(code)
+	assert.NotEqual(t, lookup, derived)
+	config.AppConfig.ActivationLookupKey = "activation-test-lookup-key"
+	assert.NotEqual(t, derived, auth.ActivationCodeLookup(code))
+
+	other, err := auth.GenerateActivationCode()
+	assert.NoError(t, err)
+	assert.NotEqual(t, code, other)
+}
+
+func TestValidateActivationCode(t *testing.T) {
+	assert.ErrorIs(t, auth.ValidateActivationCode("ABCDEFGH"), cerror.ErrWeakActivationCode)
+	assert.ErrorIs(t, auth.ValidateActivationCode("  ABCDEFGH  "), cerror.ErrWeakActivationCode)
+	assert.NoError(t, auth.ValidateActivationCode("ABCDEFGHJK"))
+}
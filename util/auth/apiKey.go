@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ApiKeyPrefix starts every API key so Protect can tell keys from tokens
+const ApiKeyPrefix = "epk_"
+
+// ApiKeyStore authenticates API keys of machine integrations
+type ApiKeyStore interface {
+	// AuthenticateApiKey returns the claims of a valid key used from ip and
+	// records the use
+	AuthenticateApiKey(key, ip string) (*Claims, error)
+}
+
+var (
+	apiKeyStore ApiKeyStore
+	apiKeyMutex = sync.RWMutex{}
+)
+
+// SetApiKeyStore replaces the store consulted by AuthenticateApiKey
+func SetApiKeyStore(store ApiKeyStore) {
+	apiKeyMutex.Lock()
+	defer apiKeyMutex.Unlock()
+	apiKeyStore = store
+}
+
+func getApiKeyStore() ApiKeyStore {
+	apiKeyMutex.RLock()
+	defer apiKeyMutex.RUnlock()
+	return apiKeyStore
+}
+
+// AuthenticateApiKey checks a key with the configured store, every key is
+// rejected while no store is configured
+func AuthenticateApiKey(key, ip string) (*Claims, error) {
+	store := getApiKeyStore()
+	if store == nil {
+		return nil, cerror.ErrInvalidApiKey
+	}
+	return store.AuthenticateApiKey(key, ip)
+}
+
+// IsApiKey reports whether a bearer credential is an API key
+func IsApiKey(credential string) bool {
+	return strings.HasPrefix(credential, ApiKeyPrefix)
+}
+
+// GenerateApiKey returns a new random API key
+func GenerateApiKey() (string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return ApiKeyPrefix + token, nil
+}
+
+// HashApiKey hashes a key for storage, keys are random so a fast hash is enough
+func HashApiKey(key string) string {
+	return HashOpaqueToken(key)
+}
+
+// HasPermissions reports whether the role of the caller has every given
+// permission, requests made with an API key are also limited to its scopes
+func (c *Claims) HasPermissions(permissions ...model.Permission) bool {
+	if !HasPermissions(c.Role, permissions...) {
+		return false
+	}
+	if c.ApiKey == "" {
+		return true
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(c.Scopes, permission) {
+			return false
+		}
+	}
+	return true
+}
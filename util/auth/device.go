@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"ePrometna_Server/util/cerror"
+	"sync"
+)
+
+// DeviceStore knows which device token is current for every registered device
+type DeviceStore interface {
+	// IsCurrentDeviceToken reports whether the token is the one issued to the
+	// device named in its claims and the device is still registered to the user
+	IsCurrentDeviceToken(claims *Claims, token string) bool
+	// TouchDevice records that the device named in claims was used from ip
+	TouchDevice(claims *Claims, ip string)
+	// VerifyDeviceSignature checks the signature of a challenge nonce with the
+	// key of the caller's device, method and path are part of the signed message
+	VerifyDeviceSignature(claims *Claims, nonce, signature, method, path string) error
+}
+
+var (
+	deviceStore DeviceStore
+	deviceMutex = sync.RWMutex{}
+)
+
+// SetDeviceStore replaces the store consulted by IsCurrentDeviceToken
+func SetDeviceStore(store DeviceStore) {
+	deviceMutex.Lock()
+	defer deviceMutex.Unlock()
+	deviceStore = store
+}
+
+func getDeviceStore() DeviceStore {
+	deviceMutex.RLock()
+	defer deviceMutex.RUnlock()
+	return deviceStore
+}
+
+// IsCurrentDeviceToken checks the configured store, tokens without a device
+// claim and every token while no store is configured are rejected
+func IsCurrentDeviceToken(claims *Claims, token string) bool {
+	if claims == nil || claims.Device == "" {
+		return false
+	}
+	store := getDeviceStore()
+	if store == nil {
+		return false
+	}
+	return store.IsCurrentDeviceToken(claims, token)
+}
+
+// TouchDevice records the use of a device in the configured store
+func TouchDevice(claims *Claims, ip string) {
+	if store := getDeviceStore(); store != nil && claims != nil && claims.Device != "" {
+		store.TouchDevice(claims, ip)
+	}
+}
+
+// VerifyDeviceSignature checks a signed challenge with the configured store,
+// every signature is rejected while no store is configured
+func VerifyDeviceSignature(claims *Claims, nonce, signature, method, path string) error {
+	store := getDeviceStore()
+	if store == nil || claims == nil {
+		return cerror.ErrInvalidSignature
+	}
+	return store.VerifyDeviceSignature(claims, nonce, signature, method, path)
+}
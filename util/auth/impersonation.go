@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// ImpersonatedRequest is a request made with an impersonation token
+type ImpersonatedRequest struct {
+	Claims *Claims
+	Method string
+	Path   string
+	Ip     string
+	Status int
+	// Blocked is set when the request was refused because of the impersonation
+	Blocked bool
+}
+
+// ImpersonationAuditor keeps the audit trail of impersonated requests
+type ImpersonationAuditor interface {
+	// RecordImpersonatedRequest writes a request to the audit trail
+	RecordImpersonatedRequest(request ImpersonatedRequest)
+}
+
+var (
+	impersonationAuditor ImpersonationAuditor
+	impersonationMutex   = sync.RWMutex{}
+)
+
+// SetImpersonationAuditor replaces the auditor used by RecordImpersonatedRequest
+func SetImpersonationAuditor(auditor ImpersonationAuditor) {
+	impersonationMutex.Lock()
+	defer impersonationMutex.Unlock()
+	impersonationAuditor = auditor
+}
+
+func getImpersonationAuditor() ImpersonationAuditor {
+	impersonationMutex.RLock()
+	defer impersonationMutex.RUnlock()
+	return impersonationAuditor
+}
+
+// RecordImpersonatedRequest writes a request to the configured auditor, while
+// no auditor is configured the request is only logged
+func RecordImpersonatedRequest(request ImpersonatedRequest) {
+	if auditor := getImpersonationAuditor(); auditor != nil {
+		auditor.RecordImpersonatedRequest(request)
+		return
+	}
+	zap.S().Warnf("Impersonated request %s %s by %s as %s is not audited",
+		request.Method, request.Path, request.Claims.Actor.Uuid, request.Claims.Uuid)
+}
+
+// IsImpersonation reports whether the claims belong to an impersonation token
+func (c *Claims) IsImpersonation() bool {
+	return c.Actor != nil
+}
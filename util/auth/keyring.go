@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"ePrometna_Server/config"
+	"ePrometna_Server/util/cerror"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+
+	// JwksMaxAge is how long verifiers may cache the published keys, a new
+	// key only signs once every cached set has it
+	JwksMaxAge = 5 * time.Minute
+)
+
+// SigningKey is a parsed key pair, PrivateKey is nil for keys that only verify
+type SigningKey struct {
+	Kid        string
+	Method     jwt.SigningMethod
+	PrivateKey any
+	PublicKey  any
+}
+
+// Keyring holds the key used to sign new tokens and every key tokens are verified with
+type Keyring struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+	// legacyBefore is when the first signing key was created, only HS256
+	// tokens issued before it may still be valid
+	legacyBefore time.Time
+}
+
+var keyring atomic.Pointer[Keyring]
+
+// SetKeyring installs the keyring used by token generation and parsing,
+// with nil tokens are signed with HS256 and config.AppConfig.AccessKey
+func SetKeyring(k *Keyring) {
+	keyring.Store(k)
+}
+
+// CurrentKeyring returns installed keyring or nil
+func CurrentKeyring() *Keyring {
+	return keyring.Load()
+}
+
+// NewKeyring creates a keyring that signs with key signingKid and verifies with all keys
+func NewKeyring(signingKid string, keys ...*SigningKey) (*Keyring, error) {
+	k := &Keyring{keys: map[string]*SigningKey{}}
+	for _, key := range keys {
+		k.keys[key.Kid] = key
+	}
+
+	signing, ok := k.keys[signingKid]
+	if !ok || signing.PrivateKey == nil {
+		return nil, cerror.ErrUnknownSigningKey
+	}
+	k.signing = signing
+
+	return k, nil
+}
+
+// WithLegacyCutoff sets when the first signing key was created, HS256 tokens
+// issued later or verified after every token issued before could expire are rejected
+func (k *Keyring) WithLegacyCutoff(firstKeyCreatedAt time.Time) *Keyring {
+	k.legacyBefore = firstKeyCreatedAt
+	return k
+}
+
+// acceptsLegacy reports whether an HS256 token with given claims was issued
+// before signing keys and could still be valid
+func (k *Keyring) acceptsLegacy(claims jwt.Claims, now time.Time) bool {
+	c, ok := claims.(*Claims)
+	if !ok || c.IssuedAt == nil || k.legacyBefore.IsZero() {
+		return false
+	}
+	return c.IssuedAt.Time.Before(k.legacyBefore) && now.Before(k.legacyBefore.Add(MaxTokenDuration))
+}
+
+// SigningKid returns the kid of the key new tokens are signed with
+func (k *Keyring) SigningKid() string {
+	return k.signing.Kid
+}
+
+// Key returns a verification key by its kid
+func (k *Keyring) Key(kid string) (*SigningKey, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Sign signs claims with the signing key and sets the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.Kid
+	return token.SignedString(k.signing.PrivateKey)
+}
+
+// JSONWebKey is a public key in JWK format (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns public keys of the keyring
+func (k *Keyring) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if k == nil {
+		return set
+	}
+
+	for _, key := range k.keys {
+		jwk := JSONWebKey{
+			Use: "sig",
+			Alg: key.Method.Alg(),
+			Kid: key.Kid,
+		}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+// GenerateKeyPair generates a new key pair for given algorithm and returns it PEM encoded
+// (private key as PKCS #8, public key as PKIX)
+func GenerateKeyPair(alg string) (string, string, error) {
+	var private, public any
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return "", "", err
+		}
+		private, public = key, &key.PublicKey
+	case AlgEdDSA:
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", err
+		}
+		private, public = key, pub
+	default:
+		return "", "", fmt.Errorf("%w: %s", cerror.ErrUnsupportedAlgorithm, alg)
+	}
+
+	privateDer, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", "", err
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", "", err
+	}
+
+	privatePem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})
+	return string(privatePem), string(publicPem), nil
+}
+
+// ParseSigningKey parses PEM encoded keys created by GenerateKeyPair,
+// privatePem can be empty for a verification only key
+func ParseSigningKey(kid, alg, privatePem, publicPem string) (*SigningKey, error) {
+	key := &SigningKey{Kid: kid}
+	switch alg {
+	case AlgRS256:
+		key.Method = jwt.SigningMethodRS256
+	case AlgEdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: %s", cerror.ErrUnsupportedAlgorithm, alg)
+	}
+
+	block, _ := pem.Decode([]byte(publicPem))
+	if block == nil {
+		return nil, fmt.Errorf("public key of %s is not PEM encoded", kid)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key.PublicKey = public
+
+	if privatePem != "" {
+		block, _ := pem.Decode([]byte(privatePem))
+		if block == nil {
+			return nil, fmt.Errorf("private key of %s is not PEM encoded", kid)
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = private
+	}
+
+	// Make sure key types match the algorithm so tokens can't switch it
+	switch alg {
+	case AlgRS256:
+		_, okPub := key.PublicKey.(*rsa.PublicKey)
+		_, okPriv := key.PrivateKey.(*rsa.PrivateKey)
+		if !okPub || (key.PrivateKey != nil && !okPriv) {
+			return nil, fmt.Errorf("%w: %s is not an RSA key", cerror.ErrUnsupportedAlgorithm, kid)
+		}
+	case AlgEdDSA:
+		_, okPub := key.PublicKey.(ed25519.PublicKey)
+		_, okPriv := key.PrivateKey.(ed25519.PrivateKey)
+		if !okPub || (key.PrivateKey != nil && !okPriv) {
+			return nil, fmt.Errorf("%w: %s is not an Ed25519 key", cerror.ErrUnsupportedAlgorithm, kid)
+		}
+	}
+
+	return key, nil
+}
+
+// signAccessClaims signs access and device tokens with the installed keyring,
+// without it the legacy HS256 access key is used
+func signAccessClaims(claims jwt.Claims) (string, error) {
+	if ring := CurrentKeyring(); ring != nil {
+		return ring.Sign(claims)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.AppConfig.AccessKey))
+}
+
+// accessKeyFunc selects the verification key for access and device tokens
+func accessKeyFunc(token *jwt.Token) (any, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		ring := CurrentKeyring()
+		if ring == nil {
+			return nil, cerror.ErrUnknownSigningKey
+		}
+		key, ok := ring.Key(kid)
+		if !ok || key.Method.Alg() != token.Method.Alg() {
+			return nil, cerror.ErrUnknownSigningKey
+		}
+		return key.PublicKey, nil
+	}
+
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || config.AppConfig.AccessKey == "" {
+		return nil, cerror.ErrUnknownSigningKey
+	}
+	// Without a keyring new tokens are signed with ACCESS_KEY
+	ring := CurrentKeyring()
+	if ring == nil {
+		return []byte(config.AppConfig.AccessKey), nil
+	}
+	// NOTE: anyone holding ACCESS_KEY can sign tokens, only tokens issued before
+	// signing keys are accepted and only if LEGACY_ACCESS_TOKENS is on
+	if config.AppConfig.LegacyAccessTokens && ring.acceptsLegacy(token.Claims, time.Now()) {
+		return []byte(config.AppConfig.AccessKey), nil
+	}
+
+	return nil, cerror.ErrUnknownSigningKey
+}
@@ -0,0 +1,220 @@
+package auth_test
+
+import (
+	"ePrometna_Server/config"
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func newTestKey(t *testing.T, kid, alg string, withPrivate bool) *auth.SigningKey {
+	t.Helper()
+	private, public, err := auth.GenerateKeyPair(alg)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair(%s) error = %v", alg, err)
+	}
+	if !withPrivate {
+		private = ""
+	}
+	key, err := auth.ParseSigningKey(kid, alg, private, public)
+	if err != nil {
+		t.Fatalf("ParseSigningKey(%s) error = %v", alg, err)
+	}
+	return key
+}
+
+func TestKeyring_SignAndParse(t *testing.T) {
+	config.AppConfig = mockAppConfig
+	defer auth.SetKeyring(nil)
+
+	user := &model.User{Email: "keys@example.com", Uuid: uuid.New(), Role: model.RoleOsoba}
+
+	for _, alg := range []string{auth.AlgRS256, auth.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			ring, err := auth.NewKeyring("current", newTestKey(t, "current", alg, true))
+			if err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+			auth.SetKeyring(ring)
+
+			accessToken, _, err := auth.GenerateTokens(user)
+			if err != nil {
+				t.Fatalf("GenerateTokens() error = %v", err)
+			}
+
+			token, claims, err := auth.ParseToken("Bearer " + accessToken)
+			if err != nil {
+				t.Fatalf("ParseToken() error = %v", err)
+			}
+			if token.Header["kid"] != "current" || token.Method.Alg() != alg {
+				t.Errorf("ParseToken() header = %v, want kid current and alg %s", token.Header, alg)
+			}
+			if claims.Uuid != user.Uuid.String() {
+				t.Errorf("ParseToken() uuid = %s, want %s", claims.Uuid, user.Uuid)
+			}
+		})
+	}
+}
+
+func TestKeyring_RotationKeepsOldTokens(t *testing.T) {
+	config.AppConfig = mockAppConfig
+	defer auth.SetKeyring(nil)
+
+	user := &model.User{Email: "rotate@example.com", Uuid: uuid.New(), Role: model.RoleOsoba}
+	oldKey := newTestKey(t, "old", auth.AlgRS256, true)
+
+	ring, _ := auth.NewKeyring("old", oldKey)
+	auth.SetKeyring(ring)
+	oldToken, _, err := auth.GenerateTokens(user)
+	if err != nil {
+		t.Fatalf("GenerateTokens() error = %v", err)
+	}
+
+	ring, _ = auth.NewKeyring("new", oldKey, newTestKey(t, "new", auth.AlgEdDSA, true))
+	auth.SetKeyring(ring)
+	if _, _, err := auth.ParseToken("Bearer " + oldToken); err != nil {
+		t.Errorf("ParseToken() of token signed with old key error = %v", err)
+	}
+
+	// Retired key is removed from the keyring
+	ring, _ = auth.NewKeyring("new", newTestKey(t, "new", auth.AlgEdDSA, true))
+	auth.SetKeyring(ring)
+	if _, _, err := auth.ParseToken("Bearer " + oldToken); err == nil {
+		t.Errorf("ParseToken() accepted token signed with retired key")
+	}
+}
+
+func TestKeyring_RejectsForeignAlgorithm(t *testing.T) {
+	config.AppConfig = mockAppConfig
+	defer auth.SetKeyring(nil)
+
+	key := newTestKey(t, "rsa", auth.AlgRS256, true)
+	ring, _ := auth.NewKeyring("rsa", key)
+	auth.SetKeyring(ring)
+
+	// HS256 token pointing to an RSA key must not verify
+	claims := &auth.Claims{
+		Uuid:             uuid.NewString(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "rsa"
+	tokenString, _ := token.SignedString([]byte("anything"))
+
+	if _, _, err := auth.ParseToken("Bearer " + tokenString); err == nil {
+		t.Errorf("ParseToken() accepted token with mismatched algorithm")
+	}
+
+	// Unknown kid
+	token = jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "unknown"
+	tokenString, _ = token.SignedString(key.PrivateKey)
+	if _, _, err := auth.ParseToken("Bearer " + tokenString); err == nil {
+		t.Errorf("ParseToken() accepted token with unknown kid")
+	}
+}
+
+func TestKeyring_LegacyHS256(t *testing.T) {
+	config.AppConfig = &config.AppConfiguration{AccessKey: "legacy-key", RefreshKey: "refresh"}
+	defer func() { config.AppConfig = mockAppConfig }()
+
+	claims := &auth.Claims{
+		Uuid:             uuid.NewString(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}
+	tokenString, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("legacy-key"))
+
+	if _, _, err := auth.ParseToken("Bearer " + tokenString); err != nil {
+		t.Errorf("ParseToken() rejected legacy token error = %v", err)
+	}
+
+	config.AppConfig.AccessKey = ""
+	if _, _, err := auth.ParseToken("Bearer " + tokenString); err == nil {
+		t.Errorf("ParseToken() accepted legacy token without ACCESS_KEY")
+	}
+}
+
+func TestKeyring_LegacyHS256Cutoff(t *testing.T) {
+	config.AppConfig = &config.AppConfiguration{AccessKey: "legacy-key", RefreshKey: "refresh", LegacyAccessTokens: true}
+	defer func() { config.AppConfig = mockAppConfig }()
+	defer auth.SetKeyring(nil)
+
+	legacyToken := func(issuedAt time.Time) string {
+		claims := &auth.Claims{
+			Uuid: uuid.NewString(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+		tokenString, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("legacy-key"))
+		return tokenString
+	}
+
+	firstKeyAt := time.Now().Add(-time.Hour)
+	ring, err := auth.NewKeyring("kid-1", newTestKey(t, "kid-1", auth.AlgEdDSA, true))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	auth.SetKeyring(ring.WithLegacyCutoff(firstKeyAt))
+
+	issuedBefore := legacyToken(firstKeyAt.Add(-time.Minute))
+	if _, _, err := auth.ParseToken("Bearer " + issuedBefore); err != nil {
+		t.Errorf("ParseToken() rejected token issued before the first key error = %v", err)
+	}
+	if _, _, err := auth.ParseToken("Bearer " + legacyToken(time.Now())); err == nil {
+		t.Errorf("ParseToken() accepted newly minted HS256 token")
+	}
+
+	config.AppConfig.LegacyAccessTokens = false
+	if _, _, err := auth.ParseToken("Bearer " + issuedBefore); err == nil {
+		t.Errorf("ParseToken() accepted legacy token with LEGACY_ACCESS_TOKENS off")
+	}
+
+	// Every token issued before the first key has expired by now
+	config.AppConfig.LegacyAccessTokens = true
+	longAgo := time.Now().Add(-auth.MaxTokenDuration - time.Hour)
+	ring.WithLegacyCutoff(longAgo)
+	if _, _, err := auth.ParseToken("Bearer " + legacyToken(longAgo.Add(-time.Minute))); err == nil {
+		t.Errorf("ParseToken() accepted legacy token after the old token lifetime")
+	}
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	ring, err := auth.NewKeyring("a",
+		newTestKey(t, "a", auth.AlgRS256, true),
+		newTestKey(t, "b", auth.AlgEdDSA, false),
+	)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	set := ring.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(set.Keys))
+	}
+	if k := set.Keys[0]; k.Kid != "a" || k.Kty != "RSA" || k.Alg != "RS256" || k.N == "" || k.E != "AQAB" {
+		t.Errorf("JWKS() RSA key = %+v", k)
+	}
+	if k := set.Keys[1]; k.Kid != "b" || k.Kty != "OKP" || k.Crv != "Ed25519" || k.Alg != "EdDSA" || k.X == "" {
+		t.Errorf("JWKS() Ed25519 key = %+v", k)
+	}
+
+	var empty *auth.Keyring
+	if got := empty.JWKS(); got.Keys == nil || len(got.Keys) != 0 {
+		t.Errorf("JWKS() of nil keyring = %+v, want empty set", got)
+	}
+}
+
+func TestNewKeyring_RequiresPrivateSigningKey(t *testing.T) {
+	if _, err := auth.NewKeyring("verify", newTestKey(t, "verify", auth.AlgEdDSA, false)); err == nil {
+		t.Errorf("NewKeyring() accepted a signing key without private key")
+	}
+	if _, _, err := auth.GenerateKeyPair("HS256"); err == nil {
+		t.Errorf("GenerateKeyPair() accepted HS256")
+	}
+}
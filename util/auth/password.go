@@ -1,21 +1,114 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
 	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// argon2Params are encoded in the PHC string so they can be changed later,
+// hashes with other params are rehashed on login
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+// NOTE: OWASP recommended minimum for argon2id
+var defaultArgon2 = argon2Params{
+	memory:  19 * 1024,
+	time:    2,
+	threads: 1,
+	keyLen:  32,
+	saltLen: 16,
+}
+
+const argon2Prefix = "$argon2id$"
+
+var errBadPasswordHash = errors.New("bad password hash format")
+
+// VerifyPassword checks a password against an argon2id PHC string or a bcrypt hash
 func VerifyPassword(hashedPassword, plainPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-	return err == nil
+	if !strings.HasPrefix(hashedPassword, argon2Prefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
+		return err == nil
+	}
+
+	params, salt, hash, err := decodeArgon2(hashedPassword)
+	if err != nil {
+		zap.S().Debugf("Failed to decode password hash err = %+v", err)
+		return false
+	}
+
+	other := argon2.IDKey([]byte(plainPassword), salt, params.time, params.memory, params.threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, other) == 1
 }
 
+// HashPassword returns an argon2id hash in PHC string format
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	salt := make([]byte, defaultArgon2.saltLen)
+	if _, err := rand.Read(salt); err != nil {
 		zap.S().Debugf("Failed to hash password err = %+v", err)
 		return "", err
 	}
 
-	return string(hash), nil
+	p := defaultArgon2
+	hash := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// NeedsRehash reports whether a hash uses an old scheme or old params
+func NeedsRehash(hashedPassword string) bool {
+	params, salt, hash, err := decodeArgon2(hashedPassword)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != defaultArgon2.memory ||
+		params.time != defaultArgon2.time ||
+		params.threads != defaultArgon2.threads ||
+		uint32(len(hash)) != defaultArgon2.keyLen ||
+		uint32(len(salt)) != defaultArgon2.saltLen
+}
+
+// decodeArgon2 parses $argon2id$v=19$m=...,t=...,p=...$salt$hash
+func decodeArgon2(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errBadPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errBadPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, errBadPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errBadPasswordHash
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return params, nil, nil, errBadPasswordHash
+	}
+
+	return params, salt, hash, nil
 }
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/i18n"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPasswordLength bounds the work done by hashing
+const MaxPasswordLength = 128
+
+// Password policy violation codes, they are also i18n message keys
+const (
+	ViolationTooShort = "password.too_short"
+	ViolationTooLong  = "password.too_long"
+	ViolationClasses  = "password.classes"
+	ViolationBreached = "password.breached"
+)
+
+// PasswordViolation is a single broken rule, Args are used to format its message
+type PasswordViolation struct {
+	Code string
+	Args []any
+}
+
+// Message returns the localized description of the violation
+func (v PasswordViolation) Message(lang string) string {
+	return i18n.T(lang, v.Code, v.Args...)
+}
+
+// PasswordPolicyError lists every rule a password breaks, it wraps cerror.ErrWeakPassword
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		codes = append(codes, v.Code)
+	}
+	return cerror.ErrWeakPassword.Error() + ": " + strings.Join(codes, ", ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return cerror.ErrWeakPassword
+}
+
+// PasswordPolicy are the rules new passwords have to satisfy
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is the number of character classes (lowercase, uppercase,
+	// digits, symbols) a password must contain
+	MinClasses int
+	// breached contains lowercase passwords and uppercase SHA-1 hex digests
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy creates a policy, breachedFile is optional and contains one
+// password or SHA-1 hex digest (HIBP format "HASH:count" is accepted) per line
+func NewPasswordPolicy(minLength, minClasses int, breachedFile string) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:  minLength,
+		MinClasses: min(minClasses, 4),
+		breached:   map[string]struct{}{},
+	}
+	if breachedFile == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(breachedFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSha1Hex(hash) {
+			policy.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		policy.breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// BreachedCount returns the number of entries in the breached list
+func (p *PasswordPolicy) BreachedCount() int {
+	return len(p.breached)
+}
+
+// Validate returns a *PasswordPolicyError if the password breaks any rule
+func (p *PasswordPolicy) Validate(password string) error {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{Code: ViolationTooShort, Args: []any{p.MinLength}})
+	}
+	if length > MaxPasswordLength {
+		violations = append(violations, PasswordViolation{Code: ViolationTooLong, Args: []any{MaxPasswordLength}})
+	}
+	if characterClasses(password) < p.MinClasses {
+		violations = append(violations, PasswordViolation{Code: ViolationClasses, Args: []any{p.MinClasses}})
+	}
+	if p.isBreached(password) {
+		violations = append(violations, PasswordViolation{Code: ViolationBreached})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) isBreached(password string) bool {
+	if len(p.breached) == 0 {
+		return false
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return true
+	}
+	sum := sha1.Sum([]byte(password))
+	_, ok := p.breached[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return ok
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+func isSha1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+var passwordPolicy atomic.Pointer[PasswordPolicy]
+
+// SetPasswordPolicy installs the policy used by ValidatePassword, nil disables it
+func SetPasswordPolicy(policy *PasswordPolicy) {
+	passwordPolicy.Store(policy)
+}
+
+// ValidatePassword checks a new password against the installed policy
+func ValidatePassword(password string) error {
+	policy := passwordPolicy.Load()
+	if policy == nil {
+		return nil
+	}
+	return policy.Validate(password)
+}
@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/i18n"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	require.ErrorAs(t, err, &policyErr)
+	require.ErrorIs(t, err, cerror.ErrWeakPassword)
+
+	codes := []string{}
+	for _, v := range policyErr.Violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	// SHA-1 of "Summer2024!" in HIBP format
+	breached := "# leaked\nletmein\n7E8B0A3433F1210A9699D85420E363A1B162ECAC:42\n"
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(file, []byte(breached), 0o600))
+
+	policy, err := auth.NewPasswordPolicy(8, 3, file)
+	require.NoError(t, err)
+	assert.Equal(t, 2, policy.BreachedCount())
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "Valid", password: "Pa$$w0rd", want: nil},
+		{name: "Unicode letters count as classes", password: "Šifra1234", want: nil},
+		{name: "Too short", password: "Pa$$w0", want: []string{auth.ViolationTooShort}},
+		{name: "Too few classes", password: "password123", want: []string{auth.ViolationClasses}},
+		{name: "Too long", password: "Aa1!" + strings.Repeat("a", auth.MaxPasswordLength), want: []string{auth.ViolationTooLong}},
+		{name: "Breached plain", password: "LetMeIn", want: []string{auth.ViolationTooShort, auth.ViolationClasses, auth.ViolationBreached}},
+		{name: "Breached hash", password: "Summer2024!", want: []string{auth.ViolationBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, violationCodes(t, policy.Validate(tt.password)))
+		})
+	}
+}
+
+func TestPasswordPolicy_MissingFile(t *testing.T) {
+	_, err := auth.NewPasswordPolicy(8, 3, filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestPasswordViolation_Message(t *testing.T) {
+	v := auth.PasswordViolation{Code: auth.ViolationTooShort, Args: []any{10}}
+
+	assert.Equal(t, "Password must be at least 10 characters long", v.Message(i18n.En))
+	assert.Equal(t, "Lozinka mora imati najmanje 10 znakova", v.Message(i18n.Hr))
+}
+
+func TestValidatePassword(t *testing.T) {
+	t.Cleanup(func() { auth.SetPasswordPolicy(nil) })
+
+	assert.NoError(t, auth.ValidatePassword("x"), "No policy installed")
+
+	policy, err := auth.NewPasswordPolicy(8, 0, "")
+	require.NoError(t, err)
+	auth.SetPasswordPolicy(policy)
+
+	assert.ErrorIs(t, auth.ValidatePassword("x"), cerror.ErrWeakPassword)
+	assert.NoError(t, auth.ValidatePassword("longenough"))
+}
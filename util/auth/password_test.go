@@ -2,6 +2,7 @@ package auth_test
 
 import (
 	"ePrometna_Server/util/auth"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/bcrypt"
@@ -11,6 +12,7 @@ func TestVerifyPassword(t *testing.T) {
 	hashedCorrect, _ := bcrypt.GenerateFromPassword([]byte("securePassword"), bcrypt.DefaultCost)
 	hashedWrong, _ := bcrypt.GenerateFromPassword([]byte("anotherPassword"), bcrypt.DefaultCost)
 	hashedEmpty, _ := bcrypt.GenerateFromPassword([]byte(""), bcrypt.DefaultCost)
+	argonCorrect, _ := auth.HashPassword("securePassword")
 
 	tests := []struct {
 		name           string
@@ -48,6 +50,30 @@ func TestVerifyPassword(t *testing.T) {
 			plainPassword:  "",
 			want:           true,
 		},
+		{
+			name:           "Argon2id correct password",
+			hashedPassword: argonCorrect,
+			plainPassword:  "securePassword",
+			want:           true,
+		},
+		{
+			name:           "Argon2id incorrect password",
+			hashedPassword: argonCorrect,
+			plainPassword:  "wrongPassword",
+			want:           false,
+		},
+		{
+			name:           "Argon2id with other params",
+			hashedPassword: "$argon2id$v=19$m=4096,t=1,p=1$c29tZXNhbHRzb21lc2FsdA$" + "8pMPmPzQ0f0MkDjVp4eoBLuUTL7w4ShhzxWz+bVCc4s",
+			plainPassword:  "securePassword",
+			want:           false,
+		},
+		{
+			name:           "Malformed argon2id hash",
+			hashedPassword: "$argon2id$v=19$m=bad$salt$hash",
+			plainPassword:  "securePassword",
+			want:           false,
+		},
 		{
 			name:           "Different correct passwords",
 			hashedPassword: string(hashedWrong),
@@ -81,7 +107,7 @@ func TestHashPassword(t *testing.T) {
 		{
 			name:         "Empty password",
 			password:     "",
-			wantNonEmpty: true, // bcrypt will hash an empty string
+			wantNonEmpty: true, // argon2id will hash an empty string
 			wantErr:      false,
 		},
 	}
@@ -100,11 +126,28 @@ func TestHashPassword(t *testing.T) {
 			}
 			if got != "" && err == nil {
 				// Basic verification that the hash works (not exhaustive)
-				err := bcrypt.CompareHashAndPassword([]byte(got), []byte(tt.password))
-				if err != nil {
-					t.Errorf("HashPassword() generated an invalid hash for password: %s, error: %v", tt.password, err)
+				if !strings.HasPrefix(got, "$argon2id$v=19$") {
+					t.Errorf("HashPassword() = %s, want an argon2id PHC string", got)
+				}
+				if !auth.VerifyPassword(got, tt.password) {
+					t.Errorf("HashPassword() generated an invalid hash for password: %s", tt.password)
 				}
 			}
 		})
 	}
 }
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("securePassword"), bcrypt.MinCost)
+	argonHash, _ := auth.HashPassword("securePassword")
+
+	if !auth.NeedsRehash(string(bcryptHash)) {
+		t.Errorf("NeedsRehash() = false for bcrypt hash")
+	}
+	if auth.NeedsRehash(argonHash) {
+		t.Errorf("NeedsRehash() = true for current argon2id hash")
+	}
+	if !auth.NeedsRehash("$argon2id$v=19$m=4096,t=1,p=1$c29tZXNhbHRzb21lc2FsdA$aGFzaA") {
+		t.Errorf("NeedsRehash() = false for argon2id hash with old params")
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"ePrometna_Server/model"
+	"slices"
+	"sync"
+)
+
+// PermissionStore answers which permissions a role has
+type PermissionStore interface {
+	// HasPermission reports whether the role was granted the permission
+	HasPermission(role model.UserRole, permission model.Permission) bool
+}
+
+var (
+	permissionStore PermissionStore = StaticPermissionStore(model.DefaultRolePermissions)
+	permissionMutex                 = sync.RWMutex{}
+)
+
+// SetPermissionStore replaces the store consulted by HasPermissions
+func SetPermissionStore(store PermissionStore) {
+	permissionMutex.Lock()
+	defer permissionMutex.Unlock()
+	permissionStore = store
+}
+
+func getPermissionStore() PermissionStore {
+	permissionMutex.RLock()
+	defer permissionMutex.RUnlock()
+	return permissionStore
+}
+
+// HasPermissions reports whether the role has every given permission in the configured store
+func HasPermissions(role model.UserRole, permissions ...model.Permission) bool {
+	store := getPermissionStore()
+	for _, permission := range permissions {
+		if !store.HasPermission(role, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// StaticPermissionStore is a fixed assignment of permissions, it is used
+// until permissions are loaded from the database
+type StaticPermissionStore map[model.UserRole][]model.Permission
+
+// HasPermission implements PermissionStore.
+func (s StaticPermissionStore) HasPermission(role model.UserRole, permission model.Permission) bool {
+	return slices.Contains(s[role], permission)
+}
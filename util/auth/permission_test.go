@@ -0,0 +1,36 @@
+package auth_test
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPermissions_Defaults(t *testing.T) {
+	assert.True(t, auth.HasPermissions(model.RoleHAK, model.PermVehicleManage, model.PermVehicleRegister))
+	assert.False(t, auth.HasPermissions(model.RoleHAK, model.PermVehicleManage, model.PermKeyManage))
+	assert.False(t, auth.HasPermissions(model.RoleOsoba, model.PermVehicleManage))
+	assert.True(t, auth.HasPermissions(model.RoleOsoba), "no permissions are always granted")
+}
+
+func TestSetPermissionStore(t *testing.T) {
+	auth.SetPermissionStore(auth.StaticPermissionStore{
+		model.RoleOsoba: {model.PermKeyManage},
+	})
+	defer auth.SetPermissionStore(auth.StaticPermissionStore(model.DefaultRolePermissions))
+
+	assert.True(t, auth.HasPermissions(model.RoleOsoba, model.PermKeyManage))
+	assert.False(t, auth.HasPermissions(model.RoleHAK, model.PermVehicleManage))
+}
+
+func TestDefaultRolePermissions_Known(t *testing.T) {
+	for role, permissions := range model.DefaultRolePermissions {
+		assert.Contains(t, model.Roles, role)
+		for _, permission := range permissions {
+			_, err := model.StoPermission(string(permission))
+			assert.NoError(t, err, "role %s has unknown permission %s", role, permission)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// RevocationStore keeps revoked tokens until they would expire on their own
+type RevocationStore interface {
+	// RevokeToken revokes a single token by its id (jti) until the given time
+	RevokeToken(jti string, until time.Time) error
+	// RevokeUser revokes every token of a user issued before the given time
+	RevokeUser(userUuid string, issuedBefore time.Time) error
+	// IsRevoked reports whether the token with given claims was revoked
+	IsRevoked(claims *Claims) bool
+}
+
+var (
+	revocationStore RevocationStore = NewMemoryRevocationStore()
+	revocationMutex                 = sync.RWMutex{}
+)
+
+// SetRevocationStore replaces the store consulted by IsRevoked
+func SetRevocationStore(store RevocationStore) {
+	revocationMutex.Lock()
+	defer revocationMutex.Unlock()
+	revocationStore = store
+}
+
+func getRevocationStore() RevocationStore {
+	revocationMutex.RLock()
+	defer revocationMutex.RUnlock()
+	return revocationStore
+}
+
+// RevokeToken revokes a token in the configured store
+func RevokeToken(jti string, until time.Time) error {
+	return getRevocationStore().RevokeToken(jti, until)
+}
+
+// RevokeUser revokes all tokens of a user issued before given time in the configured store
+func RevokeUser(userUuid string, issuedBefore time.Time) error {
+	return getRevocationStore().RevokeUser(userUuid, issuedBefore)
+}
+
+// IsRevoked checks the configured store
+func IsRevoked(claims *Claims) bool {
+	return getRevocationStore().IsRevoked(claims)
+}
+
+type userRevocation struct {
+	issuedBefore time.Time
+	until        time.Time
+}
+
+// MemoryRevocationStore is an in memory RevocationStore, entries are dropped by Cleanup
+// once every token they could match has expired
+type MemoryRevocationStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]userRevocation
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: map[string]time.Time{},
+		users:  map[string]userRevocation{},
+	}
+}
+
+// RevokeToken implements RevocationStore.
+func (m *MemoryRevocationStore) RevokeToken(jti string, until time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if current, ok := m.tokens[jti]; !ok || current.Before(until) {
+		m.tokens[jti] = until
+	}
+	return nil
+}
+
+// RevokeUser implements RevocationStore.
+func (m *MemoryRevocationStore) RevokeUser(userUuid string, issuedBefore time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if current, ok := m.users[userUuid]; ok && current.issuedBefore.After(issuedBefore) {
+		return nil
+	}
+	m.users[userUuid] = userRevocation{
+		issuedBefore: issuedBefore,
+		until:        issuedBefore.Add(MaxTokenDuration),
+	}
+	return nil
+}
+
+// IsRevoked implements RevocationStore.
+func (m *MemoryRevocationStore) IsRevoked(claims *Claims) bool {
+	if claims == nil {
+		return true
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if claims.ID != "" {
+		if _, ok := m.tokens[claims.ID]; ok {
+			return true
+		}
+	}
+
+	if rev, ok := m.users[claims.Uuid]; ok && !issuedAfter(claims, rev.issuedBefore) {
+		return true
+	}
+
+	return false
+}
+
+// issuedAfter reports whether a token was issued after t, tokens issued in
+// the same millisecond are not. Tokens without iatMs only have the seconds of
+// iat and are compared with the second of t, tokens without iat were issued
+// before revocation was possible.
+func issuedAfter(claims *Claims, t time.Time) bool {
+	if claims.IssuedAtMs != 0 {
+		return time.UnixMilli(claims.IssuedAtMs).After(t.Truncate(time.Millisecond))
+	}
+	if claims.IssuedAt == nil {
+		return false
+	}
+	return claims.IssuedAt.Time.After(t.Truncate(time.Second))
+}
+
+// Cleanup removes entries that can no longer match a valid token
+func (m *MemoryRevocationStore) Cleanup(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for jti, until := range m.tokens {
+		if now.After(until) {
+			delete(m.tokens, jti)
+		}
+	}
+	for user, rev := range m.users {
+		if now.After(rev.until) {
+			delete(m.users, user)
+		}
+	}
+}
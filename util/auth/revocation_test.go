@@ -0,0 +1,100 @@
+package auth_test
+
+import (
+	"ePrometna_Server/util/auth"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func claimsFor(userUuid, jti string, issuedAt time.Time) *auth.Claims {
+	return &auth.Claims{
+		Uuid: userUuid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       jti,
+			IssuedAt: jwt.NewNumericDate(issuedAt),
+		},
+	}
+}
+
+// claimsWithMs are the claims of a token that carries iatMs
+func claimsWithMs(userUuid string, issuedAt time.Time) *auth.Claims {
+	claims := claimsFor(userUuid, uuid.NewString(), issuedAt)
+	claims.IssuedAtMs = issuedAt.UnixMilli()
+	return claims
+}
+
+func TestMemoryRevocationStore_RevokeToken(t *testing.T) {
+	store := auth.NewMemoryRevocationStore()
+	userUuid := uuid.NewString()
+	now := time.Now()
+
+	revoked := claimsFor(userUuid, uuid.NewString(), now)
+	other := claimsFor(userUuid, uuid.NewString(), now)
+
+	if err := store.RevokeToken(revoked.ID, now.Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+
+	if !store.IsRevoked(revoked) {
+		t.Errorf("IsRevoked() = false for revoked token")
+	}
+	if store.IsRevoked(other) {
+		t.Errorf("IsRevoked() = true for token that was not revoked")
+	}
+}
+
+func TestMemoryRevocationStore_RevokeUser(t *testing.T) {
+	store := auth.NewMemoryRevocationStore()
+	userUuid := uuid.NewString()
+	cutoff := time.Now().Truncate(time.Second)
+
+	// iat has no fractions of a second, revoking later in the second still covers it
+	if err := store.RevokeUser(userUuid, cutoff.Add(700*time.Millisecond)); err != nil {
+		t.Fatalf("RevokeUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		want   bool
+	}{
+		{"Issued before cutoff", claimsFor(userUuid, uuid.NewString(), cutoff.Add(-time.Hour)), true},
+		{"Issued in the second of cutoff", claimsFor(userUuid, uuid.NewString(), cutoff), true},
+		{"Issued in the millisecond of cutoff", claimsWithMs(userUuid, cutoff.Add(700*time.Millisecond)), true},
+		{"Issued later in the second of cutoff", claimsWithMs(userUuid, cutoff.Add(701*time.Millisecond)), false},
+		{"Issued earlier in the second of cutoff", claimsWithMs(userUuid, cutoff.Add(300*time.Millisecond)), true},
+		{"Issued after cutoff", claimsFor(userUuid, uuid.NewString(), cutoff.Add(time.Second)), false},
+		{"Other user", claimsFor(uuid.NewString(), uuid.NewString(), cutoff.Add(-time.Hour)), false},
+		{"Missing iat", &auth.Claims{Uuid: userUuid}, true},
+		{"Nil claims", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.IsRevoked(tt.claims); got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStore_Cleanup(t *testing.T) {
+	store := auth.NewMemoryRevocationStore()
+	now := time.Now()
+
+	expired := claimsFor(uuid.NewString(), uuid.NewString(), now)
+	active := claimsFor(uuid.NewString(), uuid.NewString(), now)
+	_ = store.RevokeToken(expired.ID, now.Add(-time.Second))
+	_ = store.RevokeToken(active.ID, now.Add(time.Hour))
+
+	store.Cleanup(now)
+
+	if store.IsRevoked(expired) {
+		t.Errorf("Cleanup() kept an expired entry")
+	}
+	if !store.IsRevoked(active) {
+		t.Errorf("Cleanup() removed an active entry")
+	}
+}
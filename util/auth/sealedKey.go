@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"ePrometna_Server/config"
+	"ePrometna_Server/util/cerror"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// sealedKeyPrefix marks private keys and TOTP secrets encrypted for storage,
+// ones stored before that are plain
+const sealedKeyPrefix = "sealed:v1:"
+
+// IsSealed reports whether a stored private key or TOTP secret is encrypted
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, sealedKeyPrefix)
+}
+
+// SealPrivateKey encrypts a PEM private key for storage, the kid is
+// authenticated so a sealed key can't be moved to another key
+func SealPrivateKey(kid, private string) (string, error) {
+	return seal(kid, private)
+}
+
+// OpenPrivateKey returns the PEM private key of a stored one, plain keys are
+// returned as they are
+func OpenPrivateKey(kid, stored string) (string, error) {
+	private, ok, err := open(kid, stored)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", cerror.ErrUnreadableSigningKey
+	}
+	return private, nil
+}
+
+// SealTotpSecret encrypts the TOTP secret of a user for storage, it is bound
+// to the user so a sealed secret can't be copied to another account
+func SealTotpSecret(userId uint, secret string) (string, error) {
+	return seal(totpSecretData(userId), secret)
+}
+
+// OpenTotpSecret returns the TOTP secret of a stored one, secrets stored
+// before they were sealed are returned as they are
+func OpenTotpSecret(userId uint, stored string) (string, error) {
+	secret, ok, err := open(totpSecretData(userId), stored)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", cerror.ErrUnreadableMfaSecret
+	}
+	return secret, nil
+}
+
+// totpSecretData is the authenticated data of a TOTP secret, the prefix keeps
+// it apart from signing key ids
+func totpSecretData(userId uint) string {
+	return fmt.Sprintf("totp:%d", userId)
+}
+
+func seal(data, plain string) (string, error) {
+	aead, err := signingKeyCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(data))
+	return sealedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value of seal, ok is false if it can't be decrypted with
+// the configured key and data. Values that are not sealed are returned as
+// they are.
+func open(data, stored string) (string, bool, error) {
+	if !IsSealed(stored) {
+		return stored, true, nil
+	}
+
+	aead, err := signingKeyCipher()
+	if err != nil {
+		return "", false, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedKeyPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", false, nil
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(data))
+	if err != nil {
+		return "", false, nil
+	}
+	return string(plain), true, nil
+}
+
+func signingKeyCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(signingKeyEncryptionKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// signingKeyEncryptionKey is the AES-256 key of the configured secret, or
+// one derived from the refresh key so it never shares a key with tokens
+func signingKeyEncryptionKey() []byte {
+	if config.AppConfig.SigningKeyEncryptionKey != "" {
+		key := sha256.Sum256([]byte(config.AppConfig.SigningKeyEncryptionKey))
+		return key[:]
+	}
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.RefreshKey))
+	mac.Write([]byte("signing-key-encryption"))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,74 @@
+package auth_test
+
+import (
+	"ePrometna_Server/config"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"testing"
+)
+
+func TestSealPrivateKey(t *testing.T) {
+	config.AppConfig = &config.AppConfiguration{RefreshKey: "sealed-key-test-refresh-key"}
+	private, _, err := auth.GenerateKeyPair(auth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	sealed, err := auth.SealPrivateKey("kid-1", private)
+	if err != nil {
+		t.Fatalf("SealPrivateKey() error = %v", err)
+	}
+	if !auth.IsSealed(sealed) || sealed == private {
+		t.Fatalf("SealPrivateKey() = %q, want a sealed key", sealed)
+	}
+
+	opened, err := auth.OpenPrivateKey("kid-1", sealed)
+	if err != nil || opened != private {
+		t.Errorf("OpenPrivateKey() = %q, %v, want the private key", opened, err)
+	}
+	// Plain keys stored before keys were sealed are returned as they are
+	if opened, err := auth.OpenPrivateKey("kid-1", private); err != nil || opened != private {
+		t.Errorf("OpenPrivateKey(plain) = %q, %v, want the private key", opened, err)
+	}
+
+	if _, err := auth.OpenPrivateKey("kid-2", sealed); !errors.Is(err, cerror.ErrUnreadableSigningKey) {
+		t.Errorf("OpenPrivateKey(other kid) error = %v, want %v", err, cerror.ErrUnreadableSigningKey)
+	}
+	config.AppConfig.SigningKeyEncryptionKey = "other-encryption-key"
+	if _, err := auth.OpenPrivateKey("kid-1", sealed); !errors.Is(err, cerror.ErrUnreadableSigningKey) {
+		t.Errorf("OpenPrivateKey(other key) error = %v, want %v", err, cerror.ErrUnreadableSigningKey)
+	}
+}
+
+func TestSealTotpSecret(t *testing.T) {
+	config.AppConfig = &config.AppConfiguration{RefreshKey: "sealed-key-test-refresh-key"}
+	secret, err := auth.GenerateTotpSecret()
+	if err != nil {
+		t.Fatalf("GenerateTotpSecret() error = %v", err)
+	}
+
+	sealed, err := auth.SealTotpSecret(1, secret)
+	if err != nil {
+		t.Fatalf("SealTotpSecret() error = %v", err)
+	}
+	if !auth.IsSealed(sealed) || sealed == secret {
+		t.Fatalf("SealTotpSecret() = %q, want a sealed secret", sealed)
+	}
+
+	opened, err := auth.OpenTotpSecret(1, sealed)
+	if err != nil || opened != secret {
+		t.Errorf("OpenTotpSecret() = %q, %v, want the secret", opened, err)
+	}
+	if opened, err := auth.OpenTotpSecret(1, secret); err != nil || opened != secret {
+		t.Errorf("OpenTotpSecret(plain) = %q, %v, want the secret", opened, err)
+	}
+
+	if _, err := auth.OpenTotpSecret(2, sealed); !errors.Is(err, cerror.ErrUnreadableMfaSecret) {
+		t.Errorf("OpenTotpSecret(other user) error = %v, want %v", err, cerror.ErrUnreadableMfaSecret)
+	}
+	// A sealed secret is not a sealed signing key
+	if _, err := auth.OpenPrivateKey("1", sealed); !errors.Is(err, cerror.ErrUnreadableSigningKey) {
+		t.Errorf("OpenPrivateKey(totp secret) error = %v, want %v", err, cerror.ErrUnreadableSigningKey)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"ePrometna_Server/config"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/cerror"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -15,12 +17,39 @@ type Claims struct {
 	Email string         `json:"email"`
 	Uuid  string         `json:"uuid"`
 	Role  model.UserRole `json:"role"`
+	// Device is the uuid of the model.Mobile a device token was issued to
+	Device string `json:"device,omitempty"`
+	// ApiKey is the uuid of the model.ApiKey a request was made with, API key
+	// claims are never signed and Scopes limit the permissions of the role
+	ApiKey string             `json:"apiKey,omitempty"`
+	Scopes []model.Permission `json:"scopes,omitempty"`
+	// Actor is the superadmin acting as the user of an impersonation token
+	Actor *Actor `json:"act,omitempty"`
+	// IssuedAtMs is iat in milliseconds, iat has a precision of one second so
+	// user revocations compare this to keep logins made right after them
+	IssuedAtMs int64 `json:"iatMs,omitempty"`
+}
+
+// Actor identifies who really makes requests with an impersonation token
+type Actor struct {
+	Uuid  string `json:"uuid"`
+	Email string `json:"email"`
 }
 
 const (
 	accessTokenDuration  = 5 * time.Minute
-	refreshTokenDuration = 7 * 24 * time.Hour
+	RefreshTokenDuration = 7 * 24 * time.Hour
 	deviceTokenDuration  = 365 * 24 * time.Hour
+	mfaTokenDuration     = 5 * time.Minute
+
+	// ImpersonationTokenDuration is how long a superadmin can act as another user
+	ImpersonationTokenDuration = 15 * time.Minute
+
+	// mfaAudience marks tokens that only allow completing the second login step
+	mfaAudience = "mfa"
+
+	// MaxTokenDuration is the longest lifetime of any issued token
+	MaxTokenDuration = deviceTokenDuration
 )
 
 func ParseToken(authHeader string) (*jwt.Token, *Claims, error) {
@@ -31,9 +60,7 @@ func ParseToken(authHeader string) (*jwt.Token, *Claims, error) {
 	}
 	tokenString := authHeader[len("Bearer "):]
 	var claims Claims
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
-		return []byte(config.AppConfig.AccessKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &claims, accessKeyFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -41,34 +68,102 @@ func ParseToken(authHeader string) (*jwt.Token, *Claims, error) {
 	return token, &claims, nil
 }
 
+// ParseRefreshToken verifies a refresh token signature and returns its claims
+func ParseRefreshToken(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return []byte(config.AppConfig.RefreshKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(claims.Audience, mfaAudience) {
+		return nil, cerror.ErrInvalidTokenFormat
+	}
+
+	return &claims, nil
+}
+
+// GenerateMfaToken generates a short lived token proving that the password
+// was checked, it can only be exchanged for tokens with a second factor
+func GenerateMfaToken(user *model.User) (string, error) {
+	if user == nil {
+		return "", cerror.ErrUserIsNil
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Email:      user.Email,
+		Uuid:       user.Uuid.String(),
+		Role:       user.Role,
+		IssuedAtMs: now.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaTokenDuration)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.AppConfig.RefreshKey))
+}
+
+// ParseMfaToken verifies a token created by GenerateMfaToken
+func ParseMfaToken(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return []byte(config.AppConfig.RefreshKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(claims.Audience, mfaAudience) {
+		return nil, cerror.ErrInvalidTokenFormat
+	}
+
+	return &claims, nil
+}
+
 func GenerateTokens(user *model.User) (string, string, error) {
+	return GenerateTokenPair(user, uuid.NewString())
+}
+
+// GenerateTokenPair generates access and refresh tokens, refreshId is used as
+// the refresh token id (jti) so it can be tracked on the server
+func GenerateTokenPair(user *model.User, refreshId string) (string, string, error) {
 	if user == nil {
 		return "", "", cerror.ErrUserIsNil
 	}
 
+	now := time.Now()
 	accessTokenClaims := &Claims{
-		Email: user.Email,
-		Uuid:  user.Uuid.String(),
-		Role:  user.Role,
+		Email:      user.Email,
+		Uuid:       user.Uuid.String(),
+		Role:       user.Role,
+		IssuedAtMs: now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenDuration)),
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenDuration)),
 		},
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(config.AppConfig.AccessKey))
+	accessTokenString, err := signAccessClaims(accessTokenClaims)
 	if err != nil {
 		zap.S().Debugf("Failed to generate access token err = %+v", err)
 		return "", "", err
 	}
 
 	refreshTokenClaims := &Claims{
-		Email: user.Email,
-		Uuid:  user.Uuid.String(),
-		Role:  user.Role,
+		Email:      user.Email,
+		Uuid:       user.Uuid.String(),
+		Role:       user.Role,
+		IssuedAtMs: now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(refreshTokenDuration)),
+			ID:        refreshId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(RefreshTokenDuration)),
 		},
 	}
+	// NOTE: refresh tokens are only verified by this server so they stay HS256
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
 	refreshTokenString, err := refreshToken.SignedString([]byte(config.AppConfig.RefreshKey))
 	if err != nil {
@@ -79,24 +174,28 @@ func GenerateTokens(user *model.User) (string, string, error) {
 	return accessTokenString, refreshTokenString, nil
 }
 
-func GenerateDeviceToken(user *model.User) (string, error) {
+// GenerateDeviceToken generates a long lived token bound to a registered device,
+// middleware.ProtectDevice only accepts it while it is stored on that device
+func GenerateDeviceToken(user *model.User, deviceUuid uuid.UUID) (string, error) {
 	if user == nil {
 		return "", cerror.ErrUserIsNil
 	}
 
+	now := time.Now()
 	deviceTokenClaims := &Claims{
-		Email: user.Email,
-		Uuid:  user.Uuid.String(),
-		Role:  user.Role,
+		Email:      user.Email,
+		Uuid:       user.Uuid.String(),
+		Role:       user.Role,
+		Device:     deviceUuid.String(),
+		IssuedAtMs: now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(deviceTokenDuration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(deviceTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	deviceToken := jwt.NewWithClaims(jwt.SigningMethodHS256, deviceTokenClaims)
-
-	deviceTokenString, err := deviceToken.SignedString([]byte(config.AppConfig.AccessKey))
+	deviceTokenString, err := signAccessClaims(deviceTokenClaims)
 	if err != nil {
 		zap.S().Debugf("Failed to generate device token err = %+v", err)
 		return "", err
@@ -104,3 +203,35 @@ func GenerateDeviceToken(user *model.User) (string, error) {
 
 	return deviceTokenString, nil
 }
+
+// GenerateImpersonationToken generates a short lived access token of subject
+// that carries actor, sessionId is used as the token id (jti)
+func GenerateImpersonationToken(subject, actor *model.User, sessionId string) (string, error) {
+	if subject == nil || actor == nil {
+		return "", cerror.ErrUserIsNil
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Email: subject.Email,
+		Uuid:  subject.Uuid.String(),
+		Role:  subject.Role,
+		Actor: &Actor{
+			Uuid:  actor.Uuid.String(),
+			Email: actor.Email,
+		},
+		IssuedAtMs: now.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ImpersonationTokenDuration)),
+		},
+	}
+
+	token, err := signAccessClaims(claims)
+	if err != nil {
+		zap.S().Debugf("Failed to generate impersonation token err = %+v", err)
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,108 @@
+package auth_test
+
+import (
+	"ePrometna_Server/util/auth"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret for SHA1
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTotpCode_RfcVectors(t *testing.T) {
+	// Last 6 digits of the 8 digit values from RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := auth.TotpCode(rfcSecret, auth.TotpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TotpCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TotpCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	secret, err := auth.GenerateTotpSecret()
+	if err != nil {
+		t.Fatalf("GenerateTotpSecret() error = %v", err)
+	}
+	now := time.Now()
+	current := auth.TotpStep(now)
+	code, _ := auth.TotpCode(secret, current)
+	previous, _ := auth.TotpCode(secret, current-1)
+	old, _ := auth.TotpCode(secret, current-3)
+
+	if step, ok := auth.ValidateTotp(secret, code, now, 0); !ok || step != current {
+		t.Errorf("ValidateTotp() of current code = %d, %v", step, ok)
+	}
+	if _, ok := auth.ValidateTotp(secret, previous, now, 0); !ok {
+		t.Errorf("ValidateTotp() rejected code within skew")
+	}
+	if _, ok := auth.ValidateTotp(secret, old, now, 0); ok {
+		t.Errorf("ValidateTotp() accepted code outside of skew")
+	}
+	if _, ok := auth.ValidateTotp(secret, code, now, current); ok {
+		t.Errorf("ValidateTotp() accepted an already used step")
+	}
+	if _, ok := auth.ValidateTotp(secret, "12345", now, 0); ok {
+		t.Errorf("ValidateTotp() accepted a short code")
+	}
+}
+
+func TestTotpUri(t *testing.T) {
+	uri := auth.TotpUri("ePrometna", "admin@example.com", "ABC")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("TotpUri() is not a valid url: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("TotpUri() = %s, want otpauth://totp/", uri)
+	}
+	if !strings.Contains(uri, "ePrometna:admin@example.com") {
+		t.Errorf("TotpUri() = %s, missing label", uri)
+	}
+	if q := parsed.Query(); q.Get("secret") != "ABC" || q.Get("issuer") != "ePrometna" || q.Get("digits") != "6" {
+		t.Errorf("TotpUri() query = %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() returned %d codes", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("GenerateRecoveryCodes() code %q has bad format", code)
+		}
+		if seen[code] {
+			t.Errorf("GenerateRecoveryCodes() returned duplicate %q", code)
+		}
+		seen[code] = true
+	}
+
+	// Hash ignores formatting so users can type codes without the dash
+	if auth.HashRecoveryCode(codes[0]) != auth.HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Errorf("HashRecoveryCode() depends on formatting")
+	}
+}
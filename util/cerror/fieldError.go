@@ -0,0 +1,39 @@
+package cerror
+
+// FieldError is an input field that failed validation, it wraps the reason,
+// e.g. ErrInvalidOib. Several are joined with errors.Join.
+type FieldError struct {
+	// Field is the name of the field in the API, e.g. birthDate
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors returns every field error in err, nil if it has none
+func FieldErrors(err error) []*FieldError {
+	if err == nil {
+		return nil
+	}
+
+	if fieldErr, ok := err.(*FieldError); ok {
+		return []*FieldError{fieldErr}
+	}
+
+	var rez []*FieldError
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			rez = append(rez, FieldErrors(inner)...)
+		}
+	case interface{ Unwrap() error }:
+		rez = FieldErrors(e.Unwrap())
+	}
+	return rez
+}
@@ -7,14 +7,78 @@ import (
 )
 
 var (
-	ErrBadDateFormat      = fmt.Errorf("bad date format, should be %s", format.DateFormat)
-	ErrBadDateTimeFormat  = fmt.Errorf("bad date and time format, should be %s", format.DateTimeFormat)
-	ErrBadTimeFormat      = fmt.Errorf("bad time format, should be %s", format.TimeFormat)
-	ErrBadUuid            = errors.New("failed to parse uuid")
-	ErrUnknownRole        = errors.New("unknown role")
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrInvalidTokenFormat = errors.New("invalid token format")
-	ErrUserIsNil          = errors.New("user is nil")
-	ErrBadRole            = errors.New("role is not allowed")
-	ErrOutdated           = errors.New("entry expired")
+	ErrBadDateFormat        = fmt.Errorf("bad date format, should be %s", format.DateFormat)
+	ErrBadDateTimeFormat    = fmt.Errorf("bad date and time format, should be %s", format.DateTimeFormat)
+	ErrBadTimeFormat        = fmt.Errorf("bad time format, should be %s", format.TimeFormat)
+	ErrBadUuid              = errors.New("failed to parse uuid")
+	ErrUnknownRole          = errors.New("unknown role")
+	ErrInvalidCredentials   = errors.New("invalid email or password")
+	ErrInvalidTokenFormat   = errors.New("invalid token format")
+	ErrUserIsNil            = errors.New("user is nil")
+	ErrBadRole              = errors.New("role is not allowed")
+	ErrOutdated             = errors.New("entry expired")
+	ErrInvalidRefresh       = errors.New("invalid refresh token")
+	ErrRefreshReuse         = errors.New("refresh token was already used")
+	ErrUnknownSigningKey    = errors.New("unknown signing key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrMfaRequired          = errors.New("second factor is required")
+	ErrInvalidMfaToken      = errors.New("invalid or expired second factor challenge")
+	ErrInvalidMfaCode       = errors.New("invalid second factor code")
+	ErrMfaAlreadyEnrolled   = errors.New("second factor is already enrolled")
+	ErrMfaNotEnrolled       = errors.New("second factor is not enrolled")
+	ErrUnreadableMfaSecret  = errors.New("second factor secret can't be decrypted")
+	ErrSigningKeyInUse      = errors.New("signing key is in use")
+	ErrUnreadableSigningKey = errors.New("signing key can't be decrypted")
+	ErrInvalidResetToken    = errors.New("invalid or expired password reset token")
+	ErrWeakPassword         = errors.New("password does not satisfy the password policy")
+	ErrWrongPassword        = errors.New("current password is incorrect")
+	ErrTooManyAttempts      = errors.New("too many failed attempts, try again later")
+	ErrForbidden            = errors.New("access to the resource is not allowed")
+	ErrUnknownPermission    = errors.New("unknown permission")
+	ErrProtectedPermission  = errors.New("permission can't be removed from this role")
+	ErrInvalidDevice        = errors.New("device id is required")
+	ErrDeviceTaken          = errors.New("this device is already registered to another user")
+	ErrDeviceLimit          = errors.New("no more devices can be registered to your account")
+	ErrNotPoliceOfficer     = errors.New("user is not a police officer")
+	ErrWeakActivationCode   = errors.New("activation code is too short")
+	ErrNoActivationCode     = errors.New("officer has no active activation code")
+	ErrInvalidDeviceKey     = errors.New("device key must be a base64 encoded ECDSA P-256 or Ed25519 key")
+	ErrAttestationFailed    = errors.New("device key attestation failed")
+	ErrNoDeviceKey          = errors.New("device has no registered key")
+	ErrUnattestedDeviceKey  = errors.New("device key was not attested")
+	ErrInvalidSignature     = errors.New("invalid or expired device signature")
+	ErrOidcDisabled         = errors.New("sign in with an identity provider is not configured")
+	ErrOidcProvider         = errors.New("identity provider request failed")
+	ErrInvalidOidcState     = errors.New("invalid or expired sign in state")
+	ErrInvalidIdToken       = errors.New("invalid identity token")
+	ErrMissingClaim         = errors.New("identity provider did not return a required claim")
+	ErrEmailTaken           = errors.New("email is already used by another account")
+	ErrInvalidApiKey        = errors.New("invalid, expired or revoked API key")
+	ErrApiKeyIpDenied       = errors.New("API key can't be used from this address")
+	ErrScopeNotAllowed      = errors.New("scope is not granted to the role of the key")
+	ErrInvalidIpAllowlist   = errors.New("IP allowlist entries must be addresses or CIDR ranges")
+	ErrInvalidExpiry        = errors.New("expiry must be in the future and within the allowed lifetime")
+	ErrCannotImpersonate    = errors.New("user can't be impersonated")
+	ErrInvalidQuery         = errors.New("invalid list query")
+	ErrErasurePending       = errors.New("user already has a pending erasure request")
+	ErrNoPendingErasure     = errors.New("user has no pending erasure request")
+	ErrErasureNotCompleted  = errors.New("erasure request is not completed yet")
+	ErrInvalidEmailToken    = errors.New("invalid or expired email confirmation code")
+	ErrOibTaken             = errors.New("OIB is already used by another account")
+	ErrRequired             = errors.New("value is required")
+	ErrInvalidSheet         = errors.New("sheet must have a header row with the user columns")
+	ErrTooManyRows          = errors.New("sheet has too many rows")
+	ErrOrganisationExists   = errors.New("organisation with this OIB is already registered")
+	ErrUnknownOrgRole       = errors.New("unknown organisation role")
+	ErrAlreadyMember        = errors.New("user is already a member of the organisation")
+	ErrLastOwner            = errors.New("organisation must keep at least one owner")
+)
+
+// Identity validation errors, they are returned wrapped in a *FieldError
+var (
+	ErrInvalidOib       = errors.New("OIB must be 11 digits with a valid check digit")
+	ErrInvalidBirthDate = errors.New("birth date must be in the past and at most 130 years ago")
+	ErrInvalidEmail     = errors.New("email must be a valid address, e.g. ivan@example.com")
+	ErrBadPostalCode    = errors.New("postal code is not in the postal codebook")
+	ErrBadSettlement    = errors.New("settlement is not served by the postal code")
 )
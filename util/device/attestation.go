@@ -0,0 +1,64 @@
+package device
+
+import (
+	"crypto"
+	"ePrometna_Server/config"
+	"fmt"
+	"sync"
+)
+
+// AttestationVerifier checks that a device key was created by a genuine app
+// on a genuine device, e.g. with Play Integrity or App Attest
+type AttestationVerifier interface {
+	// Verify checks the attestation sent with the device info for the key
+	Verify(deviceInfo DeviceInfo, key crypto.PublicKey) error
+}
+
+var (
+	attestationVerifier AttestationVerifier
+	attestationMutex    = sync.RWMutex{}
+)
+
+// SetAttestationVerifier replaces the verifier used when devices register a
+// key, with no verifier keys are stored without being attested and can't
+// answer challenges
+func SetAttestationVerifier(verifier AttestationVerifier) {
+	attestationMutex.Lock()
+	defer attestationMutex.Unlock()
+	attestationVerifier = verifier
+}
+
+// HasAttestationVerifier reports whether a verifier is configured
+func HasAttestationVerifier() bool {
+	return getAttestationVerifier() != nil
+}
+
+// ConfigureAttestation installs the stub verifier outside of production, no
+// platform verifier exists yet. Device signatures can't be required without
+// a verifier since unattested keys can't answer challenges.
+func ConfigureAttestation(conf *config.AppConfiguration) error {
+	if conf.Env != config.Prod {
+		SetAttestationVerifier(StubAttestationVerifier{})
+	}
+	if conf.DeviceSignatures && !HasAttestationVerifier() {
+		return fmt.Errorf("DEVICE_SIGNATURES is on but no device attestation verifier is configured")
+	}
+	return nil
+}
+
+func getAttestationVerifier() AttestationVerifier {
+	attestationMutex.RLock()
+	defer attestationMutex.RUnlock()
+	return attestationVerifier
+}
+
+// StubAttestationVerifier is a local verifier for tests and development, it
+// returns Err for every attestation
+type StubAttestationVerifier struct {
+	Err error
+}
+
+// Verify implements AttestationVerifier.
+func (v StubAttestationVerifier) Verify(deviceInfo DeviceInfo, key crypto.PublicKey) error {
+	return v.Err
+}
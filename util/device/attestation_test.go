@@ -0,0 +1,22 @@
+package device_test
+
+import (
+	"ePrometna_Server/config"
+	"ePrometna_Server/util/device"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureAttestation(t *testing.T) {
+	defer device.SetAttestationVerifier(nil)
+
+	// Production has no verifier, it can't require signatures
+	device.SetAttestationVerifier(nil)
+	assert.Error(t, device.ConfigureAttestation(&config.AppConfiguration{Env: config.Prod, DeviceSignatures: true}))
+	assert.NoError(t, device.ConfigureAttestation(&config.AppConfiguration{Env: config.Prod}))
+	assert.False(t, device.HasAttestationVerifier())
+
+	assert.NoError(t, device.ConfigureAttestation(&config.AppConfiguration{Env: config.Dev, DeviceSignatures: true}))
+	assert.True(t, device.HasAttestationVerifier())
+}
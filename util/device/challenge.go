@@ -0,0 +1,117 @@
+package device
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// challengeDuration is how long a device has to sign an issued nonce
+const challengeDuration = 2 * time.Minute
+
+// IssueChallenge returns a nonce the device signs to authorize one request
+func (dm *DeviceManager) IssueChallenge(device *model.Mobile) (string, time.Time, error) {
+	if device.PublicKey == "" {
+		return "", time.Time{}, cerror.ErrNoDeviceKey
+	}
+	if device.AttestedAt == nil {
+		return "", time.Time{}, cerror.ErrUnattestedDeviceKey
+	}
+
+	nonce, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		dm.Logger.Errorf("Failed to generate nonce, error = %+v", err)
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	challenge := model.DeviceChallenge{
+		MobileId:  device.ID,
+		NonceHash: auth.HashOpaqueToken(nonce),
+		ExpiresAt: now.Add(challengeDuration),
+	}
+
+	err = dm.DB.Transaction(func(tx *gorm.DB) error {
+		// Answered and expired challenges of the device are no longer needed
+		if err := tx.
+			Unscoped().
+			Where("mobile_id = ? AND (used_at IS NOT NULL OR expires_at < ?)", device.ID, now).
+			Delete(&model.DeviceChallenge{}).
+			Error; err != nil {
+			return err
+		}
+		return tx.Create(&challenge).Error
+	})
+	if err != nil {
+		dm.Logger.Errorf("Failed to store challenge of device = %s, error = %+v", device.Uuid, err)
+		return "", time.Time{}, err
+	}
+
+	return nonce, challenge.ExpiresAt, nil
+}
+
+// VerifyDeviceSignature implements auth.DeviceStore, the challenge is used up
+// by the first answer so a signature can't be replayed
+func (dm *DeviceManager) VerifyDeviceSignature(claims *auth.Claims, nonce, signature, method, path string) error {
+	var challenge model.DeviceChallenge
+	if err := dm.DB.Where("nonce_hash = ?", auth.HashOpaqueToken(nonce)).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cerror.ErrInvalidSignature
+		}
+		dm.Logger.Errorf("Failed to query challenge, error = %+v", err)
+		return err
+	}
+
+	now := time.Now()
+	rez := dm.DB.
+		Model(&model.DeviceChallenge{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", challenge.ID, now).
+		Update("used_at", now)
+	if rez.Error != nil {
+		dm.Logger.Errorf("Failed to use challenge, error = %+v", rez.Error)
+		return rez.Error
+	}
+	if rez.RowsAffected == 0 {
+		return cerror.ErrInvalidSignature
+	}
+
+	var device model.Mobile
+	if err := dm.DB.
+		Joins("JOIN users ON users.id = mobiles.user_id AND users.deleted_at IS NULL").
+		Where("mobiles.id = ? AND users.uuid = ?", challenge.MobileId, claims.Uuid).
+		First(&device).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return cerror.ErrInvalidSignature
+		}
+		dm.Logger.Errorf("Failed to query device of challenge, error = %+v", err)
+		return err
+	}
+
+	// Device tokens may only answer challenges of their own device
+	if claims.Device != "" && claims.Device != device.Uuid.String() {
+		return cerror.ErrInvalidSignature
+	}
+	if device.PublicKey == "" {
+		return cerror.ErrNoDeviceKey
+	}
+	// NOTE: an unattested key may have been made by anything holding the
+	// device token, it can't vouch for the device
+	if device.AttestedAt == nil {
+		return cerror.ErrUnattestedDeviceKey
+	}
+
+	key, err := ParsePublicKey(device.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !VerifySignature(key, ChallengeMessage(nonce, method, path), signature) {
+		dm.Logger.Warnf("Invalid signature from device = %s of user = %s", device.Uuid, claims.Uuid)
+		return cerror.ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package device
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"ePrometna_Server/util/cerror"
+	"encoding/base64"
+)
+
+// ParsePublicKey parses a base64 encoded PKIX key registered by the mobile
+// app, ECDSA P-256 and Ed25519 keys are supported
+func ParsePublicKey(encoded string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, cerror.ErrInvalidDeviceKey
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, cerror.ErrInvalidDeviceKey
+	}
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, cerror.ErrInvalidDeviceKey
+		}
+	case ed25519.PublicKey:
+	default:
+		return nil, cerror.ErrInvalidDeviceKey
+	}
+	return key, nil
+}
+
+// ChallengeMessage is the message a device signs, it binds the nonce to the
+// request so a signature can't be used on another route
+func ChallengeMessage(nonce, method, path string) []byte {
+	return []byte(nonce + "\n" + method + "\n" + path)
+}
+
+// VerifySignature checks a base64 encoded signature of message, ECDSA
+// signatures are ASN.1 encoded over the SHA-256 digest of the message
+func VerifySignature(key crypto.PublicKey, message []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, sig)
+	default:
+		return false
+	}
+}
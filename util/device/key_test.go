@@ -0,0 +1,50 @@
+package device_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/device"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeKey(t *testing.T, key any) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	ed, _, _ := ed25519.GenerateKey(rand.Reader)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	_, err := device.ParsePublicKey(encodeKey(t, ed))
+	assert.NoError(t, err)
+	_, err = device.ParsePublicKey(encodeKey(t, &p256.PublicKey))
+	assert.NoError(t, err)
+
+	_, err = device.ParsePublicKey(encodeKey(t, &p384.PublicKey))
+	assert.ErrorIs(t, err, cerror.ErrInvalidDeviceKey)
+	_, err = device.ParsePublicKey("not base64!")
+	assert.ErrorIs(t, err, cerror.ErrInvalidDeviceKey)
+}
+
+func TestVerifySignature(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := device.ParsePublicKey(encodeKey(t, public))
+	assert.NoError(t, err)
+
+	message := device.ChallengeMessage("nonce", "PUT", "/api/tempdata/1")
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, message))
+
+	assert.True(t, device.VerifySignature(key, message, signature))
+	assert.False(t, device.VerifySignature(key, device.ChallengeMessage("nonce", "GET", "/api/tempdata/1"), signature))
+	assert.False(t, device.VerifySignature(key, message, "not base64!"))
+}
@@ -1,24 +1,36 @@
 package device
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"ePrometna_Server/app"
+	"ePrometna_Server/config"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
 	"errors"
-	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+// lastSeenInterval limits how often a device in use is written to the database
+const lastSeenInterval = time.Minute
+
 // DeviceInfo contains information about a mobile device
 type DeviceInfo struct {
 	Platform  string `json:"platform"`
 	Brand     string `json:"brand"`
 	ModelName string `json:"modelName"`
 	DeviceID  string `json:"deviceId"`
+	// PublicKey is a base64 encoded PKIX key the app signs challenges with
+	PublicKey string `json:"publicKey"`
+	// Attestation is the platform attestation of PublicKey, it is checked by
+	// the configured AttestationVerifier
+	Attestation string `json:"attestation"`
 }
 
 // DeviceManager handles device registration operations
@@ -47,10 +59,10 @@ func (dm *DeviceManager) FormatDeviceName(deviceInfo DeviceInfo) string {
 	return deviceName + " [ID:" + deviceInfo.DeviceID + "]"
 }
 
-// FindDeviceByID checks if a device with the given ID is registered to any user
+// FindDeviceByID returns the device with the given ID, it is registered to at most one user
 func (dm *DeviceManager) FindDeviceByID(deviceID string) (*model.Mobile, error) {
 	var device model.Mobile
-	result := dm.DB.Where("registered_device LIKE ?", "%"+deviceID+"%").First(&device)
+	result := dm.DB.Where("device_id = ?", deviceID).First(&device)
 
 	if result.Error != nil {
 		return nil, result.Error
@@ -71,41 +83,57 @@ func (dm *DeviceManager) FindUserDevice(userID uint) (*model.Mobile, error) {
 	return &device, nil
 }
 
-// UpdateDeviceToken updates the activation token for an existing device
+// FindUserDevices returns every device registered to a user, oldest first
+func (dm *DeviceManager) FindUserDevices(userID uint) ([]model.Mobile, error) {
+	var devices []model.Mobile
+	if err := dm.DB.Where("user_id = ?", userID).Order("created_at").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// UpdateDeviceToken issues a new activation token for an existing device, the
+// previous token is revoked
 func (dm *DeviceManager) UpdateDeviceToken(device *model.Mobile, user *model.User) (string, error) {
-	deviceToken, err := auth.GenerateDeviceToken(user)
+	deviceToken, err := auth.GenerateDeviceToken(user, device.Uuid)
 	if err != nil {
 		return "", err
 	}
 
+	oldToken := device.ActivationToken
 	device.ActivationToken = deviceToken
 	if err := dm.DB.Save(device).Error; err != nil {
 		return "", err
 	}
+	dm.revokeToken(oldToken)
 
 	return deviceToken, nil
 }
 
 // RegisterNewDevice creates a new device registration for a user
-func (dm *DeviceManager) RegisterNewDevice(user *model.User, deviceName string) (string, error) {
-	deviceToken, err := auth.GenerateDeviceToken(user)
+func (dm *DeviceManager) RegisterNewDevice(user *model.User, deviceInfo DeviceInfo) (string, error) {
+	if strings.TrimSpace(deviceInfo.DeviceID) == "" {
+		return "", cerror.ErrInvalidDevice
+	}
+
+	publicKey, attestedAt, err := dm.attestKey(deviceInfo)
 	if err != nil {
 		return "", err
 	}
 
-	newDevice := model.Mobile{
-		Uuid:             uuid.New(),
-		UserId:           user.ID,
-		CreatorId:        user.ID,
-		RegisteredDevice: deviceName,
-		ActivationToken:  deviceToken,
+	newDevice, err := dm.newDevice(user, deviceInfo, "")
+	if err != nil {
+		return "", err
 	}
+	newDevice.PublicKey = publicKey
+	newDevice.AttestedAt = attestedAt
 
-	if err := dm.DB.Create(&newDevice).Error; err != nil {
+	if err := dm.DB.Create(newDevice).Error; err != nil {
 		return "", err
 	}
 
-	return deviceToken, nil
+	return newDevice.ActivationToken, nil
 }
 
 // ValidateDeviceRegistration checks if the device can be registered or authenticated
@@ -113,18 +141,27 @@ func (dm *DeviceManager) RegisterNewDevice(user *model.User, deviceName string)
 // - deviceToken: the token if device is authenticated
 // - isNewRegistration: true if device was newly registered
 // - error: any error that occurred during the process
-func (dm *DeviceManager) ValidateDeviceRegistration(user *model.User, deviceInfo DeviceInfo) (string, bool, error) {
-	deviceIDStr := deviceInfo.DeviceID
-	deviceName := dm.FormatDeviceName(deviceInfo)
+func (dm *DeviceManager) ValidateDeviceRegistration(user *model.User, deviceInfo DeviceInfo, ip string) (string, bool, error) {
+	deviceIDStr := strings.TrimSpace(deviceInfo.DeviceID)
+	if deviceIDStr == "" {
+		return "", false, cerror.ErrInvalidDevice
+	}
+	deviceInfo.DeviceID = deviceIDStr
+
+	publicKey, attestedAt, err := dm.attestKey(deviceInfo)
+	if err != nil {
+		return "", false, err
+	}
 
 	var deviceToken string
+	var replacedToken string
 	var isNewRegistration bool
 
 	// Start a transaction with SERIALIZABLE isolation level to prevent race conditions
-	err := dm.DB.Transaction(func(tx *gorm.DB) error {
+	err = dm.DB.Transaction(func(tx *gorm.DB) error {
 		// STEP 1: Check if this device is already registered to ANY user
 		var existingDevice model.Mobile
-		result := tx.Where("registered_device LIKE ?", "%"+deviceIDStr+"%").First(&existingDevice)
+		result := tx.Where("device_id = ?", deviceIDStr).First(&existingDevice)
 
 		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			dm.Logger.Errorf("Error checking device registration: %v", result.Error)
@@ -133,68 +170,70 @@ func (dm *DeviceManager) ValidateDeviceRegistration(user *model.User, deviceInfo
 
 		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			// Device is already registered
-			if existingDevice.UserId == user.ID {
-				// Registered to THIS user, update token
-				var err error
-				deviceTokenTemp, err := auth.GenerateDeviceToken(user)
-				if err != nil {
-					dm.Logger.Errorf("Failed to generate device token: %v", err)
-					return err
-				}
-
-				existingDevice.ActivationToken = deviceTokenTemp
-				if err := tx.Save(&existingDevice).Error; err != nil {
-					dm.Logger.Errorf("Failed to update device token: %v", err)
-					return err
-				}
-
-				deviceToken = deviceTokenTemp
-				isNewRegistration = false
-				dm.Logger.Infof("Device already registered to user %s, updated token", user.Email)
-				return nil
-			} else {
-				// Registered to ANOTHER user
+			if existingDevice.UserId != user.ID {
 				dm.Logger.Warnf("Device with ID %s is already registered to another user", deviceIDStr)
-				return fmt.Errorf("this device is already registered to another user")
+				return cerror.ErrDeviceTaken
 			}
-		}
 
-		// STEP 2: Check if this user already has ANY registered device
-		var userDevice model.Mobile
-		result = tx.Where("user_id = ?", user.ID).First(&userDevice)
+			// Registered to THIS user, update token
+			deviceTokenTemp, err := auth.GenerateDeviceToken(user, existingDevice.Uuid)
+			if err != nil {
+				dm.Logger.Errorf("Failed to generate device token: %v", err)
+				return err
+			}
 
-		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			dm.Logger.Errorf("Error checking user device: %v", result.Error)
-			return result.Error
+			now := time.Now()
+			replacedToken = existingDevice.ActivationToken
+			existingDevice.ActivationToken = deviceTokenTemp
+			existingDevice.Platform = deviceInfo.Platform
+			existingDevice.Brand = deviceInfo.Brand
+			existingDevice.ModelName = deviceInfo.ModelName
+			existingDevice.RegisteredDevice = dm.FormatDeviceName(deviceInfo)
+			existingDevice.LastSeenAt = &now
+			existingDevice.LastSeenIp = ip
+			// NOTE: logins that don't send a key keep the registered one
+			if publicKey != "" {
+				existingDevice.PublicKey = publicKey
+				existingDevice.AttestedAt = attestedAt
+			}
+			if err := tx.Save(&existingDevice).Error; err != nil {
+				dm.Logger.Errorf("Failed to update device token: %v", err)
+				return err
+			}
+
+			deviceToken = deviceTokenTemp
+			isNewRegistration = false
+			dm.Logger.Infof("Device already registered to user %s, updated token", user.Email)
+			return nil
 		}
 
-		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			// User already has a registered device
-			dm.Logger.Warnf("User %s already has a different registered device", user.Email)
-			return fmt.Errorf("you already have a different device registered to your account")
+		// STEP 2: Check how many devices this user already has
+		var deviceCount int64
+		if err := tx.Model(&model.Mobile{}).Where("user_id = ?", user.ID).Count(&deviceCount).Error; err != nil {
+			dm.Logger.Errorf("Error checking user devices: %v", err)
+			return err
+		}
+
+		if limit := config.AppConfig.MaxDevices(string(user.Role)); deviceCount >= int64(limit) {
+			dm.Logger.Warnf("User %s already has %d of %d devices registered", user.Email, deviceCount, limit)
+			return cerror.ErrDeviceLimit
 		}
 
 		// STEP 3: Register new device
-		dm.Logger.Infof("Registering new device for user Email: %s, Device: %s", user.Email, deviceName)
+		dm.Logger.Infof("Registering new device for user Email: %s, Device: %s", user.Email, dm.FormatDeviceName(deviceInfo))
 
-		deviceTokenTemp, err := auth.GenerateDeviceToken(user)
+		newDevice, err := dm.newDevice(user, deviceInfo, ip)
 		if err != nil {
 			return err
 		}
+		newDevice.PublicKey = publicKey
+		newDevice.AttestedAt = attestedAt
 
-		newDevice := model.Mobile{
-			Uuid:             uuid.New(),
-			UserId:           user.ID,
-			CreatorId:        user.ID,
-			RegisteredDevice: deviceName,
-			ActivationToken:  deviceTokenTemp,
-		}
-
-		if err := tx.Create(&newDevice).Error; err != nil {
+		if err := tx.Create(newDevice).Error; err != nil {
 			return err
 		}
 
-		deviceToken = deviceTokenTemp
+		deviceToken = newDevice.ActivationToken
 		isNewRegistration = true
 		return nil
 	}, &sql.TxOptions{
@@ -204,5 +243,126 @@ func (dm *DeviceManager) ValidateDeviceRegistration(user *model.User, deviceInfo
 		return "", false, err
 	}
 
+	dm.revokeToken(replacedToken)
 	return deviceToken, isNewRegistration, nil
 }
+
+// IsCurrentDeviceToken implements auth.DeviceStore, a token stops matching once
+// the device is removed or a new token is issued to it on the next login
+func (dm *DeviceManager) IsCurrentDeviceToken(claims *auth.Claims, token string) bool {
+	var device model.Mobile
+	err := dm.DB.
+		Joins("JOIN users ON users.id = mobiles.user_id AND users.deleted_at IS NULL").
+		Where("mobiles.uuid = ? AND users.uuid = ?", claims.Device, claims.Uuid).
+		First(&device).
+		Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			dm.Logger.Errorf("Failed to query device = %s, error = %+v", claims.Device, err)
+		}
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(device.ActivationToken), []byte(token)) == 1
+}
+
+// TouchDevice implements auth.DeviceStore, a device in use is written at most
+// once per lastSeenInterval
+func (dm *DeviceManager) TouchDevice(claims *auth.Claims, ip string) {
+	now := time.Now()
+	err := dm.DB.
+		Model(&model.Mobile{}).
+		Where("uuid = ? AND (last_seen_at IS NULL OR last_seen_at < ? OR last_seen_ip <> ?)", claims.Device, now.Add(-lastSeenInterval), ip).
+		Updates(map[string]any{"last_seen_at": now, "last_seen_ip": ip}).
+		Error
+	if err != nil {
+		dm.Logger.Errorf("Failed to update last seen of device = %s, error = %+v", claims.Device, err)
+	}
+}
+
+// RevokeDevices removes devices and revokes their activation tokens, tokens
+// already issued to a device also work on routes that don't check the device
+func (dm *DeviceManager) RevokeDevices(devices []model.Mobile) error {
+	if len(devices) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+	if err := dm.DB.Unscoped().Where("id IN ?", ids).Delete(&model.Mobile{}).Error; err != nil {
+		dm.Logger.Errorf("Failed to delete devices, error = %+v", err)
+		return err
+	}
+
+	for _, device := range devices {
+		dm.revokeToken(device.ActivationToken)
+	}
+	return nil
+}
+
+func (dm *DeviceManager) newDevice(user *model.User, deviceInfo DeviceInfo, ip string) (*model.Mobile, error) {
+	deviceUuid := uuid.New()
+	deviceToken, err := auth.GenerateDeviceToken(user, deviceUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &model.Mobile{
+		Uuid:             deviceUuid,
+		UserId:           user.ID,
+		CreatorId:        user.ID,
+		Platform:         deviceInfo.Platform,
+		Brand:            deviceInfo.Brand,
+		ModelName:        deviceInfo.ModelName,
+		DeviceId:         deviceInfo.DeviceID,
+		RegisteredDevice: dm.FormatDeviceName(deviceInfo),
+		ActivationToken:  deviceToken,
+		LastSeenAt:       &now,
+		LastSeenIp:       ip,
+	}, nil
+}
+
+// attestKey checks the key sent with a registration, devices may register
+// without a key but then can't call routes that need a signed challenge
+func (dm *DeviceManager) attestKey(deviceInfo DeviceInfo) (string, *time.Time, error) {
+	encoded := strings.TrimSpace(deviceInfo.PublicKey)
+	if encoded == "" {
+		return "", nil, nil
+	}
+
+	key, err := ParsePublicKey(encoded)
+	if err != nil {
+		return "", nil, err
+	}
+
+	verifier := getAttestationVerifier()
+	if verifier == nil {
+		// NOTE: the key is kept but can't answer challenges until attested
+		return encoded, nil, nil
+	}
+	if err := verifier.Verify(deviceInfo, key); err != nil {
+		dm.Logger.Warnf("Attestation of device = %s failed, error = %+v", deviceInfo.DeviceID, err)
+		return "", nil, cerror.ErrAttestationFailed
+	}
+
+	now := time.Now()
+	return encoded, &now, nil
+}
+
+// revokeToken revokes a replaced activation token until it would expire, tokens
+// that no longer verify can't be used anyway
+func (dm *DeviceManager) revokeToken(token string) {
+	if token == "" {
+		return
+	}
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	if err != nil || claims.ExpiresAt == nil {
+		return
+	}
+	if err := auth.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		dm.Logger.Errorf("Failed to revoke device token, error = %+v", err)
+	}
+}
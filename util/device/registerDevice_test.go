@@ -5,6 +5,7 @@ import (
 	"ePrometna_Server/config"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/auth" //
+	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/device"
 	"errors"
 	"fmt"
@@ -32,11 +33,14 @@ var (
 		PasswordHash: "hashedpassword",
 		Role:         model.RoleOsoba,
 		BirthDate:    time.Now().AddDate(-30, 0, 0),
-		Residence:    "123 Test St",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 	}
 	testDeviceTokenGlobal = "fixed-test-device-token"
 )
 
+// testIp is the client ip devices are registered from in tests
+const testIp = "192.0.2.10"
+
 // --- Test Suite Definition ---
 type DeviceManagerTestSuite struct {
 	suite.Suite
@@ -129,7 +133,7 @@ func (suite *DeviceManagerTestSuite) createTestUserInDB(email string, role model
 		Email:        email,
 		Role:         role,
 		BirthDate:    time.Now().AddDate(-25, 0, 0),
-		Residence:    "DB Test Residence",
+		Residence:    model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
 		PasswordHash: "db-dummy-hash",
 	}
 	err := suite.db.Create(user).Error
@@ -139,6 +143,16 @@ func (suite *DeviceManagerTestSuite) createTestUserInDB(email string, role model
 }
 
 // TestDeviceManagerSuite runs the test suite
+// assertDeviceToken checks that token is a valid device token issued for user
+func (suite *DeviceManagerTestSuite) assertDeviceToken(user *model.User, token string) {
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), user.Uuid.String(), claims.Uuid)
+	assert.Equal(suite.T(), user.Email, claims.Email)
+	assert.Equal(suite.T(), user.Role, claims.Role)
+	assert.NotEmpty(suite.T(), claims.ID)
+}
+
 func TestDeviceManagerSuite(t *testing.T) {
 	suite.Run(t, new(DeviceManagerTestSuite))
 }
@@ -193,6 +207,7 @@ func (suite *DeviceManagerTestSuite) TestFindDeviceByID_Found() {
 		Uuid:             uuid.New(),
 		UserId:           testUserGlobal.ID,
 		CreatorId:        testUserGlobal.ID,
+		DeviceId:         deviceID,
 		RegisteredDevice: "SomeBrand SomeModel (Platform) [ID:" + deviceID + "]",
 		ActivationToken:  "some-token",
 	}
@@ -218,6 +233,7 @@ func (suite *DeviceManagerTestSuite) TestFindUserDevice_Found() {
 		Uuid:             uuid.New(),
 		UserId:           testUserGlobal.ID,
 		CreatorId:        testUserGlobal.ID,
+		DeviceId:         "userDev1",
 		RegisteredDevice: "User's Registered Device [ID:userDev1]",
 		ActivationToken:  "user-device-token",
 	}
@@ -244,6 +260,7 @@ func (suite *DeviceManagerTestSuite) TestUpdateDeviceToken_Success() {
 		UserId:           testUserGlobal.ID,
 		CreatorId:        testUserGlobal.ID,
 		ActivationToken:  "old-token",
+		DeviceId:         "updDev1",
 		RegisteredDevice: "DeviceToUpdate [ID:updDev1]",
 	}
 	err := suite.db.Create(existingDevice).Error
@@ -253,31 +270,85 @@ func (suite *DeviceManagerTestSuite) TestUpdateDeviceToken_Success() {
 	assert.NoError(suite.T(), err)
 
 	// Check that the token returned by GenerateDeviceToken is what we expect
-	expectedToken, _ := auth.GenerateDeviceToken(testUserGlobal) // Generate expected token
-	assert.Equal(suite.T(), expectedToken, token)
+	suite.assertDeviceToken(testUserGlobal, token)
 
 	// Verify in DB
 	var updatedDevice model.Mobile
 	err = suite.db.First(&updatedDevice, existingDevice.ID).Error
 	suite.Require().NoError(err)
-	assert.Equal(suite.T(), expectedToken, updatedDevice.ActivationToken)
+	assert.Equal(suite.T(), token, updatedDevice.ActivationToken)
 }
 
 func (suite *DeviceManagerTestSuite) TestRegisterNewDevice_Success() {
-	deviceName := "NewBrand NewModel (Platform) [ID:newDevReg1]"
+	deviceInfo := device.DeviceInfo{Platform: "Platform", Brand: "NewBrand", ModelName: "NewModel", DeviceID: "newDevReg1"}
 
-	token, err := suite.deviceMgr.RegisterNewDevice(testUserGlobal, deviceName)
+	token, err := suite.deviceMgr.RegisterNewDevice(testUserGlobal, deviceInfo)
 	assert.NoError(suite.T(), err)
 
-	expectedToken, _ := auth.GenerateDeviceToken(testUserGlobal)
-	assert.Equal(suite.T(), expectedToken, token)
+	suite.assertDeviceToken(testUserGlobal, token)
 
 	// Verify in DB
 	var newDevice model.Mobile
-	err = suite.db.Where("registered_device = ?", deviceName).First(&newDevice).Error
+	err = suite.db.Where("device_id = ?", deviceInfo.DeviceID).First(&newDevice).Error
 	suite.Require().NoError(err)
 	assert.Equal(suite.T(), testUserGlobal.ID, newDevice.UserId)
-	assert.Equal(suite.T(), expectedToken, newDevice.ActivationToken)
+	assert.Equal(suite.T(), "Platform", newDevice.Platform)
+	assert.Equal(suite.T(), "NewBrand", newDevice.Brand)
+	assert.Equal(suite.T(), "NewModel", newDevice.ModelName)
+	assert.Equal(suite.T(), "NewBrand NewModel (Platform) [ID:newDevReg1]", newDevice.RegisteredDevice)
+	assert.Equal(suite.T(), token, newDevice.ActivationToken)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), newDevice.Uuid.String(), claims.Device)
+}
+
+// --- Tests for IsCurrentDeviceToken ---
+
+func (suite *DeviceManagerTestSuite) TestIsCurrentDeviceToken_Current() {
+	token, err := suite.deviceMgr.RegisterNewDevice(testUserGlobal, device.DeviceInfo{DeviceID: "currentDev1"})
+	suite.Require().NoError(err)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), suite.deviceMgr.IsCurrentDeviceToken(claims, token))
+}
+
+func (suite *DeviceManagerTestSuite) TestIsCurrentDeviceToken_Replaced() {
+	oldToken, err := suite.deviceMgr.RegisterNewDevice(testUserGlobal, device.DeviceInfo{DeviceID: "replacedDev1"})
+	suite.Require().NoError(err)
+
+	var mobile model.Mobile
+	suite.Require().NoError(suite.db.Where("user_id = ?", testUserGlobal.ID).First(&mobile).Error)
+	newToken, err := suite.deviceMgr.UpdateDeviceToken(&mobile, testUserGlobal)
+	suite.Require().NoError(err)
+
+	_, oldClaims, err := auth.ParseToken("Bearer " + oldToken)
+	suite.Require().NoError(err)
+	_, newClaims, err := auth.ParseToken("Bearer " + newToken)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), suite.deviceMgr.IsCurrentDeviceToken(oldClaims, oldToken))
+	assert.True(suite.T(), suite.deviceMgr.IsCurrentDeviceToken(newClaims, newToken))
+}
+
+func (suite *DeviceManagerTestSuite) TestIsCurrentDeviceToken_Unregistered() {
+	token, err := suite.deviceMgr.RegisterNewDevice(testUserGlobal, device.DeviceInfo{DeviceID: "removedDev1"})
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Where("user_id = ?", testUserGlobal.ID).Delete(&model.Mobile{}).Error)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	assert.False(suite.T(), suite.deviceMgr.IsCurrentDeviceToken(claims, token))
+}
+
+func (suite *DeviceManagerTestSuite) TestIsCurrentDeviceToken_OtherUser() {
+	token, err := suite.deviceMgr.RegisterNewDevice(testUserGlobal, device.DeviceInfo{DeviceID: "stolenDev1"})
+	suite.Require().NoError(err)
+
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	claims.Uuid = uuid.NewString()
+	assert.False(suite.T(), suite.deviceMgr.IsCurrentDeviceToken(claims, token))
 }
 
 // --- Tests for ValidateDeviceRegistration ---
@@ -286,18 +357,17 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_NewDevice_Us
 	currentUser := suite.createTestUserInDB("newdeviceuser@example.com", model.RoleOsoba)
 	deviceInfo := device.DeviceInfo{Platform: "TestOS", Brand: "TestBrand", ModelName: "TestModelX", DeviceID: "validateNewDev1"}
 
-	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfo)
+	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfo, testIp)
 
 	assert.NoError(suite.T(), err)
 	assert.True(suite.T(), isNew)
-	expectedToken, _ := auth.GenerateDeviceToken(currentUser)
-	assert.Equal(suite.T(), expectedToken, token)
+	suite.assertDeviceToken(currentUser, token)
 
 	// Verify in DB
 	var mobileDevice model.Mobile
-	err = suite.db.Where("user_id = ? AND registered_device LIKE ?", currentUser.ID, "%"+deviceInfo.DeviceID+"%").First(&mobileDevice).Error
+	err = suite.db.Where("user_id = ? AND device_id = ?", currentUser.ID, deviceInfo.DeviceID).First(&mobileDevice).Error
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), expectedToken, mobileDevice.ActivationToken)
+	assert.Equal(suite.T(), token, mobileDevice.ActivationToken)
 }
 
 func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_ExistingDevice_SameUser() {
@@ -310,24 +380,25 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_ExistingDevi
 		Uuid:             uuid.New(),
 		UserId:           currentUser.ID,
 		CreatorId:        currentUser.ID,
+		DeviceId:         deviceInfo.DeviceID,
 		RegisteredDevice: formattedName,
 		ActivationToken:  "initial-old-token",
 	}
 	err := suite.db.Create(initialDevice).Error
 	suite.Require().NoError(err)
 
-	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfo)
+	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfo, testIp)
 
 	assert.NoError(suite.T(), err)
 	assert.False(suite.T(), isNew, "Should not be a new registration")
-	expectedToken, _ := auth.GenerateDeviceToken(currentUser)
-	assert.Equal(suite.T(), expectedToken, token, "Token should be updated")
+	suite.assertDeviceToken(currentUser, token)
+	assert.NotEqual(suite.T(), "initial-old-token", token, "Token should be updated")
 
 	// Verify in DB
 	var mobileDevice model.Mobile
 	err = suite.db.First(&mobileDevice, initialDevice.ID).Error
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), expectedToken, mobileDevice.ActivationToken)
+	assert.Equal(suite.T(), token, mobileDevice.ActivationToken)
 }
 
 func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_ExistingDevice_DifferentUser() {
@@ -342,6 +413,7 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_ExistingDevi
 		Uuid:             uuid.New(),
 		UserId:           user1.ID,
 		CreatorId:        user1.ID,
+		DeviceId:         deviceInfo.DeviceID,
 		RegisteredDevice: formattedName,
 		ActivationToken:  "user1-token",
 	}
@@ -349,12 +421,12 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_ExistingDevi
 	suite.Require().NoError(err)
 
 	// user2 tries to validate with this device
-	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(user2, deviceInfo)
+	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(user2, deviceInfo, testIp)
 
 	assert.Error(suite.T(), err)
 	assert.False(suite.T(), isNew)
 	assert.Empty(suite.T(), token)
-	assert.EqualError(suite.T(), err, "this device is already registered to another user")
+	assert.ErrorIs(suite.T(), err, cerror.ErrDeviceTaken)
 }
 
 func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_NewDevice_UserAlreadyHasADifferentDevice() {
@@ -366,6 +438,7 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_NewDevice_Us
 		Uuid:             uuid.New(),
 		UserId:           currentUser.ID,
 		CreatorId:        currentUser.ID,
+		DeviceId:         "userOldDeviceID",
 		RegisteredDevice: "OldBrand OldModel (OldOS) [ID:userOldDeviceID]",
 		ActivationToken:  "user-old-device-token",
 	}
@@ -373,12 +446,12 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_NewDevice_Us
 	suite.Require().NoError(err)
 
 	// Current user tries to validate the new device
-	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfoNew)
+	token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfoNew, testIp)
 
 	assert.Error(suite.T(), err)
 	assert.False(suite.T(), isNew)
 	assert.Empty(suite.T(), token)
-	assert.EqualError(suite.T(), err, "you already have a different device registered to your account")
+	assert.ErrorIs(suite.T(), err, cerror.ErrDeviceLimit)
 
 	// Verify the old device is still registered and unchanged
 	var dbOldDevice model.Mobile
@@ -388,7 +461,7 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_NewDevice_Us
 
 	// Verify the new device was not registered
 	var dbNewDevice model.Mobile
-	err = suite.db.Where("registered_device LIKE ?", "%"+deviceInfoNew.DeviceID+"%").First(&dbNewDevice).Error
+	err = suite.db.Where("device_id = ?", deviceInfoNew.DeviceID).First(&dbNewDevice).Error
 	assert.True(suite.T(), errors.Is(err, gorm.ErrRecordNotFound), "New device should not have been registered")
 }
 
@@ -401,19 +474,18 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_Concurrent_N
 	errs := make(chan error, numGoroutines)
 	successes := make(chan bool, numGoroutines)
 
-	expectedTokenForConcurrent, _ := auth.GenerateDeviceToken(concurrentUser)
+	tokens := make(chan string, numGoroutines)
 
 	for i := 0; i < numGoroutines; i++ {
 		go func(routineID int) {
-			token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(concurrentUser, deviceInfo)
+			token, isNew, err := suite.deviceMgr.ValidateDeviceRegistration(concurrentUser, deviceInfo, testIp)
 			if err != nil {
 				suite.logger.Errorf("Goroutine %d error: %v", routineID, err)
 				errs <- err
 				return
 			}
-			if isNew && token == expectedTokenForConcurrent {
-				successes <- true
-			} else if !isNew && token == expectedTokenForConcurrent {
+			if _, claims, err := auth.ParseToken("Bearer " + token); err == nil && claims.Uuid == concurrentUser.Uuid.String() {
+				tokens <- token
 				successes <- true
 			} else {
 				errs <- fmt.Errorf("goroutine %d: unexpected outcome (isNew: %v, token: %s)", routineID, isNew, token)
@@ -441,12 +513,54 @@ func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_Concurrent_N
 
 	// Verify DB state: only one device entry for this user and deviceID
 	var count int64
-	err := suite.db.Model(&model.Mobile{}).Where("user_id = ? AND registered_device LIKE ?", concurrentUser.ID, "%"+deviceInfo.DeviceID+"%").Count(&count).Error
+	err := suite.db.Model(&model.Mobile{}).Where("user_id = ? AND device_id = ?", concurrentUser.ID, deviceInfo.DeviceID).Count(&count).Error
 	suite.Require().NoError(err)
 	assert.Equal(suite.T(), int64(1), count, "Should be exactly one device registered for the user with this device ID after concurrent attempts")
 
 	var finalDevice model.Mobile
-	err = suite.db.Where("user_id = ? AND registered_device LIKE ?", concurrentUser.ID, "%"+deviceInfo.DeviceID+"%").First(&finalDevice).Error
+	err = suite.db.Where("user_id = ? AND device_id = ?", concurrentUser.ID, deviceInfo.DeviceID).First(&finalDevice).Error
 	suite.Require().NoError(err)
-	assert.Equal(suite.T(), expectedTokenForConcurrent, finalDevice.ActivationToken)
+	close(tokens)
+	issued := []string{}
+	for token := range tokens {
+		issued = append(issued, token)
+	}
+	assert.Contains(suite.T(), issued, finalDevice.ActivationToken)
+}
+
+func (suite *DeviceManagerTestSuite) TestValidateDeviceRegistration_KeepsKey() {
+	currentUser := suite.createTestUserInDB("keeps_key@example.com", model.RoleOsoba)
+	deviceInfo := device.DeviceInfo{Platform: "TestOS", Brand: "TestBrand", ModelName: "TestModelK", DeviceID: "validateKeepsKey"}
+	attestedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	initialDevice := &model.Mobile{
+		Uuid:             uuid.New(),
+		UserId:           currentUser.ID,
+		CreatorId:        currentUser.ID,
+		DeviceId:         deviceInfo.DeviceID,
+		RegisteredDevice: suite.deviceMgr.FormatDeviceName(deviceInfo),
+		ActivationToken:  "keeps-key-token",
+		PublicKey:        "registered-key",
+		AttestedAt:       &attestedAt,
+	}
+	suite.Require().NoError(suite.db.Create(initialDevice).Error)
+
+	// a login without a key doesn't drop the registered one
+	_, _, err := suite.deviceMgr.ValidateDeviceRegistration(currentUser, deviceInfo, testIp)
+	suite.Require().NoError(err)
+
+	var mobileDevice model.Mobile
+	suite.Require().NoError(suite.db.First(&mobileDevice, initialDevice.ID).Error)
+	assert.Equal(suite.T(), "registered-key", mobileDevice.PublicKey)
+	suite.Require().NotNil(mobileDevice.AttestedAt)
+	assert.True(suite.T(), attestedAt.Equal(*mobileDevice.AttestedAt))
+}
+
+func (suite *DeviceManagerTestSuite) TestIssueChallenge_Unattested() {
+	mobile := &model.Mobile{PublicKey: "unattested-key"}
+	_, _, err := suite.deviceMgr.IssueChallenge(mobile)
+	assert.ErrorIs(suite.T(), err, cerror.ErrUnattestedDeviceKey)
+
+	_, _, err = suite.deviceMgr.IssueChallenge(&model.Mobile{})
+	assert.ErrorIs(suite.T(), err, cerror.ErrNoDeviceKey)
 }
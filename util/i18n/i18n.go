@@ -0,0 +1,126 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Supported languages, messages missing in a language fall back to English
+const (
+	En = "en"
+	Hr = "hr"
+
+	DefaultLanguage = En
+)
+
+var messages = map[string]map[string]string{
+	En: {
+		"password.too_short":     "Password must be at least %d characters long",
+		"password.too_long":      "Password must be at most %d characters long",
+		"password.classes":       "Password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols",
+		"password.breached":      "Password appears in a list of leaked passwords, choose another one",
+		"password.policy_failed": "Password does not satisfy the password policy",
+
+		"validation.failed":             "Some fields are invalid",
+		"validation.invalid_oib":        "OIB must be 11 digits with a valid check digit",
+		"validation.invalid_birth_date": "Birth date must be in the past and at most 130 years ago",
+		"validation.invalid_email":      "Email must be a valid address, e.g. ivan@example.com",
+		"validation.email_taken":        "Email is already used by another account",
+		"validation.oib_taken":          "OIB is already used by another account",
+		"validation.unknown_role":       "Unknown role",
+		"validation.role_not_allowed":   "Role is not allowed",
+		"validation.bad_date":           "Date must be written as dd.mm.yyyy. or yyyy-mm-dd",
+		"validation.required":           "Value is required",
+		"validation.bad_postal_code":    "Postal code is not in the postal codebook",
+		"validation.bad_settlement":     "Settlement is not served by the postal code",
+
+		"export.title":          "ePrometna - your personal data",
+		"export.generated":      "Generated: %s",
+		"export.person":         "Person: %s %s, OIB %s, born %s",
+		"export.contact":        "Email: %s, residence: %s",
+		"export.account":        "Account: %s, created %s",
+		"export.vehicles":       "Vehicles you own: %d",
+		"export.past_vehicles":  "Vehicles you owned before: %d",
+		"export.driver_grants":  "Vehicles of other owners you may drive: %d",
+		"export.license":        "Driver license: %s, categories %s, valid until %s",
+		"export.no_license":     "Driver license: none",
+		"export.devices":        "Registered mobile devices: %d",
+		"export.temp_data":      "Vehicles shared with the police: %d",
+		"export.organisations":  "Organisations you are a member of: %d",
+		"export.mfa_enabled":    "Second factor: enabled",
+		"export.mfa_disabled":   "Second factor: not enabled",
+		"export.identities":     "Linked identity provider accounts: %d",
+		"export.sessions":       "Sign ins and token refreshes: %d",
+		"export.lock_events":    "Account lockouts: %d",
+		"export.impersonations": "Support sessions that viewed your account: %d",
+		"export.files":          "The files of this archive hold the complete records:",
+	},
+	Hr: {
+		"password.too_short":     "Lozinka mora imati najmanje %d znakova",
+		"password.too_long":      "Lozinka smije imati najviše %d znakova",
+		"password.classes":       "Lozinka mora sadržavati barem %d od: mala slova, velika slova, znamenke, simbole",
+		"password.breached":      "Lozinka se nalazi na popisu procurjelih lozinki, odaberite drugu",
+		"password.policy_failed": "Lozinka ne zadovoljava pravila za lozinke",
+
+		"validation.failed":             "Neka polja nisu ispravna",
+		"validation.invalid_oib":        "OIB mora imati 11 znamenki s ispravnom kontrolnom znamenkom",
+		"validation.invalid_birth_date": "Datum rođenja mora biti u prošlosti i najviše 130 godina unatrag",
+		"validation.invalid_email":      "Email mora biti ispravna adresa, npr. ivan@example.com",
+		"validation.email_taken":        "Email već koristi drugi račun",
+		"validation.oib_taken":          "OIB već koristi drugi račun",
+		"validation.unknown_role":       "Nepoznata uloga",
+		"validation.role_not_allowed":   "Uloga nije dopuštena",
+		"validation.bad_date":           "Datum mora biti zapisan kao dd.mm.gggg. ili gggg-mm-dd",
+		"validation.required":           "Vrijednost je obavezna",
+		"validation.bad_postal_code":    "Poštanski broj nije u popisu poštanskih brojeva",
+		"validation.bad_settlement":     "Naselje ne pripada poštanskom broju",
+
+		"export.title":          "ePrometna - vaši osobni podaci",
+		"export.generated":      "Izrađeno: %s",
+		"export.person":         "Osoba: %s %s, OIB %s, rođen/a %s",
+		"export.contact":        "Email: %s, prebivalište: %s",
+		"export.account":        "Račun: %s, otvoren %s",
+		"export.vehicles":       "Vozila u vašem vlasništvu: %d",
+		"export.past_vehicles":  "Vozila koja ste prije posjedovali: %d",
+		"export.driver_grants":  "Vozila drugih vlasnika koja smijete voziti: %d",
+		"export.license":        "Vozačka dozvola: %s, kategorije %s, vrijedi do %s",
+		"export.no_license":     "Vozačka dozvola: nema",
+		"export.devices":        "Registrirani mobilni uređaji: %d",
+		"export.temp_data":      "Vozila podijeljena s policijom: %d",
+		"export.organisations":  "Organizacije čiji ste član: %d",
+		"export.mfa_enabled":    "Drugi faktor: uključen",
+		"export.mfa_disabled":   "Drugi faktor: nije uključen",
+		"export.identities":     "Povezani računi pružatelja identiteta: %d",
+		"export.sessions":       "Prijave i osvježavanja tokena: %d",
+		"export.lock_events":    "Zaključavanja računa: %d",
+		"export.impersonations": "Sesije podrške koje su pregledale vaš račun: %d",
+		"export.files":          "Datoteke ove arhive sadrže potpune zapise:",
+	},
+}
+
+// Language picks the first supported language from an Accept-Language header
+func Language(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		base := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if _, ok := messages[base]; ok {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// T returns the message with key in lang formatted with args, the key
+// itself is returned if there is no such message
+func T(lang, key string, args ...any) string {
+	format, ok := messages[lang][key]
+	if !ok {
+		if format, ok = messages[DefaultLanguage][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
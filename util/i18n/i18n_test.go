@@ -0,0 +1,30 @@
+package i18n_test
+
+import (
+	"ePrometna_Server/util/i18n"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: i18n.En},
+		{header: "hr", want: i18n.Hr},
+		{header: "hr-HR,hr;q=0.9,en;q=0.8", want: i18n.Hr},
+		{header: "de-DE, en-US;q=0.7", want: i18n.En},
+		{header: "de, fr", want: i18n.DefaultLanguage},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, i18n.Language(tt.header), tt.header)
+	}
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "Lozinka mora imati najmanje 8 znakova", i18n.T(i18n.Hr, "password.too_short", 8))
+	assert.Equal(t, "Password must be at least 8 characters long", i18n.T("de", "password.too_short", 8))
+	assert.Equal(t, "unknown.key", i18n.T(i18n.Hr, "unknown.key"))
+}
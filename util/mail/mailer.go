@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. The implementations in this repo only store messages
+// in an outbox so flows can be tested without an SMTP server, a real mailer
+// can read the outbox or replace them.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// DirectoryMailer writes every message to its own .eml file in Dir
+type DirectoryMailer struct {
+	Dir string
+}
+
+// NewDirectoryMailer creates the outbox directory if it doesn't exist
+func NewDirectoryMailer(dir string) (*DirectoryMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &DirectoryMailer{Dir: dir}, nil
+}
+
+// Send implements Mailer.
+func (m *DirectoryMailer) Send(msg Message) error {
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), uuid.NewString())
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(b.String()), 0o640)
+}
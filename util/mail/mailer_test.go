@@ -0,0 +1,29 @@
+package mail_test
+
+import (
+	"ePrometna_Server/util/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryMailer_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mailer, err := mail.NewDirectoryMailer(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, mailer.Send(mail.Message{To: "user@example.com", Subject: "Hello", Body: "Body text"}))
+	require.NoError(t, mailer.Send(mail.Message{To: "other@example.com", Subject: "Second", Body: "More"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "Subject: ")
+	assert.Contains(t, string(content), "\r\n\r\n")
+}
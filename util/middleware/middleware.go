@@ -1,43 +1,147 @@
 package middleware
 
 import (
+	"ePrometna_Server/config"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"errors"
 	"net/http"
 	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// ClaimsKey is the gin context key Protect stores the parsed token claims under
+const ClaimsKey = "claims"
+
+// allowImpersonationKey marks routes impersonation tokens can mutate
+const allowImpersonationKey = "allowImpersonation"
+
+// Headers a mobile app sends a signed device challenge in
+const (
+	DeviceNonceHeader     = "X-Device-Nonce"
+	DeviceSignatureHeader = "X-Device-Signature"
+)
+
 var OptionsHandler gin.HandlerFunc = func(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// Protect protects routes allowing access only to given roles (model.UserRole)
-// if roles are empty they it only checks for the validity of tokens
-func Protect(roles ...model.UserRole) gin.HandlerFunc {
+// Protect protects routes allowing access only to roles that have every given
+// permission (model.Permission), if permissions are empty it only checks for
+// the validity of tokens. API keys of integrations are accepted as bearer
+// credentials too, they are also limited to their scopes.
+//
+// Requests made with an impersonation token are written to the audit trail,
+// mutating requests are refused unless AllowImpersonation runs before Protect.
+func Protect(permissions ...model.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Missing token")
+		claims, _, ok := authenticate(c, permissions)
+		if claims != nil && claims.IsImpersonation() {
+			blocked := ok && isMutating(c.Request.Method) && !c.GetBool(allowImpersonationKey)
+			defer auditImpersonation(c, claims, blocked)
+
+			if blocked {
+				zap.S().Debugf("Refused %s %s of %s impersonating %s", c.Request.Method, c.Request.URL.Path, claims.Actor.Uuid, claims.Uuid)
+				c.AbortWithStatusJSON(http.StatusForbidden, "Not allowed while impersonating")
+				return
+			}
+		}
+		if !ok {
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// AllowImpersonation lets impersonation tokens make a mutating request, it
+// has to run before Protect
+func AllowImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(allowImpersonationKey, true)
+		c.Next()
+	}
+}
+
+func isMutating(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// auditImpersonation records an impersonated request after it was handled
+func auditImpersonation(c *gin.Context, claims *auth.Claims, blocked bool) {
+	auth.RecordImpersonatedRequest(auth.ImpersonatedRequest{
+		Claims:  claims,
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.Path,
+		Ip:      c.ClientIP(),
+		Status:  c.Writer.Status(),
+		Blocked: blocked,
+	})
+}
+
+// ProtectDevice is Protect for routes called by the police and citizen mobile
+// apps, it only accepts device tokens that are still stored on the caller's
+// registered model.Mobile so tokens of removed or replaced devices stop working
+func ProtectDevice(permissions ...model.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, tokenString, ok := authenticate(c, permissions)
+		if claims != nil && claims.IsImpersonation() {
+			// impersonation tokens have no device and are always rejected
+			defer auditImpersonation(c, claims, false)
+		}
+		if !ok {
 			return
 		}
 
-		token, claims, err := auth.ParseToken(authHeader)
-		if err != nil {
-			zap.S().Debugf("Auth failed with err = %+v", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token format")
+		if !auth.IsCurrentDeviceToken(claims, tokenString) {
+			zap.S().Debugf("Rejected device token jti = %s, user = %s, device = %s", claims.ID, claims.Uuid, claims.Device)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "Device not registered")
 			return
 		}
+		auth.TouchDevice(claims, c.ClientIP())
 
-		if !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token")
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// RequireDeviceSignature follows Protect or ProtectDevice on sensitive routes,
+// callers with one of the given roles (every caller if no roles are given)
+// must sign a nonce issued to their registered device with its key. Nothing
+// is checked unless config.AppConfig.DeviceSignatures is on.
+func RequireDeviceSignature(roles ...model.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.AppConfig.DeviceSignatures {
+			c.Next()
 			return
 		}
 
-		if len(roles) != 0 && !slices.Contains(roles, claims.Role) {
-			c.AbortWithStatus(http.StatusForbidden)
+		claims, ok := GetClaims(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "Missing token")
+			return
+		}
+		if len(roles) > 0 && !slices.Contains(roles, claims.Role) {
+			c.Next()
+			return
+		}
+
+		nonce := c.GetHeader(DeviceNonceHeader)
+		signature := c.GetHeader(DeviceSignatureHeader)
+		if nonce == "" || signature == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "Device signature required")
+			return
+		}
+
+		if err := auth.VerifyDeviceSignature(claims, nonce, signature, c.Request.Method, c.Request.URL.Path); err != nil {
+			zap.S().Debugf("Rejected device signature of user = %s, err = %+v", claims.Uuid, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid device signature")
 			return
 		}
 
@@ -45,6 +149,94 @@ func Protect(roles ...model.UserRole) gin.HandlerFunc {
 	}
 }
 
+// authenticate checks the bearer token and permissions, the request is
+// aborted when ok is false. Claims of a valid token are also returned when
+// it was revoked or lacks permissions.
+func authenticate(c *gin.Context, permissions []model.Permission) (*auth.Claims, string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Missing token")
+		return nil, "", false
+	}
+
+	if credential := strings.TrimPrefix(authHeader, "Bearer "); auth.IsApiKey(credential) {
+		return authenticateApiKey(c, credential, permissions)
+	}
+
+	token, claims, err := auth.ParseToken(authHeader)
+	if err != nil {
+		zap.S().Debugf("Auth failed with err = %+v", err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token format")
+		return nil, "", false
+	}
+
+	if !token.Valid {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token")
+		return nil, "", false
+	}
+
+	if auth.IsRevoked(claims) {
+		zap.S().Debugf("Rejected revoked token jti = %s, user = %s", claims.ID, claims.Uuid)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Token revoked")
+		return claims, "", false
+	}
+
+	if !claims.HasPermissions(permissions...) {
+		zap.S().Debugf("Role = %s lacks permissions %v", claims.Role, permissions)
+		c.AbortWithStatus(http.StatusForbidden)
+		return claims, "", false
+	}
+
+	return claims, token.Raw, true
+}
+
+// authenticateApiKey checks a key of a machine integration, its claims go
+// through the same permission checks as tokens of users
+func authenticateApiKey(c *gin.Context, key string, permissions []model.Permission) (*auth.Claims, string, bool) {
+	claims, err := auth.AuthenticateApiKey(key, c.ClientIP())
+	if err != nil {
+		zap.S().Debugf("API key rejected with err = %+v", err)
+		if errors.Is(err, cerror.ErrApiKeyIpDenied) {
+			c.AbortWithStatusJSON(http.StatusForbidden, err.Error())
+			return nil, "", false
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid API key")
+		return nil, "", false
+	}
+
+	if !claims.HasPermissions(permissions...) {
+		zap.S().Debugf("API key = %s lacks permissions %v", claims.ApiKey, permissions)
+		c.AbortWithStatus(http.StatusForbidden)
+		return nil, "", false
+	}
+
+	return claims, "", true
+}
+
+// GetClaims returns the claims stored by Protect, ok is false on routes
+// that are not protected
+func GetClaims(c *gin.Context) (*auth.Claims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*auth.Claims)
+	return claims, ok && claims != nil
+}
+
+// GetUserUuid returns the uuid of the logged in user from the stored claims
+func GetUserUuid(c *gin.Context) (uuid.UUID, bool) {
+	claims, ok := GetClaims(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userUuid, err := uuid.Parse(claims.Uuid)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userUuid, true
+}
+
 func CorsHeader() gin.HandlerFunc {
 	// Define allowed origins
 	allowedOrigins := map[string]bool{
@@ -64,7 +256,7 @@ func CorsHeader() gin.HandlerFunc {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Device-Nonce, X-Device-Signature")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, DELETE")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
 
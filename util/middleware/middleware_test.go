@@ -4,6 +4,7 @@ import (
 	"ePrometna_Server/config"
 	"ePrometna_Server/model"
 	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
 	"ePrometna_Server/util/middleware"
 	"net/http"
 	"net/http/httptest"
@@ -36,11 +37,12 @@ func (suite *MiddlewareTestSuite) SetupSuite() {
 	suite.sugar = zapLogger.Sugar()
 
 	config.AppConfig = &config.AppConfiguration{
-		AccessKey:    "test-middleware-access-key",
-		RefreshKey:   "test-middleware-refresh-key",
-		Env:          config.Dev,
-		Port:         8090,
-		DbConnection: "",
+		AccessKey:        "test-middleware-access-key",
+		RefreshKey:       "test-middleware-refresh-key",
+		Env:              config.Dev,
+		Port:             8090,
+		DbConnection:     "",
+		DeviceSignatures: true,
 	}
 
 	// Setup Gin router for testing
@@ -51,10 +53,44 @@ func (suite *MiddlewareTestSuite) SetupSuite() {
 		c.String(http.StatusOK, "general_access_granted")
 	})
 
-	suite.router.GET("/protected/admin", middleware.Protect(model.RoleSuperAdmin), func(c *gin.Context) {
+	suite.router.GET("/protected/admin", middleware.Protect(model.PermKeyManage), func(c *gin.Context) {
 		c.String(http.StatusOK, "admin_access_granted")
 	})
 
+	suite.router.GET("/protected/vehicle", middleware.Protect(model.PermVehicleRead), func(c *gin.Context) {
+		c.String(http.StatusOK, "vehicle_access_granted")
+	})
+
+	suite.router.POST("/protected/general", middleware.Protect(), func(c *gin.Context) {
+		c.String(http.StatusOK, "general_change_made")
+	})
+
+	suite.router.POST("/protected/impersonation", middleware.AllowImpersonation(), middleware.Protect(), func(c *gin.Context) {
+		c.String(http.StatusOK, "impersonation_change_made")
+	})
+
+	suite.router.GET("/protected/claims", middleware.Protect(), func(c *gin.Context) {
+		userUuid, ok := middleware.GetUserUuid(c)
+		if !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, userUuid.String())
+	})
+
+	suite.router.GET("/protected/device", middleware.ProtectDevice(model.PermTempDataConsume), func(c *gin.Context) {
+		c.String(http.StatusOK, "device_access_granted")
+	})
+
+	suite.router.GET("/protected/signed", middleware.Protect(), middleware.RequireDeviceSignature(model.RolePolicija), func(c *gin.Context) {
+		c.String(http.StatusOK, "signed_access_granted")
+	})
+
+	suite.router.GET("/public/claims", func(c *gin.Context) {
+		_, ok := middleware.GetClaims(c)
+		c.String(http.StatusOK, "%t", ok)
+	})
+
 	suite.router.GET("/cors-test", middleware.CorsHeader(), func(c *gin.Context) {
 		c.String(http.StatusOK, "cors_ok")
 	})
@@ -124,6 +160,23 @@ func (suite *MiddlewareTestSuite) TestProtect_ValidToken_GeneralAccess() {
 	assert.Equal(suite.T(), "general_access_granted", w.Body.String())
 }
 
+func (suite *MiddlewareTestSuite) TestProtect_StoresClaims() {
+	testUserUUID := uuid.New()
+	token := suite.generateToken(testUserUUID, "test@example.com", model.RoleOsoba, time.Now().Add(5*time.Minute))
+
+	w := suite.performRequest(http.MethodGet, "/protected/claims", token)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), testUserUUID.String(), w.Body.String())
+}
+
+func (suite *MiddlewareTestSuite) TestGetClaims_NotProtected() {
+	w := suite.performRequest(http.MethodGet, "/public/claims", "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "false", w.Body.String())
+}
+
 func (suite *MiddlewareTestSuite) TestProtect_NoToken() {
 	w := suite.performRequest(http.MethodGet, "/protected/general", "")
 
@@ -218,6 +271,317 @@ func (suite *MiddlewareTestSuite) TestProtect_ValidToken_InsufficientRole() {
 	// No body expected for 403 from this middleware implementation
 }
 
+func (suite *MiddlewareTestSuite) TestProtect_RevokedToken() {
+	store := auth.NewMemoryRevocationStore()
+	auth.SetRevocationStore(store)
+	defer auth.SetRevocationStore(auth.NewMemoryRevocationStore())
+
+	testUserUUID := uuid.New()
+	token := suite.generateToken(testUserUUID, "revoked@example.com", model.RolePolicija, time.Now().Add(5*time.Minute))
+	_, claims, err := auth.ParseToken("Bearer " + token)
+	suite.Require().NoError(err)
+	suite.Require().NoError(store.RevokeUser(testUserUUID.String(), time.Now().Add(time.Second)))
+
+	w := suite.performRequest(http.MethodGet, "/protected/general", token)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Token revoked")
+	assert.True(suite.T(), auth.IsRevoked(claims))
+}
+
+// --- Test Cases for ProtectDevice Middleware ---
+
+// deviceStore accepts only the listed tokens
+type deviceStore map[string]bool
+
+func (s deviceStore) IsCurrentDeviceToken(claims *auth.Claims, token string) bool {
+	return s[token]
+}
+
+func (s deviceStore) TouchDevice(claims *auth.Claims, ip string) {}
+
+// VerifyDeviceSignature accepts signatures made of the signed message
+func (s deviceStore) VerifyDeviceSignature(claims *auth.Claims, nonce, signature, method, path string) error {
+	if signature != nonce+" "+method+" "+path {
+		return cerror.ErrInvalidSignature
+	}
+	return nil
+}
+
+func (suite *MiddlewareTestSuite) performSignedRequest(token, nonce, signature string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/protected/signed", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if nonce != "" {
+		req.Header.Set(middleware.DeviceNonceHeader, nonce)
+		req.Header.Set(middleware.DeviceSignatureHeader, signature)
+	}
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *MiddlewareTestSuite) generateDeviceToken(userRole model.UserRole) string {
+	token, err := auth.GenerateDeviceToken(&model.User{Uuid: uuid.New(), Email: "device@example.com", Role: userRole}, uuid.New())
+	suite.Require().NoError(err)
+	return token
+}
+
+func (suite *MiddlewareTestSuite) TestProtectDevice_RegisteredDevice() {
+	token := suite.generateDeviceToken(model.RolePolicija)
+	auth.SetDeviceStore(deviceStore{token: true})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performRequest(http.MethodGet, "/protected/device", token)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "device_access_granted", w.Body.String())
+}
+
+func (suite *MiddlewareTestSuite) TestProtectDevice_ReplacedDevice() {
+	oldToken := suite.generateDeviceToken(model.RolePolicija)
+	auth.SetDeviceStore(deviceStore{suite.generateDeviceToken(model.RolePolicija): true})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performRequest(http.MethodGet, "/protected/device", oldToken)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Device not registered")
+}
+
+func (suite *MiddlewareTestSuite) TestProtectDevice_AccessToken() {
+	token := suite.generateToken(uuid.New(), "police@example.com", model.RolePolicija, time.Now().Add(5*time.Minute))
+	auth.SetDeviceStore(deviceStore{token: true})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performRequest(http.MethodGet, "/protected/device", token)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Device not registered")
+}
+
+func (suite *MiddlewareTestSuite) TestProtectDevice_NoStore() {
+	token := suite.generateDeviceToken(model.RolePolicija)
+
+	w := suite.performRequest(http.MethodGet, "/protected/device", token)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestProtectDevice_InsufficientRole() {
+	token := suite.generateDeviceToken(model.RoleOsoba)
+	auth.SetDeviceStore(deviceStore{token: true})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performRequest(http.MethodGet, "/protected/device", token)
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestRequireDeviceSignature_Signed() {
+	token := suite.generateToken(uuid.New(), "police@example.com", model.RolePolicija, time.Now().Add(5*time.Minute))
+	auth.SetDeviceStore(deviceStore{})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performSignedRequest(token, "nonce", "nonce GET /protected/signed")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "signed_access_granted", w.Body.String())
+}
+
+func (suite *MiddlewareTestSuite) TestRequireDeviceSignature_Missing() {
+	token := suite.generateToken(uuid.New(), "police@example.com", model.RolePolicija, time.Now().Add(5*time.Minute))
+	auth.SetDeviceStore(deviceStore{})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performSignedRequest(token, "", "")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Device signature required")
+}
+
+func (suite *MiddlewareTestSuite) TestRequireDeviceSignature_OtherRoute() {
+	token := suite.generateToken(uuid.New(), "police@example.com", model.RolePolicija, time.Now().Add(5*time.Minute))
+	auth.SetDeviceStore(deviceStore{})
+	defer auth.SetDeviceStore(nil)
+
+	w := suite.performSignedRequest(token, "nonce", "nonce GET /protected/device")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Invalid device signature")
+}
+
+func (suite *MiddlewareTestSuite) TestRequireDeviceSignature_Off() {
+	token := suite.generateToken(uuid.New(), "police@example.com", model.RolePolicija, time.Now().Add(5*time.Minute))
+	config.AppConfig.DeviceSignatures = false
+	defer func() { config.AppConfig.DeviceSignatures = true }()
+
+	w := suite.performSignedRequest(token, "", "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestRequireDeviceSignature_RoleNotListed() {
+	token := suite.generateToken(uuid.New(), "hak@example.com", model.RoleHAK, time.Now().Add(5*time.Minute))
+
+	w := suite.performSignedRequest(token, "", "")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+// --- Test Cases for API keys ---
+
+// apiKeyStore accepts the listed keys from 192.0.2.1 only
+type apiKeyStore map[string]*auth.Claims
+
+func (s apiKeyStore) AuthenticateApiKey(key, ip string) (*auth.Claims, error) {
+	claims, ok := s[key]
+	if !ok {
+		return nil, cerror.ErrInvalidApiKey
+	}
+	if ip != "192.0.2.1" {
+		return nil, cerror.ErrApiKeyIpDenied
+	}
+	return claims, nil
+}
+
+func (suite *MiddlewareTestSuite) performApiKeyRequest(path, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.RemoteAddr = "192.0.2.1:4000"
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *MiddlewareTestSuite) setApiKeys() {
+	keyUuid := uuid.NewString()
+	auth.SetApiKeyStore(apiKeyStore{
+		"epk_vehicle": {Uuid: keyUuid, ApiKey: keyUuid, Role: model.RoleHAK, Scopes: []model.Permission{model.PermVehicleRead}},
+		"epk_license": {Uuid: keyUuid, ApiKey: keyUuid, Role: model.RoleHAK, Scopes: []model.Permission{model.PermLicenseReadAny}},
+		"epk_police":  {Uuid: keyUuid, ApiKey: keyUuid, Role: model.RoleOsoba, Scopes: []model.Permission{model.PermTempDataConsume}},
+	})
+	suite.T().Cleanup(func() { auth.SetApiKeyStore(nil) })
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ApiKey() {
+	suite.setApiKeys()
+
+	w := suite.performApiKeyRequest("/protected/vehicle", "epk_vehicle")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "vehicle_access_granted", w.Body.String())
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ApiKeyOutOfScope() {
+	suite.setApiKeys()
+
+	// The role has the permission but the key isn't scoped for it
+	w := suite.performApiKeyRequest("/protected/vehicle", "epk_license")
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// The scope isn't granted to the role of the key
+	w = suite.performApiKeyRequest("/protected/device", "epk_police")
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ApiKeyRejected() {
+	suite.setApiKeys()
+
+	w := suite.performApiKeyRequest("/protected/vehicle", "epk_unknown")
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "Invalid API key")
+
+	// Keys only work from allowed addresses
+	w = suite.performRequest(http.MethodGet, "/protected/vehicle", "epk_vehicle")
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ApiKeyNoStore() {
+	w := suite.performApiKeyRequest("/protected/vehicle", "epk_vehicle")
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+}
+
+// --- Test Cases for impersonation ---
+
+// impersonationAuditor keeps audited requests in memory
+type impersonationAuditor struct {
+	requests []auth.ImpersonatedRequest
+}
+
+func (a *impersonationAuditor) RecordImpersonatedRequest(request auth.ImpersonatedRequest) {
+	a.requests = append(a.requests, request)
+}
+
+func (suite *MiddlewareTestSuite) setImpersonationAuditor() (*impersonationAuditor, string) {
+	auditor := &impersonationAuditor{}
+	auth.SetImpersonationAuditor(auditor)
+	suite.T().Cleanup(func() { auth.SetImpersonationAuditor(nil) })
+
+	subject := &model.User{Uuid: uuid.New(), Email: "citizen@test.com", Role: model.RoleOsoba}
+	actor := &model.User{Uuid: uuid.New(), Email: "admin@test.com", Role: model.RoleSuperAdmin}
+	token, err := auth.GenerateImpersonationToken(subject, actor, uuid.NewString())
+	suite.Require().NoError(err)
+	return auditor, token
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ImpersonationRead() {
+	auditor, token := suite.setImpersonationAuditor()
+
+	w := suite.performRequest(http.MethodGet, "/protected/vehicle", token)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.Require().Len(auditor.requests, 1)
+	assert.Equal(suite.T(), "/protected/vehicle", auditor.requests[0].Path)
+	assert.Equal(suite.T(), http.StatusOK, auditor.requests[0].Status)
+	assert.False(suite.T(), auditor.requests[0].Blocked)
+	assert.Equal(suite.T(), "admin@test.com", auditor.requests[0].Claims.Actor.Email)
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ImpersonationBlocksChanges() {
+	auditor, token := suite.setImpersonationAuditor()
+
+	w := suite.performRequest(http.MethodPost, "/protected/general", token, "{}")
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+	suite.Require().Len(auditor.requests, 1)
+	assert.True(suite.T(), auditor.requests[0].Blocked)
+	assert.Equal(suite.T(), http.StatusForbidden, auditor.requests[0].Status)
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ImpersonationAllowedChange() {
+	auditor, token := suite.setImpersonationAuditor()
+
+	w := suite.performRequest(http.MethodPost, "/protected/impersonation", token, "{}")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.Require().Len(auditor.requests, 1)
+	assert.False(suite.T(), auditor.requests[0].Blocked)
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_ImpersonationForbiddenIsAudited() {
+	auditor, token := suite.setImpersonationAuditor()
+
+	w := suite.performRequest(http.MethodGet, "/protected/admin", token)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	// Impersonation tokens aren't device tokens
+	w = suite.performRequest(http.MethodGet, "/protected/device", token)
+	assert.Equal(suite.T(), http.StatusForbidden, w.Code)
+
+	assert.Len(suite.T(), auditor.requests, 2)
+}
+
+func (suite *MiddlewareTestSuite) TestProtect_RegularTokenNotAudited() {
+	auditor, _ := suite.setImpersonationAuditor()
+	token := suite.generateToken(uuid.New(), "user@test.com", model.RoleOsoba, time.Now().Add(time.Hour))
+
+	w := suite.performRequest(http.MethodPost, "/protected/general", token, "{}")
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Empty(suite.T(), auditor.requests)
+}
+
 // --- Test Cases for CorsHeader Middleware ---
 func (suite *MiddlewareTestSuite) TestCorsHeader_AllowsConfiguredOrigin() {
 	allowedOrigin := "http://localhost:8081" // Must match one in your CorsHeader middleware
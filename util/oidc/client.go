@@ -0,0 +1,293 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/cerror"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// keysRefreshInterval limits how often a token with an unknown kid refetches the keys
+	keysRefreshInterval = time.Minute
+	// maxResponseSize is the largest provider response that is read
+	maxResponseSize = 1 << 20
+)
+
+// Config identifies the relying party at the provider
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+}
+
+// Provider is the part of the discovery document used by the relying party
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of a verified id token
+type Claims jwt.MapClaims
+
+// String returns a string claim or an empty string
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// Subject returns the identifier of the user at the provider
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Client is an OpenID Connect relying party using the authorization code
+// flow with PKCE. Discovery and keys of the provider are cached.
+type Client struct {
+	conf Config
+	http *http.Client
+
+	mu            sync.Mutex
+	provider      *Provider
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// NewClient creates a client, with a nil httpClient a client with a 10 second timeout is used
+func NewClient(conf Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	conf.Issuer = strings.TrimRight(conf.Issuer, "/")
+	return &Client{conf: conf, http: httpClient}
+}
+
+// Issuer returns the configured issuer
+func (c *Client) Issuer() string {
+	return c.conf.Issuer
+}
+
+// GenerateCodeVerifier returns a random PKCE code verifier
+func GenerateCodeVerifier() (string, error) {
+	return auth.GenerateOpaqueToken()
+}
+
+// CodeChallenge returns the S256 PKCE challenge of a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Provider returns the discovery document of the issuer
+func (c *Client) Provider() (*Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.discover()
+}
+
+func (c *Client) discover() (*Provider, error) {
+	if c.provider != nil {
+		return c.provider, nil
+	}
+
+	var provider Provider
+	if err := c.getJSON(c.conf.Issuer+discoveryPath, &provider); err != nil {
+		return nil, err
+	}
+	// NOTE: the issuer has to match exactly, otherwise a document served
+	// from elsewhere could point to keys of another provider
+	if provider.Issuer != c.conf.Issuer {
+		return nil, fmt.Errorf("%w: discovery issuer %s doesn't match %s", cerror.ErrOidcProvider, provider.Issuer, c.conf.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JwksUri == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", cerror.ErrOidcProvider)
+	}
+
+	c.provider = &provider
+	return c.provider, nil
+}
+
+// AuthCodeUrl returns the url the user is sent to for signing in
+func (c *Client) AuthCodeUrl(state, nonce, codeChallenge string) (string, error) {
+	provider, err := c.Provider()
+	if err != nil {
+		return "", err
+	}
+
+	authUrl, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", cerror.ErrOidcProvider, err)
+	}
+
+	query := authUrl.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.conf.ClientId)
+	query.Set("redirect_uri", c.conf.RedirectUrl)
+	query.Set("scope", strings.Join(c.conf.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authUrl.RawQuery = query.Encode()
+
+	return authUrl.String(), nil
+}
+
+type tokenResponse struct {
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code at the token endpoint and returns the raw id token
+func (c *Client) Exchange(code, codeVerifier string) (string, error) {
+	provider, err := c.Provider()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.conf.RedirectUrl)
+	form.Set("client_id", c.conf.ClientId)
+	form.Set("code_verifier", codeVerifier)
+	if c.conf.ClientSecret != "" {
+		form.Set("client_secret", c.conf.ClientSecret)
+	}
+
+	resp, err := c.http.PostForm(provider.TokenEndpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", cerror.ErrOidcProvider, err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("%w: token response status %d", cerror.ErrOidcProvider, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("%w: %s %s", cerror.ErrOidcProvider, token.Error, token.ErrorDescription)
+	}
+	if token.IdToken == "" {
+		return "", fmt.Errorf("%w: token response has no id token", cerror.ErrOidcProvider)
+	}
+
+	return token.IdToken, nil
+}
+
+// VerifyIdToken checks the signature, issuer, audience, expiry and nonce of an id token
+func (c *Client) VerifyIdToken(rawIdToken, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIdToken, claims, c.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cerror.ErrInvalidIdToken, err)
+	}
+
+	if !claims.VerifyIssuer(c.conf.Issuer, true) {
+		return nil, fmt.Errorf("%w: wrong issuer", cerror.ErrInvalidIdToken)
+	}
+	if !claims.VerifyAudience(c.conf.ClientId, true) {
+		return nil, fmt.Errorf("%w: wrong audience", cerror.ErrInvalidIdToken)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: no expiry", cerror.ErrInvalidIdToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != c.conf.ClientId {
+		return nil, fmt.Errorf("%w: wrong authorized party", cerror.ErrInvalidIdToken)
+	}
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, fmt.Errorf("%w: wrong nonce", cerror.ErrInvalidIdToken)
+	}
+	if Claims(claims).Subject() == "" {
+		return nil, fmt.Errorf("%w: no subject", cerror.ErrInvalidIdToken)
+	}
+
+	return Claims(claims), nil
+}
+
+// keyFunc selects the provider key a token is signed with, keys are
+// refetched when the provider rotates them
+func (c *Client) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	if !ok && time.Since(c.keysFetchedAt) > keysRefreshInterval {
+		if err := c.fetchKeys(); err != nil {
+			return nil, err
+		}
+		key, ok = c.keys[kid]
+	}
+	if !ok {
+		return nil, cerror.ErrUnknownSigningKey
+	}
+	if !keyMatchesMethod(key, token.Method) {
+		return nil, cerror.ErrUnsupportedAlgorithm
+	}
+	return key, nil
+}
+
+func (c *Client) fetchKeys() error {
+	provider, err := c.discover()
+	if err != nil {
+		return err
+	}
+
+	var set auth.JSONWebKeySet
+	if err := c.getJSON(provider.JwksUri, &set); err != nil {
+		return err
+	}
+
+	keys := map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := ParseJSONWebKey(jwk)
+		if err != nil {
+			// NOTE: keys of unsupported types are skipped, tokens signed
+			// with them fail with an unknown key
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+	return nil
+}
+
+func (c *Client) getJSON(target string, v any) error {
+	resp, err := c.http.Get(target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", cerror.ErrOidcProvider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", cerror.ErrOidcProvider, target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", cerror.ErrOidcProvider, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package oidc_test
+
+import (
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/oidc"
+	"ePrometna_Server/util/oidc/oidctest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T) (*oidc.Client, *oidctest.Server) {
+	idp, err := oidctest.NewServer("eprometna")
+	require.NoError(t, err)
+	t.Cleanup(idp.Close)
+
+	client := oidc.NewClient(oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientId:    "eprometna",
+		RedirectUrl: "http://localhost:5173/auth/callback",
+		Scopes:      []string{"openid", "profile"},
+	}, nil)
+	return client, idp
+}
+
+func TestCodeFlow(t *testing.T) {
+	client, idp := newClient(t)
+
+	verifier, err := oidc.GenerateCodeVerifier()
+	require.NoError(t, err)
+	authUrl, err := client.AuthCodeUrl("state-1", "nonce-1", oidc.CodeChallenge(verifier))
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authUrl)
+	require.NoError(t, err)
+	assert.Equal(t, "openid profile", parsed.Query().Get("scope"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+
+	code, state, err := idp.Authorize(authUrl, map[string]any{"sub": "subject-1", "oib": "12345678903"})
+	require.NoError(t, err)
+	assert.Equal(t, "state-1", state)
+
+	idToken, err := client.Exchange(code, verifier)
+	require.NoError(t, err)
+
+	claims, err := client.VerifyIdToken(idToken, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "subject-1", claims.Subject())
+	assert.Equal(t, "12345678903", claims.String("oib"))
+
+	// Codes are single use
+	_, err = client.Exchange(code, verifier)
+	assert.ErrorIs(t, err, cerror.ErrOidcProvider)
+}
+
+func TestExchange_WrongVerifier(t *testing.T) {
+	client, idp := newClient(t)
+
+	verifier, err := oidc.GenerateCodeVerifier()
+	require.NoError(t, err)
+	authUrl, err := client.AuthCodeUrl("state", "nonce", oidc.CodeChallenge(verifier))
+	require.NoError(t, err)
+	code, _, err := idp.Authorize(authUrl, map[string]any{"sub": "subject-1"})
+	require.NoError(t, err)
+
+	_, err = client.Exchange(code, verifier+"x")
+	assert.ErrorIs(t, err, cerror.ErrOidcProvider)
+}
+
+func TestVerifyIdToken(t *testing.T) {
+	client, idp := newClient(t)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.Issuer(),
+			"aud":   "eprometna",
+			"sub":   "subject-1",
+			"nonce": "nonce",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	verify := func(claims jwt.MapClaims, nonce string) error {
+		token, err := idp.SignIdToken(claims)
+		require.NoError(t, err)
+		_, err = client.VerifyIdToken(token, nonce)
+		return err
+	}
+
+	assert.NoError(t, verify(valid(), "nonce"))
+	assert.ErrorIs(t, verify(valid(), "other"), cerror.ErrInvalidIdToken)
+
+	claims := valid()
+	claims["aud"] = "other-client"
+	assert.ErrorIs(t, verify(claims, "nonce"), cerror.ErrInvalidIdToken)
+
+	claims = valid()
+	claims["iss"] = "https://other.example.com"
+	assert.ErrorIs(t, verify(claims, "nonce"), cerror.ErrInvalidIdToken)
+
+	claims = valid()
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	assert.ErrorIs(t, verify(claims, "nonce"), cerror.ErrInvalidIdToken)
+
+	claims = valid()
+	delete(claims, "sub")
+	assert.ErrorIs(t, verify(claims, "nonce"), cerror.ErrInvalidIdToken)
+
+	// Tokens signed with the shared secret instead of the provider key
+	hs, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = client.VerifyIdToken(hs, "nonce")
+	assert.ErrorIs(t, err, cerror.ErrInvalidIdToken)
+}
+
+func TestDiscovery_UnknownIssuer(t *testing.T) {
+	_, idp := newClient(t)
+
+	client := oidc.NewClient(oidc.Config{Issuer: idp.Issuer() + "/realm", ClientId: "eprometna"}, nil)
+	_, err := client.Provider()
+	assert.ErrorIs(t, err, cerror.ErrOidcProvider)
+}
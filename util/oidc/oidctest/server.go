@@ -0,0 +1,198 @@
+// Package oidctest is a mock OpenID Connect provider for tests and local development
+package oidctest
+
+import (
+	"ePrometna_Server/util/auth"
+	"ePrometna_Server/util/oidc"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// Server signs in every user with the claims it is given, the issuer is the server url
+type Server struct {
+	*httptest.Server
+	ClientId string
+	// Claims are returned when a browser is sent to the authorization endpoint
+	Claims map[string]any
+
+	keys   *auth.Keyring
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+type grant struct {
+	claims      map[string]any
+	nonce       string
+	challenge   string
+	redirectUri string
+}
+
+// NewServer starts a provider that accepts the given client id
+func NewServer(clientId string) (*Server, error) {
+	private, public, err := auth.GenerateKeyPair(auth.AlgRS256)
+	if err != nil {
+		return nil, err
+	}
+	key, err := auth.ParseSigningKey("mock-idp", auth.AlgRS256, private, public)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := auth.NewKeyring(key.Kid, key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ClientId: clientId,
+		keys:     keys,
+		grants:   map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// Issuer returns the issuer to configure in the relying party
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// Authorize signs in a user with claims as if the browser was sent to
+// authUrl, it returns the code and state the provider redirects back with
+func (s *Server) Authorize(authUrl string, claims map[string]any) (string, string, error) {
+	parsed, err := url.Parse(authUrl)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+
+	if query.Get("client_id") != s.ClientId {
+		return "", "", errors.New("unknown client")
+	}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		return "", "", errors.New("only the code flow with S256 PKCE is supported")
+	}
+
+	code := uuid.NewString()
+	s.mu.Lock()
+	s.grants[code] = grant{
+		claims:      claims,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectUri: query.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+// SignIdToken signs claims with the provider key
+func (s *Server) SignIdToken(claims jwt.MapClaims) (string, error) {
+	return s.keys.Sign(claims)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Provider{
+		Issuer:                s.URL,
+		AuthorizationEndpoint: s.URL + "/authorize",
+		TokenEndpoint:         s.URL + "/token",
+		JwksUri:               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.keys.JWKS())
+}
+
+// authorize skips the login page and redirects back with a code for s.Claims
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	code, state, err := s.Authorize(r.URL.String(), s.Claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", state)
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	switch {
+	case !ok, r.PostForm.Get("redirect_uri") != g.redirectUri:
+		tokenError(w, "invalid_grant")
+		return
+	case r.PostForm.Get("client_id") != s.ClientId:
+		tokenError(w, "invalid_client")
+		return
+	case oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != g.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   s.URL,
+		"aud":   s.ClientId,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": g.nonce,
+	}
+	for name, value := range g.claims {
+		claims[name] = value
+	}
+
+	idToken, err := s.SignIdToken(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": uuid.NewString(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,258 @@
+package paging
+
+import (
+	"context"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/format"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Page describes the page a list request returned
+type Page struct {
+	Total  int64
+	Limit  int
+	Offset int
+	// ByCursor is set when the page was requested with a cursor
+	ByCursor bool
+	// NextCursor continues after the last row, it is empty on the last page
+	NextCursor string
+}
+
+// cursor holds the sort values and id of the last row of a page
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+	Id     uint              `json:"id"`
+}
+
+// Find loads a page of rows into dest, a pointer to a slice of models. The
+// query can already have joins and conditions, filters, sort and pagination
+// of params are added to it. Rows are always ordered by id last so pages are
+// stable.
+func Find(db *gorm.DB, params *Params, dest any) (*Page, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(dest); err != nil {
+		return nil, err
+	}
+	table := stmt.Schema.Table
+
+	query, err := applyFilters(db, stmt.Schema, params.Filters)
+	if err != nil {
+		return nil, err
+	}
+	query = query.Session(&gorm.Session{})
+
+	page := &Page{Limit: params.Limit, Offset: params.Offset, ByCursor: params.Cursor != ""}
+	if err := query.Model(reflect.New(stmt.Schema.ModelType).Interface()).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	columns := make([]clause.OrderByColumn, 0, len(params.Sort)+1)
+	for _, s := range params.Sort {
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: s.Field.Column, Raw: true}, Desc: s.Desc})
+	}
+	columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: table + ".id", Raw: true}})
+	query = query.Order(clause.OrderBy{Columns: columns})
+
+	if page.ByCursor {
+		where, args, err := cursorCondition(params, stmt.Schema)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(where, args...)
+	} else {
+		query = query.Offset(params.Offset)
+	}
+
+	// one more row tells whether there is a next page
+	if err := query.Limit(params.Limit + 1).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > params.Limit {
+		rows.Set(rows.Slice(0, params.Limit))
+		if page.NextCursor, err = encodeCursor(params, stmt.Schema, rows.Index(rows.Len()-1)); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func applyFilters(db *gorm.DB, sch *schema.Schema, filters []Filter) (*gorm.DB, error) {
+	for _, filter := range filters {
+		column := filter.Field.Column
+		if filter.Op == OpContains {
+			pattern := "%" + escapeLike(strings.ToLower(filter.Value)) + "%"
+			db = db.Where("LOWER("+column+") LIKE ? ESCAPE '\\'", pattern)
+			continue
+		}
+
+		value, err := filterValue(lookUpField(sch, column), filter.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad value of %q", cerror.ErrInvalidQuery, filter.Name)
+		}
+		switch filter.Op {
+		case OpFrom:
+			db = db.Where(column+" >= ?", value)
+		case OpTo:
+			// a day includes every time on it
+			if day, ok := value.(time.Time); ok && len(filter.Value) == len(format.DateFormat) {
+				db = db.Where(column+" < ?", day.AddDate(0, 0, 1))
+			} else {
+				db = db.Where(column+" <= ?", value)
+			}
+		default:
+			if day, ok := value.(time.Time); ok && len(filter.Value) == len(format.DateFormat) {
+				db = db.Where(column+" >= ? AND "+column+" < ?", day, day.AddDate(0, 0, 1))
+			} else {
+				db = db.Where(column+" = ?", value)
+			}
+		}
+	}
+	return db, nil
+}
+
+// filterValue converts a query parameter to the type of the field, so it is
+// compared the same way the column is stored
+func filterValue(field *schema.Field, raw string) (any, error) {
+	if field == nil {
+		return raw, nil
+	}
+	fieldType := field.FieldType
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		if len(raw) == len(format.DateFormat) {
+			return time.Parse(format.DateFormat, raw)
+		}
+		return time.ParseInLocation(format.DateTimeFormat, raw, time.Local)
+	}
+	switch fieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(raw, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// cursorCondition selects rows after the cursor in the sort order of params
+func cursorCondition(params *Params, sch *schema.Schema) (string, []any, error) {
+	c, err := decodeCursor(params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := make([]string, 0, len(params.Sort)+1)
+	descending := make([]bool, 0, len(params.Sort)+1)
+	values := make([]any, 0, len(params.Sort)+1)
+	for i, s := range params.Sort {
+		field := lookUpField(sch, s.Field.Column)
+		if field == nil {
+			return "", nil, fmt.Errorf("unknown column %s of %s", s.Field.Column, sch.Table)
+		}
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return "", nil, fmt.Errorf("%w: invalid cursor", cerror.ErrInvalidQuery)
+		}
+		columns = append(columns, s.Field.Column)
+		descending = append(descending, s.Desc)
+		values = append(values, value.Elem().Interface())
+	}
+	columns = append(columns, sch.Table+".id")
+	descending = append(descending, false)
+	values = append(values, c.Id)
+
+	// (a > ?) OR (a = ? AND b > ?) OR ...
+	var args []any
+	conditions := make([]string, 0, len(columns))
+	for i := range columns {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if descending[i] {
+			op = " < ?"
+		}
+		parts = append(parts, columns[i]+op)
+		args = append(args, values[i])
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(conditions, " OR "), args, nil
+}
+
+func decodeCursor(params *Params) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", cerror.ErrInvalidQuery)
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || len(c.Values) != len(params.Sort) {
+		return nil, fmt.Errorf("%w: invalid cursor", cerror.ErrInvalidQuery)
+	}
+	if c.Sort != sortKey(params.Sort) {
+		return nil, fmt.Errorf("%w: cursor was issued for another sort", cerror.ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+func encodeCursor(params *Params, sch *schema.Schema, row reflect.Value) (string, error) {
+	ctx := context.Background()
+	c := cursor{Sort: sortKey(params.Sort), Values: make([]json.RawMessage, 0, len(params.Sort))}
+	for _, s := range params.Sort {
+		field := lookUpField(sch, s.Field.Column)
+		if field == nil {
+			return "", fmt.Errorf("unknown column %s of %s", s.Field.Column, sch.Table)
+		}
+		value, _ := field.ValueOf(ctx, row)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, encoded)
+	}
+	id, _ := sch.PrioritizedPrimaryField.ValueOf(ctx, row)
+	c.Id, _ = id.(uint)
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// lookUpField finds the field of a qualified column, columns of joined
+// tables are not found
+func lookUpField(sch *schema.Schema, column string) *schema.Field {
+	table, name, found := strings.Cut(column, ".")
+	if !found {
+		name = table
+	} else if table != sch.Table {
+		return nil
+	}
+	return sch.LookUpField(name)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
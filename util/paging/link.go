@@ -0,0 +1,53 @@
+package paging
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Link returns the Link header (RFC 8288) of a page requested with u. Pages
+// requested by offset link to the first, previous, next and last page, pages
+// requested by cursor only to the first and next one.
+func (p *Page) Link(u *url.URL) string {
+	links := []string{pageLink(u, "first", func(q url.Values) {
+		q.Del(CursorParam)
+		q.Del(OffsetParam)
+	})}
+
+	if p.ByCursor {
+		if p.NextCursor != "" {
+			links = append(links, pageLink(u, "next", func(q url.Values) {
+				q.Set(CursorParam, p.NextCursor)
+			}))
+		}
+		return strings.Join(links, ", ")
+	}
+
+	if p.Offset > 0 {
+		links = append(links, pageLink(u, "prev", func(q url.Values) {
+			q.Set(OffsetParam, strconv.Itoa(max(p.Offset-p.Limit, 0)))
+		}))
+	}
+	if int64(p.Offset+p.Limit) < p.Total {
+		links = append(links, pageLink(u, "next", func(q url.Values) {
+			q.Set(OffsetParam, strconv.Itoa(p.Offset+p.Limit))
+		}))
+	}
+	if p.Total > 0 {
+		last := (p.Total - 1) / int64(p.Limit) * int64(p.Limit)
+		links = append(links, pageLink(u, "last", func(q url.Values) {
+			q.Set(OffsetParam, strconv.FormatInt(last, 10))
+		}))
+	}
+	return strings.Join(links, ", ")
+}
+
+func pageLink(u *url.URL, rel string, edit func(q url.Values)) string {
+	link := *u
+	q := link.Query()
+	edit(q)
+	link.RawQuery = q.Encode()
+	return fmt.Sprintf("<%s>; rel=%q", link.String(), rel)
+}
@@ -0,0 +1,203 @@
+package paging
+
+import (
+	"ePrometna_Server/util/cerror"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultLimit is the page size when the request has no limit
+	DefaultLimit = 20
+	// MaxLimit is the largest page that can be requested
+	MaxLimit = 100
+)
+
+// Query parameters of the list contract, every other parameter is a filter
+const (
+	LimitParam  = "limit"
+	OffsetParam = "offset"
+	CursorParam = "cursor"
+	SortParam   = "sort"
+)
+
+// Filter operators, ?field=value is OpEqual and ?field[op]=value the others
+const (
+	OpEqual    = "eq"
+	OpContains = "contains"
+	OpFrom     = "gte"
+	OpTo       = "lte"
+)
+
+// FilterKind tells which operators a field can be filtered with
+type FilterKind int
+
+const (
+	// NoFilter fields can only be sorted by
+	NoFilter FilterKind = iota
+	// FilterExact fields match ?field=value
+	FilterExact
+	// FilterText fields also match ?field[contains]=value ignoring case
+	FilterText
+	// FilterRange fields also match ?field[gte]=value and ?field[lte]=value
+	FilterRange
+)
+
+// Field is a field of a list endpoint clients can sort or filter by
+type Field struct {
+	// Column is the qualified column of the field, e.g. users.last_name. Cursor
+	// pagination compares it, sortable columns must not be null.
+	Column   string
+	Sortable bool
+	Filter   FilterKind
+}
+
+// Spec describes the fields of a list endpoint by their names in the API
+type Spec struct {
+	Fields map[string]Field
+	// DefaultSort is used when the request has no sort, e.g. "lastName", "-createdAt"
+	DefaultSort []string
+	// Params are other query parameters the endpoint reads, they aren't filters
+	Params []string
+}
+
+// Sort orders a list by a field
+type Sort struct {
+	Name  string
+	Field Field
+	Desc  bool
+}
+
+// Filter limits a list to rows whose field matches the value
+type Filter struct {
+	Name  string
+	Field Field
+	Op    string
+	Value string
+}
+
+// Params is a parsed list request
+type Params struct {
+	Limit  int
+	Offset int
+	// Cursor continues after the last row of the previous page, it is never
+	// used together with Offset
+	Cursor  string
+	Sort    []Sort
+	Filters []Filter
+}
+
+// Parse parses the query parameters of a list request, errors wrap
+// cerror.ErrInvalidQuery
+func Parse(values url.Values, spec Spec) (*Params, error) {
+	params := &Params{Limit: DefaultLimit}
+
+	var err error
+	if raw := values.Get(LimitParam); raw != "" {
+		params.Limit, err = strconv.Atoi(raw)
+		if err != nil || params.Limit < 1 || params.Limit > MaxLimit {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", cerror.ErrInvalidQuery, MaxLimit)
+		}
+	}
+	if raw := values.Get(OffsetParam); raw != "" {
+		params.Offset, err = strconv.Atoi(raw)
+		if err != nil || params.Offset < 0 {
+			return nil, fmt.Errorf("%w: offset must be a positive number", cerror.ErrInvalidQuery)
+		}
+	}
+	params.Cursor = values.Get(CursorParam)
+	if params.Cursor != "" && values.Has(OffsetParam) {
+		return nil, fmt.Errorf("%w: offset and cursor can't be used together", cerror.ErrInvalidQuery)
+	}
+
+	sort := spec.DefaultSort
+	if raw := values.Get(SortParam); raw != "" {
+		sort = strings.Split(raw, ",")
+	}
+	if params.Sort, err = parseSort(sort, spec); err != nil {
+		return nil, err
+	}
+
+	for key, list := range values {
+		if key == LimitParam || key == OffsetParam || key == CursorParam || key == SortParam || slices.Contains(spec.Params, key) {
+			continue
+		}
+		for _, value := range list {
+			if value == "" {
+				continue
+			}
+			filter, err := parseFilter(key, value, spec)
+			if err != nil {
+				return nil, err
+			}
+			params.Filters = append(params.Filters, filter)
+		}
+	}
+	// map iteration is random, queries are easier to follow in a stable order
+	slices.SortFunc(params.Filters, func(a, b Filter) int {
+		return strings.Compare(a.Name+a.Op+a.Value, b.Name+b.Op+b.Value)
+	})
+
+	if params.Cursor != "" {
+		if _, err := decodeCursor(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func parseSort(names []string, spec Spec) ([]Sort, error) {
+	sort := make([]Sort, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+
+		field, ok := spec.Fields[name]
+		if !ok || !field.Sortable {
+			return nil, fmt.Errorf("%w: can't sort by %q", cerror.ErrInvalidQuery, name)
+		}
+		if slices.ContainsFunc(sort, func(s Sort) bool { return s.Name == name }) {
+			return nil, fmt.Errorf("%w: %q is sorted by twice", cerror.ErrInvalidQuery, name)
+		}
+		sort = append(sort, Sort{Name: name, Field: field, Desc: desc})
+	}
+	return sort, nil
+}
+
+func parseFilter(key, value string, spec Spec) (Filter, error) {
+	name, op := key, OpEqual
+	if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+		name, op = key[:i], key[i+1:len(key)-1]
+	}
+
+	field, ok := spec.Fields[name]
+	if !ok || field.Filter == NoFilter {
+		return Filter{}, fmt.Errorf("%w: can't filter by %q", cerror.ErrInvalidQuery, name)
+	}
+	switch {
+	case op == OpEqual,
+		op == OpContains && field.Filter == FilterText,
+		(op == OpFrom || op == OpTo) && field.Filter == FilterRange:
+	default:
+		return Filter{}, fmt.Errorf("%w: can't filter %q with %q", cerror.ErrInvalidQuery, name, op)
+	}
+
+	return Filter{Name: name, Field: field, Op: op, Value: value}, nil
+}
+
+// sortKey identifies the sort a cursor was issued for
+func sortKey(sort []Sort) string {
+	names := make([]string, 0, len(sort))
+	for _, s := range sort {
+		if s.Desc {
+			names = append(names, "-"+s.Name)
+		} else {
+			names = append(names, s.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
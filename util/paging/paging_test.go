@@ -0,0 +1,188 @@
+package paging_test
+
+import (
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/paging"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type car struct {
+	gorm.Model
+	Mark     string `gorm:"not null"`
+	Colour   string `gorm:"not null"`
+	Built    time.Time
+	Accepted bool
+}
+
+var carSpec = paging.Spec{
+	Fields: map[string]paging.Field{
+		"mark":     {Column: "cars.mark", Sortable: true, Filter: paging.FilterText},
+		"colour":   {Column: "cars.colour", Sortable: true, Filter: paging.FilterExact},
+		"built":    {Column: "cars.built", Sortable: true, Filter: paging.FilterRange},
+		"accepted": {Column: "cars.accepted", Filter: paging.FilterExact},
+	},
+	DefaultSort: []string{"mark"},
+}
+
+func openCars(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&car{}))
+
+	marks := []string{"Audi", "BMW", "Citroen", "Dacia", "Fiat", "Kia", "Opel", "Skoda", "Tesla", "Volvo"}
+	for i, mark := range marks {
+		colour := "red"
+		if i%2 == 1 {
+			colour = "blue"
+		}
+		require.NoError(t, db.Create(&car{
+			Mark:     mark,
+			Colour:   colour,
+			Built:    time.Date(2015+i, 6, 1, 12, 0, 0, 0, time.UTC),
+			Accepted: i < 5,
+		}).Error)
+	}
+	return db
+}
+
+func parse(t *testing.T, query string) *paging.Params {
+	values, err := url.ParseQuery(query)
+	require.NoError(t, err)
+	params, err := paging.Parse(values, carSpec)
+	require.NoError(t, err)
+	return params
+}
+
+func marks(cars []car) []string {
+	rez := make([]string, 0, len(cars))
+	for _, c := range cars {
+		rez = append(rez, c.Mark)
+	}
+	return rez
+}
+
+func TestParse(t *testing.T) {
+	params := parse(t, "limit=5&offset=10&sort=-built,mark&mark[contains]=a&accepted=true")
+
+	assert.Equal(t, 5, params.Limit)
+	assert.Equal(t, 10, params.Offset)
+	require.Len(t, params.Sort, 2)
+	assert.Equal(t, "built", params.Sort[0].Name)
+	assert.True(t, params.Sort[0].Desc)
+	assert.False(t, params.Sort[1].Desc)
+	require.Len(t, params.Filters, 2)
+	assert.Equal(t, paging.OpEqual, params.Filters[0].Op)
+	assert.Equal(t, paging.OpContains, params.Filters[1].Op)
+
+	params = parse(t, "")
+	assert.Equal(t, paging.DefaultLimit, params.Limit)
+	assert.Equal(t, "mark", params.Sort[0].Name)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, query := range []string{
+		"limit=0",
+		"limit=101",
+		"offset=-1",
+		"offset=1&cursor=abc",
+		"cursor=not-a-cursor",
+		"sort=accepted",
+		"sort=mark,-mark",
+		"unknown=1",
+		"colour[contains]=re",
+		"mark[gte]=A",
+	} {
+		values, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		_, err = paging.Parse(values, carSpec)
+		assert.ErrorIs(t, err, cerror.ErrInvalidQuery, query)
+	}
+}
+
+func TestFind_Offset(t *testing.T) {
+	db := openCars(t)
+
+	var cars []car
+	page, err := paging.Find(db, parse(t, "limit=3&offset=3"), &cars)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Dacia", "Fiat", "Kia"}, marks(cars))
+	assert.EqualValues(t, 10, page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+
+	link := page.Link(&url.URL{Path: "/api/cars", RawQuery: "limit=3&offset=3"})
+	assert.Contains(t, link, `</api/cars?limit=3>; rel="first"`)
+	assert.Contains(t, link, `</api/cars?limit=3&offset=0>; rel="prev"`)
+	assert.Contains(t, link, `</api/cars?limit=3&offset=6>; rel="next"`)
+	assert.Contains(t, link, `</api/cars?limit=3&offset=9>; rel="last"`)
+}
+
+func TestFind_Cursor(t *testing.T) {
+	db := openCars(t)
+
+	// blue before red, newest first within a colour
+	query := "limit=4&sort=colour,-built"
+	var seen []string
+	for range 5 {
+		var cars []car
+		page, err := paging.Find(db, parse(t, query), &cars)
+		require.NoError(t, err)
+		assert.EqualValues(t, 10, page.Total)
+		seen = append(seen, marks(cars)...)
+		if page.NextCursor == "" {
+			assert.NotContains(t, page.Link(&url.URL{Path: "/api/cars"}), `rel="next"`)
+			break
+		}
+		query = "limit=4&sort=colour,-built&cursor=" + page.NextCursor
+	}
+
+	assert.Equal(t, []string{"Volvo", "Skoda", "Kia", "Dacia", "BMW", "Tesla", "Opel", "Fiat", "Citroen", "Audi"}, seen)
+
+	// cursors only continue the sort they were issued for
+	var cars []car
+	page, err := paging.Find(db, parse(t, "limit=4&sort=colour,-built"), &cars)
+	require.NoError(t, err)
+	values := url.Values{"sort": {"mark"}, "cursor": {page.NextCursor}}
+	_, err = paging.Parse(values, carSpec)
+	assert.ErrorIs(t, err, cerror.ErrInvalidQuery)
+}
+
+func TestFind_Filters(t *testing.T) {
+	db := openCars(t)
+
+	var cars []car
+	page, err := paging.Find(db, parse(t, "mark[contains]=I&colour=blue"), &cars)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Dacia", "Kia"}, marks(cars))
+	assert.EqualValues(t, 2, page.Total)
+
+	cars = nil
+	_, err = paging.Find(db, parse(t, "built[gte]=2020-01-01&built[lte]=2022-06-01&accepted=false"), &cars)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Kia", "Opel", "Skoda"}, marks(cars))
+
+	cars = nil
+	_, err = paging.Find(db, parse(t, "built=2016-06-01"), &cars)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BMW"}, marks(cars))
+
+	// like wildcards are matched literally
+	cars = nil
+	_, err = paging.Find(db, parse(t, "mark[contains]=%25"), &cars)
+	require.NoError(t, err)
+	assert.Empty(t, cars)
+
+	_, err = paging.Find(db, parse(t, "built[gte]=yesterday"), &cars)
+	assert.ErrorIs(t, err, cerror.ErrInvalidQuery)
+}
@@ -0,0 +1,146 @@
+package postal
+
+import (
+	"ePrometna_Server/util/cerror"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Place is a settlement served by a postal code
+type Place struct {
+	PostalCode string
+	Settlement string
+	County     string
+}
+
+// Codebook are the postal codes and the settlements they serve
+type Codebook struct {
+	// byCode lists the places of a postal code, the post office seat first
+	byCode map[string][]Place
+	// bySettlement lists the places of a lowercase settlement name
+	bySettlement map[string][]Place
+}
+
+// Load reads a codebook file, see Read
+func Load(path string) (*Codebook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// LoadAtLeast reads a codebook file that has to have at least minPlaces places
+func LoadAtLeast(path string, minPlaces int) (*Codebook, error) {
+	codebook, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if codebook.Len() < minPlaces {
+		return nil, fmt.Errorf("postal codebook %s has %d places, at least %d are required", path, codebook.Len(), minPlaces)
+	}
+	return codebook, nil
+}
+
+// Read reads a semicolon separated codebook with postalCode, settlement and
+// county columns after a header row, lines starting with # are comments.
+// The first settlement of a postal code is the seat of its post office.
+func Read(r io.Reader) (*Codebook, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = ';'
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("postal codebook has no places")
+	}
+
+	codebook := &Codebook{
+		byCode:       map[string][]Place{},
+		bySettlement: map[string][]Place{},
+	}
+	for i, record := range records[1:] {
+		place := Place{
+			PostalCode: strings.TrimSpace(record[0]),
+			Settlement: strings.TrimSpace(record[1]),
+			County:     strings.TrimSpace(record[2]),
+		}
+		if !IsPostalCode(place.PostalCode) || place.Settlement == "" {
+			return nil, fmt.Errorf("postal codebook line %d: invalid place %v", i+2, record)
+		}
+		codebook.byCode[place.PostalCode] = append(codebook.byCode[place.PostalCode], place)
+		key := strings.ToLower(place.Settlement)
+		codebook.bySettlement[key] = append(codebook.bySettlement[key], place)
+	}
+	return codebook, nil
+}
+
+// Len returns the number of places in the codebook
+func (c *Codebook) Len() int {
+	count := 0
+	for _, places := range c.byCode {
+		count += len(places)
+	}
+	return count
+}
+
+// Lookup returns the place of a settlement served by a postal code, the
+// settlement name is matched ignoring case
+func (c *Codebook) Lookup(postalCode, settlement string) (Place, error) {
+	places, ok := c.byCode[strings.TrimSpace(postalCode)]
+	if !ok {
+		return Place{}, cerror.ErrBadPostalCode
+	}
+	for _, place := range places {
+		if strings.EqualFold(place.Settlement, strings.TrimSpace(settlement)) {
+			return place, nil
+		}
+	}
+	return Place{}, cerror.ErrBadSettlement
+}
+
+// PostOffice returns the place of the post office of a postal code
+func (c *Codebook) PostOffice(postalCode string) (Place, bool) {
+	places, ok := c.byCode[postalCode]
+	if !ok {
+		return Place{}, false
+	}
+	return places[0], true
+}
+
+// Settlement returns the place of a settlement name if it is unambiguous, a
+// settlement served by several postal codes of one county gets the first
+func (c *Codebook) Settlement(name string) (Place, bool) {
+	places := c.bySettlement[strings.ToLower(strings.TrimSpace(name))]
+	if len(places) == 0 {
+		return Place{}, false
+	}
+	for _, place := range places[1:] {
+		if place.County != places[0].County {
+			return Place{}, false
+		}
+	}
+	return places[0], true
+}
+
+// IsPostalCode reports whether s has the 5 digits of a Croatian postal code
+func IsPostalCode(s string) bool {
+	if len(s) != 5 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
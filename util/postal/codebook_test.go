@@ -0,0 +1,99 @@
+package postal_test
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/postal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCodebook = `# test places
+postalCode;settlement;county
+10000;Zagreb;Grad Zagreb
+10000;Odra;Grad Zagreb
+10020;Zagreb;Grad Zagreb
+21000;Split;Splitsko-dalmatinska
+31000;Osijek;Osječko-baranjska
+44000;Lug;Sisačko-moslavačka
+31328;Lug;Osječko-baranjska
+`
+
+func readCodebook(t *testing.T) *postal.Codebook {
+	codebook, err := postal.Read(strings.NewReader(testCodebook))
+	require.NoError(t, err)
+	return codebook
+}
+
+func TestRead(t *testing.T) {
+	codebook := readCodebook(t)
+	assert.Equal(t, 7, codebook.Len())
+
+	_, err := postal.Read(strings.NewReader("postalCode;settlement;county\n1000;Zagreb;Grad Zagreb\n"))
+	assert.Error(t, err)
+	_, err = postal.Read(strings.NewReader("postalCode;settlement;county\n"))
+	assert.Error(t, err)
+}
+
+func TestLoad_DataFile(t *testing.T) {
+	codebook, err := postal.Load("../../data/postal_codes.csv")
+	require.NoError(t, err)
+
+	place, err := codebook.Lookup("10000", "zagreb")
+	require.NoError(t, err)
+	assert.Equal(t, "Grad Zagreb", place.County)
+}
+
+func TestLoadAtLeast(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "postal_codes.csv")
+	require.NoError(t, os.WriteFile(path, []byte(testCodebook), 0o600))
+
+	codebook, err := postal.LoadAtLeast(path, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 7, codebook.Len())
+
+	_, err = postal.LoadAtLeast(path, 8)
+	assert.ErrorContains(t, err, "at least 8")
+}
+
+func TestLookup(t *testing.T) {
+	codebook := readCodebook(t)
+
+	place, err := codebook.Lookup("10000", " odra ")
+	require.NoError(t, err)
+	assert.Equal(t, postal.Place{PostalCode: "10000", Settlement: "Odra", County: "Grad Zagreb"}, place)
+
+	_, err = codebook.Lookup("10001", "Zagreb")
+	assert.ErrorIs(t, err, cerror.ErrBadPostalCode)
+	_, err = codebook.Lookup("21000", "Zagreb")
+	assert.ErrorIs(t, err, cerror.ErrBadSettlement)
+}
+
+func TestParse(t *testing.T) {
+	codebook := readCodebook(t)
+
+	tests := []struct {
+		text string
+		want model.Address
+		ok   bool
+	}{
+		{"Ilica 1, 10000 Zagreb", model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb", County: "Grad Zagreb"}, true},
+		{"Odranska  12 a, 10000 ODRA", model.Address{Street: "Odranska", HouseNumber: "12a", PostalCode: "10000", Settlement: "Odra", County: "Grad Zagreb"}, true},
+		{"Split, Ulica kralja Tomislava bb", model.Address{Street: "Ulica kralja Tomislava", HouseNumber: "bb", PostalCode: "21000", Settlement: "Split", County: "Splitsko-dalmatinska"}, true},
+		{"123 Main St, 31000", model.Address{Street: "Main St", HouseNumber: "123", PostalCode: "31000", Settlement: "Osijek", County: "Osječko-baranjska"}, true},
+		{"Zagreb", model.Address{PostalCode: "10000", Settlement: "Zagreb", County: "Grad Zagreb"}, true},
+		{"Glavna 3, Lug", model.Address{Street: "Glavna 3, Lug"}, false},
+		{"Neverland", model.Address{Street: "Neverland"}, false},
+		{"", model.Address{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := codebook.Parse(tt.text)
+		assert.Equal(t, tt.ok, ok, tt.text)
+		assert.Equal(t, tt.want, got, tt.text)
+	}
+}
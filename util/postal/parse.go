@@ -0,0 +1,76 @@
+package postal
+
+import (
+	"ePrometna_Server/model"
+	"regexp"
+	"strings"
+)
+
+var (
+	// placeRe matches a postal code with an optional settlement, e.g. 10000 Zagreb
+	placeRe = regexp.MustCompile(`^(\d{5})\s*(.*)$`)
+	// numberLastRe matches a street followed by a house number, e.g. Ilica 12a
+	numberLastRe = regexp.MustCompile(`(?i)^(.*\S)\s+(\d+\s?[a-z]?|bb|b\.b\.)$`)
+	// numberFirstRe matches a house number followed by a street, e.g. 123 Main St
+	numberFirstRe = regexp.MustCompile(`^(\d+[a-zA-Z]?)\s+(.+)$`)
+)
+
+// Parse splits a free text address, e.g. "Ilica 1, 10000 Zagreb", into an
+// address. The place is taken from the codebook, ok is false if no part of
+// the text names one and then the whole text is kept as the street.
+func (c *Codebook) Parse(text string) (address model.Address, ok bool) {
+	var parts []string
+	for _, part := range strings.Split(text, ",") {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	place, at := c.findPlace(parts)
+	if at < 0 {
+		return model.Address{Street: strings.TrimSpace(text)}, false
+	}
+
+	address = model.Address{
+		PostalCode: place.PostalCode,
+		Settlement: place.Settlement,
+		County:     place.County,
+	}
+	street := strings.Join(append(parts[:at:at], parts[at+1:]...), ", ")
+	if m := numberLastRe.FindStringSubmatch(street); m != nil {
+		address.Street, address.HouseNumber = m[1], strings.ReplaceAll(m[2], " ", "")
+	} else if m := numberFirstRe.FindStringSubmatch(street); m != nil {
+		address.Street, address.HouseNumber = m[2], m[1]
+	} else {
+		address.Street = street
+	}
+	return address, true
+}
+
+// findPlace returns the place named by one of the parts and its index, a
+// postal code is preferred over a settlement name, which is searched from
+// the last part
+func (c *Codebook) findPlace(parts []string) (Place, int) {
+	for i, part := range parts {
+		m := placeRe.FindStringSubmatch(part)
+		if m == nil {
+			continue
+		}
+		if m[2] == "" {
+			if place, ok := c.PostOffice(m[1]); ok {
+				return place, i
+			}
+			continue
+		}
+		if place, err := c.Lookup(m[1], m[2]); err == nil {
+			return place, i
+		}
+	}
+
+	for i := len(parts) - 1; i >= 0; i-- {
+		if place, ok := c.Settlement(parts[i]); ok {
+			return place, i
+		}
+	}
+	return Place{}, -1
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Condition is the match condition and score of a searched column
+type Condition struct {
+	Where clause.Expr
+	Score clause.Expr
+}
+
+// Similar matches rows whose column, a lowercase expression, is similar to
+// query or contains it. On Postgres both operators use the trigram index of
+// the expression.
+func Similar(db *gorm.DB, column, query string) Condition {
+	query = strings.ToLower(query)
+	contains := "%" + escapeLike(query) + "%"
+
+	where := clause.Expr{SQL: "(" + column + " % ? OR " + column + " LIKE ? ESCAPE '\\')", Vars: []any{query, contains}}
+	if !isPostgres(db) {
+		where = clause.Expr{SQL: "(similarity(" + column + ", ?) >= ? OR " + column + " LIKE ? ESCAPE '\\')", Vars: []any{query, Threshold, contains}}
+	}
+	return Condition{
+		Where: where,
+		Score: clause.Expr{SQL: "similarity(" + column + ", ?)", Vars: []any{query}},
+	}
+}
+
+// Prefix matches rows whose column starts with query, they all score 1
+func Prefix(column, query string) Condition {
+	return Condition{
+		Where: clause.Expr{SQL: column + " LIKE ? ESCAPE '\\'", Vars: []any{escapeLike(query) + "%"}},
+		Score: clause.Expr{SQL: "1.0"},
+	}
+}
+
+// Any matches rows any of the conditions matches, scored by the best of them
+func Any(db *gorm.DB, conditions ...Condition) Condition {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+
+	where := make([]string, 0, len(conditions))
+	score := make([]string, 0, len(conditions))
+	var whereVars, scoreVars []any
+	for _, c := range conditions {
+		where = append(where, c.Where.SQL)
+		whereVars = append(whereVars, c.Where.Vars...)
+		score = append(score, c.Score.SQL)
+		scoreVars = append(scoreVars, c.Score.Vars...)
+	}
+
+	// MAX with more than one argument is the scalar function on SQLite
+	greatest := "MAX("
+	if isPostgres(db) {
+		greatest = "GREATEST("
+	}
+	return Condition{
+		Where: clause.Expr{SQL: "(" + strings.Join(where, " OR ") + ")", Vars: whereVars},
+		Score: clause.Expr{SQL: greatest + strings.Join(score, ", ") + ")", Vars: scoreVars},
+	}
+}
+
+func isPostgres(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,26 @@
+package search
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SqliteDriver is the SQLite driver with the similarity function of pg_trgm,
+// so searches run the same queries on the test database
+const SqliteDriver = "sqlite3_search"
+
+func init() {
+	sql.Register(SqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("similarity", Similarity, true)
+		},
+	})
+}
+
+// OpenSqlite opens the SQLite database dsn with the search functions
+func OpenSqlite(dsn string) gorm.Dialector {
+	return sqlite.New(sqlite.Config{DriverName: SqliteDriver, DSN: dsn})
+}
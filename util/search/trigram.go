@@ -0,0 +1,44 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Threshold is the least similarity of a match, the default of
+// pg_trgm.similarity_threshold
+const Threshold = 0.3
+
+// Similarity is the trigram similarity of a and b as pg_trgm computes it:
+// shared trigrams of both words divided by all of their trigrams. Words are
+// runs of letters and digits, compared ignoring case.
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]struct{} {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	set := make(map[string]struct{})
+	for _, word := range words {
+		// every word starts with two spaces and ends with one
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
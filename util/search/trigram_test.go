@@ -0,0 +1,18 @@
+package search_test
+
+import (
+	"ePrometna_Server/util/search"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, search.Similarity("Ivan Horvat", "ivan  HORVAT"))
+	assert.Equal(t, 0.0, search.Similarity("ivan", "zzz"))
+	assert.Equal(t, 0.0, search.Similarity("", ""))
+	// same as SELECT similarity('word', 'two words') on pg_trgm
+	assert.InDelta(t, 0.3636, search.Similarity("word", "two words"), 0.0001)
+	assert.Greater(t, search.Similarity("Jonatan", "Jonathan"), search.Threshold)
+	assert.Greater(t, search.Similarity("Čakovec", "cakovec"), 0.0)
+}
@@ -12,7 +12,9 @@ import (
 
 const (
 	_PASSWORD_ENV = "SUPERADMIN_PASSWORD"
-	_OIB          = "11111111111"
+	_OIB          = "11111111119"
+	// _LEGACY_OIB was seeded before OIBs were validated, it has no valid check digit
+	_LEGACY_OIB = "11111111111"
 )
 
 // CreateSuperAdmin creates a SuperAdmin user if one doesn't already exist.
@@ -25,6 +27,9 @@ func createSuperAdmin() error {
 	// Check if SuperAdmin exists
 	{
 		_, err := userCrud.GetUserByOIB(_OIB)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_, err = userCrud.GetUserByOIB(_LEGACY_OIB)
+		}
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				zap.S().Infof("SuperAdmin not found, err %+v", err)
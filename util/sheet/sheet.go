@@ -0,0 +1,78 @@
+package sheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnreadable is returned for files that are neither CSV nor XLSX
+	ErrUnreadable = errors.New("file is not a CSV or XLSX sheet")
+	// ErrTooLarge is returned for sheets with more than maxRows rows
+	ErrTooLarge = errors.New("sheet has too many rows")
+)
+
+// maxRows limits the rows of a sheet, including empty ones, callers check
+// their own smaller limit after reading
+const maxRows = 10000
+
+var zipMagic = []byte("PK\x03\x04")
+
+// Read returns the rows of a CSV file or of the first sheet of an XLSX
+// workbook, the format is told by the content. Cells are trimmed and empty
+// trailing rows are dropped.
+func Read(data []byte) ([][]string, error) {
+	var rows [][]string
+	var err error
+	if bytes.HasPrefix(data, zipMagic) {
+		rows, err = readXlsx(data)
+	} else {
+		rows, err = readCsv(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+	}
+	for len(rows) > 0 && isEmpty(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+// readCsv reads comma or semicolon separated values, spreadsheets set to
+// Croatian locale export the latter
+func readCsv(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Join(ErrUnreadable, err)
+	}
+	if len(rows) > maxRows {
+		return nil, ErrTooLarge
+	}
+	return rows, nil
+}
+
+// isEmpty reports whether every cell of the row is empty
+func isEmpty(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package sheet_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"ePrometna_Server/util/sheet"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead_Csv(t *testing.T) {
+	rows, err := sheet.Read([]byte("\ufeffime;oib\n Ana ;12345678903\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"ime", "oib"}, {"Ana", "12345678903"}}, rows)
+
+	rows, err = sheet.Read([]byte("name,residence\nIvo,\"Zagreb, Ilica 1\"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Zagreb, Ilica 1", rows[1][1])
+
+	_, err = sheet.Read([]byte("a,\"b\nc"))
+	assert.ErrorIs(t, err, sheet.ErrUnreadable)
+}
+
+// xlsx zips a workbook with the given first worksheet
+func xlsx(t *testing.T, worksheet string) []byte {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+			xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Users" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId3" Type="worksheet" Target="worksheets/users.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>name</t></si><si><r><t>An</t></r><r><t>a</t></r></si></sst>`,
+		"xl/worksheets/users.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			worksheet + `</sheetData></worksheet>`,
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestRead_Xlsx(t *testing.T) {
+	rows, err := sheet.Read(xlsx(t, `
+		<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>born</t></is></c></row>
+		<row r="2"><c r="A2" t="s"><v>1</v></c><c r="C2"><v>31048</v></c></row>`))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name", "", "born"}, {"Ana", "", "31048"}}, rows)
+}
+
+func TestRead_XlsxBounds(t *testing.T) {
+	_, err := sheet.Read(xlsx(t, `<row r="1"><c r="ZZZZZZZZZZZZ1"><v>x</v></c></row>`))
+	assert.ErrorIs(t, err, sheet.ErrUnreadable)
+
+	_, err = sheet.Read(xlsx(t, `<row r="1"><c r="XFE1"><v>x</v></c></row>`))
+	assert.ErrorIs(t, err, sheet.ErrUnreadable)
+
+	_, err = sheet.Read(xlsx(t, `
+		<row r="1"><c r="A1"><v>name</v></c><c r="B1"><v>oib</v></c></row>
+		<row r="2"><c r="A2"><v>Ana</v></c><c r="XFD2"><v>x</v></c></row>`))
+	assert.ErrorIs(t, err, sheet.ErrUnreadable)
+
+	_, err = sheet.Read(xlsx(t, strings.Repeat(`<row><c><v>1</v></c></row>`, 10001)))
+	assert.ErrorIs(t, err, sheet.ErrTooLarge)
+}
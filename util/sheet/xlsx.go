@@ -0,0 +1,229 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxPartSize limits a decompressed part of a workbook, a few MB of sheet
+	// must not unpack into gigabytes
+	maxPartSize = 64 << 20
+	// maxColumn is the last column of a worksheet, XFD
+	maxColumn = 16383
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string, rich text is split in runs
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxRow struct {
+	Cells []struct {
+		Ref    string   `xml:"r,attr"`
+		Type   string   `xml:"t,attr"`
+		Value  string   `xml:"v"`
+		Inline xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+// readXlsx reads the first sheet of a workbook
+func readXlsx(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Join(ErrUnreadable, err)
+	}
+	parts := map[string]*zip.File{}
+	for _, file := range archive.File {
+		parts[file.Name] = file
+	}
+
+	sheetPath, err := firstSheetPath(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(parts, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	return readWorksheet(parts, sheetPath, shared)
+}
+
+// readWorksheet decodes the rows of a worksheet one by one, so a sheet with
+// too many rows is rejected before it is held in memory. Cells can't be
+// right of the header row.
+func readWorksheet(parts map[string]*zip.File, name string, shared xlsxSharedStrings) ([][]string, error) {
+	file, ok := parts[name]
+	if !ok {
+		return nil, ErrUnreadable
+	}
+	r, err := file.Open()
+	if err != nil {
+		return nil, errors.Join(ErrUnreadable, err)
+	}
+	defer r.Close()
+
+	rows := [][]string{}
+	decoder := xml.NewDecoder(io.LimitReader(r, maxPartSize))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, errors.Join(ErrUnreadable, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		if len(rows) >= maxRows {
+			return nil, ErrTooLarge
+		}
+
+		var xmlRow xlsxRow
+		if err := decoder.DecodeElement(&xmlRow, &start); err != nil {
+			return nil, errors.Join(ErrUnreadable, err)
+		}
+		width := maxColumn + 1
+		if len(rows) > 0 {
+			width = len(rows[0])
+		}
+		row, err := sheetRow(xmlRow, shared, width)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// sheetRow returns the cells of a row with fewer than width columns
+func sheetRow(xmlRow xlsxRow, shared xlsxSharedStrings, width int) ([]string, error) {
+	row := []string{}
+	for _, cell := range xmlRow.Cells {
+		col := columnIndex(cell.Ref)
+		if col < 0 {
+			col = len(row)
+		}
+		if col >= width {
+			return nil, ErrUnreadable
+		}
+		for len(row) <= col {
+			row = append(row, "")
+		}
+
+		switch cell.Type {
+		case "s":
+			i, err := strconv.Atoi(cell.Value)
+			if err != nil || i < 0 || i >= len(shared.Items) {
+				return nil, ErrUnreadable
+			}
+			row[col] = shared.Items[i].String()
+		case "inlineStr":
+			row[col] = cell.Inline.String()
+		default:
+			row[col] = cell.Value
+		}
+	}
+	return row, nil
+}
+
+// firstSheetPath finds the part of the first sheet through the workbook relationships
+func firstSheetPath(parts map[string]*zip.File) (string, error) {
+	var workbook xlsxWorkbook
+	if err := decodePart(parts, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	var rels xlsxRelationships
+	if err := decodePart(parts, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", ErrUnreadable
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.Id != workbook.Sheets[0].Id {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", ErrUnreadable
+}
+
+func decodePart(parts map[string]*zip.File, name string, v any) error {
+	file, ok := parts[name]
+	if !ok {
+		return ErrUnreadable
+	}
+	r, err := file.Open()
+	if err != nil {
+		return errors.Join(ErrUnreadable, err)
+	}
+	defer r.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(r, maxPartSize)).Decode(v); err != nil {
+		return errors.Join(ErrUnreadable, err)
+	}
+	return nil
+}
+
+// columnIndex returns the zero based column of a cell reference, e.g. 27 for
+// AB3, references past the last column return maxColumn+1
+func columnIndex(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		if col > maxColumn+1 {
+			return maxColumn + 1
+		}
+	}
+	return col - 1
+}
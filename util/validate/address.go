@@ -0,0 +1,70 @@
+package validate
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/postal"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+var postalCodebook atomic.Pointer[postal.Codebook]
+
+// SetPostalCodebook installs the codebook addresses are checked against, with
+// nil only the format of postal codes is checked
+func SetPostalCodebook(codebook *postal.Codebook) {
+	postalCodebook.Store(codebook)
+}
+
+// Address checks the fields of an address under the field name prefix, e.g.
+// residence.postalCode, or without it if prefix is empty. The settlement and county are set as written in the
+// codebook. Every failure is returned as a *cerror.FieldError joined into one
+// error.
+func Address(prefix string, address *model.Address) error {
+	address.Street = strings.TrimSpace(address.Street)
+	address.HouseNumber = strings.TrimSpace(address.HouseNumber)
+	address.PostalCode = strings.TrimSpace(address.PostalCode)
+	address.Settlement = strings.TrimSpace(address.Settlement)
+
+	var errs []error
+	for _, field := range []struct{ name, value string }{
+		{"street", address.Street},
+		{"houseNumber", address.HouseNumber},
+		{"postalCode", address.PostalCode},
+		{"settlement", address.Settlement},
+	} {
+		if field.value == "" {
+			errs = append(errs, &cerror.FieldError{Field: fieldName(prefix, field.name), Err: cerror.ErrRequired})
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	codebook := postalCodebook.Load()
+	if codebook == nil {
+		if !postal.IsPostalCode(address.PostalCode) {
+			return &cerror.FieldError{Field: fieldName(prefix, "postalCode"), Err: cerror.ErrBadPostalCode}
+		}
+		return nil
+	}
+
+	place, err := codebook.Lookup(address.PostalCode, address.Settlement)
+	if errors.Is(err, cerror.ErrBadPostalCode) {
+		return &cerror.FieldError{Field: fieldName(prefix, "postalCode"), Err: err}
+	}
+	if err != nil {
+		return &cerror.FieldError{Field: fieldName(prefix, "settlement"), Err: err}
+	}
+	address.Settlement = place.Settlement
+	address.County = place.County
+	return nil
+}
+
+func fieldName(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	return prefix + "." + field
+}
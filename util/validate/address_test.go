@@ -0,0 +1,45 @@
+package validate_test
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/postal"
+	"ePrometna_Server/util/validate"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddress(t *testing.T) {
+	codebook, err := postal.Read(strings.NewReader("postalCode;settlement;county\n10000;Zagreb;Grad Zagreb\n21000;Split;Splitsko-dalmatinska\n"))
+	require.NoError(t, err)
+	validate.SetPostalCodebook(codebook)
+	defer validate.SetPostalCodebook(nil)
+
+	address := &model.Address{Street: " Ilica ", HouseNumber: "1", PostalCode: "10000", Settlement: "zagreb"}
+	require.NoError(t, validate.Address("residence", address))
+	assert.Equal(t, model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb", County: "Grad Zagreb"}, *address)
+
+	tests := []struct {
+		address model.Address
+		field   string
+		want    error
+	}{
+		{model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10001", Settlement: "Zagreb"}, "residence.postalCode", cerror.ErrBadPostalCode},
+		{model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "21000", Settlement: "Zagreb"}, "residence.settlement", cerror.ErrBadSettlement},
+		{model.Address{Street: "Ilica", PostalCode: "10000", Settlement: "Zagreb"}, "residence.houseNumber", cerror.ErrRequired},
+	}
+	for _, tt := range tests {
+		fieldErrs := cerror.FieldErrors(validate.Address("residence", &tt.address))
+		require.Len(t, fieldErrs, 1, tt.field)
+		assert.Equal(t, tt.field, fieldErrs[0].Field)
+		assert.ErrorIs(t, fieldErrs[0], tt.want)
+	}
+}
+
+func TestAddress_NoCodebook(t *testing.T) {
+	assert.NoError(t, validate.Address("residence", &model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "99999", Settlement: "Zagreb"}))
+	assert.ErrorIs(t, validate.Address("residence", &model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "1000", Settlement: "Zagreb"}), cerror.ErrBadPostalCode)
+}
@@ -0,0 +1,82 @@
+package validate
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MaxAge is the age in years of the oldest plausible birth date
+const MaxAge = 130
+
+// Oib checks an OIB is 11 digits ending with the ISO 7064 MOD 11,10 check
+// digit of the first ten
+func Oib(oib string) error {
+	if len(oib) != 11 {
+		return cerror.ErrInvalidOib
+	}
+
+	a := 10
+	for i := 0; i < 10; i++ {
+		digit := oib[i]
+		if digit < '0' || digit > '9' {
+			return cerror.ErrInvalidOib
+		}
+		a = (a + int(digit-'0')) % 10
+		if a == 0 {
+			a = 10
+		}
+		a = a * 2 % 11
+	}
+
+	check := (11 - a) % 10
+	if oib[10] != byte('0'+check) {
+		return cerror.ErrInvalidOib
+	}
+	return nil
+}
+
+// BirthDate checks the birth date is in the past and at most MaxAge years ago
+func BirthDate(birthDate time.Time) error {
+	now := time.Now()
+	if birthDate.After(now) || birthDate.Before(now.AddDate(-MaxAge, 0, 0)) {
+		return cerror.ErrInvalidBirthDate
+	}
+	return nil
+}
+
+// Email checks email is a bare address with a domain, e.g. ivan@example.com,
+// display names and comments aren't accepted
+func Email(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return cerror.ErrInvalidEmail
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return cerror.ErrInvalidEmail
+	}
+	return nil
+}
+
+// User checks the OIB, birth date, email and residence of a user, every
+// failure is returned as a *cerror.FieldError joined into one error
+func User(user *model.User) error {
+	var errs []error
+	if err := Oib(user.OIB); err != nil {
+		errs = append(errs, &cerror.FieldError{Field: "oib", Err: err})
+	}
+	if err := BirthDate(user.BirthDate); err != nil {
+		errs = append(errs, &cerror.FieldError{Field: "birthDate", Err: err})
+	}
+	if err := Email(user.Email); err != nil {
+		errs = append(errs, &cerror.FieldError{Field: "email", Err: err})
+	}
+	if err := Address("residence", &user.Residence); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package validate_test
+
+import (
+	"ePrometna_Server/model"
+	"ePrometna_Server/util/cerror"
+	"ePrometna_Server/util/validate"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOib(t *testing.T) {
+	for _, oib := range []string{"72352576276", "02535077085", "12345678903", "11111111119"} {
+		assert.NoError(t, validate.Oib(oib), oib)
+	}
+	for _, oib := range []string{"", "7235257627", "723525762760", "72352576277", "11111111111", "7235257627a", "a2352576276"} {
+		assert.ErrorIs(t, validate.Oib(oib), cerror.ErrInvalidOib, oib)
+	}
+}
+
+func TestBirthDate(t *testing.T) {
+	assert.NoError(t, validate.BirthDate(time.Now().AddDate(-30, 0, 0)))
+	assert.NoError(t, validate.BirthDate(time.Now().AddDate(0, 0, -1)))
+	assert.ErrorIs(t, validate.BirthDate(time.Now().AddDate(0, 0, 1)), cerror.ErrInvalidBirthDate)
+	assert.ErrorIs(t, validate.BirthDate(time.Now().AddDate(-validate.MaxAge-1, 0, 0)), cerror.ErrInvalidBirthDate)
+	assert.ErrorIs(t, validate.BirthDate(time.Time{}), cerror.ErrInvalidBirthDate)
+}
+
+func TestEmail(t *testing.T) {
+	for _, email := range []string{"ivan@example.com", "ivan.horvat+mup@gov.example.hr"} {
+		assert.NoError(t, validate.Email(email), email)
+	}
+	for _, email := range []string{"", "ivan", "ivan@", "ivan@localhost", "Ivan <ivan@example.com>", " ivan@example.com", "ivan@example."} {
+		assert.ErrorIs(t, validate.Email(email), cerror.ErrInvalidEmail, email)
+	}
+}
+
+func TestUser(t *testing.T) {
+	user := &model.User{
+		OIB:       "72352576276",
+		Email:     "ivan@example.com",
+		BirthDate: time.Now().AddDate(-30, 0, 0),
+		Residence: model.Address{Street: "Ilica", HouseNumber: "1", PostalCode: "10000", Settlement: "Zagreb"},
+	}
+	assert.NoError(t, validate.User(user))
+
+	user.OIB = "72352576277"
+	user.Email = "ivan"
+	err := validate.User(user)
+	assert.ErrorIs(t, err, cerror.ErrInvalidOib)
+	assert.ErrorIs(t, err, cerror.ErrInvalidEmail)
+
+	fieldErrs := cerror.FieldErrors(err)
+	require.Len(t, fieldErrs, 2)
+	assert.Equal(t, "oib", fieldErrs[0].Field)
+	assert.Equal(t, "email", fieldErrs[1].Field)
+}